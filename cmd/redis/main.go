@@ -3,16 +3,19 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/burenotti/redis_impl/internal/config"
 	"github.com/burenotti/redis_impl/internal/handler"
 	"github.com/burenotti/redis_impl/internal/server"
 	"github.com/burenotti/redis_impl/internal/service"
 	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/burenotti/redis_impl/pkg/resp"
 )
 
 const (
@@ -35,14 +38,25 @@ func main() {
 	parseFlags()
 
 	cfg := config.MustLoad(configPath)
-	store := memory.New()
-	redis := service.NewService(store, walSize)
+	redis := service.NewService(initDatabases(cfg), walSize)
+	redis.ScriptMonitor().SetThreshold(time.Duration(cfg.BusyReplyThreshold) * time.Millisecond)
+	if cfg.SlowlogLogSlowerThan >= 0 {
+		redis.Use(service.LogSlowCommands(logger, time.Duration(cfg.SlowlogLogSlowerThan)*time.Microsecond))
+	}
 	go func() {
 		redis.Run()
 	}()
 	defer redis.Stop()
 
-	srv := initServer(logger, cfg, redis)
+	srv, err := initServer(logger, cfg, redis)
+	if err != nil {
+		logger.Error("Failed to initialize the server. Exiting.", "error", err)
+		return
+	}
+	if err := loadModules(logger, cfg, redis); err != nil {
+		logger.Error("Failed to load a module. Exiting.", "error", err)
+		return
+	}
 
 	srvDone := make(chan error, 1)
 	go func() {
@@ -62,6 +76,8 @@ func main() {
 		}
 	case sig := <-notify:
 		logger.Info("Received signal. Exiting.", "signal", sig)
+	case <-redis.ShutdownRequested():
+		logger.Info("Shutdown requested by a client. Exiting.")
 	}
 
 	if err := srv.Stop(cfg.Server.ShutdownTimeout); err != nil {
@@ -75,16 +91,46 @@ func main() {
 	}
 }
 
-func initServer(logger *slog.Logger, cfg *config.Config, redis *service.RedisService) *server.Server {
+func initDatabases(cfg *config.Config) []service.Storage {
+	databases := make([]service.Storage, cfg.Databases)
+	for i := range databases {
+		databases[i] = memory.New()
+	}
+	return databases
+}
+
+func initServer(logger *slog.Logger, cfg *config.Config, redis *service.RedisService) (*server.Server, error) {
 	handle := handler.New(func() *service.Client {
 		return service.NewClient(redis)
 	})
+	handle.UseModules(redis.Modules())
+	handle.SetProtoLimits(resp.Limits{
+		MaxBulkLen:      int64(cfg.ProtoMaxBulkLen),
+		MaxMultiBulkLen: cfg.ProtoMaxMultiBulkLen,
+	})
+	for _, rename := range cfg.RenameCommands {
+		if err := handle.RenameCommand(rename.Name, rename.NewName); err != nil {
+			return nil, fmt.Errorf("rename command %s: %w", rename.Name, err)
+		}
+	}
 	srv := server.Default(handle)
 	srv.Host = cfg.Server.Host
 	srv.Port = cfg.Server.Port
 	srv.MaxConnections = cfg.Server.MaxConnections
+	srv.EventLoops = cfg.EventLoops
 	srv.Logger = logger
-	return srv
+	return srv, nil
+}
+
+func loadModules(logger *slog.Logger, cfg *config.Config, redis *service.RedisService) error {
+	for _, m := range cfg.Modules {
+		loaded, err := redis.Modules().Load(m.Path, m.Args)
+		if err != nil {
+			return fmt.Errorf("load module %s: %w", m.Path, err)
+		}
+		logger.Info("Module loaded", "name", loaded.Name, "version", loaded.Version, "path", m.Path)
+	}
+	return nil
 }
 
 func parseFlags() {
@@ -12,7 +12,6 @@ import (
 	"github.com/burenotti/redis_impl/internal/config"
 	"github.com/burenotti/redis_impl/internal/server"
 	"github.com/burenotti/redis_impl/internal/service"
-	"github.com/burenotti/redis_impl/internal/storage/memory"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -46,10 +45,12 @@ func (s *TestSuite) SetupTest() {
 	cfg.Server.Host = "localhost"
 	cfg.Server.Port = 7379
 	cfg.Server.MaxConnections = 10
+	cfg.Databases = 16
 
-	storage := memory.New()
-	s.service = service.NewService(storage, 1000)
-	s.server = initServer(slog.Default(), cfg, s.service)
+	s.service = service.NewService(initDatabases(cfg), 1000)
+	var err error
+	s.server, err = initServer(slog.Default(), cfg, s.service)
+	s.Require().NoError(err)
 	go func() {
 		if err := s.server.Run(); err != nil {
 			if !errors.Is(err, context.Canceled) {
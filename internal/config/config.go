@@ -1,10 +1,15 @@
 package config
 
 import (
-	"github.com/burenotti/redis_impl/pkg/conf"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/burenotti/redis_impl/pkg/conf"
 )
 
+var ErrInvalidConfig = errors.New("invalid config")
+
 type Config struct {
 	Server struct {
 		Host            string
@@ -12,12 +17,40 @@ type Config struct {
 		ShutdownTimeout time.Duration
 		MaxConnections  int
 	}
+	Databases int `redis:"databases" redis-default:"16"`
+	// EventLoops is the number of epoll event loops serving connections on Linux instead of
+	// a goroutine per connection. Zero disables event loops.
+	EventLoops int `redis:"event-loops" redis-default:"0"`
+	// ProtoMaxBulkLen is the maximum length of a bulk string of a request.
+	ProtoMaxBulkLen conf.Bytes `redis:"proto-max-bulk-len" redis-default:"512mb"`
+	// ProtoMaxMultiBulkLen is the maximum number of arguments of a request.
+	ProtoMaxMultiBulkLen int64 `redis:"proto-max-multibulk-len" redis-default:"1048576"`
+	// BusyReplyThreshold is a time in milliseconds after which a running script makes other
+	// clients get BUSY errors. Zero disables the threshold.
+	BusyReplyThreshold int `redis:"busy-reply-threshold" redis-default:"5000"`
+	// SlowlogLogSlowerThan is a time in microseconds after which executed commands are logged
+	// as slow. Negative value disables logging.
+	SlowlogLogSlowerThan int `redis:"slowlog-log-slower-than" redis-default:"10000"`
+	// Modules are loaded on startup by loadmodule directives.
+	Modules []conf.Module `redis:"loadmodule"`
+	// RenameCommands rename or disable built-in commands.
+	RenameCommands []conf.RenameCommand `redis:"rename-command"`
 }
 
 func Load(filePath string) (cfg *Config, err error) {
 	cfg = &Config{}
-	err = conf.BindFile(cfg, filePath)
-	return cfg, err
+	if err = conf.BindFile(cfg, filePath); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+// validate checks values which are parsed, but can't be used.
+func (c *Config) validate() error {
+	if c.Databases < 1 {
+		return fmt.Errorf("%w: databases must be at least 1", ErrInvalidConfig)
+	}
+	return nil
 }
 
 func MustLoad(filePath string) *Config {
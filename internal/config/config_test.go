@@ -0,0 +1,21 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_databases(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	data := "Host 127.0.0.1\nPort 6379\nShutdownTimeout 5000000000\nMaxConnections 16\ndatabases 0\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	_, err := config.Load(path)
+	assert.ErrorIs(t, err, config.ErrInvalidConfig)
+}
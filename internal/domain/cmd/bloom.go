@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+)
+
+const (
+	BFRESERVE = "BF.RESERVE"
+	BFADD     = "BF.ADD"
+	BFMADD    = "BF.MADD"
+	BFEXISTS  = "BF.EXISTS"
+	BFMEXISTS = "BF.MEXISTS"
+	BFINFO    = "BF.INFO"
+)
+
+type BFInfoField string
+
+const (
+	BFInfoAll       BFInfoField = ""
+	BFInfoCapacity  BFInfoField = "CAPACITY"
+	BFInfoSize      BFInfoField = "SIZE"
+	BFInfoFilters   BFInfoField = "FILTERS"
+	BFInfoItems     BFInfoField = "ITEMS"
+	BFInfoExpansion BFInfoField = "EXPANSION"
+)
+
+func getBloom(ctx context.Context, s Storage, key string) (*bloom.Filter, Entry, error) {
+	return getTyped[*bloom.Filter](ctx, s, key, ValueBloom)
+}
+
+// getOrCreateBloom returns a filter stored by key or a new filter with default options.
+// Entry is nil for a new filter.
+func getOrCreateBloom(ctx context.Context, s Storage, key string) (*bloom.Filter, Entry, error) {
+	f, entry, err := getBloom(ctx, s, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		f, err = bloom.New(bloom.Options{ErrorRate: bloom.DefaultErrorRate, Capacity: bloom.DefaultCapacity})
+	}
+	return f, entry, err
+}
+
+// touch stores modified value back to the storage, so the revision of the key is updated.
+// Entry is nil for a new value.
+func touch(ctx context.Context, s Storage, key string, value interface{}, entry Entry) error {
+	if entry == nil {
+		_, err := s.Set(ctx, key, value, nil)
+		return err
+	}
+	_, err := s.Set(ctx, key, value, entry.ExpiresAt())
+	return err
+}
+
+func boolReply(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func BFReserve(key string, opts bloom.Options) (Command, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &bfReserve{key: key, opts: opts}, nil
+}
+
+type bfReserve struct {
+	modifyingCommand
+	key  string
+	opts bloom.Options
+}
+
+func (b *bfReserve) Name() string {
+	return BFRESERVE
+}
+
+func (b *bfReserve) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, b.key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	f, err := bloom.New(b.opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, b.key, f, nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (b *bfReserve) Args() []interface{} {
+	res := []interface{}{BFRESERVE, b.key, formatFloat(b.opts.ErrorRate), int64(b.opts.Capacity)}
+	if b.opts.Expansion != 0 {
+		res = append(res, "EXPANSION", int64(b.opts.Expansion))
+	}
+	if b.opts.NonScaling {
+		res = append(res, "NONSCALING")
+	}
+	return res
+}
+
+// BFAdd adds an item to the filter, which is created with default options if it doesn't exist.
+func BFAdd(key string, item []byte) Command {
+	return &bfAdd{key: key, items: [][]byte{item}}
+}
+
+func BFMAdd(key string, items ...[]byte) Command {
+	return &bfAdd{key: key, items: items, multi: true}
+}
+
+type bfAdd struct {
+	modifyingCommand
+	key   string
+	items [][]byte
+	multi bool
+}
+
+func (b *bfAdd) Name() string {
+	if b.multi {
+		return BFMADD
+	}
+	return BFADD
+}
+
+func (b *bfAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	f, entry, err := getOrCreateBloom(ctx, storage, b.key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(b.items))
+	for i, item := range b.items {
+		added, err := f.Add(item)
+		if err != nil {
+			res[i] = err
+			continue
+		}
+		res[i] = boolReply(added)
+	}
+	if err := touch(ctx, storage, b.key, f, entry); err != nil {
+		return nil, err
+	}
+
+	if b.multi {
+		return NewResult(res), nil
+	}
+	if err, ok := res[0].(error); ok {
+		return nil, err
+	}
+	return NewResult(res[0]), nil
+}
+
+func (b *bfAdd) Args() []interface{} {
+	res := []interface{}{b.Name(), b.key}
+	for _, item := range b.items {
+		res = append(res, item)
+	}
+	return res
+}
+
+// BFExists checks whether an item may be in the filter.
+func BFExists(key string, item []byte) Command {
+	return &bfExists{key: key, items: [][]byte{item}}
+}
+
+func BFMExists(key string, items ...[]byte) Command {
+	return &bfExists{key: key, items: items, multi: true}
+}
+
+type bfExists struct {
+	baseCommand
+	key   string
+	items [][]byte
+	multi bool
+}
+
+func (b *bfExists) Name() string {
+	if b.multi {
+		return BFMEXISTS
+	}
+	return BFEXISTS
+}
+
+func (b *bfExists) Execute(ctx context.Context, c Client) (*Result, error) {
+	f, _, err := getBloom(ctx, c.Storage(), b.key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(b.items))
+	for i, item := range b.items {
+		res[i] = boolReply(f != nil && f.Exists(item))
+	}
+	if b.multi {
+		return NewResult(res), nil
+	}
+	return NewResult(res[0]), nil
+}
+
+func (b *bfExists) Args() []interface{} {
+	res := []interface{}{b.Name(), b.key}
+	for _, item := range b.items {
+		res = append(res, item)
+	}
+	return res
+}
+
+func BFInfo(key string, field BFInfoField) Command {
+	return &bfInfo{key: key, field: field}
+}
+
+type bfInfo struct {
+	baseCommand
+	key   string
+	field BFInfoField
+}
+
+func (b *bfInfo) Name() string {
+	return BFINFO
+}
+
+func (b *bfInfo) Execute(ctx context.Context, c Client) (*Result, error) {
+	f, _, err := getBloom(ctx, c.Storage(), b.key)
+	if err != nil {
+		return nil, err
+	}
+
+	var expansion interface{} = int64(f.Options().Expansion)
+	if f.Options().NonScaling {
+		expansion = NilString()
+	}
+	fields := []struct {
+		field BFInfoField
+		name  string
+		value interface{}
+	}{
+		{BFInfoCapacity, "Capacity", int64(f.Capacity())},
+		{BFInfoSize, "Size", int64(f.Size())},
+		{BFInfoFilters, "Number of filters", int64(f.Filters())},
+		{BFInfoItems, "Number of items inserted", int64(f.Items())},
+		{BFInfoExpansion, "Expansion rate", expansion},
+	}
+
+	var res []interface{}
+	for _, field := range fields {
+		switch b.field {
+		case BFInfoAll:
+			res = append(res, field.name, field.value)
+		case field.field:
+			res = append(res, field.value)
+		}
+	}
+	return NewResult(res), nil
+}
+
+func (b *bfInfo) Args() []interface{} {
+	if b.field == BFInfoAll {
+		return []interface{}{BFINFO, b.key}
+	}
+	return []interface{}{BFINFO, b.key, string(b.field)}
+}
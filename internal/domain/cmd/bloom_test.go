@@ -0,0 +1,39 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBFMAdd_createsFilter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	var stored interface{}
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "bf", cmd.ValueBloom).Return(nil, cmd.ErrKeyNotFound)
+	storage.EXPECT().Set(ctx, "bf", gomock.Any(), nil).DoAndReturn(
+		func(_ context.Context, _ string, value interface{}, _ interface{}) (cmd.Entry, error) {
+			stored = value
+			return &mockValue{value: value}, nil
+		})
+
+	res, err := cmd.BFMAdd("bf", []byte("a"), []byte("b"), []byte("a")).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{int64(1), int64(1), int64(0)}), res)
+
+	f, ok := stored.(*bloom.Filter)
+	require.True(t, ok)
+	assert.Equal(t, uint64(bloom.DefaultCapacity), f.Capacity())
+	assert.Equal(t, cmd.TypeBloom, cmd.TypeOf(f))
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultBusyReplyThreshold is the time after which a running script makes other clients
+// get BUSY errors.
+const DefaultBusyReplyThreshold = 5 * time.Second
+
+var (
+	ErrBusyScript     = errors.New("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+	ErrBusyFunction   = errors.New("BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.")
+	ErrNotBusy        = errors.New("NOTBUSY No scripts in execution right now.")
+	ErrUnkillable     = errors.New("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	ErrScriptKilled   = errors.New("Script killed by user with SCRIPT KILL...")
+	ErrFunctionKilled = errors.New("Script killed by user with FUNCTION KILL...")
+	ErrShutdown       = errors.New("Script killed by server shutdown")
+)
+
+// Unlocked is implemented by commands executed without the global lock, so they are
+// available while a script blocks other clients. Such commands must be safe for concurrent use.
+type Unlocked interface {
+	IsUnlocked() bool
+}
+
+type unlockedCommand struct {
+	baseCommand
+}
+
+func (u *unlockedCommand) IsUnlocked() bool {
+	return true
+}
+
+// ScriptMonitor tracks the running script or function. Once it runs longer than the threshold,
+// it is busy and other clients get BUSY errors. Scripts check their context cooperatively,
+// so killing one cancels its context.
+type ScriptMonitor struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	running   *runningScript
+	busy      bool
+	// changed is closed and replaced when the running script becomes busy or ends.
+	changed chan struct{}
+}
+
+type runningScript struct {
+	function bool
+	wrote    bool
+	cancel   context.CancelCauseFunc
+	timer    *time.Timer
+}
+
+// NewScriptMonitor creates a monitor. Scripts never become busy if the threshold isn't positive.
+func NewScriptMonitor(threshold time.Duration) *ScriptMonitor {
+	return &ScriptMonitor{threshold: threshold, changed: make(chan struct{})}
+}
+
+// SetThreshold changes the threshold for scripts started later.
+func (m *ScriptMonitor) SetThreshold(threshold time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.threshold = threshold
+}
+
+// Start registers a script. The returned context is cancelled with the reason when the script
+// is killed, and done must be called when the script ends. Scripts run under the global lock,
+// so only one of them is registered at a time.
+func (m *ScriptMonitor) Start(ctx context.Context, function bool) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	script := &runningScript{function: function, cancel: cancel}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running = script
+	if m.threshold > 0 {
+		script.timer = time.AfterFunc(m.threshold, func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if m.running == script {
+				m.busy = true
+				m.notify()
+			}
+		})
+	}
+	return ctx, func() {
+		cancel(nil)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if script.timer != nil {
+			script.timer.Stop()
+		}
+		m.running = nil
+		if m.busy {
+			m.busy = false
+			m.notify()
+		}
+	}
+}
+
+func (m *ScriptMonitor) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// Busy returns a BUSY error while the running script is busy, and a channel closed when
+// the state changes.
+func (m *ScriptMonitor) Busy() (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.busy {
+		return m.changed, nil
+	}
+	if m.running.function {
+		return m.changed, ErrBusyFunction
+	}
+	return m.changed, ErrBusyScript
+}
+
+// Wrote marks the running script as one which executed a modifying command, so it can't be killed.
+func (m *ScriptMonitor) Wrote() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running != nil {
+		m.running.wrote = true
+	}
+}
+
+// Kill kills the running script or, if function is set, the running function. Scripts which
+// executed modifying commands can't be killed, because their writes can't be reverted.
+func (m *ScriptMonitor) Kill(function bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.running == nil || m.running.function != function:
+		return ErrNotBusy
+	case m.running.wrote:
+		return ErrUnkillable
+	case function:
+		m.running.cancel(ErrFunctionKilled)
+	default:
+		m.running.cancel(ErrScriptKilled)
+	}
+	return nil
+}
+
+// Abort kills the running script even if it executed modifying commands.
+func (m *ScriptMonitor) Abort() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running != nil {
+		m.running.cancel(ErrShutdown)
+	}
+}
+
+// ScriptKill kills the running script. FunctionKill kills the running function.
+func ScriptKill() Command {
+	return &scriptKill{}
+}
+
+func FunctionKill() Command {
+	return &scriptKill{function: true}
+}
+
+type scriptKill struct {
+	unlockedCommand
+	function bool
+}
+
+func (k *scriptKill) Name() string {
+	if k.function {
+		return FUNCTION
+	}
+	return SCRIPT
+}
+
+func (k *scriptKill) Execute(_ context.Context, c Client) (*Result, error) {
+	if err := c.ScriptMonitor().Kill(k.function); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (k *scriptKill) Args() []interface{} {
+	return []interface{}{k.Name(), "KILL"}
+}
+
+// ShutdownMode is an option of SHUTDOWN. There is no persistence, so modes only differ
+// in handling of busy scripts.
+type ShutdownMode string
+
+const (
+	ShutdownDefault ShutdownMode = ""
+	ShutdownSave    ShutdownMode = "SAVE"
+	// ShutdownNoSave shuts the server down even if a script is busy. The script is killed.
+	ShutdownNoSave ShutdownMode = "NOSAVE"
+)
+
+// Shutdown stops the server.
+func Shutdown(mode ShutdownMode) Command {
+	return &shutdown{mode: mode}
+}
+
+type shutdown struct {
+	unlockedCommand
+	mode ShutdownMode
+}
+
+func (s *shutdown) Name() string {
+	return SHUTDOWN
+}
+
+func (s *shutdown) Execute(_ context.Context, c Client) (*Result, error) {
+	if s.mode != ShutdownNoSave {
+		if _, err := c.ScriptMonitor().Busy(); err != nil {
+			return nil, err
+		}
+	}
+	c.ScriptMonitor().Abort()
+	c.Shutdown()
+	return OkResult(), nil
+}
+
+func (s *shutdown) Args() []interface{} {
+	if s.mode == ShutdownDefault {
+		return []interface{}{SHUTDOWN}
+	}
+	return []interface{}{SHUTDOWN, string(s.mode)}
+}
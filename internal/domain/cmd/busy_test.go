@@ -0,0 +1,83 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptMonitor_busy(t *testing.T) {
+	t.Parallel()
+	m := cmd.NewScriptMonitor(10 * time.Millisecond)
+	changed, err := m.Busy()
+	require.NoError(t, err)
+
+	_, done := m.Start(context.Background(), true)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		require.Fail(t, "script didn't become busy")
+	}
+	changed, err = m.Busy()
+	require.ErrorIs(t, err, cmd.ErrBusyFunction)
+
+	done()
+	<-changed
+	_, err = m.Busy()
+	require.NoError(t, err)
+}
+
+func TestScriptMonitor_kill(t *testing.T) {
+	t.Parallel()
+	m := cmd.NewScriptMonitor(0)
+	require.ErrorIs(t, m.Kill(false), cmd.ErrNotBusy)
+
+	ctx, done := m.Start(context.Background(), false)
+	require.ErrorIs(t, m.Kill(true), cmd.ErrNotBusy)
+	require.NoError(t, m.Kill(false))
+	require.ErrorIs(t, context.Cause(ctx), cmd.ErrScriptKilled)
+	done()
+
+	// Scripts which wrote can only be aborted.
+	ctx, done = m.Start(context.Background(), false)
+	defer done()
+	m.Wrote()
+	require.ErrorIs(t, m.Kill(false), cmd.ErrUnkillable)
+	require.NoError(t, ctx.Err())
+	m.Abort()
+	require.ErrorIs(t, context.Cause(ctx), cmd.ErrShutdown)
+}
+
+func TestEval_killed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	monitor := cmd.NewScriptMonitor(time.Millisecond)
+	client := NewMockClient(ctl)
+	client.EXPECT().Scripts().Return(cmd.NewScriptCache())
+	client.EXPECT().ScriptMonitor().Return(monitor).AnyTimes()
+	client.EXPECT().SelectedDB().Return(0)
+	client.EXPECT().Select(ctx, 0).Return(nil)
+
+	go func() {
+		for {
+			if _, err := monitor.Busy(); err != nil {
+				assert.NoError(t, monitor.Kill(false))
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	// Errors of killed scripts can't be caught by pcall.
+	_, err := cmd.Eval("while true do pcall(function() end) end", nil, nil, false, parseScriptCommand).Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrScriptKilled)
+	_, err = monitor.Busy()
+	require.NoError(t, err)
+}
@@ -17,6 +17,16 @@ const (
 	UNWATCH  = "UNWATCH"
 	HELLO    = "HELLO"
 	REPLCONF = "REPLCONF"
+	SELECT   = "SELECT"
+	SWAPDB   = "SWAPDB"
+	MOVE     = "MOVE"
+	DBSIZE   = "DBSIZE"
+	FLUSHDB  = "FLUSHDB"
+	FLUSHALL = "FLUSHALL"
+	TYPE     = "TYPE"
+	DEL      = "DEL"
+	OBJECT   = "OBJECT"
+	SHUTDOWN = "SHUTDOWN"
 )
 
 func NilString() []byte {
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/algo/cms"
+)
+
+const (
+	CMSINITBYDIM  = "CMS.INITBYDIM"
+	CMSINITBYPROB = "CMS.INITBYPROB"
+	CMSINCRBY     = "CMS.INCRBY"
+	CMSQUERY      = "CMS.QUERY"
+	CMSMERGE      = "CMS.MERGE"
+)
+
+func getCMS(ctx context.Context, s Storage, key string) (*cms.Sketch, Entry, error) {
+	return getTyped[*cms.Sketch](ctx, s, key, ValueCMS)
+}
+
+// CMSInitByDim creates a sketch with the given dimensions.
+func CMSInitByDim(key string, width, depth uint64) (Command, error) {
+	if err := cms.ValidateDimensions(width, depth); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &cmsInit{key: key, width: width, depth: depth}, nil
+}
+
+// CMSInitByProb creates a sketch with dimensions computed from the error rate and
+// the probability of overestimation.
+func CMSInitByProb(key string, errorRate, probability float64) (Command, error) {
+	width, depth, err := cms.Dimensions(errorRate, probability)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &cmsInit{key: key, width: width, depth: depth, errorRate: errorRate, probability: probability}, nil
+}
+
+type cmsInit struct {
+	modifyingCommand
+	key         string
+	width       uint64
+	depth       uint64
+	errorRate   float64
+	probability float64
+}
+
+func (i *cmsInit) Name() string {
+	if i.errorRate != 0 {
+		return CMSINITBYPROB
+	}
+	return CMSINITBYDIM
+}
+
+func (i *cmsInit) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, i.key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	sketch, err := cms.NewByDim(i.width, i.depth)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, i.key, sketch, nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (i *cmsInit) Args() []interface{} {
+	if i.errorRate != 0 {
+		return []interface{}{CMSINITBYPROB, i.key, formatFloat(i.errorRate), formatFloat(i.probability)}
+	}
+	return []interface{}{CMSINITBYDIM, i.key, int64(i.width), int64(i.depth)}
+}
+
+type CMSIncrement struct {
+	Item  []byte
+	Value uint64
+}
+
+func CMSIncrBy(key string, increments ...CMSIncrement) Command {
+	return &cmsIncrBy{key: key, increments: increments}
+}
+
+type cmsIncrBy struct {
+	modifyingCommand
+	key        string
+	increments []CMSIncrement
+}
+
+func (i *cmsIncrBy) Name() string {
+	return CMSINCRBY
+}
+
+func (i *cmsIncrBy) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	sketch, entry, err := getCMS(ctx, storage, i.key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(i.increments))
+	for j, incr := range i.increments {
+		count, err := sketch.IncrBy(incr.Item, incr.Value)
+		if err != nil {
+			res[j] = err
+			continue
+		}
+		res[j] = int64(count)
+	}
+	if err := touch(ctx, storage, i.key, sketch, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(res), nil
+}
+
+func (i *cmsIncrBy) Args() []interface{} {
+	res := []interface{}{CMSINCRBY, i.key}
+	for _, incr := range i.increments {
+		res = append(res, incr.Item, int64(incr.Value))
+	}
+	return res
+}
+
+func CMSQuery(key string, items ...[]byte) Command {
+	return &cmsQuery{key: key, items: items}
+}
+
+type cmsQuery struct {
+	baseCommand
+	key   string
+	items [][]byte
+}
+
+func (q *cmsQuery) Name() string {
+	return CMSQUERY
+}
+
+func (q *cmsQuery) Execute(ctx context.Context, c Client) (*Result, error) {
+	sketch, _, err := getCMS(ctx, c.Storage(), q.key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(q.items))
+	for i, item := range q.items {
+		res[i] = int64(sketch.Query(item))
+	}
+	return NewResult(res), nil
+}
+
+func (q *cmsQuery) Args() []interface{} {
+	res := []interface{}{CMSQUERY, q.key}
+	for _, item := range q.items {
+		res = append(res, item)
+	}
+	return res
+}
+
+// CMSMerge replaces the destination sketch with a weighted sum of sources.
+// Nil weights mean weight 1 for every source.
+func CMSMerge(dest string, sources []string, weights []uint64) (Command, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: at least one source is required", ErrInvalidOpt)
+	}
+	if weights != nil && len(weights) != len(sources) {
+		return nil, fmt.Errorf("%w: amount of weights must be equal to amount of sources", ErrInvalidOpt)
+	}
+	return &cmsMerge{dest: dest, sources: sources, weights: weights}, nil
+}
+
+type cmsMerge struct {
+	modifyingCommand
+	dest    string
+	sources []string
+	weights []uint64
+}
+
+func (m *cmsMerge) Name() string {
+	return CMSMERGE
+}
+
+func (m *cmsMerge) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	dest, entry, err := getCMS(ctx, storage, m.dest)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]*cms.Sketch, len(m.sources))
+	for i, key := range m.sources {
+		if sources[i], _, err = getCMS(ctx, storage, key); err != nil {
+			return nil, err
+		}
+	}
+
+	weights := m.weights
+	if weights == nil {
+		weights = make([]uint64, len(sources))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if err := dest.Merge(sources, weights); err != nil {
+		return nil, err
+	}
+	if err := touch(ctx, storage, m.dest, dest, entry); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (m *cmsMerge) Args() []interface{} {
+	res := []interface{}{CMSMERGE, m.dest, int64(len(m.sources))}
+	for _, src := range m.sources {
+		res = append(res, src)
+	}
+	if m.weights != nil {
+		res = append(res, "WEIGHTS")
+		for _, w := range m.weights {
+			res = append(res, int64(w))
+		}
+	}
+	return res
+}
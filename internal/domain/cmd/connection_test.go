@@ -21,6 +21,14 @@ func (m *mockValue) Value() interface{} {
 	return m.value
 }
 
+func (m *mockValue) Type() cmd.ValueType {
+	return cmd.TypeOfValue(m.value)
+}
+
+func (m *mockValue) Encoding() string {
+	return cmd.EncodingOf(m.value)
+}
+
 func (m *mockValue) ExpiresAt() *time.Time {
 	return m.expiresAt
 }
@@ -59,9 +67,9 @@ func TestGet(t *testing.T) {
 	expected := cmd.NewResult([]byte("artem"), []byte("burenin"), cmd.NilString())
 
 	client.EXPECT().Storage().Return(storage)
-	storage.EXPECT().Get(ctx, "first_name").Return(firstName, nil)
-	storage.EXPECT().Get(ctx, "last_name").Return(lastName, nil)
-	storage.EXPECT().Get(ctx, "middle_name").Return(nil, cmd.ErrKeyNotFound)
+	storage.EXPECT().GetString(ctx, "first_name").Return(firstName.value, firstName, nil)
+	storage.EXPECT().GetString(ctx, "last_name").Return(lastName.value, lastName, nil)
+	storage.EXPECT().GetString(ctx, "middle_name").Return(nil, nil, cmd.ErrKeyNotFound)
 
 	get := cmd.Get("first_name", "last_name", "middle_name")
 	res, err := get.Execute(ctx, client)
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/algo/cuckoo"
+)
+
+const (
+	CFRESERVE = "CF.RESERVE"
+	CFADD     = "CF.ADD"
+	CFADDNX   = "CF.ADDNX"
+	CFDEL     = "CF.DEL"
+	CFEXISTS  = "CF.EXISTS"
+	CFCOUNT   = "CF.COUNT"
+)
+
+func getCuckoo(ctx context.Context, s Storage, key string) (*cuckoo.Filter, Entry, error) {
+	return getTyped[*cuckoo.Filter](ctx, s, key, ValueCuckoo)
+}
+
+func CFReserve(key string, opts cuckoo.Options) (Command, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &cfReserve{key: key, opts: opts}, nil
+}
+
+type cfReserve struct {
+	modifyingCommand
+	key  string
+	opts cuckoo.Options
+}
+
+func (r *cfReserve) Name() string {
+	return CFRESERVE
+}
+
+func (r *cfReserve) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, r.key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	f, err := cuckoo.New(r.opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, r.key, f, nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (r *cfReserve) Args() []interface{} {
+	res := []interface{}{CFRESERVE, r.key, int64(r.opts.Capacity)}
+	if r.opts.BucketSize != 0 {
+		res = append(res, "BUCKETSIZE", int64(r.opts.BucketSize))
+	}
+	if r.opts.MaxIterations != 0 {
+		res = append(res, "MAXITERATIONS", int64(r.opts.MaxIterations))
+	}
+	return append(res, "EXPANSION", int64(r.opts.Expansion))
+}
+
+// CFAdd adds an item to the filter, which is created with default options if it doesn't exist.
+// If nx is set, the item is added only if it doesn't exist yet (CF.ADDNX).
+func CFAdd(key string, item []byte, nx bool) Command {
+	return &cfAdd{key: key, item: item, nx: nx}
+}
+
+type cfAdd struct {
+	modifyingCommand
+	key  string
+	item []byte
+	nx   bool
+}
+
+func (a *cfAdd) Name() string {
+	if a.nx {
+		return CFADDNX
+	}
+	return CFADD
+}
+
+func (a *cfAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	f, entry, err := getCuckoo(ctx, storage, a.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		f, err = cuckoo.New(cuckoo.Options{Capacity: cuckoo.DefaultCapacity, Expansion: cuckoo.DefaultExpansion})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	added := true
+	if a.nx {
+		added, err = f.AddNX(a.item)
+	} else {
+		err = f.Add(a.item)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := touch(ctx, storage, a.key, f, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(boolReply(added)), nil
+}
+
+func (a *cfAdd) Args() []interface{} {
+	return []interface{}{a.Name(), a.key, a.item}
+}
+
+func CFDel(key string, item []byte) Command {
+	return &cfDel{key: key, item: item}
+}
+
+type cfDel struct {
+	modifyingCommand
+	key  string
+	item []byte
+}
+
+func (d *cfDel) Name() string {
+	return CFDEL
+}
+
+func (d *cfDel) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	f, entry, err := getCuckoo(ctx, storage, d.key)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Delete(d.item) {
+		return NewResult(int64(0)), nil
+	}
+	if err := touch(ctx, storage, d.key, f, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(int64(1)), nil
+}
+
+func (d *cfDel) Args() []interface{} {
+	return []interface{}{CFDEL, d.key, d.item}
+}
+
+// CFCount returns estimated amount of occurrences of an item. If exists is set,
+// it only checks whether the item may be in the filter (CF.EXISTS).
+func CFCount(key string, item []byte, exists bool) Command {
+	return &cfCount{key: key, item: item, exists: exists}
+}
+
+type cfCount struct {
+	baseCommand
+	key    string
+	item   []byte
+	exists bool
+}
+
+func (q *cfCount) Name() string {
+	if q.exists {
+		return CFEXISTS
+	}
+	return CFCOUNT
+}
+
+func (q *cfCount) Execute(ctx context.Context, c Client) (*Result, error) {
+	f, _, err := getCuckoo(ctx, c.Storage(), q.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.exists {
+		return NewResult(boolReply(f.Exists(q.item))), nil
+	}
+	return NewResult(int64(f.Count(q.item))), nil
+}
+
+func (q *cfCount) Args() []interface{} {
+	return []interface{}{q.Name(), q.key, q.item}
+}
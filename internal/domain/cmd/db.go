@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrSameDB = errors.New("source and destination objects are the same")
+
+type FlushMode string
+
+const (
+	FlushSync  FlushMode = "SYNC"
+	FlushAsync FlushMode = "ASYNC"
+)
+
+func Select(db int) Command {
+	return &selectDB{db: db}
+}
+
+type selectDB struct {
+	baseCommand
+	db int
+}
+
+func (s *selectDB) Name() string {
+	return SELECT
+}
+
+func (s *selectDB) Execute(ctx context.Context, c Client) (*Result, error) {
+	if err := c.Select(ctx, s.db); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (s *selectDB) Args() []interface{} {
+	return []interface{}{SELECT, int64(s.db)}
+}
+
+func SwapDB(first, second int) Command {
+	return &swapDB{first: first, second: second}
+}
+
+type swapDB struct {
+	modifyingCommand
+	first  int
+	second int
+}
+
+func (s *swapDB) Name() string {
+	return SWAPDB
+}
+
+func (s *swapDB) Execute(ctx context.Context, c Client) (*Result, error) {
+	if err := c.SwapDB(ctx, s.first, s.second); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (s *swapDB) Args() []interface{} {
+	return []interface{}{SWAPDB, int64(s.first), int64(s.second)}
+}
+
+func Move(key string, db int) Command {
+	return &move{key: key, db: db}
+}
+
+type move struct {
+	modifyingCommand
+	key string
+	db  int
+}
+
+func (m *move) Name() string {
+	return MOVE
+}
+
+func (m *move) Execute(ctx context.Context, c Client) (*Result, error) {
+	if m.db == c.SelectedDB() {
+		return nil, ErrSameDB
+	}
+	dst, err := c.Database(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	src := c.Storage()
+	entry, err := src.Get(ctx, m.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dst.Get(ctx, m.key)
+	if err == nil {
+		return NewResult(int64(0)), nil
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	if _, err := dst.Set(ctx, m.key, entry.Value(), entry.ExpiresAt()); err != nil {
+		return nil, err
+	}
+	if _, err := src.Del(ctx, m.key); err != nil {
+		return nil, err
+	}
+	return NewResult(int64(1)), nil
+}
+
+func (m *move) Args() []interface{} {
+	return []interface{}{MOVE, m.key, int64(m.db)}
+}
+
+func DBSize() Command {
+	return &dbSize{}
+}
+
+type dbSize struct {
+	baseCommand
+}
+
+func (d *dbSize) Name() string {
+	return DBSIZE
+}
+
+func (d *dbSize) Execute(ctx context.Context, c Client) (*Result, error) {
+	return NewResult(int64(c.Storage().Len(ctx))), nil
+}
+
+func (d *dbSize) Args() []interface{} {
+	return []interface{}{DBSIZE}
+}
+
+func FlushDB(mode FlushMode) Command {
+	return &flushDB{mode: mode}
+}
+
+type flushDB struct {
+	modifyingCommand
+	mode FlushMode
+}
+
+func (f *flushDB) Name() string {
+	return FLUSHDB
+}
+
+func (f *flushDB) Execute(ctx context.Context, c Client) (*Result, error) {
+	if err := c.Storage().Flush(ctx, f.mode == FlushAsync); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (f *flushDB) Args() []interface{} {
+	return flushArgs(FLUSHDB, f.mode)
+}
+
+func FlushAll(mode FlushMode) Command {
+	return &flushAll{mode: mode}
+}
+
+type flushAll struct {
+	modifyingCommand
+	mode FlushMode
+}
+
+func (f *flushAll) Name() string {
+	return FLUSHALL
+}
+
+func (f *flushAll) Execute(ctx context.Context, c Client) (*Result, error) {
+	for i := 0; i < c.Databases(); i++ {
+		db, err := c.Database(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Flush(ctx, f.mode == FlushAsync); err != nil {
+			return nil, fmt.Errorf("failed to flush db %d: %w", i, err)
+		}
+	}
+	return OkResult(), nil
+}
+
+func (f *flushAll) Args() []interface{} {
+	return flushArgs(FLUSHALL, f.mode)
+}
+
+func flushArgs(name string, mode FlushMode) []interface{} {
+	if mode == "" {
+		return []interface{}{name}
+	}
+	return []interface{}{name, string(mode)}
+}
@@ -0,0 +1,70 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMove(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	src := NewMockStorage(ctl)
+	dst := NewMockStorage(ctl)
+
+	value := &mockValue{value: []byte("artem")}
+
+	client.EXPECT().SelectedDB().Return(0)
+	client.EXPECT().Database(1).Return(dst, nil)
+	client.EXPECT().Storage().Return(src)
+	src.EXPECT().Get(ctx, "first_name").Return(value, nil)
+	dst.EXPECT().Get(ctx, "first_name").Return(nil, cmd.ErrKeyNotFound)
+	dst.EXPECT().Set(ctx, "first_name", []byte("artem"), nil).Return(value, nil)
+	src.EXPECT().Del(ctx, "first_name").Return(value, nil)
+
+	res, err := cmd.Move("first_name", 1).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(1)), res)
+}
+
+func TestMove_sameDB(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().SelectedDB().Return(2)
+
+	_, err := cmd.Move("first_name", 2).Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrSameDB)
+}
+
+func TestFlushAll(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	first := NewMockStorage(ctl)
+	second := NewMockStorage(ctl)
+
+	client.EXPECT().Databases().Return(2).AnyTimes()
+	client.EXPECT().Database(0).Return(first, nil)
+	client.EXPECT().Database(1).Return(second, nil)
+	first.EXPECT().Flush(ctx, true).Return(nil)
+	second.EXPECT().Flush(ctx, true).Return(nil)
+
+	res, err := cmd.FlushAll(cmd.FlushAsync).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.OkResult(), res)
+}
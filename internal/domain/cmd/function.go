@@ -0,0 +1,670 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burenotti/redis_impl/pkg/lua"
+)
+
+const (
+	FUNCTION = "FUNCTION"
+	FCALL    = "FCALL"
+	FCALLRO  = "FCALL_RO"
+)
+
+// Flags of functions. Only FlagNoWrites changes how functions are executed.
+const (
+	FlagNoWrites           = "no-writes"
+	FlagAllowOOM           = "allow-oom"
+	FlagAllowStale         = "allow-stale"
+	FlagNoCluster          = "no-cluster"
+	FlagAllowCrossSlotKeys = "allow-cross-slot-keys"
+)
+
+// functionChunk is the name of libraries in error messages.
+const functionChunk = "user_function"
+
+// loadTimeout limits running code of a library while it registers functions.
+const loadTimeout = 500 * time.Millisecond
+
+// functionsDumpVersion is a version of payloads created by FUNCTION DUMP.
+const functionsDumpVersion = 1
+
+var (
+	ErrFunctionNotFound    = errors.New("Function not found")
+	ErrFunctionExists      = errors.New("Function already exists")
+	ErrFunctionWriteFlag   = errors.New("Can not execute a script with write flag using *_ro command.")
+	ErrFunctionCompile     = errors.New("Error compiling function")
+	ErrFunctionRegister    = errors.New("Error registering functions")
+	ErrFunctionLoadTimeout = errors.New("FUNCTION LOAD timeout")
+	ErrNoFunctions         = errors.New("No functions registered")
+	ErrLibraryNotFound     = errors.New("Library not found")
+	ErrLibraryExists       = errors.New("Library already exists")
+	ErrLibraryMetadata     = errors.New("Missing library metadata")
+	ErrLibraryName         = errors.New("Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	ErrLibraryEngine       = errors.New("Engine not found")
+	ErrFunctionPayload     = errors.New("payload version or checksum are wrong")
+)
+
+var functionFlags = map[string]bool{
+	FlagNoWrites: true, FlagAllowOOM: true, FlagAllowStale: true, FlagNoCluster: true, FlagAllowCrossSlotKeys: true,
+}
+
+var dumpTable = crc64.MakeTable(crc64.ECMA)
+
+// Library is a loaded library. Libraries are immutable, replacing a library creates a new one.
+type Library struct {
+	Name      string
+	Code      string
+	Functions []*LibraryFunction
+	// state runs the library code and keeps globals of the library between calls.
+	state *lua.State
+}
+
+// LibraryFunction is a function registered by a library.
+type LibraryFunction struct {
+	Name        string
+	Description string
+	Flags       []string
+	library     *Library
+	callback    *lua.Function
+}
+
+func (f *LibraryFunction) HasFlag(flag string) bool {
+	return slices.Contains(f.Flags, flag)
+}
+
+// FunctionRegistry holds loaded libraries. Function names are unique across libraries.
+type FunctionRegistry struct {
+	mu        sync.Mutex
+	libraries map[string]*Library
+	functions map[string]*LibraryFunction
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{
+		libraries: make(map[string]*Library),
+		functions: make(map[string]*LibraryFunction),
+	}
+}
+
+// Load loads a library from its code. Loading a library with the name of a loaded one fails
+// unless replace is set. Returns the name of the library.
+func (r *FunctionRegistry) Load(ctx context.Context, code string, replace bool) (string, error) {
+	lib, err := loadLibrary(ctx, code)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	libs := maps.Clone(r.libraries)
+	if err := addLibrary(libs, lib, replace); err != nil {
+		return "", err
+	}
+	r.set(libs)
+	return lib.Name, nil
+}
+
+func (r *FunctionRegistry) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.libraries[name]; !ok {
+		return ErrLibraryNotFound
+	}
+	libs := maps.Clone(r.libraries)
+	delete(libs, name)
+	r.set(libs)
+	return nil
+}
+
+func (r *FunctionRegistry) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(make(map[string]*Library))
+}
+
+func (r *FunctionRegistry) Function(name string) (*LibraryFunction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.functions[name]
+	return f, ok
+}
+
+// Libraries returns libraries sorted by names.
+func (r *FunctionRegistry) Libraries() []*Library {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	libs := make([]*Library, 0, len(r.libraries))
+	for _, lib := range r.libraries {
+		libs = append(libs, lib)
+	}
+	slices.SortFunc(libs, func(a, b *Library) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return libs
+}
+
+// Snapshot returns loaded libraries, so they can be restored with Restore.
+func (r *FunctionRegistry) Snapshot() map[string]*Library {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.libraries
+}
+
+// Restore replaces loaded libraries with a snapshot.
+func (r *FunctionRegistry) Restore(snapshot map[string]*Library) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(snapshot)
+}
+
+// set replaces libraries. Maps of libraries are never modified in place, so snapshots
+// can share them.
+func (r *FunctionRegistry) set(libs map[string]*Library) {
+	r.libraries = libs
+	r.functions = make(map[string]*LibraryFunction)
+	for _, lib := range libs {
+		for _, f := range lib.Functions {
+			r.functions[f.Name] = f
+		}
+	}
+}
+
+// Dump serializes code of all libraries with a version and a checksum.
+func (r *FunctionRegistry) Dump() []byte {
+	var payload []byte
+	for _, lib := range r.Libraries() {
+		payload = binary.AppendUvarint(payload, uint64(len(lib.Code)))
+		payload = append(payload, lib.Code...)
+	}
+	payload = binary.LittleEndian.AppendUint16(payload, functionsDumpVersion)
+	return binary.LittleEndian.AppendUint64(payload, crc64.Checksum(payload, dumpTable))
+}
+
+// RestorePolicy defines how FUNCTION RESTORE treats loaded libraries.
+type RestorePolicy string
+
+const (
+	// RestoreAppend fails if a restored library is already loaded.
+	RestoreAppend RestorePolicy = "APPEND"
+	// RestoreReplace replaces loaded libraries with restored ones.
+	RestoreReplace RestorePolicy = "REPLACE"
+	// RestoreFlush deletes loaded libraries first.
+	RestoreFlush RestorePolicy = "FLUSH"
+)
+
+// RestoreDump loads libraries from a payload created by Dump. Nothing is loaded if any library fails.
+func (r *FunctionRegistry) RestoreDump(ctx context.Context, payload []byte, policy RestorePolicy) error {
+	codes, err := parseDump(payload)
+	if err != nil {
+		return err
+	}
+	loaded := make([]*Library, len(codes))
+	for i, code := range codes {
+		if loaded[i], err = loadLibrary(ctx, code); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	libs := make(map[string]*Library)
+	if policy != RestoreFlush {
+		libs = maps.Clone(r.libraries)
+	}
+	for _, lib := range loaded {
+		if err := addLibrary(libs, lib, policy == RestoreReplace); err != nil {
+			return err
+		}
+	}
+	r.set(libs)
+	return nil
+}
+
+func parseDump(payload []byte) ([]string, error) {
+	const trailer = 10 // version and checksum
+	if len(payload) < trailer {
+		return nil, ErrFunctionPayload
+	}
+	body := payload[:len(payload)-8]
+	if crc64.Checksum(body, dumpTable) != binary.LittleEndian.Uint64(payload[len(body):]) ||
+		binary.LittleEndian.Uint16(body[len(body)-2:]) != functionsDumpVersion {
+		return nil, ErrFunctionPayload
+	}
+	body = body[:len(body)-2]
+	var codes []string
+	for len(body) > 0 {
+		n, size := binary.Uvarint(body)
+		if size <= 0 || n > uint64(len(body)-size) {
+			return nil, ErrFunctionPayload
+		}
+		codes = append(codes, string(body[size:size+int(n)]))
+		body = body[size+int(n):]
+	}
+	return codes, nil
+}
+
+// addLibrary adds a library to libs checking that its name and names of its functions are free.
+func addLibrary(libs map[string]*Library, lib *Library, replace bool) error {
+	if _, ok := libs[lib.Name]; ok && !replace {
+		return fmt.Errorf("%w: %s", ErrLibraryExists, lib.Name)
+	}
+	for name, other := range libs {
+		if name == lib.Name {
+			continue
+		}
+		for _, f := range lib.Functions {
+			if slices.ContainsFunc(other.Functions, func(o *LibraryFunction) bool { return o.Name == f.Name }) {
+				return fmt.Errorf("%w: %s", ErrFunctionExists, f.Name)
+			}
+		}
+	}
+	libs[lib.Name] = lib
+	return nil
+}
+
+// loadLibrary runs code of a library, which registers its functions with redis.register_function.
+// The code starts with a shebang line naming the engine and the library: #!lua name=mylib.
+func loadLibrary(ctx context.Context, code string) (*Library, error) {
+	name, err := parseLibraryMetadata(code)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := lua.Compile(functionChunk, code)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionCompile, singleLine(err.Error()))
+	}
+
+	lib := &Library{Name: name, Code: code, state: lua.NewState()}
+	redis := lua.NewTable(0, 0)
+	redis.SetString("register_function", lua.NewFunction("register_function", lib.register))
+	registerLog(redis)
+	lib.state.SetGlobal("redis", redis)
+
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+	if _, err := lib.state.Run(ctx, chunk); err != nil {
+		var luaErr *lua.Error
+		switch {
+		case errors.As(err, &luaErr):
+			return nil, fmt.Errorf("%w: %s", ErrFunctionRegister, singleLine(luaErr.Error()))
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, ErrFunctionLoadTimeout
+		}
+		return nil, err
+	}
+	if len(lib.Functions) == 0 {
+		return nil, ErrNoFunctions
+	}
+	return lib, nil
+}
+
+func parseLibraryMetadata(code string) (string, error) {
+	line, _, _ := strings.Cut(code, "\n")
+	shebang, ok := strings.CutPrefix(line, "#!")
+	if !ok {
+		return "", ErrLibraryMetadata
+	}
+	fields := strings.Fields(shebang)
+	if len(fields) == 0 {
+		return "", ErrLibraryMetadata
+	}
+	if !strings.EqualFold(fields[0], "lua") {
+		return "", fmt.Errorf("%w: %s", ErrLibraryEngine, fields[0])
+	}
+	var name string
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key != "name" {
+			return "", fmt.Errorf("%w: invalid metadata value given: %s", ErrLibraryMetadata, field)
+		}
+		name = value
+	}
+	if !validFunctionName(name) {
+		return "", ErrLibraryName
+	}
+	return name, nil
+}
+
+// validFunctionName reports whether a name consists of letters, digits and underscores only.
+func validFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// register implements redis.register_function(name, callback) and
+// redis.register_function{function_name=..., callback=..., flags={...}, description=...}.
+func (lib *Library) register(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+	var name, callback, flags, description lua.Value
+	switch len(args) {
+	case 2: //nolint:mnd // name and callback
+		name, callback = args[0], args[1]
+	case 1:
+		t, ok := args[0].(*lua.Table)
+		if !ok {
+			return nil, s.Errorf("calling redis.register_function with a single argument is only applicable to Lua table")
+		}
+		var key lua.Value
+		for {
+			k, v, err := t.Next(key)
+			if err != nil {
+				return nil, err
+			}
+			if k == nil {
+				break
+			}
+			key = k
+			switch k {
+			case "function_name":
+				name = v
+			case "callback":
+				callback = v
+			case "flags":
+				flags = v
+			case "description":
+				description = v
+			default:
+				return nil, s.Errorf("unknown argument given to redis.register_function")
+			}
+		}
+	default:
+		return nil, s.Errorf("wrong number of arguments to redis.register_function")
+	}
+
+	f := &LibraryFunction{library: lib}
+	var ok bool
+	if f.Name, ok = name.(string); !ok {
+		return nil, s.Errorf("function_name argument given to redis.register_function must be a string")
+	}
+	if !validFunctionName(f.Name) {
+		return nil, s.Errorf("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	if f.callback, ok = callback.(*lua.Function); !ok {
+		return nil, s.Errorf("callback argument given to redis.register_function must be a function")
+	}
+	if description != nil {
+		if f.Description, ok = description.(string); !ok {
+			return nil, s.Errorf("description argument given to redis.register_function must be a string")
+		}
+	}
+	if flags != nil {
+		t, ok := flags.(*lua.Table)
+		if !ok {
+			return nil, s.Errorf("flags argument to redis.register_function must be a table representing function flags")
+		}
+		for i := 1; i <= t.Len(); i++ {
+			flag, ok := t.Get(float64(i)).(string)
+			if !ok || !functionFlags[flag] {
+				return nil, s.Errorf("unknown flag given")
+			}
+			f.Flags = append(f.Flags, flag)
+		}
+	}
+	if slices.ContainsFunc(lib.Functions, func(o *LibraryFunction) bool { return o.Name == f.Name }) {
+		return nil, s.Errorf("Function already exists in the library")
+	}
+	lib.Functions = append(lib.Functions, f)
+	return nil, nil
+}
+
+// FCall calls a function with keys and args tables as arguments. Functions without
+// the no-writes flag can't be called by read only calls.
+func FCall(function string, keys, args []string, readOnly bool, parse Parser) Command {
+	return &fcall{function: function, keys: keys, args: args, readOnly: readOnly, parse: parse}
+}
+
+type fcall struct {
+	baseCommand
+	function string
+	keys     []string
+	args     []string
+	readOnly bool
+	parse    Parser
+	effects  []Effect
+}
+
+func (f *fcall) Name() string {
+	if f.readOnly {
+		return FCALLRO
+	}
+	return FCALL
+}
+
+func (f *fcall) IsModifying() bool {
+	return !f.readOnly
+}
+
+func (f *fcall) Execute(ctx context.Context, c Client) (*Result, error) {
+	f.effects = nil
+	fn, ok := c.Functions().Function(f.function)
+	if !ok {
+		return nil, ErrFunctionNotFound
+	}
+	noWrites := fn.HasFlag(FlagNoWrites)
+	if f.readOnly && !noWrites {
+		return nil, ErrFunctionWriteFlag
+	}
+
+	state := fn.library.state
+	run := &scriptRun{client: c, parse: f.parse, readOnly: noWrites, function: true}
+	res, err := run.run(ctx, state, func(ctx context.Context) ([]lua.Value, error) {
+		return state.CallContext(ctx, fn.callback, stringsTable(f.keys), stringsTable(f.args))
+	})
+	f.effects = run.effects
+	return res, err
+}
+
+func (f *fcall) Effects() []Effect {
+	return f.effects
+}
+
+func (f *fcall) Args() []interface{} {
+	res := []interface{}{f.Name(), f.function, int64(len(f.keys))}
+	for _, key := range f.keys {
+		res = append(res, key)
+	}
+	for _, arg := range f.args {
+		res = append(res, arg)
+	}
+	return res
+}
+
+// FunctionLoad loads a library and replies with its name.
+func FunctionLoad(code string, replace bool) Command {
+	return &functionLoad{code: code, replace: replace}
+}
+
+type functionLoad struct {
+	modifyingCommand
+	code    string
+	replace bool
+}
+
+func (l *functionLoad) Name() string {
+	return FUNCTION
+}
+
+func (l *functionLoad) Execute(ctx context.Context, c Client) (*Result, error) {
+	name, err := c.Functions().Load(ctx, l.code, l.replace)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult([]byte(name)), nil
+}
+
+func (l *functionLoad) Args() []interface{} {
+	if l.replace {
+		return []interface{}{FUNCTION, "LOAD", "REPLACE", l.code}
+	}
+	return []interface{}{FUNCTION, "LOAD", l.code}
+}
+
+func FunctionDelete(library string) Command {
+	return &functionDelete{library: library}
+}
+
+type functionDelete struct {
+	modifyingCommand
+	library string
+}
+
+func (d *functionDelete) Name() string {
+	return FUNCTION
+}
+
+func (d *functionDelete) Execute(_ context.Context, c Client) (*Result, error) {
+	if err := c.Functions().Delete(d.library); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (d *functionDelete) Args() []interface{} {
+	return []interface{}{FUNCTION, "DELETE", d.library}
+}
+
+func FunctionFlush() Command {
+	return &functionFlush{}
+}
+
+type functionFlush struct {
+	modifyingCommand
+}
+
+func (f *functionFlush) Name() string {
+	return FUNCTION
+}
+
+func (f *functionFlush) Execute(_ context.Context, c Client) (*Result, error) {
+	c.Functions().Flush()
+	return OkResult(), nil
+}
+
+func (f *functionFlush) Args() []interface{} {
+	return []interface{}{FUNCTION, "FLUSH"}
+}
+
+// FunctionList lists libraries with names matching a glob-style pattern ignoring case.
+// An empty pattern matches all libraries.
+func FunctionList(pattern string, withCode bool) Command {
+	return &functionList{pattern: pattern, withCode: withCode}
+}
+
+type functionList struct {
+	baseCommand
+	pattern  string
+	withCode bool
+}
+
+func (l *functionList) Name() string {
+	return FUNCTION
+}
+
+func (l *functionList) Execute(_ context.Context, c Client) (*Result, error) {
+	res := make([]interface{}, 0)
+	for _, lib := range c.Functions().Libraries() {
+		if l.pattern != "" && !matchPattern(strings.ToLower(l.pattern), strings.ToLower(lib.Name)) {
+			continue
+		}
+		functions := make([]interface{}, len(lib.Functions))
+		for i, f := range lib.Functions {
+			flags := make([]interface{}, len(f.Flags))
+			for j, flag := range f.Flags {
+				flags[j] = []byte(flag)
+			}
+			description := NilString()
+			if f.Description != "" {
+				description = []byte(f.Description)
+			}
+			functions[i] = []interface{}{
+				[]byte("name"), []byte(f.Name),
+				[]byte("description"), description,
+				[]byte("flags"), flags,
+			}
+		}
+		item := []interface{}{
+			[]byte("library_name"), []byte(lib.Name),
+			[]byte("engine"), []byte("LUA"),
+			[]byte("functions"), functions,
+		}
+		if l.withCode {
+			item = append(item, []byte("library_code"), []byte(lib.Code))
+		}
+		res = append(res, item)
+	}
+	return NewResult(res), nil
+}
+
+func (l *functionList) Args() []interface{} {
+	res := []interface{}{FUNCTION, "LIST"}
+	if l.pattern != "" {
+		res = append(res, "LIBRARYNAME", l.pattern)
+	}
+	if l.withCode {
+		res = append(res, "WITHCODE")
+	}
+	return res
+}
+
+// FunctionDump replies with a payload holding all libraries, which is loaded by FunctionRestore.
+func FunctionDump() Command {
+	return &functionDump{}
+}
+
+type functionDump struct {
+	baseCommand
+}
+
+func (d *functionDump) Name() string {
+	return FUNCTION
+}
+
+func (d *functionDump) Execute(_ context.Context, c Client) (*Result, error) {
+	return NewResult(c.Functions().Dump()), nil
+}
+
+func (d *functionDump) Args() []interface{} {
+	return []interface{}{FUNCTION, "DUMP"}
+}
+
+func FunctionRestore(payload []byte, policy RestorePolicy) Command {
+	return &functionRestore{payload: payload, policy: policy}
+}
+
+type functionRestore struct {
+	modifyingCommand
+	payload []byte
+	policy  RestorePolicy
+}
+
+func (r *functionRestore) Name() string {
+	return FUNCTION
+}
+
+func (r *functionRestore) Execute(ctx context.Context, c Client) (*Result, error) {
+	if err := c.Functions().RestoreDump(ctx, r.payload, r.policy); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (r *functionRestore) Args() []interface{} {
+	return []interface{}{FUNCTION, "RESTORE", r.payload, string(r.policy)}
+}
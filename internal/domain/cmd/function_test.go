@@ -0,0 +1,174 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLibrary = `#!lua name=mylib
+local calls = 0
+redis.register_function('count', function(keys, args)
+	calls = calls + 1
+	return {calls, keys[1], args[1]}
+end)
+redis.register_function{
+	function_name = 'put',
+	callback = function(keys, args) return redis.call('SET', keys[1], args[1]) end,
+	description = 'writes a key',
+}
+redis.register_function{
+	function_name = 'try_put',
+	callback = function(keys, args) return redis.call('SET', keys[1], args[1]) end,
+	flags = {'no-writes'},
+}
+`
+
+func TestFCall(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().Functions().Return(cmd.NewFunctionRegistry()).AnyTimes()
+	client.EXPECT().SelectedDB().Return(0).AnyTimes()
+	client.EXPECT().Select(ctx, 0).Return(nil).AnyTimes()
+	client.EXPECT().ScriptMonitor().Return(cmd.NewScriptMonitor(0)).AnyTimes()
+
+	res, err := cmd.FunctionLoad(testLibrary, false).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("mylib")}, res.Values)
+
+	// Globals of libraries are kept between calls.
+	for i := range 2 {
+		res, err = cmd.FCall("count", []string{"k"}, []string{"a"}, false, parseScriptCommand).Execute(ctx, client)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{[]interface{}{int64(i + 1), []byte("k"), []byte("a")}}, res.Values)
+	}
+
+	_, err = cmd.FCall("put", []string{"k"}, []string{"v"}, true, parseScriptCommand).Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrFunctionWriteFlag)
+	_, err = cmd.FCall("try_put", []string{"k"}, []string{"v"}, false, parseScriptCommand).Execute(ctx, client)
+	require.EqualError(t, err, cmd.ErrScriptWrite.Error())
+	_, err = cmd.FCall("missing", nil, nil, false, parseScriptCommand).Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrFunctionNotFound)
+
+	fcall := cmd.FCall("count", []string{"k"}, nil, true, parseScriptCommand)
+	assert.Equal(t, []interface{}{cmd.FCALLRO, "count", int64(1), "k"}, fcall.Args())
+}
+
+func TestFunctionLoad_errors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	registry := cmd.NewFunctionRegistry()
+	_, err := registry.Load(ctx, testLibrary, false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		code string
+		err  error
+	}{
+		{"return 1", cmd.ErrLibraryMetadata},
+		{"#!js name=lib\n", cmd.ErrLibraryEngine},
+		{"#!lua name=my-lib\n", cmd.ErrLibraryName},
+		{"#!lua name=lib\nreturn (", cmd.ErrFunctionCompile},
+		{"#!lua name=lib\nlocal x = 1", cmd.ErrNoFunctions},
+		{"#!lua name=lib\nredis.call('GET', 'k')", cmd.ErrFunctionRegister},
+		{"#!lua name=lib\nredis.register_function('f', 'not a function')", cmd.ErrFunctionRegister},
+		{"#!lua name=lib\nredis.register_function{function_name='f', callback=print, flags={'bad'}}", cmd.ErrFunctionRegister},
+		{"#!lua name=lib\nwhile true do end", cmd.ErrFunctionLoadTimeout},
+		{"#!lua name=mylib\nredis.register_function('f', function() end)", cmd.ErrLibraryExists},
+		{"#!lua name=lib\nredis.register_function('count', function() end)", cmd.ErrFunctionExists},
+	}
+	for _, tt := range tests {
+		_, err := registry.Load(ctx, tt.code, false)
+		require.ErrorIs(t, err, tt.err, tt.code)
+	}
+
+	_, err = registry.Load(ctx, "#!lua name=mylib\nredis.register_function('f', function() end)", true)
+	require.NoError(t, err)
+	_, ok := registry.Function("count")
+	assert.False(t, ok)
+	_, ok = registry.Function("f")
+	assert.True(t, ok)
+}
+
+func TestFunctionList(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().Functions().Return(cmd.NewFunctionRegistry()).AnyTimes()
+	code := "#!lua name=other\nredis.register_function('other', function() end)"
+	for _, c := range []string{testLibrary, code} {
+		_, err := cmd.FunctionLoad(c, false).Execute(ctx, client)
+		require.NoError(t, err)
+	}
+
+	res, err := cmd.FunctionList("OTH*", true).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{
+		[]interface{}{
+			[]byte("library_name"), []byte("other"),
+			[]byte("engine"), []byte("LUA"),
+			[]byte("functions"), []interface{}{
+				[]interface{}{[]byte("name"), []byte("other"), []byte("description"), []byte(nil), []byte("flags"), []interface{}{}},
+			},
+			[]byte("library_code"), []byte(code),
+		},
+	}}, res.Values)
+
+	res, err = cmd.FunctionList("", false).Execute(ctx, client)
+	require.NoError(t, err)
+	libs := res.Values[0].([]interface{}) //nolint:forcetypeassert // the reply is an array
+	require.Len(t, libs, 2)
+	assert.Equal(t, []interface{}{
+		[]interface{}{[]byte("name"), []byte("count"), []byte("description"), []byte(nil), []byte("flags"), []interface{}{}},
+		[]interface{}{[]byte("name"), []byte("put"), []byte("description"), []byte("writes a key"), []byte("flags"), []interface{}{}},
+		[]interface{}{[]byte("name"), []byte("try_put"), []byte("description"), []byte(nil), []byte("flags"), []interface{}{[]byte("no-writes")}},
+	}, libs[0].([]interface{})[5])
+
+	_, err = cmd.FunctionDelete("other").Execute(ctx, client)
+	require.NoError(t, err)
+	_, err = cmd.FunctionDelete("other").Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrLibraryNotFound)
+	res, err = cmd.FunctionList("", false).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Len(t, res.Values[0], 1)
+}
+
+func TestFunctionDump(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	source := cmd.NewFunctionRegistry()
+	_, err := source.Load(ctx, testLibrary, false)
+	require.NoError(t, err)
+	_, err = source.Load(ctx, "#!lua name=other\nredis.register_function('other', function() end)", false)
+	require.NoError(t, err)
+	payload := source.Dump()
+
+	target := cmd.NewFunctionRegistry()
+	_, err = target.Load(ctx, "#!lua name=mylib\nredis.register_function('old', function() end)", false)
+	require.NoError(t, err)
+	_, err = target.Load(ctx, "#!lua name=kept\nredis.register_function('kept', function() end)", false)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, target.RestoreDump(ctx, payload, cmd.RestoreAppend), cmd.ErrLibraryExists)
+	require.ErrorIs(t, target.RestoreDump(ctx, payload[1:], cmd.RestoreAppend), cmd.ErrFunctionPayload)
+	assert.Len(t, target.Libraries(), 2)
+
+	require.NoError(t, target.RestoreDump(ctx, payload, cmd.RestoreReplace))
+	assert.Len(t, target.Libraries(), 3)
+	_, ok := target.Function("old")
+	assert.False(t, ok)
+
+	require.NoError(t, target.RestoreDump(ctx, payload, cmd.RestoreFlush))
+	assert.Equal(t, payload, target.Dump())
+}
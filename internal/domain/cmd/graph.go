@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/burenotti/redis_impl/pkg/graph"
+)
+
+const (
+	GRAPHQUERY   = "GRAPH.QUERY"
+	GRAPHROQUERY = "GRAPH.RO_QUERY"
+	GRAPHDELETE  = "GRAPH.DELETE"
+	GRAPHEXPLAIN = "GRAPH.EXPLAIN"
+)
+
+var ErrGraphEmptyKey = errors.New("invalid graph operation on empty key")
+
+// Value types of the compact result set format.
+const (
+	graphNull    int64 = 1
+	graphString  int64 = 2
+	graphInteger int64 = 3
+	graphBoolean int64 = 4
+	graphDouble  int64 = 5
+	graphArray   int64 = 6
+	graphEdge    int64 = 7
+	graphNode    int64 = 8
+	graphPath    int64 = 9
+	graphMap     int64 = 10
+)
+
+// graphColumnScalar is the type of every column in compact headers.
+const graphColumnScalar int64 = 1
+
+func getGraph(ctx context.Context, s Storage, key string) (*graph.Graph, Entry, error) {
+	return getTyped[*graph.Graph](ctx, s, key, ValueGraph)
+}
+
+// GraphQuery executes a Cypher query. The key is created by the first query modifying the graph.
+// Read only queries fail if the query has write clauses. Compact replies refer to labels,
+// relationship types and property keys by identifiers reported by db.labels() and similar
+// procedures.
+func GraphQuery(key, query string, readOnly, compact bool) Command {
+	return &graphQuery{key: key, query: query, readOnly: readOnly, compact: compact}
+}
+
+type graphQuery struct {
+	baseCommand
+	key      string
+	query    string
+	readOnly bool
+	compact  bool
+}
+
+func (q *graphQuery) Name() string {
+	if q.readOnly {
+		return GRAPHROQUERY
+	}
+	return GRAPHQUERY
+}
+
+func (q *graphQuery) IsModifying() bool {
+	return !q.readOnly
+}
+
+func (q *graphQuery) Execute(ctx context.Context, c Client) (*Result, error) {
+	start := time.Now()
+	storage := c.Storage()
+	g, entry, err := getGraph(ctx, storage, q.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		g, err = graph.New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.Query(q.query, q.readOnly)
+	if err != nil {
+		return nil, err
+	}
+	if res.Stats.Modified() {
+		if err := touch(ctx, storage, q.key, g, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := graphStats(res.Stats, time.Since(start))
+	if res.Columns == nil {
+		return NewResult([]interface{}{stats}), nil
+	}
+	header := make([]interface{}, len(res.Columns))
+	for i, column := range res.Columns {
+		if q.compact {
+			header[i] = []interface{}{graphColumnScalar, []byte(column)}
+		} else {
+			header[i] = []byte(column)
+		}
+	}
+	rows := make([]interface{}, len(res.Rows))
+	for i, r := range res.Rows {
+		cells := make([]interface{}, len(r))
+		for j, v := range r {
+			if q.compact {
+				cells[j] = compactValue(g, v)
+			} else {
+				cells[j] = verboseValue(v)
+			}
+		}
+		rows[i] = cells
+	}
+	return NewResult([]interface{}{header, rows, stats}), nil
+}
+
+func (q *graphQuery) Args() []interface{} {
+	res := []interface{}{q.Name(), q.key, q.query}
+	if q.compact {
+		res = append(res, "--compact")
+	}
+	return res
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Nanoseconds())/float64(time.Millisecond), 'f', 6, 64)
+}
+
+func graphStats(s graph.Stats, elapsed time.Duration) []interface{} {
+	var res []interface{}
+	counters := []struct {
+		name  string
+		value int
+	}{
+		{"Labels added", s.LabelsAdded},
+		{"Nodes created", s.NodesCreated},
+		{"Nodes deleted", s.NodesDeleted},
+		{"Properties set", s.PropertiesSet},
+		{"Properties removed", s.PropertiesRemoved},
+		{"Relationships created", s.RelationshipsCreated},
+		{"Relationships deleted", s.RelationshipsDeleted},
+	}
+	for _, counter := range counters {
+		if counter.value > 0 {
+			res = append(res, []byte(fmt.Sprintf("%s: %d", counter.name, counter.value)))
+		}
+	}
+	return append(res,
+		[]byte("Cached execution: 0"),
+		[]byte("Query internal execution time: "+formatDuration(elapsed)+" milliseconds"),
+	)
+}
+
+// compactValue encodes a value as a pair of its type and payload.
+func compactValue(g *graph.Graph, v graph.Value) []interface{} {
+	t, payload := compactPayload(g, v)
+	return []interface{}{t, payload}
+}
+
+func compactPayload(g *graph.Graph, v graph.Value) (int64, interface{}) {
+	switch v := v.(type) {
+	case string:
+		return graphString, []byte(v)
+	case int64:
+		return graphInteger, v
+	case bool:
+		return graphBoolean, []byte(strconv.FormatBool(v))
+	case float64:
+		return graphDouble, []byte(graph.FormatFloat(v))
+	case []graph.Value:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = compactValue(g, item)
+		}
+		return graphArray, items
+	case map[string]graph.Value:
+		items := make([]interface{}, 0, 2*len(v))
+		for _, k := range sortedGraphKeys(v) {
+			items = append(items, []byte(k), compactValue(g, v[k]))
+		}
+		return graphMap, items
+	case *graph.Node:
+		labels := make([]interface{}, len(v.Labels))
+		for i, label := range v.Labels {
+			labels[i] = int64(g.LabelID(label))
+		}
+		return graphNode, []interface{}{v.ID, labels, compactProperties(g, v.Properties)}
+	case *graph.Relationship:
+		return graphEdge, []interface{}{
+			v.ID, int64(g.RelationshipTypeID(v.Type)), v.Src, v.Dst, compactProperties(g, v.Properties),
+		}
+	case *graph.Path:
+		nodes := make([]interface{}, len(v.Nodes))
+		for i, n := range v.Nodes {
+			nodes[i] = compactValue(g, n)
+		}
+		rels := make([]interface{}, len(v.Relationships))
+		for i, r := range v.Relationships {
+			rels[i] = compactValue(g, r)
+		}
+		return graphPath, []interface{}{
+			[]interface{}{graphArray, nodes},
+			[]interface{}{graphArray, rels},
+		}
+	}
+	return graphNull, NilString()
+}
+
+func compactProperties(g *graph.Graph, props graph.Properties) []interface{} {
+	res := make([]interface{}, len(props))
+	for i, prop := range props {
+		t, payload := compactPayload(g, prop.Value)
+		res[i] = []interface{}{int64(g.PropertyKeyID(prop.Key)), t, payload}
+	}
+	return res
+}
+
+// verboseValue encodes a value without type information.
+func verboseValue(v graph.Value) interface{} {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case int64:
+		return v
+	case bool:
+		return []byte(strconv.FormatBool(v))
+	case float64:
+		return []byte(graph.FormatFloat(v))
+	case []graph.Value:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = verboseValue(item)
+		}
+		return items
+	case map[string]graph.Value:
+		items := make([]interface{}, 0, 2*len(v))
+		for _, k := range sortedGraphKeys(v) {
+			items = append(items, []byte(k), verboseValue(v[k]))
+		}
+		return items
+	case *graph.Node:
+		labels := make([]interface{}, len(v.Labels))
+		for i, label := range v.Labels {
+			labels[i] = []byte(label)
+		}
+		return []interface{}{
+			[]interface{}{[]byte("id"), v.ID},
+			[]interface{}{[]byte("labels"), labels},
+			[]interface{}{[]byte("properties"), verboseProperties(v.Properties)},
+		}
+	case *graph.Relationship:
+		return []interface{}{
+			[]interface{}{[]byte("id"), v.ID},
+			[]interface{}{[]byte("type"), []byte(v.Type)},
+			[]interface{}{[]byte("src_node"), v.Src},
+			[]interface{}{[]byte("dest_node"), v.Dst},
+			[]interface{}{[]byte("properties"), verboseProperties(v.Properties)},
+		}
+	case *graph.Path:
+		nodes := make([]interface{}, len(v.Nodes))
+		for i, n := range v.Nodes {
+			nodes[i] = verboseValue(n)
+		}
+		rels := make([]interface{}, len(v.Relationships))
+		for i, r := range v.Relationships {
+			rels[i] = verboseValue(r)
+		}
+		return []interface{}{nodes, rels}
+	}
+	return NilString()
+}
+
+func verboseProperties(props graph.Properties) []interface{} {
+	res := make([]interface{}, len(props))
+	for i, prop := range props {
+		res[i] = []interface{}{[]byte(prop.Key), verboseValue(prop.Value)}
+	}
+	return res
+}
+
+func sortedGraphKeys(m map[string]graph.Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// GraphDelete removes a graph.
+func GraphDelete(key string) Command {
+	return &graphDelete{key: key}
+}
+
+type graphDelete struct {
+	modifyingCommand
+	key string
+}
+
+func (d *graphDelete) Name() string {
+	return GRAPHDELETE
+}
+
+func (d *graphDelete) Execute(ctx context.Context, c Client) (*Result, error) {
+	start := time.Now()
+	storage := c.Storage()
+	_, _, err := getGraph(ctx, storage, d.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrGraphEmptyKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Del(ctx, d.key); err != nil {
+		return nil, err
+	}
+	return NewResult("Graph removed, internal execution time: " + formatDuration(time.Since(start)) +
+		" milliseconds"), nil
+}
+
+func (d *graphDelete) Args() []interface{} {
+	return []interface{}{GRAPHDELETE, d.key}
+}
+
+// GraphExplain replies with the execution plan of a query without executing it.
+func GraphExplain(key, query string) Command {
+	return &graphExplain{key: key, query: query}
+}
+
+type graphExplain struct {
+	baseCommand
+	key   string
+	query string
+}
+
+func (e *graphExplain) Name() string {
+	return GRAPHEXPLAIN
+}
+
+func (e *graphExplain) Execute(ctx context.Context, c Client) (*Result, error) {
+	_, _, err := getGraph(ctx, c.Storage(), e.key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	plan, err := graph.Explain(e.query)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(plan))
+	for i, line := range plan {
+		res[i] = []byte(line)
+	}
+	return NewResult(res), nil
+}
+
+func (e *graphExplain) Args() []interface{} {
+	return []interface{}{GRAPHEXPLAIN, e.key, e.query}
+}
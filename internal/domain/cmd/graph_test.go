@@ -0,0 +1,112 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/graph"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQuery_createsGraph(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	storage.EXPECT().GetTyped(ctx, "g", cmd.ValueGraph).Return(nil, cmd.ErrKeyNotFound).Times(2)
+	var stored *graph.Graph
+	storage.EXPECT().Set(ctx, "g", gomock.Any(), nil).
+		DoAndReturn(func(_ context.Context, _ string, value interface{}, _ *time.Time) (cmd.Entry, error) {
+			stored = value.(*graph.Graph) //nolint:forcetypeassert // a graph is stored
+			return &mockValue{value: value}, nil
+		})
+
+	// Read queries don't create the key.
+	res, err := cmd.GraphQuery("g", "MATCH (n) RETURN count(n)", true, false).Execute(ctx, client)
+	require.NoError(t, err)
+	require.Len(t, res.Values, 1)
+	assert.Equal(t, []interface{}{[]byte("count(n)")}, res.Values[0].([]interface{})[0])
+
+	query := cmd.GraphQuery("g", "CREATE (:Person {name: 'alice'})", false, true)
+	res, err = query.Execute(ctx, client)
+	require.NoError(t, err)
+	stats := res.Values[0].([]interface{})[0].([]interface{})
+	assert.Equal(t, []interface{}{[]byte("Labels added: 1"), []byte("Nodes created: 1"),
+		[]byte("Properties set: 1"), []byte("Cached execution: 0")}, stats[:4])
+	assert.Equal(t, 1, stored.NodeCount())
+	assert.Equal(t, []interface{}{cmd.GRAPHQUERY, "g", "CREATE (:Person {name: 'alice'})", "--compact"}, query.Args())
+	assert.True(t, query.IsModifying())
+}
+
+func TestGraphQuery_compact(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	g := graph.New()
+	_, err := g.Query(`CREATE (:A {x: 1})-[:R {y: 'a'}]->(:B:A {z: [true, 1.5]})`, false)
+	require.NoError(t, err)
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "g", cmd.ValueGraph).Return(&mockValue{value: g}, nil)
+
+	res, err := cmd.GraphQuery("g", "MATCH (a)-[r]->(b) RETURN a, r, b, null", true, true).Execute(ctx, client)
+	require.NoError(t, err)
+	reply := res.Values[0].([]interface{})
+	require.Len(t, reply, 3)
+	assert.Equal(t, []interface{}{
+		[]interface{}{int64(1), []byte("a")},
+		[]interface{}{int64(1), []byte("r")},
+		[]interface{}{int64(1), []byte("b")},
+		[]interface{}{int64(1), []byte("null")},
+	}, reply[0])
+	assert.Equal(t, []interface{}{[]interface{}{
+		[]interface{}{int64(8), []interface{}{int64(0), []interface{}{int64(0)}, []interface{}{
+			[]interface{}{int64(0), int64(3), int64(1)},
+		}}},
+		[]interface{}{int64(7), []interface{}{int64(0), int64(0), int64(0), int64(1), []interface{}{
+			[]interface{}{int64(2), int64(2), []byte("a")},
+		}}},
+		[]interface{}{int64(8), []interface{}{int64(1), []interface{}{int64(1), int64(0)}, []interface{}{
+			[]interface{}{int64(1), int64(6), []interface{}{
+				[]interface{}{int64(4), []byte("true")},
+				[]interface{}{int64(5), []byte("1.5")},
+			}},
+		}}},
+		[]interface{}{int64(1), []byte(nil)},
+	}}, reply[1])
+}
+
+func TestGraphDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(3)
+	gomock.InOrder(
+		storage.EXPECT().GetTyped(ctx, "g", cmd.ValueGraph).Return(&mockValue{value: graph.New()}, nil),
+		storage.EXPECT().Del(ctx, "g").Return(&mockValue{}, nil),
+		storage.EXPECT().GetTyped(ctx, "g", cmd.ValueGraph).Return(nil, cmd.ErrKeyNotFound),
+		storage.EXPECT().GetTyped(ctx, "g", cmd.ValueGraph).Return(nil, cmd.ErrWrongType),
+	)
+	_, err := cmd.GraphDelete("g").Execute(ctx, client)
+	require.NoError(t, err)
+	_, err = cmd.GraphDelete("g").Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrGraphEmptyKey)
+	_, err = cmd.GraphDelete("g").Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrWrongType)
+}
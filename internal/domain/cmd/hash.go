@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+const (
+	HSET    = "HSET"
+	HGET    = "HGET"
+	HMGET   = "HMGET"
+	HDEL    = "HDEL"
+	HGETALL = "HGETALL"
+	HEXISTS = "HEXISTS"
+	HLEN    = "HLEN"
+	HKEYS   = "HKEYS"
+	HVALS   = "HVALS"
+	HINCRBY = "HINCRBY"
+)
+
+var (
+	ErrHashNotInteger  = errors.New("hash value is not an integer")
+	ErrIntegerOverflow = errors.New("increment or decrement would overflow")
+)
+
+// Hash is a value of hash keys mapping field names to values.
+type Hash map[string][]byte
+
+// fields returns field names in sorted order, so replies don't depend on map iteration order.
+func (h Hash) fields() []string {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// getHash returns a hash stored at key. A missing key is reported as ErrKeyNotFound.
+func getHash(ctx context.Context, s Storage, key string) (Hash, Entry, error) {
+	return s.GetHash(ctx, key)
+}
+
+// readHash returns a hash stored at key or an empty hash if the key doesn't exist.
+func readHash(ctx context.Context, s Storage, key string) (Hash, error) {
+	h, _, err := getHash(ctx, s, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return Hash{}, nil
+	}
+	return h, err
+}
+
+type HashField struct {
+	Field string
+	Value []byte
+}
+
+// HSet sets fields of a hash and replies with amount of added fields.
+func HSet(key string, fields ...HashField) Command {
+	return &hSet{key: key, fields: fields}
+}
+
+type hSet struct {
+	modifyingCommand
+	key    string
+	fields []HashField
+}
+
+func (s *hSet) Name() string {
+	return HSET
+}
+
+func (s *hSet) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	h, entry, err := getHash(ctx, storage, s.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		h, err = Hash{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var added int64
+	for _, f := range s.fields {
+		if _, ok := h[f.Field]; !ok {
+			added++
+		}
+		h[f.Field] = f.Value
+	}
+	if err := touch(ctx, storage, s.key, h, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(added), nil
+}
+
+func (s *hSet) Args() []interface{} {
+	res := []interface{}{HSET, s.key}
+	for _, f := range s.fields {
+		res = append(res, f.Field, f.Value)
+	}
+	return res
+}
+
+func HGet(key, field string) Command {
+	return &hGet{key: key, fields: []string{field}}
+}
+
+func HMGet(key string, fields ...string) Command {
+	return &hGet{key: key, fields: fields, multi: true}
+}
+
+type hGet struct {
+	baseCommand
+	key    string
+	fields []string
+	multi  bool
+}
+
+func (g *hGet) Name() string {
+	if g.multi {
+		return HMGET
+	}
+	return HGET
+}
+
+func (g *hGet) Execute(ctx context.Context, c Client) (*Result, error) {
+	h, err := readHash(ctx, c.Storage(), g.key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(g.fields))
+	for i, field := range g.fields {
+		res[i] = NilString()
+		if value, ok := h[field]; ok {
+			res[i] = value
+		}
+	}
+	if !g.multi {
+		return NewResult(res[0]), nil
+	}
+	return NewResult(res), nil
+}
+
+func (g *hGet) Args() []interface{} {
+	res := []interface{}{g.Name(), g.key}
+	for _, field := range g.fields {
+		res = append(res, field)
+	}
+	return res
+}
+
+// HDel removes fields of a hash and replies with amount of removed fields.
+// The key is removed with the last field.
+func HDel(key string, fields ...string) Command {
+	return &hDel{key: key, fields: fields}
+}
+
+type hDel struct {
+	modifyingCommand
+	key    string
+	fields []string
+}
+
+func (d *hDel) Name() string {
+	return HDEL
+}
+
+func (d *hDel) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	h, entry, err := getHash(ctx, storage, d.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var removed int64
+	for _, field := range d.fields {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			removed++
+		}
+	}
+	if len(h) == 0 {
+		_, err = storage.Del(ctx, d.key)
+	} else if removed > 0 {
+		err = touch(ctx, storage, d.key, h, entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(removed), nil
+}
+
+func (d *hDel) Args() []interface{} {
+	res := []interface{}{HDEL, d.key}
+	for _, field := range d.fields {
+		res = append(res, field)
+	}
+	return res
+}
+
+// HashReply selects what HGETALL-like commands reply with.
+type HashReply int
+
+const (
+	HashReplyAll HashReply = iota
+	HashReplyKeys
+	HashReplyValues
+	HashReplyLen
+)
+
+// HGetAll replies with fields and values of a hash ordered by field name.
+func HGetAll(key string) Command {
+	return &hGetAll{key: key, reply: HashReplyAll}
+}
+
+func HKeys(key string) Command {
+	return &hGetAll{key: key, reply: HashReplyKeys}
+}
+
+func HVals(key string) Command {
+	return &hGetAll{key: key, reply: HashReplyValues}
+}
+
+func HLen(key string) Command {
+	return &hGetAll{key: key, reply: HashReplyLen}
+}
+
+type hGetAll struct {
+	baseCommand
+	key   string
+	reply HashReply
+}
+
+func (g *hGetAll) Name() string {
+	switch g.reply {
+	case HashReplyKeys:
+		return HKEYS
+	case HashReplyValues:
+		return HVALS
+	case HashReplyLen:
+		return HLEN
+	default:
+		return HGETALL
+	}
+}
+
+func (g *hGetAll) Execute(ctx context.Context, c Client) (*Result, error) {
+	h, err := readHash(ctx, c.Storage(), g.key)
+	if err != nil {
+		return nil, err
+	}
+	if g.reply == HashReplyLen {
+		return NewResult(int64(len(h))), nil
+	}
+	res := []interface{}{}
+	for _, field := range h.fields() {
+		if g.reply != HashReplyValues {
+			res = append(res, []byte(field))
+		}
+		if g.reply != HashReplyKeys {
+			res = append(res, h[field])
+		}
+	}
+	return NewResult(res), nil
+}
+
+func (g *hGetAll) Args() []interface{} {
+	return []interface{}{g.Name(), g.key}
+}
+
+func HExists(key, field string) Command {
+	return &hExists{key: key, field: field}
+}
+
+type hExists struct {
+	baseCommand
+	key   string
+	field string
+}
+
+func (e *hExists) Name() string {
+	return HEXISTS
+}
+
+func (e *hExists) Execute(ctx context.Context, c Client) (*Result, error) {
+	h, err := readHash(ctx, c.Storage(), e.key)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := h[e.field]
+	return NewResult(boolReply(ok)), nil
+}
+
+func (e *hExists) Args() []interface{} {
+	return []interface{}{HEXISTS, e.key, e.field}
+}
+
+func HIncrBy(key, field string, incr int64) Command {
+	return &hIncrBy{key: key, field: field, incr: incr}
+}
+
+type hIncrBy struct {
+	modifyingCommand
+	key   string
+	field string
+	incr  int64
+}
+
+func (i *hIncrBy) Name() string {
+	return HINCRBY
+}
+
+func (i *hIncrBy) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	h, entry, err := getHash(ctx, storage, i.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		h, err = Hash{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var current int64
+	if value, ok := h[i.field]; ok {
+		if current, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return nil, ErrHashNotInteger
+		}
+	}
+	next := current + i.incr
+	if (next > current) != (i.incr > 0) {
+		return nil, ErrIntegerOverflow
+	}
+	h[i.field] = strconv.AppendInt(nil, next, 10)
+	if err := touch(ctx, storage, i.key, h, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(next), nil
+}
+
+func (i *hIncrBy) Args() []interface{} {
+	return []interface{}{HINCRBY, i.key, i.field, i.incr}
+}
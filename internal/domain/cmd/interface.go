@@ -7,31 +7,57 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/burenotti/redis_impl/pkg/keyspace"
+	"github.com/burenotti/redis_impl/pkg/search"
 )
 
 var (
 	ErrKeyNotFound = errors.New("key not found")
 	ErrKeyExists   = errors.New("key already exists")
 	ErrExpired     = fmt.Errorf("%w: expired", ErrKeyNotFound)
+	ErrInvalidDB   = errors.New("DB index is out of range")
+	ErrWrongType   = keyspace.ErrWrongType
 )
 
 type Storage interface {
 	Set(ctx context.Context, key string, value interface{}, expiresAt *time.Time) (Entry, error)
 	Get(ctx context.Context, key string) (Entry, error)
+	// GetTyped returns an entry holding a value of the type. Keys of other types fail with ErrWrongType.
+	GetTyped(ctx context.Context, key string, typ ValueType) (Entry, error)
+	GetString(ctx context.Context, key string) ([]byte, Entry, error)
+	GetHash(ctx context.Context, key string) (Hash, Entry, error)
 	Del(ctx context.Context, key string) (Entry, error)
+	Len(ctx context.Context) int
+	Flush(ctx context.Context, async bool) error
+	Range(ctx context.Context, f func(string, Entry) bool)
+	Indexes() *search.Registry
 }
 
 type Client interface {
-	StartTx(ctx context.Context) error
+	StartTx(ctx context.Context, atomic bool) error
 	ExecTx(ctx context.Context) (*Result, error)
 	DiscardTx(ctx context.Context) error
 	Watch(ctx context.Context, keys ...string) error
 	Unwatch(ctx context.Context) error
+	Select(ctx context.Context, db int) error
+	SelectedDB() int
+	Database(db int) (Storage, error)
+	Databases() int
+	SwapDB(ctx context.Context, first, second int) error
 	Storage() Storage
+	Scripts() *ScriptCache
+	Functions() *FunctionRegistry
+	ScriptMonitor() *ScriptMonitor
+	Modules() *ModuleRegistry
+	// Shutdown requests the server to stop.
+	Shutdown()
 }
 
 type Entry interface {
 	Value() interface{}
+	Type() ValueType
+	Encoding() string
 	ExpiresAt() *time.Time
 	Revision() uint64
 }
@@ -0,0 +1,803 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+)
+
+const (
+	JSONSET       = "JSON.SET"
+	JSONGET       = "JSON.GET"
+	JSONDEL       = "JSON.DEL"
+	JSONTYPE      = "JSON.TYPE"
+	JSONNUMINCRBY = "JSON.NUMINCRBY"
+	JSONSTRAPPEND = "JSON.STRAPPEND"
+	JSONARRAPPEND = "JSON.ARRAPPEND"
+	JSONARRINSERT = "JSON.ARRINSERT"
+	JSONARRPOP    = "JSON.ARRPOP"
+	JSONARRLEN    = "JSON.ARRLEN"
+	JSONOBJKEYS   = "JSON.OBJKEYS"
+	JSONMGET      = "JSON.MGET"
+)
+
+var (
+	ErrJSONNewAtRoot        = errors.New("new objects must be created at the root")
+	ErrJSONPathNotExists    = errors.New("path does not exist")
+	ErrJSONWrongPathType    = errors.New("wrong type of path value")
+	ErrJSONIndexOutOfBounds = errors.New("index out of bounds")
+	// ErrJSONSyntax and ErrJSONPathSyntax are returned for malformed values and paths.
+	ErrJSONSyntax     = jsondoc.ErrSyntax
+	ErrJSONPathSyntax = jsondoc.ErrPathSyntax
+)
+
+func getJSON(ctx context.Context, s Storage, key string) (*jsondoc.Document, Entry, error) {
+	return getTyped[*jsondoc.Document](ctx, s, key, ValueJSON)
+}
+
+// touchJSON stores modified document back to the storage, so the revision of the key is updated.
+func touchJSON(ctx context.Context, s Storage, key string, doc *jsondoc.Document, entry Entry) error {
+	_, err := s.Set(ctx, key, doc, entry.ExpiresAt())
+	return err
+}
+
+func parseJSONValues(raw ...[]byte) ([]interface{}, error) {
+	values := make([]interface{}, len(raw))
+	for i, r := range raw {
+		v, err := jsondoc.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func pathNotExists(path *jsondoc.Path) error {
+	return fmt.Errorf("%w: %s", ErrJSONPathNotExists, path)
+}
+
+func wrongPathType(expected string, actual interface{}) error {
+	return fmt.Errorf("%w - expected %s but found %s", ErrJSONWrongPathType, expected, jsondoc.TypeName(actual))
+}
+
+// applyJSON calls op for every node matched by path. Operations that can't be applied
+// to a node produce a nil reply for JSONPath and fail the whole command for legacy paths.
+func applyJSON(
+	path *jsondoc.Path,
+	nodes []jsondoc.Node,
+	op func(n jsondoc.Node) (interface{}, error),
+) ([]interface{}, error) {
+	results := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		res, err := op(n)
+		if err != nil {
+			if path.IsLegacy() {
+				return nil, err
+			}
+			res = NilString()
+		}
+		results = append(results, res)
+	}
+	if path.IsLegacy() && len(results) == 0 {
+		return nil, pathNotExists(path)
+	}
+	return results, nil
+}
+
+// jsonReply returns an array of results for JSONPath and the first result for a legacy path.
+func jsonReply(path *jsondoc.Path, results []interface{}) *Result {
+	if path.IsLegacy() {
+		return NewResult(results[0])
+	}
+	return NewResult(results)
+}
+
+type jsonKeyPath struct {
+	key  string
+	path *jsondoc.Path
+}
+
+func newJSONKeyPath(key, path string) (jsonKeyPath, error) {
+	p, err := jsondoc.Compile(path)
+	return jsonKeyPath{key: key, path: p}, err
+}
+
+func JSONSet(key, path string, value []byte, exists ExistsOpt) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseJSONValues(value)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonSet{jsonKeyPath: kp, raw: value, value: values[0], exists: exists}, nil
+}
+
+type jsonSet struct {
+	modifyingCommand
+	jsonKeyPath
+	raw    []byte
+	value  interface{}
+	exists ExistsOpt
+}
+
+func (j *jsonSet) Name() string {
+	return JSONSET
+}
+
+func (j *jsonSet) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		if !j.path.IsRoot() {
+			return nil, ErrJSONNewAtRoot
+		}
+		if j.exists == Exists {
+			return NewResult(NilString()), nil
+		}
+		if _, err := storage.Set(ctx, j.key, jsondoc.New(jsondoc.Clone(j.value)), nil); err != nil {
+			return nil, err
+		}
+		return OkResult(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !j.set(doc) {
+		return NewResult(NilString()), nil
+	}
+	if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (j *jsonSet) set(doc *jsondoc.Document) bool {
+	nodes := j.path.Select(doc)
+	if len(nodes) > 0 {
+		if j.exists == NotExists {
+			return false
+		}
+		for _, n := range nodes {
+			n.Set(jsondoc.Clone(j.value))
+		}
+		return true
+	}
+
+	if j.exists == Exists {
+		return false
+	}
+	// Path doesn't exist yet, so a new member is added to every matching parent object.
+	parent, name, ok := j.path.Parent()
+	if !ok {
+		return false
+	}
+	created := false
+	for _, n := range parent.Select(doc) {
+		if obj, ok := n.Value.(*jsondoc.Object); ok {
+			obj.Set(name, jsondoc.Clone(j.value))
+			created = true
+		}
+	}
+	return created
+}
+
+func (j *jsonSet) Args() []interface{} {
+	res := []interface{}{JSONSET, j.key, j.path.String(), j.raw}
+	if j.exists != "" {
+		res = append(res, string(j.exists))
+	}
+	return res
+}
+
+func JSONGet(key string, format jsondoc.Format, paths ...string) (Command, error) {
+	g := &jsonGet{key: key, format: format}
+	for _, path := range paths {
+		p, err := jsondoc.Compile(path)
+		if err != nil {
+			return nil, err
+		}
+		g.paths = append(g.paths, p)
+	}
+	return g, nil
+}
+
+type jsonGet struct {
+	baseCommand
+	key    string
+	format jsondoc.Format
+	paths  []*jsondoc.Path
+}
+
+func (j *jsonGet) Name() string {
+	return JSONGET
+}
+
+func (j *jsonGet) Execute(ctx context.Context, c Client) (*Result, error) {
+	doc, _, err := getJSON(ctx, c.Storage(), j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(NilString()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(j.paths) == 0 {
+		return NewResult(jsondoc.Marshal(doc.Root(), j.format)), nil
+	}
+
+	if len(j.paths) == 1 {
+		value, err := selectJSON(doc, j.paths[0], j.paths[0].IsLegacy())
+		if err != nil {
+			return nil, err
+		}
+		return NewResult(jsondoc.Marshal(value, j.format)), nil
+	}
+
+	legacy := true
+	for _, p := range j.paths {
+		legacy = legacy && p.IsLegacy()
+	}
+	obj := jsondoc.NewObject()
+	for _, p := range j.paths {
+		value, err := selectJSON(doc, p, legacy)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(p.String(), value)
+	}
+	return NewResult(jsondoc.Marshal(obj, j.format)), nil
+}
+
+// selectJSON returns the first matched value if single is true, and an array of all matches otherwise.
+func selectJSON(doc *jsondoc.Document, path *jsondoc.Path, single bool) (interface{}, error) {
+	nodes := path.Select(doc)
+	if single {
+		if len(nodes) == 0 {
+			return nil, pathNotExists(path)
+		}
+		return nodes[0].Value, nil
+	}
+	arr := jsondoc.NewArray()
+	for _, n := range nodes {
+		arr.Items = append(arr.Items, n.Value)
+	}
+	return arr, nil
+}
+
+func (j *jsonGet) Args() []interface{} {
+	res := []interface{}{JSONGET, j.key}
+	if j.format.Indent != "" {
+		res = append(res, "INDENT", j.format.Indent)
+	}
+	if j.format.Newline != "" {
+		res = append(res, "NEWLINE", j.format.Newline)
+	}
+	if j.format.Space != "" {
+		res = append(res, "SPACE", j.format.Space)
+	}
+	for _, p := range j.paths {
+		res = append(res, p.String())
+	}
+	return res
+}
+
+func JSONDel(key, path string) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonDel{jsonKeyPath: kp}, nil
+}
+
+type jsonDel struct {
+	modifyingCommand
+	jsonKeyPath
+}
+
+func (j *jsonDel) Name() string {
+	return JSONDEL
+}
+
+func (j *jsonDel) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if j.path.IsRoot() {
+		if _, err := storage.Del(ctx, j.key); err != nil {
+			return nil, err
+		}
+		return NewResult(int64(1)), nil
+	}
+
+	deleted := jsondoc.Delete(j.path.Select(doc))
+	if deleted > 0 {
+		if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+			return nil, err
+		}
+	}
+	return NewResult(int64(deleted)), nil
+}
+
+func (j *jsonDel) Args() []interface{} {
+	return []interface{}{JSONDEL, j.key, j.path.String()}
+}
+
+func JSONType(key, path string) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonType{jsonKeyPath: kp}, nil
+}
+
+type jsonType struct {
+	baseCommand
+	jsonKeyPath
+}
+
+func (j *jsonType) Name() string {
+	return JSONTYPE
+}
+
+func (j *jsonType) Execute(ctx context.Context, c Client) (*Result, error) {
+	doc, _, err := getJSON(ctx, c.Storage(), j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(NilString()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := j.path.Select(doc)
+	if j.path.IsLegacy() && len(nodes) == 0 {
+		return NewResult(NilString()), nil
+	}
+	results, err := applyJSON(j.path, nodes, func(n jsondoc.Node) (interface{}, error) {
+		return []byte(jsondoc.TypeName(n.Value)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonType) Args() []interface{} {
+	return []interface{}{JSONTYPE, j.key, j.path.String()}
+}
+
+func JSONNumIncrBy(key, path string, value []byte) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseJSONValues(value)
+	if err != nil {
+		return nil, err
+	}
+	switch values[0].(type) {
+	case int64, float64:
+	default:
+		return nil, fmt.Errorf("%w: increment must be a number", ErrInvalidOpt)
+	}
+	return &jsonNumIncrBy{jsonKeyPath: kp, raw: value, incr: values[0]}, nil
+}
+
+type jsonNumIncrBy struct {
+	modifyingCommand
+	jsonKeyPath
+	raw  []byte
+	incr interface{}
+}
+
+func (j *jsonNumIncrBy) Name() string {
+	return JSONNUMINCRBY
+}
+
+func (j *jsonNumIncrBy) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := j.path.Select(doc)
+	updated := jsondoc.NewArray()
+	for _, n := range nodes {
+		sum, ok := addNumbers(n.Value, j.incr)
+		if !ok {
+			if j.path.IsLegacy() {
+				return nil, wrongPathType("a number", n.Value)
+			}
+			updated.Items = append(updated.Items, nil)
+			continue
+		}
+		n.Set(sum)
+		updated.Items = append(updated.Items, sum)
+	}
+	if j.path.IsLegacy() && len(nodes) == 0 {
+		return nil, pathNotExists(j.path)
+	}
+
+	if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+		return nil, err
+	}
+	if j.path.IsLegacy() {
+		return NewResult(jsondoc.Marshal(updated.Items[0], jsondoc.Format{})), nil
+	}
+	return NewResult(jsondoc.Marshal(updated, jsondoc.Format{})), nil
+}
+
+func addNumbers(a, b interface{}) (interface{}, bool) {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return x + y, true
+		}
+		return float64(x) + b.(float64), true //nolint:forcetypeassert // checked by constructor
+	case float64:
+		if y, ok := b.(int64); ok {
+			return x + float64(y), true
+		}
+		return x + b.(float64), true //nolint:forcetypeassert // checked by constructor
+	default:
+		return nil, false
+	}
+}
+
+func (j *jsonNumIncrBy) Args() []interface{} {
+	return []interface{}{JSONNUMINCRBY, j.key, j.path.String(), j.raw}
+}
+
+func JSONStrAppend(key, path string, value []byte) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseJSONValues(value)
+	if err != nil {
+		return nil, err
+	}
+	str, ok := values[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: value must be a JSON string", ErrInvalidOpt)
+	}
+	return &jsonStrAppend{jsonKeyPath: kp, raw: value, value: str}, nil
+}
+
+type jsonStrAppend struct {
+	modifyingCommand
+	jsonKeyPath
+	raw   []byte
+	value string
+}
+
+func (j *jsonStrAppend) Name() string {
+	return JSONSTRAPPEND
+}
+
+func (j *jsonStrAppend) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := applyJSON(j.path, j.path.Select(doc), func(n jsondoc.Node) (interface{}, error) {
+		str, ok := n.Value.(string)
+		if !ok {
+			return nil, wrongPathType("a string", n.Value)
+		}
+		str += j.value
+		n.Set(str)
+		return int64(len(str)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonStrAppend) Args() []interface{} {
+	return []interface{}{JSONSTRAPPEND, j.key, j.path.String(), j.raw}
+}
+
+func JSONArrAppend(key, path string, values ...[]byte) (Command, error) {
+	return JSONArrInsert(key, path, nil, values...)
+}
+
+// JSONArrInsert inserts values into arrays before index. Nil index means the end of arrays.
+func JSONArrInsert(key, path string, index *int, values ...[]byte) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseJSONValues(values...)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonArrInsert{jsonKeyPath: kp, raw: values, values: parsed, index: index}, nil
+}
+
+type jsonArrInsert struct {
+	modifyingCommand
+	jsonKeyPath
+	raw    [][]byte
+	values []interface{}
+	index  *int
+}
+
+func (j *jsonArrInsert) Name() string {
+	if j.index == nil {
+		return JSONARRAPPEND
+	}
+	return JSONARRINSERT
+}
+
+func (j *jsonArrInsert) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := j.path.Select(doc)
+	// Bounds are checked before any modification, so the command is applied either to all arrays or to none.
+	for _, n := range nodes {
+		if arr, ok := n.Value.(*jsondoc.Array); ok {
+			if _, err := j.position(arr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	results, err := applyJSON(j.path, nodes, func(n jsondoc.Node) (interface{}, error) {
+		arr, ok := n.Value.(*jsondoc.Array)
+		if !ok {
+			return nil, wrongPathType("an array", n.Value)
+		}
+		pos, _ := j.position(arr)
+		values := make([]interface{}, len(j.values))
+		for i, v := range j.values {
+			values[i] = jsondoc.Clone(v)
+		}
+		arr.Insert(pos, values...)
+		return int64(arr.Len()), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonArrInsert) position(arr *jsondoc.Array) (int, error) {
+	if j.index == nil {
+		return arr.Len(), nil
+	}
+	pos := *j.index
+	if pos < 0 {
+		pos += arr.Len()
+	}
+	if pos < 0 || pos > arr.Len() {
+		return 0, ErrJSONIndexOutOfBounds
+	}
+	return pos, nil
+}
+
+func (j *jsonArrInsert) Args() []interface{} {
+	res := []interface{}{j.Name(), j.key, j.path.String()}
+	if j.index != nil {
+		res = append(res, int64(*j.index))
+	}
+	for _, r := range j.raw {
+		res = append(res, r)
+	}
+	return res
+}
+
+func JSONArrPop(key, path string, index int) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonArrPop{jsonKeyPath: kp, index: index}, nil
+}
+
+type jsonArrPop struct {
+	modifyingCommand
+	jsonKeyPath
+	index int
+}
+
+func (j *jsonArrPop) Name() string {
+	return JSONARRPOP
+}
+
+func (j *jsonArrPop) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	doc, entry, err := getJSON(ctx, storage, j.key)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := applyJSON(j.path, j.path.Select(doc), func(n jsondoc.Node) (interface{}, error) {
+		arr, ok := n.Value.(*jsondoc.Array)
+		if !ok {
+			return nil, wrongPathType("an array", n.Value)
+		}
+		item, ok := arr.Pop(j.index)
+		if !ok {
+			return NilString(), nil
+		}
+		return jsondoc.Marshal(item, jsondoc.Format{}), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := touchJSON(ctx, storage, j.key, doc, entry); err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonArrPop) Args() []interface{} {
+	return []interface{}{JSONARRPOP, j.key, j.path.String(), int64(j.index)}
+}
+
+func JSONArrLen(key, path string) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonArrLen{jsonKeyPath: kp}, nil
+}
+
+type jsonArrLen struct {
+	baseCommand
+	jsonKeyPath
+}
+
+func (j *jsonArrLen) Name() string {
+	return JSONARRLEN
+}
+
+func (j *jsonArrLen) Execute(ctx context.Context, c Client) (*Result, error) {
+	doc, _, err := getJSON(ctx, c.Storage(), j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(NilString()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := applyJSON(j.path, j.path.Select(doc), func(n jsondoc.Node) (interface{}, error) {
+		arr, ok := n.Value.(*jsondoc.Array)
+		if !ok {
+			return nil, wrongPathType("an array", n.Value)
+		}
+		return int64(arr.Len()), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonArrLen) Args() []interface{} {
+	return []interface{}{JSONARRLEN, j.key, j.path.String()}
+}
+
+func JSONObjKeys(key, path string) (Command, error) {
+	kp, err := newJSONKeyPath(key, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonObjKeys{jsonKeyPath: kp}, nil
+}
+
+type jsonObjKeys struct {
+	baseCommand
+	jsonKeyPath
+}
+
+func (j *jsonObjKeys) Name() string {
+	return JSONOBJKEYS
+}
+
+func (j *jsonObjKeys) Execute(ctx context.Context, c Client) (*Result, error) {
+	doc, _, err := getJSON(ctx, c.Storage(), j.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(NilArray()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := applyJSON(j.path, j.path.Select(doc), func(n jsondoc.Node) (interface{}, error) {
+		obj, ok := n.Value.(*jsondoc.Object)
+		if !ok {
+			return nil, wrongPathType("an object", n.Value)
+		}
+		keys := make([]interface{}, obj.Len())
+		for i, key := range obj.Keys() {
+			keys[i] = []byte(key)
+		}
+		return keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jsonReply(j.path, results), nil
+}
+
+func (j *jsonObjKeys) Args() []interface{} {
+	return []interface{}{JSONOBJKEYS, j.key, j.path.String()}
+}
+
+func JSONMGet(path string, keys ...string) (Command, error) {
+	p, err := jsondoc.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonMGet{keys: keys, path: p}, nil
+}
+
+type jsonMGet struct {
+	baseCommand
+	keys []string
+	path *jsondoc.Path
+}
+
+func (j *jsonMGet) Name() string {
+	return JSONMGET
+}
+
+func (j *jsonMGet) Execute(ctx context.Context, c Client) (*Result, error) {
+	results := make([]interface{}, 0, len(j.keys))
+	for _, key := range j.keys {
+		doc, _, err := getJSON(ctx, c.Storage(), key)
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrWrongType) {
+			results = append(results, NilString())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := selectJSON(doc, j.path, j.path.IsLegacy())
+		if errors.Is(err, ErrJSONPathNotExists) {
+			results = append(results, NilString())
+			continue
+		}
+		results = append(results, jsondoc.Marshal(value, jsondoc.Format{}))
+	}
+	return NewResult(results), nil
+}
+
+func (j *jsonMGet) Args() []interface{} {
+	res := []interface{}{JSONMGET}
+	for _, key := range j.keys {
+		res = append(res, key)
+	}
+	return append(res, j.path.String())
+}
@@ -0,0 +1,117 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSet_newKeyMustBeRoot(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "doc", cmd.ValueJSON).Return(nil, cmd.ErrKeyNotFound)
+
+	set, err := cmd.JSONSet("doc", "$.a", []byte(`1`), "")
+	require.NoError(t, err)
+	_, err = set.Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrJSONNewAtRoot)
+}
+
+func TestJSONNumIncrBy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	root, err := jsondoc.Parse([]byte(`{"a":1,"b":{"a":"x"},"c":{"a":2.5}}`))
+	require.NoError(t, err)
+	doc := &mockValue{value: jsondoc.New(root)}
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "doc", cmd.ValueJSON).Return(doc, nil)
+	storage.EXPECT().Set(ctx, "doc", doc.value, nil).Return(doc, nil)
+
+	incr, err := cmd.JSONNumIncrBy("doc", "$..a", []byte(`2`))
+	require.NoError(t, err)
+	res, err := incr.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]byte(`[3,null,4.5]`)), res)
+}
+
+// TestJSONStrAppend_legacy checks legacy paths reply with the length of the first match and
+// JSONPath replies with lengths of all matches.
+func TestJSONStrAppend_legacy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cases := []struct {
+		path     string
+		expected interface{}
+	}{
+		{path: ".a", expected: int64(2)},
+		{path: "b.a", expected: int64(3)},
+		{path: "$..a", expected: []interface{}{int64(2), int64(3)}},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			t.Parallel()
+			ctl := gomock.NewController(t)
+			defer ctl.Finish()
+
+			root, err := jsondoc.Parse([]byte(`{"a":"x","b":{"a":"yy"}}`))
+			require.NoError(t, err)
+			doc := &mockValue{value: jsondoc.New(root)}
+			client := NewMockClient(ctl)
+			storage := NewMockStorage(ctl)
+			client.EXPECT().Storage().Return(storage)
+			storage.EXPECT().GetTyped(ctx, "doc", cmd.ValueJSON).Return(doc, nil)
+			storage.EXPECT().Set(ctx, "doc", doc.value, nil).Return(doc, nil)
+
+			command, err := cmd.JSONStrAppend("doc", c.path, []byte(`"z"`))
+			require.NoError(t, err)
+			res, err := command.Execute(ctx, client)
+			require.NoError(t, err)
+			assert.Equal(t, cmd.NewResult(c.expected), res)
+		})
+	}
+}
+
+func TestJSONCommands_wrongType(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "str", cmd.ValueJSON).Return(nil, cmd.ErrWrongType)
+
+	get, err := cmd.JSONGet("str", jsondoc.Format{})
+	require.NoError(t, err)
+	_, err = get.Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrWrongType)
+}
+
+func TestJSONSet_syntaxErrors(t *testing.T) {
+	t.Parallel()
+	_, err := cmd.JSONSet("doc", "$", []byte(`{"a":`), "")
+	assert.ErrorIs(t, err, cmd.ErrJSONSyntax)
+	assert.NotErrorIs(t, err, cmd.ErrInvalidOpt)
+
+	_, err = cmd.JSONSet("doc", "$[", []byte(`1`), "")
+	assert.ErrorIs(t, err, cmd.ErrJSONPathSyntax)
+	assert.NotErrorIs(t, err, cmd.ErrInvalidOpt)
+}
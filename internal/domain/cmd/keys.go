@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/burenotti/redis_impl/pkg/module"
+)
+
+const (
+	TypeNone       = "none"
+	TypeString     = "string"
+	TypeHash       = "hash"
+	TypeJSON       = "ReJSON-RL"
+	TypeTimeSeries = "TSDB-TYPE"
+	TypeBloom      = "MBbloom--"
+	TypeCuckoo     = "MBbloomCF"
+	TypeCMS        = "CMSk-TYPE"
+	TypeTopK       = "TopK-TYPE"
+	TypeTDigest    = "TDIS-TYPE"
+	TypeSuggest    = "trietype0"
+	TypeGraph      = "graphdata"
+	// TypeModule is a name of all module types. TYPE reports names of module types instead.
+	TypeModule = "module"
+)
+
+// TypeOf returns name of the type of the value as reported by TYPE command.
+func TypeOf(value interface{}) string {
+	if v, ok := value.(*module.Value); ok {
+		return v.Type.Name
+	}
+	return TypeOfValue(value).String()
+}
+
+func Type(key string) Command {
+	return &keyType{key: key}
+}
+
+type keyType struct {
+	baseCommand
+	key string
+}
+
+func (t *keyType) Name() string {
+	return TYPE
+}
+
+func (t *keyType) Execute(ctx context.Context, c Client) (*Result, error) {
+	entry, err := c.Storage().Get(ctx, t.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(TypeNone), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(TypeOf(entry.Value())), nil
+}
+
+func (t *keyType) Args() []interface{} {
+	return []interface{}{TYPE, t.key}
+}
+
+type ObjectSubcommand string
+
+const ObjectEncoding ObjectSubcommand = "ENCODING"
+
+// Object inspects internal representation of the value stored at key.
+func Object(sub ObjectSubcommand, key string) Command {
+	return &object{sub: sub, key: key}
+}
+
+type object struct {
+	baseCommand
+	sub ObjectSubcommand
+	key string
+}
+
+func (o *object) Name() string {
+	return OBJECT
+}
+
+func (o *object) Execute(ctx context.Context, c Client) (*Result, error) {
+	entry, err := c.Storage().Get(ctx, o.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(NilString()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult([]byte(entry.Encoding())), nil
+}
+
+func (o *object) Args() []interface{} {
+	return []interface{}{OBJECT, string(o.sub), o.key}
+}
+
+// Del removes keys and replies with amount of removed keys.
+func Del(keys ...string) Command {
+	return &del{keys: keys}
+}
+
+type del struct {
+	modifyingCommand
+	keys []string
+}
+
+func (d *del) Name() string {
+	return DEL
+}
+
+func (d *del) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	var removed int64
+	for _, key := range d.keys {
+		// Expired keys are removed by Get and aren't counted.
+		if _, err := storage.Get(ctx, key); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if _, err := storage.Del(ctx, key); err != nil {
+			return nil, err
+		}
+		removed++
+	}
+	return NewResult(removed), nil
+}
+
+func (d *del) Args() []interface{} {
+	res := []interface{}{DEL}
+	for _, key := range d.keys {
+		res = append(res, key)
+	}
+	return res
+}
@@ -7,6 +7,7 @@ package cmd_test
 import (
 	context "context"
 	cmd "github.com/burenotti/redis_impl/internal/domain/cmd"
+	search "github.com/burenotti/redis_impl/pkg/search"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 	time "time"
@@ -35,6 +36,35 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// Database mocks base method
+func (m *MockClient) Database(arg0 int) (cmd.Storage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Database", arg0)
+	ret0, _ := ret[0].(cmd.Storage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Database indicates an expected call of Database
+func (mr *MockClientMockRecorder) Database(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Database", reflect.TypeOf((*MockClient)(nil).Database), arg0)
+}
+
+// Databases mocks base method
+func (m *MockClient) Databases() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Databases")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Databases indicates an expected call of Databases
+func (mr *MockClientMockRecorder) Databases() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Databases", reflect.TypeOf((*MockClient)(nil).Databases))
+}
+
 // DiscardTx mocks base method
 func (m *MockClient) DiscardTx(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -64,18 +94,114 @@ func (mr *MockClientMockRecorder) ExecTx(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecTx", reflect.TypeOf((*MockClient)(nil).ExecTx), arg0)
 }
 
+// Functions mocks base method
+func (m *MockClient) Functions() *cmd.FunctionRegistry {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Functions")
+	ret0, _ := ret[0].(*cmd.FunctionRegistry)
+	return ret0
+}
+
+// Functions indicates an expected call of Functions
+func (mr *MockClientMockRecorder) Functions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Functions", reflect.TypeOf((*MockClient)(nil).Functions))
+}
+
+// Modules mocks base method
+func (m *MockClient) Modules() *cmd.ModuleRegistry {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Modules")
+	ret0, _ := ret[0].(*cmd.ModuleRegistry)
+	return ret0
+}
+
+// Modules indicates an expected call of Modules
+func (mr *MockClientMockRecorder) Modules() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Modules", reflect.TypeOf((*MockClient)(nil).Modules))
+}
+
+// ScriptMonitor mocks base method
+func (m *MockClient) ScriptMonitor() *cmd.ScriptMonitor {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScriptMonitor")
+	ret0, _ := ret[0].(*cmd.ScriptMonitor)
+	return ret0
+}
+
+// ScriptMonitor indicates an expected call of ScriptMonitor
+func (mr *MockClientMockRecorder) ScriptMonitor() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScriptMonitor", reflect.TypeOf((*MockClient)(nil).ScriptMonitor))
+}
+
+// Scripts mocks base method
+func (m *MockClient) Scripts() *cmd.ScriptCache {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scripts")
+	ret0, _ := ret[0].(*cmd.ScriptCache)
+	return ret0
+}
+
+// Scripts indicates an expected call of Scripts
+func (mr *MockClientMockRecorder) Scripts() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scripts", reflect.TypeOf((*MockClient)(nil).Scripts))
+}
+
+// Select mocks base method
+func (m *MockClient) Select(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Select", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Select indicates an expected call of Select
+func (mr *MockClientMockRecorder) Select(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Select", reflect.TypeOf((*MockClient)(nil).Select), arg0, arg1)
+}
+
+// SelectedDB mocks base method
+func (m *MockClient) SelectedDB() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectedDB")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// SelectedDB indicates an expected call of SelectedDB
+func (mr *MockClientMockRecorder) SelectedDB() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectedDB", reflect.TypeOf((*MockClient)(nil).SelectedDB))
+}
+
+// Shutdown mocks base method
+func (m *MockClient) Shutdown() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Shutdown")
+}
+
+// Shutdown indicates an expected call of Shutdown
+func (mr *MockClientMockRecorder) Shutdown() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockClient)(nil).Shutdown))
+}
+
 // StartTx mocks base method
-func (m *MockClient) StartTx(arg0 context.Context) error {
+func (m *MockClient) StartTx(arg0 context.Context, arg1 bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StartTx", arg0)
+	ret := m.ctrl.Call(m, "StartTx", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // StartTx indicates an expected call of StartTx
-func (mr *MockClientMockRecorder) StartTx(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) StartTx(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartTx", reflect.TypeOf((*MockClient)(nil).StartTx), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartTx", reflect.TypeOf((*MockClient)(nil).StartTx), arg0, arg1)
 }
 
 // Storage mocks base method
@@ -92,6 +218,20 @@ func (mr *MockClientMockRecorder) Storage() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Storage", reflect.TypeOf((*MockClient)(nil).Storage))
 }
 
+// SwapDB mocks base method
+func (m *MockClient) SwapDB(arg0 context.Context, arg1 int, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SwapDB", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SwapDB indicates an expected call of SwapDB
+func (mr *MockClientMockRecorder) SwapDB(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SwapDB", reflect.TypeOf((*MockClient)(nil).SwapDB), arg0, arg1, arg2)
+}
+
 // Unwatch mocks base method
 func (m *MockClient) Unwatch(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -163,6 +303,20 @@ func (mr *MockStorageMockRecorder) Del(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockStorage)(nil).Del), arg0, arg1)
 }
 
+// Flush mocks base method
+func (m *MockStorage) Flush(arg0 context.Context, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush
+func (mr *MockStorageMockRecorder) Flush(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockStorage)(nil).Flush), arg0, arg1)
+}
+
 // Get mocks base method
 func (m *MockStorage) Get(arg0 context.Context, arg1 string) (cmd.Entry, error) {
 	m.ctrl.T.Helper()
@@ -178,6 +332,93 @@ func (mr *MockStorageMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorage)(nil).Get), arg0, arg1)
 }
 
+// GetHash mocks base method
+func (m *MockStorage) GetHash(arg0 context.Context, arg1 string) (cmd.Hash, cmd.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHash", arg0, arg1)
+	ret0, _ := ret[0].(cmd.Hash)
+	ret1, _ := ret[1].(cmd.Entry)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetHash indicates an expected call of GetHash
+func (mr *MockStorageMockRecorder) GetHash(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHash", reflect.TypeOf((*MockStorage)(nil).GetHash), arg0, arg1)
+}
+
+// GetString mocks base method
+func (m *MockStorage) GetString(arg0 context.Context, arg1 string) ([]byte, cmd.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetString", arg0, arg1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(cmd.Entry)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetString indicates an expected call of GetString
+func (mr *MockStorageMockRecorder) GetString(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetString", reflect.TypeOf((*MockStorage)(nil).GetString), arg0, arg1)
+}
+
+// GetTyped mocks base method
+func (m *MockStorage) GetTyped(arg0 context.Context, arg1 string, arg2 cmd.ValueType) (cmd.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTyped", arg0, arg1, arg2)
+	ret0, _ := ret[0].(cmd.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTyped indicates an expected call of GetTyped
+func (mr *MockStorageMockRecorder) GetTyped(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTyped", reflect.TypeOf((*MockStorage)(nil).GetTyped), arg0, arg1, arg2)
+}
+
+// Indexes mocks base method
+func (m *MockStorage) Indexes() *search.Registry {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Indexes")
+	ret0, _ := ret[0].(*search.Registry)
+	return ret0
+}
+
+// Indexes indicates an expected call of Indexes
+func (mr *MockStorageMockRecorder) Indexes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Indexes", reflect.TypeOf((*MockStorage)(nil).Indexes))
+}
+
+// Len mocks base method
+func (m *MockStorage) Len(arg0 context.Context) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len", arg0)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len
+func (mr *MockStorageMockRecorder) Len(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockStorage)(nil).Len), arg0)
+}
+
+// Range mocks base method
+func (m *MockStorage) Range(arg0 context.Context, arg1 func(string, cmd.Entry) bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Range", arg0, arg1)
+}
+
+// Range indicates an expected call of Range
+func (mr *MockStorageMockRecorder) Range(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Range", reflect.TypeOf((*MockStorage)(nil).Range), arg0, arg1)
+}
+
 // Set mocks base method
 func (m *MockStorage) Set(arg0 context.Context, arg1 string, arg2 interface{}, arg3 *time.Time) (cmd.Entry, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/burenotti/redis_impl/pkg/module"
+)
+
+const MODULE = "MODULE"
+
+var (
+	ErrModuleLoad     = errors.New("Error loading the extension")
+	ErrModuleNotFound = errors.New("Error unloading module: no such module with that name")
+	ErrModuleHasTypes = errors.New("Error unloading module: the module exports one or more module-side data types, can't unload")
+	ErrModuleReply    = errors.New("module command returned a reply of unsupported type")
+	ErrUnknownCommand = errors.New("unknown command")
+)
+
+// ModuleRegistry holds loaded modules. Commands are looked up while parsing requests, which
+// happens outside of the global lock, so the registry is safe for concurrent use.
+type ModuleRegistry struct {
+	mu sync.RWMutex
+	// notify serializes delivery of events, because commands of different clients complete
+	// concurrently and subscribers are called sequentially.
+	notify   sync.Mutex
+	open     func(path string, args []string) (*module.Module, error)
+	modules  map[string]*module.Module
+	commands map[string]*module.Command
+	types    map[string]*module.Type
+	// reserved are names of built-in commands, which modules can't override.
+	reserved map[string]bool
+}
+
+// NewModuleRegistry creates a registry loading modules from Go plugins.
+func NewModuleRegistry() *ModuleRegistry {
+	return &ModuleRegistry{
+		open:     module.Open,
+		modules:  make(map[string]*module.Module),
+		commands: make(map[string]*module.Command),
+		types:    make(map[string]*module.Type),
+		reserved: make(map[string]bool),
+	}
+}
+
+// Reserve forbids modules to register commands with the names.
+func (r *ModuleRegistry) Reserve(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.reserved[strings.ToUpper(name)] = true
+	}
+}
+
+// Load opens the module at path and registers it.
+func (r *ModuleRegistry) Load(path string, args []string) (*module.Module, error) {
+	m, err := r.open(path, args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrModuleLoad, err)
+	}
+	if err := r.Add(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add registers an initialized module. Nothing is registered if any of its names is taken.
+func (r *ModuleRegistry) Add(m *module.Module) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.modules[m.Name]; ok {
+		return fmt.Errorf("%w: module %s is already loaded", ErrModuleLoad, m.Name)
+	}
+	for _, c := range m.Commands() {
+		if _, ok := r.commands[c.Name]; ok || r.reserved[c.Name] {
+			return fmt.Errorf("%w: %w: command %s already exists", ErrModuleLoad, module.ErrCommand, c.Name)
+		}
+	}
+	for _, t := range m.Types() {
+		if _, ok := r.types[t.Name]; ok {
+			return fmt.Errorf("%w: %w: type %s already exists", ErrModuleLoad, module.ErrType, t.Name)
+		}
+	}
+
+	r.modules[m.Name] = m
+	for _, c := range m.Commands() {
+		r.commands[c.Name] = c
+	}
+	for _, t := range m.Types() {
+		r.types[t.Name] = t
+	}
+	return nil
+}
+
+// Unload unregisters the module. Modules with types can't be unloaded, because keys may hold
+// their values. The code of plugins stays loaded, because Go can't close them.
+func (r *ModuleRegistry) Unload(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.modules[name]
+	if !ok {
+		return ErrModuleNotFound
+	}
+	if len(m.Types()) > 0 {
+		return ErrModuleHasTypes
+	}
+	for _, c := range m.Commands() {
+		delete(r.commands, c.Name)
+	}
+	delete(r.modules, name)
+	return nil
+}
+
+// Modules returns loaded modules sorted by name.
+func (r *ModuleRegistry) Modules() []*module.Module {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	modules := make([]*module.Module, 0, len(r.modules))
+	for _, m := range r.modules {
+		modules = append(modules, m)
+	}
+	slices.SortFunc(modules, func(a, b *module.Module) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return modules
+}
+
+// Command returns a command registered by a module. The name must be upper case.
+func (r *ModuleRegistry) Command(name string) (*module.Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.commands[name]
+	return c, ok
+}
+
+// Notify passes keyspace events to subscribers of all modules. Events of concurrent calls aren't
+// interleaved.
+func (r *ModuleRegistry) Notify(events []module.Event) {
+	if len(events) == 0 {
+		return
+	}
+	r.notify.Lock()
+	defer r.notify.Unlock()
+	r.mu.RLock()
+	var subscribers []module.Subscriber
+	for _, m := range r.modules {
+		subscribers = append(subscribers, m.Subscribers()...)
+	}
+	r.mu.RUnlock()
+	for _, event := range events {
+		for _, s := range subscribers {
+			s(event)
+		}
+	}
+}
+
+// ModuleCommand calls a command registered by a module. Args don't include the name.
+func ModuleCommand(command *module.Command, args [][]byte) Command {
+	return &moduleCommand{command: command, args: args}
+}
+
+type moduleCommand struct {
+	baseCommand
+	command *module.Command
+	args    [][]byte
+}
+
+func (m *moduleCommand) Name() string {
+	return m.command.Name
+}
+
+func (m *moduleCommand) IsModifying() bool {
+	return m.command.HasFlag(module.FlagWrite)
+}
+
+func (m *moduleCommand) Execute(ctx context.Context, c Client) (*Result, error) {
+	// The module could be unloaded while the command was queued in a transaction.
+	if current, ok := c.Modules().Command(m.command.Name); !ok || current != m.command {
+		return nil, fmt.Errorf("%w %s", ErrUnknownCommand, m.command.Name)
+	}
+	res, err := m.command.Handler(ctx, &moduleKeyspace{storage: c.Storage()}, m.args)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := moduleReply(res)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(reply), nil
+}
+
+func (m *moduleCommand) Args() []interface{} {
+	args := make([]interface{}, 0, len(m.args)+1)
+	args = append(args, m.command.Name)
+	for _, arg := range m.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// moduleReply checks that a reply of a module command can be sent to clients.
+func moduleReply(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return NilString(), nil
+	case int:
+		return int64(v), nil
+	case []byte, string, int64, error:
+		return v, nil
+	case []interface{}:
+		reply := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if reply[i], err = moduleReply(item); err != nil {
+				return nil, err
+			}
+		}
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrModuleReply, value)
+	}
+}
+
+// moduleKeyspace gives module commands access to the selected database.
+type moduleKeyspace struct {
+	storage Storage
+}
+
+func (k *moduleKeyspace) GetString(ctx context.Context, key string) ([]byte, bool, error) {
+	value, _, err := k.storage.GetString(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (k *moduleKeyspace) SetString(ctx context.Context, key string, value []byte) error {
+	_, err := k.storage.Set(ctx, key, value, nil)
+	return err
+}
+
+func (k *moduleKeyspace) GetValue(ctx context.Context, key string, typ *module.Type) (interface{}, bool, error) {
+	value, _, err := getTyped[*module.Value](ctx, k.storage, key, ValueModule)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if value.Type != typ {
+		return nil, false, ErrWrongType
+	}
+	return value.Value, true, nil
+}
+
+func (k *moduleKeyspace) SetValue(ctx context.Context, key string, typ *module.Type, value interface{}) error {
+	_, err := k.storage.Set(ctx, key, &module.Value{Type: typ, Value: value}, nil)
+	return err
+}
+
+func (k *moduleKeyspace) Del(ctx context.Context, key string) (bool, error) {
+	_, err := k.storage.Del(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ModuleLoad loads a module from a plugin.
+func ModuleLoad(path string, args []string) Command {
+	return &moduleLoad{path: path, args: args}
+}
+
+type moduleLoad struct {
+	baseCommand
+	path string
+	args []string
+}
+
+func (m *moduleLoad) Name() string {
+	return MODULE
+}
+
+func (m *moduleLoad) Execute(_ context.Context, c Client) (*Result, error) {
+	if _, err := c.Modules().Load(m.path, m.args); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (m *moduleLoad) Args() []interface{} {
+	args := []interface{}{MODULE, "LOAD", m.path}
+	for _, arg := range m.args {
+		args = append(args, arg)
+	}
+	return args
+}
+
+// ModuleUnload unloads a module by its name.
+func ModuleUnload(name string) Command {
+	return &moduleUnload{name: name}
+}
+
+type moduleUnload struct {
+	baseCommand
+	name string
+}
+
+func (m *moduleUnload) Name() string {
+	return MODULE
+}
+
+func (m *moduleUnload) Execute(_ context.Context, c Client) (*Result, error) {
+	if err := c.Modules().Unload(m.name); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (m *moduleUnload) Args() []interface{} {
+	return []interface{}{MODULE, "UNLOAD", m.name}
+}
+
+// ModuleList lists loaded modules.
+func ModuleList() Command {
+	return &moduleList{}
+}
+
+type moduleList struct {
+	baseCommand
+}
+
+func (m *moduleList) Name() string {
+	return MODULE
+}
+
+func (m *moduleList) Execute(_ context.Context, c Client) (*Result, error) {
+	modules := c.Modules().Modules()
+	reply := make([]interface{}, 0, len(modules))
+	for _, mod := range modules {
+		args := make([]interface{}, len(mod.Args))
+		for i, arg := range mod.Args {
+			args[i] = []byte(arg)
+		}
+		reply = append(reply, []interface{}{
+			[]byte("name"), []byte(mod.Name),
+			[]byte("ver"), int64(mod.Version),
+			[]byte("path"), []byte(mod.Path),
+			[]byte("args"), args,
+		})
+	}
+	return NewResult(reply), nil
+}
+
+func (m *moduleList) Args() []interface{} {
+	return []interface{}{MODULE, "LIST"}
+}
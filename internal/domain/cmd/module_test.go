@@ -0,0 +1,147 @@
+package cmd_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/module"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCounterModule creates a module with a counter type and a command incrementing counters.
+func newCounterModule(t *testing.T, name string, events *[]module.Event) *module.Module {
+	t.Helper()
+	m, err := module.Init(func(m *module.Module, _ []string) error {
+		m.Name = name
+		counter, err := m.CreateType(module.Type{
+			Name: name + "-counter",
+			Save: func(v interface{}) ([]byte, error) { return []byte(strconv.FormatInt(*v.(*int64), 10)), nil }, //nolint:forcetypeassert // values are counters
+			Load: func(data []byte) (interface{}, error) {
+				n, err := strconv.ParseInt(string(data), 10, 64)
+				return &n, err
+			},
+		})
+		if err != nil {
+			return err
+		}
+		m.Subscribe(func(e module.Event) { *events = append(*events, e) })
+		return m.CreateCommand(module.Command{
+			Name: name + ".incr", Arity: 2, Flags: []string{module.FlagWrite}, FirstKey: 1, LastKey: 1, KeyStep: 1,
+			Handler: func(ctx context.Context, ks module.Keyspace, args [][]byte) (interface{}, error) {
+				v, ok, err := ks.GetValue(ctx, string(args[0]), counter)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					v = new(int64)
+				}
+				n := v.(*int64) //nolint:forcetypeassert // values are counters
+				*n++
+				return *n, ks.SetValue(ctx, string(args[0]), counter, n)
+			},
+		})
+	}, "/modules/"+name+".so", nil)
+	require.NoError(t, err)
+	return m
+}
+
+func TestModuleRegistry(t *testing.T) {
+	t.Parallel()
+	var events []module.Event
+	registry := cmd.NewModuleRegistry()
+	registry.Reserve(cmd.GET)
+	first := newCounterModule(t, "first", &events)
+	require.NoError(t, registry.Add(first))
+	require.ErrorIs(t, registry.Add(newCounterModule(t, "first", &events)), cmd.ErrModuleLoad)
+
+	taken, err := module.Init(func(m *module.Module, _ []string) error {
+		m.Name = "taken"
+		return m.CreateCommand(module.Command{Name: "get", Arity: 2, Handler: func(context.Context, module.Keyspace, [][]byte) (interface{}, error) {
+			return nil, nil
+		}})
+	}, "", nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, registry.Add(taken), module.ErrCommand)
+
+	empty, err := module.Init(func(m *module.Module, _ []string) error {
+		m.Name = "empty"
+		return nil
+	}, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, registry.Add(empty))
+	assert.Equal(t, []*module.Module{empty, first}, registry.Modules())
+
+	_, ok := registry.Command("FIRST.INCR")
+	assert.True(t, ok)
+	registry.Notify([]module.Event{{DB: 1, Key: "k", Event: "set"}})
+	assert.Equal(t, []module.Event{{DB: 1, Key: "k", Event: "set"}}, events)
+
+	require.ErrorIs(t, registry.Unload("first"), cmd.ErrModuleHasTypes)
+	require.NoError(t, registry.Unload("empty"))
+	require.ErrorIs(t, registry.Unload("empty"), cmd.ErrModuleNotFound)
+}
+
+func TestModuleCommand(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	registry := cmd.NewModuleRegistry()
+	require.NoError(t, registry.Add(newCounterModule(t, "counter", new([]module.Event))))
+	incr, _ := registry.Command("COUNTER.INCR")
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Modules().Return(registry).AnyTimes()
+	client.EXPECT().Storage().Return(storage).AnyTimes()
+
+	stored := &module.Value{Type: registry.Modules()[0].Types()[0], Value: new(int64)}
+	storage.EXPECT().GetTyped(ctx, "c", cmd.ValueModule).Return(&mockValue{value: stored}, nil)
+	storage.EXPECT().Set(ctx, "c", stored, nil).Return(&mockValue{value: stored}, nil)
+	command := cmd.ModuleCommand(incr, [][]byte{[]byte("c")})
+	res, err := command.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(1)), res)
+	assert.True(t, command.IsModifying())
+	assert.Equal(t, []interface{}{"COUNTER.INCR", "c"}, command.Args())
+
+	storage.EXPECT().GetTyped(ctx, "s", cmd.ValueModule).Return(nil, cmd.ErrWrongType)
+	_, err = cmd.ModuleCommand(incr, [][]byte{[]byte("s")}).Execute(ctx, client)
+	require.ErrorIs(t, err, module.ErrWrongType)
+
+	// Values are copied with serialization callbacks.
+	clone, err := cmd.CloneValue(stored)
+	require.NoError(t, err)
+	assert.Equal(t, stored, clone)
+	assert.NotSame(t, stored.Value, clone.(*module.Value).Value) //nolint:forcetypeassert // clones keep types
+	assert.Equal(t, "counter-counter", cmd.TypeOf(stored))
+}
+
+func TestModuleList(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	registry := cmd.NewModuleRegistry()
+	require.NoError(t, registry.Add(newCounterModule(t, "counter", new([]module.Event))))
+	client := NewMockClient(ctl)
+	client.EXPECT().Modules().Return(registry).AnyTimes()
+
+	res, err := cmd.ModuleList().Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{[]interface{}{
+		[]byte("name"), []byte("counter"),
+		[]byte("ver"), int64(0),
+		[]byte("path"), []byte("/modules/counter.so"),
+		[]byte("args"), []interface{}{},
+	}}), res)
+
+	_, err = cmd.ModuleUnload("missing").Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrModuleNotFound)
+}
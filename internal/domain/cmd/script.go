@@ -0,0 +1,517 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // scripts are identified by SHA1 digests
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/burenotti/redis_impl/pkg/lua"
+)
+
+const (
+	EVAL      = "EVAL"
+	EVALSHA   = "EVALSHA"
+	EVALRO    = "EVAL_RO"
+	EVALSHARO = "EVALSHA_RO"
+	SCRIPT    = "SCRIPT"
+)
+
+// scriptChunk is the name of scripts in error messages.
+const scriptChunk = "user_script"
+
+var (
+	ErrNoScript         = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	ErrScriptCompile    = errors.New("Error compiling script (new function)")
+	ErrScriptRun        = errors.New("Error running script")
+	ErrScriptCommand    = errors.New("This Redis command is not allowed from script")
+	ErrScriptWrite      = errors.New("Write commands are not allowed from read-only scripts")
+	ErrScriptNoArgs     = errors.New("Please specify at least one argument for this redis lib call")
+	ErrScriptArgType    = errors.New("Lua redis lib command arguments must be strings or integers")
+	ErrScriptNumKeys    = errors.New("Number of keys can't be greater than number of args")
+	ErrScriptNegNumKeys = errors.New("Number of keys can't be negative")
+)
+
+// Parser creates a command from its name and arguments as they are sent by clients.
+type Parser func(args []interface{}) (Command, error)
+
+// Effect is a modifying command executed by another command against database DB.
+type Effect struct {
+	DB      int
+	Command Command
+}
+
+// Effector is implemented by commands which are logged as commands they executed instead of
+// themselves, so replaying the log doesn't depend on scripts. Effects are logged even if
+// the command failed, because executed commands aren't reverted.
+type Effector interface {
+	Effects() []Effect
+}
+
+// scriptCommands can't be called from scripts.
+var scriptCommands = map[string]bool{
+	EVAL: true, EVALSHA: true, EVALRO: true, EVALSHARO: true, SCRIPT: true,
+	FCALL: true, FCALLRO: true, FUNCTION: true, MODULE: true,
+}
+
+// ScriptCache holds compiled scripts by SHA1 digests of their sources.
+type ScriptCache struct {
+	mu      sync.Mutex
+	scripts map[string]*lua.Chunk
+}
+
+func NewScriptCache() *ScriptCache {
+	return &ScriptCache{scripts: make(map[string]*lua.Chunk)}
+}
+
+// ScriptSHA returns the digest identifying a script.
+func ScriptSHA(source string) string {
+	sum := sha1.Sum([]byte(source)) //nolint:gosec // scripts are identified by SHA1 digests
+	return hex.EncodeToString(sum[:])
+}
+
+// Load compiles a script and caches it.
+func (c *ScriptCache) Load(source string) (string, *lua.Chunk, error) {
+	sha := ScriptSHA(source)
+	if chunk, ok := c.Get(sha); ok {
+		return sha, chunk, nil
+	}
+	chunk, err := lua.Compile(scriptChunk, source)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrScriptCompile, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scripts[sha] = chunk
+	return sha, chunk, nil
+}
+
+// Get returns a script by its digest ignoring case.
+func (c *ScriptCache) Get(sha string) (*lua.Chunk, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chunk, ok := c.scripts[strings.ToLower(sha)]
+	return chunk, ok
+}
+
+func (c *ScriptCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.scripts)
+}
+
+// Eval runs a script with KEYS and ARGV globals. Read only scripts can't call
+// modifying commands. Parse creates commands called by the script.
+func Eval(source string, keys, args []string, readOnly bool, parse Parser) Command {
+	return &eval{source: source, keys: keys, args: args, readOnly: readOnly, parse: parse}
+}
+
+// EvalSHA runs a script cached by EVAL or SCRIPT LOAD.
+func EvalSHA(sha string, keys, args []string, readOnly bool, parse Parser) Command {
+	return &eval{sha: sha, keys: keys, args: args, readOnly: readOnly, parse: parse}
+}
+
+type eval struct {
+	baseCommand
+	source   string
+	sha      string
+	keys     []string
+	args     []string
+	readOnly bool
+	parse    Parser
+	effects  []Effect
+}
+
+func (e *eval) Name() string {
+	switch {
+	case e.sha != "" && e.readOnly:
+		return EVALSHARO
+	case e.sha != "":
+		return EVALSHA
+	case e.readOnly:
+		return EVALRO
+	}
+	return EVAL
+}
+
+func (e *eval) IsModifying() bool {
+	return !e.readOnly
+}
+
+func (e *eval) Execute(ctx context.Context, c Client) (*Result, error) {
+	e.effects = nil
+	var chunk *lua.Chunk
+	if e.sha != "" {
+		var ok bool
+		if chunk, ok = c.Scripts().Get(e.sha); !ok {
+			return nil, ErrNoScript
+		}
+	} else {
+		var err error
+		if _, chunk, err = c.Scripts().Load(e.source); err != nil {
+			return nil, err
+		}
+	}
+
+	state := lua.NewState()
+	state.SetGlobal("KEYS", stringsTable(e.keys))
+	state.SetGlobal("ARGV", stringsTable(e.args))
+	run := &scriptRun{client: c, parse: e.parse, readOnly: e.readOnly}
+	res, err := run.run(ctx, state, func(ctx context.Context) ([]lua.Value, error) {
+		return state.Run(ctx, chunk)
+	})
+	e.effects = run.effects
+	return res, err
+}
+
+func (e *eval) Effects() []Effect {
+	return e.effects
+}
+
+func (e *eval) Args() []interface{} {
+	script := e.source
+	if e.sha != "" {
+		script = e.sha
+	}
+	res := []interface{}{e.Name(), script, int64(len(e.keys))}
+	for _, key := range e.keys {
+		res = append(res, key)
+	}
+	for _, arg := range e.args {
+		res = append(res, arg)
+	}
+	return res
+}
+
+// scriptRun is an execution of a script or a function collecting modifying commands it called.
+type scriptRun struct {
+	client   Client
+	parse    Parser
+	readOnly bool
+	function bool
+	effects  []Effect
+}
+
+// run runs a script by calling f with the redis table available in the state, and converts
+// its result to a reply. The script must run with the passed context, which is cancelled
+// when the script is killed. Databases selected by the script don't affect the client.
+func (r *scriptRun) run(ctx context.Context, state *lua.State, f func(ctx context.Context) ([]lua.Value, error)) (*Result, error) {
+	db := r.client.SelectedDB()
+	defer func() { _ = r.client.Select(ctx, db) }()
+
+	scriptCtx, done := r.client.ScriptMonitor().Start(ctx, r.function)
+	defer done()
+
+	prev := state.Globals().GetString("redis")
+	defer state.SetGlobal("redis", prev)
+	state.SetGlobal("redis", r.library(scriptCtx))
+	rets, err := f(scriptCtx)
+	if err != nil {
+		if scriptCtx.Err() != nil {
+			return nil, context.Cause(scriptCtx)
+		}
+		return nil, scriptError(err)
+	}
+	var ret lua.Value
+	if len(rets) > 0 {
+		ret = rets[0]
+	}
+	reply := fromLua(ret)
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+	return NewResult(reply), nil
+}
+
+// library creates the redis table available to scripts.
+func (r *scriptRun) library(ctx context.Context) *lua.Table {
+	t := lua.NewTable(0, 0)
+	t.SetString("call", lua.NewFunction("call", func(_ *lua.State, args []lua.Value) ([]lua.Value, error) {
+		reply, err := r.command(ctx, args)
+		if err != nil {
+			return nil, &lua.Error{Value: errorTable(err.Error())}
+		}
+		return []lua.Value{toLua(reply)}, nil
+	}))
+	t.SetString("pcall", lua.NewFunction("pcall", func(_ *lua.State, args []lua.Value) ([]lua.Value, error) {
+		reply, err := r.command(ctx, args)
+		if err != nil {
+			return []lua.Value{errorTable(err.Error())}, nil
+		}
+		return []lua.Value{toLua(reply)}, nil
+	}))
+	t.SetString("error_reply", lua.NewFunction("error_reply", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		msg, ok := firstString(args)
+		if !ok {
+			return nil, s.Errorf("wrong number or type of arguments")
+		}
+		return []lua.Value{errorTable(msg)}, nil
+	}))
+	t.SetString("status_reply", lua.NewFunction("status_reply", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		msg, ok := firstString(args)
+		if !ok {
+			return nil, s.Errorf("wrong number or type of arguments")
+		}
+		status := lua.NewTable(0, 1)
+		status.SetString("ok", msg)
+		return []lua.Value{status}, nil
+	}))
+	t.SetString("sha1hex", lua.NewFunction("sha1hex", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		str, ok := firstString(args)
+		if !ok {
+			return nil, s.Errorf("wrong number of arguments")
+		}
+		return []lua.Value{ScriptSHA(str)}, nil
+	}))
+	registerLog(t)
+	return t
+}
+
+// registerLog adds redis.log and log levels to the redis table.
+func registerLog(t *lua.Table) {
+	// Scripts have no access to the server log, so messages are dropped.
+	t.SetString("log", lua.NewFunction("log", func(_ *lua.State, _ []lua.Value) ([]lua.Value, error) {
+		return nil, nil
+	}))
+	for i, level := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		t.SetString(level, float64(i))
+	}
+}
+
+// command executes a command called by the script and returns its reply.
+func (r *scriptRun) command(ctx context.Context, args []lua.Value) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, ErrScriptNoArgs
+	}
+	raw := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			raw[i] = []byte(arg)
+		case float64:
+			raw[i] = []byte(lua.FormatNumber(arg))
+		default:
+			return nil, ErrScriptArgType
+		}
+	}
+	command, err := r.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if command.IsTx() || scriptCommands[command.Name()] {
+		return nil, ErrScriptCommand
+	}
+	if r.readOnly && command.IsModifying() {
+		return nil, ErrScriptWrite
+	}
+	if command.IsModifying() {
+		r.client.ScriptMonitor().Wrote()
+	}
+	db := r.client.SelectedDB()
+	res, err := command.Execute(ctx, r.client)
+	if err != nil {
+		return nil, err
+	}
+	if command.IsModifying() {
+		r.effects = append(r.effects, Effect{DB: db, Command: command})
+	}
+	if len(res.Values) == 1 {
+		return res.Values[0], nil
+	}
+	return res.Values, nil
+}
+
+// scriptError converts an error raised by a script to a reply. Errors raised by redis.call
+// and error_reply tables are replied as is.
+func scriptError(err error) error {
+	var luaErr *lua.Error
+	if !errors.As(err, &luaErr) {
+		return err
+	}
+	if t, ok := luaErr.Value.(*lua.Table); ok {
+		if msg, ok := t.GetString("err").(string); ok {
+			return errors.New(singleLine(msg)) //nolint:err113 // replies errors of called commands
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrScriptRun, singleLine(luaErr.Error()))
+}
+
+// singleLine replaces line breaks, which can't be sent in error replies.
+func singleLine(msg string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+}
+
+func firstString(args []lua.Value) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	switch v := args[0].(type) {
+	case string:
+		return v, true
+	case float64:
+		return lua.FormatNumber(v), true
+	}
+	return "", false
+}
+
+func errorTable(msg string) *lua.Table {
+	t := lua.NewTable(0, 1)
+	t.SetString("err", msg)
+	return t
+}
+
+func stringsTable(items []string) *lua.Table {
+	t := lua.NewTable(len(items), 0)
+	for _, item := range items {
+		t.Append(item)
+	}
+	return t
+}
+
+// toLua converts a reply to a Lua value: integers to numbers, bulk strings to strings,
+// status replies to {ok=...}, errors to {err=...}, arrays to tables and nulls to false.
+func toLua(reply interface{}) lua.Value {
+	switch v := reply.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case []byte:
+		if v == nil {
+			return false
+		}
+		return string(v)
+	case string:
+		t := lua.NewTable(0, 1)
+		t.SetString("ok", v)
+		return t
+	case error:
+		return errorTable(v.Error())
+	case []interface{}:
+		if v == nil {
+			return false
+		}
+		t := lua.NewTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(item))
+		}
+		return t
+	}
+	return false
+}
+
+// fromLua converts a value returned by a script to a reply: numbers are truncated to integers,
+// true is 1, false and nil are null, tables with ok or err fields are status or error replies,
+// other tables are arrays up to their first nil.
+func fromLua(v lua.Value) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int64(1)
+		}
+	case float64:
+		return int64(v)
+	case string:
+		return []byte(v)
+	case *lua.Table:
+		if msg, ok := v.GetString("err").(string); ok {
+			return errors.New(singleLine(msg)) //nolint:err113 // error replies of scripts
+		}
+		if status, ok := v.GetString("ok").(string); ok {
+			return singleLine(status)
+		}
+		items := make([]interface{}, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.Get(float64(i))
+			if item == nil {
+				return items
+			}
+			items = append(items, fromLua(item))
+		}
+	}
+	return NilString()
+}
+
+// ScriptLoad compiles a script and caches it without running. Replies with the digest of the script.
+func ScriptLoad(source string) Command {
+	return &scriptLoad{source: source}
+}
+
+type scriptLoad struct {
+	baseCommand
+	source string
+}
+
+func (l *scriptLoad) Name() string {
+	return SCRIPT
+}
+
+func (l *scriptLoad) Execute(_ context.Context, c Client) (*Result, error) {
+	sha, _, err := c.Scripts().Load(l.source)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult([]byte(sha)), nil
+}
+
+func (l *scriptLoad) Args() []interface{} {
+	return []interface{}{SCRIPT, "LOAD", l.source}
+}
+
+// ScriptExists replies with an array of 1 for cached scripts and 0 for others.
+func ScriptExists(shas ...string) Command {
+	return &scriptExists{shas: shas}
+}
+
+type scriptExists struct {
+	baseCommand
+	shas []string
+}
+
+func (e *scriptExists) Name() string {
+	return SCRIPT
+}
+
+func (e *scriptExists) Execute(_ context.Context, c Client) (*Result, error) {
+	res := make([]interface{}, len(e.shas))
+	for i, sha := range e.shas {
+		_, ok := c.Scripts().Get(sha)
+		res[i] = boolReply(ok)
+	}
+	return NewResult(res), nil
+}
+
+func (e *scriptExists) Args() []interface{} {
+	res := []interface{}{SCRIPT, "EXISTS"}
+	for _, sha := range e.shas {
+		res = append(res, sha)
+	}
+	return res
+}
+
+// ScriptFlush removes all cached scripts.
+func ScriptFlush() Command {
+	return &scriptFlush{}
+}
+
+type scriptFlush struct {
+	baseCommand
+}
+
+func (f *scriptFlush) Name() string {
+	return SCRIPT
+}
+
+func (f *scriptFlush) Execute(_ context.Context, c Client) (*Result, error) {
+	c.Scripts().Flush()
+	return OkResult(), nil
+}
+
+func (f *scriptFlush) Args() []interface{} {
+	return []interface{}{SCRIPT, "FLUSH"}
+}
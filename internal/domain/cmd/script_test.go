@@ -0,0 +1,173 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+// parseScriptCommand parses GET, SET and EVAL called by scripts.
+func parseScriptCommand(args []interface{}) (cmd.Command, error) {
+	name := string(args[0].([]byte)) //nolint:forcetypeassert // scripts send strings
+	switch name {
+	case cmd.GET:
+		return cmd.Get(string(args[1].([]byte))), nil //nolint:forcetypeassert // scripts send strings
+	case cmd.SET:
+		return cmd.Set(string(args[1].([]byte)), args[2]) //nolint:forcetypeassert // scripts send strings
+	case cmd.EVAL:
+		return cmd.Eval("return 1", nil, nil, false, parseScriptCommand), nil
+	}
+	return nil, errUnknownCommand
+}
+
+func TestEval_replies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().Scripts().Return(cmd.NewScriptCache()).AnyTimes()
+	client.EXPECT().SelectedDB().Return(0).AnyTimes()
+	client.EXPECT().Select(ctx, 0).Return(nil).AnyTimes()
+	client.EXPECT().ScriptMonitor().Return(cmd.NewScriptMonitor(0)).AnyTimes()
+
+	tests := []struct {
+		script string
+		reply  interface{}
+	}{
+		{"return 1.9", int64(1)},
+		{"return 'a'", []byte("a")},
+		{"return true", int64(1)},
+		{"return false", []byte(nil)},
+		{"return nil", []byte(nil)},
+		{"return {ok = 'fine'}", "fine"},
+		{"return {1, 'b', {2}, nil, 3}", []interface{}{int64(1), []byte("b"), []interface{}{int64(2)}}},
+		{"return {KEYS[1], ARGV[1], #ARGV}", []interface{}{[]byte("key"), []byte("arg"), int64(2)}},
+		{"return redis.sha1hex('')", []byte("da39a3ee5e6b4b0d3255bfef95601890afd80709")},
+		{"return redis.status_reply('QUEUED')", "QUEUED"},
+	}
+	for _, tt := range tests {
+		res, err := cmd.Eval(tt.script, []string{"key"}, []string{"arg", "other"}, false, parseScriptCommand).Execute(ctx, client)
+		require.NoError(t, err, tt.script)
+		assert.Equal(t, []interface{}{tt.reply}, res.Values, tt.script)
+	}
+
+	for script, msg := range map[string]string{
+		"return {err = 'custom'}":                  "custom",
+		"return redis.error_reply('ERR custom')":   "ERR custom",
+		"error('failed')":                          "Error running script: user_script:1: failed",
+		"return redis.call('NOPE')":                "unknown command",
+		"return redis.call('EVAL', 'return 1', 0)": cmd.ErrScriptCommand.Error(),
+		"return redis.call({})":                    cmd.ErrScriptArgType.Error(),
+		"return redis.pcall('NOPE')":               "unknown command",
+		"return x(":                                "Error compiling script (new function): user_script:1: unexpected symbol near '<eof>'",
+	} {
+		_, err := cmd.Eval(script, nil, nil, false, parseScriptCommand).Execute(ctx, client)
+		require.Error(t, err, script)
+		assert.Equal(t, msg, err.Error(), script)
+	}
+
+	res, err := cmd.Eval("return redis.pcall('NOPE').err", nil, nil, false, parseScriptCommand).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("unknown command")}, res.Values)
+}
+
+func TestEval_effects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Scripts().Return(cmd.NewScriptCache()).AnyTimes()
+	client.EXPECT().Storage().Return(storage).AnyTimes()
+	client.EXPECT().SelectedDB().Return(2).AnyTimes()
+	client.EXPECT().Select(ctx, 2).Return(nil)
+	client.EXPECT().ScriptMonitor().Return(cmd.NewScriptMonitor(0)).AnyTimes()
+	storage.EXPECT().Get(gomock.Any(), "k").Return(nil, cmd.ErrKeyNotFound)
+	storage.EXPECT().Set(gomock.Any(), "k", []byte("10"), nil).Return(&mockValue{value: []byte("10")}, nil)
+	storage.EXPECT().GetString(gomock.Any(), "k").Return([]byte("10"), &mockValue{value: []byte("10")}, nil)
+
+	script := `
+		redis.call('SET', KEYS[1], ARGV[1] * 2)
+		local v = redis.call('GET', KEYS[1])
+		error('after ' .. v)
+	`
+	eval := cmd.Eval(script, []string{"k"}, []string{"5"}, false, parseScriptCommand)
+	_, err := eval.Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrScriptRun)
+
+	// Writes are kept even though the script failed, so they are logged.
+	effector, ok := eval.(cmd.Effector)
+	require.True(t, ok)
+	effects := effector.Effects()
+	require.Len(t, effects, 1)
+	assert.Equal(t, 2, effects[0].DB)
+	assert.Equal(t, []interface{}{cmd.SET, "k", []byte("10")}, effects[0].Command.Args())
+}
+
+func TestEval_readOnly(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().Scripts().Return(cmd.NewScriptCache())
+	client.EXPECT().SelectedDB().Return(0)
+	client.EXPECT().Select(ctx, 0).Return(nil)
+	client.EXPECT().ScriptMonitor().Return(cmd.NewScriptMonitor(0)).AnyTimes()
+
+	eval := cmd.Eval("return redis.call('SET', 'k', 'v')", nil, nil, true, parseScriptCommand)
+	assert.False(t, eval.IsModifying())
+	_, err := eval.Execute(ctx, client)
+	require.EqualError(t, err, cmd.ErrScriptWrite.Error())
+}
+
+func TestScript_cache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	client.EXPECT().Scripts().Return(cmd.NewScriptCache()).AnyTimes()
+	client.EXPECT().SelectedDB().Return(0).AnyTimes()
+	client.EXPECT().Select(ctx, 0).Return(nil).AnyTimes()
+	client.EXPECT().ScriptMonitor().Return(cmd.NewScriptMonitor(0)).AnyTimes()
+
+	source := "return ARGV[1] .. '!'"
+	sha := cmd.ScriptSHA(source)
+	_, err := cmd.EvalSHA(sha, nil, []string{"hi"}, false, parseScriptCommand).Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrNoScript)
+
+	res, err := cmd.ScriptLoad(source).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte(sha)}, res.Values)
+
+	_, err = cmd.ScriptLoad("return (").Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrScriptCompile)
+
+	res, err = cmd.ScriptExists(sha, "unknown").Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(1), int64(0)}}, res.Values)
+
+	res, err = cmd.EvalSHA(sha, nil, []string{"hi"}, true, parseScriptCommand).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("hi!")}, res.Values)
+
+	_, err = cmd.ScriptFlush().Execute(ctx, client)
+	require.NoError(t, err)
+	res, err = cmd.ScriptExists(sha).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(0)}}, res.Values)
+}
@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/burenotti/redis_impl/pkg/search"
+)
+
+const (
+	FTCREATE    = "FT.CREATE"
+	FTDROPINDEX = "FT.DROPINDEX"
+	FTINFO      = "FT.INFO"
+	FTSEARCH    = "FT.SEARCH"
+)
+
+// DefaultSearchLimit is amount of documents FT.SEARCH replies with by default.
+const DefaultSearchLimit = 10
+
+// FTCreate creates an index and indexes all existing hashes matching its definition.
+func FTCreate(def search.Definition) (Command, error) {
+	if err := def.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &ftCreate{def: def}, nil
+}
+
+type ftCreate struct {
+	modifyingCommand
+	def search.Definition
+}
+
+func (f *ftCreate) Name() string {
+	return FTCREATE
+}
+
+func (f *ftCreate) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	idx, err := storage.Indexes().Create(f.def)
+	if err != nil {
+		return nil, err
+	}
+	hashes := map[string]Hash{}
+	storage.Range(ctx, func(key string, entry Entry) bool {
+		if hash, ok := entry.Value().(Hash); ok {
+			hashes[key] = hash
+		}
+		return true
+	})
+	// HNSW graphs depend on the order of insertions, so hashes are indexed in a stable order.
+	keys := make([]string, 0, len(hashes))
+	for key := range hashes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		idx.Update(key, hashes[key])
+	}
+	return OkResult(), nil
+}
+
+func (f *ftCreate) Args() []interface{} {
+	res := []interface{}{FTCREATE, f.def.Name, "ON", "HASH"}
+	if len(f.def.Prefixes) > 0 {
+		res = append(res, "PREFIX", int64(len(f.def.Prefixes)))
+		for _, prefix := range f.def.Prefixes {
+			res = append(res, prefix)
+		}
+	}
+	res = append(res, "SCHEMA")
+	for _, field := range f.def.Fields {
+		res = append(res, field.Name)
+		if field.Alias != "" {
+			res = append(res, "AS", field.Alias)
+		}
+		res = append(res, string(field.Type))
+		res = append(res, fieldOptions(field)...)
+	}
+	return res
+}
+
+// fieldOptions returns options of a schema field as they are written in FT.CREATE.
+func fieldOptions(field search.Field) []interface{} {
+	var res []interface{}
+	switch field.Type {
+	case search.FieldText:
+		res = append(res, "WEIGHT", formatFloat(field.Weight))
+		if field.NoStem {
+			res = append(res, "NOSTEM")
+		}
+	case search.FieldTag:
+		res = append(res, "SEPARATOR", string(field.Separator))
+		if field.CaseSensitive {
+			res = append(res, "CASESENSITIVE")
+		}
+	case search.FieldVector:
+		v := field.Vector
+		attrs := []interface{}{"TYPE", "FLOAT32", "DIM", int64(v.Dim), "DISTANCE_METRIC", string(v.Metric)}
+		if v.Algorithm == search.VectorHNSW {
+			attrs = append(attrs,
+				"M", int64(v.M), "EF_CONSTRUCTION", int64(v.EFConstruction), "EF_RUNTIME", int64(v.EFRuntime))
+		}
+		res = append(res, string(v.Algorithm), int64(len(attrs)))
+		res = append(res, attrs...)
+	}
+	if field.Sortable {
+		res = append(res, "SORTABLE")
+	}
+	return res
+}
+
+// FTDropIndex removes an index. With deleteDocs indexed hashes are removed as well.
+func FTDropIndex(index string, deleteDocs bool) Command {
+	return &ftDropIndex{index: index, deleteDocs: deleteDocs}
+}
+
+type ftDropIndex struct {
+	modifyingCommand
+	index      string
+	deleteDocs bool
+}
+
+func (d *ftDropIndex) Name() string {
+	return FTDROPINDEX
+}
+
+func (d *ftDropIndex) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	idx, err := storage.Indexes().Drop(d.index)
+	if err != nil {
+		return nil, err
+	}
+	if !d.deleteDocs {
+		return OkResult(), nil
+	}
+	var keys []string
+	storage.Range(ctx, func(key string, entry Entry) bool {
+		if entry.Type() == ValueHash && idx.Definition().Matches(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		if _, err := storage.Del(ctx, key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+	return OkResult(), nil
+}
+
+func (d *ftDropIndex) Args() []interface{} {
+	if d.deleteDocs {
+		return []interface{}{FTDROPINDEX, d.index, "DD"}
+	}
+	return []interface{}{FTDROPINDEX, d.index}
+}
+
+func FTInfo(index string) Command {
+	return &ftInfo{index: index}
+}
+
+type ftInfo struct {
+	baseCommand
+	index string
+}
+
+func (i *ftInfo) Name() string {
+	return FTINFO
+}
+
+func (i *ftInfo) Execute(_ context.Context, c Client) (*Result, error) {
+	idx, err := c.Storage().Indexes().Get(i.index)
+	if err != nil {
+		return nil, err
+	}
+	def := idx.Definition()
+
+	prefixes := make([]interface{}, len(def.Prefixes))
+	for j, prefix := range def.Prefixes {
+		prefixes[j] = []byte(prefix)
+	}
+	attributes := make([]interface{}, len(def.Fields))
+	for j, field := range def.Fields {
+		attr := []interface{}{
+			"identifier", []byte(field.Name),
+			"attribute", []byte(field.Attribute()),
+			"type", string(field.Type),
+		}
+		attributes[j] = append(attr, fieldOptions(field)...)
+	}
+	return NewResult(
+		"index_name", []byte(def.Name),
+		"index_definition", []interface{}{"key_type", "HASH", "prefixes", prefixes},
+		"attributes", attributes,
+		"num_docs", int64(idx.NumDocs()),
+		"num_terms", int64(idx.NumTerms()),
+		"num_records", int64(idx.NumRecords()),
+		"hash_indexing_failures", int64(idx.Failures()),
+	), nil
+}
+
+func (i *ftInfo) Args() []interface{} {
+	return []interface{}{FTINFO, i.index}
+}
+
+// SearchOptions are options of FT.SEARCH.
+type SearchOptions struct {
+	// NoContent replies with keys only.
+	NoContent bool
+	Verbatim  bool
+	// Return lists fields to reply with. Nil means all fields.
+	Return     []string
+	SortBy     string
+	Descending bool
+	Offset     int64
+	Limit      int64
+	// Params are values of query parameters, e.g. vectors of KNN queries.
+	Params map[string][]byte
+}
+
+// FTSearch searches an index. See search.ParseQuery for the query language.
+func FTSearch(index, query string, opts SearchOptions) (Command, error) {
+	q, err := search.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, fmt.Errorf("%w: LIMIT offset and number must not be negative", ErrInvalidOpt)
+	}
+	return &ftSearch{index: index, query: query, parsed: q, opts: opts}, nil
+}
+
+type ftSearch struct {
+	baseCommand
+	index  string
+	query  string
+	parsed *search.Query
+	opts   SearchOptions
+}
+
+func (s *ftSearch) Name() string {
+	return FTSEARCH
+}
+
+func (s *ftSearch) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	idx, err := storage.Indexes().Get(s.index)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := idx.Search(s.parsed, search.SearchOptions{
+		SortBy:     s.opts.SortBy,
+		Descending: s.opts.Descending,
+		Verbatim:   s.opts.Verbatim,
+		Params:     s.opts.Params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired hashes stay indexed until they are touched, so every match is checked.
+	var hashes []Hash
+	var keys []string
+	var scores []float64
+	for _, m := range matches {
+		hash, _, err := getHash(ctx, storage, m.Key)
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrWrongType) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, m.Key)
+		hashes = append(hashes, hash)
+		scores = append(scores, m.Score)
+	}
+
+	res := []interface{}{int64(len(keys))}
+	start := min(s.opts.Offset, int64(len(keys)))
+	end := min(start+s.opts.Limit, int64(len(keys)))
+	for i := start; i < end; i++ {
+		res = append(res, []byte(keys[i]))
+		if s.opts.NoContent {
+			continue
+		}
+		res = append(res, s.fields(idx.Definition(), hashes[i], scores[i]))
+	}
+	return NewResult(res), nil
+}
+
+// fields returns requested fields of a hash. Requested names may be attributes of the index.
+// Distances of KNN queries are replied as a field of the document.
+func (s *ftSearch) fields(def search.Definition, hash Hash, score float64) []interface{} {
+	res := []interface{}{}
+	scoreField := s.parsed.ScoreField()
+	if s.opts.Return == nil {
+		if scoreField != "" {
+			res = append(res, []byte(scoreField), formatFloat(score))
+		}
+		for _, field := range hash.fields() {
+			res = append(res, []byte(field), hash[field])
+		}
+		return res
+	}
+	for _, name := range s.opts.Return {
+		if name == scoreField && scoreField != "" {
+			res = append(res, []byte(name), formatFloat(score))
+			continue
+		}
+		field := name
+		for _, f := range def.Fields {
+			if f.Attribute() == name {
+				field = f.Name
+				break
+			}
+		}
+		if value, ok := hash[field]; ok {
+			res = append(res, []byte(name), value)
+		}
+	}
+	return res
+}
+
+func (s *ftSearch) Args() []interface{} {
+	res := []interface{}{FTSEARCH, s.index, s.query}
+	if s.opts.NoContent {
+		res = append(res, "NOCONTENT")
+	}
+	if s.opts.Verbatim {
+		res = append(res, "VERBATIM")
+	}
+	if s.opts.Return != nil {
+		res = append(res, "RETURN", int64(len(s.opts.Return)))
+		for _, field := range s.opts.Return {
+			res = append(res, field)
+		}
+	}
+	if s.opts.SortBy != "" {
+		order := "ASC"
+		if s.opts.Descending {
+			order = "DESC"
+		}
+		res = append(res, "SORTBY", s.opts.SortBy, order)
+	}
+	if len(s.opts.Params) > 0 {
+		names := make([]string, 0, len(s.opts.Params))
+		for name := range s.opts.Params {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		res = append(res, "PARAMS", int64(2*len(names))) //nolint:mnd // name and value pairs
+		for _, name := range names {
+			res = append(res, name, s.opts.Params[name])
+		}
+	}
+	return append(res, "LIMIT", s.opts.Offset, s.opts.Limit)
+}
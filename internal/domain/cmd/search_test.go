@@ -0,0 +1,152 @@
+package cmd_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHIncrBy_overflow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	hash := cmd.Hash{"counter": []byte("9223372036854775806"), "name": []byte("x")}
+	storage.EXPECT().GetHash(ctx, "h").Return(hash, &mockValue{value: hash}, nil).Times(2)
+	storage.EXPECT().Set(ctx, "h", hash, nil).Return(&mockValue{value: hash}, nil)
+
+	res, err := cmd.HIncrBy("h", "counter", 1).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(math.MaxInt64)), res)
+
+	_, err = cmd.HIncrBy("h", "counter", 1).Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrIntegerOverflow)
+}
+
+func TestHDel_removesEmptyHash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	hash := cmd.Hash{"a": []byte("1")}
+	storage.EXPECT().GetHash(ctx, "h").Return(hash, &mockValue{value: hash}, nil)
+	storage.EXPECT().Del(ctx, "h").Return(nil, nil)
+
+	res, err := cmd.HDel("h", "a", "b").Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(1)), res)
+}
+
+func TestFTSearch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	registry := search.NewRegistry()
+	idx, err := registry.Create(search.Definition{
+		Name: "idx",
+		Fields: []search.Field{
+			{Name: "title", Type: search.FieldText, Weight: 1},
+			{Name: "price", Alias: "cost", Type: search.FieldNumeric},
+		},
+	})
+	require.NoError(t, err)
+	first := cmd.Hash{"title": []byte("red apple"), "price": []byte("3")}
+	second := cmd.Hash{"title": []byte("green apple"), "price": []byte("2")}
+	idx.Update("fruit:1", first)
+	idx.Update("fruit:2", second)
+	idx.Update("fruit:3", cmd.Hash{"title": []byte("apple"), "price": []byte("1")})
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().Indexes().Return(registry)
+	storage.EXPECT().GetHash(ctx, "fruit:1").Return(first, &mockValue{value: first}, nil)
+	storage.EXPECT().GetHash(ctx, "fruit:2").Return(second, &mockValue{value: second}, nil)
+	// Expired hashes are skipped and not counted.
+	storage.EXPECT().GetHash(ctx, "fruit:3").Return(nil, nil, cmd.ErrExpired)
+
+	query, err := cmd.FTSearch("idx", "@title:apple", cmd.SearchOptions{
+		Return: []string{"cost"},
+		SortBy: "cost",
+		Limit:  1,
+	})
+	require.NoError(t, err)
+	res, err := query.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{
+		int64(2),
+		[]byte("fruit:2"), []interface{}{[]byte("cost"), []byte("2")},
+	}), res)
+	assert.Equal(t, []interface{}{
+		cmd.FTSEARCH, "idx", "@title:apple", "RETURN", int64(1), "cost", "SORTBY", "cost", "ASC", "LIMIT", int64(0), int64(1),
+	}, query.Args())
+
+	_, err = cmd.FTSearch("idx", "(apple", cmd.SearchOptions{})
+	assert.ErrorIs(t, err, search.ErrSyntax)
+}
+
+func TestFTSearch_knn(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	def := search.Definition{
+		Name: "idx",
+		Fields: []search.Field{{Name: "vec", Type: search.FieldVector, Vector: search.VectorOptions{
+			Algorithm: search.VectorHNSW, Dim: 2, Metric: search.MetricL2, M: 4, EFConstruction: 8, EFRuntime: 4,
+		}}},
+	}
+	create, err := cmd.FTCreate(def)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		cmd.FTCREATE, "idx", "ON", "HASH", "SCHEMA", "vec", "VECTOR", "HNSW", int64(12),
+		"TYPE", "FLOAT32", "DIM", int64(2), "DISTANCE_METRIC", "L2", "M", int64(4), "EF_CONSTRUCTION", int64(8),
+		"EF_RUNTIME", int64(4),
+	}, create.Args())
+
+	registry := search.NewRegistry()
+	idx, err := registry.Create(def)
+	require.NoError(t, err)
+	near := cmd.Hash{"vec": search.EncodeVector([]float32{1, 1})}
+	far := cmd.Hash{"vec": search.EncodeVector([]float32{3, 3})}
+	idx.Update("near", near)
+	idx.Update("far", far)
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().Indexes().Return(registry)
+	storage.EXPECT().GetHash(ctx, "near").Return(near, &mockValue{value: near}, nil)
+	storage.EXPECT().GetHash(ctx, "far").Return(far, &mockValue{value: far}, nil)
+
+	query, err := cmd.FTSearch("idx", "*=>[KNN 2 @vec $q AS dist]", cmd.SearchOptions{
+		Return: []string{"dist"},
+		Limit:  cmd.DefaultSearchLimit,
+		Params: map[string][]byte{"q": search.EncodeVector([]float32{0, 0})},
+	})
+	require.NoError(t, err)
+	res, err := query.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{
+		int64(2),
+		[]byte("near"), []interface{}{[]byte("dist"), []byte("2")},
+		[]byte("far"), []interface{}{[]byte("dist"), []byte("18")},
+	}), res)
+}
@@ -0,0 +1,336 @@
+package cmd
+
+// Groups of commands as reported by COMMAND DOCS.
+const (
+	GroupGeneric      = "generic"
+	GroupString       = "string"
+	GroupHash         = "hash"
+	GroupConnection   = "connection"
+	GroupServer       = "server"
+	GroupTransactions = "transactions"
+	GroupScripting    = "scripting"
+	GroupJSON         = "json"
+	GroupTimeSeries   = "timeseries"
+	GroupBloom        = "bf"
+	GroupCuckoo       = "cf"
+	GroupCMS          = "cms"
+	GroupTopK         = "topk"
+	GroupTDigest      = "tdigest"
+	GroupSearch       = "search"
+	GroupSuggestion   = "suggestion"
+	GroupGraph        = "graph"
+	GroupModule       = "module"
+)
+
+// Flags and categories shared by many specs.
+var (
+	read      = []string{FlagReadOnly}
+	readFast  = []string{FlagReadOnly, FlagFast}
+	write     = []string{FlagWrite}
+	writeFast = []string{FlagWrite, FlagFast}
+	writeOOM  = []string{FlagWrite, FlagDenyOOM}
+	// writeOOMFast is for commands which add data in constant time.
+	writeOOMFast = []string{FlagWrite, FlagDenyOOM, FlagFast}
+	txFlags      = []string{FlagNoScript, FlagLoading, FlagStale, FlagFast}
+	adminFlags   = []string{FlagAdmin, FlagNoScript, FlagLoading, FlagStale}
+	scriptFlags  = []string{FlagNoScript, FlagStale}
+)
+
+// Key specs shared by many specs.
+var (
+	oneKeyRO    = []KeySpec{keyRange(1, 0, 1, KeyRO, KeyAccess)}
+	oneKeyRW    = []KeySpec{keyRange(1, 0, 1, KeyRW, KeyUpdate)}
+	oneKeyOW    = []KeySpec{keyRange(1, 0, 1, KeyOW, KeyUpdate)}
+	oneKeyRM    = []KeySpec{keyRange(1, 0, 1, KeyRM, KeyDelete)}
+	oneKeyNew   = []KeySpec{keyRange(1, 0, 1, KeyRW, KeyInsert)}
+	allKeysRO   = []KeySpec{keyRange(1, -1, 1, KeyRO, KeyAccess)}
+	allKeysRM   = []KeySpec{keyRange(1, -1, 1, KeyRM, KeyDelete)}
+	mergeKeys   = []KeySpec{keyRange(1, 0, 1, KeyRW, KeyInsert), keyNum(2, KeyRO, KeyAccess)}
+	scriptKeys  = []KeySpec{keyNum(2, KeyRW, KeyAccess, KeyUpdate)}
+	scriptKeyRO = []KeySpec{keyNum(2, KeyRO, KeyAccess)}
+)
+
+var builtinSpecs = []*CommandSpec{
+	{Name: GET, Arity: -2, Flags: readFast, Categories: []string{CatString}, Keys: allKeysRO, Group: GroupString,
+		Summary: "Returns the string values of keys."},
+	{Name: SET, Arity: -3, Flags: writeOOM, Categories: []string{CatString}, Keys: oneKeyOW, Group: GroupString,
+		Summary: "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist."},
+	{Name: DEL, Arity: -2, Flags: write, Categories: []string{CatKeyspace}, Keys: allKeysRM, Group: GroupGeneric,
+		Summary: "Deletes one or more keys."},
+	{Name: TYPE, Arity: 2, Flags: readFast, Categories: []string{CatKeyspace}, Keys: oneKeyRO, Group: GroupGeneric,
+		Summary: "Determines the type of value stored at a key."},
+	{Name: MOVE, Arity: 3, Flags: writeFast, Categories: []string{CatKeyspace}, Keys: oneKeyRW, Group: GroupGeneric,
+		Summary: "Moves a key to another database."},
+	{Name: OBJECT, Arity: -2, Categories: []string{CatKeyspace}, Group: GroupGeneric,
+		Summary: "A container for object introspection commands.",
+		Subcommands: []*CommandSpec{
+			{Name: OBJECT + "|ENCODING", Arity: 3, Flags: read, Categories: []string{CatKeyspace},
+				Keys: []KeySpec{keyRange(2, 0, 1, KeyRO)}, Group: GroupGeneric,
+				Summary: "Returns the internal encoding of a Redis object."},
+		}},
+	{Name: CLTHROTTLE, Arity: -5, Flags: writeOOMFast, Keys: oneKeyRW, Group: GroupModule,
+		Summary: "Rate limits an action with the generic cell rate algorithm."},
+
+	{Name: PING, Arity: -1, Flags: []string{FlagFast}, Categories: []string{CatConnection}, Group: GroupConnection,
+		Summary: "Returns the server's liveliness response."},
+	{Name: HELLO, Arity: -1, Flags: []string{FlagNoScript, FlagLoading, FlagStale, FlagFast}, Categories: []string{CatConnection},
+		Group: GroupConnection, Summary: "Handshakes with the Redis server."},
+	{Name: SELECT, Arity: 2, Flags: []string{FlagLoading, FlagStale, FlagFast}, Categories: []string{CatConnection},
+		Group: GroupConnection, Summary: "Changes the selected database."},
+	{Name: SWAPDB, Arity: 3, Flags: writeFast, Categories: []string{CatKeyspace, CatDangerous}, Group: GroupServer,
+		Summary: "Swaps two Redis databases."},
+	{Name: DBSIZE, Arity: 1, Flags: readFast, Categories: []string{CatKeyspace}, Group: GroupServer,
+		Summary: "Returns the number of keys in the database."},
+	{Name: FLUSHDB, Arity: -1, Flags: write, Categories: []string{CatKeyspace, CatDangerous}, Group: GroupServer,
+		Summary: "Removes all keys from the current database."},
+	{Name: FLUSHALL, Arity: -1, Flags: write, Categories: []string{CatKeyspace, CatDangerous}, Group: GroupServer,
+		Summary: "Removes all keys from all databases."},
+	{Name: SHUTDOWN, Arity: -1, Flags: adminFlags, Group: GroupServer,
+		Summary: "Synchronously saves the database(s) to disk and shuts down the Redis server."},
+	{Name: COMMAND, Arity: -1, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection}, Group: GroupServer,
+		Summary: "Returns detailed information about all commands.",
+		Subcommands: []*CommandSpec{
+			{Name: COMMAND + "|COUNT", Arity: 2, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection},
+				Group: GroupServer, Summary: "Returns a count of commands."},
+			{Name: COMMAND + "|INFO", Arity: -2, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection},
+				Group: GroupServer, Summary: "Returns information about one, multiple or all commands."},
+			{Name: COMMAND + "|DOCS", Arity: -2, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection},
+				Group: GroupServer, Summary: "Returns documentary information about one, multiple or all commands."},
+			{Name: COMMAND + "|LIST", Arity: -2, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection},
+				Group: GroupServer, Summary: "Returns a list of command names."},
+			{Name: COMMAND + "|GETKEYS", Arity: -3, Flags: []string{FlagLoading, FlagStale}, Categories: []string{CatConnection},
+				Group: GroupServer, Summary: "Extracts the key names from an arbitrary command."},
+		}},
+	{Name: MODULE, Arity: -2, Flags: []string{FlagAdmin, FlagNoScript}, Group: GroupServer,
+		Summary: "A container for module commands.",
+		Subcommands: []*CommandSpec{
+			{Name: MODULE + "|LOAD", Arity: -3, Flags: []string{FlagAdmin, FlagNoScript}, Group: GroupServer,
+				Summary: "Loads a module."},
+			{Name: MODULE + "|UNLOAD", Arity: 3, Flags: []string{FlagAdmin, FlagNoScript}, Group: GroupServer,
+				Summary: "Unloads a module."},
+			{Name: MODULE + "|LIST", Arity: 2, Flags: []string{FlagAdmin, FlagNoScript}, Group: GroupServer,
+				Summary: "Returns all loaded modules."},
+		}},
+
+	{Name: MULTI, Arity: -1, Flags: txFlags, Categories: []string{CatTransaction}, Group: GroupTransactions,
+		Summary: "Starts a transaction."},
+	{Name: EXEC, Arity: 1, Flags: []string{FlagNoScript, FlagLoading, FlagStale}, Categories: []string{CatTransaction},
+		Group: GroupTransactions, Summary: "Executes all commands in a transaction."},
+	{Name: DISCARD, Arity: 1, Flags: txFlags, Categories: []string{CatTransaction}, Group: GroupTransactions,
+		Summary: "Discards a transaction."},
+	{Name: WATCH, Arity: -2, Flags: txFlags, Categories: []string{CatTransaction}, Keys: allKeysRO, Group: GroupTransactions,
+		Summary: "Monitors changes to keys to determine the execution of a transaction."},
+	{Name: UNWATCH, Arity: 1, Flags: txFlags, Categories: []string{CatTransaction}, Group: GroupTransactions,
+		Summary: "Forgets about watched keys of a transaction."},
+
+	{Name: HSET, Arity: -4, Flags: writeOOMFast, Categories: []string{CatHash}, Keys: oneKeyRW, Group: GroupHash,
+		Summary: "Creates or modifies the value of a field in a hash."},
+	{Name: HGET, Arity: 3, Flags: readFast, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns the value of a field in a hash."},
+	{Name: HMGET, Arity: -3, Flags: readFast, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns the values of all fields in a hash."},
+	{Name: HDEL, Arity: -3, Flags: writeFast, Categories: []string{CatHash}, Keys: oneKeyRW, Group: GroupHash,
+		Summary: "Deletes one or more fields and their values from a hash. Deletes the hash if no fields remain."},
+	{Name: HGETALL, Arity: 2, Flags: read, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns all fields and values in a hash."},
+	{Name: HKEYS, Arity: 2, Flags: read, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns all fields in a hash."},
+	{Name: HVALS, Arity: 2, Flags: read, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns all values in a hash."},
+	{Name: HLEN, Arity: 2, Flags: readFast, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Returns the number of fields in a hash."},
+	{Name: HEXISTS, Arity: 3, Flags: readFast, Categories: []string{CatHash}, Keys: oneKeyRO, Group: GroupHash,
+		Summary: "Determines whether a field exists in a hash."},
+	{Name: HINCRBY, Arity: 4, Flags: writeOOMFast, Categories: []string{CatHash}, Keys: oneKeyRW, Group: GroupHash,
+		Summary: "Increments the integer value of a field in a hash by a number."},
+
+	{Name: FTCREATE, Arity: -2, Flags: writeOOM, Categories: []string{CatSearch}, Group: GroupSearch,
+		Summary: "Creates an index with the given spec."},
+	{Name: FTDROPINDEX, Arity: -2, Flags: write, Categories: []string{CatSearch}, Group: GroupSearch,
+		Summary: "Deletes the index, optionally with the indexed hashes."},
+	{Name: FTINFO, Arity: 2, Flags: read, Categories: []string{CatSearch}, Group: GroupSearch,
+		Summary: "Returns information and statistics on the index."},
+	{Name: FTSEARCH, Arity: -3, Flags: read, Categories: []string{CatSearch}, Group: GroupSearch,
+		Summary: "Searches the index with a textual query, returning either documents or just ids."},
+	{Name: FTSUGADD, Arity: -4, Flags: writeOOM, Categories: []string{CatSearch}, Keys: oneKeyRW, Group: GroupSuggestion,
+		Summary: "Adds a suggestion string to an auto-complete suggestion dictionary."},
+	{Name: FTSUGGET, Arity: -3, Flags: read, Categories: []string{CatSearch}, Keys: oneKeyRO, Group: GroupSuggestion,
+		Summary: "Gets completion suggestions for a prefix."},
+	{Name: FTSUGDEL, Arity: 3, Flags: write, Categories: []string{CatSearch}, Keys: oneKeyRW, Group: GroupSuggestion,
+		Summary: "Deletes a string from a suggestion index."},
+	{Name: FTSUGLEN, Arity: 2, Flags: read, Categories: []string{CatSearch}, Keys: oneKeyRO, Group: GroupSuggestion,
+		Summary: "Gets the size of an auto-complete suggestion dictionary."},
+
+	{Name: GRAPHQUERY, Arity: -3, Flags: writeOOM, Categories: []string{CatGraph}, Keys: oneKeyRW, Group: GroupGraph,
+		Summary: "Executes the given query against a specified graph."},
+	{Name: GRAPHROQUERY, Arity: -3, Flags: read, Categories: []string{CatGraph}, Keys: oneKeyRO, Group: GroupGraph,
+		Summary: "Executes a given read only query against a specified graph."},
+	{Name: GRAPHDELETE, Arity: 2, Flags: write, Categories: []string{CatGraph}, Keys: oneKeyRM, Group: GroupGraph,
+		Summary: "Completely removes the graph and all of its entities."},
+	{Name: GRAPHEXPLAIN, Arity: 3, Flags: read, Categories: []string{CatGraph}, Keys: oneKeyRO, Group: GroupGraph,
+		Summary: "Returns a query execution plan without running the query."},
+
+	{Name: JSONSET, Arity: -4, Flags: writeOOM, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Sets or updates the JSON value at a path."},
+	{Name: JSONGET, Arity: -2, Flags: read, Categories: []string{CatJSON}, Keys: oneKeyRO, Group: GroupJSON,
+		Summary: "Gets the value at one or more paths in JSON serialized form."},
+	{Name: JSONDEL, Arity: -2, Flags: write, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Deletes a value."},
+	{Name: JSONTYPE, Arity: -2, Flags: read, Categories: []string{CatJSON}, Keys: oneKeyRO, Group: GroupJSON,
+		Summary: "Returns the type of the JSON value at path."},
+	{Name: JSONNUMINCRBY, Arity: 4, Flags: write, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Increments the numeric value at path by a value."},
+	{Name: JSONSTRAPPEND, Arity: -3, Flags: writeOOM, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Appends a string to a JSON string value at path."},
+	{Name: JSONARRAPPEND, Arity: -4, Flags: writeOOM, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Appends one or more JSON values into the array at path after the last element in it."},
+	{Name: JSONARRINSERT, Arity: -5, Flags: writeOOM, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Inserts the JSON scalar(s) value at the specified index in the array at path."},
+	{Name: JSONARRPOP, Arity: -2, Flags: write, Categories: []string{CatJSON}, Keys: oneKeyRW, Group: GroupJSON,
+		Summary: "Removes and returns the element at the specified index in the array at path."},
+	{Name: JSONARRLEN, Arity: -2, Flags: read, Categories: []string{CatJSON}, Keys: oneKeyRO, Group: GroupJSON,
+		Summary: "Returns the length of the array at path."},
+	{Name: JSONOBJKEYS, Arity: -2, Flags: read, Categories: []string{CatJSON}, Keys: oneKeyRO, Group: GroupJSON,
+		Summary: "Returns the JSON keys of the object at path."},
+	{Name: JSONMGET, Arity: -3, Flags: read, Categories: []string{CatJSON}, Keys: []KeySpec{keyRange(1, -2, 1, KeyRO, KeyAccess)},
+		Group: GroupJSON, Summary: "Returns the values at a path from one or more keys."},
+
+	{Name: TSCREATE, Arity: -2, Flags: writeOOM, Categories: []string{CatTimeSeries}, Keys: oneKeyNew, Group: GroupTimeSeries,
+		Summary: "Creates a new time series."},
+	{Name: TSADD, Arity: -4, Exclusive: true, Flags: writeOOM, Categories: []string{CatTimeSeries}, Keys: oneKeyRW, Group: GroupTimeSeries,
+		Summary: "Appends a sample to a time series."},
+	{Name: TSMADD, Arity: -4, Exclusive: true, Flags: writeOOM, Categories: []string{CatTimeSeries},
+		Keys: []KeySpec{keyRange(1, -1, 3, KeyRW, KeyUpdate)}, Group: GroupTimeSeries,
+		Summary: "Appends new samples to one or more time series."},
+	{Name: TSINCRBY, Arity: -3, Exclusive: true, Flags: writeOOM, Categories: []string{CatTimeSeries}, Keys: oneKeyRW, Group: GroupTimeSeries,
+		Summary: "Increases the value of the sample with the maximum existing timestamp, or creates a new sample."},
+	{Name: TSGET, Arity: -2, Flags: read, Categories: []string{CatTimeSeries}, Keys: oneKeyRO, Group: GroupTimeSeries,
+		Summary: "Gets the sample with the highest timestamp from a given time series."},
+	{Name: TSRANGE, Arity: -4, Flags: read, Categories: []string{CatTimeSeries}, Keys: oneKeyRO, Group: GroupTimeSeries,
+		Summary: "Queries a range in forward direction."},
+	{Name: TSREVRANGE, Arity: -4, Flags: read, Categories: []string{CatTimeSeries}, Keys: oneKeyRO, Group: GroupTimeSeries,
+		Summary: "Queries a range in reverse direction."},
+	{Name: TSCREATERULE, Arity: -6, Flags: write, Categories: []string{CatTimeSeries},
+		Keys: []KeySpec{keyRange(1, 1, 1, KeyRW, KeyUpdate)}, Group: GroupTimeSeries,
+		Summary: "Creates a compaction rule."},
+	{Name: TSMRANGE, Arity: -4, Flags: read, Categories: []string{CatTimeSeries}, Group: GroupTimeSeries,
+		Summary: "Queries a range across multiple time series by filters in forward direction."},
+	{Name: TSMREVRANGE, Arity: -4, Flags: read, Categories: []string{CatTimeSeries}, Group: GroupTimeSeries,
+		Summary: "Queries a range across multiple time series by filters in reverse direction."},
+
+	{Name: BFRESERVE, Arity: -4, Flags: writeOOM, Categories: []string{CatBloom}, Keys: oneKeyNew, Group: GroupBloom,
+		Summary: "Creates a new Bloom Filter."},
+	{Name: BFADD, Arity: 3, Flags: writeOOMFast, Categories: []string{CatBloom}, Keys: oneKeyRW, Group: GroupBloom,
+		Summary: "Adds an item to a Bloom Filter."},
+	{Name: BFMADD, Arity: -3, Flags: writeOOM, Categories: []string{CatBloom}, Keys: oneKeyRW, Group: GroupBloom,
+		Summary: "Adds one or more items to a Bloom Filter. A filter will be created if it does not exist."},
+	{Name: BFEXISTS, Arity: 3, Flags: readFast, Categories: []string{CatBloom}, Keys: oneKeyRO, Group: GroupBloom,
+		Summary: "Checks whether an item exists in a Bloom Filter."},
+	{Name: BFMEXISTS, Arity: -3, Flags: read, Categories: []string{CatBloom}, Keys: oneKeyRO, Group: GroupBloom,
+		Summary: "Checks whether one or more items exist in a Bloom Filter."},
+	{Name: BFINFO, Arity: -2, Flags: readFast, Categories: []string{CatBloom}, Keys: oneKeyRO, Group: GroupBloom,
+		Summary: "Returns information about a Bloom Filter."},
+	{Name: CFRESERVE, Arity: -3, Flags: writeOOM, Categories: []string{CatCuckoo}, Keys: oneKeyNew, Group: GroupCuckoo,
+		Summary: "Creates a new Cuckoo Filter."},
+	{Name: CFADD, Arity: 3, Flags: writeOOMFast, Categories: []string{CatCuckoo}, Keys: oneKeyRW, Group: GroupCuckoo,
+		Summary: "Adds an item to a Cuckoo Filter."},
+	{Name: CFADDNX, Arity: 3, Flags: writeOOMFast, Categories: []string{CatCuckoo}, Keys: oneKeyRW, Group: GroupCuckoo,
+		Summary: "Adds an item to a Cuckoo Filter if the item did not exist previously."},
+	{Name: CFDEL, Arity: 3, Flags: writeFast, Categories: []string{CatCuckoo}, Keys: oneKeyRW, Group: GroupCuckoo,
+		Summary: "Deletes an item from a Cuckoo Filter."},
+	{Name: CFEXISTS, Arity: 3, Flags: readFast, Categories: []string{CatCuckoo}, Keys: oneKeyRO, Group: GroupCuckoo,
+		Summary: "Checks if an item exists in a Cuckoo Filter."},
+	{Name: CFCOUNT, Arity: 3, Flags: readFast, Categories: []string{CatCuckoo}, Keys: oneKeyRO, Group: GroupCuckoo,
+		Summary: "Returns the number of times an item may be in the filter."},
+
+	{Name: CMSINITBYDIM, Arity: 4, Flags: writeOOMFast, Categories: []string{CatCMS}, Keys: oneKeyNew, Group: GroupCMS,
+		Summary: "Initializes a Count-Min Sketch to dimensions specified by user."},
+	{Name: CMSINITBYPROB, Arity: 4, Flags: writeOOMFast, Categories: []string{CatCMS}, Keys: oneKeyNew, Group: GroupCMS,
+		Summary: "Initializes a Count-Min Sketch to accommodate requested tolerances."},
+	{Name: CMSINCRBY, Arity: -4, Flags: writeOOM, Categories: []string{CatCMS}, Keys: oneKeyRW, Group: GroupCMS,
+		Summary: "Increases the count of one or more items by increment."},
+	{Name: CMSQUERY, Arity: -3, Flags: read, Categories: []string{CatCMS}, Keys: oneKeyRO, Group: GroupCMS,
+		Summary: "Returns the count for one or more items in a sketch."},
+	{Name: CMSMERGE, Arity: -4, Flags: writeOOM, Categories: []string{CatCMS}, Keys: mergeKeys, Group: GroupCMS,
+		Summary: "Merges several sketches into one sketch."},
+	{Name: TOPKRESERVE, Arity: -3, Flags: writeOOM, Categories: []string{CatTopK}, Keys: oneKeyNew, Group: GroupTopK,
+		Summary: "Initializes a TopK with specified parameters."},
+	{Name: TOPKADD, Arity: -3, Flags: writeOOM, Categories: []string{CatTopK}, Keys: oneKeyRW, Group: GroupTopK,
+		Summary: "Increases the count of one or more items by one."},
+	{Name: TOPKINCRBY, Arity: -4, Flags: writeOOM, Categories: []string{CatTopK}, Keys: oneKeyRW, Group: GroupTopK,
+		Summary: "Increases the count of one or more items by increment."},
+	{Name: TOPKQUERY, Arity: -3, Flags: read, Categories: []string{CatTopK}, Keys: oneKeyRO, Group: GroupTopK,
+		Summary: "Checks whether one or more items are in a sketch."},
+	{Name: TOPKLIST, Arity: -2, Flags: read, Categories: []string{CatTopK}, Keys: oneKeyRO, Group: GroupTopK,
+		Summary: "Returns full list of items in Top K list."},
+
+	{Name: TDIGESTCREATE, Arity: -2, Flags: writeOOM, Categories: []string{CatTDigest}, Keys: oneKeyNew, Group: GroupTDigest,
+		Summary: "Allocates memory and initializes a new t-digest sketch."},
+	{Name: TDIGESTADD, Arity: -3, Flags: writeOOM, Categories: []string{CatTDigest}, Keys: oneKeyRW, Group: GroupTDigest,
+		Summary: "Adds one or more observations to a t-digest sketch."},
+	{Name: TDIGESTRESET, Arity: 2, Flags: write, Categories: []string{CatTDigest}, Keys: oneKeyRW, Group: GroupTDigest,
+		Summary: "Resets a t-digest sketch: empty the sketch and re-initializes it."},
+	{Name: TDIGESTMERGE, Arity: -4, Flags: writeOOM, Categories: []string{CatTDigest}, Keys: mergeKeys, Group: GroupTDigest,
+		Summary: "Merges multiple t-digest sketches into a single sketch."},
+	{Name: TDIGESTQUANTILE, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input fraction, an estimation of the value smaller than the given fraction of observations."},
+	{Name: TDIGESTCDF, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input value, an estimation of the fraction of observations smaller than the value."},
+	{Name: TDIGESTRANK, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input value, an estimation of the number of observations smaller than the value."},
+	{Name: TDIGESTREVRANK, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input value, an estimation of the number of observations larger than the value."},
+	{Name: TDIGESTBYRANK, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input rank, an estimation of the value with that rank."},
+	{Name: TDIGESTBYREVRANK, Arity: -3, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns, for each input reverse rank, an estimation of the value with that reverse rank."},
+	{Name: TDIGESTMIN, Arity: 2, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns the minimum observation value from a t-digest sketch."},
+	{Name: TDIGESTMAX, Arity: 2, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns the maximum observation value from a t-digest sketch."},
+	{Name: TDIGESTTRIMMEDMEAN, Arity: 4, Flags: read, Categories: []string{CatTDigest}, Keys: oneKeyRO, Group: GroupTDigest,
+		Summary: "Returns an estimation of the mean value from the sketch, excluding observation values outside the cutoffs."},
+
+	{Name: EVAL, Arity: -3, Exclusive: true, Flags: scriptFlags, Categories: []string{CatScripting}, Keys: scriptKeys, Group: GroupScripting,
+		Summary: "Executes a server-side Lua script."},
+	{Name: EVALRO, Arity: -3, Exclusive: true, Flags: []string{FlagReadOnly, FlagNoScript, FlagStale}, Categories: []string{CatScripting},
+		Keys: scriptKeyRO, Group: GroupScripting, Summary: "Executes a read-only server-side Lua script."},
+	{Name: EVALSHA, Arity: -3, Exclusive: true, Flags: scriptFlags, Categories: []string{CatScripting}, Keys: scriptKeys, Group: GroupScripting,
+		Summary: "Executes a server-side Lua script by SHA1 digest."},
+	{Name: EVALSHARO, Arity: -3, Exclusive: true, Flags: []string{FlagReadOnly, FlagNoScript, FlagStale}, Categories: []string{CatScripting},
+		Keys: scriptKeyRO, Group: GroupScripting, Summary: "Executes a read-only server-side Lua script by SHA1 digest."},
+	{Name: FCALL, Arity: -3, Exclusive: true, Flags: scriptFlags, Categories: []string{CatScripting}, Keys: scriptKeys, Group: GroupScripting,
+		Summary: "Invokes a function."},
+	{Name: FCALLRO, Arity: -3, Exclusive: true, Flags: []string{FlagReadOnly, FlagNoScript, FlagStale}, Categories: []string{CatScripting},
+		Keys: scriptKeyRO, Group: GroupScripting, Summary: "Invokes a read-only function."},
+	{Name: SCRIPT, Arity: -2, Categories: []string{CatScripting}, Group: GroupScripting,
+		Summary: "A container for Lua scripts management commands.",
+		Subcommands: []*CommandSpec{
+			{Name: SCRIPT + "|LOAD", Arity: 3, Flags: []string{FlagNoScript, FlagStale}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Loads a server-side Lua script to the script cache."},
+			{Name: SCRIPT + "|EXISTS", Arity: -3, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Determines whether server-side Lua scripts exist in the script cache."},
+			{Name: SCRIPT + "|FLUSH", Arity: -2, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Removes all server-side Lua scripts from the script cache."},
+			{Name: SCRIPT + "|KILL", Arity: 2, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Terminates a server-side Lua script during execution."},
+		}},
+	{Name: FUNCTION, Arity: -2, Categories: []string{CatScripting}, Group: GroupScripting,
+		Summary: "A container for function commands.",
+		Subcommands: []*CommandSpec{
+			{Name: FUNCTION + "|LOAD", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM, FlagNoScript},
+				Categories: []string{CatScripting}, Group: GroupScripting, Summary: "Creates a library."},
+			{Name: FUNCTION + "|DELETE", Arity: 3, Flags: []string{FlagWrite, FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Deletes a library and its functions."},
+			{Name: FUNCTION + "|FLUSH", Arity: -2, Flags: []string{FlagWrite, FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Deletes all libraries and functions."},
+			{Name: FUNCTION + "|LIST", Arity: -2, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Returns information about all libraries."},
+			{Name: FUNCTION + "|DUMP", Arity: 2, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Dumps all libraries into a serialized binary payload."},
+			{Name: FUNCTION + "|RESTORE", Arity: -3, Flags: []string{FlagWrite, FlagDenyOOM, FlagNoScript},
+				Categories: []string{CatScripting}, Group: GroupScripting, Summary: "Restores all libraries from a payload."},
+			{Name: FUNCTION + "|KILL", Arity: 2, Flags: []string{FlagNoScript}, Categories: []string{CatScripting},
+				Group: GroupScripting, Summary: "Terminates a function during execution."},
+		}},
+}
@@ -22,7 +22,7 @@ func (g *get) Execute(ctx context.Context, c Client) (*Result, error) {
 	result := make([]interface{}, 0, len(g.Keys))
 	storage := c.Storage()
 	for _, key := range g.Keys {
-		val, err := storage.Get(ctx, key)
+		val, _, err := storage.GetString(ctx, key)
 		if err != nil {
 			if errors.Is(err, ErrKeyNotFound) {
 				result = append(result, NilString())
@@ -30,7 +30,7 @@ func (g *get) Execute(ctx context.Context, c Client) (*Result, error) {
 			}
 			return &Result{Values: result}, err
 		}
-		result = append(result, val.Value())
+		result = append(result, val)
 	}
 	return &Result{Values: result}, nil
 }
@@ -123,11 +123,23 @@ func (s *set) Name() string {
 }
 
 func (s *set) Execute(ctx context.Context, c Client) (*Result, error) {
-	prev, err := c.Storage().Get(ctx, s.key)
-	keyNotFound := prev == nil
+	storage := c.Storage()
+	var prev Entry
+	var previous []byte
+	var err error
+	if s.get {
+		// The previous value is replied, so it must be a string.
+		previous, prev, err = storage.GetString(ctx, s.key)
+	} else {
+		prev, err = storage.Get(ctx, s.key)
+	}
+	keyNotFound := errors.Is(err, ErrKeyNotFound)
 	if err != nil && !keyNotFound {
 		return nil, err
 	}
+	if keyNotFound {
+		prev, previous = nil, NilString()
+	}
 
 	if s.exists == NotExists && !keyNotFound {
 		return nil, ErrKeyExists
@@ -141,13 +153,13 @@ func (s *set) Execute(ctx context.Context, c Client) (*Result, error) {
 		newExpiry = prev.ExpiresAt()
 	}
 
-	_, err = c.Storage().Set(ctx, s.key, s.value, newExpiry)
+	_, err = storage.Set(ctx, s.key, s.value, newExpiry)
 	if err != nil {
 		return nil, err
 	}
 
 	if s.get {
-		return NewResult(prev), nil
+		return NewResult(previous), nil
 	}
 
 	return OkResult(), nil
@@ -0,0 +1,45 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet_getPrevious(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	storage := memory.New()
+	client := NewMockClient(ctl)
+	client.EXPECT().Storage().Return(storage).AnyTimes()
+	_, err := storage.Set(ctx, "hash", cmd.Hash{"field": []byte("value")}, nil)
+	require.NoError(t, err)
+
+	set := func(key, value string) (*cmd.Result, error) {
+		c, err := cmd.Set(key, []byte(value), cmd.SetGetPrevious())
+		require.NoError(t, err)
+		return c.Execute(ctx, client)
+	}
+
+	res, err := set("key", "first")
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(cmd.NilString()), res)
+	res, err = set("key", "second")
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]byte("first")), res)
+
+	// Values of other types aren't replaced.
+	_, err = set("hash", "value")
+	require.ErrorIs(t, err, cmd.ErrWrongType)
+	entry, err := storage.Get(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, cmd.ValueHash, entry.Type())
+}
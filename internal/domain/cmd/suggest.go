@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/burenotti/redis_impl/pkg/search"
+)
+
+const (
+	FTSUGADD = "FT.SUGADD"
+	FTSUGGET = "FT.SUGGET"
+	FTSUGDEL = "FT.SUGDEL"
+	FTSUGLEN = "FT.SUGLEN"
+)
+
+var ErrInvalidScore = errors.New("score must be a finite number")
+
+func getSuggestions(ctx context.Context, s Storage, key string) (*search.Suggestions, Entry, error) {
+	return getTyped[*search.Suggestions](ctx, s, key, ValueSuggest)
+}
+
+// FTSugAdd adds a suggestion to a dictionary and replies with the size of the dictionary.
+// With incr the score is added to the score of an existing suggestion.
+func FTSugAdd(key, str string, score float64, incr bool, payload []byte) (Command, error) {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, ErrInvalidScore)
+	}
+	return &ftSugAdd{key: key, str: str, score: score, incr: incr, payload: payload}, nil
+}
+
+type ftSugAdd struct {
+	modifyingCommand
+	key     string
+	str     string
+	score   float64
+	incr    bool
+	payload []byte
+}
+
+func (a *ftSugAdd) Name() string {
+	return FTSUGADD
+}
+
+func (a *ftSugAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	sug, entry, err := getSuggestions(ctx, storage, a.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		sug, err = search.NewSuggestions(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sug.Add(a.str, a.score, a.incr, a.payload)
+	if err := touch(ctx, storage, a.key, sug, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(int64(sug.Len())), nil
+}
+
+func (a *ftSugAdd) Args() []interface{} {
+	res := []interface{}{FTSUGADD, a.key, a.str, formatFloat(a.score)}
+	if a.incr {
+		res = append(res, "INCR")
+	}
+	if a.payload != nil {
+		res = append(res, "PAYLOAD", a.payload)
+	}
+	return res
+}
+
+type SugGetOptions struct {
+	// Fuzzy matches suggestions starting with a string one edit away from the prefix.
+	Fuzzy        bool
+	Max          int64
+	WithScores   bool
+	WithPayloads bool
+}
+
+// FTSugGet replies with suggestions starting with prefix ordered from the highest score.
+func FTSugGet(key, prefix string, opts SugGetOptions) (Command, error) {
+	if opts.Max < 0 {
+		return nil, fmt.Errorf("%w: MAX must not be negative", ErrInvalidOpt)
+	}
+	return &ftSugGet{key: key, prefix: prefix, opts: opts}, nil
+}
+
+type ftSugGet struct {
+	baseCommand
+	key    string
+	prefix string
+	opts   SugGetOptions
+}
+
+func (g *ftSugGet) Name() string {
+	return FTSUGGET
+}
+
+func (g *ftSugGet) Execute(ctx context.Context, c Client) (*Result, error) {
+	sug, _, err := getSuggestions(ctx, c.Storage(), g.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult([]interface{}{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, s := range sug.Get(g.prefix, g.opts.Fuzzy, int(g.opts.Max)) {
+		res = append(res, []byte(s.String))
+		if g.opts.WithScores {
+			res = append(res, formatFloat(s.Score))
+		}
+		if g.opts.WithPayloads {
+			res = append(res, s.Payload)
+		}
+	}
+	return NewResult(res), nil
+}
+
+func (g *ftSugGet) Args() []interface{} {
+	res := []interface{}{FTSUGGET, g.key, g.prefix}
+	if g.opts.Fuzzy {
+		res = append(res, "FUZZY")
+	}
+	if g.opts.WithScores {
+		res = append(res, "WITHSCORES")
+	}
+	if g.opts.WithPayloads {
+		res = append(res, "WITHPAYLOADS")
+	}
+	return append(res, "MAX", g.opts.Max)
+}
+
+// FTSugDel removes a suggestion. The key is removed with the last suggestion.
+func FTSugDel(key, str string) Command {
+	return &ftSugDel{key: key, str: str}
+}
+
+type ftSugDel struct {
+	modifyingCommand
+	key string
+	str string
+}
+
+func (d *ftSugDel) Name() string {
+	return FTSUGDEL
+}
+
+func (d *ftSugDel) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	sug, entry, err := getSuggestions(ctx, storage, d.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sug.Del(d.str) {
+		return NewResult(int64(0)), nil
+	}
+	if sug.Len() == 0 {
+		_, err = storage.Del(ctx, d.key)
+	} else {
+		err = touch(ctx, storage, d.key, sug, entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(int64(1)), nil
+}
+
+func (d *ftSugDel) Args() []interface{} {
+	return []interface{}{FTSUGDEL, d.key, d.str}
+}
+
+func FTSugLen(key string) Command {
+	return &ftSugLen{key: key}
+}
+
+type ftSugLen struct {
+	baseCommand
+	key string
+}
+
+func (l *ftSugLen) Name() string {
+	return FTSUGLEN
+}
+
+func (l *ftSugLen) Execute(ctx context.Context, c Client) (*Result, error) {
+	sug, _, err := getSuggestions(ctx, c.Storage(), l.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewResult(int64(0)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(int64(sug.Len())), nil
+}
+
+func (l *ftSugLen) Args() []interface{} {
+	return []interface{}{FTSUGLEN, l.key}
+}
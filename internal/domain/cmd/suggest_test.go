@@ -0,0 +1,70 @@
+package cmd_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFTSugAdd_createsDictionary(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "ac", cmd.ValueSuggest).Return(nil, cmd.ErrKeyNotFound)
+	var stored *search.Suggestions
+	storage.EXPECT().Set(ctx, "ac", gomock.Any(), nil).
+		DoAndReturn(func(_ context.Context, _ string, value interface{}, _ *time.Time) (cmd.Entry, error) {
+			stored = value.(*search.Suggestions) //nolint:forcetypeassert // a dictionary is stored
+			return &mockValue{value: value}, nil
+		})
+
+	add, err := cmd.FTSugAdd("ac", "hello", 2.5, true, []byte("p"))
+	require.NoError(t, err)
+	res, err := add.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(1)), res)
+	assert.Equal(t, []search.Suggestion{{String: "hello", Score: 2.5, Payload: []byte("p")}},
+		stored.Get("he", false, search.DefaultMaxSuggestions))
+	assert.Equal(t, []interface{}{cmd.FTSUGADD, "ac", "hello", []byte("2.5"), "INCR", "PAYLOAD", []byte("p")},
+		add.Args())
+
+	_, err = cmd.FTSugAdd("ac", "hello", math.Inf(1), false, nil)
+	assert.ErrorIs(t, err, cmd.ErrInvalidScore)
+}
+
+func TestFTSugGet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	sug := search.NewSuggestions()
+	sug.Add("hello", 1, false, nil)
+	sug.Add("yellow", 2, false, []byte("color"))
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "ac", cmd.ValueSuggest).Return(&mockValue{value: sug}, nil)
+
+	get, err := cmd.FTSugGet("ac", "hel", cmd.SugGetOptions{Fuzzy: true, Max: 5, WithScores: true, WithPayloads: true})
+	require.NoError(t, err)
+	res, err := get.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{
+		[]byte("yellow"), []byte("2"), []byte("color"),
+		[]byte("hello"), []byte("1"), []byte(nil),
+	}), res)
+}
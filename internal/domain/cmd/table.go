@@ -0,0 +1,597 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/pkg/module"
+)
+
+const COMMAND = "COMMAND"
+
+// Flags of commands as reported by COMMAND INFO.
+const (
+	FlagWrite    = "write"
+	FlagReadOnly = "readonly"
+	FlagDenyOOM  = "denyoom"
+	FlagAdmin    = "admin"
+	FlagPubSub   = "pubsub"
+	FlagNoScript = "noscript"
+	FlagLoading  = "loading"
+	FlagStale    = "stale"
+	FlagFast     = "fast"
+	// FlagMovableKeys is reported for commands whose keys can't be located by the legacy key range.
+	FlagMovableKeys = "movablekeys"
+)
+
+// ACL categories of commands. Categories of flags (read, write, fast, slow, admin, dangerous)
+// are derived, the rest are listed in specs.
+const (
+	CatKeyspace    = "keyspace"
+	CatRead        = "read"
+	CatWrite       = "write"
+	CatString      = "string"
+	CatHash        = "hash"
+	CatFast        = "fast"
+	CatSlow        = "slow"
+	CatAdmin       = "admin"
+	CatDangerous   = "dangerous"
+	CatConnection  = "connection"
+	CatTransaction = "transaction"
+	CatScripting   = "scripting"
+	CatJSON        = "json"
+	CatTimeSeries  = "timeseries"
+	CatBloom       = "bloom"
+	CatCuckoo      = "cuckoo"
+	CatCMS         = "cms"
+	CatTopK        = "topk"
+	CatTDigest     = "tdigest"
+	CatSearch      = "search"
+	CatGraph       = "graph"
+)
+
+// Flags of key specs.
+const (
+	KeyRW     = "RW"
+	KeyRO     = "RO"
+	KeyOW     = "OW"
+	KeyRM     = "RM"
+	KeyAccess = "access"
+	KeyUpdate = "update"
+	KeyInsert = "insert"
+	KeyDelete = "delete"
+)
+
+var (
+	ErrInvalidCommand = errors.New("Invalid command specified")
+	ErrRenameCommand  = errors.New("can't rename command")
+	ErrCommandArity   = errors.New("Invalid number of arguments specified for command")
+	ErrNoKeys         = errors.New("The command has no key arguments")
+)
+
+// KeySpec locates keys in arguments of a command. Search of keys begins at the argument Begin,
+// counting the name as 0. Keys either follow the argument holding their number (NumKeys),
+// or span to LastKey relative to Begin, where negative LastKey counts from the end.
+type KeySpec struct {
+	Flags   []string
+	Begin   int
+	LastKey int
+	Step    int
+	NumKeys bool
+	// FirstKey is the position of the first key relative to the number of keys.
+	FirstKey int
+}
+
+// keyRange creates a spec of keys from begin to last with step.
+func keyRange(begin, last, step int, flags ...string) KeySpec {
+	return KeySpec{Flags: flags, Begin: begin, LastKey: last, Step: step}
+}
+
+// keyNum creates a spec of keys following their number at begin.
+func keyNum(begin int, flags ...string) KeySpec {
+	return KeySpec{Flags: flags, Begin: begin, Step: 1, NumKeys: true, FirstKey: 1}
+}
+
+// keys appends keys located by the spec in args, which include the name.
+func (s KeySpec) keys(keys, args []string) ([]string, error) {
+	if s.Begin >= len(args) {
+		return keys, nil
+	}
+	if s.NumKeys {
+		n, err := strconv.Atoi(args[s.Begin])
+		first := s.Begin + s.FirstKey
+		if err != nil || n < 0 || first+(n-1)*s.Step >= len(args) {
+			return nil, ErrCommandArity
+		}
+		for i := range n {
+			keys = append(keys, args[first+i*s.Step])
+		}
+		return keys, nil
+	}
+	last := s.Begin + s.LastKey
+	if s.LastKey < 0 {
+		last = len(args) + s.LastKey
+	}
+	for i := s.Begin; i <= last && i < len(args); i += s.Step {
+		keys = append(keys, args[i])
+	}
+	return keys, nil
+}
+
+func (s KeySpec) info() []interface{} {
+	begin := []interface{}{
+		[]byte("type"), []byte("index"),
+		[]byte("spec"), []interface{}{[]byte("index"), int64(s.Begin)},
+	}
+	find := []interface{}{
+		[]byte("type"), []byte("range"),
+		[]byte("spec"), []interface{}{
+			[]byte("lastkey"), int64(s.LastKey), []byte("step"), int64(s.Step), []byte("limit"), int64(0),
+		},
+	}
+	if s.NumKeys {
+		find = []interface{}{
+			[]byte("type"), []byte("keynum"),
+			[]byte("spec"), []interface{}{
+				[]byte("keynumidx"), int64(0), []byte("firstkey"), int64(s.FirstKey), []byte("keystep"), int64(s.Step),
+			},
+		}
+	}
+	return []interface{}{
+		[]byte("flags"), simpleStrings(s.Flags),
+		[]byte("begin_search"), begin,
+		[]byte("find_keys"), find,
+	}
+}
+
+// CommandSpec describes a command.
+type CommandSpec struct {
+	// Name is the upper case name. Names of subcommands are prefixed with the name of the container and '|'.
+	Name string
+	// Arity is the number of arguments including the name. Negative arity -N means at least N arguments.
+	Arity      int
+	Flags      []string
+	Categories []string
+	Keys       []KeySpec
+	Group      string
+	Summary    string
+	// Subcommands are commands selected by the first argument.
+	Subcommands []*CommandSpec
+	// Module is the name of the module which registered the command.
+	Module string
+	// Exclusive commands access keys beyond their key specs, so they are executed alone.
+	Exclusive bool
+}
+
+// CheckArity reports whether the command accepts n arguments including the name.
+func (s *CommandSpec) CheckArity(n int) bool {
+	if s.Arity < 0 {
+		return n >= -s.Arity
+	}
+	return n == s.Arity
+}
+
+func (s *CommandSpec) HasFlag(flag string) bool {
+	return slices.Contains(s.AllFlags(), flag)
+}
+
+// AllFlags returns flags of the command including derived ones.
+func (s *CommandSpec) AllFlags() []string {
+	for _, k := range s.Keys {
+		if k.NumKeys {
+			return append(slices.Clip(s.Flags), FlagMovableKeys)
+		}
+	}
+	return s.Flags
+}
+
+// ACLCategories returns categories of the command including ones derived from flags.
+func (s *CommandSpec) ACLCategories() []string {
+	categories := slices.Clone(s.Categories)
+	switch {
+	case slices.Contains(s.Flags, FlagWrite):
+		categories = append(categories, CatWrite)
+	case slices.Contains(s.Flags, FlagReadOnly):
+		categories = append(categories, CatRead)
+	}
+	if slices.Contains(s.Flags, FlagAdmin) {
+		categories = append(categories, CatAdmin, CatDangerous)
+	}
+	if slices.Contains(s.Flags, FlagFast) {
+		categories = append(categories, CatFast)
+	} else {
+		categories = append(categories, CatSlow)
+	}
+	return categories
+}
+
+// Subcommand returns a subcommand by its upper case name without the container.
+func (s *CommandSpec) Subcommand(name string) (*CommandSpec, bool) {
+	for _, sub := range s.Subcommands {
+		if sub.Name == s.Name+"|"+name {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// GetKeys returns keys in args of the command, which include the name.
+func (s *CommandSpec) GetKeys(args []string) ([]string, error) {
+	if !s.CheckArity(len(args)) {
+		return nil, ErrCommandArity
+	}
+	if len(args) > 1 {
+		if sub, ok := s.Subcommand(strings.ToUpper(args[1])); ok {
+			return sub.GetKeys(args)
+		}
+	}
+	var keys []string
+	for _, spec := range s.Keys {
+		var err error
+		if keys, err = spec.keys(keys, args); err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+// legacyKeys returns the first key, the last key and the step for clients unaware of key specs.
+// Only a leading range spec can be described this way.
+func (s *CommandSpec) legacyKeys() (first, last, step int64) {
+	if len(s.Keys) == 0 || s.Keys[0].NumKeys {
+		return 0, 0, 0
+	}
+	k := s.Keys[0]
+	last = int64(k.Begin + k.LastKey)
+	if k.LastKey < 0 {
+		last = int64(k.LastKey)
+	}
+	return int64(k.Begin), last, int64(k.Step)
+}
+
+// info returns the reply of COMMAND INFO for the command called name.
+func (s *CommandSpec) info(name string) []interface{} {
+	first, last, step := s.legacyKeys()
+	categories := s.ACLCategories()
+	for i, c := range categories {
+		categories[i] = "@" + c
+	}
+	keys := make([]interface{}, len(s.Keys))
+	for i, k := range s.Keys {
+		keys[i] = k.info()
+	}
+	subcommands := make([]interface{}, len(s.Subcommands))
+	for i, sub := range s.Subcommands {
+		subcommands[i] = sub.info(name + sub.Name[len(s.Name):])
+	}
+	return []interface{}{
+		[]byte(strings.ToLower(name)),
+		int64(s.Arity),
+		simpleStrings(s.AllFlags()),
+		first, last, step,
+		simpleStrings(categories),
+		[]interface{}{},
+		keys,
+		subcommands,
+	}
+}
+
+// docs returns the reply of COMMAND DOCS for the command called name.
+func (s *CommandSpec) docs(name string) []interface{} {
+	docs := []interface{}{
+		[]byte("summary"), []byte(s.Summary),
+		[]byte("group"), []byte(s.Group),
+	}
+	if s.Module != "" {
+		docs = append(docs, []byte("module"), []byte(s.Module))
+	}
+	if len(s.Subcommands) > 0 {
+		subcommands := make([]interface{}, 0, 2*len(s.Subcommands)) //nolint:mnd // name and docs
+		for _, sub := range s.Subcommands {
+			subName := name + sub.Name[len(s.Name):]
+			subcommands = append(subcommands, []byte(strings.ToLower(subName)), sub.docs(subName))
+		}
+		docs = append(docs, []byte("subcommands"), subcommands)
+	}
+	return docs
+}
+
+func simpleStrings(values []string) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
+
+// CommandTable describes built-in commands and commands registered by modules.
+// Built-in commands can be renamed or disabled, but their specs keep canonical names,
+// so commands are logged under them.
+type CommandTable struct {
+	specs   map[string]*CommandSpec
+	modules *ModuleRegistry
+	// renames map canonical names to new ones, empty for disabled commands.
+	renames map[string]string
+	// aliases map new names to canonical ones.
+	aliases map[string]string
+}
+
+// NewCommandTable creates a table of built-in commands.
+func NewCommandTable() *CommandTable {
+	t := &CommandTable{
+		specs:   make(map[string]*CommandSpec, len(builtinSpecs)),
+		renames: make(map[string]string),
+		aliases: make(map[string]string),
+	}
+	for _, spec := range builtinSpecs {
+		t.specs[spec.Name] = spec
+	}
+	return t
+}
+
+// UseModules adds commands of loaded modules to the table.
+func (t *CommandTable) UseModules(modules *ModuleRegistry) {
+	t.modules = modules
+}
+
+// Rename makes a built-in command available under the new name only. Empty name disables it.
+// Must be called before commands are looked up concurrently.
+func (t *CommandTable) Rename(name, newName string) error {
+	name, newName = strings.ToUpper(name), strings.ToUpper(newName)
+	if _, ok := t.specs[name]; !ok {
+		return fmt.Errorf("%w: no such command %s", ErrRenameCommand, name)
+	}
+	if _, ok := t.renames[name]; ok {
+		return fmt.Errorf("%w: command %s is already renamed", ErrRenameCommand, name)
+	}
+	if newName != "" {
+		if _, ok := t.Lookup(newName); ok {
+			return fmt.Errorf("%w: command %s already exists", ErrRenameCommand, newName)
+		}
+		t.aliases[newName] = name
+	}
+	t.renames[name] = newName
+	return nil
+}
+
+// Name returns the name under which the command is available.
+func (t *CommandTable) Name(spec *CommandSpec) string {
+	if name, ok := t.renames[spec.Name]; ok {
+		return name
+	}
+	return spec.Name
+}
+
+// Aliases returns new names of renamed commands.
+func (t *CommandTable) Aliases() []string {
+	aliases := make([]string, 0, len(t.aliases))
+	for alias := range t.aliases {
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// Lookup returns a command by its upper case name. Renamed commands are found by new names only.
+func (t *CommandTable) Lookup(name string) (*CommandSpec, bool) {
+	if canonical, ok := t.aliases[name]; ok {
+		return t.specs[canonical], true
+	}
+	if _, ok := t.renames[name]; ok {
+		return nil, false
+	}
+	if spec, ok := t.specs[name]; ok {
+		return spec, true
+	}
+	if t.modules == nil {
+		return nil, false
+	}
+	for _, m := range t.modules.Modules() {
+		for _, c := range m.Commands() {
+			if c.Name == name {
+				return moduleSpec(m.Name, c), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Specs returns all available commands sorted by name.
+func (t *CommandTable) Specs() []*CommandSpec {
+	specs := make([]*CommandSpec, 0, len(t.specs))
+	for _, spec := range t.specs {
+		if t.Name(spec) != "" {
+			specs = append(specs, spec)
+		}
+	}
+	if t.modules != nil {
+		for _, m := range t.modules.Modules() {
+			for _, c := range m.Commands() {
+				specs = append(specs, moduleSpec(m.Name, c))
+			}
+		}
+	}
+	slices.SortFunc(specs, func(a, b *CommandSpec) int {
+		return strings.Compare(t.Name(a), t.Name(b))
+	})
+	return specs
+}
+
+// moduleSpec describes a command registered by a module.
+func moduleSpec(name string, c *module.Command) *CommandSpec {
+	flags := make([]string, 0, len(c.Flags))
+	for _, flag := range c.Flags {
+		switch flag {
+		case module.FlagDenyOOM:
+			flags = append(flags, FlagDenyOOM)
+		case module.FlagRandom:
+		default:
+			flags = append(flags, flag)
+		}
+	}
+	spec := &CommandSpec{Name: c.Name, Arity: c.Arity, Flags: flags, Group: "module", Module: name}
+	if c.FirstKey > 0 {
+		last := c.LastKey - c.FirstKey
+		if c.LastKey < 0 {
+			last = c.LastKey
+		}
+		spec.Keys = []KeySpec{keyRange(c.FirstKey, last, c.KeyStep)}
+	}
+	return spec
+}
+
+// CommandSubcommand is a subcommand of COMMAND.
+type CommandSubcommand string
+
+const (
+	CommandAll     CommandSubcommand = ""
+	CommandCount   CommandSubcommand = "COUNT"
+	CommandInfo    CommandSubcommand = "INFO"
+	CommandDocs    CommandSubcommand = "DOCS"
+	CommandList    CommandSubcommand = "LIST"
+	CommandGetKeys CommandSubcommand = "GETKEYS"
+)
+
+// CommandFilter is a filter of COMMAND LIST.
+type CommandFilter struct {
+	Module      string
+	ACLCategory string
+	Pattern     string
+}
+
+func (f *CommandFilter) match(name string, spec *CommandSpec) bool {
+	switch {
+	case f == nil:
+		return true
+	case f.Module != "":
+		return spec.Module == f.Module
+	case f.ACLCategory != "":
+		return slices.Contains(spec.ACLCategories(), strings.ToLower(f.ACLCategory))
+	default:
+		return matchPattern(strings.ToLower(f.Pattern), strings.ToLower(name))
+	}
+}
+
+// CommandIntrospection creates COMMAND, COMMAND COUNT, COMMAND INFO [name ...], COMMAND DOCS [name ...]
+// and COMMAND GETKEYS command [arg ...]. Args are names of commands or arguments of GETKEYS.
+func CommandIntrospection(table *CommandTable, sub CommandSubcommand, args ...string) Command {
+	return &command{table: table, sub: sub, args: args}
+}
+
+// CommandListing creates COMMAND LIST [FILTERBY MODULE name|ACLCAT category|PATTERN pattern].
+func CommandListing(table *CommandTable, filter *CommandFilter) Command {
+	return &command{table: table, sub: CommandList, filter: filter}
+}
+
+type command struct {
+	baseCommand
+	table  *CommandTable
+	sub    CommandSubcommand
+	args   []string
+	filter *CommandFilter
+}
+
+func (c *command) Name() string {
+	return COMMAND
+}
+
+func (c *command) Execute(_ context.Context, _ Client) (*Result, error) {
+	switch c.sub {
+	case CommandCount:
+		return NewResult(int64(len(c.table.Specs()))), nil
+	case CommandInfo, CommandAll:
+		return NewResult(c.infos()), nil
+	case CommandDocs:
+		return NewResult(c.docs()), nil
+	case CommandList:
+		names := []interface{}{}
+		for _, spec := range c.table.Specs() {
+			if name := c.table.Name(spec); c.filter.match(name, spec) {
+				names = append(names, []byte(strings.ToLower(name)))
+			}
+		}
+		return NewResult(names), nil
+	case CommandGetKeys:
+		return c.getKeys()
+	}
+	return nil, fmt.Errorf("%w: unknown subcommand %s", ErrInvalidOpt, c.sub)
+}
+
+// lookup returns specs of named commands, or all commands if there are no names.
+// Unknown commands are nil.
+func (c *command) lookup() []*CommandSpec {
+	if len(c.args) == 0 {
+		return c.table.Specs()
+	}
+	specs := make([]*CommandSpec, len(c.args))
+	for i, name := range c.args {
+		specs[i], _ = c.table.Lookup(strings.ToUpper(name))
+	}
+	return specs
+}
+
+func (c *command) infos() []interface{} {
+	specs := c.lookup()
+	res := make([]interface{}, len(specs))
+	for i, spec := range specs {
+		if spec == nil {
+			res[i] = NilArray()
+			continue
+		}
+		res[i] = spec.info(c.table.Name(spec))
+	}
+	return res
+}
+
+func (c *command) docs() []interface{} {
+	res := []interface{}{}
+	for _, spec := range c.lookup() {
+		if spec != nil {
+			name := c.table.Name(spec)
+			res = append(res, []byte(strings.ToLower(name)), spec.docs(name))
+		}
+	}
+	return res
+}
+
+func (c *command) getKeys() (*Result, error) {
+	spec, ok := c.table.Lookup(strings.ToUpper(c.args[0]))
+	if !ok {
+		return nil, ErrInvalidCommand
+	}
+	keys, err := spec.GetKeys(c.args)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(keys))
+	for i, key := range keys {
+		res[i] = []byte(key)
+	}
+	return NewResult(res), nil
+}
+
+func (c *command) Args() []interface{} {
+	args := []interface{}{COMMAND}
+	if c.sub != CommandAll {
+		args = append(args, string(c.sub))
+	}
+	switch {
+	case c.filter == nil:
+	case c.filter.Module != "":
+		args = append(args, "FILTERBY", "MODULE", c.filter.Module)
+	case c.filter.ACLCategory != "":
+		args = append(args, "FILTERBY", "ACLCAT", c.filter.ACLCategory)
+	default:
+		args = append(args, "FILTERBY", "PATTERN", c.filter.Pattern)
+	}
+	for _, arg := range c.args {
+		args = append(args, arg)
+	}
+	return args
+}
@@ -0,0 +1,179 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandSpec_GetKeys(t *testing.T) {
+	t.Parallel()
+	table := cmd.NewCommandTable()
+	tests := []struct {
+		name string
+		args []string
+		keys []string
+		err  error
+	}{
+		{name: "range", args: []string{"DEL", "a", "b"}, keys: []string{"a", "b"}},
+		{name: "single key", args: []string{"HSET", "h", "f", "v"}, keys: []string{"h"}},
+		{name: "last key from end", args: []string{"JSON.MGET", "a", "b", "$"}, keys: []string{"a", "b"}},
+		{name: "step", args: []string{"TS.MADD", "a", "1", "1", "b", "1", "2"}, keys: []string{"a", "b"}},
+		{name: "keynum", args: []string{"EVAL", "return 1", "2", "a", "b", "c"}, keys: []string{"a", "b"}},
+		{name: "range and keynum", args: []string{"CMS.MERGE", "d", "2", "a", "b"}, keys: []string{"d", "a", "b"}},
+		{name: "subcommand", args: []string{"OBJECT", "encoding", "k"}, keys: []string{"k"}},
+		{name: "no keys", args: []string{"PING"}, err: cmd.ErrNoKeys},
+		{name: "arity", args: []string{"GET"}, err: cmd.ErrCommandArity},
+		{name: "too many keys", args: []string{"EVAL", "return 1", "3", "a"}, err: cmd.ErrCommandArity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			spec, ok := table.Lookup(tt.args[0])
+			require.True(t, ok)
+			keys, err := spec.GetKeys(tt.args)
+			require.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.keys, keys)
+		})
+	}
+}
+
+func TestCommandSpec_flags(t *testing.T) {
+	t.Parallel()
+	table := cmd.NewCommandTable()
+
+	get, _ := table.Lookup(cmd.GET)
+	assert.True(t, get.CheckArity(3))
+	assert.False(t, get.CheckArity(1))
+	assert.Equal(t, []string{cmd.CatString, cmd.CatRead, cmd.CatFast}, get.ACLCategories())
+
+	eval, _ := table.Lookup(cmd.EVAL)
+	assert.True(t, eval.HasFlag(cmd.FlagMovableKeys))
+	shutdown, _ := table.Lookup(cmd.SHUTDOWN)
+	assert.Equal(t, []string{cmd.CatAdmin, cmd.CatDangerous, cmd.CatSlow}, shutdown.ACLCategories())
+
+	script, _ := table.Lookup(cmd.SCRIPT)
+	load, ok := script.Subcommand("LOAD")
+	require.True(t, ok)
+	assert.Equal(t, "SCRIPT|LOAD", load.Name)
+}
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	table := cmd.NewCommandTable()
+	registry := cmd.NewModuleRegistry()
+	require.NoError(t, registry.Add(newCounterModule(t, "counter", new([]module.Event))))
+	table.UseModules(registry)
+
+	res, err := cmd.CommandIntrospection(table, cmd.CommandCount).Execute(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(int64(len(table.Specs()))), res)
+
+	res, err = cmd.CommandIntrospection(table, cmd.CommandInfo, "type", "nosuch").Execute(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{
+		[]interface{}{
+			[]byte("type"), int64(2), []interface{}{cmd.FlagReadOnly, cmd.FlagFast},
+			int64(1), int64(1), int64(1),
+			[]interface{}{"@keyspace", "@read", "@fast"},
+			[]interface{}{},
+			[]interface{}{[]interface{}{
+				[]byte("flags"), []interface{}{cmd.KeyRO, cmd.KeyAccess},
+				[]byte("begin_search"), []interface{}{
+					[]byte("type"), []byte("index"), []byte("spec"), []interface{}{[]byte("index"), int64(1)},
+				},
+				[]byte("find_keys"), []interface{}{
+					[]byte("type"), []byte("range"),
+					[]byte("spec"), []interface{}{[]byte("lastkey"), int64(0), []byte("step"), int64(1), []byte("limit"), int64(0)},
+				},
+			}},
+			[]interface{}{},
+		},
+		cmd.NilArray(),
+	}), res)
+
+	res, err = cmd.CommandIntrospection(table, cmd.CommandDocs, "counter.incr").Execute(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{
+		[]byte("counter.incr"),
+		[]interface{}{[]byte("summary"), []byte(""), []byte("group"), []byte("module"), []byte("module"), []byte("counter")},
+	}), res)
+
+	res, err = cmd.CommandIntrospection(table, cmd.CommandGetKeys, "counter.incr", "c").Execute(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{[]byte("c")}), res)
+	_, err = cmd.CommandIntrospection(table, cmd.CommandGetKeys, "nosuch").Execute(ctx, nil)
+	require.ErrorIs(t, err, cmd.ErrInvalidCommand)
+}
+
+func TestCommandListing(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	table := cmd.NewCommandTable()
+	registry := cmd.NewModuleRegistry()
+	require.NoError(t, registry.Add(newCounterModule(t, "counter", new([]module.Event))))
+	table.UseModules(registry)
+
+	tests := []struct {
+		name   string
+		filter *cmd.CommandFilter
+		names  []interface{}
+	}{
+		{name: "module", filter: &cmd.CommandFilter{Module: "counter"}, names: []interface{}{[]byte("counter.incr")}},
+		{
+			name:   "category",
+			filter: &cmd.CommandFilter{ACLCategory: "TRANSACTION"},
+			names: []interface{}{
+				[]byte("discard"), []byte("exec"), []byte("multi"), []byte("unwatch"), []byte("watch"),
+			},
+		},
+		{name: "pattern", filter: &cmd.CommandFilter{Pattern: "H*ET"}, names: []interface{}{[]byte("hget"), []byte("hmget"), []byte("hset")}},
+		{name: "nothing", filter: &cmd.CommandFilter{Pattern: "nosuch"}, names: []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			res, err := cmd.CommandListing(table, tt.filter).Execute(ctx, nil)
+			require.NoError(t, err)
+			assert.Equal(t, cmd.NewResult(tt.names), res)
+		})
+	}
+}
+
+func TestCommandTable_Rename(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	table := cmd.NewCommandTable()
+	count := len(table.Specs())
+	require.NoError(t, table.Rename("flushall", ""))
+	require.NoError(t, table.Rename("script", "admin-script"))
+	require.ErrorIs(t, table.Rename("nosuch", "other"), cmd.ErrRenameCommand)
+	require.ErrorIs(t, table.Rename("script", "other"), cmd.ErrRenameCommand)
+	require.ErrorIs(t, table.Rename("get", "SET"), cmd.ErrRenameCommand)
+	require.ErrorIs(t, table.Rename("get", "ADMIN-SCRIPT"), cmd.ErrRenameCommand)
+
+	_, ok := table.Lookup(cmd.FLUSHALL)
+	assert.False(t, ok)
+	_, ok = table.Lookup(cmd.SCRIPT)
+	assert.False(t, ok)
+	spec, ok := table.Lookup("ADMIN-SCRIPT")
+	require.True(t, ok)
+	assert.Equal(t, cmd.SCRIPT, spec.Name)
+	assert.Len(t, table.Specs(), count-1)
+
+	res, err := cmd.CommandListing(table, &cmd.CommandFilter{Pattern: "*script*"}).Execute(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{[]byte("admin-script")}), res)
+
+	res, err = cmd.CommandIntrospection(table, cmd.CommandDocs, "admin-script").Execute(ctx, nil)
+	require.NoError(t, err)
+	docs := res.Values[0].([]interface{}) //nolint:forcetypeassert // docs are arrays
+	assert.Equal(t, []byte("admin-script"), docs[0])
+	fields := docs[1].([]interface{}) //nolint:forcetypeassert // docs are arrays
+	assert.Contains(t, fields[len(fields)-1], []byte("admin-script|kill"))
+}
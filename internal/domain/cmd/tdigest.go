@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/burenotti/redis_impl/pkg/algo/tdigest"
+)
+
+const (
+	TDIGESTCREATE      = "TDIGEST.CREATE"
+	TDIGESTADD         = "TDIGEST.ADD"
+	TDIGESTRESET       = "TDIGEST.RESET"
+	TDIGESTMERGE       = "TDIGEST.MERGE"
+	TDIGESTQUANTILE    = "TDIGEST.QUANTILE"
+	TDIGESTCDF         = "TDIGEST.CDF"
+	TDIGESTRANK        = "TDIGEST.RANK"
+	TDIGESTREVRANK     = "TDIGEST.REVRANK"
+	TDIGESTBYRANK      = "TDIGEST.BYRANK"
+	TDIGESTBYREVRANK   = "TDIGEST.BYREVRANK"
+	TDIGESTMIN         = "TDIGEST.MIN"
+	TDIGESTMAX         = "TDIGEST.MAX"
+	TDIGESTTRIMMEDMEAN = "TDIGEST.TRIMMED_MEAN"
+)
+
+func getTDigest(ctx context.Context, s Storage, key string) (*tdigest.TDigest, Entry, error) {
+	return getTyped[*tdigest.TDigest](ctx, s, key, ValueTDigest)
+}
+
+func TDigestCreate(key string, compression uint64) (Command, error) {
+	if err := tdigest.ValidateCompression(float64(compression)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &tdigestCreate{key: key, compression: compression}, nil
+}
+
+type tdigestCreate struct {
+	modifyingCommand
+	key         string
+	compression uint64
+}
+
+func (r *tdigestCreate) Name() string {
+	return TDIGESTCREATE
+}
+
+func (r *tdigestCreate) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, r.key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	t, err := tdigest.New(float64(r.compression))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, r.key, t, nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (r *tdigestCreate) Args() []interface{} {
+	return []interface{}{TDIGESTCREATE, r.key, "COMPRESSION", int64(r.compression)}
+}
+
+func TDigestAdd(key string, values ...float64) (Command, error) {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, tdigest.ErrInvalidValue)
+		}
+	}
+	return &tdigestAdd{key: key, values: values}, nil
+}
+
+type tdigestAdd struct {
+	modifyingCommand
+	key    string
+	values []float64
+}
+
+func (a *tdigestAdd) Name() string {
+	return TDIGESTADD
+}
+
+func (a *tdigestAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	t, entry, err := getTDigest(ctx, storage, a.key)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Add(a.values...); err != nil {
+		return nil, err
+	}
+	if err := touch(ctx, storage, a.key, t, entry); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (a *tdigestAdd) Args() []interface{} {
+	res := []interface{}{TDIGESTADD, a.key}
+	for _, v := range a.values {
+		res = append(res, formatFloat(v))
+	}
+	return res
+}
+
+func TDigestReset(key string) Command {
+	return &tdigestReset{key: key}
+}
+
+type tdigestReset struct {
+	modifyingCommand
+	key string
+}
+
+func (r *tdigestReset) Name() string {
+	return TDIGESTRESET
+}
+
+func (r *tdigestReset) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	t, entry, err := getTDigest(ctx, storage, r.key)
+	if err != nil {
+		return nil, err
+	}
+	t.Reset()
+	if err := touch(ctx, storage, r.key, t, entry); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (r *tdigestReset) Args() []interface{} {
+	return []interface{}{TDIGESTRESET, r.key}
+}
+
+// TDigestMerge merges sources into the destination sketch. If the destination exists, its
+// observations are merged too, unless override is set. Zero compression means the maximal
+// compression of merged sketches.
+func TDigestMerge(dest string, sources []string, compression uint64, override bool) (Command, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: at least one source is required", ErrInvalidOpt)
+	}
+	if compression != 0 {
+		if err := tdigest.ValidateCompression(float64(compression)); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+		}
+	}
+	return &tdigestMerge{dest: dest, sources: sources, compression: compression, override: override}, nil
+}
+
+type tdigestMerge struct {
+	modifyingCommand
+	dest        string
+	sources     []string
+	compression uint64
+	override    bool
+}
+
+func (m *tdigestMerge) Name() string {
+	return TDIGESTMERGE
+}
+
+func (m *tdigestMerge) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	dest, entry, err := getTDigest(ctx, storage, m.dest)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	var merged []*tdigest.TDigest
+	if dest != nil && !m.override {
+		merged = append(merged, dest)
+	}
+	for _, key := range m.sources {
+		src, _, err := getTDigest(ctx, storage, key)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, src)
+	}
+
+	compression := float64(m.compression)
+	if compression == 0 {
+		for _, t := range merged {
+			compression = math.Max(compression, t.Compression())
+		}
+	}
+	res, err := tdigest.New(compression)
+	if err != nil {
+		return nil, err
+	}
+	res.Merge(merged...)
+	if err := touch(ctx, storage, m.dest, res, entry); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (m *tdigestMerge) Args() []interface{} {
+	res := []interface{}{TDIGESTMERGE, m.dest, int64(len(m.sources))}
+	for _, src := range m.sources {
+		res = append(res, src)
+	}
+	if m.compression != 0 {
+		res = append(res, "COMPRESSION", int64(m.compression))
+	}
+	if m.override {
+		res = append(res, "OVERRIDE")
+	}
+	return res
+}
+
+// TDigestQuantile returns estimated values at the given quantiles.
+func TDigestQuantile(key string, quantiles ...float64) (Command, error) {
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("%w: quantile must be in range [0, 1]", ErrInvalidOpt)
+		}
+	}
+	return &tdigestQuery{name: TDIGESTQUANTILE, key: key, args: quantiles}, nil
+}
+
+// TDigestCDF returns estimated fractions of observations less than or equal to the given values.
+func TDigestCDF(key string, values ...float64) Command {
+	return &tdigestQuery{name: TDIGESTCDF, key: key, args: values}
+}
+
+// TDigestRank returns estimated ranks of the given values, in descending order if reverse is set.
+func TDigestRank(key string, reverse bool, values ...float64) Command {
+	if reverse {
+		return &tdigestQuery{name: TDIGESTREVRANK, key: key, args: values}
+	}
+	return &tdigestQuery{name: TDIGESTRANK, key: key, args: values}
+}
+
+// TDigestByRank returns estimated values with the given ranks, in descending order if reverse is set.
+func TDigestByRank(key string, reverse bool, ranks ...int64) (Command, error) {
+	args := make([]float64, len(ranks))
+	for i, rank := range ranks {
+		if rank < 0 {
+			return nil, fmt.Errorf("%w: rank must be non-negative", ErrInvalidOpt)
+		}
+		args[i] = float64(rank)
+	}
+	if reverse {
+		return &tdigestQuery{name: TDIGESTBYREVRANK, key: key, args: args}, nil
+	}
+	return &tdigestQuery{name: TDIGESTBYRANK, key: key, args: args}, nil
+}
+
+// tdigestQuery is a read-only command, which replies with an estimation for every argument.
+type tdigestQuery struct {
+	baseCommand
+	name string
+	key  string
+	args []float64
+}
+
+func (q *tdigestQuery) Name() string {
+	return q.name
+}
+
+func (q *tdigestQuery) Execute(ctx context.Context, c Client) (*Result, error) {
+	t, _, err := getTDigest(ctx, c.Storage(), q.key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(q.args))
+	for i, arg := range q.args {
+		switch q.name {
+		case TDIGESTQUANTILE:
+			res[i] = formatFloat(t.Quantile(arg))
+		case TDIGESTCDF:
+			res[i] = formatFloat(t.CDF(arg))
+		case TDIGESTRANK:
+			res[i] = t.Rank(arg)
+		case TDIGESTREVRANK:
+			res[i] = t.RevRank(arg)
+		case TDIGESTBYRANK:
+			res[i] = formatFloat(t.ByRank(int64(arg)))
+		case TDIGESTBYREVRANK:
+			res[i] = formatFloat(t.ByRevRank(int64(arg)))
+		}
+	}
+	return NewResult(res), nil
+}
+
+func (q *tdigestQuery) Args() []interface{} {
+	res := []interface{}{q.name, q.key}
+	for _, arg := range q.args {
+		res = append(res, formatFloat(arg))
+	}
+	return res
+}
+
+func TDigestMin(key string) Command {
+	return &tdigestMinMax{key: key}
+}
+
+func TDigestMax(key string) Command {
+	return &tdigestMinMax{key: key, max: true}
+}
+
+type tdigestMinMax struct {
+	baseCommand
+	key string
+	max bool
+}
+
+func (m *tdigestMinMax) Name() string {
+	if m.max {
+		return TDIGESTMAX
+	}
+	return TDIGESTMIN
+}
+
+func (m *tdigestMinMax) Execute(ctx context.Context, c Client) (*Result, error) {
+	t, _, err := getTDigest(ctx, c.Storage(), m.key)
+	if err != nil {
+		return nil, err
+	}
+	if m.max {
+		return NewResult(formatFloat(t.Max())), nil
+	}
+	return NewResult(formatFloat(t.Min())), nil
+}
+
+func (m *tdigestMinMax) Args() []interface{} {
+	return []interface{}{m.Name(), m.key}
+}
+
+// TDigestTrimmedMean returns mean of observations between the low and high quantiles.
+func TDigestTrimmedMean(key string, low, high float64) (Command, error) {
+	if !(low >= 0 && low < high && high <= 1) {
+		return nil, fmt.Errorf("%w: low and high cut must satisfy 0 <= low < high <= 1", ErrInvalidOpt)
+	}
+	return &tdigestTrimmedMean{key: key, low: low, high: high}, nil
+}
+
+type tdigestTrimmedMean struct {
+	baseCommand
+	key  string
+	low  float64
+	high float64
+}
+
+func (m *tdigestTrimmedMean) Name() string {
+	return TDIGESTTRIMMEDMEAN
+}
+
+func (m *tdigestTrimmedMean) Execute(ctx context.Context, c Client) (*Result, error) {
+	t, _, err := getTDigest(ctx, c.Storage(), m.key)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(formatFloat(t.TrimmedMean(m.low, m.high))), nil
+}
+
+func (m *tdigestTrimmedMean) Args() []interface{} {
+	return []interface{}{TDIGESTTRIMMEDMEAN, m.key, formatFloat(m.low), formatFloat(m.high)}
+}
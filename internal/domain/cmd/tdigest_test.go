@@ -0,0 +1,87 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/tdigest"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTDigestMerge_override(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	dest, err := tdigest.New(50)
+	require.NoError(t, err)
+	require.NoError(t, dest.Add(1, 2, 3))
+	src, err := tdigest.New(200)
+	require.NoError(t, err)
+	require.NoError(t, src.Add(10, 20))
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	storage.EXPECT().GetTyped(ctx, "dest", cmd.ValueTDigest).Return(&mockValue{value: dest}, nil).Times(2)
+	storage.EXPECT().GetTyped(ctx, "src", cmd.ValueTDigest).Return(&mockValue{value: src}, nil).Times(2)
+
+	var merged []*tdigest.TDigest
+	storage.EXPECT().Set(ctx, "dest", gomock.Any(), nil).
+		DoAndReturn(func(_ context.Context, _ string, value interface{}, _ *time.Time) (cmd.Entry, error) {
+			merged = append(merged, value.(*tdigest.TDigest)) //nolint:forcetypeassert // merge stores a sketch
+			return &mockValue{value: value}, nil
+		}).Times(2)
+
+	merge, err := cmd.TDigestMerge("dest", []string{"src"}, 0, false)
+	require.NoError(t, err)
+	res, err := merge.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.OkResult(), res)
+
+	override, err := cmd.TDigestMerge("dest", []string{"src"}, 0, true)
+	require.NoError(t, err)
+	_, err = override.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{cmd.TDIGESTMERGE, "dest", int64(1), "src", "OVERRIDE"}, override.Args())
+
+	require.Len(t, merged, 2)
+	assert.Equal(t, 5.0, merged[0].Count())
+	assert.Equal(t, 200.0, merged[0].Compression())
+	assert.Equal(t, 1.0, merged[0].Min())
+	assert.Equal(t, 2.0, merged[1].Count())
+	assert.Equal(t, 10.0, merged[1].Min())
+}
+
+func TestTDigestQuantile_emptySketch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	td, err := tdigest.New(tdigest.DefaultCompression)
+	require.NoError(t, err)
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	storage.EXPECT().GetTyped(ctx, "td", cmd.ValueTDigest).Return(&mockValue{value: td}, nil).Times(2)
+
+	quantile, err := cmd.TDigestQuantile("td", 0.5, 1)
+	require.NoError(t, err)
+	res, err := quantile.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{[]byte("nan"), []byte("nan")}), res)
+
+	res, err = cmd.TDigestRank("td", true, 1).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{int64(-2)}), res)
+
+	_, err = cmd.TDigestQuantile("td", 1.5)
+	assert.ErrorIs(t, err, cmd.ErrInvalidOpt)
+}
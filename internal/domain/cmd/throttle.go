@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const CLTHROTTLE = "CL.THROTTLE"
+
+var (
+	ErrThrottleState    = errors.New("rate limiter state is not an integer")
+	ErrThrottleOverflow = errors.New("rate limit parameters overflow")
+)
+
+// ThrottleOptions configure a GCRA rate limiter allowing Count actions per Period
+// with bursts of MaxBurst actions above the rate.
+type ThrottleOptions struct {
+	MaxBurst int64
+	Count    int64
+	Period   time.Duration
+	// Quantity is an amount of actions to perform. Zero only reports the state.
+	Quantity int64
+}
+
+func (o ThrottleOptions) validate() error {
+	switch {
+	case o.MaxBurst < 0:
+		return errors.New("max burst must not be negative")
+	case o.Count <= 0:
+		return errors.New("count per period must be positive")
+	case o.Period <= 0:
+		return errors.New("period must be positive")
+	case o.Quantity < 0:
+		return errors.New("quantity must not be negative")
+	}
+	return nil
+}
+
+// CLThrottle applies the generic cell rate algorithm. The key holds the theoretical arrival
+// time of the next action in unix nanoseconds and expires when the limiter is fully reset.
+// Nil now means current time, which is resolved on execution, so the logged command is
+// deterministic.
+//
+// The reply is whether the action is limited, the limit, the remaining amount of actions,
+// seconds to wait before retrying (-1 when allowed) and seconds until the limiter resets.
+func CLThrottle(key string, opts ThrottleOptions, now *int64) (Command, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	emission := int64(opts.Period) / opts.Count
+	if emission == 0 || opts.MaxBurst >= math.MaxInt64/emission || opts.Quantity > math.MaxInt64/emission {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, ErrThrottleOverflow)
+	}
+	return &clThrottle{key: key, opts: opts, now: now}, nil
+}
+
+type clThrottle struct {
+	modifyingCommand
+	key  string
+	opts ThrottleOptions
+	now  *int64
+}
+
+func (t *clThrottle) Name() string {
+	return CLTHROTTLE
+}
+
+func (t *clThrottle) Execute(ctx context.Context, c Client) (*Result, error) {
+	if t.now == nil {
+		now := time.Now().UnixNano()
+		t.now = &now
+	}
+	now := *t.now
+
+	storage := c.Storage()
+	tat := now
+	state, _, err := storage.GetString(ctx, t.key)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		if tat, err = strconv.ParseInt(string(state), 10, 64); err != nil {
+			return nil, ErrThrottleState
+		}
+	}
+
+	emission := int64(t.opts.Period) / t.opts.Count
+	tolerance := emission * (t.opts.MaxBurst + 1)
+	increment := emission * t.opts.Quantity
+	if max(tat, now) > math.MaxInt64-increment {
+		return nil, ErrThrottleOverflow
+	}
+	newTAT := max(tat, now) + increment
+	allowAt := newTAT - tolerance
+
+	limited := now < allowAt
+	retryAfter := int64(-1)
+	var ttl int64
+	if limited {
+		if increment <= tolerance {
+			retryAfter = ceilSeconds(allowAt - now)
+		}
+		ttl = tat - now
+	} else {
+		ttl = newTAT - now
+		if ttl > 0 {
+			state := []byte(strconv.FormatInt(newTAT, 10))
+			if _, err := storage.Set(ctx, t.key, state, expiresAt(time.Unix(0, newTAT))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ttl = max(ttl, 0)
+
+	remaining := int64(0)
+	if next := tolerance - ttl; next > -emission {
+		remaining = max(next/emission, 0)
+	}
+	return NewResult([]interface{}{
+		boolReply(limited), t.opts.MaxBurst + 1, remaining, retryAfter, ceilSeconds(ttl),
+	}), nil
+}
+
+func (t *clThrottle) Args() []interface{} {
+	res := []interface{}{
+		CLTHROTTLE, t.key, t.opts.MaxBurst, t.opts.Count, int64(t.opts.Period / time.Second), t.opts.Quantity,
+	}
+	if t.now != nil {
+		res = append(res, "AT", *t.now)
+	}
+	return res
+}
+
+func expiresAt(t time.Time) *time.Time {
+	return &t
+}
+
+// ceilSeconds converts nanoseconds to seconds rounding up, so waiting for the result is enough.
+func ceilSeconds(ns int64) int64 {
+	return (ns + int64(time.Second) - 1) / int64(time.Second)
+}
@@ -0,0 +1,165 @@
+package cmd_test
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLThrottle_burst(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	now := time.Now().UnixNano()
+	opts := cmd.ThrottleOptions{MaxBurst: 2, Count: 1, Period: 10 * time.Second, Quantity: 1}
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).AnyTimes()
+
+	var state *mockValue
+	storage.EXPECT().GetString(ctx, "limiter").DoAndReturn(func(context.Context, string) ([]byte, cmd.Entry, error) {
+		if state == nil {
+			return nil, nil, cmd.ErrKeyNotFound
+		}
+		return state.value.([]byte), state, nil //nolint:forcetypeassert // state is a string
+	}).AnyTimes()
+	storage.EXPECT().Set(ctx, "limiter", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, value interface{}, expiresAt *time.Time) (cmd.Entry, error) {
+			state = &mockValue{value: value}
+			tat, err := strconv.ParseInt(string(value.([]byte)), 10, 64) //nolint:forcetypeassert // state is a string
+			require.NoError(t, err)
+			assert.Equal(t, time.Unix(0, tat), *expiresAt)
+			return state, nil
+		}).Times(4)
+
+	expected := [][]interface{}{
+		{int64(0), int64(3), int64(2), int64(-1), int64(10)},
+		{int64(0), int64(3), int64(1), int64(-1), int64(20)},
+		{int64(0), int64(3), int64(0), int64(-1), int64(30)},
+		{int64(1), int64(3), int64(0), int64(10), int64(30)},
+	}
+	for _, reply := range expected {
+		c, err := cmd.CLThrottle("limiter", opts, &now)
+		require.NoError(t, err)
+		res, err := c.Execute(ctx, client)
+		require.NoError(t, err)
+		assert.Equal(t, reply, res.Values[0])
+	}
+
+	// The limiter lets one action in after the emission interval.
+	now += int64(10 * time.Second)
+	c, err := cmd.CLThrottle("limiter", opts, &now)
+	require.NoError(t, err)
+	res, err := c.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(3), int64(0), int64(-1), int64(30)}, res.Values[0])
+}
+
+// TestCLThrottle_expiration checks the key expires when the limiter resets, at a time derived
+// from the logged time, so replaying the log gives the same keyspace.
+func TestCLThrottle_expiration(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	start := time.Now().UnixNano()
+	opts := cmd.ThrottleOptions{MaxBurst: 1, Count: 1, Period: time.Minute, Quantity: 1}
+	expected := [][]interface{}{
+		{int64(0), int64(2), int64(1), int64(-1), int64(60)},
+		{int64(0), int64(2), int64(0), int64(-1), int64(120)},
+		{int64(1), int64(2), int64(0), int64(60), int64(120)},
+	}
+	var expirations []time.Time
+	for range 2 {
+		storage := memory.New()
+		client := NewMockClient(ctl)
+		client.EXPECT().Storage().Return(storage).AnyTimes()
+		for i, reply := range expected {
+			now := start + int64(i)
+			c, err := cmd.CLThrottle("limiter", opts, &now)
+			require.NoError(t, err)
+			res, err := c.Execute(ctx, client)
+			require.NoError(t, err)
+			assert.Equal(t, reply, res.Values[0])
+
+			_, entry, err := storage.GetString(ctx, "limiter")
+			require.NoError(t, err)
+			require.NotNil(t, entry.ExpiresAt())
+			ttl := entry.ExpiresAt().Sub(time.Unix(0, now))
+			assert.Equal(t, reply[4], int64(math.Ceil(ttl.Seconds())))
+		}
+		_, entry, err := storage.GetString(ctx, "limiter")
+		require.NoError(t, err)
+		expirations = append(expirations, *entry.ExpiresAt())
+	}
+	assert.Equal(t, expirations[0], expirations[1])
+}
+
+func TestCLThrottle_args(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetString(ctx, "limiter").Return(nil, nil, cmd.ErrKeyNotFound)
+	storage.EXPECT().Set(ctx, "limiter", gomock.Any(), gomock.Any()).Return(&mockValue{}, nil)
+
+	opts := cmd.ThrottleOptions{MaxBurst: 15, Count: 30, Period: time.Minute, Quantity: 2}
+	c, err := cmd.CLThrottle("limiter", opts, nil)
+	require.NoError(t, err)
+	assert.True(t, c.IsModifying())
+	_, err = c.Execute(ctx, client)
+	require.NoError(t, err)
+
+	// The time is resolved on execution, so replaying the command gives the same result.
+	args := c.Args()
+	require.Len(t, args, 8)
+	assert.Equal(t, []interface{}{cmd.CLTHROTTLE, "limiter", int64(15), int64(30), int64(60), int64(2), "AT"}, args[:7])
+	assert.IsType(t, int64(0), args[7])
+}
+
+func TestCLThrottle_errors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	_, err := cmd.CLThrottle("limiter", cmd.ThrottleOptions{MaxBurst: 1, Count: 0, Period: time.Second}, nil)
+	require.ErrorIs(t, err, cmd.ErrInvalidOpt)
+	_, err = cmd.CLThrottle("limiter", cmd.ThrottleOptions{MaxBurst: 1 << 62, Count: 1, Period: time.Hour}, nil)
+	require.ErrorIs(t, err, cmd.ErrThrottleOverflow)
+	_, err = cmd.CLThrottle("limiter", cmd.ThrottleOptions{MaxBurst: math.MaxInt64, Count: 1, Period: 1}, nil)
+	require.ErrorIs(t, err, cmd.ErrThrottleOverflow)
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	storage.EXPECT().GetString(ctx, "hash").Return(nil, nil, cmd.ErrWrongType)
+	text := []byte("text")
+	storage.EXPECT().GetString(ctx, "text").Return(text, &mockValue{value: text}, nil)
+
+	opts := cmd.ThrottleOptions{MaxBurst: 1, Count: 1, Period: time.Second, Quantity: 1}
+	c, err := cmd.CLThrottle("hash", opts, nil)
+	require.NoError(t, err)
+	_, err = c.Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrWrongType)
+
+	c, err = cmd.CLThrottle("text", opts, nil)
+	require.NoError(t, err)
+	_, err = c.Execute(ctx, client)
+	require.ErrorIs(t, err, cmd.ErrThrottleState)
+}
@@ -0,0 +1,517 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+)
+
+const (
+	TSCREATE     = "TS.CREATE"
+	TSADD        = "TS.ADD"
+	TSMADD       = "TS.MADD"
+	TSINCRBY     = "TS.INCRBY"
+	TSGET        = "TS.GET"
+	TSRANGE      = "TS.RANGE"
+	TSREVRANGE   = "TS.REVRANGE"
+	TSCREATERULE = "TS.CREATERULE"
+	TSMRANGE     = "TS.MRANGE"
+	TSMREVRANGE  = "TS.MREVRANGE"
+)
+
+var (
+	ErrTSSameKey      = errors.New("the source key and destination key should be different")
+	ErrTSHasSource    = errors.New("the destination key already has a src rule")
+	ErrTSOldTimestamp = errors.New("timestamp must be equal to or higher than the maximum existing timestamp")
+	ErrTSNoMatcher    = errors.New("please provide at least one matcher")
+)
+
+func tsError(err error) error {
+	return fmt.Errorf("TSDB: %w", err)
+}
+
+func getTimeSeries(ctx context.Context, s Storage, key string) (*timeseries.Series, Entry, error) {
+	return getTyped[*timeseries.Series](ctx, s, key, ValueTimeSeries)
+}
+
+// addSample adds a sample to the series and propagates samples produced by compaction
+// rules to their destination series.
+func addSample(
+	ctx context.Context,
+	s Storage,
+	key string,
+	series *timeseries.Series,
+	entry Entry,
+	sample timeseries.Sample,
+	policy timeseries.DuplicatePolicy,
+) error {
+	compactions, err := series.Add(sample, policy)
+	if err != nil {
+		return tsError(err)
+	}
+	var expiresAt *time.Time
+	if entry != nil {
+		expiresAt = entry.ExpiresAt()
+	}
+	if _, err := s.Set(ctx, key, series, expiresAt); err != nil {
+		return err
+	}
+
+	for _, c := range compactions {
+		dest, destEntry, err := getTimeSeries(ctx, s, c.Dest)
+		if err != nil || dest.Source() != key {
+			// Destination was deleted or replaced by another value.
+			continue
+		}
+		err = addSample(ctx, s, c.Dest, dest, destEntry, c.Sample, timeseries.PolicyLast)
+		if err != nil && !errors.Is(err, timeseries.ErrTooOld) {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveTimestamp(ts *int64) int64 {
+	if ts == nil {
+		return time.Now().UnixMilli()
+	}
+	return *ts
+}
+
+func samplesReply(samples []timeseries.Sample) []interface{} {
+	res := make([]interface{}, len(samples))
+	for i, s := range samples {
+		res[i] = []interface{}{s.Timestamp, formatFloat(s.Value)}
+	}
+	return res
+}
+
+func labelsReply(labels []timeseries.Label) []interface{} {
+	res := make([]interface{}, len(labels))
+	for i, l := range labels {
+		res[i] = []interface{}{[]byte(l.Name), []byte(l.Value)}
+	}
+	return res
+}
+
+func tsOptionsArgs(opts timeseries.Options) []interface{} {
+	var res []interface{}
+	if opts.Retention > 0 {
+		res = append(res, "RETENTION", opts.Retention)
+	}
+	if opts.ChunkSize > 0 {
+		res = append(res, "CHUNK_SIZE", int64(opts.ChunkSize))
+	}
+	if opts.DuplicatePolicy != "" {
+		res = append(res, "DUPLICATE_POLICY", string(opts.DuplicatePolicy))
+	}
+	if len(opts.Labels) > 0 {
+		res = append(res, "LABELS")
+		for _, l := range opts.Labels {
+			res = append(res, l.Name, l.Value)
+		}
+	}
+	return res
+}
+
+func tsQueryArgs(q timeseries.Query) []interface{} {
+	res := []interface{}{q.From, q.To}
+	if len(q.FilterByTS) > 0 {
+		res = append(res, "FILTER_BY_TS")
+		for _, ts := range q.FilterByTS {
+			res = append(res, ts)
+		}
+	}
+	if q.FilterByValue {
+		res = append(res, "FILTER_BY_VALUE", formatFloat(q.MinValue), formatFloat(q.MaxValue))
+	}
+	if q.Count > 0 {
+		res = append(res, "COUNT", int64(q.Count))
+	}
+	if q.Aggregation != "" {
+		res = append(res, "ALIGN", q.Align, "AGGREGATION", string(q.Aggregation), q.BucketDuration)
+	}
+	return res
+}
+
+func TSCreate(key string, opts timeseries.Options) Command {
+	return &tsCreate{key: key, opts: opts}
+}
+
+type tsCreate struct {
+	modifyingCommand
+	key  string
+	opts timeseries.Options
+}
+
+func (t *tsCreate) Name() string {
+	return TSCREATE
+}
+
+func (t *tsCreate) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, t.key)
+	if err == nil {
+		return nil, tsError(ErrKeyExists)
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, t.key, timeseries.New(t.opts), nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (t *tsCreate) Args() []interface{} {
+	return append([]interface{}{TSCREATE, t.key}, tsOptionsArgs(t.opts)...)
+}
+
+// TSAdd adds a sample to the series. Nil timestamp means current time, which is
+// resolved on execution, so the logged command is deterministic. Series is created with
+// opts if it doesn't exist.
+func TSAdd(
+	key string,
+	timestamp *int64,
+	value float64,
+	policy timeseries.DuplicatePolicy,
+	opts timeseries.Options,
+) Command {
+	return &tsAdd{key: key, timestamp: timestamp, value: value, policy: policy, opts: opts}
+}
+
+type tsAdd struct {
+	modifyingCommand
+	key       string
+	timestamp *int64
+	value     float64
+	policy    timeseries.DuplicatePolicy
+	opts      timeseries.Options
+}
+
+func (t *tsAdd) Name() string {
+	return TSADD
+}
+
+func (t *tsAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	ts := resolveTimestamp(t.timestamp)
+	t.timestamp = &ts
+
+	storage := c.Storage()
+	series, entry, err := getTimeSeries(ctx, storage, t.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		series, err = timeseries.New(t.opts), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sample := timeseries.Sample{Timestamp: ts, Value: t.value}
+	if err := addSample(ctx, storage, t.key, series, entry, sample, t.policy); err != nil {
+		return nil, err
+	}
+	return NewResult(ts), nil
+}
+
+func (t *tsAdd) Args() []interface{} {
+	res := []interface{}{TSADD, t.key}
+	if t.timestamp != nil {
+		res = append(res, *t.timestamp)
+	} else {
+		res = append(res, "*")
+	}
+	res = append(res, formatFloat(t.value))
+	if t.policy != "" {
+		res = append(res, "ON_DUPLICATE", string(t.policy))
+	}
+	return append(res, tsOptionsArgs(t.opts)...)
+}
+
+// TSSample is a sample of TS.MADD command. Nil timestamp means current time.
+type TSSample struct {
+	Key       string
+	Timestamp *int64
+	Value     float64
+}
+
+func TSMAdd(samples ...TSSample) Command {
+	return &tsMAdd{samples: samples}
+}
+
+type tsMAdd struct {
+	modifyingCommand
+	samples []TSSample
+}
+
+func (t *tsMAdd) Name() string {
+	return TSMADD
+}
+
+func (t *tsMAdd) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	res := make([]interface{}, len(t.samples))
+	for i := range t.samples {
+		s := &t.samples[i]
+		ts := resolveTimestamp(s.Timestamp)
+		s.Timestamp = &ts
+
+		series, entry, err := getTimeSeries(ctx, storage, s.Key)
+		if err == nil {
+			err = addSample(ctx, storage, s.Key, series, entry, timeseries.Sample{Timestamp: ts, Value: s.Value}, "")
+		}
+		if err != nil {
+			res[i] = err
+			continue
+		}
+		res[i] = ts
+	}
+	return NewResult(res), nil
+}
+
+func (t *tsMAdd) Args() []interface{} {
+	res := []interface{}{TSMADD}
+	for _, s := range t.samples {
+		res = append(res, s.Key)
+		if s.Timestamp != nil {
+			res = append(res, *s.Timestamp)
+		} else {
+			res = append(res, "*")
+		}
+		res = append(res, formatFloat(s.Value))
+	}
+	return res
+}
+
+// TSIncrBy adds a sample with value of the last sample increased by incr.
+// Nil timestamp means current time.
+func TSIncrBy(key string, incr float64, timestamp *int64, opts timeseries.Options) Command {
+	return &tsIncrBy{key: key, incr: incr, timestamp: timestamp, opts: opts}
+}
+
+type tsIncrBy struct {
+	modifyingCommand
+	key       string
+	incr      float64
+	timestamp *int64
+	opts      timeseries.Options
+}
+
+func (t *tsIncrBy) Name() string {
+	return TSINCRBY
+}
+
+func (t *tsIncrBy) Execute(ctx context.Context, c Client) (*Result, error) {
+	ts := resolveTimestamp(t.timestamp)
+	t.timestamp = &ts
+
+	storage := c.Storage()
+	series, entry, err := getTimeSeries(ctx, storage, t.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		series, err = timeseries.New(t.opts), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value := t.incr
+	if last, ok := series.Last(); ok {
+		if ts < last.Timestamp {
+			return nil, tsError(ErrTSOldTimestamp)
+		}
+		value += last.Value
+	}
+	sample := timeseries.Sample{Timestamp: ts, Value: value}
+	if err := addSample(ctx, storage, t.key, series, entry, sample, timeseries.PolicyLast); err != nil {
+		return nil, err
+	}
+	return NewResult(ts), nil
+}
+
+func (t *tsIncrBy) Args() []interface{} {
+	res := []interface{}{TSINCRBY, t.key, formatFloat(t.incr)}
+	if t.timestamp != nil {
+		res = append(res, "TIMESTAMP", *t.timestamp)
+	}
+	return append(res, tsOptionsArgs(t.opts)...)
+}
+
+func TSGet(key string) Command {
+	return &tsGet{key: key}
+}
+
+type tsGet struct {
+	baseCommand
+	key string
+}
+
+func (t *tsGet) Name() string {
+	return TSGET
+}
+
+func (t *tsGet) Execute(ctx context.Context, c Client) (*Result, error) {
+	series, _, err := getTimeSeries(ctx, c.Storage(), t.key)
+	if err != nil {
+		return nil, err
+	}
+	last, ok := series.Last()
+	if !ok {
+		return NewResult([]interface{}{}), nil
+	}
+	return NewResult([]interface{}{last.Timestamp, formatFloat(last.Value)}), nil
+}
+
+func (t *tsGet) Args() []interface{} {
+	return []interface{}{TSGET, t.key}
+}
+
+// TSRange queries samples of the series. Query.Reverse selects TS.REVRANGE.
+func TSRange(key string, query timeseries.Query) Command {
+	return &tsRange{key: key, query: query}
+}
+
+type tsRange struct {
+	baseCommand
+	key   string
+	query timeseries.Query
+}
+
+func (t *tsRange) Name() string {
+	if t.query.Reverse {
+		return TSREVRANGE
+	}
+	return TSRANGE
+}
+
+func (t *tsRange) Execute(ctx context.Context, c Client) (*Result, error) {
+	series, _, err := getTimeSeries(ctx, c.Storage(), t.key)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(samplesReply(series.Query(t.query))), nil
+}
+
+func (t *tsRange) Args() []interface{} {
+	return append([]interface{}{t.Name(), t.key}, tsQueryArgs(t.query)...)
+}
+
+// TSCreateRule creates a compaction rule from src into dest.
+func TSCreateRule(src, dest string, agg timeseries.Aggregation, bucket, align int64) (Command, error) {
+	if src == dest {
+		return nil, tsError(ErrTSSameKey)
+	}
+	if bucket <= 0 {
+		return nil, fmt.Errorf("%w: bucket duration must be positive", ErrInvalidOpt)
+	}
+	return &tsCreateRule{src: src, dest: dest, agg: agg, bucket: bucket, align: align}, nil
+}
+
+type tsCreateRule struct {
+	modifyingCommand
+	src    string
+	dest   string
+	agg    timeseries.Aggregation
+	bucket int64
+	align  int64
+}
+
+func (t *tsCreateRule) Name() string {
+	return TSCREATERULE
+}
+
+func (t *tsCreateRule) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	src, srcEntry, err := getTimeSeries(ctx, storage, t.src)
+	if err != nil {
+		return nil, err
+	}
+	dest, destEntry, err := getTimeSeries(ctx, storage, t.dest)
+	if err != nil {
+		return nil, err
+	}
+	if dest.Source() != "" {
+		return nil, tsError(ErrTSHasSource)
+	}
+
+	src.AddRule(timeseries.NewRule(t.dest, t.agg, t.bucket, t.align))
+	dest.SetSource(t.src)
+	if _, err := storage.Set(ctx, t.src, src, srcEntry.ExpiresAt()); err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, t.dest, dest, destEntry.ExpiresAt()); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (t *tsCreateRule) Args() []interface{} {
+	res := []interface{}{TSCREATERULE, t.src, t.dest, "AGGREGATION", string(t.agg), t.bucket}
+	if t.align != 0 {
+		res = append(res, t.align)
+	}
+	return res
+}
+
+// TSMRange queries samples of all series matching the filter. At least one matcher
+// must require a label to have a specific value. Query.Reverse selects TS.MREVRANGE.
+func TSMRange(query timeseries.Query, filter []timeseries.Matcher, withLabels bool) (Command, error) {
+	if !slices.ContainsFunc(filter, timeseries.Matcher.IsPositive) {
+		return nil, tsError(ErrTSNoMatcher)
+	}
+	return &tsMRange{query: query, filter: filter, withLabels: withLabels}, nil
+}
+
+type tsMRange struct {
+	baseCommand
+	query      timeseries.Query
+	filter     []timeseries.Matcher
+	withLabels bool
+}
+
+func (t *tsMRange) Name() string {
+	if t.query.Reverse {
+		return TSMREVRANGE
+	}
+	return TSMRANGE
+}
+
+func (t *tsMRange) Execute(ctx context.Context, c Client) (*Result, error) {
+	matched := map[string]*timeseries.Series{}
+	c.Storage().Range(ctx, func(key string, entry Entry) bool {
+		if series, ok := entry.Value().(*timeseries.Series); ok && timeseries.MatchAll(series, t.filter) {
+			matched[key] = series
+		}
+		return true
+	})
+
+	keys := make([]string, 0, len(matched))
+	for key := range matched {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	res := make([]interface{}, len(keys))
+	for i, key := range keys {
+		series := matched[key]
+		labels := []interface{}{}
+		if t.withLabels {
+			labels = labelsReply(series.Labels())
+		}
+		res[i] = []interface{}{[]byte(key), labels, samplesReply(series.Query(t.query))}
+	}
+	return NewResult(res), nil
+}
+
+func (t *tsMRange) Args() []interface{} {
+	res := append([]interface{}{t.Name()}, tsQueryArgs(t.query)...)
+	if t.withLabels {
+		res = append(res, "WITHLABELS")
+	}
+	res = append(res, "FILTER")
+	for _, m := range t.filter {
+		res = append(res, m.String())
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTSAdd_logsResolvedTimestamp(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage)
+	storage.EXPECT().GetTyped(ctx, "ts", cmd.ValueTimeSeries).Return(nil, cmd.ErrKeyNotFound)
+	storage.EXPECT().Set(ctx, "ts", gomock.Any(), nil).Return(&mockValue{}, nil)
+
+	add := cmd.TSAdd("ts", nil, 1.5, "", timeseries.Options{})
+	res, err := add.Execute(ctx, client)
+	require.NoError(t, err)
+	ts, ok := res.Values[0].(int64)
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{cmd.TSADD, "ts", ts, []byte("1.5")}, add.Args())
+}
+
+func TestTSCreateRule_propagatesCompactions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	src := &mockValue{value: timeseries.New(timeseries.Options{})}
+	dest := &mockValue{value: timeseries.New(timeseries.Options{})}
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).AnyTimes()
+	storage.EXPECT().GetTyped(ctx, "src", cmd.ValueTimeSeries).Return(src, nil).AnyTimes()
+	storage.EXPECT().GetTyped(ctx, "dest", cmd.ValueTimeSeries).Return(dest, nil).AnyTimes()
+	storage.EXPECT().Set(ctx, "src", src.value, nil).Return(src, nil).AnyTimes()
+	storage.EXPECT().Set(ctx, "dest", dest.value, nil).Return(dest, nil).AnyTimes()
+
+	rule, err := cmd.TSCreateRule("src", "dest", timeseries.AggSum, 10, 0)
+	require.NoError(t, err)
+	_, err = rule.Execute(ctx, client)
+	require.NoError(t, err)
+
+	for i, ts := range []int64{1, 5, 12} {
+		_, err := cmd.TSAdd("src", &ts, float64(i+1), "", timeseries.Options{}).Execute(ctx, client)
+		require.NoError(t, err)
+	}
+
+	res, err := cmd.TSGet("dest").Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{int64(0), []byte("3")}), res)
+
+	_, err = rule.Execute(ctx, client)
+	assert.ErrorIs(t, err, cmd.ErrTSHasSource)
+}
+
+func TestTSMRange_requiresPositiveMatcher(t *testing.T) {
+	t.Parallel()
+	m, err := timeseries.ParseMatcher("area!=eu")
+	require.NoError(t, err)
+	_, err = cmd.TSMRange(timeseries.Query{}, []timeseries.Matcher{m}, false)
+	assert.ErrorIs(t, err, cmd.ErrTSNoMatcher)
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/algo/topk"
+)
+
+const (
+	TOPKRESERVE = "TOPK.RESERVE"
+	TOPKADD     = "TOPK.ADD"
+	TOPKINCRBY  = "TOPK.INCRBY"
+	TOPKQUERY   = "TOPK.QUERY"
+	TOPKLIST    = "TOPK.LIST"
+)
+
+func getTopK(ctx context.Context, s Storage, key string) (*topk.TopK, Entry, error) {
+	return getTyped[*topk.TopK](ctx, s, key, ValueTopK)
+}
+
+func TopKReserve(key string, opts topk.Options) (Command, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpt, err)
+	}
+	return &topKReserve{key: key, opts: opts}, nil
+}
+
+type topKReserve struct {
+	modifyingCommand
+	key  string
+	opts topk.Options
+}
+
+func (r *topKReserve) Name() string {
+	return TOPKRESERVE
+}
+
+func (r *topKReserve) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	_, err := storage.Get(ctx, r.key)
+	if err == nil {
+		return nil, ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	t, err := topk.New(r.opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Set(ctx, r.key, t, nil); err != nil {
+		return nil, err
+	}
+	return OkResult(), nil
+}
+
+func (r *topKReserve) Args() []interface{} {
+	return []interface{}{
+		TOPKRESERVE, r.key, int64(r.opts.K), int64(r.opts.Width), int64(r.opts.Depth), formatFloat(r.opts.Decay),
+	}
+}
+
+type TopKIncrement struct {
+	Item  []byte
+	Value uint64
+}
+
+// TopKAdd adds items to the sketch. Reply contains an item expelled from the top-k list
+// for every added item, or nil.
+func TopKAdd(key string, items ...[]byte) Command {
+	increments := make([]TopKIncrement, len(items))
+	for i, item := range items {
+		increments[i] = TopKIncrement{Item: item, Value: 1}
+	}
+	return &topKIncrBy{key: key, increments: increments, add: true}
+}
+
+func TopKIncrBy(key string, increments ...TopKIncrement) Command {
+	return &topKIncrBy{key: key, increments: increments}
+}
+
+type topKIncrBy struct {
+	modifyingCommand
+	key        string
+	increments []TopKIncrement
+	add        bool
+}
+
+func (i *topKIncrBy) Name() string {
+	if i.add {
+		return TOPKADD
+	}
+	return TOPKINCRBY
+}
+
+func (i *topKIncrBy) Execute(ctx context.Context, c Client) (*Result, error) {
+	storage := c.Storage()
+	t, entry, err := getTopK(ctx, storage, i.key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(i.increments))
+	for j, incr := range i.increments {
+		res[j] = NilString()
+		if expelled, ok := t.IncrBy(incr.Item, incr.Value); ok {
+			res[j] = []byte(expelled)
+		}
+	}
+	if err := touch(ctx, storage, i.key, t, entry); err != nil {
+		return nil, err
+	}
+	return NewResult(res), nil
+}
+
+func (i *topKIncrBy) Args() []interface{} {
+	res := []interface{}{i.Name(), i.key}
+	for _, incr := range i.increments {
+		res = append(res, incr.Item)
+		if !i.add {
+			res = append(res, int64(incr.Value))
+		}
+	}
+	return res
+}
+
+func TopKQuery(key string, items ...[]byte) Command {
+	return &topKQuery{key: key, items: items}
+}
+
+type topKQuery struct {
+	baseCommand
+	key   string
+	items [][]byte
+}
+
+func (q *topKQuery) Name() string {
+	return TOPKQUERY
+}
+
+func (q *topKQuery) Execute(ctx context.Context, c Client) (*Result, error) {
+	t, _, err := getTopK(ctx, c.Storage(), q.key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(q.items))
+	for i, item := range q.items {
+		res[i] = boolReply(t.Query(item))
+	}
+	return NewResult(res), nil
+}
+
+func (q *topKQuery) Args() []interface{} {
+	res := []interface{}{TOPKQUERY, q.key}
+	for _, item := range q.items {
+		res = append(res, item)
+	}
+	return res
+}
+
+func TopKList(key string, withCount bool) Command {
+	return &topKList{key: key, withCount: withCount}
+}
+
+type topKList struct {
+	baseCommand
+	key       string
+	withCount bool
+}
+
+func (l *topKList) Name() string {
+	return TOPKLIST
+}
+
+func (l *topKList) Execute(ctx context.Context, c Client) (*Result, error) {
+	t, _, err := getTopK(ctx, c.Storage(), l.key)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, item := range t.List() {
+		res = append(res, []byte(item.Value))
+		if l.withCount {
+			res = append(res, int64(item.Count))
+		}
+	}
+	return NewResult(res), nil
+}
+
+func (l *topKList) Args() []interface{} {
+	if l.withCount {
+		return []interface{}{TOPKLIST, l.key, "WITHCOUNT"}
+	}
+	return []interface{}{TOPKLIST, l.key}
+}
@@ -0,0 +1,39 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/topk"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopKAdd_returnsExpelled(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	tk, err := topk.New(topk.Options{K: 1, Width: 8, Depth: 3, Decay: topk.DefaultDecay})
+	require.NoError(t, err)
+	value := &mockValue{value: tk}
+
+	client := NewMockClient(ctl)
+	storage := NewMockStorage(ctl)
+	client.EXPECT().Storage().Return(storage).Times(2)
+	storage.EXPECT().GetTyped(ctx, "top", cmd.ValueTopK).Return(value, nil).Times(2)
+	storage.EXPECT().Set(ctx, "top", tk, nil).Return(value, nil).Times(2)
+
+	res, err := cmd.TopKAdd("top", []byte("a")).Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{cmd.NilString()}), res)
+
+	incr := cmd.TopKIncrBy("top", cmd.TopKIncrement{Item: []byte("b"), Value: 5})
+	res, err = incr.Execute(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{[]byte("a")}), res)
+	assert.Equal(t, []interface{}{cmd.TOPKINCRBY, "top", []byte("b"), int64(5)}, incr.Args())
+}
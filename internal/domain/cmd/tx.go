@@ -4,12 +4,14 @@ import (
 	"context"
 )
 
-func Multi() Command {
-	return &multi{}
+// Multi starts a transaction. Atomic transactions are rolled back if any command fails.
+func Multi(atomic bool) Command {
+	return &multi{atomic: atomic}
 }
 
 type multi struct {
 	txCommand
+	atomic bool
 }
 
 func (m *multi) Name() string {
@@ -17,13 +19,16 @@ func (m *multi) Name() string {
 }
 
 func (m *multi) Execute(ctx context.Context, storage Client) (*Result, error) {
-	if err := storage.StartTx(ctx); err != nil {
+	if err := storage.StartTx(ctx, m.atomic); err != nil {
 		return NewResult(err), err
 	}
 	return NewResult("OK"), nil
 }
 
 func (m *multi) Args() []interface{} {
+	if m.atomic {
+		return []interface{}{MULTI, "ATOMIC"}
+	}
 	return []interface{}{MULTI}
 }
 
@@ -97,7 +102,12 @@ func (w *watch) Execute(ctx context.Context, storage Client) (*Result, error) {
 }
 
 func (w *watch) Args() []interface{} {
-	return []interface{}{WATCH}
+	args := make([]interface{}, 0, len(w.keys)+1)
+	args = append(args, WATCH)
+	for _, key := range w.keys {
+		args = append(args, key)
+	}
+	return args
 }
 
 type unwatch struct {
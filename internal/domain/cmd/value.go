@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+	"github.com/burenotti/redis_impl/pkg/algo/cms"
+	"github.com/burenotti/redis_impl/pkg/algo/cuckoo"
+	"github.com/burenotti/redis_impl/pkg/algo/tdigest"
+	"github.com/burenotti/redis_impl/pkg/algo/topk"
+	"github.com/burenotti/redis_impl/pkg/graph"
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+	"github.com/burenotti/redis_impl/pkg/module"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+)
+
+var ErrUnsupportedValue = errors.New("value of unsupported type")
+
+// ValueType tags entries of the keyspace with the kind of the stored value.
+// Storage checks the tag on typed reads, so commands never see values of other types.
+type ValueType int
+
+const (
+	ValueNone ValueType = iota
+	ValueString
+	ValueHash
+	ValueJSON
+	ValueTimeSeries
+	ValueBloom
+	ValueCuckoo
+	ValueCMS
+	ValueTopK
+	ValueTDigest
+	ValueSuggest
+	ValueGraph
+	ValueModule
+)
+
+var valueTypeNames = [...]string{
+	ValueNone:       TypeNone,
+	ValueString:     TypeString,
+	ValueHash:       TypeHash,
+	ValueJSON:       TypeJSON,
+	ValueTimeSeries: TypeTimeSeries,
+	ValueBloom:      TypeBloom,
+	ValueCuckoo:     TypeCuckoo,
+	ValueCMS:        TypeCMS,
+	ValueTopK:       TypeTopK,
+	ValueTDigest:    TypeTDigest,
+	ValueSuggest:    TypeSuggest,
+	ValueGraph:      TypeGraph,
+	ValueModule:     TypeModule,
+}
+
+// String returns name of the type as reported by TYPE command.
+func (t ValueType) String() string {
+	if t < 0 || int(t) >= len(valueTypeNames) {
+		return TypeNone
+	}
+	return valueTypeNames[t]
+}
+
+// TypeOfValue returns type of the value. Values that can't be stored have ValueNone type.
+func TypeOfValue(value interface{}) ValueType {
+	switch value.(type) {
+	case []byte, string:
+		return ValueString
+	case Hash:
+		return ValueHash
+	case *jsondoc.Document:
+		return ValueJSON
+	case *timeseries.Series:
+		return ValueTimeSeries
+	case *bloom.Filter:
+		return ValueBloom
+	case *cuckoo.Filter:
+		return ValueCuckoo
+	case *cms.Sketch:
+		return ValueCMS
+	case *topk.TopK:
+		return ValueTopK
+	case *tdigest.TDigest:
+		return ValueTDigest
+	case *search.Suggestions:
+		return ValueSuggest
+	case *graph.Graph:
+		return ValueGraph
+	case *module.Value:
+		return ValueModule
+	default:
+		return ValueNone
+	}
+}
+
+// Encodings of values as reported by OBJECT ENCODING command.
+const (
+	EncodingInt       = "int"
+	EncodingEmbStr    = "embstr"
+	EncodingRaw       = "raw"
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+const (
+	maxEmbStrLen         = 44
+	maxListpackEntries   = 128
+	maxListpackEntrySize = 64
+)
+
+// EncodingOf returns encoding of the value. Strings representing integers are encoded as int,
+// short strings as embstr, small hashes as listpack. Other values have raw encoding.
+func EncodingOf(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return stringEncoding(string(v))
+	case string:
+		return stringEncoding(v)
+	case Hash:
+		if len(v) > maxListpackEntries {
+			return EncodingHashtable
+		}
+		for field, val := range v {
+			if len(field) > maxListpackEntrySize || len(val) > maxListpackEntrySize {
+				return EncodingHashtable
+			}
+		}
+		return EncodingListpack
+	default:
+		return EncodingRaw
+	}
+}
+
+func stringEncoding(s string) string {
+	// Only canonical representations are stored as integers, so the value reads back unchanged.
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		return EncodingInt
+	}
+	if len(s) <= maxEmbStrLen {
+		return EncodingEmbStr
+	}
+	return EncodingRaw
+}
+
+// CloneValue returns a deep copy of a stored value, so the copy isn't affected by commands
+// modifying the value in place.
+func CloneValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return bytes.Clone(v), nil
+	case string:
+		return v, nil
+	case Hash:
+		c := make(Hash, len(v))
+		for field, val := range v {
+			c[field] = bytes.Clone(val)
+		}
+		return c, nil
+	case *jsondoc.Document:
+		return jsondoc.New(jsondoc.Clone(v.Root())), nil
+	case *timeseries.Series:
+		return v.Clone(), nil
+	case *bloom.Filter:
+		return cloneBinary(v)
+	case *cuckoo.Filter:
+		return cloneBinary(v)
+	case *cms.Sketch:
+		return cloneBinary(v)
+	case *topk.TopK:
+		return cloneBinary(v)
+	case *tdigest.TDigest:
+		return cloneBinary(v)
+	case *search.Suggestions:
+		return v.Clone(), nil
+	case *graph.Graph:
+		return v.Clone(), nil
+	case *module.Value:
+		return v.Clone()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+	}
+}
+
+// cloneBinary copies probabilistic structures through their binary encoding.
+func cloneBinary[T any, P interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}](v P) (P, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	c := P(new(T))
+	if err := c.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// getTyped returns a value of the type stored at key.
+func getTyped[T any](ctx context.Context, s Storage, key string, typ ValueType) (T, Entry, error) {
+	var zero T
+	entry, err := s.GetTyped(ctx, key, typ)
+	if err != nil {
+		return zero, nil, err
+	}
+	value, ok := entry.Value().(T)
+	if !ok {
+		return zero, nil, ErrWrongType
+	}
+	return value, entry, nil
+}
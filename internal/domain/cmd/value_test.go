@@ -0,0 +1,54 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodingOf(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, cmd.EncodingInt, cmd.EncodingOf([]byte("-42")))
+	assert.Equal(t, cmd.EncodingEmbStr, cmd.EncodingOf([]byte("042")))
+	assert.Equal(t, cmd.EncodingRaw, cmd.EncodingOf(strings.Repeat("a", 45)))
+	assert.Equal(t, cmd.EncodingListpack, cmd.EncodingOf(cmd.Hash{"a": []byte("b")}))
+	assert.Equal(t, cmd.EncodingHashtable, cmd.EncodingOf(cmd.Hash{"a": []byte(strings.Repeat("b", 65))}))
+	assert.Equal(t, cmd.EncodingRaw, cmd.EncodingOf(search.NewSuggestions()))
+}
+
+func TestCloneValue(t *testing.T) {
+	t.Parallel()
+	hash := cmd.Hash{"a": []byte("b")}
+	c, err := cmd.CloneValue(hash)
+	require.NoError(t, err)
+	hash["a"][0] = 'c'
+	assert.Equal(t, cmd.Hash{"a": []byte("b")}, c)
+
+	f, err := bloom.New(bloom.Options{ErrorRate: 0.01, Capacity: 100, Expansion: 2})
+	require.NoError(t, err)
+	_, err = f.Add([]byte("a"))
+	require.NoError(t, err)
+	c, err = cmd.CloneValue(f)
+	require.NoError(t, err)
+	_, err = f.Add([]byte("b"))
+	require.NoError(t, err)
+	copied := c.(*bloom.Filter) //nolint:forcetypeassert // a copy has the same type
+	assert.True(t, copied.Exists([]byte("a")))
+	assert.False(t, copied.Exists([]byte("b")))
+
+	sug := search.NewSuggestions()
+	sug.Add("hello", 1, false, []byte("payload"))
+	c, err = cmd.CloneValue(sug)
+	require.NoError(t, err)
+	sug.Add("hello", 2, true, nil)
+	assert.Equal(t, []search.Suggestion{{String: "hello", Score: 1, Payload: []byte("payload")}},
+		c.(*search.Suggestions).Get("he", false, 1)) //nolint:forcetypeassert // a copy has the same type
+
+	_, err = cmd.CloneValue(42)
+	require.ErrorIs(t, err, cmd.ErrUnsupportedValue)
+}
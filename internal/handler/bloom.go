@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+	"github.com/burenotti/redis_impl/pkg/algo/cuckoo"
+)
+
+func parseUint(name, value string) (uint64, error) {
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be a non-negative integer", ErrSyntax, name)
+	}
+	return v, nil
+}
+
+func parseBFReserve(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 { //nolint:mnd // key, error rate and capacity
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.BFRESERVE)
+	}
+
+	var opts bloom.Options
+	if opts.ErrorRate, err = strconv.ParseFloat(parsed[1], 64); err != nil {
+		return nil, fmt.Errorf("%w: error rate must be a number", ErrSyntax)
+	}
+	if opts.Capacity, err = parseUint("capacity", parsed[2]); err != nil {
+		return nil, err
+	}
+	for i := 3; i < len(parsed); i++ {
+		switch opt := strings.ToUpper(parsed[i]); opt {
+		case "NONSCALING":
+			opts.NonScaling = true
+		case "EXPANSION":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			i++
+			if opts.Expansion, err = parseUint("expansion", parsed[i]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.BFRESERVE)
+		}
+	}
+	return cmd.BFReserve(parsed[0], opts)
+}
+
+// parseKeyItem parses commands with signature "key item".
+func parseKeyItem(name string, args []interface{}, create func(key string, item []byte) cmd.Command,
+) (cmd.Command, error) {
+	if len(args) != 2 { //nolint:mnd // key and item
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return create(parsed[0], []byte(parsed[1])), nil
+}
+
+// parseKeyItems parses commands with signature "key item [item ...]".
+func parseKeyItems(name string, args []interface{}, create func(key string, items ...[]byte) cmd.Command,
+) (cmd.Command, error) {
+	if len(args) < 2 { //nolint:mnd // key and item
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return create(parsed[0], asBytes(parsed[1:])...), nil
+}
+
+func parseBFAdd(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.BFADD, args, cmd.BFAdd)
+}
+
+func parseBFMAdd(args []interface{}) (cmd.Command, error) {
+	return parseKeyItems(cmd.BFMADD, args, cmd.BFMAdd)
+}
+
+func parseBFExists(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.BFEXISTS, args, cmd.BFExists)
+}
+
+func parseBFMExists(args []interface{}) (cmd.Command, error) {
+	return parseKeyItems(cmd.BFMEXISTS, args, cmd.BFMExists)
+}
+
+func parseBFInfo(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 && len(parsed) != 2 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.BFINFO)
+	}
+	if len(parsed) == 1 {
+		return cmd.BFInfo(parsed[0], cmd.BFInfoAll), nil
+	}
+	switch field := cmd.BFInfoField(strings.ToUpper(parsed[1])); field {
+	case cmd.BFInfoCapacity, cmd.BFInfoSize, cmd.BFInfoFilters, cmd.BFInfoItems, cmd.BFInfoExpansion:
+		return cmd.BFInfo(parsed[0], field), nil
+	default:
+		return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[1], cmd.BFINFO)
+	}
+}
+
+func parseCFReserve(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // key and capacity
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CFRESERVE)
+	}
+
+	opts := cuckoo.Options{Expansion: cuckoo.DefaultExpansion}
+	if opts.Capacity, err = parseUint("capacity", parsed[1]); err != nil {
+		return nil, err
+	}
+	for i := 2; i < len(parsed); i += 2 {
+		var target *uint64
+		switch opt := strings.ToUpper(parsed[i]); opt {
+		case "BUCKETSIZE":
+			target = &opts.BucketSize
+		case "MAXITERATIONS":
+			target = &opts.MaxIterations
+		case "EXPANSION":
+			target = &opts.Expansion
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.CFRESERVE)
+		}
+		if i+1 >= len(parsed) {
+			return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, parsed[i])
+		}
+		if *target, err = parseUint(strings.ToLower(parsed[i]), parsed[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return cmd.CFReserve(parsed[0], opts)
+}
+
+func parseCFAdd(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.CFADD, args, func(key string, item []byte) cmd.Command {
+		return cmd.CFAdd(key, item, false)
+	})
+}
+
+func parseCFAddNX(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.CFADDNX, args, func(key string, item []byte) cmd.Command {
+		return cmd.CFAdd(key, item, true)
+	})
+}
+
+func parseCFDel(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.CFDEL, args, cmd.CFDel)
+}
+
+func parseCFExists(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.CFEXISTS, args, func(key string, item []byte) cmd.Command {
+		return cmd.CFCount(key, item, true)
+	})
+}
+
+func parseCFCount(args []interface{}) (cmd.Command, error) {
+	return parseKeyItem(cmd.CFCOUNT, args, func(key string, item []byte) cmd.Command {
+		return cmd.CFCount(key, item, false)
+	})
+}
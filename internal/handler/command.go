@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// parseCommand parses COMMAND, COMMAND COUNT, COMMAND INFO [name ...], COMMAND DOCS [name ...],
+// COMMAND LIST [FILTERBY MODULE name|ACLCAT category|PATTERN pattern] and COMMAND GETKEYS command [arg ...].
+func parseCommand(table *cmd.CommandTable) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		parsed, err := asStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) == 0 {
+			return cmd.CommandIntrospection(table, cmd.CommandAll), nil
+		}
+		sub, rest := cmd.CommandSubcommand(strings.ToUpper(parsed[0])), parsed[1:]
+		wrongArgs := fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.COMMAND, sub)
+		switch sub {
+		case cmd.CommandCount:
+			if len(rest) != 0 {
+				return nil, wrongArgs
+			}
+			return cmd.CommandIntrospection(table, sub), nil
+		case cmd.CommandInfo, cmd.CommandDocs:
+			return cmd.CommandIntrospection(table, sub, rest...), nil
+		case cmd.CommandGetKeys:
+			if len(rest) == 0 {
+				return nil, wrongArgs
+			}
+			return cmd.CommandIntrospection(table, sub, rest...), nil
+		case cmd.CommandList:
+			return parseCommandList(table, rest)
+		}
+		return nil, fmt.Errorf("%w: unknown subcommand %s", ErrSyntax, parsed[0])
+	}
+}
+
+func parseCommandList(table *cmd.CommandTable, args []string) (cmd.Command, error) {
+	switch {
+	case len(args) == 0:
+		return cmd.CommandListing(table, nil), nil
+	case len(args) != 3 || !strings.EqualFold(args[0], "FILTERBY"): //nolint:mnd // FILTERBY, kind and value
+		return nil, fmt.Errorf("%w: %s %s accepts FILTERBY MODULE|ACLCAT|PATTERN only", ErrSyntax, cmd.COMMAND, cmd.CommandList)
+	}
+	filter := &cmd.CommandFilter{}
+	switch strings.ToUpper(args[1]) {
+	case "MODULE":
+		filter.Module = args[2]
+	case "ACLCAT":
+		filter.ACLCategory = args[2]
+	case "PATTERN":
+		filter.Pattern = args[2]
+	default:
+		return nil, fmt.Errorf("%w: unknown filter %s", ErrSyntax, args[1])
+	}
+	return cmd.CommandListing(table, filter), nil
+}
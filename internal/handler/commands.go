@@ -110,7 +110,18 @@ func parseDiscard(args []interface{}) (cmd.Command, error) {
 }
 
 func parseMulti(args []interface{}) (cmd.Command, error) {
-	return parseNoArgs(cmd.Multi(), args)
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parsed) == 0:
+		return cmd.Multi(false), nil
+	case len(parsed) == 1 && strings.EqualFold(parsed[0], "ATOMIC"):
+		return cmd.Multi(true), nil
+	default:
+		return nil, fmt.Errorf("%w: MULTI accepts only ATOMIC option", ErrSyntax)
+	}
 }
 
 func parseExec(args []interface{}) (cmd.Command, error) {
@@ -137,6 +148,140 @@ func parseHello(_ []interface{}) (cmd.Command, error) {
 	return cmd.Hello(), nil
 }
 
+func parseSelect(args []interface{}) (cmd.Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for select", ErrSyntax)
+	}
+	db, err := parseInt(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid DB index", ErrSyntax)
+	}
+	return cmd.Select(int(db)), nil
+}
+
+func parseSwapDB(args []interface{}) (cmd.Command, error) {
+	if len(args) != 2 { //nolint:mnd // two databases to swap
+		return nil, fmt.Errorf("%w: wrong number of arguments for swapdb", ErrSyntax)
+	}
+	first, err := parseInt(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid first DB index", ErrSyntax)
+	}
+	second, err := parseInt(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid second DB index", ErrSyntax)
+	}
+	return cmd.SwapDB(int(first), int(second)), nil
+}
+
+func parseMove(args []interface{}) (cmd.Command, error) {
+	if len(args) != 2 { //nolint:mnd // key and db
+		return nil, fmt.Errorf("%w: wrong number of arguments for move", ErrSyntax)
+	}
+	key, ok := asString(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: key must be a string", ErrSyntax)
+	}
+	db, err := parseInt(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid DB index", ErrSyntax)
+	}
+	return cmd.Move(key, int(db)), nil
+}
+
+func parseDBSize(args []interface{}) (cmd.Command, error) {
+	return parseNoArgs(cmd.DBSize(), args)
+}
+
+func parseFlushMode(name string, args []interface{}) (cmd.FlushMode, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("%w: too many arguments for %s", ErrSyntax, name)
+	}
+	mode, ok := asString(args[0])
+	if !ok {
+		return "", fmt.Errorf("%w: bad syntax of command %s", ErrSyntax, name)
+	}
+	switch m := cmd.FlushMode(strings.ToUpper(mode)); m {
+	case cmd.FlushSync, cmd.FlushAsync:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w: invalid flush mode %s", ErrSyntax, mode)
+	}
+}
+
+func parseFlushDB(args []interface{}) (cmd.Command, error) {
+	mode, err := parseFlushMode(cmd.FLUSHDB, args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.FlushDB(mode), nil
+}
+
+func parseFlushAll(args []interface{}) (cmd.Command, error) {
+	mode, err := parseFlushMode(cmd.FLUSHALL, args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.FlushAll(mode), nil
+}
+
+func parseType(args []interface{}) (cmd.Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for type", ErrSyntax)
+	}
+	key, ok := asString(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: key must be a string", ErrSyntax)
+	}
+	return cmd.Type(key), nil
+}
+
+func parseObject(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 { //nolint:mnd // subcommand and key
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.OBJECT)
+	}
+	sub := cmd.ObjectSubcommand(strings.ToUpper(parsed[0]))
+	if sub != cmd.ObjectEncoding {
+		return nil, fmt.Errorf("%w: unknown subcommand %s", ErrSyntax, parsed[0])
+	}
+	return cmd.Object(sub, parsed[1]), nil
+}
+
+func parseShutdown(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parsed) == 0:
+		return cmd.Shutdown(cmd.ShutdownDefault), nil
+	case len(parsed) == 1 && strings.EqualFold(parsed[0], string(cmd.ShutdownNoSave)):
+		return cmd.Shutdown(cmd.ShutdownNoSave), nil
+	case len(parsed) == 1 && strings.EqualFold(parsed[0], string(cmd.ShutdownSave)):
+		return cmd.Shutdown(cmd.ShutdownSave), nil
+	default:
+		return nil, fmt.Errorf("%w: SHUTDOWN accepts only NOSAVE or SAVE option", ErrSyntax)
+	}
+}
+
+func asStrings(args []interface{}) ([]string, error) {
+	parsed := make([]string, len(args))
+	for i, arg := range args {
+		var ok bool
+		if parsed[i], ok = asString(arg); !ok {
+			return nil, fmt.Errorf("%w: all arguments must be strings", ErrSyntax)
+		}
+	}
+	return parsed, nil
+}
+
 func asString(i interface{}) (string, bool) {
 	if bytes, ok := i.([]byte); ok {
 		return string(bytes), true
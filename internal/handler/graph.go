@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+func parseGraphQuery(readOnly bool) func(args []interface{}) (cmd.Command, error) {
+	name := cmd.GRAPHQUERY
+	if readOnly {
+		name = cmd.GRAPHROQUERY
+	}
+	return func(args []interface{}) (cmd.Command, error) {
+		parsed, err := asStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) < 2 { //nolint:mnd // key and query
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+		}
+		compact := false
+		for _, opt := range parsed[2:] {
+			if !strings.EqualFold(opt, "--compact") {
+				return nil, fmt.Errorf("%w: unknown option %s", ErrSyntax, opt)
+			}
+			compact = true
+		}
+		return cmd.GraphQuery(parsed[0], parsed[1], readOnly, compact), nil
+	}
+}
+
+func parseGraphDelete(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.GRAPHDELETE)
+	}
+	return cmd.GraphDelete(parsed[0]), nil
+}
+
+func parseGraphExplain(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 { //nolint:mnd // key and query
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.GRAPHEXPLAIN)
+	}
+	return cmd.GraphExplain(parsed[0], parsed[1]), nil
+}
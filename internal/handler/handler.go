@@ -1,14 +1,15 @@
 package handler
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"strings"
 
 	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/server"
 	"github.com/burenotti/redis_impl/internal/service"
 	"github.com/burenotti/redis_impl/pkg/resp"
 )
@@ -18,52 +19,251 @@ var ErrSyntax = errors.New("syntax error")
 type Handler struct {
 	createController func() *service.Client
 	commands         map[string]func([]interface{}) (cmd.Command, error)
+	table            *cmd.CommandTable
+	modules          *cmd.ModuleRegistry
+	limits           resp.Limits
 }
 
 func New(createController func() *service.Client) *Handler {
-	h := &Handler{
-		createController: createController,
-		commands: map[string]func([]interface{}) (cmd.Command, error){
-			cmd.GET:     parseGet,
-			cmd.SET:     parseSet,
-			cmd.PING:    parsePing,
-			cmd.MULTI:   parseMulti,
-			cmd.EXEC:    parseExec,
-			cmd.DISCARD: parseDiscard,
-			cmd.WATCH:   parseWatch,
-			cmd.UNWATCH: parseUnwatch,
-			cmd.HELLO:   parseHello,
-		},
+	h := &Handler{createController: createController, table: cmd.NewCommandTable()}
+	h.commands = map[string]func([]interface{}) (cmd.Command, error){
+		cmd.GET:      parseGet,
+		cmd.SET:      parseSet,
+		cmd.PING:     parsePing,
+		cmd.MULTI:    parseMulti,
+		cmd.EXEC:     parseExec,
+		cmd.DISCARD:  parseDiscard,
+		cmd.WATCH:    parseWatch,
+		cmd.UNWATCH:  parseUnwatch,
+		cmd.HELLO:    parseHello,
+		cmd.SELECT:   parseSelect,
+		cmd.SWAPDB:   parseSwapDB,
+		cmd.MOVE:     parseMove,
+		cmd.DBSIZE:   parseDBSize,
+		cmd.FLUSHDB:  parseFlushDB,
+		cmd.FLUSHALL: parseFlushAll,
+		cmd.TYPE:     parseType,
+		cmd.DEL:      parseDel,
+		cmd.OBJECT:   parseObject,
+		cmd.SHUTDOWN: parseShutdown,
+
+		cmd.CLTHROTTLE: parseCLThrottle,
+
+		cmd.HSET:    parseHSet,
+		cmd.HGET:    parseHGet,
+		cmd.HMGET:   parseHMGet,
+		cmd.HDEL:    parseHDel,
+		cmd.HGETALL: parseHGetAll,
+		cmd.HKEYS:   parseHKeys,
+		cmd.HVALS:   parseHVals,
+		cmd.HLEN:    parseHLen,
+		cmd.HEXISTS: parseHExists,
+		cmd.HINCRBY: parseHIncrBy,
+
+		cmd.FTCREATE:    parseFTCreate,
+		cmd.FTDROPINDEX: parseFTDropIndex,
+		cmd.FTINFO:      parseFTInfo,
+		cmd.FTSEARCH:    parseFTSearch,
+		cmd.FTSUGADD:    parseFTSugAdd,
+		cmd.FTSUGGET:    parseFTSugGet,
+		cmd.FTSUGDEL:    parseFTSugDel,
+		cmd.FTSUGLEN:    parseFTSugLen,
+
+		cmd.GRAPHQUERY:   parseGraphQuery(false),
+		cmd.GRAPHROQUERY: parseGraphQuery(true),
+		cmd.GRAPHDELETE:  parseGraphDelete,
+		cmd.GRAPHEXPLAIN: parseGraphExplain,
+
+		cmd.JSONSET:       parseJSONSet,
+		cmd.JSONGET:       parseJSONGet,
+		cmd.JSONDEL:       parseJSONDel,
+		cmd.JSONTYPE:      parseJSONType,
+		cmd.JSONNUMINCRBY: parseJSONNumIncrBy,
+		cmd.JSONSTRAPPEND: parseJSONStrAppend,
+		cmd.JSONARRAPPEND: parseJSONArrAppend,
+		cmd.JSONARRINSERT: parseJSONArrInsert,
+		cmd.JSONARRPOP:    parseJSONArrPop,
+		cmd.JSONARRLEN:    parseJSONArrLen,
+		cmd.JSONOBJKEYS:   parseJSONObjKeys,
+		cmd.JSONMGET:      parseJSONMGet,
+
+		cmd.TSCREATE:     parseTSCreate,
+		cmd.TSADD:        parseTSAdd,
+		cmd.TSMADD:       parseTSMAdd,
+		cmd.TSINCRBY:     parseTSIncrBy,
+		cmd.TSGET:        parseTSGet,
+		cmd.TSRANGE:      parseTSRange(cmd.TSRANGE, false),
+		cmd.TSREVRANGE:   parseTSRange(cmd.TSREVRANGE, true),
+		cmd.TSCREATERULE: parseTSCreateRule,
+		cmd.TSMRANGE:     parseTSMRange(cmd.TSMRANGE, false),
+		cmd.TSMREVRANGE:  parseTSMRange(cmd.TSMREVRANGE, true),
+
+		cmd.BFRESERVE: parseBFReserve,
+		cmd.BFADD:     parseBFAdd,
+		cmd.BFMADD:    parseBFMAdd,
+		cmd.BFEXISTS:  parseBFExists,
+		cmd.BFMEXISTS: parseBFMExists,
+		cmd.BFINFO:    parseBFInfo,
+		cmd.CFRESERVE: parseCFReserve,
+		cmd.CFADD:     parseCFAdd,
+		cmd.CFADDNX:   parseCFAddNX,
+		cmd.CFDEL:     parseCFDel,
+		cmd.CFEXISTS:  parseCFExists,
+		cmd.CFCOUNT:   parseCFCount,
+
+		cmd.CMSINITBYDIM:  parseCMSInitByDim,
+		cmd.CMSINITBYPROB: parseCMSInitByProb,
+		cmd.CMSINCRBY:     parseCMSIncrBy,
+		cmd.CMSQUERY:      parseCMSQuery,
+		cmd.CMSMERGE:      parseCMSMerge,
+		cmd.TOPKRESERVE:   parseTopKReserve,
+		cmd.TOPKADD:       parseTopKAdd,
+		cmd.TOPKINCRBY:    parseTopKIncrBy,
+		cmd.TOPKQUERY:     parseTopKQuery,
+		cmd.TOPKLIST:      parseTopKList,
+
+		cmd.TDIGESTCREATE:      parseTDigestCreate,
+		cmd.TDIGESTADD:         parseTDigestAdd,
+		cmd.TDIGESTRESET:       parseTDigestReset,
+		cmd.TDIGESTMERGE:       parseTDigestMerge,
+		cmd.TDIGESTQUANTILE:    parseTDigestQuantile,
+		cmd.TDIGESTCDF:         parseTDigestCDF,
+		cmd.TDIGESTRANK:        parseTDigestRank(false),
+		cmd.TDIGESTREVRANK:     parseTDigestRank(true),
+		cmd.TDIGESTBYRANK:      parseTDigestByRank(false),
+		cmd.TDIGESTBYREVRANK:   parseTDigestByRank(true),
+		cmd.TDIGESTMIN:         parseTDigestMin,
+		cmd.TDIGESTMAX:         parseTDigestMax,
+		cmd.TDIGESTTRIMMEDMEAN: parseTDigestTrimmedMean,
+
+		cmd.EVAL:      parseEval(h.parse, false),
+		cmd.EVALRO:    parseEval(h.parse, true),
+		cmd.EVALSHA:   parseEvalSHA(h.parse, false),
+		cmd.EVALSHARO: parseEvalSHA(h.parse, true),
+		cmd.SCRIPT:    parseScript,
+		cmd.FCALL:     parseFCall(h.parse, false),
+		cmd.FCALLRO:   parseFCall(h.parse, true),
+		cmd.FUNCTION:  parseFunction,
+		cmd.MODULE:    parseModule,
+		cmd.COMMAND:   parseCommand(h.table),
+	}
+	for name := range h.commands {
+		if _, ok := h.table.Lookup(name); !ok {
+			panic(fmt.Sprintf("command %s has no spec", name))
+		}
+	}
+	for _, spec := range h.table.Specs() {
+		if _, ok := h.commands[spec.Name]; !ok {
+			panic(fmt.Sprintf("command %s has no parser", spec.Name))
+		}
 	}
 	return h
 }
 
+// UseModules makes commands registered by modules available. Modules can't override built-in commands.
+func (h *Handler) UseModules(modules *cmd.ModuleRegistry) {
+	for name := range h.commands {
+		modules.Reserve(name)
+	}
+	modules.Reserve(h.table.Aliases()...)
+	h.modules = modules
+	h.table.UseModules(modules)
+}
+
+// RenameCommand makes a built-in command available under the new name only. Empty name disables it.
+// Must be called before clients are served.
+func (h *Handler) RenameCommand(name, newName string) error {
+	if err := h.table.Rename(name, newName); err != nil {
+		return err
+	}
+	if h.modules != nil && newName != "" {
+		h.modules.Reserve(newName)
+	}
+	return nil
+}
+
+// SetProtoLimits bounds sizes of requests. Must be called before clients are served.
+func (h *Handler) SetProtoLimits(limits resp.Limits) {
+	h.limits = limits
+}
+
 func (h *Handler) Handle(ctx context.Context, req io.Reader, res io.Writer) error {
-	reader := bufio.NewReader(req)
+	decoder := resp.NewDecoder(req, h.limits)
 	controller := h.createController()
+	if conn, ok := req.(net.Conn); ok {
+		controller.SetConn(conn.RemoteAddr(), conn.LocalAddr())
+	}
 	for {
-		command, err := h.parseNextCommand(reader)
+		args, err := decoder.DecodeCommand()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
 		if err != nil {
-			if err := resp.Marshal(res, err.Error()); err != nil {
-				return err
-			}
-			continue
+			return h.failProtocol(controller, res, err)
+		}
+		if err := h.serve(ctx, controller, args, res); err != nil {
+			return err
 		}
+	}
+}
 
-		result, err := controller.Run(ctx, command)
+// Open creates a session serving requests of a connection of an event loop.
+func (h *Handler) Open(remote, local net.Addr) server.Session {
+	controller := h.createController()
+	controller.SetConn(remote, local)
+	return &session{handler: h, controller: controller, parser: resp.Parser{Limits: h.limits}}
+}
+
+// session parses requests incrementally, because an event loop passes them as they arrive.
+type session struct {
+	handler    *Handler
+	controller *service.Client
+	parser     resp.Parser
+}
+
+func (s *session) Serve(ctx context.Context, data []byte, w io.Writer) (int, error) {
+	consumed := 0
+	for {
+		args, n, err := s.parser.ParseCommand(data[consumed:])
+		consumed += n
+		if errors.Is(err, resp.ErrIncomplete) {
+			return consumed, nil
+		}
 		if err != nil {
-			if err := resp.Marshal(res, err.Error()); err != nil {
-				return err
-			}
-			continue
+			return consumed, s.handler.failProtocol(s.controller, w, err)
 		}
-
-		if err := h.marshalResult(res, result); err != nil {
-			return err
+		if err := s.handler.serve(ctx, s.controller, args, w); err != nil {
+			return consumed, err
 		}
 	}
 }
 
+// failProtocol replies with a protocol error, which closes the connection, because the rest of
+// the stream can't be parsed.
+func (h *Handler) failProtocol(controller *service.Client, w io.Writer, err error) error {
+	controller.MarkDirty()
+	if writeErr := resp.Marshal(w, err); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// serve runs the command of the request and writes its reply.
+func (h *Handler) serve(ctx context.Context, controller *service.Client, args [][]byte, w io.Writer) error {
+	command, err := h.parseArgs(args)
+	if err != nil {
+		// A command that can't be queued fails the whole transaction.
+		controller.MarkDirty()
+		return resp.Marshal(w, err)
+	}
+
+	result, err := controller.Run(ctx, command)
+	if err != nil {
+		return resp.Marshal(w, err)
+	}
+	return h.marshalResult(w, result)
+}
+
 func (h *Handler) marshalResult(w io.Writer, result *cmd.Result) error {
 	if len(result.Values) == 1 {
 		return resp.Marshal(w, result.Values[0])
@@ -71,26 +271,53 @@ func (h *Handler) marshalResult(w io.Writer, result *cmd.Result) error {
 	return resp.Marshal(w, result.Values)
 }
 
-func (h *Handler) parseNextCommand(r *bufio.Reader) (cmd.Command, error) {
-	data, err := resp.Unmarshal(r)
-	if err != nil {
-		return nil, err
+// parseArgs creates a command from arguments of a request, which refer to the buffer of the
+// connection. Commands may retain arguments, so they are copied into a single block.
+func (h *Handler) parseArgs(args [][]byte) (cmd.Command, error) {
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+	block := make([]byte, 0, size)
+	arr := make([]interface{}, len(args))
+	for i, arg := range args {
+		start := len(block)
+		block = append(block, arg...)
+		arr[i] = block[start:len(block):len(block)]
 	}
+	return h.parse(arr)
+}
 
-	arr, ok := data.([]interface{})
-	if !ok || len(arr) == 0 {
+// parse creates a command from its name followed by arguments.
+func (h *Handler) parse(arr []interface{}) (cmd.Command, error) {
+	if len(arr) == 0 {
 		return nil, ErrSyntax
 	}
-
 	rawName, ok := arr[0].([]byte)
 	if !ok || len(rawName) == 0 {
 		return nil, fmt.Errorf("%w: command name must not be empty string", ErrSyntax)
 	}
 	name := strings.ToUpper(string(rawName))
 
-	parser, ok := h.commands[name]
+	spec, ok := h.table.Lookup(name)
 	if !ok {
 		return nil, fmt.Errorf("%w: unknown command %s", ErrSyntax, name)
 	}
+	if !spec.CheckArity(len(arr)) {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	if len(arr) > 1 {
+		if sub, ok := arr[1].([]byte); ok {
+			if subSpec, ok := spec.Subcommand(strings.ToUpper(string(sub))); ok && !subSpec.CheckArity(len(arr)) {
+				return nil, fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, name, strings.ToUpper(string(sub)))
+			}
+		}
+	}
+
+	// Renamed commands are parsed under canonical names, so they are logged under them.
+	parser, ok := h.commands[spec.Name]
+	if !ok {
+		return h.parseModuleCommand(spec.Name, arr[1:])
+	}
 	return parser(arr[1:])
 }
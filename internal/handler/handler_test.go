@@ -0,0 +1,105 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/handler"
+	"github.com/burenotti/redis_impl/internal/service"
+	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(args ...string) []byte {
+	req := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		req = fmt.Appendf(req, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return req
+}
+
+// exchange is a request and the reply expected for it.
+type exchange struct {
+	request []string
+	reply   string
+}
+
+// assertExchanges sends requests of exchanges to a handler of a new service and checks replies.
+func assertExchanges(t *testing.T, exchanges []exchange) {
+	t.Helper()
+	redis := service.NewService([]service.Storage{memory.New()}, 1024)
+	t.Cleanup(redis.Stop)
+	h := handler.New(func() *service.Client {
+		return service.NewClient(redis)
+	})
+
+	var req, expected, res bytes.Buffer
+	for _, e := range exchanges {
+		req.Write(request(e.request...))
+		expected.WriteString(e.reply)
+	}
+	require.NoError(t, h.Handle(context.Background(), &req, &res))
+	assert.Equal(t, expected.String(), res.String())
+}
+
+func TestHandler_Handle_transactions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		exchanges []exchange
+	}{
+		{
+			name: "queuing error aborts exec",
+			exchanges: []exchange{
+				{request: []string{"MULTI"}, reply: "+OK\r\n"},
+				{request: []string{"SET", "key", "value"}, reply: "+QUEUED\r\n"},
+				{request: []string{"SET"}, reply: "-syntax error: wrong number of arguments for SET\r\n"},
+				{request: []string{"EXEC"}, reply: "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+				{request: []string{"GET", "key"}, reply: "$-1\r\n"},
+			},
+		},
+		{
+			name: "runtime errors are replied in place",
+			exchanges: []exchange{
+				{request: []string{"SET", "string", "value"}, reply: "+OK\r\n"},
+				{request: []string{"MULTI"}, reply: "+OK\r\n"},
+				{request: []string{"HSET", "string", "field", "value"}, reply: "+QUEUED\r\n"},
+				{request: []string{"SET", "key", "value"}, reply: "+QUEUED\r\n"},
+				{
+					request: []string{"EXEC"},
+					reply:   "*2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n+OK\r\n",
+				},
+				{request: []string{"GET", "key"}, reply: "$5\r\nvalue\r\n"},
+			},
+		},
+		{
+			name: "nested multi keeps transaction",
+			exchanges: []exchange{
+				{request: []string{"MULTI"}, reply: "+OK\r\n"},
+				{request: []string{"SET", "key", "value"}, reply: "+QUEUED\r\n"},
+				{request: []string{"MULTI"}, reply: "-nested MULTI calls is not supported\r\n"},
+				{request: []string{"EXEC"}, reply: "*1\r\n+OK\r\n"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			assertExchanges(t, c.exchanges)
+		})
+	}
+}
+
+// TestHandler_Handle_jsonStrAppend checks JSON.STRAPPEND without a path uses the legacy root path.
+func TestHandler_Handle_jsonStrAppend(t *testing.T) {
+	t.Parallel()
+	assertExchanges(t, []exchange{
+		{request: []string{"JSON.SET", "doc", "$", `"ab"`}, reply: "+OK\r\n"},
+		{request: []string{"JSON.STRAPPEND", "doc", `"c"`}, reply: ":3\r\n"},
+		{request: []string{"JSON.STRAPPEND", "doc", "$", `"d"`}, reply: "*1\r\n:4\r\n"},
+	})
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+func parseDel(args []interface{}) (cmd.Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.DEL)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.Del(parsed...), nil
+}
+
+func parseHSet(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 || len(parsed)%2 == 0 { //nolint:mnd // key and field value pairs
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.HSET)
+	}
+	fields := make([]cmd.HashField, 0, len(parsed)/2) //nolint:mnd // field value pairs
+	for i := 1; i < len(parsed); i += 2 {
+		fields = append(fields, cmd.HashField{Field: parsed[i], Value: []byte(parsed[i+1])})
+	}
+	return cmd.HSet(parsed[0], fields...), nil
+}
+
+func parseHGet(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 { //nolint:mnd // key and field
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.HGET)
+	}
+	return cmd.HGet(parsed[0], parsed[1]), nil
+}
+
+// parseHashFields parses commands with signature "key field [field ...]".
+func parseHashFields(name string, args []interface{}, create func(key string, fields ...string) cmd.Command,
+) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // key and field
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	return create(parsed[0], parsed[1:]...), nil
+}
+
+func parseHMGet(args []interface{}) (cmd.Command, error) {
+	return parseHashFields(cmd.HMGET, args, cmd.HMGet)
+}
+
+func parseHDel(args []interface{}) (cmd.Command, error) {
+	return parseHashFields(cmd.HDEL, args, cmd.HDel)
+}
+
+// parseHashKey parses commands with signature "key".
+func parseHashKey(name string, args []interface{}, create func(key string) cmd.Command) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	return create(parsed[0]), nil
+}
+
+func parseHGetAll(args []interface{}) (cmd.Command, error) {
+	return parseHashKey(cmd.HGETALL, args, cmd.HGetAll)
+}
+
+func parseHKeys(args []interface{}) (cmd.Command, error) {
+	return parseHashKey(cmd.HKEYS, args, cmd.HKeys)
+}
+
+func parseHVals(args []interface{}) (cmd.Command, error) {
+	return parseHashKey(cmd.HVALS, args, cmd.HVals)
+}
+
+func parseHLen(args []interface{}) (cmd.Command, error) {
+	return parseHashKey(cmd.HLEN, args, cmd.HLen)
+}
+
+func parseHExists(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 { //nolint:mnd // key and field
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.HEXISTS)
+	}
+	return cmd.HExists(parsed[0], parsed[1]), nil
+}
+
+func parseHIncrBy(args []interface{}) (cmd.Command, error) {
+	if len(args) != 3 { //nolint:mnd // key, field and increment
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.HINCRBY)
+	}
+	parsed, err := asStrings(args[:2])
+	if err != nil {
+		return nil, err
+	}
+	incr, err := parseInt(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: increment must be an integer", ErrSyntax)
+	}
+	return cmd.HIncrBy(parsed[0], parsed[1], incr), nil
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+)
+
+const (
+	jsonRootPath       = "$"
+	jsonLegacyRootPath = "."
+)
+
+func parseJSONSet(args []interface{}) (cmd.Command, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONSET)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists cmd.ExistsOpt
+	if len(parsed) == 4 { //nolint:mnd // key, path, value and condition
+		switch opt := cmd.ExistsOpt(strings.ToUpper(parsed[3])); opt {
+		case cmd.NotExists, cmd.Exists:
+			exists = opt
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s", ErrSyntax, parsed[3])
+		}
+	}
+	return cmd.JSONSet(parsed[0], parsed[1], []byte(parsed[2]), exists)
+}
+
+func parseJSONGet(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONGET)
+	}
+
+	var format jsondoc.Format
+	i := 1
+	for ; i < len(parsed); i += 2 {
+		var target *string
+		switch strings.ToUpper(parsed[i]) {
+		case "INDENT":
+			target = &format.Indent
+		case "NEWLINE":
+			target = &format.Newline
+		case "SPACE":
+			target = &format.Space
+		}
+		if target == nil {
+			break
+		}
+		if i+1 >= len(parsed) {
+			return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, parsed[i])
+		}
+		*target = parsed[i+1]
+	}
+	return cmd.JSONGet(parsed[0], format, parsed[i:]...)
+}
+
+// parseJSONKeyPath parses commands with signature "key [path]".
+func parseJSONKeyPath(name string, args []interface{}, create func(key, path string) (cmd.Command, error),
+) (cmd.Command, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	path := jsonRootPath
+	if len(parsed) == 2 { //nolint:mnd // key and path
+		path = parsed[1]
+	}
+	return create(parsed[0], path)
+}
+
+func parseJSONDel(args []interface{}) (cmd.Command, error) {
+	return parseJSONKeyPath(cmd.JSONDEL, args, cmd.JSONDel)
+}
+
+func parseJSONType(args []interface{}) (cmd.Command, error) {
+	return parseJSONKeyPath(cmd.JSONTYPE, args, cmd.JSONType)
+}
+
+func parseJSONArrLen(args []interface{}) (cmd.Command, error) {
+	return parseJSONKeyPath(cmd.JSONARRLEN, args, cmd.JSONArrLen)
+}
+
+func parseJSONObjKeys(args []interface{}) (cmd.Command, error) {
+	return parseJSONKeyPath(cmd.JSONOBJKEYS, args, cmd.JSONObjKeys)
+}
+
+func parseJSONNumIncrBy(args []interface{}) (cmd.Command, error) {
+	if len(args) != 3 { //nolint:mnd // key, path and increment
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONNUMINCRBY)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.JSONNumIncrBy(parsed[0], parsed[1], []byte(parsed[2]))
+}
+
+func parseJSONStrAppend(args []interface{}) (cmd.Command, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONSTRAPPEND)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 2 { //nolint:mnd // key and value
+		return cmd.JSONStrAppend(parsed[0], jsonLegacyRootPath, []byte(parsed[1]))
+	}
+	return cmd.JSONStrAppend(parsed[0], parsed[1], []byte(parsed[2]))
+}
+
+func parseJSONArrAppend(args []interface{}) (cmd.Command, error) {
+	if len(args) < 3 { //nolint:mnd // key, path and at least one value
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONARRAPPEND)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.JSONArrAppend(parsed[0], parsed[1], asBytes(parsed[2:])...)
+}
+
+func parseJSONArrInsert(args []interface{}) (cmd.Command, error) {
+	if len(args) < 4 { //nolint:mnd // key, path, index and at least one value
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONARRINSERT)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.Atoi(parsed[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: index must be an integer", ErrSyntax)
+	}
+	return cmd.JSONArrInsert(parsed[0], parsed[1], &index, asBytes(parsed[3:])...)
+}
+
+func parseJSONArrPop(args []interface{}) (cmd.Command, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONARRPOP)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	path := jsonRootPath
+	if len(parsed) > 1 {
+		path = parsed[1]
+	}
+	index := -1
+	if len(parsed) > 2 { //nolint:mnd // key, path and index
+		if index, err = strconv.Atoi(parsed[2]); err != nil {
+			return nil, fmt.Errorf("%w: index must be an integer", ErrSyntax)
+		}
+	}
+	return cmd.JSONArrPop(parsed[0], path, index)
+}
+
+func parseJSONMGet(args []interface{}) (cmd.Command, error) {
+	if len(args) < 2 { //nolint:mnd // at least one key and path
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.JSONMGET)
+	}
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.JSONMGet(parsed[len(parsed)-1], parsed[:len(parsed)-1]...)
+}
+
+func asBytes(values []string) [][]byte {
+	res := make([][]byte, len(values))
+	for i, v := range values {
+		res[i] = []byte(v)
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// parseModule parses MODULE LOAD path [arg ...], MODULE UNLOAD name and MODULE LIST.
+func parseModule(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.MODULE)
+	}
+	sub, rest := strings.ToUpper(parsed[0]), parsed[1:]
+	wrongArgs := fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.MODULE, sub)
+	switch sub {
+	case "LOAD":
+		if len(rest) == 0 {
+			return nil, wrongArgs
+		}
+		return cmd.ModuleLoad(rest[0], rest[1:]), nil
+	case "UNLOAD":
+		if len(rest) != 1 {
+			return nil, wrongArgs
+		}
+		return cmd.ModuleUnload(rest[0]), nil
+	case "LIST":
+		if len(rest) != 0 {
+			return nil, wrongArgs
+		}
+		return cmd.ModuleList(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown subcommand %s", ErrSyntax, parsed[0])
+}
+
+// parseModuleCommand parses a command registered by a module. Arity is checked by the command table,
+// the rest is up to the module.
+func (h *Handler) parseModuleCommand(name string, args []interface{}) (cmd.Command, error) {
+	if h.modules == nil {
+		return nil, fmt.Errorf("%w: unknown command %s", ErrSyntax, name)
+	}
+	command, ok := h.modules.Command(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown command %s", ErrSyntax, name)
+	}
+	raw := make([][]byte, len(args))
+	for i, arg := range args {
+		var ok bool
+		if raw[i], ok = arg.([]byte); !ok {
+			return nil, fmt.Errorf("%w: all arguments must be strings", ErrSyntax)
+		}
+	}
+	return cmd.ModuleCommand(command, raw), nil
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// parseEval parses EVAL script numkeys [key ...] [arg ...]. Commands called by scripts are parsed by parse.
+func parseEval(parse cmd.Parser, readOnly bool) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		script, keys, argv, err := parseScriptArgs(cmd.EVAL, args)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.Eval(script, keys, argv, readOnly, parse), nil
+	}
+}
+
+// parseEvalSHA parses EVALSHA sha1 numkeys [key ...] [arg ...].
+func parseEvalSHA(parse cmd.Parser, readOnly bool) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		sha, keys, argv, err := parseScriptArgs(cmd.EVALSHA, args)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.EvalSHA(sha, keys, argv, readOnly, parse), nil
+	}
+}
+
+// parseScriptArgs splits arguments of scripts and functions to the script, keys and other arguments.
+func parseScriptArgs(name string, args []interface{}) (script string, keys, argv []string, err error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // script and numkeys
+		return "", nil, nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	numKeys, err := parseInt(args[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w: invalid number of keys %s", ErrSyntax, parsed[1])
+	}
+	switch {
+	case numKeys < 0:
+		return "", nil, nil, cmd.ErrScriptNegNumKeys
+	case numKeys > int64(len(parsed)-2):
+		return "", nil, nil, cmd.ErrScriptNumKeys
+	}
+	rest := parsed[2:]
+	return parsed[0], rest[:numKeys], rest[numKeys:], nil
+}
+
+// parseScript parses SCRIPT LOAD script, SCRIPT EXISTS sha1 [sha1 ...], SCRIPT FLUSH [ASYNC|SYNC] and SCRIPT KILL.
+func parseScript(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.SCRIPT)
+	}
+	sub, rest := strings.ToUpper(parsed[0]), parsed[1:]
+	switch sub {
+	case "LOAD":
+		if len(rest) != 1 {
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.SCRIPT, sub)
+		}
+		return cmd.ScriptLoad(rest[0]), nil
+	case "EXISTS":
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.SCRIPT, sub)
+		}
+		return cmd.ScriptExists(rest...), nil
+	case "FLUSH":
+		// Flushing is always synchronous, so the mode is only validated.
+		if len(rest) > 1 || len(rest) == 1 && !strings.EqualFold(rest[0], "ASYNC") && !strings.EqualFold(rest[0], "SYNC") {
+			return nil, fmt.Errorf("%w: %s %s accepts ASYNC or SYNC only", ErrSyntax, cmd.SCRIPT, sub)
+		}
+		return cmd.ScriptFlush(), nil
+	case "KILL":
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.SCRIPT, sub)
+		}
+		return cmd.ScriptKill(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown subcommand %s", ErrSyntax, parsed[0])
+}
+
+// parseFCall parses FCALL function numkeys [key ...] [arg ...].
+func parseFCall(parse cmd.Parser, readOnly bool) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		function, keys, argv, err := parseScriptArgs(cmd.FCALL, args)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.FCall(function, keys, argv, readOnly, parse), nil
+	}
+}
+
+// parseFunction parses FUNCTION LOAD [REPLACE] code, FUNCTION DELETE library, FUNCTION FLUSH [ASYNC|SYNC],
+// FUNCTION LIST [LIBRARYNAME pattern] [WITHCODE], FUNCTION DUMP, FUNCTION RESTORE payload [FLUSH|APPEND|REPLACE]
+// and FUNCTION KILL.
+//
+//nolint:gocyclo // one case per subcommand
+func parseFunction(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FUNCTION)
+	}
+	sub, rest := strings.ToUpper(parsed[0]), parsed[1:]
+	wrongArgs := fmt.Errorf("%w: wrong number of arguments for %s %s", ErrSyntax, cmd.FUNCTION, sub)
+	switch sub {
+	case "LOAD":
+		replace := len(rest) == 2 && strings.EqualFold(rest[0], "REPLACE") //nolint:mnd // REPLACE and code
+		if replace {
+			rest = rest[1:]
+		}
+		if len(rest) != 1 {
+			return nil, wrongArgs
+		}
+		return cmd.FunctionLoad(rest[0], replace), nil
+	case "DELETE":
+		if len(rest) != 1 {
+			return nil, wrongArgs
+		}
+		return cmd.FunctionDelete(rest[0]), nil
+	case "FLUSH":
+		// Flushing is always synchronous, so the mode is only validated.
+		if len(rest) > 1 || len(rest) == 1 && !strings.EqualFold(rest[0], "ASYNC") && !strings.EqualFold(rest[0], "SYNC") {
+			return nil, fmt.Errorf("%w: %s %s accepts ASYNC or SYNC only", ErrSyntax, cmd.FUNCTION, sub)
+		}
+		return cmd.FunctionFlush(), nil
+	case "LIST":
+		var pattern string
+		var withCode bool
+		for i := 0; i < len(rest); i++ {
+			switch opt := strings.ToUpper(rest[i]); {
+			case opt == "WITHCODE" && !withCode:
+				withCode = true
+			case opt == "LIBRARYNAME" && pattern == "" && i+1 < len(rest):
+				i++
+				pattern = rest[i]
+			default:
+				return nil, fmt.Errorf("%w: unknown argument %s", ErrSyntax, rest[i])
+			}
+		}
+		return cmd.FunctionList(pattern, withCode), nil
+	case "DUMP":
+		if len(rest) != 0 {
+			return nil, wrongArgs
+		}
+		return cmd.FunctionDump(), nil
+	case "RESTORE":
+		if len(rest) == 0 || len(rest) > 2 { //nolint:mnd // payload and policy
+			return nil, wrongArgs
+		}
+		policy := cmd.RestoreAppend
+		if len(rest) == 2 { //nolint:mnd // payload and policy
+			policy = cmd.RestorePolicy(strings.ToUpper(rest[1]))
+			if policy != cmd.RestoreAppend && policy != cmd.RestoreReplace && policy != cmd.RestoreFlush {
+				return nil, fmt.Errorf("%w: invalid restore policy %s", ErrSyntax, rest[1])
+			}
+		}
+		return cmd.FunctionRestore([]byte(rest[0]), policy), nil
+	case "KILL":
+		if len(rest) != 0 {
+			return nil, wrongArgs
+		}
+		return cmd.FunctionKill(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown subcommand %s", ErrSyntax, parsed[0])
+}
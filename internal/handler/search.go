@@ -0,0 +1,387 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/search"
+)
+
+// parseCount parses an argument with amount of following arguments and returns them.
+func parseCount(name string, args []string, i int) ([]string, error) {
+	n, err := parseUint(name, args[i])
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(args)-i-1) {
+		return nil, fmt.Errorf("%w: not enough arguments for %s", ErrSyntax, name)
+	}
+	return args[i+1 : i+1+int(n)], nil
+}
+
+//nolint:funlen,gocognit // parsing functions can be long
+func parseFTCreate(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTCREATE)
+	}
+
+	def := search.Definition{Name: parsed[0]}
+	i := 1
+	for ; i < len(parsed); i++ {
+		opt := strings.ToUpper(parsed[i])
+		if opt == "SCHEMA" {
+			break
+		}
+		if i+1 >= len(parsed) {
+			return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+		}
+		switch opt {
+		case "ON":
+			i++
+			if strings.ToUpper(parsed[i]) != "HASH" {
+				return nil, fmt.Errorf("%w: only HASH indexes are supported", ErrSyntax)
+			}
+		case "PREFIX":
+			prefixes, err := parseCount("PREFIX", parsed, i+1)
+			if err != nil {
+				return nil, err
+			}
+			def.Prefixes = append(def.Prefixes, prefixes...)
+			i += len(prefixes) + 1
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.FTCREATE)
+		}
+	}
+	if i >= len(parsed) {
+		return nil, fmt.Errorf("%w: SCHEMA is required for %s", ErrSyntax, cmd.FTCREATE)
+	}
+
+	schema := parsed[i+1:]
+	for j := 0; j < len(schema); {
+		field := search.Field{Name: schema[j]}
+		j++
+		if j+1 < len(schema) && strings.ToUpper(schema[j]) == "AS" {
+			field.Alias = schema[j+1]
+			j += 2
+		}
+		if j >= len(schema) {
+			return nil, fmt.Errorf("%w: missing type of field %s", ErrSyntax, field.Name)
+		}
+		field.Type = search.FieldType(strings.ToUpper(schema[j]))
+		j++
+		switch field.Type {
+		case search.FieldText:
+			field.Weight = search.DefaultWeight
+		case search.FieldTag:
+			field.Separator = search.DefaultTagSeparator
+		case search.FieldNumeric:
+		case search.FieldVector:
+			if field.Vector, j, err = parseVectorOptions(schema, j); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown field type %s", ErrSyntax, schema[j-1])
+		}
+
+	options:
+		for ; j < len(schema); j++ {
+			switch opt := strings.ToUpper(schema[j]); {
+			case opt == "SORTABLE" && field.Type != search.FieldVector:
+				field.Sortable = true
+			case opt == "NOSTEM" && field.Type == search.FieldText:
+				field.NoStem = true
+			case opt == "CASESENSITIVE" && field.Type == search.FieldTag:
+				field.CaseSensitive = true
+			case opt == "WEIGHT" && field.Type == search.FieldText:
+				if j+1 >= len(schema) {
+					return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+				}
+				j++
+				if field.Weight, err = strconv.ParseFloat(schema[j], 64); err != nil {
+					return nil, fmt.Errorf("%w: weight must be a number", ErrSyntax)
+				}
+			case opt == "SEPARATOR" && field.Type == search.FieldTag:
+				if j+1 >= len(schema) {
+					return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+				}
+				j++
+				if len(schema[j]) != 1 {
+					return nil, fmt.Errorf("%w: separator must be a single character", ErrSyntax)
+				}
+				field.Separator = schema[j][0]
+			default:
+				break options
+			}
+		}
+		def.Fields = append(def.Fields, field)
+	}
+	return cmd.FTCreate(def)
+}
+
+// parseVectorOptions parses "algorithm nargs attribute value ..." of a VECTOR field
+// starting at i and returns the index of the next argument.
+func parseVectorOptions(schema []string, i int) (search.VectorOptions, int, error) {
+	opts := search.VectorOptions{
+		M:              search.DefaultM,
+		EFConstruction: search.DefaultEFConstruction,
+		EFRuntime:      search.DefaultEFRuntime,
+	}
+	if i+1 >= len(schema) {
+		return opts, i, fmt.Errorf("%w: VECTOR requires an algorithm and attributes", ErrSyntax)
+	}
+	opts.Algorithm = search.VectorAlgorithm(strings.ToUpper(schema[i]))
+	attrs, err := parseCount("VECTOR", schema, i+1)
+	if err != nil {
+		return opts, i, err
+	}
+	if len(attrs)%2 != 0 {
+		return opts, i, fmt.Errorf("%w: VECTOR attributes must be name value pairs", ErrSyntax)
+	}
+	hnsw := opts.Algorithm == search.VectorHNSW
+	for j := 0; j < len(attrs); j += 2 {
+		name, value := strings.ToUpper(attrs[j]), attrs[j+1]
+		var n uint64
+		switch name {
+		case "TYPE":
+			if strings.ToUpper(value) != "FLOAT32" {
+				return opts, i, fmt.Errorf("%w: only FLOAT32 vectors are supported", ErrSyntax)
+			}
+			continue
+		case "DISTANCE_METRIC":
+			opts.Metric = search.DistanceMetric(strings.ToUpper(value))
+			continue
+		case "DIM":
+		case "M", "EF_CONSTRUCTION", "EF_RUNTIME":
+			if !hnsw {
+				return opts, i, fmt.Errorf("%w: %s is an attribute of HNSW", ErrSyntax, name)
+			}
+		default:
+			return opts, i, fmt.Errorf("%w: invalid VECTOR attribute %s", ErrSyntax, attrs[j])
+		}
+		if n, err = parseUint(name, value); err != nil {
+			return opts, i, err
+		}
+		switch name {
+		case "DIM":
+			opts.Dim = int(n)
+		case "M":
+			opts.M = int(n)
+		case "EF_CONSTRUCTION":
+			opts.EFConstruction = int(n)
+		case "EF_RUNTIME":
+			opts.EFRuntime = int(n)
+		}
+	}
+	return opts, i + len(attrs) + 2, nil //nolint:mnd // algorithm and nargs
+}
+
+func parseFTDropIndex(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parsed) == 1:
+		return cmd.FTDropIndex(parsed[0], false), nil
+	case len(parsed) == 2 && strings.ToUpper(parsed[1]) == "DD": //nolint:mnd // index and option
+		return cmd.FTDropIndex(parsed[0], true), nil
+	default:
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTDROPINDEX)
+	}
+}
+
+func parseFTInfo(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTINFO)
+	}
+	return cmd.FTInfo(parsed[0]), nil
+}
+
+//nolint:funlen // parsing functions can be long
+func parseFTSearch(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // index and query
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTSEARCH)
+	}
+
+	opts := cmd.SearchOptions{Limit: cmd.DefaultSearchLimit}
+	for i := 2; i < len(parsed); i++ {
+		switch opt := strings.ToUpper(parsed[i]); opt {
+		case "NOCONTENT":
+			opts.NoContent = true
+		case "VERBATIM":
+			opts.Verbatim = true
+		case "RETURN":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			fields, err := parseCount(opt, parsed, i+1)
+			if err != nil {
+				return nil, err
+			}
+			// RETURN 0 replies without fields, just like NOCONTENT.
+			if len(fields) == 0 {
+				opts.NoContent = true
+			}
+			opts.Return = append([]string{}, fields...)
+			i += len(fields) + 1
+		case "SORTBY":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			i++
+			opts.SortBy = strings.TrimPrefix(parsed[i], "@")
+			if i+1 < len(parsed) {
+				switch strings.ToUpper(parsed[i+1]) {
+				case "ASC":
+					i++
+				case "DESC":
+					opts.Descending = true
+					i++
+				}
+			}
+		case "PARAMS":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			params, err := parseCount(opt, parsed, i+1)
+			if err != nil {
+				return nil, err
+			}
+			if len(params)%2 != 0 {
+				return nil, fmt.Errorf("%w: PARAMS must be name value pairs", ErrSyntax)
+			}
+			opts.Params = map[string][]byte{}
+			for j := 0; j < len(params); j += 2 {
+				opts.Params[params[j]] = []byte(params[j+1])
+			}
+			i += len(params) + 1
+		case "DIALECT":
+			// Every dialect is parsed the same way, so the version is only validated.
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			i++
+			if _, err := parseUint("dialect", parsed[i]); err != nil {
+				return nil, err
+			}
+		case "LIMIT":
+			if i+2 >= len(parsed) { //nolint:mnd // offset and number
+				return nil, fmt.Errorf("%w: need offset and number for %s", ErrSyntax, opt)
+			}
+			offset, err := parseUint("offset", parsed[i+1])
+			if err != nil {
+				return nil, err
+			}
+			limit, err := parseUint("number", parsed[i+2])
+			if err != nil {
+				return nil, err
+			}
+			opts.Offset, opts.Limit = int64(offset), int64(limit)
+			i += 2
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.FTSEARCH)
+		}
+	}
+	return cmd.FTSearch(parsed[0], parsed[1], opts)
+}
+
+func parseFTSugAdd(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 { //nolint:mnd // key, string and score
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTSUGADD)
+	}
+	score, err := parseTSFloat("score", parsed[2])
+	if err != nil {
+		return nil, err
+	}
+	incr := false
+	var payload []byte
+	for i := 3; i < len(parsed); i++ {
+		switch opt := strings.ToUpper(parsed[i]); opt {
+		case "INCR":
+			incr = true
+		case "PAYLOAD":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			i++
+			payload = []byte(parsed[i])
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.FTSUGADD)
+		}
+	}
+	return cmd.FTSugAdd(parsed[0], parsed[1], score, incr, payload)
+}
+
+func parseFTSugGet(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // key and prefix
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTSUGGET)
+	}
+	opts := cmd.SugGetOptions{Max: search.DefaultMaxSuggestions}
+	for i := 2; i < len(parsed); i++ {
+		switch opt := strings.ToUpper(parsed[i]); opt {
+		case "FUZZY":
+			opts.Fuzzy = true
+		case "WITHSCORES":
+			opts.WithScores = true
+		case "WITHPAYLOADS":
+			opts.WithPayloads = true
+		case "MAX":
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for %s", ErrSyntax, opt)
+			}
+			i++
+			n, err := parseUint("max", parsed[i])
+			if err != nil {
+				return nil, err
+			}
+			opts.Max = int64(n)
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.FTSUGGET)
+		}
+	}
+	return cmd.FTSugGet(parsed[0], parsed[1], opts)
+}
+
+func parseFTSugDel(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 { //nolint:mnd // key and string
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTSUGDEL)
+	}
+	return cmd.FTSugDel(parsed[0], parsed[1]), nil
+}
+
+func parseFTSugLen(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.FTSUGLEN)
+	}
+	return cmd.FTSugLen(parsed[0]), nil
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/topk"
+)
+
+func parseCMSInitByDim(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 3 { //nolint:mnd // key, width and depth
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CMSINITBYDIM)
+	}
+	width, err := parseUint("width", parsed[1])
+	if err != nil {
+		return nil, err
+	}
+	depth, err := parseUint("depth", parsed[2])
+	if err != nil {
+		return nil, err
+	}
+	return cmd.CMSInitByDim(parsed[0], width, depth)
+}
+
+func parseCMSInitByProb(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 3 { //nolint:mnd // key, error and probability
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CMSINITBYPROB)
+	}
+	errorRate, err := strconv.ParseFloat(parsed[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error must be a number", ErrSyntax)
+	}
+	probability, err := strconv.ParseFloat(parsed[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: probability must be a number", ErrSyntax)
+	}
+	return cmd.CMSInitByProb(parsed[0], errorRate, probability)
+}
+
+func parseCMSIncrBy(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 || len(parsed)%2 != 1 { //nolint:mnd // key and item-increment pairs
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CMSINCRBY)
+	}
+	increments := make([]cmd.CMSIncrement, 0, len(parsed)/2) //nolint:mnd // item-increment pairs
+	for i := 1; i < len(parsed); i += 2 {
+		value, err := parseUint("increment", parsed[i+1])
+		if err != nil {
+			return nil, err
+		}
+		increments = append(increments, cmd.CMSIncrement{Item: []byte(parsed[i]), Value: value})
+	}
+	return cmd.CMSIncrBy(parsed[0], increments...), nil
+}
+
+func parseCMSQuery(args []interface{}) (cmd.Command, error) {
+	return parseKeyItems(cmd.CMSQUERY, args, cmd.CMSQuery)
+}
+
+func parseCMSMerge(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 { //nolint:mnd // destination, amount of keys and a source
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CMSMERGE)
+	}
+	n, err := parseUint("numKeys", parsed[1])
+	if err != nil {
+		return nil, err
+	}
+	rest := parsed[2:]
+	if n == 0 || n > uint64(len(rest)) {
+		return nil, fmt.Errorf("%w: wrong number of keys for %s", ErrSyntax, cmd.CMSMERGE)
+	}
+	sources, rest := rest[:n], rest[n:]
+
+	var weights []uint64
+	if len(rest) > 0 {
+		if strings.ToUpper(rest[0]) != "WEIGHTS" || uint64(len(rest)-1) != n {
+			return nil, fmt.Errorf("%w: invalid arguments for %s", ErrSyntax, cmd.CMSMERGE)
+		}
+		weights = make([]uint64, n)
+		for i, w := range rest[1:] {
+			if weights[i], err = parseUint("weight", w); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cmd.CMSMerge(parsed[0], sources, weights)
+}
+
+func parseTopKReserve(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 2 && len(parsed) != 5 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TOPKRESERVE)
+	}
+	opts := topk.Options{Width: topk.DefaultWidth, Depth: topk.DefaultDepth, Decay: topk.DefaultDecay}
+	if opts.K, err = parseUint("topk", parsed[1]); err != nil {
+		return nil, err
+	}
+	if len(parsed) == 5 { //nolint:mnd // with width, depth and decay
+		if opts.Width, err = parseUint("width", parsed[2]); err != nil {
+			return nil, err
+		}
+		if opts.Depth, err = parseUint("depth", parsed[3]); err != nil {
+			return nil, err
+		}
+		if opts.Decay, err = strconv.ParseFloat(parsed[4], 64); err != nil {
+			return nil, fmt.Errorf("%w: decay must be a number", ErrSyntax)
+		}
+	}
+	return cmd.TopKReserve(parsed[0], opts)
+}
+
+func parseTopKAdd(args []interface{}) (cmd.Command, error) {
+	return parseKeyItems(cmd.TOPKADD, args, cmd.TopKAdd)
+}
+
+func parseTopKIncrBy(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 || len(parsed)%2 != 1 { //nolint:mnd // key and item-increment pairs
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TOPKINCRBY)
+	}
+	increments := make([]cmd.TopKIncrement, 0, len(parsed)/2) //nolint:mnd // item-increment pairs
+	for i := 1; i < len(parsed); i += 2 {
+		value, err := parseUint("increment", parsed[i+1])
+		if err != nil {
+			return nil, err
+		}
+		increments = append(increments, cmd.TopKIncrement{Item: []byte(parsed[i]), Value: value})
+	}
+	return cmd.TopKIncrBy(parsed[0], increments...), nil
+}
+
+func parseTopKQuery(args []interface{}) (cmd.Command, error) {
+	return parseKeyItems(cmd.TOPKQUERY, args, cmd.TopKQuery)
+}
+
+func parseTopKList(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parsed) == 1:
+		return cmd.TopKList(parsed[0], false), nil
+	case len(parsed) == 2 && strings.ToUpper(parsed[1]) == "WITHCOUNT": //nolint:mnd // key and option
+		return cmd.TopKList(parsed[0], true), nil
+	default:
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TOPKLIST)
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/algo/tdigest"
+)
+
+// parseTDigestKey parses commands with signature "key".
+func parseTDigestKey(name string, args []interface{}, create func(key string) cmd.Command) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	return create(parsed[0]), nil
+}
+
+// parseTDigestValues parses commands with signature "key value [value ...]".
+func parseTDigestValues(name string, args []interface{}, create func(key string, values ...float64) (cmd.Command, error),
+) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // key and value
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	values := make([]float64, len(parsed)-1)
+	for i, v := range parsed[1:] {
+		if values[i], err = parseTSFloat("value", v); err != nil {
+			return nil, err
+		}
+	}
+	return create(parsed[0], values...)
+}
+
+func parseTDigestCreate(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parsed) == 1:
+		return cmd.TDigestCreate(parsed[0], tdigest.DefaultCompression)
+	case len(parsed) == 3 && strings.ToUpper(parsed[1]) == "COMPRESSION": //nolint:mnd // key and option
+		compression, err := parseUint("compression", parsed[2])
+		if err != nil {
+			return nil, err
+		}
+		return cmd.TDigestCreate(parsed[0], compression)
+	default:
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TDIGESTCREATE)
+	}
+}
+
+func parseTDigestAdd(args []interface{}) (cmd.Command, error) {
+	return parseTDigestValues(cmd.TDIGESTADD, args, cmd.TDigestAdd)
+}
+
+func parseTDigestReset(args []interface{}) (cmd.Command, error) {
+	return parseTDigestKey(cmd.TDIGESTRESET, args, cmd.TDigestReset)
+}
+
+func parseTDigestMerge(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 { //nolint:mnd // destination, amount of keys and a source
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TDIGESTMERGE)
+	}
+	n, err := parseUint("numkeys", parsed[1])
+	if err != nil {
+		return nil, err
+	}
+	rest := parsed[2:]
+	if n == 0 || n > uint64(len(rest)) {
+		return nil, fmt.Errorf("%w: wrong number of keys for %s", ErrSyntax, cmd.TDIGESTMERGE)
+	}
+	sources, rest := rest[:n], rest[n:]
+
+	var compression uint64
+	override := false
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToUpper(rest[i]) {
+		case "COMPRESSION":
+			if i+1 == len(rest) {
+				return nil, fmt.Errorf("%w: compression value is missing", ErrSyntax)
+			}
+			i++
+			if compression, err = parseUint("compression", rest[i]); err != nil {
+				return nil, err
+			}
+			if compression == 0 {
+				return nil, fmt.Errorf("%w: compression must be positive", ErrSyntax)
+			}
+		case "OVERRIDE":
+			override = true
+		default:
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, rest[i], cmd.TDIGESTMERGE)
+		}
+	}
+	return cmd.TDigestMerge(parsed[0], sources, compression, override)
+}
+
+func parseTDigestQuantile(args []interface{}) (cmd.Command, error) {
+	return parseTDigestValues(cmd.TDIGESTQUANTILE, args, cmd.TDigestQuantile)
+}
+
+func parseTDigestCDF(args []interface{}) (cmd.Command, error) {
+	return parseTDigestValues(cmd.TDIGESTCDF, args, func(key string, values ...float64) (cmd.Command, error) {
+		return cmd.TDigestCDF(key, values...), nil
+	})
+}
+
+func parseTDigestRank(reverse bool) func(args []interface{}) (cmd.Command, error) {
+	name := cmd.TDIGESTRANK
+	if reverse {
+		name = cmd.TDIGESTREVRANK
+	}
+	return func(args []interface{}) (cmd.Command, error) {
+		return parseTDigestValues(name, args, func(key string, values ...float64) (cmd.Command, error) {
+			return cmd.TDigestRank(key, reverse, values...), nil
+		})
+	}
+}
+
+func parseTDigestByRank(reverse bool) func(args []interface{}) (cmd.Command, error) {
+	name := cmd.TDIGESTBYRANK
+	if reverse {
+		name = cmd.TDIGESTBYREVRANK
+	}
+	return func(args []interface{}) (cmd.Command, error) {
+		parsed, err := asStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) < 2 { //nolint:mnd // key and rank
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+		}
+		ranks := make([]int64, len(parsed)-1)
+		for i, v := range parsed[1:] {
+			if ranks[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: rank must be an integer", ErrSyntax)
+			}
+		}
+		return cmd.TDigestByRank(parsed[0], reverse, ranks...)
+	}
+}
+
+func parseTDigestMin(args []interface{}) (cmd.Command, error) {
+	return parseTDigestKey(cmd.TDIGESTMIN, args, cmd.TDigestMin)
+}
+
+func parseTDigestMax(args []interface{}) (cmd.Command, error) {
+	return parseTDigestKey(cmd.TDIGESTMAX, args, cmd.TDigestMax)
+}
+
+func parseTDigestTrimmedMean(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 3 { //nolint:mnd // key, low and high cut
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TDIGESTTRIMMEDMEAN)
+	}
+	low, err := parseTSFloat("low_cut_quantile", parsed[1])
+	if err != nil {
+		return nil, err
+	}
+	high, err := parseTSFloat("high_cut_quantile", parsed[2])
+	if err != nil {
+		return nil, err
+	}
+	return cmd.TDigestTrimmedMean(parsed[0], low, high)
+}
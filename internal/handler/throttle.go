@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// parseCLThrottle parses CL.THROTTLE key max_burst count period [quantity] [AT unix-time-ns].
+func parseCLThrottle(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 4 { //nolint:mnd // key, max burst, count and period
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CLTHROTTLE)
+	}
+	opts := cmd.ThrottleOptions{Quantity: 1}
+	var period int64
+	for i, dst := range []*int64{&opts.MaxBurst, &opts.Count, &period} {
+		if *dst, err = parseInt(args[i+1]); err != nil {
+			return nil, fmt.Errorf("%w: invalid integer %s", ErrSyntax, parsed[i+1])
+		}
+	}
+	if period > int64(time.Duration(1<<63-1)/time.Second) {
+		return nil, fmt.Errorf("%w: period is too large", ErrSyntax)
+	}
+	opts.Period = time.Duration(period) * time.Second
+
+	rest := parsed[4:]
+	if len(rest) > 0 && !strings.EqualFold(rest[0], "AT") {
+		if opts.Quantity, err = parseInt(args[4]); err != nil {
+			return nil, fmt.Errorf("%w: invalid quantity %s", ErrSyntax, rest[0])
+		}
+		rest = rest[1:]
+	}
+	var now *int64
+	switch {
+	case len(rest) == 2 && strings.EqualFold(rest[0], "AT"): //nolint:mnd // AT and time
+		at, err := parseInt(args[len(args)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time %s", ErrSyntax, rest[1])
+		}
+		now = &at
+	case len(rest) > 0:
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.CLTHROTTLE)
+	}
+	return cmd.CLThrottle(parsed[0], opts, now)
+}
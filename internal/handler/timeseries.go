@@ -0,0 +1,445 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+)
+
+func parseTSInt(name, value string) (int64, error) {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be an integer", ErrSyntax, name)
+	}
+	return v, nil
+}
+
+func parseTSFloat(name, value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, fmt.Errorf("%w: %s must be a number", ErrSyntax, name)
+	}
+	return v, nil
+}
+
+// parseTSTimestamp parses a timestamp of a new sample, where "*" means current time.
+func parseTSTimestamp(value string) (*int64, error) {
+	if value == "*" {
+		return nil, nil
+	}
+	ts, err := parseTSInt("timestamp", value)
+	if err != nil {
+		return nil, err
+	}
+	if ts < 0 {
+		return nil, fmt.Errorf("%w: timestamp must not be negative", ErrSyntax)
+	}
+	return &ts, nil
+}
+
+// parseTSOption parses a series creation option at args[i] and returns index of the next argument.
+// ok is false if args[i] is not a creation option.
+func parseTSOption(args []string, i int, opts *timeseries.Options) (next int, ok bool, err error) {
+	name := strings.ToUpper(args[i])
+	switch name {
+	case "RETENTION", "CHUNK_SIZE", "DUPLICATE_POLICY", "ENCODING":
+	case "LABELS":
+		labels := args[i+1:]
+		if len(labels) == 0 || len(labels)%2 != 0 {
+			return 0, true, fmt.Errorf("%w: LABELS must be followed by label-value pairs", ErrSyntax)
+		}
+		opts.Labels = nil
+		for j := 0; j < len(labels); j += 2 {
+			opts.Labels = append(opts.Labels, timeseries.Label{Name: labels[j], Value: labels[j+1]})
+		}
+		return len(args), true, nil
+	default:
+		return i, false, nil
+	}
+
+	if i+1 >= len(args) {
+		return 0, true, fmt.Errorf("%w: need value for %s", ErrSyntax, name)
+	}
+	value := args[i+1]
+	switch name {
+	case "RETENTION":
+		if opts.Retention, err = parseTSInt(name, value); err == nil && opts.Retention < 0 {
+			err = fmt.Errorf("%w: %s must not be negative", ErrSyntax, name)
+		}
+	case "CHUNK_SIZE":
+		var size int64
+		if size, err = parseTSInt(name, value); err == nil && size <= 0 {
+			err = fmt.Errorf("%w: %s must be positive", ErrSyntax, name)
+		}
+		opts.ChunkSize = int(size)
+	case "DUPLICATE_POLICY":
+		opts.DuplicatePolicy, err = timeseries.ParseDuplicatePolicy(value)
+	case "ENCODING":
+		// Chunks are always compressed, uncompressed encoding is accepted for compatibility.
+		switch strings.ToUpper(value) {
+		case "COMPRESSED", "UNCOMPRESSED":
+		default:
+			err = fmt.Errorf("%w: unknown encoding %s", ErrSyntax, value)
+		}
+	}
+	return i + 2, true, err //nolint:mnd // option and its value
+}
+
+func parseTSOptions(name string, args []string, i int, opts *timeseries.Options) error {
+	for i < len(args) {
+		next, ok, err := parseTSOption(args, i, opts)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, args[i], name)
+		}
+		i = next
+	}
+	return nil
+}
+
+func parseTSCreate(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSCREATE)
+	}
+	var opts timeseries.Options
+	if err := parseTSOptions(cmd.TSCREATE, parsed, 1, &opts); err != nil {
+		return nil, err
+	}
+	return cmd.TSCreate(parsed[0], opts), nil
+}
+
+func parseTSAdd(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 3 { //nolint:mnd // key, timestamp and value
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSADD)
+	}
+	ts, err := parseTSTimestamp(parsed[1])
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseTSFloat("value", parsed[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var opts timeseries.Options
+	var policy timeseries.DuplicatePolicy
+	for i := 3; i < len(parsed); {
+		if strings.ToUpper(parsed[i]) == "ON_DUPLICATE" {
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for ON_DUPLICATE", ErrSyntax)
+			}
+			if policy, err = timeseries.ParseDuplicatePolicy(parsed[i+1]); err != nil {
+				return nil, err
+			}
+			i += 2
+			continue
+		}
+		next, ok, err := parseTSOption(parsed, i, &opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.TSADD)
+		}
+		i = next
+	}
+	return cmd.TSAdd(parsed[0], ts, value, policy, opts), nil
+}
+
+func parseTSMAdd(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 || len(parsed)%3 != 0 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSMADD)
+	}
+	samples := make([]cmd.TSSample, 0, len(parsed)/3) //nolint:mnd // key, timestamp and value
+	for i := 0; i < len(parsed); i += 3 {
+		ts, err := parseTSTimestamp(parsed[i+1])
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseTSFloat("value", parsed[i+2])
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, cmd.TSSample{Key: parsed[i], Timestamp: ts, Value: value})
+	}
+	return cmd.TSMAdd(samples...), nil
+}
+
+func parseTSIncrBy(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 { //nolint:mnd // key and increment
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSINCRBY)
+	}
+	incr, err := parseTSFloat("increment", parsed[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var opts timeseries.Options
+	var ts *int64
+	for i := 2; i < len(parsed); {
+		if strings.ToUpper(parsed[i]) == "TIMESTAMP" {
+			if i+1 >= len(parsed) {
+				return nil, fmt.Errorf("%w: need value for TIMESTAMP", ErrSyntax)
+			}
+			if ts, err = parseTSTimestamp(parsed[i+1]); err != nil {
+				return nil, err
+			}
+			i += 2
+			continue
+		}
+		next, ok, err := parseTSOption(parsed, i, &opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, parsed[i], cmd.TSINCRBY)
+		}
+		i = next
+	}
+	return cmd.TSIncrBy(parsed[0], incr, ts, opts), nil
+}
+
+func parseTSGet(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSGET)
+	}
+	return cmd.TSGet(parsed[0]), nil
+}
+
+// parseTSRangeBound parses a range bound, where "-" is the minimal and "+" is the maximal timestamp.
+func parseTSRangeBound(value string) (int64, error) {
+	switch value {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	default:
+		return parseTSInt("timestamp", value)
+	}
+}
+
+// parseTSQueryOption parses a range query option at args[i] and returns index of the next argument.
+// ok is false if args[i] is not a query option.
+func parseTSQueryOption(args []string, i int, q *timeseries.Query) (next int, ok bool, err error) {
+	name := strings.ToUpper(args[i])
+	need := func(n int) error {
+		if i+n >= len(args) {
+			return fmt.Errorf("%w: need value for %s", ErrSyntax, name)
+		}
+		return nil
+	}
+
+	switch name {
+	case "LATEST":
+		// There are no unfinished compaction buckets exposed, so LATEST doesn't change the result.
+		return i + 1, true, nil
+	case "FILTER_BY_TS":
+		next = i + 1
+		for ; next < len(args); next++ {
+			ts, err := strconv.ParseInt(args[next], 10, 64)
+			if err != nil {
+				break
+			}
+			q.FilterByTS = append(q.FilterByTS, ts)
+		}
+		if len(q.FilterByTS) == 0 {
+			return 0, true, need(1)
+		}
+		return next, true, nil
+	case "FILTER_BY_VALUE":
+		if err := need(2); err != nil { //nolint:mnd // min and max
+			return 0, true, err
+		}
+		q.FilterByValue = true
+		if q.MinValue, err = parseTSFloat(name, args[i+1]); err != nil {
+			return 0, true, err
+		}
+		q.MaxValue, err = parseTSFloat(name, args[i+2])
+		return i + 3, true, err //nolint:mnd // option, min and max
+	case "COUNT":
+		if err := need(1); err != nil {
+			return 0, true, err
+		}
+		count, err := parseTSInt(name, args[i+1])
+		if err == nil && count <= 0 {
+			err = fmt.Errorf("%w: %s must be positive", ErrSyntax, name)
+		}
+		q.Count = int(count)
+		return i + 2, true, err //nolint:mnd // option and its value
+	case "ALIGN":
+		if err := need(1); err != nil {
+			return 0, true, err
+		}
+		switch strings.ToLower(args[i+1]) {
+		case "-", "start":
+			q.Align = q.From
+		case "+", "end":
+			q.Align = q.To
+		default:
+			q.Align, err = parseTSInt(name, args[i+1])
+		}
+		return i + 2, true, err //nolint:mnd // option and its value
+	case "AGGREGATION":
+		if err := need(2); err != nil { //nolint:mnd // type and bucket duration
+			return 0, true, err
+		}
+		if q.Aggregation, err = timeseries.ParseAggregation(args[i+1]); err != nil {
+			return 0, true, err
+		}
+		q.BucketDuration, err = parseTSInt("bucket duration", args[i+2])
+		if err == nil && q.BucketDuration <= 0 {
+			err = fmt.Errorf("%w: bucket duration must be positive", ErrSyntax)
+		}
+		return i + 3, true, err //nolint:mnd // option, type and bucket duration
+	default:
+		return i, false, nil
+	}
+}
+
+func parseTSRangeArgs(name string, args []string) (timeseries.Query, []string, error) {
+	var q timeseries.Query
+	if len(args) < 2 { //nolint:mnd // from and to
+		return q, nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+	}
+	var err error
+	if q.From, err = parseTSRangeBound(args[0]); err != nil {
+		return q, nil, err
+	}
+	if q.To, err = parseTSRangeBound(args[1]); err != nil {
+		return q, nil, err
+	}
+
+	var rest []string
+	for i := 2; i < len(args); {
+		next, ok, err := parseTSQueryOption(args, i, &q)
+		if err != nil {
+			return q, nil, err
+		}
+		if !ok {
+			rest = append(rest, args[i])
+			i++
+			continue
+		}
+		i = next
+	}
+	if q.Align != 0 && q.Aggregation == "" {
+		return q, nil, fmt.Errorf("%w: ALIGN requires AGGREGATION", ErrSyntax)
+	}
+	return q, rest, nil
+}
+
+func parseTSRange(name string, reverse bool) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		parsed, err := asStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) == 0 {
+			return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, name)
+		}
+		q, rest, err := parseTSRangeArgs(name, parsed[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, rest[0], name)
+		}
+		q.Reverse = reverse
+		return cmd.TSRange(parsed[0], q), nil
+	}
+}
+
+func parseTSMRange(name string, reverse bool) func([]interface{}) (cmd.Command, error) {
+	return func(args []interface{}) (cmd.Command, error) {
+		parsed, err := asStrings(args)
+		if err != nil {
+			return nil, err
+		}
+
+		// FILTER consumes all the remaining arguments.
+		filterAt := -1
+		for i, arg := range parsed {
+			if i >= 2 && strings.ToUpper(arg) == "FILTER" { //nolint:mnd // from and to
+				filterAt = i
+				break
+			}
+		}
+		if filterAt < 0 {
+			return nil, fmt.Errorf("%w: FILTER is required for %s", ErrSyntax, name)
+		}
+
+		q, rest, err := parseTSRangeArgs(name, parsed[:filterAt])
+		if err != nil {
+			return nil, err
+		}
+		q.Reverse = reverse
+		withLabels := false
+		for _, arg := range rest {
+			if strings.ToUpper(arg) != "WITHLABELS" {
+				return nil, fmt.Errorf("%w: invalid argument %s for %s", ErrSyntax, arg, name)
+			}
+			withLabels = true
+		}
+
+		var filter []timeseries.Matcher
+		for _, expr := range parsed[filterAt+1:] {
+			m, err := timeseries.ParseMatcher(expr)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, m)
+		}
+		return cmd.TSMRange(q, filter, withLabels)
+	}
+}
+
+func parseTSCreateRule(args []interface{}) (cmd.Command, error) {
+	parsed, err := asStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if (len(parsed) != 5 && len(parsed) != 6) || strings.ToUpper(parsed[2]) != "AGGREGATION" {
+		return nil, fmt.Errorf("%w: wrong number of arguments for %s", ErrSyntax, cmd.TSCREATERULE)
+	}
+	agg, err := timeseries.ParseAggregation(parsed[3])
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := parseTSInt("bucket duration", parsed[4])
+	if err != nil {
+		return nil, err
+	}
+	var align int64
+	if len(parsed) == 6 { //nolint:mnd // with align timestamp
+		if align, err = parseTSInt("align timestamp", parsed[5]); err != nil {
+			return nil, err
+		}
+	}
+	return cmd.TSCreateRule(parsed[0], parsed[1], agg, bucket, align)
+}
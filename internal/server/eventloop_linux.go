@@ -0,0 +1,610 @@
+//go:build linux
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// eventLoopBufferSize is the size of the read buffer of a loop, which bounds data of
+	// a connection read per wakeup.
+	eventLoopBufferSize = 64 << 10
+	// maxKeptPending is the capacity of the request buffer a connection keeps between requests.
+	maxKeptPending = 4 << 10
+	// eventLoopEvents is the maximum number of events handled per wait.
+	eventLoopEvents = 256
+	// eventLoopWaitTimeout is how often loops check whether the server is stopped.
+	eventLoopWaitTimeout = 100 * time.Millisecond
+	// maxUnsentReplies is the size of replies not accepted by a socket yet, after which requests of
+	// the connection aren't read until the client reads the replies.
+	maxUnsentReplies = 1 << 20
+
+	// epollET is syscall.EPOLLET, which is declared negative, as an event mask.
+	epollET = syscall.EPOLLET & 0xffffffff
+)
+
+// runEventLoops serves connections by event loops, each of them waits for events of its
+// connections by edge-triggered epoll and passes their requests to workers. The listener is shared
+// by all loops, and connections stay in the loop which has accepted them.
+func (s *Server) runEventLoops(addr string) error {
+	handler, ok := s.Handler.(ConnHandler)
+	if !ok {
+		return fmt.Errorf("%w: %T doesn't implement ConnHandler", ErrEventLoopUnsupported, s.Handler)
+	}
+	lis, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	loops := make([]*eventLoop, s.EventLoops)
+	lis.refs.Store(int32(len(loops)))
+	for i := range loops {
+		if loops[i], err = newEventLoop(s, handler, lis); err != nil {
+			for _, loop := range loops[:i] {
+				loop.close()
+			}
+			for range loops[i:] {
+				lis.release()
+			}
+			return err
+		}
+	}
+
+	s.workers.Add(len(loops))
+	for _, loop := range loops {
+		go loop.run()
+	}
+	s.Logger.Info("Server has started", "addr", lis.addr, "event_loops", len(loops))
+	<-s.softDone
+	return nil
+}
+
+// loopListener is a non-blocking listening socket shared by event loops.
+type loopListener struct {
+	fd   int
+	addr net.Addr
+	// refs is the number of loops waiting for connections, the last one closes the socket.
+	refs atomic.Int32
+}
+
+func listen(addr string) (*loopListener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	family, sa := sockaddr(tcpAddr)
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+	lis := &loopListener{fd: fd}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		lis.release()
+		return nil, fmt.Errorf("setsockopt: %w", err)
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		lis.release()
+		return nil, fmt.Errorf("bind %s: %w", addr, err)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		lis.release()
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	local, err := syscall.Getsockname(fd)
+	if err != nil {
+		lis.release()
+		return nil, fmt.Errorf("getsockname: %w", err)
+	}
+	lis.addr = tcpAddrOf(local)
+	return lis, nil
+}
+
+// release closes the socket once no loop waits for connections.
+func (l *loopListener) release() {
+	if l.refs.Add(-1) <= 0 {
+		_ = syscall.Close(l.fd)
+	}
+}
+
+type eventLoop struct {
+	server  *Server
+	handler ConnHandler
+	epfd    int
+	// poller owns epfd, which is registered in the runtime poller.
+	poller     *os.File
+	pollerConn syscall.RawConn
+	listener   *loopListener
+	// listening is cleared once the loop stops accepting connections.
+	listening bool
+	conns     map[int]*loopConn
+	events    []syscall.EpollEvent
+	// readBuf is shared by connections of the loop. Connections keep data only while requests are
+	// served or incomplete, or the socket doesn't accept replies.
+	readBuf []byte
+
+	// wakeR and wakeW are ends of a pipe, which wakes the loop once workers have served requests.
+	wakeR, wakeW int
+	mu           sync.Mutex
+	// served are results of workers not handled by the loop yet.
+	served  []served
+	workers sync.WaitGroup
+}
+
+// served is the result of a worker serving requests of a connection.
+type served struct {
+	conn     *loopConn
+	consumed int
+	replies  *bytes.Buffer
+	// written is the number of bytes of replies the worker has written itself.
+	written int
+	// broken is set if the worker has failed to write to the socket.
+	broken bool
+	err    error
+}
+
+// replyBuffers are buffers of replies of workers.
+var replyBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+type loopConn struct {
+	fd      int
+	session Session
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// pending are requests not served yet, the last one may be incomplete.
+	pending []byte
+	// unsent are replies not accepted by the socket yet.
+	unsent []byte
+	// serving is set while a worker serves requests of the connection. The connection isn't read
+	// meanwhile, so requests are served in order.
+	serving bool
+	// paused is set while requests aren't read because of too many unsent replies or requests
+	// being served.
+	paused bool
+	// closing is set when no more requests are served, the connection is closed once replies are sent.
+	closing bool
+	// closed is set when the connection is closed while it is served. The worker may write to its
+	// socket, so the socket is closed once the worker is done, or its descriptor could be reused.
+	closed bool
+}
+
+func newEventLoop(s *Server, handler ConnHandler, lis *loopListener) (*eventLoop, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("epoll_create1: %w", err)
+	}
+	// A non-blocking descriptor is registered in the runtime poller by os.NewFile.
+	if err := syscall.SetNonblock(epfd, true); err != nil {
+		_ = syscall.Close(epfd)
+		return nil, fmt.Errorf("set nonblock: %w", err)
+	}
+	poller := os.NewFile(uintptr(epfd), "epoll")
+	pollerConn, err := poller.SyscallConn()
+	if err != nil {
+		_ = poller.Close()
+		return nil, err
+	}
+	event := &syscall.EpollEvent{Events: syscall.EPOLLIN | epollET, Fd: int32(lis.fd)}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, lis.fd, event); err != nil {
+		_ = poller.Close()
+		return nil, fmt.Errorf("epoll_ctl: %w", err)
+	}
+	var wake [2]int
+	if err := syscall.Pipe2(wake[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		_ = poller.Close()
+		return nil, fmt.Errorf("pipe2: %w", err)
+	}
+	event = &syscall.EpollEvent{Events: syscall.EPOLLIN | epollET, Fd: int32(wake[0])}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, wake[0], event); err != nil {
+		_ = syscall.Close(wake[0])
+		_ = syscall.Close(wake[1])
+		_ = poller.Close()
+		return nil, fmt.Errorf("epoll_ctl: %w", err)
+	}
+	return &eventLoop{
+		server:     s,
+		handler:    handler,
+		epfd:       epfd,
+		poller:     poller,
+		pollerConn: pollerConn,
+		listener:   lis,
+		listening:  true,
+		conns:      make(map[int]*loopConn),
+		events:     make([]syscall.EpollEvent, eventLoopEvents),
+		readBuf:    make([]byte, eventLoopBufferSize),
+		wakeR:      wake[0],
+		wakeW:      wake[1],
+	}, nil
+}
+
+// run serves connections until the server is stopped. After a soft stop the loop doesn't accept
+// connections and exits once accepted ones are closed, after a hard stop it closes them at once.
+func (l *eventLoop) run() {
+	defer l.server.workers.Done()
+	defer l.close()
+
+	softDone := l.server.softDone
+	for {
+		select {
+		case <-l.server.hardDone:
+			return
+		case <-softDone:
+			l.stopListening()
+			softDone = nil
+		default:
+		}
+		if !l.listening && len(l.conns) == 0 {
+			return
+		}
+
+		n, err := l.wait()
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			l.server.Logger.Error("failed to wait for events", "error", err)
+			return
+		}
+		for _, event := range l.events[:n] {
+			fd := int(event.Fd)
+			if fd == l.wakeR {
+				l.complete()
+			} else if l.listening && fd == l.listener.fd {
+				l.accept()
+			} else if c, ok := l.conns[fd]; ok {
+				l.handle(c, event.Events)
+			}
+		}
+	}
+}
+
+// wait waits for events. A goroutine blocked in a syscall holds its P until the runtime retakes it,
+// which delays other goroutines by tens of microseconds, so the loop parks in the runtime poller
+// until its epoll descriptor is readable, which it is once events are ready.
+func (l *eventLoop) wait() (int, error) {
+	if err := l.poller.SetReadDeadline(time.Now().Add(eventLoopWaitTimeout)); err != nil {
+		return 0, err
+	}
+	var n int
+	var waitErr error
+	err := l.pollerConn.Read(func(fd uintptr) bool {
+		n, waitErr = syscall.EpollWait(int(fd), l.events, 0)
+		return n > 0 || waitErr != nil
+	})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, waitErr
+}
+
+func (l *eventLoop) accept() {
+	for {
+		fd, remote, err := syscall.Accept4(l.listener.fd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		switch {
+		case errors.Is(err, syscall.EAGAIN):
+			return
+		case errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.ECONNABORTED):
+			continue
+		case err != nil:
+			l.server.Logger.Info("failed to accept connection", "error", err)
+			return
+		}
+		if l.server.MaxConnections > 0 && l.server.connCount.Load() >= int64(l.server.MaxConnections) {
+			// The socket is new, so the reply fits its buffer.
+			_, _ = syscall.Write(fd, []byte("-ERR max number of clients reached\r\n"))
+			_ = syscall.Close(fd)
+			continue
+		}
+		if err := l.register(fd, remote); err != nil {
+			l.server.Logger.Warn("failed to register connection", "error", err)
+			_ = syscall.Close(fd)
+		}
+	}
+}
+
+func (l *eventLoop) register(fd int, remote syscall.Sockaddr) error {
+	// Replies are written as a whole, so they don't need to be coalesced.
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1); err != nil {
+		return fmt.Errorf("setsockopt: %w", err)
+	}
+	local, err := syscall.Getsockname(fd)
+	if err != nil {
+		return fmt.Errorf("getsockname: %w", err)
+	}
+	event := &syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLOUT | syscall.EPOLLRDHUP | epollET,
+		Fd:     int32(fd),
+	}
+	if err := syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_ADD, fd, event); err != nil {
+		return fmt.Errorf("epoll_ctl: %w", err)
+	}
+
+	remoteAddr := tcpAddrOf(remote)
+	ctx, cancel := context.WithCancel(context.Background())
+	l.conns[fd] = &loopConn{
+		fd:      fd,
+		session: l.handler.Open(remoteAddr, tcpAddrOf(local)),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	l.server.connCount.Add(1)
+	l.server.Logger.Debug("accepted a new connection ", "addr", remoteAddr)
+	return nil
+}
+
+// handle serves a connection after its socket has become readable or writable. Edge-triggered
+// events aren't repeated, so the loop reads and writes until the socket would block.
+func (l *eventLoop) handle(c *loopConn, events uint32) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.server.Logger.Error("recovered from panic", "error", r)
+			l.server.Logger.Debug(string(debug.Stack()))
+			l.closeConn(c)
+		}
+	}()
+
+	if c.closed {
+		return
+	}
+	if events&syscall.EPOLLERR != 0 {
+		l.closeConn(c)
+		return
+	}
+	if events&syscall.EPOLLOUT != 0 && len(c.unsent) > 0 {
+		unsent := c.unsent
+		c.unsent = nil
+		if !l.write(c, unsent) {
+			l.closeConn(c)
+			return
+		}
+	}
+	readable := events&(syscall.EPOLLIN|syscall.EPOLLRDHUP|syscall.EPOLLHUP) != 0
+	if !c.closing && (readable || c.paused) && !l.read(c) {
+		l.closeConn(c)
+		return
+	}
+	if c.closing && !c.serving && len(c.unsent) == 0 {
+		l.closeConn(c)
+	}
+}
+
+// read reads requests and passes them to a worker. Only one buffer of data is read per wakeup,
+// so a pipelining client doesn't delay other connections of the loop. The rest is read once
+// the worker is done. It returns false if the connection is broken.
+func (l *eventLoop) read(c *loopConn) bool {
+	c.paused = false
+	for !c.closing {
+		if c.serving || len(c.unsent) >= maxUnsentReplies {
+			c.paused = true
+			return true
+		}
+		n, err := syscall.Read(c.fd, l.readBuf)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EAGAIN):
+			return true
+		case err != nil:
+			return false
+		case n == 0:
+			// The client has closed the connection, but it may still read replies.
+			c.closing = true
+			return true
+		}
+		l.dispatch(c, l.readBuf[:n])
+	}
+	return true
+}
+
+// dispatch passes received data to a worker. Commands don't run on the loop, because they may take
+// long: scripts run until they are killed by other clients, and commands wait for keys locked by
+// other clients.
+func (l *eventLoop) dispatch(c *loopConn, data []byte) {
+	c.pending = append(c.pending, data...)
+	c.serving = true
+	l.workers.Add(1)
+	// Replies are written by the worker unless earlier ones wait for the socket, which the loop
+	// writes meanwhile.
+	go l.serve(c, c.pending, len(c.unsent) == 0)
+}
+
+// serve passes requests to the session in a worker and wakes the loop to read the next ones.
+func (l *eventLoop) serve(c *loopConn, data []byte, write bool) {
+	defer l.workers.Done()
+	res := served{conn: c, replies: replyBuffers.Get().(*bytes.Buffer)} //nolint:forcetypeassert // the pool has buffers only
+	res.replies.Reset()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				l.server.Logger.Error("recovered from panic", "error", r)
+				l.server.Logger.Debug(string(debug.Stack()))
+				res.err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		res.consumed, res.err = c.session.Serve(c.ctx, data, res.replies)
+	}()
+	if write {
+		var err error
+		res.written, err = writeSome(c.fd, res.replies.Bytes())
+		res.broken = err != nil
+	}
+
+	l.mu.Lock()
+	// The loop is woken once for all results it hasn't handled yet.
+	wake := len(l.served) == 0
+	l.served = append(l.served, res)
+	l.mu.Unlock()
+	if wake {
+		// A full pipe wakes the loop anyway.
+		_, _ = syscall.Write(l.wakeW, []byte{0})
+	}
+}
+
+// complete handles results of workers. The pipe is drained before results are taken, so a result
+// added after that wakes the loop again.
+func (l *eventLoop) complete() {
+	var buf [64]byte
+	for {
+		n, err := syscall.Read(l.wakeR, buf[:])
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil || n < len(buf) {
+			break
+		}
+	}
+	l.mu.Lock()
+	results := l.served
+	l.served = nil
+	l.mu.Unlock()
+
+	for _, res := range results {
+		l.finish(res)
+		replyBuffers.Put(res.replies)
+	}
+}
+
+// finish writes replies of served requests the worker hasn't written and reads the next requests.
+func (l *eventLoop) finish(res served) {
+	c := res.conn
+	c.serving = false
+	if c.closed || res.broken {
+		l.closeConn(c)
+		return
+	}
+	if res.err != nil {
+		l.server.Logger.Debug("failed to serve connection", "error", res.err)
+		c.closing = true
+	}
+	if rest := c.pending[res.consumed:]; len(rest) > 0 {
+		c.pending = append(c.pending[:0], rest...)
+	} else if cap(c.pending) <= maxKeptPending {
+		c.pending = c.pending[:0]
+	} else {
+		c.pending = nil
+	}
+	if !l.write(c, res.replies.Bytes()[res.written:]) {
+		l.closeConn(c)
+		return
+	}
+	// Data received while requests were served isn't signalled again.
+	l.handle(c, 0)
+}
+
+// write writes data to the socket and keeps the rest it doesn't accept. It returns false if the
+// connection is broken.
+func (l *eventLoop) write(c *loopConn, data []byte) bool {
+	if len(c.unsent) > 0 {
+		c.unsent = append(c.unsent, data...)
+		return true
+	}
+	n, err := writeSome(c.fd, data)
+	if err != nil {
+		return false
+	}
+	if n < len(data) {
+		c.unsent = append(c.unsent, data[n:]...)
+	}
+	return true
+}
+
+// writeSome writes data until the socket would block and returns the number of written bytes.
+func writeSome(fd int, data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		n, err := syscall.Write(fd, data[written:])
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EAGAIN):
+			return written, nil
+		case err != nil:
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// closeConn closes the connection, or marks it closed while it is served.
+func (l *eventLoop) closeConn(c *loopConn) {
+	c.cancel()
+	if c.serving {
+		c.closed = true
+		return
+	}
+	delete(l.conns, c.fd)
+	if err := syscall.Close(c.fd); err != nil {
+		l.server.Logger.Warn("failed properly to close a connection", "error", err)
+	}
+	l.server.connCount.Add(-1)
+}
+
+// stopListening stops accepting connections. Closing the socket removes it from epoll, so it isn't
+// closed before the loop removes it itself, or its descriptor could be reused by a connection.
+func (l *eventLoop) stopListening() {
+	if !l.listening {
+		return
+	}
+	l.listening = false
+	_ = syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_DEL, l.listener.fd, nil)
+	l.listener.release()
+}
+
+// close closes connections and waits for workers, which stop once contexts of their connections
+// are cancelled.
+func (l *eventLoop) close() {
+	l.stopListening()
+	for _, c := range l.conns {
+		l.closeConn(c)
+	}
+	l.workers.Wait()
+	for _, c := range l.conns {
+		c.serving = false
+		l.closeConn(c)
+	}
+	_ = syscall.Close(l.wakeR)
+	_ = syscall.Close(l.wakeW)
+	_ = l.poller.Close()
+}
+
+func sockaddr(addr *net.TCPAddr) (int, syscall.Sockaddr) {
+	if ip4 := addr.IP.To4(); ip4 != nil || addr.IP == nil {
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return syscall.AF_INET, sa
+	}
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To16())
+	if iface, err := net.InterfaceByName(addr.Zone); err == nil {
+		sa.ZoneId = uint32(iface.Index)
+	}
+	return syscall.AF_INET6, sa
+}
+
+func tcpAddrOf(sa syscall.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		addr := &net.TCPAddr{IP: net.IP(bytes.Clone(sa.Addr[:])), Port: sa.Port}
+		if iface, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+			addr.Zone = iface.Name
+		}
+		return addr
+	default:
+		return &net.TCPAddr{}
+	}
+}
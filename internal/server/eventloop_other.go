@@ -0,0 +1,12 @@
+//go:build !linux
+
+package server
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (s *Server) runEventLoops(string) error {
+	return fmt.Errorf("%w on %s", ErrEventLoopUnsupported, runtime.GOOS)
+}
@@ -9,6 +9,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,7 +19,10 @@ const (
 	defaultMaxConnections = 256
 )
 
-var ErrStoppedAbnormally = errors.New("server stopped abnormally")
+var (
+	ErrStoppedAbnormally    = errors.New("server stopped abnormally")
+	ErrEventLoopUnsupported = errors.New("event loops are not supported")
+)
 
 type Handler interface {
 	Handle(ctx context.Context, req io.Reader, resp io.Writer) error
@@ -30,6 +34,22 @@ func (f HandlerFunc) Handle(ctx context.Context, req io.Reader, resp io.Writer)
 	return f(ctx, req, resp)
 }
 
+// ConnHandler is a Handler which can also serve connections of event loops. Event loops don't
+// provide a blocking reader, so requests are passed to sessions as they arrive.
+type ConnHandler interface {
+	Handler
+	Open(remote, local net.Addr) Session
+}
+
+// Session serves requests of a single connection of an event loop. Serve is called by worker
+// goroutines, one call at a time.
+type Session interface {
+	// Serve handles complete requests at the beginning of data, writes replies to w and returns
+	// the number of consumed bytes. The rest of data is passed again along with the data received
+	// next. Serve must not retain data. An error closes the connection once replies are sent.
+	Serve(ctx context.Context, data []byte, w io.Writer) (int, error)
+}
+
 type Server struct {
 	Host           string
 	Port           int
@@ -42,6 +62,12 @@ type Server struct {
 	softDone       chan struct{}
 	hardDone       chan struct{}
 	listener       net.Listener
+
+	// EventLoops is the number of event loops serving connections instead of a worker goroutine
+	// per connection. The handler must implement ConnHandler. Zero disables event loops.
+	EventLoops int
+	// connCount is the number of connections served by event loops.
+	connCount atomic.Int64
 }
 
 func Default(handler Handler) *Server {
@@ -73,6 +99,10 @@ func (s *Server) Run() error {
 	s.setRunning(true)
 	defer s.setRunning(false)
 
+	if s.EventLoops > 0 {
+		return s.runEventLoops(addr)
+	}
+
 	s.connections = make(chan net.Conn, s.MaxConnections)
 
 	lis, err := net.Listen("tcp", addr)
@@ -117,8 +147,10 @@ func (s *Server) Stop(timeout time.Duration) error {
 		resultErr = ErrStoppedAbnormally
 	}
 
-	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-		s.Logger.Error("failed to close listener", "error", err)
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.Logger.Error("failed to close listener", "error", err)
+		}
 	}
 	s.workers.Wait()
 	return resultErr
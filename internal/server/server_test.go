@@ -0,0 +1,318 @@
+package server_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/handler"
+	"github.com/burenotti/redis_impl/internal/server"
+	"github.com/burenotti/redis_impl/internal/service"
+	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backends are the ways the server serves connections, by the number of event loops.
+var backends = []struct {
+	name       string
+	eventLoops int
+}{
+	{name: "goroutines", eventLoops: 0},
+	{name: "event loops", eventLoops: runtime.GOMAXPROCS(0)},
+}
+
+// startServer runs a server on a free port and returns its address.
+func startServer(tb testing.TB, eventLoops, maxConnections int) string {
+	tb.Helper()
+	if eventLoops > 0 && runtime.GOOS != "linux" {
+		tb.Skip("event loops are supported on linux only")
+	}
+	redis := service.NewService([]service.Storage{memory.New()}, 1024)
+	tb.Cleanup(redis.Stop)
+	// Scripts become busy soon, so tests of busy scripts don't wait long.
+	redis.ScriptMonitor().SetThreshold(100 * time.Millisecond)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	addr := lis.Addr().(*net.TCPAddr)
+	require.NoError(tb, lis.Close())
+
+	srv := server.Default(handler.New(func() *service.Client {
+		return service.NewClient(redis)
+	}))
+	srv.Host = addr.IP.String()
+	srv.Port = addr.Port
+	// The probe below may not be closed yet when clients connect.
+	srv.MaxConnections = maxConnections + 1
+	srv.EventLoops = eventLoops
+	srv.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	go func() {
+		assert.NoError(tb, srv.Run())
+	}()
+	tb.Cleanup(func() {
+		assert.NoError(tb, srv.Stop(time.Second))
+	})
+
+	require.Eventually(tb, func() bool {
+		conn, err := net.Dial("tcp", addr.String())
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	return addr.String()
+}
+
+type client struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dial(tb testing.TB, addr string) *client {
+	tb.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = conn.Close() })
+	return &client{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+func request(args ...string) []byte {
+	req := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		req = fmt.Appendf(req, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return req
+}
+
+// reply reads a reply of a known length.
+func (c *client) reply(size int) (string, error) {
+	buf := make([]byte, size)
+	_, err := io.ReadFull(c.r, buf)
+	return string(buf), err
+}
+
+func TestServer_eventLoops(t *testing.T) {
+	t.Parallel()
+	addr := startServer(t, 2, 16)
+
+	t.Run("split requests", func(t *testing.T) {
+		c := dial(t, addr)
+		for _, b := range request("SET", "split", "value") {
+			_, err := c.Write([]byte{b})
+			require.NoError(t, err)
+		}
+		reply, err := c.reply(len("+OK\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", reply)
+	})
+
+	t.Run("large value", func(t *testing.T) {
+		c := dial(t, addr)
+		value := string(make([]byte, 1<<20))
+		_, err := c.Write(append(request("SET", "large", value), request("GET", "large")...))
+		require.NoError(t, err)
+		reply, err := c.reply(len("+OK\r\n$1048576\r\n") + len(value) + 2)
+		require.NoError(t, err)
+		assert.Equal(t, "+OK\r\n$1048576\r\n"+value+"\r\n", reply)
+	})
+
+	t.Run("pipeline exceeding socket buffers", func(t *testing.T) {
+		c := dial(t, addr)
+		value := string(make([]byte, 1024))
+		_, err := c.Write(request("SET", "pipeline", value))
+		require.NoError(t, err)
+		_, err = c.reply(len("+OK\r\n"))
+		require.NoError(t, err)
+
+		// Replies are read only after all requests are sent, so the server stops reading requests
+		// until the client reads replies.
+		const requests = 10000
+		go func() {
+			for range requests {
+				_, err := c.Write(request("GET", "pipeline"))
+				assert.NoError(t, err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+		expected := "$1024\r\n" + value + "\r\n"
+		for range requests {
+			reply, err := c.reply(len(expected))
+			require.NoError(t, err)
+			require.Equal(t, expected, reply)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		c := dial(t, addr)
+		_, err := c.Write([]byte("PING\r\n"))
+		require.NoError(t, err)
+		line, err := c.r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Contains(t, line, "invalid syntax")
+		_, err = c.r.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
+
+// TestServer_pipeline checks that values of pipelined requests are kept once buffers of the
+// connection are reused by the next requests.
+func TestServer_pipeline(t *testing.T) {
+	t.Parallel()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			c := dial(t, startServer(t, backend.eventLoops, 4))
+			const keys = 1000
+			var req, expected []byte
+			for i := range keys {
+				req = append(req, request("SET", "key"+strconv.Itoa(i), "value"+strconv.Itoa(i))...)
+				expected = append(expected, "+OK\r\n"...)
+			}
+			for i := range keys {
+				value := "value" + strconv.Itoa(i)
+				req = append(req, request("GET", "key"+strconv.Itoa(i))...)
+				expected = fmt.Appendf(expected, "$%d\r\n%s\r\n", len(value), value)
+			}
+			_, err := c.Write(req)
+			require.NoError(t, err)
+			reply, err := c.reply(len(expected))
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), reply)
+		})
+	}
+}
+
+// TestServer_busyScript checks that a client can kill a busy script, even if the script runs on
+// the same event loop.
+func TestServer_busyScript(t *testing.T) {
+	t.Parallel()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			addr := startServer(t, min(backend.eventLoops, 1), 4)
+			script, other := dial(t, addr), dial(t, addr)
+			for _, c := range []*client{script, other} {
+				require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+			}
+
+			_, err := script.Write(request("EVAL", "while true do end", "0"))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool {
+				_, err := other.Write(request("PING"))
+				require.NoError(t, err)
+				line, err := other.r.ReadString('\n')
+				require.NoError(t, err)
+				return strings.HasPrefix(line, "-BUSY")
+			}, 3*time.Second, 50*time.Millisecond)
+
+			_, err = other.Write(request("SCRIPT", "KILL"))
+			require.NoError(t, err)
+			reply, err := other.reply(len("+OK\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, "+OK\r\n", reply)
+
+			line, err := script.r.ReadString('\n')
+			require.NoError(t, err)
+			assert.Contains(t, line, "Script killed by user")
+			_, err = script.Write(request("PING"))
+			require.NoError(t, err)
+			reply, err = script.reply(len("+PONG\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, "+PONG\r\n", reply)
+		})
+	}
+}
+
+// BenchmarkServer compares serving connections by goroutines and by event loops.
+// Every client sends a request once the previous one is replied.
+func BenchmarkServer(b *testing.B) {
+	for _, backend := range backends {
+		for _, clients := range []int{1, 16, 256} {
+			b.Run(fmt.Sprintf("%s/clients=%d", backend.name, clients), func(b *testing.B) {
+				addr := startServer(b, backend.eventLoops, clients)
+				conns := make([]*client, clients)
+				for i := range conns {
+					conns[i] = dial(b, addr)
+				}
+				req := request("SET", "key", "value")
+
+				var ops atomic.Int64
+				var wg sync.WaitGroup
+				b.ReportAllocs()
+				b.ResetTimer()
+				for _, c := range conns {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for ops.Add(1) <= int64(b.N) {
+							if _, err := c.Write(req); err != nil {
+								b.Error(err)
+								return
+							}
+							if _, err := c.reply(len("+OK\r\n")); err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// BenchmarkServer_idle measures requests of a client among many idle ones, and reports memory
+// and goroutines taken per connection.
+func BenchmarkServer_idle(b *testing.B) {
+	const clients = 1000
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			var before runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			goroutines := runtime.NumGoroutine()
+
+			addr := startServer(b, backend.eventLoops, clients)
+			conns := make([]*client, clients)
+			ping := request("PING")
+			for i := range conns {
+				conns[i] = dial(b, addr)
+				_, err := conns[i].Write(ping)
+				require.NoError(b, err)
+				_, err = conns[i].reply(len("+PONG\r\n"))
+				require.NoError(b, err)
+			}
+
+			var after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			goroutines = runtime.NumGoroutine() - goroutines
+
+			b.ResetTimer()
+			for i := range b.N {
+				c := conns[i%clients]
+				if _, err := c.Write(ping); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := c.reply(len("+PONG\r\n")); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			inuse := func(m *runtime.MemStats) uint64 { return m.HeapInuse + m.StackInuse }
+			b.ReportMetric(float64(inuse(&after)-inuse(&before))/clients, "B/conn")
+			b.ReportMetric(float64(goroutines)/clients, "goroutines/conn")
+		})
+	}
+}
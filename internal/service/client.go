@@ -4,115 +4,411 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strings"
+
 	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/module"
 )
 
 var (
 	ErrNestedMulti         = fmt.Errorf("nested MULTI calls is not supported")
 	ErrDiscardWithoutMulti = fmt.Errorf("discard without multi")
 	ErrExecWithoutMulti    = fmt.Errorf("exec without multi")
+	ErrExecAbort           = fmt.Errorf("EXECABORT Transaction discarded because of previous errors.")
+	ErrWatchInMulti        = fmt.Errorf("WATCH inside MULTI is not allowed")
 )
 
 func NewClient(service *RedisService) *Client {
 	return &Client{
 		service:        service,
+		conn:           ConnInfo{ID: service.clients.Add(1)},
 		queuedCommands: nil,
-		watches:        make(map[string]uint64),
+		watches:        make(map[watchedKey]watchedRevision),
 		inProgress:     false,
 	}
 }
 
+type watchedKey struct {
+	db  int
+	key string
+}
+
+// watchedRevision is a revision of a key at the moment it was watched. The storage is kept
+// to release the watch even if databases are swapped.
+type watchedRevision struct {
+	storage  Storage
+	revision uint64
+}
+
 type Client struct {
 	service        *RedisService
+	conn           ConnInfo
+	db             int
 	queuedCommands []cmd.Command
-	watches        map[string]uint64
+	watches        map[watchedKey]watchedRevision
 	inProgress     bool
+	// dirty is set when a command failed to be queued.
+	dirty  bool
+	atomic bool
+	// undo is set while a modifying command of an atomic transaction is executed.
+	undo *undoLog
+	// changes is set while a modifying command is executed and collects keys it changed.
+	changes *keyChanges
+	// events are keyspace events passed to modules once locks are released.
+	events []module.Event
 }
 
 func (c *Client) Storage() cmd.Storage {
-	return c.service.Storage()
+	// c.db is validated by Select, so the lookup can't fail.
+	storage, _ := c.service.Database(c.db)
+	return c.wrap(c.db, storage)
+}
+
+// wrap makes changes of the storage revertible while an atomic transaction is executed
+// and records changed keys while a modifying command is executed.
+func (c *Client) wrap(db int, storage Storage) cmd.Storage {
+	var wrapped cmd.Storage = storage
+	if c.undo != nil {
+		wrapped = &undoStorage{Storage: storage, log: c.undo}
+	}
+	if c.changes != nil {
+		wrapped = &changesStorage{Storage: wrapped, db: db, changes: c.changes}
+	}
+	return wrapped
+}
+
+func (c *Client) Scripts() *cmd.ScriptCache {
+	return c.service.Scripts()
+}
+
+func (c *Client) Functions() *cmd.FunctionRegistry {
+	functions := c.service.Functions()
+	if c.undo != nil {
+		c.undo.recordFunctions(functions)
+	}
+	return functions
+}
+
+func (c *Client) ScriptMonitor() *cmd.ScriptMonitor {
+	return c.service.ScriptMonitor()
 }
 
-func (c *Client) Run(ctx context.Context, command cmd.Command) (res *cmd.Result, err error) {
+func (c *Client) Modules() *cmd.ModuleRegistry {
+	return c.service.Modules()
+}
+
+func (c *Client) Shutdown() {
+	c.service.Shutdown()
+}
+
+// SetConn sets addresses of the connection reported to interceptors.
+func (c *Client) SetConn(remote, local net.Addr) {
+	c.conn.RemoteAddr = remote.String()
+	c.conn.LocalAddr = local.String()
+}
+
+// Conn returns the connection of the client.
+func (c *Client) Conn() ConnInfo {
+	return c.conn
+}
+
+func (c *Client) Select(_ context.Context, db int) error {
+	if _, err := c.service.Database(db); err != nil {
+		return err
+	}
+	c.db = db
+	return nil
+}
+
+func (c *Client) SelectedDB() int {
+	return c.db
+}
+
+func (c *Client) Database(db int) (cmd.Storage, error) {
+	storage, err := c.service.Database(db)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(db, storage), nil
+}
+
+func (c *Client) Databases() int {
+	return c.service.Databases()
+}
+
+func (c *Client) SwapDB(_ context.Context, first, second int) error {
+	if err := c.service.SwapDB(first, second); err != nil {
+		return err
+	}
+	if c.undo != nil {
+		c.undo.swaps = append(c.undo.swaps, [2]int{first, second})
+	}
+	return nil
+}
+
+// Run runs the command through interceptors. A command rejected while a transaction is queued
+// fails the transaction.
+func (c *Client) Run(ctx context.Context, command cmd.Command) (*cmd.Result, error) {
+	queue := c.inProgress && !command.IsTx()
+	call := &Call{Command: command, Conn: c.conn, DB: c.db, Queuing: queue}
+	res, err := c.service.intercept(ctx, call, func(ctx context.Context) (*cmd.Result, error) {
+		return c.run(ctx, command)
+	})
+	if err != nil {
+		if queue {
+			c.MarkDirty()
+		}
+		return cmd.NewResult(err), err
+	}
+	return res, nil
+}
+
+func (c *Client) run(ctx context.Context, command cmd.Command) (res *cmd.Result, err error) {
 	if c.inProgress && !command.IsTx() {
 		c.queuedCommands = append(c.queuedCommands, command)
 		return cmd.NewResult("QUEUED"), nil
 	}
 
-	err = c.service.Atomic(ctx, func(ctx context.Context) error {
-		res, err = command.Execute(ctx, c)
-		if err == nil && command.IsModifying() {
-			err = c.service.WalAppend(ctx, command)
+	if unlocked, ok := command.(cmd.Unlocked); ok && unlocked.IsUnlocked() {
+		return command.Execute(ctx, c)
+	}
+
+	err = c.service.Atomic(ctx, c.locks(command), func(ctx context.Context) error {
+		res, err = c.execute(ctx, command)
+		if logErr := c.logCommand(ctx, c.db, command, err); logErr != nil {
+			return logErr
 		}
 		return err
 	})
-	if err != nil {
-		return cmd.NewResult(err), err
+	c.service.Modules().Notify(c.events)
+	c.events = c.events[:0]
+	return res, err
+}
+
+// locks returns locks needed to run the command. EXEC locks keys of queued commands and watched
+// keys, so they can't change between the check of watches and the execution. Atomic transactions
+// are exclusive, because their rollback restores indexes of whole databases.
+func (c *Client) locks(command cmd.Command) LockSet {
+	if !command.IsTx() || command.Name() == cmd.WATCH {
+		return c.service.lockSet(command)
 	}
-	return res, nil
+	if command.Name() != cmd.EXEC || !c.inProgress {
+		return LockSet{}
+	}
+	if c.atomic {
+		return ExclusiveLock()
+	}
+	keys := make([]string, 0, len(c.watches))
+	for key := range c.watches {
+		keys = append(keys, key.key)
+	}
+	set := KeysLock(keys...)
+	for _, queued := range c.queuedCommands {
+		set = set.Union(c.service.lockSet(queued))
+	}
+	return set
 }
 
-func (c *Client) StartTx(_ context.Context) error {
+func (c *Client) StartTx(_ context.Context, atomic bool) error {
 	if c.inProgress {
 		return ErrNestedMulti
 	}
 
 	c.inProgress = true
+	c.atomic = atomic
 	return nil
 }
 
+// MarkDirty marks the transaction in progress as failed, so EXEC replies with EXECABORT.
+// Does nothing outside of transactions.
+func (c *Client) MarkDirty() {
+	if c.inProgress {
+		c.dirty = true
+	}
+}
+
+// ExecTx executes queued commands. Errors of commands don't stop the transaction
+// and are replied in place of their results.
 func (c *Client) ExecTx(ctx context.Context) (*cmd.Result, error) {
 	if !c.inProgress {
 		return cmd.EmptyResult(), ErrExecWithoutMulti
 	}
+	defer c.resetTx(ctx)
 
-	result := cmd.EmptyResult()
+	if c.dirty {
+		return cmd.EmptyResult(), ErrExecAbort
+	}
+	if c.watchedChanged(ctx) {
+		return cmd.NewResult(cmd.NilArray()), nil
+	}
+	if c.atomic {
+		return c.execAtomic(ctx)
+	}
 
+	replies := make([]interface{}, 0, len(c.queuedCommands))
 	for _, command := range c.queuedCommands {
-		res, err := command.Execute(ctx, c)
+		res, err := c.executeQueued(ctx, command)
+		if logErr := c.logCommand(ctx, c.db, command, err); logErr != nil {
+			return cmd.EmptyResult(), logErr
+		}
 		if err != nil {
-			return res, err
+			replies = append(replies, err)
+			continue
 		}
+		replies = append(replies, reply(res))
+	}
+	return cmd.NewResult(replies), nil
+}
+
+// execute executes a command. Keys changed by modifying commands and scripts become keyspace
+// events named after the command. Scripts are logged even if they fail, so are their changes.
+func (c *Client) execute(ctx context.Context, command cmd.Command) (*cmd.Result, error) {
+	_, effector := command.(cmd.Effector)
+	if command.IsTx() || !command.IsModifying() && !effector {
+		return command.Execute(ctx, c)
+	}
+	c.changes = newKeyChanges()
+	defer func() { c.changes = nil }()
+	res, err := command.Execute(ctx, c)
+	if err == nil || effector {
+		c.events = c.changes.events(c.events, strings.ToLower(command.Name()))
+	}
+	return res, err
+}
+
+// executeQueued executes a command queued in a transaction through interceptors.
+func (c *Client) executeQueued(ctx context.Context, command cmd.Command) (*cmd.Result, error) {
+	call := &Call{Command: command, Conn: c.conn, DB: c.db, Queued: true}
+	return c.service.intercept(ctx, call, func(ctx context.Context) (*cmd.Result, error) {
+		return c.execute(ctx, command)
+	})
+}
 
-		result.Values = append(result.Values, res.Values)
-		if err = c.service.WalAppend(ctx, command); err != nil {
-			return res, err
+// logCommand appends a command executed against database db to the WAL. Effectors are logged
+// as commands they executed even if they failed, other commands only if they succeeded.
+func (c *Client) logCommand(ctx context.Context, db int, command cmd.Command, execErr error) error {
+	if effector, ok := command.(cmd.Effector); ok {
+		for _, effect := range effector.Effects() {
+			if err := c.service.WalAppend(ctx, effect.DB, effect.Command); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+	if execErr != nil || !command.IsModifying() {
+		return nil
 	}
+	return c.service.WalAppend(ctx, db, command)
+}
 
-	c.queuedCommands = c.queuedCommands[:0]
-	c.inProgress = false
-	_ = c.Unwatch(ctx)
-	return result, nil
+// walEntry is a command to be logged after an atomic transaction commits.
+type walEntry struct {
+	db      int
+	command cmd.Command
+}
+
+// execAtomic executes queued commands recording an undo log. If any command fails,
+// all changes are reverted and nothing is logged.
+func (c *Client) execAtomic(ctx context.Context) (*cmd.Result, error) {
+	log := newUndoLog()
+	db := c.db
+	events := len(c.events)
+	replies := make([]interface{}, 0, len(c.queuedCommands))
+	var logged []walEntry
+	for i, command := range c.queuedCommands {
+		if command.IsModifying() {
+			c.undo = log
+		}
+		res, err := c.executeQueued(ctx, command)
+		c.undo = nil
+		if err != nil {
+			c.db = db
+			c.events = c.events[:events]
+			if rbErr := log.rollback(ctx, c.service); rbErr != nil {
+				return cmd.EmptyResult(), errors.Join(err, rbErr)
+			}
+			return cmd.EmptyResult(), fmt.Errorf("%w: command #%d (%s) failed: %w", ErrRolledBack, i+1, command.Name(), err)
+		}
+		replies = append(replies, reply(res))
+		if effector, ok := command.(cmd.Effector); ok {
+			for _, effect := range effector.Effects() {
+				logged = append(logged, walEntry{db: effect.DB, command: effect.Command})
+			}
+		} else if command.IsModifying() {
+			logged = append(logged, walEntry{db: c.db, command: command})
+		}
+	}
+
+	for _, entry := range logged {
+		if err := c.service.WalAppend(ctx, entry.db, entry.command); err != nil {
+			return cmd.EmptyResult(), err
+		}
+	}
+	return cmd.NewResult(replies), nil
+}
+
+// reply unwraps single value results the same way they are sent to clients.
+func reply(res *cmd.Result) interface{} {
+	if len(res.Values) == 1 {
+		return res.Values[0]
+	}
+	return res.Values
 }
 
-func (c *Client) DiscardTx(_ context.Context) error {
+func (c *Client) DiscardTx(ctx context.Context) error {
 	if !c.inProgress {
 		return ErrDiscardWithoutMulti
 	}
-	clear(c.queuedCommands)
-	c.inProgress = false
+	c.resetTx(ctx)
 	return nil
 }
 
+func (c *Client) resetTx(ctx context.Context) {
+	c.queuedCommands = c.queuedCommands[:0]
+	c.inProgress = false
+	c.dirty = false
+	c.atomic = false
+	_ = c.Unwatch(ctx)
+}
+
 func (c *Client) Unwatch(_ context.Context) error {
+	for key, watched := range c.watches {
+		watched.storage.Unwatch(key.key)
+	}
 	clear(c.watches)
 	return nil
 }
 
+// Watch remembers revisions of keys, so the transaction is aborted if any of them changes
+// before EXEC. Must be called under Atomic.
 func (c *Client) Watch(ctx context.Context, keys ...string) error {
-	return c.service.Atomic(ctx, func(ctx context.Context) error {
-		for _, key := range keys {
-			entry, err := c.service.Storage().Get(ctx, key)
-			if errors.Is(err, cmd.ErrKeyNotFound) {
-				c.watches[key] = 0
-			}
-			if err != nil {
-				return err
-			}
-			c.watches[key] = entry.Revision()
+	if c.inProgress {
+		return ErrWatchInMulti
+	}
+	storage, err := c.service.Database(c.db)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		wk := watchedKey{db: c.db, key: key}
+		if _, ok := c.watches[wk]; ok {
+			continue
 		}
+		storage.Watch(key)
+		c.watches[wk] = watchedRevision{storage: storage, revision: storage.Revision(ctx, key)}
+	}
+	return nil
+}
 
-		return nil
-	})
+// watchedChanged reports whether any watched key was modified, deleted, expired or flushed.
+// Revisions are unique across all databases, so a swapped database is detected as well.
+func (c *Client) watchedChanged(ctx context.Context) bool {
+	for key, watched := range c.watches {
+		storage, err := c.service.Database(key.db)
+		if err != nil || storage.Revision(ctx, key.key) != watched.revision {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/service"
+	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/burenotti/redis_impl/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newService(t testing.TB) *service.RedisService {
+	t.Helper()
+	redis := service.NewService([]service.Storage{memory.New(), memory.New()}, 1024)
+	t.Cleanup(redis.Stop)
+	return redis
+}
+
+func TestClient_Run_concurrent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	const clients, increments = 8, 200
+
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := service.NewClient(redis)
+			for range increments {
+				_, err := c.Run(ctx, cmd.HIncrBy("shared", "count", 1))
+				assert.NoError(t, err)
+				_, err = c.Run(ctx, cmd.HIncrBy("own"+strconv.Itoa(i), "count", 1))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c := service.NewClient(redis)
+	res, err := c.Run(ctx, cmd.HGet("shared", "count"))
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]byte(strconv.Itoa(clients*increments))), res)
+}
+
+// TestClient_Run_notify checks keyspace events of concurrent clients are delivered sequentially.
+// Run with -race.
+func TestClient_Run_notify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	const clients, sets = 4, 100
+
+	received := 0
+	m, err := module.Init(func(m *module.Module, _ []string) error {
+		m.Name = "counter"
+		m.Subscribe(func(module.Event) { received++ })
+		return nil
+	}, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, redis.Modules().Add(m))
+
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := service.NewClient(redis)
+			for j := range sets {
+				command, err := cmd.Set("key"+strconv.Itoa(i), []byte(strconv.Itoa(j)))
+				assert.NoError(t, err)
+				_, err = c.Run(ctx, command)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, clients*sets, received)
+}
+
+// TestClient_ExecTx_watch increments a string with optimistic locking, which loses no
+// increments only if EXEC is atomic with the check of watched keys.
+func TestClient_ExecTx_watch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	const clients, increments = 8, 50
+
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := service.NewClient(redis)
+			run := func(command cmd.Command) *cmd.Result {
+				res, err := c.Run(ctx, command)
+				assert.NoError(t, err)
+				return res
+			}
+			for done := 0; done < increments; {
+				run(cmd.Watch("counter"))
+				n := 0
+				if value, ok := run(cmd.Get("counter")).Values[0].([]byte); ok {
+					n, _ = strconv.Atoi(string(value))
+				}
+				set, err := cmd.Set("counter", []byte(strconv.Itoa(n+1)))
+				assert.NoError(t, err)
+				run(cmd.Multi(false))
+				run(set)
+				// EXEC replies with a nil array if the counter changed.
+				if replies, _ := run(cmd.Exec()).Values[0].([]interface{}); replies != nil {
+					done++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	res, err := service.NewClient(redis).Run(ctx, cmd.Get("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]byte(strconv.Itoa(clients*increments))), res)
+}
+
+// BenchmarkClient_Run shows how commands scale across cores: commands with distinct keys
+// run in parallel, commands with the same key or without keys are serialized.
+// Run with -cpu=1,2,4,8 to compare.
+func BenchmarkClient_Run(b *testing.B) {
+	ctx := context.Background()
+	benchmarks := []struct {
+		name    string
+		command func(client int) cmd.Command
+	}{
+		{name: "distinct keys", command: func(client int) cmd.Command {
+			return cmd.HIncrBy("hash"+strconv.Itoa(client), "field", 1)
+		}},
+		{name: "same key", command: func(int) cmd.Command {
+			return cmd.HIncrBy("hash", "field", 1)
+		}},
+		{name: "keyless", command: func(int) cmd.Command {
+			return cmd.DBSize()
+		}},
+	}
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			redis := newService(b)
+			var clients sync.Mutex
+			next := 0
+			b.RunParallel(func(pb *testing.PB) {
+				clients.Lock()
+				c, command := service.NewClient(redis), bb.command(next)
+				next++
+				clients.Unlock()
+				for pb.Next() {
+					if _, err := c.Run(ctx, command); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/module"
+)
+
+type changedKey struct {
+	db  int
+	key string
+}
+
+// keyChanges are keys changed by a command in the order of their first change.
+type keyChanges struct {
+	keys    []changedKey
+	deleted map[changedKey]bool
+}
+
+func newKeyChanges() *keyChanges {
+	return &keyChanges{deleted: make(map[changedKey]bool)}
+}
+
+func (c *keyChanges) add(db int, key string, deleted bool) {
+	k := changedKey{db: db, key: key}
+	if _, ok := c.deleted[k]; !ok {
+		c.keys = append(c.keys, k)
+	}
+	c.deleted[k] = deleted
+}
+
+// events appends events of changed keys. Keys deleted by the command get del events.
+func (c *keyChanges) events(events []module.Event, name string) []module.Event {
+	for _, k := range c.keys {
+		event := name
+		if c.deleted[k] {
+			event = "del"
+		}
+		events = append(events, module.Event{DB: k.db, Key: k.key, Event: event})
+	}
+	return events
+}
+
+// changesStorage records keys set and deleted through it. Values are modified in place
+// and then set again, so every change of a key is recorded.
+type changesStorage struct {
+	cmd.Storage
+	db      int
+	changes *keyChanges
+}
+
+func (s *changesStorage) Set(ctx context.Context, key string, value interface{}, expiresAt *time.Time) (cmd.Entry, error) {
+	entry, err := s.Storage.Set(ctx, key, value, expiresAt)
+	if err == nil {
+		s.changes.add(s.db, key, false)
+	}
+	return entry, err
+}
+
+func (s *changesStorage) Del(ctx context.Context, key string) (cmd.Entry, error) {
+	entry, err := s.Storage.Del(ctx, key)
+	if err == nil {
+		s.changes.add(s.db, key, true)
+	}
+	return entry, err
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// ConnInfo describes the connection of a client.
+type ConnInfo struct {
+	// ID is unique across clients of the service.
+	ID         uint64
+	RemoteAddr string
+	LocalAddr  string
+}
+
+// Call is a command passed through interceptors.
+type Call struct {
+	Command cmd.Command
+	Conn    ConnInfo
+	// DB is the database selected when the command is called.
+	DB int
+	// Queuing is set when the command is going to be queued in a transaction, and Queued when
+	// EXEC executes it. Queued commands are intercepted at both stages.
+	Queuing bool
+	Queued  bool
+}
+
+// Next calls the rest of the chain and finally the command.
+type Next func(ctx context.Context) (*cmd.Result, error)
+
+// Interceptor is called around every command. It may inspect or replace the result of next,
+// or return an error without calling next to reject the command. Interceptors of queued commands
+// are called under locks of the transaction, so they must not block.
+type Interceptor func(ctx context.Context, call *Call, next Next) (*cmd.Result, error)
+
+// Use appends interceptors to the chain. The first interceptor is the outermost one.
+// Must be called before clients are served.
+func (s *RedisService) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// intercept calls the command f through the chain of interceptors.
+func (s *RedisService) intercept(ctx context.Context, call *Call, f Next) (*cmd.Result, error) {
+	next := f
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := s.interceptors[i], next
+		next = func(ctx context.Context) (*cmd.Result, error) {
+			return interceptor(ctx, call, inner)
+		}
+	}
+	return next(ctx)
+}
+
+// LogSlowCommands logs commands executed longer than threshold.
+// Queued commands are logged when EXEC executes them.
+func LogSlowCommands(logger *slog.Logger, threshold time.Duration) Interceptor {
+	return func(ctx context.Context, call *Call, next Next) (*cmd.Result, error) {
+		start := time.Now()
+		res, err := next(ctx)
+		if elapsed := time.Since(start); elapsed >= threshold && !call.Queuing && !call.Command.IsTx() {
+			logger.Warn("Slow command",
+				"command", call.Command.Name(),
+				"duration", elapsed,
+				"client", call.Conn.ID,
+				"addr", call.Conn.RemoteAddr,
+				"db", call.DB,
+			)
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRejected = errors.New("rejected")
+
+func set(t testing.TB, key, value string) cmd.Command {
+	t.Helper()
+	command, err := cmd.Set(key, []byte(value))
+	require.NoError(t, err)
+	return command
+}
+
+// reject rejects commands modifying the key without calling them.
+func reject(key string) service.Interceptor {
+	return func(ctx context.Context, call *service.Call, next service.Next) (*cmd.Result, error) {
+		if args := call.Command.Args(); call.Command.IsModifying() && len(args) > 1 && args[1] == key {
+			return nil, errRejected
+		}
+		return next(ctx)
+	}
+}
+
+func TestRedisService_Use_order(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	var calls []string
+	trace := func(name string) service.Interceptor {
+		return func(ctx context.Context, call *service.Call, next service.Next) (*cmd.Result, error) {
+			calls = append(calls, name+" "+call.Command.Name())
+			res, err := next(ctx)
+			calls = append(calls, name+" done")
+			return res, err
+		}
+	}
+	redis.Use(trace("outer"), trace("inner"))
+
+	_, err := service.NewClient(redis).Run(ctx, cmd.Get("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer GET", "inner GET", "inner done", "outer done"}, calls)
+}
+
+func TestRedisService_Use_reject(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	redis.Use(reject("rejected"))
+	c := service.NewClient(redis)
+
+	res, err := c.Run(ctx, set(t, "rejected", "value"))
+	require.ErrorIs(t, err, errRejected)
+	assert.Equal(t, cmd.NewResult(err), res)
+	res, err = c.Run(ctx, cmd.Get("rejected"))
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult(cmd.NilString()), res)
+}
+
+func TestRedisService_Use_transactions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("rejected while queuing", func(t *testing.T) {
+		t.Parallel()
+		redis := newService(t)
+		redis.Use(reject("rejected"))
+		c := service.NewClient(redis)
+
+		_, err := c.Run(ctx, cmd.Multi(false))
+		require.NoError(t, err)
+		_, err = c.Run(ctx, set(t, "key", "value"))
+		require.NoError(t, err)
+		_, err = c.Run(ctx, set(t, "rejected", "value"))
+		require.ErrorIs(t, err, errRejected)
+		_, err = c.Run(ctx, cmd.Exec())
+		require.ErrorIs(t, err, service.ErrExecAbort)
+
+		res, err := c.Run(ctx, cmd.Get("key"))
+		require.NoError(t, err)
+		assert.Equal(t, cmd.NewResult(cmd.NilString()), res)
+	})
+
+	t.Run("rejected on exec", func(t *testing.T) {
+		t.Parallel()
+		redis := newService(t)
+		// Commands are rejected when EXEC executes them only.
+		redis.Use(func(ctx context.Context, call *service.Call, next service.Next) (*cmd.Result, error) {
+			if call.Queued {
+				return reject("rejected")(ctx, call, next)
+			}
+			return next(ctx)
+		})
+		c := service.NewClient(redis)
+
+		for _, command := range []cmd.Command{cmd.Multi(false), set(t, "key", "value"), set(t, "rejected", "value")} {
+			_, err := c.Run(ctx, command)
+			require.NoError(t, err)
+		}
+		res, err := c.Run(ctx, cmd.Exec())
+		require.NoError(t, err)
+		assert.Equal(t, cmd.NewResult([]interface{}{"OK", errRejected}), res)
+	})
+
+	t.Run("rejected on atomic exec", func(t *testing.T) {
+		t.Parallel()
+		redis := newService(t)
+		redis.Use(func(ctx context.Context, call *service.Call, next service.Next) (*cmd.Result, error) {
+			if call.Queued {
+				return reject("rejected")(ctx, call, next)
+			}
+			return next(ctx)
+		})
+		c := service.NewClient(redis)
+
+		for _, command := range []cmd.Command{cmd.Multi(true), set(t, "key", "value"), set(t, "rejected", "value")} {
+			_, err := c.Run(ctx, command)
+			require.NoError(t, err)
+		}
+		_, err := c.Run(ctx, cmd.Exec())
+		require.ErrorIs(t, err, service.ErrRolledBack)
+		require.ErrorIs(t, err, errRejected)
+
+		// Changes of previous commands are reverted.
+		res, err := c.Run(ctx, cmd.Get("key"))
+		require.NoError(t, err)
+		assert.Equal(t, cmd.NewResult(cmd.NilString()), res)
+	})
+}
+
+func TestLogSlowCommands(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	var logs bytes.Buffer
+	redis.Use(service.LogSlowCommands(slog.New(slog.NewTextHandler(&logs, nil)), 0))
+	c := service.NewClient(redis)
+
+	for _, command := range []cmd.Command{cmd.Multi(false), set(t, "key", "value"), cmd.Exec()} {
+		_, err := c.Run(ctx, command)
+		require.NoError(t, err)
+	}
+
+	// Transaction commands aren't logged, and the queued command is logged once it is executed.
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "command=SET")
+}
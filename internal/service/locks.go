@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"slices"
+	"sync"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+)
+
+// lockStripes is the number of stripes keys are locked by. Keys are mapped to stripes
+// regardless of databases, so a key moved between databases takes a single stripe.
+const lockStripes = 1024
+
+var stripeSeed = maphash.MakeSeed()
+
+// LockSet is a set of locks held while a command is executed. Commands holding stripes share
+// the global lock, exclusive commands hold it alone.
+type LockSet struct {
+	Exclusive bool
+	// Stripes are sorted and unique, so they are always acquired in the same order.
+	Stripes []int
+}
+
+// ExclusiveLock is held by commands which can't run concurrently with any other command.
+func ExclusiveLock() LockSet {
+	return LockSet{Exclusive: true}
+}
+
+// KeysLock is held by commands which access the keys only.
+func KeysLock(keys ...string) LockSet {
+	stripes := make([]int, len(keys))
+	for i, key := range keys {
+		stripes[i] = int(maphash.String(stripeSeed, key) % lockStripes)
+	}
+	slices.Sort(stripes)
+	return LockSet{Stripes: slices.Compact(stripes)}
+}
+
+// Union returns locks held by both sets.
+func (l LockSet) Union(other LockSet) LockSet {
+	if l.Exclusive || other.Exclusive {
+		return ExclusiveLock()
+	}
+	stripes := append(slices.Clone(l.Stripes), other.Stripes...)
+	slices.Sort(stripes)
+	return LockSet{Stripes: slices.Compact(stripes)}
+}
+
+// keyLocks is the global lock and stripes of keys.
+type keyLocks struct {
+	global  *rwLock
+	stripes [lockStripes]chan struct{}
+}
+
+func newKeyLocks() *keyLocks {
+	l := &keyLocks{global: newRWLock()}
+	for i := range l.stripes {
+		l.stripes[i] = make(chan struct{}, 1)
+	}
+	return l
+}
+
+// acquire takes locks of the set. It gives up and releases taken locks once changed is closed.
+func (l *keyLocks) acquire(ctx context.Context, set LockSet, changed <-chan struct{}) (bool, error) {
+	if ok, err := l.global.acquire(ctx, set.Exclusive, changed); !ok || err != nil {
+		return ok, err
+	}
+	for i, stripe := range set.Stripes {
+		select {
+		case l.stripes[stripe] <- struct{}{}:
+		case <-ctx.Done():
+			l.release(LockSet{Stripes: set.Stripes[:i]})
+			return false, ctx.Err()
+		case <-changed:
+			l.release(LockSet{Stripes: set.Stripes[:i]})
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (l *keyLocks) release(set LockSet) {
+	for i := len(set.Stripes) - 1; i >= 0; i-- {
+		<-l.stripes[set.Stripes[i]]
+	}
+	l.global.release(set.Exclusive)
+}
+
+// rwLock is a readers-writer lock, which can be given up while waiting for it.
+// Waiting writers block new readers, so they don't starve.
+type rwLock struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	waiting int
+	// released is closed and replaced whenever waiters may be able to proceed.
+	released chan struct{}
+}
+
+func newRWLock() *rwLock {
+	return &rwLock{released: make(chan struct{})}
+}
+
+func (l *rwLock) acquire(ctx context.Context, exclusive bool, changed <-chan struct{}) (bool, error) {
+	l.mu.Lock()
+	if exclusive {
+		l.waiting++
+	}
+	for {
+		switch {
+		case exclusive && !l.writer && l.readers == 0:
+			l.waiting--
+			l.writer = true
+			l.mu.Unlock()
+			return true, nil
+		case !exclusive && !l.writer && l.waiting == 0:
+			l.readers++
+			l.mu.Unlock()
+			return true, nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		var err error
+		select {
+		case <-released:
+			l.mu.Lock()
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-changed:
+		}
+		if exclusive {
+			l.mu.Lock()
+			l.waiting--
+			l.broadcast()
+			l.mu.Unlock()
+		}
+		return false, err
+	}
+}
+
+func (l *rwLock) release(exclusive bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case exclusive:
+		l.writer = false
+	case l.readers <= 0:
+		panic(fmt.Sprintf("release of unlocked %T", l))
+	default:
+		l.readers--
+	}
+	// Only writers wait for readers to leave.
+	if exclusive || l.readers == 0 {
+		l.broadcast()
+	}
+}
+
+func (l *rwLock) broadcast() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// lockSet returns locks needed to execute the command. Commands with keys lock their keys,
+// connection commands lock nothing but the shared global lock, the rest are exclusive.
+func (s *RedisService) lockSet(command cmd.Command) LockSet {
+	spec, ok := s.commands.Lookup(command.Name())
+	switch {
+	case !ok || spec.Exclusive:
+		return ExclusiveLock()
+	case slices.Contains(spec.Categories, cmd.CatConnection):
+		return LockSet{}
+	}
+	keys, err := spec.GetKeys(stringArgs(command.Args()))
+	if err != nil {
+		return ExclusiveLock()
+	}
+	return KeysLock(keys...)
+}
+
+// stringArgs formats arguments of a command the way they are sent to the server.
+func stringArgs(args []interface{}) []string {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			res[i] = v
+		case []byte:
+			res[i] = string(v)
+		default:
+			res[i] = fmt.Sprint(v)
+		}
+	}
+	return res
+}
@@ -3,72 +3,178 @@ package service
 import (
 	"context"
 	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Storage interface {
 	Set(ctx context.Context, key string, value interface{}, expiresAt *time.Time) (cmd.Entry, error)
 	Get(ctx context.Context, key string) (cmd.Entry, error)
+	GetTyped(ctx context.Context, key string, typ cmd.ValueType) (cmd.Entry, error)
+	GetString(ctx context.Context, key string) ([]byte, cmd.Entry, error)
+	GetHash(ctx context.Context, key string) (cmd.Hash, cmd.Entry, error)
 	Del(ctx context.Context, key string) (cmd.Entry, error)
+	Len(ctx context.Context) int
+	Flush(ctx context.Context, async bool) error
+	Range(ctx context.Context, f func(string, cmd.Entry) bool)
+	Indexes() *search.Registry
+	Watch(key string)
+	Unwatch(key string)
+	Revision(ctx context.Context, key string) uint64
 }
 
 type RedisService struct {
-	lock      chan struct{}
-	done      chan struct{}
-	storage   Storage
+	locks *keyLocks
+	// commands locate keys of commands to lock.
+	commands *cmd.CommandTable
+	done     chan struct{}
+	// dbLock guards the order of databases changed by SWAPDB.
+	dbLock    sync.RWMutex
+	databases []Storage
 	wal       chan []cmd.Command
+	// walLock serializes appends, so a SELECT is logged right before commands of its database.
+	walLock   sync.Mutex
+	walDB     int
 	listeners map[string]chan []cmd.Command
+	scripts   *cmd.ScriptCache
+	functions *cmd.FunctionRegistry
+	monitor   *cmd.ScriptMonitor
+	modules   *cmd.ModuleRegistry
+	shutdown  chan struct{}
+	stopOnce  sync.Once
+	// interceptors are called around every command of clients.
+	interceptors []Interceptor
+	// clients counts created clients to assign their IDs.
+	clients atomic.Uint64
 }
 
-func NewService(storage Storage, walSize int) *RedisService {
+func NewService(databases []Storage, walSize int) *RedisService {
+	if len(databases) == 0 {
+		panic("at least one database is required")
+	}
 	s := &RedisService{
-		storage: storage,
-		wal:     make(chan []cmd.Command, walSize),
-		lock:    make(chan struct{}, 1),
-		done:    make(chan struct{}),
+		databases: databases,
+		wal:       make(chan []cmd.Command, walSize),
+		listeners: make(map[string]chan []cmd.Command),
+		locks:     newKeyLocks(),
+		commands:  cmd.NewCommandTable(),
+		done:      make(chan struct{}),
+		scripts:   cmd.NewScriptCache(),
+		functions: cmd.NewFunctionRegistry(),
+		monitor:   cmd.NewScriptMonitor(cmd.DefaultBusyReplyThreshold),
+		modules:   cmd.NewModuleRegistry(),
+		shutdown:  make(chan struct{}),
 	}
+	s.commands.UseModules(s.modules)
 	s.Run()
 	return s
 }
 
-func (s *RedisService) Lock(ctx context.Context) error {
-	select {
-	case s.lock <- struct{}{}:
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+// Lock acquires locks of the set. While a busy script holds the global lock, it fails with a BUSY error.
+func (s *RedisService) Lock(ctx context.Context, set LockSet) error {
+	for {
+		changed, err := s.monitor.Busy()
+		if err != nil {
+			return err
+		}
+		if ok, err := s.locks.acquire(ctx, set, changed); ok || err != nil {
+			return err
+		}
+	}
+}
+
+func (s *RedisService) Unlock(set LockSet) {
+	s.locks.release(set)
+}
+
+// Scripts returns scripts cached by EVAL and SCRIPT LOAD.
+func (s *RedisService) Scripts() *cmd.ScriptCache {
+	return s.scripts
+}
+
+// Functions returns libraries loaded by FUNCTION LOAD.
+func (s *RedisService) Functions() *cmd.FunctionRegistry {
+	return s.functions
+}
+
+// ScriptMonitor returns the monitor of running scripts and functions.
+func (s *RedisService) ScriptMonitor() *cmd.ScriptMonitor {
+	return s.monitor
+}
+
+// Modules returns loaded modules.
+func (s *RedisService) Modules() *cmd.ModuleRegistry {
+	return s.modules
+}
+
+// Shutdown requests the server to stop. It can be called many times.
+func (s *RedisService) Shutdown() {
+	s.stopOnce.Do(func() { close(s.shutdown) })
+}
+
+// ShutdownRequested returns a channel closed when a client requested the server to stop.
+func (s *RedisService) ShutdownRequested() <-chan struct{} {
+	return s.shutdown
+}
+
+func (s *RedisService) Database(index int) (Storage, error) {
+	s.dbLock.RLock()
+	defer s.dbLock.RUnlock()
+	if index < 0 || index >= len(s.databases) {
+		return nil, cmd.ErrInvalidDB
 	}
+	return s.databases[index], nil
 }
 
-func (s *RedisService) Unlock() {
-	<-s.lock
+func (s *RedisService) Databases() int {
+	return len(s.databases)
 }
 
-func (s *RedisService) Storage() Storage {
-	return s.storage
+// SwapDB swaps contents of two databases. Must be called under an exclusive lock.
+func (s *RedisService) SwapDB(first, second int) error {
+	s.dbLock.Lock()
+	defer s.dbLock.Unlock()
+	if first < 0 || first >= len(s.databases) || second < 0 || second >= len(s.databases) {
+		return cmd.ErrInvalidDB
+	}
+	s.databases[first], s.databases[second] = s.databases[second], s.databases[first]
+	return nil
 }
 
 type atomicFunc func(context.Context) error
 
-func (s *RedisService) Atomic(ctx context.Context, f atomicFunc) error {
+// Atomic calls f holding locks of the set.
+func (s *RedisService) Atomic(ctx context.Context, set LockSet, f atomicFunc) error {
 	atomicCtx, cancel := context.WithCancel(ctx)
 
 	defer cancel()
 
-	if err := s.Lock(atomicCtx); err != nil {
+	if err := s.Lock(atomicCtx, set); err != nil {
 		return err
 	}
 
-	defer s.Unlock()
+	defer s.Unlock(set)
 
 	return f(atomicCtx)
 }
 
-func (s *RedisService) WalAppend(ctx context.Context, commands ...cmd.Command) error {
+// WalAppend appends commands executed against database db to the log.
+// A SELECT is logged first whenever db differs from the database of the previous entry,
+// so the log can be replayed without knowing which client produced each command.
+// Must be called under Atomic.
+func (s *RedisService) WalAppend(ctx context.Context, db int, commands ...cmd.Command) error {
+	s.walLock.Lock()
+	defer s.walLock.Unlock()
+	if db != s.walDB {
+		commands = append([]cmd.Command{cmd.Select(db)}, commands...)
+	}
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	case s.wal <- commands:
+		s.walDB = db
 		return nil
 	}
 }
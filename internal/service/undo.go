@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/pkg/search"
+)
+
+var ErrRolledBack = errors.New("ROLLBACK Transaction rolled back")
+
+// beforeImage is a state of a key before it was first touched by a transaction.
+type beforeImage struct {
+	storage   Storage
+	key       string
+	exists    bool
+	value     interface{}
+	expiresAt *time.Time
+}
+
+type undoKey struct {
+	storage Storage
+	key     string
+}
+
+// undoLog records before-images of everything changed by an atomic transaction,
+// so the changes can be reverted if any command fails.
+type undoLog struct {
+	images  []beforeImage
+	seen    map[undoKey]struct{}
+	indexes map[Storage]map[string]*search.Index
+	swaps   [][2]int
+	// functions are loaded libraries before the transaction, if it changed them.
+	functions         *cmd.FunctionRegistry
+	functionsSnapshot map[string]*cmd.Library
+}
+
+func newUndoLog() *undoLog {
+	return &undoLog{
+		seen:    make(map[undoKey]struct{}),
+		indexes: make(map[Storage]map[string]*search.Index),
+	}
+}
+
+// record records a before-image of key unless it was already recorded. Values that will be
+// returned to a command are copied, because commands modify values in place.
+func (l *undoLog) record(ctx context.Context, s Storage, key string, copyValue bool) error {
+	if _, ok := l.seen[undoKey{storage: s, key: key}]; ok {
+		return nil
+	}
+	entry, err := s.Get(ctx, key)
+	if errors.Is(err, cmd.ErrKeyNotFound) {
+		l.add(beforeImage{storage: s, key: key})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	value := entry.Value()
+	if copyValue {
+		if value, err = cmd.CloneValue(value); err != nil {
+			return err
+		}
+	}
+	l.add(beforeImage{storage: s, key: key, exists: true, value: value, expiresAt: entry.ExpiresAt()})
+	return nil
+}
+
+func (l *undoLog) add(image beforeImage) {
+	l.seen[undoKey{storage: image.storage, key: image.key}] = struct{}{}
+	l.images = append(l.images, image)
+}
+
+func (l *undoLog) recordIndexes(s Storage) {
+	if _, ok := l.indexes[s]; !ok {
+		l.indexes[s] = s.Indexes().Snapshot()
+	}
+}
+
+func (l *undoLog) recordFunctions(r *cmd.FunctionRegistry) {
+	if l.functions == nil {
+		l.functions = r
+		l.functionsSnapshot = r.Snapshot()
+	}
+}
+
+// rollback reverts recorded changes. Index definitions are restored before keys,
+// so restored hashes are indexed by them.
+func (l *undoLog) rollback(ctx context.Context, service *RedisService) error {
+	var errs []error
+	for i := len(l.swaps) - 1; i >= 0; i-- {
+		errs = append(errs, service.SwapDB(l.swaps[i][0], l.swaps[i][1]))
+	}
+	for s, snapshot := range l.indexes {
+		s.Indexes().Restore(snapshot)
+	}
+	if l.functions != nil {
+		l.functions.Restore(l.functionsSnapshot)
+	}
+	for _, image := range l.images {
+		if image.exists {
+			_, err := image.storage.Set(ctx, image.key, image.value, image.expiresAt)
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := image.storage.Del(ctx, image.key); err != nil && !errors.Is(err, cmd.ErrKeyNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// undoStorage records before-images of keys to the undo log before passing calls to the storage.
+// Values visited by Range aren't recorded, so commands must not modify them.
+type undoStorage struct {
+	Storage
+	log *undoLog
+}
+
+func (s *undoStorage) Get(ctx context.Context, key string) (cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, true); err != nil {
+		return nil, err
+	}
+	return s.Storage.Get(ctx, key)
+}
+
+func (s *undoStorage) GetTyped(ctx context.Context, key string, typ cmd.ValueType) (cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, true); err != nil {
+		return nil, err
+	}
+	return s.Storage.GetTyped(ctx, key, typ)
+}
+
+func (s *undoStorage) GetString(ctx context.Context, key string) ([]byte, cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, true); err != nil {
+		return nil, nil, err
+	}
+	return s.Storage.GetString(ctx, key)
+}
+
+func (s *undoStorage) GetHash(ctx context.Context, key string) (cmd.Hash, cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, true); err != nil {
+		return nil, nil, err
+	}
+	return s.Storage.GetHash(ctx, key)
+}
+
+// Set doesn't copy the old value. It becomes unreachable, so nothing can modify it.
+func (s *undoStorage) Set(ctx context.Context, key string, value interface{}, expiresAt *time.Time) (cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, false); err != nil {
+		return nil, err
+	}
+	return s.Storage.Set(ctx, key, value, expiresAt)
+}
+
+func (s *undoStorage) Del(ctx context.Context, key string) (cmd.Entry, error) {
+	if err := s.log.record(ctx, s.Storage, key, false); err != nil {
+		return nil, err
+	}
+	return s.Storage.Del(ctx, key)
+}
+
+func (s *undoStorage) Flush(ctx context.Context, async bool) error {
+	var err error
+	s.Storage.Range(ctx, func(key string, _ cmd.Entry) bool {
+		err = s.log.record(ctx, s.Storage, key, false)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("record flushed keys: %w", err)
+	}
+	return s.Storage.Flush(ctx, async)
+}
+
+func (s *undoStorage) Indexes() *search.Registry {
+	s.log.recordIndexes(s.Storage)
+	return s.Storage.Indexes()
+}
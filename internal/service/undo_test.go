@@ -0,0 +1,198 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/internal/domain/cmd"
+	"github.com/burenotti/redis_impl/internal/service"
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// must unwraps a command built from valid arguments.
+func must(command cmd.Command, err error) cmd.Command {
+	if err != nil {
+		panic(err)
+	}
+	return command
+}
+
+// replies runs commands and returns their replies, errors included.
+func replies(ctx context.Context, c *service.Client, commands ...cmd.Command) []interface{} {
+	var res []interface{}
+	for _, command := range commands {
+		r, _ := c.Run(ctx, command)
+		res = append(res, r.Values...)
+	}
+	return res
+}
+
+// walListener listens to the WAL of the service. Listeners must be added before commands run.
+func walListener(redis *service.RedisService) chan []cmd.Command {
+	ch := make(chan []cmd.Command, 64)
+	redis.AddWalListener("test", ch)
+	return ch
+}
+
+// logged reads n appends of the WAL and returns arguments of their commands.
+func logged(t *testing.T, ch chan []cmd.Command, n int) [][]interface{} {
+	t.Helper()
+	var res [][]interface{}
+	for range n {
+		select {
+		case commands := <-ch:
+			for _, command := range commands {
+				res = append(res, command.Args())
+			}
+		case <-time.After(time.Second):
+			require.FailNow(t, "WAL append timed out")
+		}
+	}
+	return res
+}
+
+func args(commands ...cmd.Command) [][]interface{} {
+	res := make([][]interface{}, len(commands))
+	for i, command := range commands {
+		res[i] = command.Args()
+	}
+	return res
+}
+
+// execAtomic runs commands in a MULTI ATOMIC transaction and returns the result of EXEC.
+func execAtomic(ctx context.Context, t *testing.T, c *service.Client, commands ...cmd.Command) (*cmd.Result, error) {
+	t.Helper()
+	res, err := c.Run(ctx, cmd.Multi(true))
+	require.NoError(t, err)
+	require.Equal(t, cmd.OkResult(), res)
+	for _, command := range commands {
+		res, err := c.Run(ctx, command)
+		require.NoError(t, err)
+		require.Equal(t, cmd.NewResult("QUEUED"), res)
+	}
+	return c.Run(ctx, cmd.Exec())
+}
+
+func TestClient_ExecTx_atomicRollback(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("keys", func(t *testing.T) {
+		t.Parallel()
+		redis := newService(t)
+		wal := walListener(redis)
+		c := service.NewClient(redis)
+
+		one := int64(1)
+		setup := []cmd.Command{
+			set(t, "string", "old"),
+			set(t, "deleted", "kept"),
+			cmd.HSet("hash", cmd.HashField{Field: "f", Value: []byte("old")}),
+			must(cmd.JSONSet("json", "$", []byte(`{"a":1}`), "")),
+			cmd.TSAdd("series", &one, 1, "", timeseries.Options{}),
+		}
+		for _, command := range setup {
+			_, err := c.Run(ctx, command)
+			require.NoError(t, err)
+		}
+		reads := []cmd.Command{
+			cmd.Get("string"), cmd.Get("deleted"), cmd.Get("created"), cmd.HGetAll("hash"),
+			must(cmd.JSONGet("json", jsondoc.Format{}, "$")), cmd.TSGet("series"),
+		}
+		before := replies(ctx, c, reads...)
+
+		two := int64(2)
+		_, err := execAtomic(ctx, t, c,
+			set(t, "string", "new"),
+			cmd.Del("deleted"),
+			set(t, "created", "new"),
+			cmd.HSet("hash", cmd.HashField{Field: "f", Value: []byte("new")}),
+			must(cmd.JSONSet("json", "$.a", []byte("2"), "")),
+			cmd.TSAdd("series", &two, 2, "", timeseries.Options{}),
+			// Fails with WRONGTYPE.
+			cmd.HSet("string", cmd.HashField{Field: "f", Value: []byte("v")}),
+		)
+		require.ErrorIs(t, err, service.ErrRolledBack)
+		require.ErrorIs(t, err, cmd.ErrWrongType)
+		assert.Equal(t, before, replies(ctx, c, reads...))
+
+		// Nothing of the transaction is logged before the marker.
+		marker := set(t, "marker", "value")
+		_, err = c.Run(ctx, marker)
+		require.NoError(t, err)
+		assert.Equal(t, args(append(setup, marker)...), logged(t, wal, len(setup)+1))
+	})
+
+	t.Run("databases and indexes", func(t *testing.T) {
+		t.Parallel()
+		redis := newService(t)
+		wal := walListener(redis)
+		c := service.NewClient(redis)
+
+		setup := []cmd.Command{
+			cmd.HSet("doc:1", cmd.HashField{Field: "title", Value: []byte("hello")}),
+			must(cmd.FTCreate(search.Definition{
+				Name: "idx", Prefixes: []string{"doc:"}, Fields: []search.Field{{Name: "title", Type: search.FieldText, Weight: 1}},
+			})),
+			cmd.Select(1),
+			set(t, "other", "value"),
+			cmd.Select(0),
+		}
+		for _, command := range setup {
+			_, err := c.Run(ctx, command)
+			require.NoError(t, err)
+		}
+		reads := []cmd.Command{
+			cmd.HGetAll("doc:1"), cmd.FTInfo("idx"), cmd.FTInfo("created"),
+			must(cmd.FTSearch("idx", "hello", cmd.SearchOptions{NoContent: true})),
+			cmd.Select(1), cmd.Get("other"), cmd.Select(0),
+		}
+		before := replies(ctx, c, reads...)
+
+		_, err := execAtomic(ctx, t, c,
+			cmd.FTDropIndex("idx", false),
+			must(cmd.FTCreate(search.Definition{
+				Name: "created", Prefixes: []string{"doc:"}, Fields: []search.Field{{Name: "title", Type: search.FieldText, Weight: 1}},
+			})),
+			cmd.SwapDB(0, 1),
+			cmd.FlushAll(cmd.FlushSync),
+			cmd.Select(1),
+			// Fails with an invalid DB index.
+			cmd.SwapDB(0, redis.Databases()),
+		)
+		require.ErrorIs(t, err, service.ErrRolledBack)
+		require.ErrorIs(t, err, cmd.ErrInvalidDB)
+		assert.Equal(t, before, replies(ctx, c, reads...))
+
+		marker := set(t, "marker", "value")
+		_, err = c.Run(ctx, marker)
+		require.NoError(t, err)
+		assert.Equal(t, [][]interface{}{
+			setup[0].Args(), setup[1].Args(), cmd.Select(1).Args(), setup[3].Args(), cmd.Select(0).Args(), marker.Args(),
+		}, logged(t, wal, 4))
+	})
+}
+
+func TestClient_ExecTx_atomicLog(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redis := newService(t)
+	wal := walListener(redis)
+	c := service.NewClient(redis)
+
+	first, second, deleted := set(t, "first", "1"), set(t, "second", "2"), cmd.Del("first")
+	res, err := execAtomic(ctx, t, c, first, cmd.Select(1), second, cmd.Get("second"), cmd.Select(0), deleted)
+	require.NoError(t, err)
+	assert.Equal(t, cmd.NewResult([]interface{}{"OK", "OK", "OK", []byte("2"), "OK", int64(1)}), res)
+
+	// Every modifying command is logged once, preceded by a SELECT of its database.
+	marker := set(t, "marker", "value")
+	_, err = c.Run(ctx, marker)
+	require.NoError(t, err)
+	assert.Equal(t, args(first, cmd.Select(1), second, cmd.Select(0), deleted, marker), logged(t, wal, 4))
+}
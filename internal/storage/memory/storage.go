@@ -2,16 +2,28 @@ package memory
 
 import (
 	"context"
+	"fmt"
 	"github.com/burenotti/redis_impl/internal/domain/cmd"
 	"github.com/burenotti/redis_impl/pkg/algo/heap"
+	"github.com/burenotti/redis_impl/pkg/search"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type ValueType int
+// revisions is shared by all storages, so a revision identifies a single change of the
+// keyspace and a recreated key never gets a revision it had before.
+var revisions atomic.Uint64
+
+func nextRevision() uint64 {
+	return revisions.Add(1)
+}
 
 type Entry struct {
 	key       string
 	value     interface{}
+	typ       cmd.ValueType
+	encoding  string
 	revision  uint64
 	expiresAt *time.Time
 }
@@ -24,6 +36,15 @@ func (e *Entry) Value() interface{} {
 	return e.value
 }
 
+// Type returns the type tag assigned to the value when it was stored.
+func (e *Entry) Type() cmd.ValueType {
+	return e.typ
+}
+
+func (e *Entry) Encoding() string {
+	return e.encoding
+}
+
 func (e *Entry) ExpiresAt() *time.Time {
 	return e.expiresAt
 }
@@ -32,10 +53,21 @@ func (e *Entry) Revision() uint64 {
 	return e.revision
 }
 
+// Storage is safe for concurrent use by commands holding different keys. Range, Len, Flush
+// and indexes must be used exclusively, because they cover all keys.
 type Storage struct {
+	// mu guards the keyspace, not values, which are guarded by locks of their keys.
+	mu          sync.Mutex
 	kv          map[string]*Entry
 	lock        chan struct{}
 	expirations *heap.Heap[string]
+	// indexes are kept up to date on every change of the keyspace,
+	// so they never drift from stored hashes.
+	indexes *search.Registry
+	// watched counts watches of keys. Deletions of watched keys are recorded as tombstones,
+	// so a watched key that is created and deleted again doesn't look unchanged.
+	watched    map[string]int
+	tombstones map[string]uint64
 }
 
 func New() *Storage {
@@ -43,6 +75,9 @@ func New() *Storage {
 		kv:          make(map[string]*Entry),
 		lock:        make(chan struct{}, 1),
 		expirations: heap.OfOrdered[string](),
+		indexes:     search.NewRegistry(),
+		watched:     make(map[string]int),
+		tombstones:  make(map[string]uint64),
 	}
 }
 
@@ -52,18 +87,37 @@ func (s *Storage) Set(
 	value interface{},
 	expiresAt *time.Time,
 ) (cmd.Entry, error) {
-	prevRev := s.revision(key)
+	typ := cmd.TypeOfValue(value)
+	if typ == cmd.ValueNone {
+		return nil, fmt.Errorf("%w: %T", cmd.ErrUnsupportedValue, value)
+	}
 	e := &Entry{
 		key:       key,
 		value:     value,
-		revision:  prevRev + 1,
+		typ:       typ,
+		encoding:  cmd.EncodingOf(value),
+		revision:  nextRevision(),
 		expiresAt: expiresAt,
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.kv[key] = e
+	delete(s.tombstones, key)
+	if hash, ok := value.(cmd.Hash); ok {
+		s.indexes.Update(key, hash)
+	} else {
+		s.indexes.Remove(key)
+	}
 	return e, nil
 }
 
 func (s *Storage) Get(_ context.Context, key string) (cmd.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+func (s *Storage) get(key string) (cmd.Entry, error) {
 	e, ok := s.kv[key]
 	if !ok {
 		return nil, cmd.ErrKeyNotFound
@@ -77,22 +131,129 @@ func (s *Storage) Get(_ context.Context, key string) (cmd.Entry, error) {
 	return e, nil
 }
 
+// GetTyped checks type tags of entries, so commands don't check types of values themselves.
+func (s *Storage) GetTyped(ctx context.Context, key string, typ cmd.ValueType) (cmd.Entry, error) {
+	e, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type() != typ {
+		return nil, cmd.ErrWrongType
+	}
+	return e, nil
+}
+
+func (s *Storage) GetString(ctx context.Context, key string) ([]byte, cmd.Entry, error) {
+	e, err := s.GetTyped(ctx, key, cmd.ValueString)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch v := e.Value().(type) {
+	case string:
+		return []byte(v), e, nil
+	default:
+		return v.([]byte), e, nil //nolint:forcetypeassert // the type is checked by the tag
+	}
+}
+
+func (s *Storage) GetHash(ctx context.Context, key string) (cmd.Hash, cmd.Entry, error) {
+	e, err := s.GetTyped(ctx, key, cmd.ValueHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.Value().(cmd.Hash), e, nil //nolint:forcetypeassert // the type is checked by the tag
+}
+
 func (s *Storage) Del(_ context.Context, key string) (cmd.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.del(key)
 }
 
+func (s *Storage) Len(_ context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.kv)
+}
+
+// Flush removes all keys from the storage. In async mode the old keyspace
+// is detached and left for the garbage collector instead of being cleared in place.
+func (s *Storage) Flush(_ context.Context, async bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indexes.Clear()
+	for key := range s.watched {
+		if _, ok := s.kv[key]; ok {
+			s.tombstones[key] = nextRevision()
+		}
+	}
+	if async {
+		s.kv = make(map[string]*Entry)
+		s.expirations = heap.OfOrdered[string]()
+		return nil
+	}
+	clear(s.kv)
+	s.expirations = heap.OfOrdered[string]()
+	return nil
+}
+
+// Indexes returns search indexes of the keyspace.
+func (s *Storage) Indexes() *search.Registry {
+	return s.indexes
+}
+
+// Range calls f for every key that is not expired until f returns false.
+// The keyspace isn't locked, so f can use the storage.
+func (s *Storage) Range(_ context.Context, f func(key string, entry cmd.Entry) bool) {
+	now := time.Now()
+	for key, e := range s.kv {
+		if e.expiresAt != nil && e.expiresAt.Before(now) {
+			continue
+		}
+		if !f(key, e) {
+			return
+		}
+	}
+}
+
 func (s *Storage) del(key string) (cmd.Entry, error) {
 	e, ok := s.kv[key]
 	if !ok {
 		return nil, cmd.ErrKeyNotFound
 	}
 	delete(s.kv, key)
+	s.indexes.Remove(key)
+	if s.watched[key] > 0 {
+		s.tombstones[key] = nextRevision()
+	}
 	return e, nil
 }
 
-func (s *Storage) revision(key string) uint64 {
-	if val, ok := s.kv[key]; ok {
-		return val.revision
+// Watch starts tracking deletions of the key. Every call must be paired with Unwatch.
+func (s *Storage) Watch(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watched[key]++
+}
+
+func (s *Storage) Unwatch(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watched[key]--
+	if s.watched[key] <= 0 {
+		delete(s.watched, key)
+		delete(s.tombstones, key)
+	}
+}
+
+// Revision returns revision of the last change of the key. Missing keys have revision
+// of their last deletion while they are watched and zero otherwise.
+func (s *Storage) Revision(_ context.Context, key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.get(key)
+	if err != nil {
+		return s.tombstones[key]
 	}
-	return 0
+	return e.Revision()
 }
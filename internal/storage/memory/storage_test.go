@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/burenotti/redis_impl/internal/domain/cmd"
 	"github.com/burenotti/redis_impl/internal/storage/memory"
+	"github.com/burenotti/redis_impl/pkg/search"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -26,14 +27,15 @@ func TestStorage_canSetValues(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, value)
 	assert.Equal(t, "artem", value.Value())
-	assert.EqualValues(t, 1, value.Revision())
+	assert.Positive(t, value.Revision())
 	assert.Equal(t, "first_name", value.(*memory.Entry).Key())
 	assert.Nil(t, value.ExpiresAt())
+	firstRevision := value.Revision()
 
 	value, err = storage.Get(ctx, "last_name")
 	require.NoError(t, err)
 	assert.Equal(t, "burenin", value.Value())
-	assert.EqualValues(t, 1, value.Revision())
+	assert.Greater(t, value.Revision(), firstRevision)
 	assert.Nil(t, value.ExpiresAt())
 
 	value, err = storage.Get(ctx, "middle_name")
@@ -75,3 +77,124 @@ func TestStorage_canDeleteValues(t *testing.T) {
 	_, err = storage.Del(ctx, "first_name")
 	require.ErrorIs(t, err, cmd.ErrKeyNotFound)
 }
+
+func TestStorage_revisionsNeverRepeat(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	storage := memory.New()
+
+	e, err := storage.Set(ctx, "key", "value", nil)
+	require.NoError(t, err)
+	watched := e.Revision()
+	storage.Watch("key")
+	defer storage.Unwatch("key")
+	assert.Equal(t, watched, storage.Revision(ctx, "key"))
+
+	// Recreated keys get new revisions.
+	_, err = storage.Del(ctx, "key")
+	require.NoError(t, err)
+	deleted := storage.Revision(ctx, "key")
+	assert.Greater(t, deleted, watched)
+	e, err = storage.Set(ctx, "key", "value", nil)
+	require.NoError(t, err)
+	assert.Greater(t, e.Revision(), deleted)
+
+	// Watched keys that are created and deleted again don't look unchanged.
+	storage.Watch("missing")
+	defer storage.Unwatch("missing")
+	assert.Zero(t, storage.Revision(ctx, "missing"))
+	_, err = storage.Set(ctx, "missing", "value", nil)
+	require.NoError(t, err)
+	_, err = storage.Del(ctx, "missing")
+	require.NoError(t, err)
+	assert.NotZero(t, storage.Revision(ctx, "missing"))
+
+	before := storage.Revision(ctx, "key")
+	require.NoError(t, storage.Flush(ctx, false))
+	assert.Greater(t, storage.Revision(ctx, "key"), before)
+}
+
+func TestStorage_canFlushValues(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, async := range []bool{false, true} {
+		storage := memory.New()
+		_, _ = storage.Set(ctx, "first_name", "artem", nil)
+		_, _ = storage.Set(ctx, "last_name", "burenin", nil)
+		assert.Equal(t, 2, storage.Len(ctx))
+
+		require.NoError(t, storage.Flush(ctx, async))
+		assert.Equal(t, 0, storage.Len(ctx))
+		_, err := storage.Get(ctx, "first_name")
+		require.ErrorIs(t, err, cmd.ErrKeyNotFound)
+	}
+}
+
+func TestStorage_keepsIndexesUpToDate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	storage := memory.New()
+	idx, err := storage.Indexes().Create(search.Definition{
+		Name:     "users",
+		Prefixes: []string{"user:"},
+		Fields:   []search.Field{{Name: "name", Type: search.FieldText, Weight: 1}},
+	})
+	require.NoError(t, err)
+
+	_, err = storage.Set(ctx, "user:1", cmd.Hash{"name": []byte("Alice")}, nil)
+	require.NoError(t, err)
+	_, err = storage.Set(ctx, "user:2", cmd.Hash{"name": []byte("Bob")}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, idx.NumDocs())
+
+	// Overwriting a hash with another type removes it from indexes.
+	_, err = storage.Set(ctx, "user:1", "Alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, idx.NumDocs())
+
+	_, err = storage.Del(ctx, "user:2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, idx.NumDocs())
+
+	_, err = storage.Set(ctx, "user:3", cmd.Hash{"name": []byte("Carol")}, nil)
+	require.NoError(t, err)
+	require.NoError(t, storage.Flush(ctx, false))
+	assert.Equal(t, 0, idx.NumDocs())
+	assert.Equal(t, []string{"users"}, storage.Indexes().Names())
+}
+
+func TestStorage_typedGets(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	storage := memory.New()
+
+	_, err := storage.Set(ctx, "counter", []byte("42"), nil)
+	require.NoError(t, err)
+	_, err = storage.Set(ctx, "user", cmd.Hash{"name": []byte("Alice")}, nil)
+	require.NoError(t, err)
+	_, err = storage.Set(ctx, "bad", 42, nil)
+	require.ErrorIs(t, err, cmd.ErrUnsupportedValue)
+
+	value, entry, err := storage.GetString(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("42"), value)
+	assert.Equal(t, cmd.ValueString, entry.Type())
+	assert.Equal(t, cmd.EncodingInt, entry.Encoding())
+
+	hash, entry, err := storage.GetHash(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, cmd.Hash{"name": []byte("Alice")}, hash)
+	assert.Equal(t, cmd.TypeHash, entry.Type().String())
+	assert.Equal(t, cmd.EncodingListpack, entry.Encoding())
+
+	_, _, err = storage.GetString(ctx, "user")
+	require.ErrorIs(t, err, cmd.ErrWrongType)
+	_, _, err = storage.GetHash(ctx, "counter")
+	require.ErrorIs(t, err, cmd.ErrWrongType)
+	_, err = storage.GetTyped(ctx, "user", cmd.ValueJSON)
+	require.ErrorIs(t, err, cmd.ErrWrongType)
+	_, _, err = storage.GetHash(ctx, "missing")
+	require.ErrorIs(t, err, cmd.ErrKeyNotFound)
+}
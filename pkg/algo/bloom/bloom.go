@@ -0,0 +1,236 @@
+// Package bloom implements a scalable Bloom filter. When a filter reaches its capacity a new
+// layer with larger capacity and tighter error rate is added, so the total false positive
+// rate stays below the requested one.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/burenotti/redis_impl/pkg/algo/hashing"
+	"github.com/burenotti/redis_impl/pkg/algo/internal/encoding"
+)
+
+var (
+	ErrFull           = errors.New("non scaling filter is full")
+	ErrInvalidOptions = errors.New("invalid filter options")
+	ErrCorrupted      = encoding.ErrCorrupted
+)
+
+const (
+	DefaultErrorRate = 0.01
+	DefaultCapacity  = 100
+	DefaultExpansion = 2
+
+	// tighteningRatio is a ratio of error rates of two subsequent layers.
+	tighteningRatio = 0.5
+	minBits         = 64
+	encodingVersion = 1
+)
+
+type Options struct {
+	// ErrorRate is a desired probability of false positives.
+	ErrorRate float64
+	// Capacity is an amount of items the first layer can hold.
+	Capacity uint64
+	// Expansion is a capacity ratio of two subsequent layers.
+	Expansion  uint64
+	NonScaling bool
+}
+
+type layer struct {
+	bits     []uint64
+	size     uint64
+	hashes   uint64
+	capacity uint64
+	count    uint64
+}
+
+func newLayer(capacity uint64, errorRate float64) *layer {
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	size = max(size, minBits)
+	hashes := uint64(math.Ceil(math.Ln2 * float64(size) / float64(capacity)))
+	return &layer{
+		bits:     make([]uint64, (size+63)/64),
+		size:     size,
+		hashes:   max(hashes, 1),
+		capacity: capacity,
+	}
+}
+
+// test reports whether all bits of the item are set. Bit positions are produced with
+// double hashing: h1 + i*h2.
+func (l *layer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % l.size
+		if l.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *layer) set(h1, h2 uint64) {
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % l.size
+		l.bits[pos/64] |= 1 << (pos % 64)
+	}
+	l.count++
+}
+
+type Filter struct {
+	opts   Options
+	layers []*layer
+}
+
+func (o Options) Validate() error {
+	if o.ErrorRate <= 0 || o.ErrorRate >= 1 {
+		return fmt.Errorf("%w: error rate must be in range (0, 1)", ErrInvalidOptions)
+	}
+	if o.Capacity == 0 {
+		return fmt.Errorf("%w: capacity must be positive", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// New creates a filter. Zero Expansion means DefaultExpansion.
+func New(opts Options) (*Filter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Expansion == 0 {
+		opts.Expansion = DefaultExpansion
+	}
+	f := &Filter{opts: opts}
+	f.layers = []*layer{newLayer(opts.Capacity, opts.ErrorRate)}
+	return f, nil
+}
+
+func itemHashes(item []byte) (uint64, uint64) {
+	h := hashing.Sum64(item, 0)
+	return h, hashing.Mix64(h) | 1
+}
+
+// Add adds an item and reports whether it wasn't present in the filter.
+func (f *Filter) Add(item []byte) (bool, error) {
+	h1, h2 := itemHashes(item)
+	if f.exists(h1, h2) {
+		return false, nil
+	}
+	last := f.layers[len(f.layers)-1]
+	if last.count >= last.capacity {
+		if f.opts.NonScaling {
+			return false, ErrFull
+		}
+		errorRate := f.opts.ErrorRate * math.Pow(tighteningRatio, float64(len(f.layers)))
+		last = newLayer(last.capacity*f.opts.Expansion, errorRate)
+		f.layers = append(f.layers, last)
+	}
+	last.set(h1, h2)
+	return true, nil
+}
+
+// Exists reports whether an item may be present in the filter. False positives are
+// possible, but false negatives are not.
+func (f *Filter) Exists(item []byte) bool {
+	return f.exists(itemHashes(item))
+}
+
+func (f *Filter) exists(h1, h2 uint64) bool {
+	for _, l := range f.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) Options() Options {
+	return f.opts
+}
+
+// Capacity returns total capacity of all layers.
+func (f *Filter) Capacity() uint64 {
+	var total uint64
+	for _, l := range f.layers {
+		total += l.capacity
+	}
+	return total
+}
+
+// Size returns amount of memory used by bits of all layers in bytes.
+func (f *Filter) Size() uint64 {
+	var total uint64
+	for _, l := range f.layers {
+		total += uint64(len(l.bits)) * 8 //nolint:mnd // bytes in uint64
+	}
+	return total
+}
+
+// Filters returns amount of layers.
+func (f *Filter) Filters() int {
+	return len(f.layers)
+}
+
+// Items returns amount of added items.
+func (f *Filter) Items() uint64 {
+	var total uint64
+	for _, l := range f.layers {
+		total += l.count
+	}
+	return total
+}
+
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	buf := []byte{encodingVersion}
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f.opts.ErrorRate))
+	buf = binary.AppendUvarint(buf, f.opts.Capacity)
+	buf = binary.AppendUvarint(buf, f.opts.Expansion)
+	buf = encoding.AppendBool(buf, f.opts.NonScaling)
+	buf = binary.AppendUvarint(buf, uint64(len(f.layers)))
+	for _, l := range f.layers {
+		buf = binary.AppendUvarint(buf, l.size)
+		buf = binary.AppendUvarint(buf, l.hashes)
+		buf = binary.AppendUvarint(buf, l.capacity)
+		buf = binary.AppendUvarint(buf, l.count)
+		for _, word := range l.bits {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+	}
+	return buf, nil
+}
+
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	d := encoding.NewDecoder(data)
+	if d.Byte() != encodingVersion {
+		return ErrCorrupted
+	}
+	var res Filter
+	res.opts.ErrorRate = math.Float64frombits(d.Uint64())
+	res.opts.Capacity = d.Uvarint()
+	res.opts.Expansion = d.Uvarint()
+	res.opts.NonScaling = d.Bool()
+	n := d.Uvarint()
+	for i := uint64(0); i < n && d.Err == nil; i++ {
+		l := &layer{size: d.Uvarint(), hashes: d.Uvarint(), capacity: d.Uvarint(), count: d.Uvarint()}
+		words := (l.size + 63) / 64
+		if l.size == 0 || l.hashes == 0 || words > uint64(d.Remaining())/8 {
+			return ErrCorrupted
+		}
+		l.bits = make([]uint64, words)
+		for j := range l.bits {
+			l.bits[j] = d.Uint64()
+		}
+		res.layers = append(res.layers, l)
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if len(res.layers) == 0 {
+		return ErrCorrupted
+	}
+	*f = res
+	return nil
+}
@@ -0,0 +1,77 @@
+package bloom_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/bloom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_falsePositiveRate(t *testing.T) {
+	t.Parallel()
+	f, err := bloom.New(bloom.Options{ErrorRate: 0.01, Capacity: 1000})
+	require.NoError(t, err)
+
+	for i := 0; i < 10_000; i++ {
+		_, err := f.Add([]byte("item:" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+	assert.Greater(t, f.Filters(), 1)
+	assert.GreaterOrEqual(t, f.Capacity(), uint64(10_000))
+
+	for i := 0; i < 10_000; i++ {
+		assert.True(t, f.Exists([]byte("item:"+strconv.Itoa(i))))
+	}
+	falsePositives := 0
+	for i := 0; i < 10_000; i++ {
+		if f.Exists([]byte("other:" + strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 200)
+}
+
+func TestFilter_nonScaling(t *testing.T) {
+	t.Parallel()
+	f, err := bloom.New(bloom.Options{ErrorRate: 0.001, Capacity: 10, NonScaling: true})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		added, err := f.Add([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+	added, err := f.Add([]byte("0"))
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	_, err = f.Add([]byte("new"))
+	assert.ErrorIs(t, err, bloom.ErrFull)
+}
+
+func TestFilter_invalidOptions(t *testing.T) {
+	t.Parallel()
+	_, err := bloom.New(bloom.Options{ErrorRate: 1, Capacity: 10})
+	assert.ErrorIs(t, err, bloom.ErrInvalidOptions)
+	_, err = bloom.New(bloom.Options{ErrorRate: 0.1})
+	assert.ErrorIs(t, err, bloom.ErrInvalidOptions)
+}
+
+func TestFilter_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	f, err := bloom.New(bloom.Options{ErrorRate: 0.01, Capacity: 10, Expansion: 4})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := f.Add([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+	var restored bloom.Filter
+	require.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, f, &restored)
+
+	assert.ErrorIs(t, restored.UnmarshalBinary(data[:len(data)-1]), bloom.ErrCorrupted)
+}
@@ -0,0 +1,173 @@
+// Package cms implements a Count-Min Sketch, which estimates frequencies of items in
+// sublinear space. Estimates are never lower than real frequencies.
+package cms
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/burenotti/redis_impl/pkg/algo/hashing"
+	"github.com/burenotti/redis_impl/pkg/algo/internal/encoding"
+)
+
+var (
+	ErrInvalidOptions  = errors.New("invalid sketch options")
+	ErrDimensions      = errors.New("width/depth is not equal")
+	ErrCounterOverflow = errors.New("counter overflow")
+	ErrCorrupted       = encoding.ErrCorrupted
+)
+
+const (
+	// maxCounters limits memory of a single sketch to 2 GiB.
+	maxCounters     = 1 << 28
+	encodingVersion = 1
+)
+
+type Sketch struct {
+	width    uint64
+	depth    uint64
+	count    uint64
+	counters []uint64
+}
+
+func ValidateDimensions(width, depth uint64) error {
+	if width == 0 || depth == 0 {
+		return fmt.Errorf("%w: width and depth must be positive", ErrInvalidOptions)
+	}
+	if width > maxCounters/depth {
+		return fmt.Errorf("%w: sketch is too large", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// NewByDim creates a sketch with depth rows of width counters.
+func NewByDim(width, depth uint64) (*Sketch, error) {
+	if err := ValidateDimensions(width, depth); err != nil {
+		return nil, err
+	}
+	return &Sketch{width: width, depth: depth, counters: make([]uint64, width*depth)}, nil
+}
+
+// NewByProb creates a sketch, which overestimates counts by at most errorRate of the total
+// count with the given probability of failure.
+func NewByProb(errorRate, probability float64) (*Sketch, error) {
+	width, depth, err := Dimensions(errorRate, probability)
+	if err != nil {
+		return nil, err
+	}
+	return NewByDim(width, depth)
+}
+
+// Dimensions returns width and depth of a sketch with the given error rate and probability.
+func Dimensions(errorRate, probability float64) (uint64, uint64, error) {
+	if errorRate <= 0 || errorRate >= 1 {
+		return 0, 0, fmt.Errorf("%w: error must be in range (0, 1)", ErrInvalidOptions)
+	}
+	if probability <= 0 || probability >= 1 {
+		return 0, 0, fmt.Errorf("%w: probability must be in range (0, 1)", ErrInvalidOptions)
+	}
+	width := uint64(math.Ceil(2 / errorRate))                             //nolint:mnd // as in RedisBloom
+	depth := uint64(math.Ceil(math.Log10(probability) / math.Log10(0.5))) //nolint:mnd // as in RedisBloom
+	depth = max(depth, 1)
+	return width, depth, ValidateDimensions(width, depth)
+}
+
+func (s *Sketch) Width() uint64 {
+	return s.width
+}
+
+func (s *Sketch) Depth() uint64 {
+	return s.depth
+}
+
+// Count returns total amount of increments.
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+func (s *Sketch) index(item []byte, row uint64) uint64 {
+	return row*s.width + hashing.Sum64(item, row)%s.width
+}
+
+// IncrBy increases count of an item and returns its new estimated count.
+func (s *Sketch) IncrBy(item []byte, incr uint64) (uint64, error) {
+	if s.count+incr < s.count {
+		return 0, ErrCounterOverflow
+	}
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.depth; row++ {
+		i := s.index(item, row)
+		s.counters[i] += incr
+		estimate = min(estimate, s.counters[i])
+	}
+	s.count += incr
+	return estimate, nil
+}
+
+// Query returns estimated count of an item.
+func (s *Sketch) Query(item []byte) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.depth; row++ {
+		estimate = min(estimate, s.counters[s.index(item, row)])
+	}
+	return estimate
+}
+
+// Merge replaces counters of the sketch with a weighted sum of sources. All sketches
+// must have the same dimensions.
+func (s *Sketch) Merge(sources []*Sketch, weights []uint64) error {
+	if len(sources) != len(weights) {
+		return fmt.Errorf("%w: amount of weights must be equal to amount of sources", ErrInvalidOptions)
+	}
+	for _, src := range sources {
+		if src.width != s.width || src.depth != s.depth {
+			return ErrDimensions
+		}
+	}
+
+	counters := make([]uint64, len(s.counters))
+	var count uint64
+	for j, src := range sources {
+		for i, c := range src.counters {
+			counters[i] += c * weights[j]
+		}
+		count += src.count * weights[j]
+	}
+	s.counters = counters
+	s.count = count
+	return nil
+}
+
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	buf := []byte{encodingVersion}
+	buf = binary.AppendUvarint(buf, s.width)
+	buf = binary.AppendUvarint(buf, s.depth)
+	buf = binary.AppendUvarint(buf, s.count)
+	for _, c := range s.counters {
+		buf = binary.AppendUvarint(buf, c)
+	}
+	return buf, nil
+}
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	d := encoding.NewDecoder(data)
+	if d.Byte() != encodingVersion {
+		return ErrCorrupted
+	}
+	res := Sketch{width: d.Uvarint(), depth: d.Uvarint(), count: d.Uvarint()}
+	// Every counter takes at least one byte.
+	if res.width == 0 || res.depth == 0 || res.width > uint64(d.Remaining())/res.depth {
+		return ErrCorrupted
+	}
+	res.counters = make([]uint64, res.width*res.depth)
+	for i := range res.counters {
+		res.counters[i] = d.Uvarint()
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	*s = res
+	return nil
+}
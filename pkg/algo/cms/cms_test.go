@@ -0,0 +1,72 @@
+package cms_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/cms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketch_estimates(t *testing.T) {
+	t.Parallel()
+	s, err := cms.NewByProb(0.001, 0.01)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2000, s.Width())
+	assert.EqualValues(t, 7, s.Depth())
+
+	rnd := rand.New(rand.NewSource(1))
+	exact := map[string]uint64{}
+	for i := 0; i < 100_000; i++ {
+		item := strconv.Itoa(int(rnd.ExpFloat64() * 100))
+		exact[item]++
+		_, err := s.IncrBy([]byte(item), 1)
+		require.NoError(t, err)
+	}
+
+	assert.EqualValues(t, 100_000, s.Count())
+	for item, count := range exact {
+		estimate := s.Query([]byte(item))
+		assert.GreaterOrEqual(t, estimate, count)
+		assert.LessOrEqual(t, estimate, count+uint64(0.001*float64(s.Count())), item)
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	t.Parallel()
+	a, err := cms.NewByDim(100, 5)
+	require.NoError(t, err)
+	b, err := cms.NewByDim(100, 5)
+	require.NoError(t, err)
+	_, err = a.IncrBy([]byte("x"), 3)
+	require.NoError(t, err)
+	_, err = b.IncrBy([]byte("x"), 5)
+	require.NoError(t, err)
+
+	dest, err := cms.NewByDim(100, 5)
+	require.NoError(t, err)
+	require.NoError(t, dest.Merge([]*cms.Sketch{a, b}, []uint64{1, 2}))
+	assert.EqualValues(t, 13, dest.Query([]byte("x")))
+	assert.EqualValues(t, 13, dest.Count())
+
+	other, err := cms.NewByDim(10, 5)
+	require.NoError(t, err)
+	assert.ErrorIs(t, dest.Merge([]*cms.Sketch{other}, []uint64{1}), cms.ErrDimensions)
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	s, err := cms.NewByDim(10, 3)
+	require.NoError(t, err)
+	_, err = s.IncrBy([]byte("x"), 1000)
+	require.NoError(t, err)
+
+	data, err := s.MarshalBinary()
+	require.NoError(t, err)
+	var restored cms.Sketch
+	require.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, s, &restored)
+	assert.ErrorIs(t, restored.UnmarshalBinary(data[:5]), cms.ErrCorrupted)
+}
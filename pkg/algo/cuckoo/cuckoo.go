@@ -0,0 +1,341 @@
+// Package cuckoo implements a scalable Cuckoo filter. Unlike a Bloom filter it supports
+// deletion and counting of items. Every item is represented by an 8-bit fingerprint stored
+// in one of two candidate buckets.
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/burenotti/redis_impl/pkg/algo/hashing"
+	"github.com/burenotti/redis_impl/pkg/algo/internal/encoding"
+)
+
+var (
+	ErrFull           = errors.New("filter is full")
+	ErrInvalidOptions = errors.New("invalid filter options")
+	ErrCorrupted      = encoding.ErrCorrupted
+)
+
+const (
+	DefaultCapacity      = 1024
+	DefaultBucketSize    = 2
+	DefaultMaxIterations = 20
+	DefaultExpansion     = 1
+
+	maxBucketSize   = 255
+	encodingVersion = 1
+)
+
+type Options struct {
+	// Capacity is an amount of items the first layer can hold.
+	Capacity uint64
+	// BucketSize is an amount of fingerprints in a bucket.
+	BucketSize uint64
+	// MaxIterations is an amount of relocations before a layer is considered full.
+	MaxIterations uint64
+	// Expansion is a capacity ratio of two subsequent layers. 0 means the filter doesn't scale.
+	Expansion uint64
+}
+
+// layer is a cuckoo hash table of fingerprints. Amount of buckets is a power of two,
+// so the alternative bucket index can be computed with XOR in both directions.
+type layer struct {
+	buckets    uint64
+	bucketSize uint64
+	data       []byte
+}
+
+func newLayer(capacity, bucketSize uint64) *layer {
+	buckets := uint64(1)
+	for buckets*bucketSize < capacity {
+		buckets <<= 1
+	}
+	return &layer{buckets: buckets, bucketSize: bucketSize, data: make([]byte, buckets*bucketSize)}
+}
+
+func (l *layer) bucket(i uint64) []byte {
+	i &= l.buckets - 1
+	return l.data[i*l.bucketSize : (i+1)*l.bucketSize]
+}
+
+func (l *layer) alt(i uint64, fp byte) uint64 {
+	return (i ^ hashing.Mix64(uint64(fp))) & (l.buckets - 1)
+}
+
+// candidates returns buckets where a fingerprint can be stored.
+func (l *layer) candidates(i uint64, fp byte) [][]byte {
+	i &= l.buckets - 1
+	alt := l.alt(i, fp)
+	if alt == i {
+		return [][]byte{l.bucket(i)}
+	}
+	return [][]byte{l.bucket(i), l.bucket(alt)}
+}
+
+func (l *layer) count(i uint64, fp byte) uint64 {
+	var n uint64
+	for _, b := range l.candidates(i, fp) {
+		for _, v := range b {
+			if v == fp {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func insertInto(bucket []byte, fp byte) bool {
+	for i, v := range bucket {
+		if v == 0 {
+			bucket[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (l *layer) remove(i uint64, fp byte) bool {
+	for _, b := range l.candidates(i, fp) {
+		for j, v := range b {
+			if v == fp {
+				b[j] = 0
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type relocation struct {
+	bucket uint64
+	slot   uint64
+	fp     byte
+}
+
+// insert adds a fingerprint relocating existing ones if both buckets are full.
+// If there is no free slot after maxIterations relocations, all of them are reverted.
+// Victims are selected deterministically by the kick counter, so replaying the same
+// operations always produces the same filter.
+func (l *layer) insert(i uint64, fp byte, maxIterations uint64, kicks *uint64) bool {
+	alt := l.alt(i, fp)
+	if insertInto(l.bucket(i), fp) || insertInto(l.bucket(alt), fp) {
+		return true
+	}
+
+	var history []relocation
+	cur := alt
+	for n := uint64(0); n < maxIterations; n++ {
+		slot := *kicks % l.bucketSize
+		*kicks++
+		b := l.bucket(cur)
+		history = append(history, relocation{bucket: cur, slot: slot, fp: b[slot]})
+		fp, b[slot] = b[slot], fp
+		cur = l.alt(cur, fp)
+		if insertInto(l.bucket(cur), fp) {
+			return true
+		}
+	}
+
+	for j := len(history) - 1; j >= 0; j-- {
+		r := history[j]
+		l.bucket(r.bucket)[r.slot] = r.fp
+	}
+	return false
+}
+
+type Filter struct {
+	opts    Options
+	layers  []*layer
+	items   uint64
+	deleted uint64
+	kicks   uint64
+}
+
+func (o Options) Validate() error {
+	if o.Capacity == 0 {
+		return fmt.Errorf("%w: capacity must be positive", ErrInvalidOptions)
+	}
+	if o.BucketSize > maxBucketSize {
+		return fmt.Errorf("%w: bucket size must not exceed %d", ErrInvalidOptions, maxBucketSize)
+	}
+	return nil
+}
+
+// New creates a filter. Zero BucketSize and MaxIterations mean default values.
+func New(opts Options) (*Filter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.BucketSize == 0 {
+		opts.BucketSize = DefaultBucketSize
+	}
+	if opts.MaxIterations == 0 {
+		opts.MaxIterations = DefaultMaxIterations
+	}
+	f := &Filter{opts: opts}
+	f.layers = []*layer{newLayer(opts.Capacity, opts.BucketSize)}
+	return f, nil
+}
+
+func fingerprint(item []byte) (uint64, byte) {
+	h := hashing.Sum64(item, 0)
+	fp := byte(h >> 56) //nolint:mnd // the highest byte
+	if fp == 0 {
+		fp = 1
+	}
+	return h, fp
+}
+
+// Add adds an item. The same item may be added several times.
+func (f *Filter) Add(item []byte) error {
+	h, fp := fingerprint(item)
+	last := f.layers[len(f.layers)-1]
+	if !last.insert(h, fp, f.opts.MaxIterations, &f.kicks) {
+		if f.opts.Expansion == 0 {
+			return ErrFull
+		}
+		capacity := last.buckets * last.bucketSize * f.opts.Expansion
+		last = newLayer(capacity, f.opts.BucketSize)
+		f.layers = append(f.layers, last)
+		if !last.insert(h, fp, f.opts.MaxIterations, &f.kicks) {
+			return ErrFull
+		}
+	}
+	f.items++
+	return nil
+}
+
+// AddNX adds an item only if it doesn't exist and reports whether it was added.
+func (f *Filter) AddNX(item []byte) (bool, error) {
+	if f.Exists(item) {
+		return false, nil
+	}
+	return true, f.Add(item)
+}
+
+// Delete removes a single occurrence of an item and reports whether it was found.
+// Deleting an item that wasn't added may remove another item with the same fingerprint.
+func (f *Filter) Delete(item []byte) bool {
+	h, fp := fingerprint(item)
+	for i := len(f.layers) - 1; i >= 0; i-- {
+		if f.layers[i].remove(h, fp) {
+			f.items--
+			f.deleted++
+			return true
+		}
+	}
+	return false
+}
+
+// Exists reports whether an item may be present in the filter.
+func (f *Filter) Exists(item []byte) bool {
+	return f.Count(item) > 0
+}
+
+// Count returns an estimated amount of occurrences of an item. It can be greater than
+// the real amount because of fingerprint collisions.
+func (f *Filter) Count(item []byte) uint64 {
+	h, fp := fingerprint(item)
+	var n uint64
+	for _, l := range f.layers {
+		n += l.count(h, fp)
+	}
+	return n
+}
+
+func (f *Filter) Options() Options {
+	return f.opts
+}
+
+// Size returns amount of memory used by fingerprints in bytes.
+func (f *Filter) Size() uint64 {
+	var total uint64
+	for _, l := range f.layers {
+		total += uint64(len(l.data))
+	}
+	return total
+}
+
+// Buckets returns total amount of buckets in all layers.
+func (f *Filter) Buckets() uint64 {
+	var total uint64
+	for _, l := range f.layers {
+		total += l.buckets
+	}
+	return total
+}
+
+// Filters returns amount of layers.
+func (f *Filter) Filters() int {
+	return len(f.layers)
+}
+
+// Items returns amount of stored items.
+func (f *Filter) Items() uint64 {
+	return f.items
+}
+
+// Deleted returns amount of deleted items.
+func (f *Filter) Deleted() uint64 {
+	return f.deleted
+}
+
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	buf := []byte{encodingVersion}
+	buf = binary.AppendUvarint(buf, f.opts.Capacity)
+	buf = binary.AppendUvarint(buf, f.opts.BucketSize)
+	buf = binary.AppendUvarint(buf, f.opts.MaxIterations)
+	buf = binary.AppendUvarint(buf, f.opts.Expansion)
+	buf = binary.AppendUvarint(buf, f.items)
+	buf = binary.AppendUvarint(buf, f.deleted)
+	buf = binary.AppendUvarint(buf, f.kicks)
+	buf = binary.AppendUvarint(buf, uint64(len(f.layers)))
+	for _, l := range f.layers {
+		buf = binary.AppendUvarint(buf, l.buckets)
+		buf = append(buf, l.data...)
+	}
+	return buf, nil
+}
+
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	d := encoding.NewDecoder(data)
+	if d.Byte() != encodingVersion {
+		return ErrCorrupted
+	}
+	var res Filter
+	res.opts = Options{
+		Capacity:      d.Uvarint(),
+		BucketSize:    d.Uvarint(),
+		MaxIterations: d.Uvarint(),
+		Expansion:     d.Uvarint(),
+	}
+	res.items = d.Uvarint()
+	res.deleted = d.Uvarint()
+	res.kicks = d.Uvarint()
+	if res.opts.BucketSize == 0 || res.opts.BucketSize > maxBucketSize {
+		return ErrCorrupted
+	}
+	n := d.Uvarint()
+	for i := uint64(0); i < n && d.Err == nil; i++ {
+		buckets := d.Uvarint()
+		if buckets == 0 || buckets&(buckets-1) != 0 || buckets > uint64(d.Remaining()) {
+			return ErrCorrupted
+		}
+		raw := d.Bytes(buckets * res.opts.BucketSize)
+		res.layers = append(res.layers, &layer{
+			buckets:    buckets,
+			bucketSize: res.opts.BucketSize,
+			data:       append([]byte(nil), raw...),
+		})
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if len(res.layers) == 0 {
+		return ErrCorrupted
+	}
+	*f = res
+	return nil
+}
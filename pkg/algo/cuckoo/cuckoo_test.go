@@ -0,0 +1,84 @@
+package cuckoo_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/cuckoo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	f, err := cuckoo.New(cuckoo.Options{Capacity: 1000, Expansion: 1})
+	require.NoError(t, err)
+
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, f.Add([]byte(strconv.Itoa(i))))
+	}
+	assert.Greater(t, f.Filters(), 1)
+	assert.EqualValues(t, 2000, f.Items())
+	for i := 0; i < 2000; i++ {
+		assert.True(t, f.Exists([]byte(strconv.Itoa(i))), i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.Delete([]byte(strconv.Itoa(i))))
+	}
+	assert.EqualValues(t, 1000, f.Items())
+	assert.EqualValues(t, 1000, f.Deleted())
+	for i := 1000; i < 2000; i++ {
+		assert.True(t, f.Exists([]byte(strconv.Itoa(i))), i)
+	}
+}
+
+func TestFilter_Count(t *testing.T) {
+	t.Parallel()
+	f, err := cuckoo.New(cuckoo.Options{Capacity: 100})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.Add([]byte("item")))
+	}
+	assert.EqualValues(t, 3, f.Count([]byte("item")))
+
+	added, err := f.AddNX([]byte("item"))
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	assert.True(t, f.Delete([]byte("item")))
+	assert.EqualValues(t, 2, f.Count([]byte("item")))
+	assert.False(t, f.Delete([]byte("missing")))
+}
+
+func TestFilter_full(t *testing.T) {
+	t.Parallel()
+	f, err := cuckoo.New(cuckoo.Options{Capacity: 8, BucketSize: 1})
+	require.NoError(t, err)
+
+	var failed error
+	for i := 0; i < 100 && failed == nil; i++ {
+		failed = f.Add([]byte(strconv.Itoa(i)))
+	}
+	assert.ErrorIs(t, failed, cuckoo.ErrFull)
+	assert.Equal(t, 1, f.Filters())
+}
+
+func TestFilter_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	f, err := cuckoo.New(cuckoo.Options{Capacity: 64, BucketSize: 4, Expansion: 2})
+	require.NoError(t, err)
+	for i := 0; i < 500; i++ {
+		require.NoError(t, f.Add([]byte(strconv.Itoa(i))))
+	}
+	f.Delete([]byte("1"))
+
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+	var restored cuckoo.Filter
+	require.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, f, &restored)
+
+	assert.ErrorIs(t, restored.UnmarshalBinary(append(data, 0)), cuckoo.ErrCorrupted)
+}
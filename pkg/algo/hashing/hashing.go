@@ -0,0 +1,30 @@
+// Package hashing provides deterministic non-cryptographic hash functions used by
+// probabilistic data structures. Results don't depend on the process, so structures
+// built from the same input are identical on every replica.
+package hashing
+
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// Sum64 returns 64-bit hash of data with the given seed. It's FNV-1a followed by
+// the splitmix64 finalizer, so every bit of input affects every bit of the result.
+func Sum64(data []byte, seed uint64) uint64 {
+	h := uint64(offset64) ^ Mix64(seed)
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= prime64
+	}
+	return Mix64(h)
+}
+
+// Mix64 is the splitmix64 finalizer.
+func Mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
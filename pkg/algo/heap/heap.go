@@ -53,6 +53,15 @@ func (h *Heap[T]) Pop() (T, bool) {
 	return heap.Pop(&h.data).(T), true //nolint:forcetypeassert // we're sure that type will not raise
 }
 
+// Peek returns the top element without removing it.
+func (h *Heap[T]) Peek() (T, bool) {
+	if h.Len() == 0 {
+		var null T
+		return null, false
+	}
+	return h.data.data[0], true
+}
+
 func (h *Heap[T]) MustPop() T {
 	if val, ok := h.Pop(); ok {
 		return val
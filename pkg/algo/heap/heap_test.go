@@ -40,3 +40,17 @@ func TestHeap_Push(t *testing.T) {
 	}
 	assert.Equal(t, 0, h.Len())
 }
+
+func TestHeap_Peek(t *testing.T) {
+	t.Parallel()
+	h := heap.OfOrdered[int]()
+	_, ok := h.Peek()
+	assert.False(t, ok)
+
+	h.Push(5)
+	h.Push(2)
+	top, ok := h.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, 2, top)
+	assert.Equal(t, 2, h.Len())
+}
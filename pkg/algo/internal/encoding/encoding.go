@@ -0,0 +1,90 @@
+// Package encoding contains helpers for binary serialization of algo data structures.
+package encoding
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrCorrupted = errors.New("corrupted data")
+
+const uint64Size = 8
+
+// Decoder reads values from a buffer. The first failure is remembered in Err,
+// and all subsequent reads return zero values.
+type Decoder struct {
+	data []byte
+	Err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Remaining returns amount of unread bytes.
+func (d *Decoder) Remaining() int {
+	return len(d.data)
+}
+
+func (d *Decoder) Byte() byte {
+	if d.Err != nil || len(d.data) < 1 {
+		d.Err = ErrCorrupted
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *Decoder) Bool() bool {
+	return d.Byte() != 0
+}
+
+func (d *Decoder) Uint64() uint64 {
+	if d.Err != nil || len(d.data) < uint64Size {
+		d.Err = ErrCorrupted
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[uint64Size:]
+	return v
+}
+
+func (d *Decoder) Uvarint() uint64 {
+	if d.Err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.Err = ErrCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// Bytes reads n raw bytes without copying.
+func (d *Decoder) Bytes(n uint64) []byte {
+	if d.Err != nil || uint64(len(d.data)) < n {
+		d.Err = ErrCorrupted
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// Finish returns an error if decoding failed or there is unread data.
+func (d *Decoder) Finish() error {
+	if d.Err == nil && len(d.data) != 0 {
+		d.Err = ErrCorrupted
+	}
+	return d.Err
+}
+
+func AppendBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
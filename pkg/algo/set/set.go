@@ -89,6 +89,11 @@ func (s *SortedSet[T]) Descend(iter Iterator[T]) {
 	visitDescend(s.root, iter)
 }
 
+// AscendFrom iterates over values greater than or equal to pivot in ascending order.
+func (s *SortedSet[T]) AscendFrom(pivot T, iter Iterator[T]) {
+	visitAscendFrom(s.root, pivot, iter, s.less)
+}
+
 type node[T any] struct {
 	val    T
 	left   *node[T]
@@ -167,9 +172,9 @@ func insertNode[T any](node *node[T], val T, less Less[T]) *node[T] {
 	}
 
 	if balanceFactor < -1 {
-		if less(val, node.right.val) {
+		if less(node.right.val, val) {
 			return leftRotate(node)
-		} else if less(node.right.val, val) {
+		} else if less(val, node.right.val) {
 			node.right = rightRotate(node.right)
 			return leftRotate(node)
 		}
@@ -273,6 +278,23 @@ func visitAscend[T any](n *node[T], iter Iterator[T]) bool {
 	return visitAscend(n.right, iter)
 }
 
+func visitAscendFrom[T any](n *node[T], pivot T, iter Iterator[T], less Less[T]) bool {
+	if n == nil {
+		return true
+	}
+
+	if less(n.val, pivot) {
+		return visitAscendFrom(n.right, pivot, iter, less)
+	}
+	if ok := visitAscendFrom(n.left, pivot, iter, less); !ok {
+		return false
+	}
+	if ok := iter(n.val); !ok {
+		return false
+	}
+	return visitAscend(n.right, iter)
+}
+
 func visitDescend[T any](n *node[T], iter Iterator[T]) bool {
 	if n == nil {
 		return true
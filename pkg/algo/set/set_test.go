@@ -126,6 +126,42 @@ func TestSortedSet_Descend(t *testing.T) {
 	})
 }
 
+func TestSortedSet_AscendFrom(t *testing.T) {
+	t.Parallel()
+	s := set.Of[int](6, 3, 2, 100, 1, 4, -5, 0, 10)
+
+	t.Run("should traverse items greater or equal to pivot", func(t *testing.T) {
+		t.Parallel()
+		var visited []int
+		s.AscendFrom(3, func(v int) bool {
+			visited = append(visited, v)
+			return true
+		})
+		assert.Equal(t, []int{3, 4, 6, 10, 100}, visited)
+	})
+
+	t.Run("should start from the next item if pivot is absent", func(t *testing.T) {
+		t.Parallel()
+		var visited []int
+		s.AscendFrom(5, func(v int) bool {
+			visited = append(visited, v)
+			return v < 10
+		})
+		assert.Equal(t, []int{6, 10}, visited)
+	})
+}
+
+func TestSortedSet_Add_ascending(t *testing.T) {
+	t.Parallel()
+	s := set.Of[int](1, 2, 3, 4, 5)
+	var visited []int
+	s.Ascend(func(v int) bool {
+		visited = append(visited, v)
+		return true
+	})
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, visited)
+}
+
 func TestSortedSet_Remove(t *testing.T) {
 	t.Parallel()
 	items := []int{6, 3, 2, 100, 1, 4, -5, 0, 10}
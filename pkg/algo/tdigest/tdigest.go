@@ -0,0 +1,473 @@
+// Package tdigest implements a merging t-digest, a sketch for accurate estimation of
+// quantiles, especially extreme ones. Values are accumulated in a buffer and periodically
+// merged into centroids, whose sizes are limited by the k1 scale function.
+package tdigest
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/burenotti/redis_impl/pkg/algo/internal/encoding"
+)
+
+var (
+	ErrInvalidOptions = errors.New("invalid t-digest options")
+	ErrInvalidValue   = errors.New("value must be a finite number")
+	ErrCorrupted      = encoding.ErrCorrupted
+)
+
+const (
+	DefaultCompression = 100
+	// MaxCompression limits amount of centroids kept by a single sketch.
+	MaxCompression = 1 << 20
+
+	encodingVersion = 1
+)
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []float64
+	total       float64
+	min         float64
+	max         float64
+}
+
+func ValidateCompression(compression float64) error {
+	if !(compression > 0 && compression <= MaxCompression) {
+		return fmt.Errorf("%w: compression must be in range (0, %d]", ErrInvalidOptions, MaxCompression)
+	}
+	return nil
+}
+
+func New(compression float64) (*TDigest, error) {
+	if err := ValidateCompression(compression); err != nil {
+		return nil, err
+	}
+	t := &TDigest{compression: compression}
+	t.Reset()
+	return t, nil
+}
+
+func (t *TDigest) Compression() float64 {
+	return t.compression
+}
+
+// Reset removes all observations.
+func (t *TDigest) Reset() {
+	t.centroids = nil
+	t.buffer = nil
+	t.total = 0
+	t.min = math.Inf(1)
+	t.max = math.Inf(-1)
+}
+
+func (t *TDigest) bufferSize() int {
+	return int(6*t.compression) + 10 //nolint:mnd // as in RedisBloom
+}
+
+// Add adds observations.
+func (t *TDigest) Add(values ...float64) error {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrInvalidValue
+		}
+	}
+	for _, v := range values {
+		t.buffer = append(t.buffer, v)
+		t.total++
+		t.min = math.Min(t.min, v)
+		t.max = math.Max(t.max, v)
+		if len(t.buffer) >= t.bufferSize() {
+			t.compress()
+		}
+	}
+	return nil
+}
+
+// Count returns amount of observations.
+func (t *TDigest) Count() float64 {
+	return t.total
+}
+
+// Min returns the smallest observation or NaN if the sketch is empty.
+func (t *TDigest) Min() float64 {
+	if t.total == 0 {
+		return math.NaN()
+	}
+	return t.min
+}
+
+// Max returns the largest observation or NaN if the sketch is empty.
+func (t *TDigest) Max() float64 {
+	if t.total == 0 {
+		return math.NaN()
+	}
+	return t.max
+}
+
+// k1 scale function and its inverse. Centroids near the tails are smaller than centroids
+// near the median, which makes extreme quantiles more accurate.
+func (t *TDigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (t *TDigest) scaleInverse(k float64) float64 {
+	return (math.Sin(math.Min(k*2*math.Pi/t.compression, math.Pi/2)) + 1) / 2 //nolint:mnd // k1 scale function
+}
+
+// compress merges buffered values into centroids. It's called only when the buffer is full,
+// so the state of the sketch depends only on added values and not on queries.
+func (t *TDigest) compress() {
+	t.centroids = t.merged()
+	t.buffer = t.buffer[:0]
+}
+
+// merged returns centroids with buffered values merged into them without modifying the sketch.
+func (t *TDigest) merged() []centroid {
+	if len(t.buffer) == 0 {
+		return t.centroids
+	}
+	all := make([]centroid, 0, len(t.centroids)+len(t.buffer))
+	all = append(all, t.centroids...)
+	for _, v := range t.buffer {
+		all = append(all, centroid{mean: v, weight: 1})
+	}
+	slices.SortStableFunc(all, func(a, b centroid) int {
+		return cmp.Compare(a.mean, b.mean)
+	})
+	return t.merge(all)
+}
+
+// merge greedily merges sorted centroids while the merged centroid fits into
+// the size limit of the scale function.
+func (t *TDigest) merge(sorted []centroid) []centroid {
+	var total float64
+	for _, c := range sorted {
+		total += c.weight
+	}
+
+	res := make([]centroid, 0, len(sorted))
+	cur := sorted[0]
+	var weightSoFar float64
+	limit := total * t.scaleInverse(t.scale(0)+1)
+	for _, next := range sorted[1:] {
+		if weightSoFar+cur.weight+next.weight <= limit {
+			cur.weight += next.weight
+			cur.mean += (next.mean - cur.mean) * next.weight / cur.weight
+			continue
+		}
+		weightSoFar += cur.weight
+		res = append(res, cur)
+		limit = total * t.scaleInverse(t.scale(weightSoFar/total)+1)
+		cur = next
+	}
+	return append(res, cur)
+}
+
+func weightedAverage(x1, w1, x2, w2 float64) float64 {
+	if x1 > x2 {
+		x1, w1, x2, w2 = x2, w2, x1, w1
+	}
+	v := (x1*w1 + x2*w2) / (w1 + w2)
+	return math.Max(x1, math.Min(v, x2))
+}
+
+// Quantile returns an estimated value at quantile q in [0, 1] or NaN if the sketch is empty.
+//
+//nolint:gocognit,cyclop // interpolation has many edge cases
+func (t *TDigest) Quantile(q float64) float64 {
+	if t.total == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+
+	cs := t.merged()
+	if len(cs) == 1 {
+		return weightedAverage(t.min, 1-q, t.max, q)
+	}
+
+	index := q * t.total
+	if index < 1 {
+		return t.min
+	}
+	first, last := cs[0], cs[len(cs)-1]
+	if first.weight > 1 && index < first.weight/2 {
+		// Interpolate between the minimum and the center of the first centroid.
+		return t.min + (index-1)/(first.weight/2-1)*(first.mean-t.min)
+	}
+	if index > t.total-1 {
+		return t.max
+	}
+	if last.weight > 1 && t.total-index <= last.weight/2 {
+		return t.max - (t.total-index-1)/(last.weight/2-1)*(t.max-last.mean)
+	}
+
+	weightSoFar := first.weight / 2
+	for i := 0; i < len(cs)-1; i++ {
+		dw := (cs[i].weight + cs[i+1].weight) / 2
+		if weightSoFar+dw > index {
+			// Singleton centroids are exact values, so they aren't interpolated.
+			var leftUnit, rightUnit float64
+			if cs[i].weight == 1 {
+				if index-weightSoFar < 0.5 { //nolint:mnd // half of a singleton
+					return cs[i].mean
+				}
+				leftUnit = 0.5
+			}
+			if cs[i+1].weight == 1 {
+				if weightSoFar+dw-index <= 0.5 { //nolint:mnd // half of a singleton
+					return cs[i+1].mean
+				}
+				rightUnit = 0.5
+			}
+			z1 := index - weightSoFar - leftUnit
+			z2 := weightSoFar + dw - index - rightUnit
+			return weightedAverage(cs[i].mean, z2, cs[i+1].mean, z1)
+		}
+		weightSoFar += dw
+	}
+
+	// Interpolate between the center of the last centroid and the maximum.
+	z1 := index - (t.total - last.weight/2)
+	z2 := t.total - index
+	return weightedAverage(last.mean, z2, t.max, z1)
+}
+
+// CDF returns an estimated fraction of observations that are less than or equal to x,
+// where observations equal to x are counted with half weight. Returns NaN if the sketch is empty.
+//
+//nolint:gocognit,cyclop // interpolation has many edge cases
+func (t *TDigest) CDF(x float64) float64 {
+	if t.total == 0 || math.IsNaN(x) {
+		return math.NaN()
+	}
+	if x < t.min {
+		return 0
+	}
+	if x > t.max {
+		return 1
+	}
+
+	cs := t.merged()
+	if len(cs) == 1 {
+		if t.max == t.min {
+			return 0.5 //nolint:mnd // all observations are equal to x
+		}
+		return (x - t.min) / (t.max - t.min)
+	}
+
+	first, last := cs[0], cs[len(cs)-1]
+	if x < first.mean {
+		if x == t.min {
+			return 0.5 / t.total //nolint:mnd // half of the minimal observation
+		}
+		return (1 + (x-t.min)/(first.mean-t.min)*(first.weight/2-1)) / t.total
+	}
+	if x > last.mean {
+		if x == t.max {
+			return 1 - 0.5/t.total //nolint:mnd // half of the maximal observation
+		}
+		return 1 - (1+(t.max-x)/(t.max-last.mean)*(last.weight/2-1))/t.total
+	}
+
+	var weightSoFar float64
+	for i := 0; i < len(cs)-1; i++ {
+		if cs[i].mean == x {
+			var dw float64
+			for ; i < len(cs) && cs[i].mean == x; i++ {
+				dw += cs[i].weight
+			}
+			return (weightSoFar + dw/2) / t.total
+		}
+		if cs[i].mean <= x && x < cs[i+1].mean {
+			var leftExcluded, rightExcluded float64
+			if cs[i].weight == 1 {
+				if cs[i+1].weight == 1 {
+					// Between two exact values.
+					return (weightSoFar + 1) / t.total
+				}
+				leftExcluded = 0.5
+			} else if cs[i+1].weight == 1 {
+				rightExcluded = 0.5
+			}
+			dw := (cs[i].weight+cs[i+1].weight)/2 - leftExcluded - rightExcluded
+			base := weightSoFar + cs[i].weight/2 + leftExcluded
+			return (base + dw*(x-cs[i].mean)/(cs[i+1].mean-cs[i].mean)) / t.total
+		}
+		weightSoFar += cs[i].weight
+	}
+	return 1 - 0.5/t.total //nolint:mnd // x is equal to the mean of the last centroid
+}
+
+// Rank returns an estimated amount of observations less than value plus half of observations
+// equal to value. It's -1 if value is less than the minimum, Count if value is greater than the
+// maximum and -2 if the sketch is empty.
+func (t *TDigest) Rank(value float64) int64 {
+	switch {
+	case t.total == 0:
+		return -2 //nolint:mnd // as in RedisBloom
+	case value < t.min:
+		return -1
+	case value > t.max:
+		return int64(t.total)
+	default:
+		return int64(math.Round(t.CDF(value) * t.total))
+	}
+}
+
+// RevRank is Rank in descending order.
+func (t *TDigest) RevRank(value float64) int64 {
+	switch {
+	case t.total == 0:
+		return -2 //nolint:mnd // as in RedisBloom
+	case value > t.max:
+		return -1
+	case value < t.min:
+		return int64(t.total)
+	default:
+		return int64(math.Round((1 - t.CDF(value)) * t.total))
+	}
+}
+
+// ByRank returns an estimated value with the given rank. Rank 0 is the minimum and
+// Count-1 is the maximum. Ranks greater than that return +Inf.
+func (t *TDigest) ByRank(rank int64) float64 {
+	switch {
+	case t.total == 0 || rank < 0:
+		return math.NaN()
+	case rank == 0:
+		return t.min
+	case float64(rank) >= t.total:
+		return math.Inf(1)
+	case float64(rank) == t.total-1:
+		return t.max
+	default:
+		return t.Quantile((float64(rank) + 0.5) / t.total) //nolint:mnd // center of the observation
+	}
+}
+
+// ByRevRank is ByRank in descending order. Ranks greater than Count-1 return -Inf.
+func (t *TDigest) ByRevRank(rank int64) float64 {
+	switch {
+	case t.total == 0 || rank < 0:
+		return math.NaN()
+	case rank == 0:
+		return t.max
+	case float64(rank) >= t.total:
+		return math.Inf(-1)
+	case float64(rank) == t.total-1:
+		return t.min
+	default:
+		return t.Quantile(1 - (float64(rank)+0.5)/t.total) //nolint:mnd // center of the observation
+	}
+}
+
+// TrimmedMean returns mean of observations between quantiles low and high.
+func (t *TDigest) TrimmedMean(low, high float64) float64 {
+	if t.total == 0 {
+		return math.NaN()
+	}
+	from, to := low*t.total, high*t.total
+	var sum, weight, weightSoFar float64
+	for _, c := range t.merged() {
+		overlap := math.Min(weightSoFar+c.weight, to) - math.Max(weightSoFar, from)
+		if overlap > 0 {
+			sum += c.mean * overlap
+			weight += overlap
+		}
+		weightSoFar += c.weight
+	}
+	if weight == 0 {
+		return math.NaN()
+	}
+	return sum / weight
+}
+
+// Merge adds all observations of other sketches.
+func (t *TDigest) Merge(others ...*TDigest) {
+	var all []centroid
+	for _, other := range append([]*TDigest{t}, others...) {
+		if other.total == 0 {
+			continue
+		}
+		all = append(all, other.merged()...)
+		t.min = math.Min(t.min, other.min)
+		t.max = math.Max(t.max, other.max)
+	}
+	if len(all) == 0 {
+		return
+	}
+	slices.SortStableFunc(all, func(a, b centroid) int {
+		return cmp.Compare(a.mean, b.mean)
+	})
+	t.total = 0
+	for _, c := range all {
+		t.total += c.weight
+	}
+	t.centroids = t.merge(all)
+	t.buffer = nil
+}
+
+func (t *TDigest) MarshalBinary() ([]byte, error) {
+	buf := []byte{encodingVersion}
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(t.compression))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(t.min))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(t.max))
+	buf = binary.AppendUvarint(buf, uint64(len(t.centroids)))
+	for _, c := range t.centroids {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.mean))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.weight))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(t.buffer)))
+	for _, v := range t.buffer {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	return buf, nil
+}
+
+func (t *TDigest) UnmarshalBinary(data []byte) error {
+	d := encoding.NewDecoder(data)
+	if d.Byte() != encodingVersion {
+		return ErrCorrupted
+	}
+	res := TDigest{compression: math.Float64frombits(d.Uint64())}
+	res.min = math.Float64frombits(d.Uint64())
+	res.max = math.Float64frombits(d.Uint64())
+	n := d.Uvarint()
+	if ValidateCompression(res.compression) != nil || n > uint64(d.Remaining())/16 { //nolint:mnd // mean and weight
+		return ErrCorrupted
+	}
+	for i := uint64(0); i < n; i++ {
+		c := centroid{mean: math.Float64frombits(d.Uint64()), weight: math.Float64frombits(d.Uint64())}
+		res.centroids = append(res.centroids, c)
+		res.total += c.weight
+	}
+	n = d.Uvarint()
+	if n > uint64(d.Remaining())/8 { //nolint:mnd // size of float64
+		return ErrCorrupted
+	}
+	for i := uint64(0); i < n; i++ {
+		res.buffer = append(res.buffer, math.Float64frombits(d.Uint64()))
+	}
+	res.total += float64(n)
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	*t = res
+	return nil
+}
@@ -0,0 +1,183 @@
+package tdigest_test
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/tdigest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exactRank returns the fraction of sorted values that are less than v.
+func exactRank(sorted []float64, v float64) float64 {
+	return float64(sort.SearchFloat64s(sorted, v)) / float64(len(sorted))
+}
+
+func TestTDigest_accuracy(t *testing.T) {
+	t.Parallel()
+	distributions := map[string]func(*rand.Rand) float64{
+		"uniform":     func(r *rand.Rand) float64 { return r.Float64() },
+		"normal":      func(r *rand.Rand) float64 { return r.NormFloat64()*10 + 100 },
+		"exponential": func(r *rand.Rand) float64 { return r.ExpFloat64() },
+		"lognormal":   func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()) },
+	}
+	quantiles := []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999}
+
+	for name, gen := range distributions {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			td, err := tdigest.New(tdigest.DefaultCompression)
+			require.NoError(t, err)
+
+			rnd := rand.New(rand.NewSource(1))
+			values := make([]float64, 100_000)
+			for i := range values {
+				values[i] = gen(rnd)
+				require.NoError(t, td.Add(values[i]))
+			}
+			slices.Sort(values)
+
+			assert.Equal(t, values[0], td.Min())
+			assert.Equal(t, values[len(values)-1], td.Max())
+			for _, q := range quantiles {
+				// Error in quantile space is proportional to q(1-q).
+				tolerance := max(4*q*(1-q)*0.01, 0.001)
+				estimate := td.Quantile(q)
+				assert.InDelta(t, q, exactRank(values, estimate), tolerance, "quantile %v", q)
+
+				exact := values[int(q*float64(len(values)))]
+				assert.InDelta(t, q, td.CDF(exact), tolerance, "cdf at quantile %v", q)
+			}
+		})
+	}
+}
+
+func TestTDigest_smallExact(t *testing.T) {
+	t.Parallel()
+	td, err := tdigest.New(tdigest.DefaultCompression)
+	require.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		require.NoError(t, td.Add(float64(i)))
+	}
+
+	assert.Equal(t, 1.0, td.Quantile(0))
+	assert.Equal(t, 10.0, td.Quantile(1))
+	assert.Equal(t, 6.0, td.Quantile(0.5))
+	assert.InDelta(t, 0.05, td.CDF(1), 1e-9)
+	assert.InDelta(t, 0.55, td.CDF(6), 1e-9)
+	assert.Equal(t, 0.0, td.CDF(0))
+	assert.Equal(t, 1.0, td.CDF(11))
+
+	assert.Equal(t, int64(-1), td.Rank(0))
+	assert.Equal(t, int64(3), td.Rank(3.5))
+	assert.Equal(t, int64(10), td.Rank(11))
+	assert.Equal(t, int64(-1), td.RevRank(11))
+	assert.Equal(t, int64(7), td.RevRank(3.5))
+	assert.Equal(t, int64(10), td.RevRank(0))
+
+	for rank := int64(0); rank < 10; rank++ {
+		assert.Equal(t, float64(rank+1), td.ByRank(rank))
+	}
+	assert.True(t, math.IsInf(td.ByRank(10), 1))
+	for rank := int64(0); rank < 10; rank++ {
+		assert.Equal(t, float64(10-rank), td.ByRevRank(rank))
+	}
+	assert.True(t, math.IsInf(td.ByRevRank(10), -1))
+
+	assert.InDelta(t, 5.5, td.TrimmedMean(0, 1), 1e-9)
+	assert.InDelta(t, 5.5, td.TrimmedMean(0.1, 0.9), 1e-9)
+	assert.InDelta(t, 2, td.TrimmedMean(0, 0.3), 1e-9)
+}
+
+func TestTDigest_empty(t *testing.T) {
+	t.Parallel()
+	td, err := tdigest.New(tdigest.DefaultCompression)
+	require.NoError(t, err)
+
+	assert.True(t, math.IsNaN(td.Min()))
+	assert.True(t, math.IsNaN(td.Max()))
+	assert.True(t, math.IsNaN(td.Quantile(0.5)))
+	assert.True(t, math.IsNaN(td.CDF(1)))
+	assert.True(t, math.IsNaN(td.ByRank(0)))
+	assert.True(t, math.IsNaN(td.TrimmedMean(0, 1)))
+	assert.Equal(t, int64(-2), td.Rank(1))
+	assert.Equal(t, int64(-2), td.RevRank(1))
+
+	assert.ErrorIs(t, td.Add(math.NaN()), tdigest.ErrInvalidValue)
+	assert.ErrorIs(t, td.Add(math.Inf(1)), tdigest.ErrInvalidValue)
+	_, err = tdigest.New(0)
+	assert.ErrorIs(t, err, tdigest.ErrInvalidOptions)
+}
+
+func TestTDigest_Merge(t *testing.T) {
+	t.Parallel()
+	rnd := rand.New(rand.NewSource(2))
+	values := make([]float64, 0, 30_000)
+	var parts []*tdigest.TDigest
+	for i := 0; i < 3; i++ {
+		td, err := tdigest.New(tdigest.DefaultCompression)
+		require.NoError(t, err)
+		for j := 0; j < 10_000; j++ {
+			v := rnd.NormFloat64() + float64(i)
+			values = append(values, v)
+			require.NoError(t, td.Add(v))
+		}
+		parts = append(parts, td)
+	}
+	slices.Sort(values)
+
+	merged, err := tdigest.New(tdigest.DefaultCompression)
+	require.NoError(t, err)
+	merged.Merge(parts...)
+
+	assert.Equal(t, float64(len(values)), merged.Count())
+	assert.Equal(t, values[0], merged.Min())
+	assert.Equal(t, values[len(values)-1], merged.Max())
+	for _, q := range []float64{0.01, 0.5, 0.99} {
+		assert.InDelta(t, q, exactRank(values, merged.Quantile(q)), 0.01)
+	}
+}
+
+func TestTDigest_queriesDoNotModify(t *testing.T) {
+	t.Parallel()
+	a, err := tdigest.New(10)
+	require.NoError(t, err)
+	b, err := tdigest.New(10)
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, a.Add(float64(i%97)))
+		require.NoError(t, b.Add(float64(i%97)))
+		a.Quantile(0.5)
+	}
+	dataA, err := a.MarshalBinary()
+	require.NoError(t, err)
+	dataB, err := b.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, dataB, dataA)
+}
+
+func TestTDigest_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	td, err := tdigest.New(50)
+	require.NoError(t, err)
+	for i := 0; i < 1234; i++ {
+		require.NoError(t, td.Add(float64(i*i%1000)))
+	}
+	data, err := td.MarshalBinary()
+	require.NoError(t, err)
+
+	var restored tdigest.TDigest
+	require.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, td.Compression(), restored.Compression())
+	assert.Equal(t, td.Count(), restored.Count())
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 1} {
+		assert.Equal(t, td.Quantile(q), restored.Quantile(q))
+	}
+
+	assert.ErrorIs(t, restored.UnmarshalBinary(data[:len(data)-1]), tdigest.ErrCorrupted)
+}
@@ -0,0 +1,285 @@
+// Package topk implements HeavyKeeper, a sketch that tracks the k most frequent items.
+// Counters of colliding items decay exponentially, so rare items are quickly evicted
+// from buckets while heavy hitters keep their counts.
+package topk
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/burenotti/redis_impl/pkg/algo/hashing"
+	"github.com/burenotti/redis_impl/pkg/algo/internal/encoding"
+)
+
+var (
+	ErrInvalidOptions = errors.New("invalid top-k options")
+	ErrCorrupted      = encoding.ErrCorrupted
+)
+
+const (
+	DefaultWidth = 8
+	DefaultDepth = 7
+	DefaultDecay = 0.9
+
+	maxBuckets = 1 << 28
+	// maxDecayLookup is a maximal count with precomputed decay probability.
+	// Counters above it practically never decay.
+	maxDecayLookup  = 256
+	encodingVersion = 1
+)
+
+type Options struct {
+	K     uint64
+	Width uint64
+	Depth uint64
+	Decay float64
+}
+
+func (o Options) Validate() error {
+	if o.K == 0 || o.Width == 0 || o.Depth == 0 {
+		return fmt.Errorf("%w: k, width and depth must be positive", ErrInvalidOptions)
+	}
+	if o.Width > maxBuckets/o.Depth || o.K > maxBuckets {
+		return fmt.Errorf("%w: sketch is too large", ErrInvalidOptions)
+	}
+	if o.Decay <= 0 || o.Decay > 1 {
+		return fmt.Errorf("%w: decay must be in range (0, 1]", ErrInvalidOptions)
+	}
+	return nil
+}
+
+type bucket struct {
+	fp    uint64
+	count uint64
+}
+
+// Item is an item of the top-k list with its estimated count.
+type Item struct {
+	Value string
+	Count uint64
+}
+
+type TopK struct {
+	opts    Options
+	buckets []bucket
+	top     minHeap
+	// rng is a state of the random generator used for decay. It is a part of the
+	// sketch state, so replaying the same operations always produces the same sketch.
+	rng        uint64
+	decayTable []float64
+}
+
+func New(opts Options) (*TopK, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	t := &TopK{
+		opts:    opts,
+		buckets: make([]bucket, opts.Width*opts.Depth),
+		top:     minHeap{index: map[string]int{}},
+	}
+	t.initDecay()
+	return t, nil
+}
+
+func (t *TopK) initDecay() {
+	t.decayTable = make([]float64, maxDecayLookup)
+	for i := range t.decayTable {
+		t.decayTable[i] = math.Pow(t.opts.Decay, float64(i))
+	}
+}
+
+func (t *TopK) Options() Options {
+	return t.opts
+}
+
+// random returns a pseudo random number in [0, 1).
+func (t *TopK) random() float64 {
+	t.rng += 0x9e3779b97f4a7c15
+	return float64(hashing.Mix64(t.rng)>>11) / (1 << 53) //nolint:mnd // 53 bits of mantissa
+}
+
+// attempts returns amount of decay attempts until a counter is decayed, when every attempt
+// succeeds with probability p. It follows the geometric distribution, so large increments
+// don't need an attempt per unit.
+func (t *TopK) attempts(p float64) uint64 {
+	if p >= 1 {
+		return 1
+	}
+	n := math.Floor(math.Log(1-t.random())/math.Log1p(-p)) + 1
+	if n >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(n)
+}
+
+// IncrBy increases count of an item. If the item enters the top-k list and another item is
+// expelled from it, the expelled item is returned.
+func (t *TopK) IncrBy(item []byte, incr uint64) (string, bool) {
+	if incr == 0 {
+		return "", false
+	}
+	fp := hashing.Sum64(item, 0)
+	var maxCount uint64
+	for row := uint64(0); row < t.opts.Depth; row++ {
+		b := &t.buckets[row*t.opts.Width+hashing.Sum64(item, row+1)%t.opts.Width]
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, incr
+		case b.fp == fp:
+			b.count += incr
+		default:
+			remaining := incr
+			for b.count < maxDecayLookup {
+				attempts := t.attempts(t.decayTable[b.count])
+				if attempts > remaining {
+					break
+				}
+				remaining -= attempts
+				b.count--
+				if b.count == 0 {
+					// The attempt that emptied the bucket is counted for the new item.
+					b.fp, b.count = fp, remaining+1
+					break
+				}
+			}
+		}
+		if b.fp == fp {
+			maxCount = max(maxCount, b.count)
+		}
+	}
+	if maxCount == 0 {
+		return "", false
+	}
+	return t.top.offer(string(item), maxCount, t.opts.K)
+}
+
+// Query reports whether an item is in the top-k list.
+func (t *TopK) Query(item []byte) bool {
+	_, ok := t.top.index[string(item)]
+	return ok
+}
+
+// List returns items of the top-k list ordered by count in descending order.
+func (t *TopK) List() []Item {
+	items := slices.Clone(t.top.items)
+	slices.SortStableFunc(items, func(a, b Item) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return items
+}
+
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	buf := []byte{encodingVersion}
+	buf = binary.AppendUvarint(buf, t.opts.K)
+	buf = binary.AppendUvarint(buf, t.opts.Width)
+	buf = binary.AppendUvarint(buf, t.opts.Depth)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(t.opts.Decay))
+	buf = binary.LittleEndian.AppendUint64(buf, t.rng)
+	for _, b := range t.buckets {
+		buf = binary.LittleEndian.AppendUint64(buf, b.fp)
+		buf = binary.AppendUvarint(buf, b.count)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(t.top.items)))
+	for _, item := range t.top.items {
+		buf = binary.AppendUvarint(buf, uint64(len(item.Value)))
+		buf = append(buf, item.Value...)
+		buf = binary.AppendUvarint(buf, item.Count)
+	}
+	return buf, nil
+}
+
+func (t *TopK) UnmarshalBinary(data []byte) error {
+	d := encoding.NewDecoder(data)
+	if d.Byte() != encodingVersion {
+		return ErrCorrupted
+	}
+	opts := Options{K: d.Uvarint(), Width: d.Uvarint(), Depth: d.Uvarint()}
+	opts.Decay = math.Float64frombits(d.Uint64())
+	if d.Err != nil || opts.Validate() != nil || opts.Width*opts.Depth > uint64(d.Remaining()) {
+		return ErrCorrupted
+	}
+	res, _ := New(opts)
+	res.rng = d.Uint64()
+	for i := range res.buckets {
+		res.buckets[i] = bucket{fp: d.Uint64(), count: d.Uvarint()}
+	}
+	n := d.Uvarint()
+	if n > opts.K {
+		return ErrCorrupted
+	}
+	for i := uint64(0); i < n && d.Err == nil; i++ {
+		value := string(d.Bytes(d.Uvarint()))
+		res.top.index[value] = len(res.top.items)
+		res.top.items = append(res.top.items, Item{Value: value, Count: d.Uvarint()})
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	*t = *res
+	return nil
+}
+
+// minHeap keeps the top-k items with the least frequent item on top.
+type minHeap struct {
+	items []Item
+	index map[string]int
+}
+
+func (h *minHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *minHeap) Less(i, j int) bool {
+	return h.items[i].Count < h.items[j].Count
+}
+
+func (h *minHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Value] = i
+	h.index[h.items[j].Value] = j
+}
+
+func (h *minHeap) Push(x any) {
+	item := x.(Item) //nolint:forcetypeassert // heap contains only items
+	h.index[item.Value] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *minHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, item.Value)
+	return item
+}
+
+// offer updates count of an item, or adds it if the heap isn't full or the item is more
+// frequent than the least frequent one, which is expelled.
+func (h *minHeap) offer(value string, count, k uint64) (string, bool) {
+	if i, ok := h.index[value]; ok {
+		h.items[i].Count = max(h.items[i].Count, count)
+		heap.Fix(h, i)
+		return "", false
+	}
+	if uint64(len(h.items)) < k {
+		heap.Push(h, Item{Value: value, Count: count})
+		return "", false
+	}
+	if count <= h.items[0].Count {
+		return "", false
+	}
+	expelled := h.items[0].Value
+	delete(h.index, expelled)
+	h.items[0] = Item{Value: value, Count: count}
+	h.index[value] = 0
+	heap.Fix(h, 0)
+	return expelled, true
+}
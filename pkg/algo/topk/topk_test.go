@@ -0,0 +1,73 @@
+package topk_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopK_heavyHitters(t *testing.T) {
+	t.Parallel()
+	tk, err := topk.New(topk.Options{K: 5, Width: 100, Depth: 5, Decay: topk.DefaultDecay})
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50_000; i++ {
+		var item string
+		if rnd.Intn(2) == 0 {
+			// Half of the stream consists of 5 heavy hitters.
+			item = "heavy:" + strconv.Itoa(rnd.Intn(5))
+		} else {
+			item = "rare:" + strconv.Itoa(rnd.Intn(10_000))
+		}
+		tk.IncrBy([]byte(item), 1)
+	}
+
+	list := tk.List()
+	require.Len(t, list, 5)
+	for _, item := range list {
+		assert.Contains(t, item.Value, "heavy:")
+		assert.InDelta(t, 5000, float64(item.Count), 1000)
+		assert.True(t, tk.Query([]byte(item.Value)))
+	}
+	assert.False(t, tk.Query([]byte("rare:1")))
+}
+
+func TestTopK_expelled(t *testing.T) {
+	t.Parallel()
+	tk, err := topk.New(topk.Options{K: 2, Width: 50, Depth: 3, Decay: 0.9})
+	require.NoError(t, err)
+
+	_, ok := tk.IncrBy([]byte("a"), 1)
+	assert.False(t, ok)
+	_, ok = tk.IncrBy([]byte("b"), 5)
+	assert.False(t, ok)
+	expelled, ok := tk.IncrBy([]byte("c"), 10)
+	assert.True(t, ok)
+	assert.Equal(t, "a", expelled)
+	assert.Equal(t, []topk.Item{{Value: "c", Count: 10}, {Value: "b", Count: 5}}, tk.List())
+}
+
+func TestTopK_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	tk, err := topk.New(topk.Options{K: 3, Width: 8, Depth: 2, Decay: 0.9})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tk.IncrBy([]byte(strconv.Itoa(i%7)), uint64(i))
+	}
+
+	data, err := tk.MarshalBinary()
+	require.NoError(t, err)
+	var restored topk.TopK
+	require.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, tk.List(), restored.List())
+
+	// Restored sketch continues with the same random state.
+	tk.IncrBy([]byte("x"), 50)
+	restored.IncrBy([]byte("x"), 50)
+	assert.Equal(t, tk, &restored)
+}
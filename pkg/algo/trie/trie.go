@@ -0,0 +1,174 @@
+// Package trie implements a prefix tree over runes of string keys with exact and
+// fuzzy prefix lookups. Keys are visited in lexicographic order of their runes.
+package trie
+
+import "slices"
+
+type node[V any] struct {
+	r        rune
+	children []*node[V]
+	value    V
+	ok       bool
+}
+
+// child returns the child with the given rune and its position among children.
+func (n *node[V]) child(r rune) (*node[V], int) {
+	i, found := slices.BinarySearchFunc(n.children, r, func(c *node[V], r rune) int {
+		return int(c.r - r)
+	})
+	if !found {
+		return nil, i
+	}
+	return n.children[i], i
+}
+
+// Trie maps string keys to values.
+type Trie[V any] struct {
+	root *node[V]
+	size int
+}
+
+func New[V any]() *Trie[V] {
+	return &Trie[V]{root: &node[V]{}}
+}
+
+// Len returns amount of keys.
+func (t *Trie[V]) Len() int {
+	return t.size
+}
+
+// Put sets a value of a key and reports whether the key was added.
+func (t *Trie[V]) Put(key string, value V) bool {
+	n := t.root
+	for _, r := range key {
+		next, i := n.child(r)
+		if next == nil {
+			next = &node[V]{r: r}
+			n.children = slices.Insert(n.children, i, next)
+		}
+		n = next
+	}
+	added := !n.ok
+	n.value, n.ok = value, true
+	if added {
+		t.size++
+	}
+	return added
+}
+
+func (t *Trie[V]) Get(key string) (V, bool) {
+	n := t.find(key)
+	if n == nil || !n.ok {
+		var null V
+		return null, false
+	}
+	return n.value, true
+}
+
+// find returns a node of a key or prefix.
+func (t *Trie[V]) find(key string) *node[V] {
+	n := t.root
+	for _, r := range key {
+		if n, _ = n.child(r); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Delete removes a key and reports whether it existed. Nodes left without keys are removed.
+func (t *Trie[V]) Delete(key string) bool {
+	path := []*node[V]{t.root}
+	for _, r := range key {
+		next, _ := path[len(path)-1].child(r)
+		if next == nil {
+			return false
+		}
+		path = append(path, next)
+	}
+	n := path[len(path)-1]
+	if !n.ok {
+		return false
+	}
+	var null V
+	n.value, n.ok = null, false
+	t.size--
+	for i := len(path) - 1; i > 0; i-- {
+		if n := path[i]; n.ok || len(n.children) > 0 {
+			break
+		}
+		parent := path[i-1]
+		_, j := parent.child(path[i].r)
+		parent.children = slices.Delete(parent.children, j, j+1)
+	}
+	return true
+}
+
+// WalkPrefix calls fn for every key starting with prefix until fn returns false.
+func (t *Trie[V]) WalkPrefix(prefix string, fn func(key string, value V) bool) {
+	n := t.find(prefix)
+	if n == nil {
+		return
+	}
+	buf := []rune(prefix)
+	walk(n, &buf, fn)
+}
+
+// walk calls fn for every key of a subtree. buf holds the key of the subtree root.
+func walk[V any](n *node[V], buf *[]rune, fn func(key string, value V) bool) bool {
+	if n.ok && !fn(string(*buf), n.value) {
+		return false
+	}
+	for _, c := range n.children {
+		*buf = append(*buf, c.r)
+		ok := walk(c, buf, fn)
+		*buf = (*buf)[:len(*buf)-1]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkFuzzyPrefix calls fn for every key starting with a string within Levenshtein distance
+// maxDist of prefix until fn returns false. Every key is visited once.
+func (t *Trie[V]) WalkFuzzyPrefix(prefix string, maxDist int, fn func(key string, value V) bool) {
+	query := []rune(prefix)
+	// row holds distances between prefixes of the query and the current key.
+	row := make([]int, len(query)+1)
+	for i := range row {
+		row[i] = i
+	}
+	var buf []rune
+	walkFuzzy(t.root, query, row, maxDist, &buf, fn)
+}
+
+func walkFuzzy[V any](n *node[V], query []rune, row []int, maxDist int, buf *[]rune,
+	fn func(key string, value V) bool,
+) bool {
+	// The current key is within the distance of the whole query, so the subtree matches.
+	if row[len(query)] <= maxDist {
+		return walk(n, buf, fn)
+	}
+	if slices.Min(row) > maxDist {
+		return true
+	}
+	for _, c := range n.children {
+		next := make([]int, len(row))
+		next[0] = row[0] + 1
+		for i := 1; i < len(next); i++ {
+			cost := 1
+			if query[i-1] == c.r {
+				cost = 0
+			}
+			next[i] = min(row[i]+1, next[i-1]+1, row[i-1]+cost)
+		}
+		*buf = append(*buf, c.r)
+		ok := walkFuzzy(c, query, next, maxDist, buf, fn)
+		*buf = (*buf)[:len(*buf)-1]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
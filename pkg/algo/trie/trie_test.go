@@ -0,0 +1,110 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/algo/trie"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTrie(keys ...string) *trie.Trie[int] {
+	t := trie.New[int]()
+	for i, key := range keys {
+		t.Put(key, i)
+	}
+	return t
+}
+
+func prefixed(t *trie.Trie[int], prefix string) []string {
+	keys := []string{}
+	t.WalkPrefix(prefix, func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func fuzzy(t *trie.Trie[int], prefix string, maxDist int) []string {
+	keys := []string{}
+	t.WalkFuzzyPrefix(prefix, maxDist, func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestTrie_PutGet(t *testing.T) {
+	t.Parallel()
+	tr := trie.New[string]()
+	assert.True(t, tr.Put("hello", "a"))
+	assert.True(t, tr.Put("help", "b"))
+	assert.False(t, tr.Put("hello", "c"))
+	assert.True(t, tr.Put("", "empty"))
+	assert.Equal(t, 3, tr.Len())
+
+	v, ok := tr.Get("hello")
+	assert.True(t, ok)
+	assert.Equal(t, "c", v)
+	_, ok = tr.Get("hel")
+	assert.False(t, ok)
+	_, ok = tr.Get("helper")
+	assert.False(t, ok)
+	v, ok = tr.Get("")
+	assert.True(t, ok)
+	assert.Equal(t, "empty", v)
+}
+
+func TestTrie_Delete(t *testing.T) {
+	t.Parallel()
+	tr := newTrie("hello", "help", "he")
+	assert.False(t, tr.Delete("hel"))
+	assert.False(t, tr.Delete("helping"))
+	assert.True(t, tr.Delete("help"))
+	assert.False(t, tr.Delete("help"))
+	assert.Equal(t, 2, tr.Len())
+	assert.Equal(t, []string{"he", "hello"}, prefixed(tr, ""))
+
+	assert.True(t, tr.Delete("he"))
+	assert.True(t, tr.Delete("hello"))
+	assert.Equal(t, 0, tr.Len())
+	// Pruned nodes don't match prefixes anymore.
+	assert.Empty(t, prefixed(tr, "h"))
+}
+
+func TestTrie_WalkPrefix(t *testing.T) {
+	t.Parallel()
+	tr := newTrie("banana", "band", "ban", "bandana", "apple", "бан")
+	assert.Equal(t, []string{"ban", "banana", "band", "bandana"}, prefixed(tr, "ban"))
+	assert.Equal(t, []string{"apple", "ban", "banana", "band", "bandana", "бан"}, prefixed(tr, ""))
+	assert.Equal(t, []string{"бан"}, prefixed(tr, "ба"))
+	assert.Empty(t, prefixed(tr, "c"))
+
+	var first []string
+	tr.WalkPrefix("b", func(key string, _ int) bool {
+		first = append(first, key)
+		return len(first) < 2
+	})
+	assert.Equal(t, []string{"ban", "banana"}, first)
+}
+
+func TestTrie_WalkFuzzyPrefix(t *testing.T) {
+	t.Parallel()
+	tr := newTrie("hello", "help", "yellow", "hallo", "world", "hi", "shell")
+	cases := []struct {
+		prefix   string
+		maxDist  int
+		expected []string
+	}{
+		{"hel", 0, []string{"hello", "help"}},
+		// Substitution, deletion and insertion.
+		{"hel", 1, []string{"hallo", "hello", "help", "shell", "yellow"}},
+		{"hello", 1, []string{"hallo", "hello", "yellow"}},
+		{"he", 1, []string{"hallo", "hello", "help", "hi", "shell", "yellow"}},
+		{"wrld", 1, []string{"world"}},
+		{"xyz", 1, []string{}},
+		{"", 0, []string{"hallo", "hello", "help", "hi", "shell", "world", "yellow"}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, fuzzy(tr, c.prefix, c.maxDist), c.prefix)
+	}
+}
@@ -0,0 +1,40 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bytes is an amount of memory. Like in redis.conf, it may be followed by a unit:
+// 1k is 1000 bytes, 1kb is 1024 bytes, and so are m, mb, g and gb. Units are case-insensitive.
+type Bytes int64
+
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longer suffixes go first, because they end with shorter ones.
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+func (b *Bytes) SetValue(raw []string) error {
+	if len(raw) != 1 {
+		return fmt.Errorf("%w: memory amount must be a single value", ErrSyntax)
+	}
+	value, multiplier := strings.ToLower(raw[0]), int64(1)
+	for _, unit := range byteUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = number, unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid memory amount %q", ErrSyntax, raw[0])
+	}
+	*b = Bytes(n * multiplier)
+	return nil
+}
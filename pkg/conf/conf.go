@@ -44,13 +44,19 @@ func bindConfig(cfg interface{}, r io.Reader) error {
 		return err
 	}
 
-	data := make(map[string][]string)
-	if err := parse(data, r); err != nil {
+	data := directives{values: make(map[string][]string)}
+	if err := parse(&data, r); err != nil {
 		return err
 	}
 
+	for _, v := range meta.modules {
+		v.Set(reflect.ValueOf(data.modules))
+	}
+	for _, v := range meta.renames {
+		v.Set(reflect.ValueOf(data.renames))
+	}
 	for k, f := range meta.fields {
-		val, ok := data[k]
+		val, ok := data.values[k]
 		if !ok {
 			if f.defaultValue != nil {
 				val = []string{*f.defaultValue}
@@ -107,13 +113,26 @@ func collectFieldMeta(meta *configMeta, f reflect.StructField, v reflect.Value,
 		reflect.Bool:
 		meta.fields[fieldMeta.name] = fieldMeta
 		return nil
+	case reflect.Slice:
+		// Modules and renames are bound regardless of the name, because their directives can be repeated.
+		switch f.Type {
+		case reflect.TypeOf([]Module(nil)):
+			meta.modules = append(meta.modules, v)
+			return nil
+		case reflect.TypeOf([]RenameCommand(nil)):
+			meta.renames = append(meta.renames, v)
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrTypeNotSupported, f.Type)
 	default:
 		return fmt.Errorf("%w: %s", ErrTypeNotSupported, f.Type)
 	}
 }
 
 type configMeta struct {
-	fields map[string]field
+	fields  map[string]field
+	modules []reflect.Value
+	renames []reflect.Value
 }
 
 type field struct {
@@ -127,6 +146,12 @@ func bindValue(v reflect.Value, raw []string) error {
 	if s, ok := v.Interface().(Setter); ok {
 		return s.SetValue(raw)
 	}
+	// Setters are usually implemented by pointers.
+	if v.CanAddr() {
+		if s, ok := v.Addr().Interface().(Setter); ok {
+			return s.SetValue(raw)
+		}
+	}
 	if len(raw) == 0 {
 		return fmt.Errorf("%w: can't bind empty value", ErrSyntax)
 	}
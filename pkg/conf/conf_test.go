@@ -74,7 +74,7 @@ func TestConfig_parse(t *testing.T) {
 			input := strings.Join(c.Input, "\r\n")
 			r := strings.NewReader(input)
 			actual := make(map[string][]string)
-			err := parse(actual, r)
+			err := parse(&directives{values: actual}, r)
 			if c.Error != nil {
 				assert.ErrorIs(t, err, c.Error)
 			} else {
@@ -167,3 +167,72 @@ func TestBind_badCases(t *testing.T) {
 	err := Bind(&cfg, strings.NewReader("a 123i+2"))
 	require.ErrorIs(t, err, ErrTypeNotSupported)
 }
+
+func TestBind_modules(t *testing.T) {
+	t.Parallel()
+	data := `loadmodule /opt/first.so
+loadmodule "/opt/second module.so" arg1 'arg 2'
+port 6379
+`
+	cfg := struct {
+		Port    int      `redis:"port"`
+		Modules []Module `redis:"loadmodule"`
+	}{}
+	require.NoError(t, Bind(&cfg, strings.NewReader(data)))
+	assert.Equal(t, []Module{
+		{Path: "/opt/first.so", Args: []string{}},
+		{Path: "/opt/second module.so", Args: []string{"arg1", "arg 2"}},
+	}, cfg.Modules)
+
+	err := Bind(&cfg, strings.NewReader("loadmodule"))
+	require.ErrorIs(t, err, ErrSyntax)
+}
+
+func TestBind_renames(t *testing.T) {
+	t.Parallel()
+	data := `rename-command FLUSHALL ""
+rename-command config "admin-config"
+`
+	cfg := struct {
+		Renames []RenameCommand `redis:"rename-command"`
+	}{}
+	require.NoError(t, Bind(&cfg, strings.NewReader(data)))
+	assert.Equal(t, []RenameCommand{
+		{Name: "FLUSHALL", NewName: ""},
+		{Name: "config", NewName: "admin-config"},
+	}, cfg.Renames)
+
+	err := Bind(&cfg, strings.NewReader("rename-command FLUSHALL"))
+	require.ErrorIs(t, err, ErrSyntax)
+}
+
+func TestBind_bytes(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		Input    string
+		Expected Bytes
+	}{
+		{Input: "512", Expected: 512},
+		{Input: "1k", Expected: 1000},
+		{Input: "1kb", Expected: 1024},
+		{Input: "2MB", Expected: 2 << 20},
+		{Input: "512mb", Expected: 512 << 20},
+		{Input: "1g", Expected: 1000 * 1000 * 1000},
+		{Input: "1gb", Expected: 1 << 30},
+	}
+	for _, c := range cases {
+		cfg := struct {
+			Size Bytes `redis:"size" redis-default:"1mb"`
+		}{}
+		require.NoError(t, Bind(&cfg, strings.NewReader("size "+c.Input)))
+		assert.Equal(t, c.Expected, cfg.Size, c.Input)
+	}
+
+	cfg := struct {
+		Size Bytes `redis:"size" redis-default:"1mb"`
+	}{}
+	require.NoError(t, Bind(&cfg, strings.NewReader("")))
+	assert.Equal(t, Bytes(1<<20), cfg.Size)
+
+	require.ErrorIs(t, Bind(&cfg, strings.NewReader("size 1tb")), ErrSyntax)
+}
@@ -17,11 +17,43 @@ var (
 	ErrSyntax       = errors.New("syntax error")
 )
 
-func loadModule(_ map[string][]string, _ []string) error {
-	return fmt.Errorf("%w: loading modules is not yet supported", ErrNotSupported)
+// Module is a module loaded by the loadmodule directive.
+type Module struct {
+	Path string
+	Args []string
 }
 
-func include(data map[string][]string, args []string) error {
+// RenameCommand is a command renamed by the rename-command directive. Empty NewName disables the command.
+type RenameCommand struct {
+	Name    string
+	NewName string
+}
+
+// directives are values of a config file. A repeated directive overrides the previous one,
+// except for loadmodule and rename-command, all occurrences of which are kept.
+type directives struct {
+	values  map[string][]string
+	modules []Module
+	renames []RenameCommand
+}
+
+func loadModule(data *directives, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: loadmodule requires a path to the module", ErrSyntax)
+	}
+	data.modules = append(data.modules, Module{Path: args[0], Args: args[1:]})
+	return nil
+}
+
+func renameCommand(data *directives, args []string) error {
+	if len(args) != 2 { //nolint:mnd // name and new name
+		return fmt.Errorf("%w: rename-command requires a command and its new name", ErrSyntax)
+	}
+	data.renames = append(data.renames, RenameCommand{Name: args[0], NewName: args[1]})
+	return nil
+}
+
+func include(data *directives, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("%w: include requires exactly one argument", ErrSyntax)
 	}
@@ -33,7 +65,7 @@ func include(data map[string][]string, args []string) error {
 	return parse(data, file)
 }
 
-func parse(data map[string][]string, r io.Reader) error {
+func parse(data *directives, r io.Reader) error {
 	scanner := bufio.NewScanner(r)
 	scanner.Split(bufio.ScanLines)
 
@@ -50,7 +82,7 @@ func parse(data map[string][]string, r io.Reader) error {
 	return nil
 }
 
-func parseLine(data map[string][]string, line []byte) error {
+func parseLine(data *directives, line []byte) error {
 	// Comment line
 	if r, _ := utf8.DecodeRune(line); r == '#' {
 		return nil
@@ -66,17 +98,18 @@ func parseLine(data map[string][]string, line []byte) error {
 		return nil
 	}
 
-	keywords := map[string]func(data map[string][]string, args []string) error{
-		"include":    include,
-		"loadmodule": loadModule,
+	keywords := map[string]func(data *directives, args []string) error{
+		"include":        include,
+		"loadmodule":     loadModule,
+		"rename-command": renameCommand,
 	}
 
-	// Has a keyword (loadmodule, include, etc...)
+	// Has a keyword (loadmodule, rename-command, include, etc...)
 	if handler, ok := keywords[tokens[0]]; ok {
 		return handler(data, tokens[1:])
 	}
 
-	data[tokens[0]] = tokens[1:]
+	data.values[tokens[0]] = tokens[1:]
 	return nil
 }
 
@@ -0,0 +1,385 @@
+package graph
+
+import (
+	"strconv"
+	"strings"
+)
+
+type query struct {
+	params  map[string]Value
+	clauses []clause
+}
+
+type clause interface{}
+
+type matchClause struct {
+	optional bool
+	patterns []*patternPart
+	where    expr
+}
+
+type unwindClause struct {
+	list     expr
+	variable string
+}
+
+type createClause struct {
+	patterns []*patternPart
+}
+
+type mergeClause struct {
+	pattern  *patternPart
+	onCreate []setItem
+	onMatch  []setItem
+}
+
+type setClause struct {
+	items []setItem
+}
+
+type removeClause struct {
+	items []setItem
+}
+
+type deleteClause struct {
+	detach bool
+	exprs  []expr
+}
+
+// projectionClause is either WITH or RETURN.
+type projectionClause struct {
+	with     bool
+	distinct bool
+	// star projects all named variables.
+	star    bool
+	items   []projectionItem
+	orderBy []sortItem
+	skip    expr
+	limit   expr
+	// where filters rows projected by WITH.
+	where expr
+}
+
+type callClause struct {
+	procedure string
+	args      []expr
+	yield     []string
+}
+
+type projectionItem struct {
+	expr  expr
+	alias string
+}
+
+type sortItem struct {
+	expr expr
+	desc bool
+}
+
+type setKind int
+
+const (
+	// setProperty is n.key = value or REMOVE n.key.
+	setProperty setKind = iota
+	// setReplace is n = {map}.
+	setReplace
+	// setMerge is n += {map}.
+	setMerge
+	// setLabels is n:Label or REMOVE n:Label.
+	setLabels
+)
+
+type setItem struct {
+	kind     setKind
+	variable string
+	key      string
+	value    expr
+	labels   []string
+}
+
+type direction int
+
+const (
+	dirOut direction = iota
+	dirIn
+	dirBoth
+)
+
+// patternPart is a path pattern like p = (a)-[r]->(b).
+type patternPart struct {
+	path  string
+	nodes []*nodePattern
+	rels  []*relPattern
+}
+
+type nodePattern struct {
+	variable string
+	labels   []string
+	props    *mapLit
+}
+
+type relPattern struct {
+	variable  string
+	types     []string
+	props     *mapLit
+	dir       direction
+	varLength bool
+	minHops   int
+	// maxHops is negative when the length is unbounded.
+	maxHops int
+}
+
+// anonymous reports whether a variable was generated for an unnamed pattern element.
+// Such variables start with a space, so they never clash with user variables.
+func anonymous(name string) bool {
+	return strings.HasPrefix(name, " ")
+}
+
+func writeVariable(sb *strings.Builder, name string) {
+	if !anonymous(name) {
+		sb.WriteString(name)
+	}
+}
+
+func (n *nodePattern) String() string {
+	var sb strings.Builder
+	sb.WriteString("(")
+	writeVariable(&sb, n.variable)
+	for _, label := range n.labels {
+		sb.WriteString(":" + label)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (r *relPattern) String() string {
+	var sb strings.Builder
+	if r.dir == dirIn {
+		sb.WriteString("<")
+	}
+	sb.WriteString("-[")
+	writeVariable(&sb, r.variable)
+	if len(r.types) > 0 {
+		sb.WriteString(":" + strings.Join(r.types, "|"))
+	}
+	if r.varLength {
+		sb.WriteString("*" + strconv.Itoa(r.minHops) + "..")
+		if r.maxHops >= 0 {
+			sb.WriteString(strconv.Itoa(r.maxHops))
+		}
+	}
+	sb.WriteString("]-")
+	if r.dir == dirOut {
+		sb.WriteString(">")
+	}
+	return sb.String()
+}
+
+func (p *patternPart) String() string {
+	var sb strings.Builder
+	if p.path != "" {
+		sb.WriteString(p.path + " = ")
+	}
+	for i, n := range p.nodes {
+		if i > 0 {
+			sb.WriteString(p.rels[i-1].String())
+		}
+		sb.WriteString(n.String())
+	}
+	return sb.String()
+}
+
+type expr interface {
+	String() string
+}
+
+type literal struct {
+	value Value
+}
+
+type paramRef struct {
+	name string
+}
+
+type varRef struct {
+	name string
+}
+
+type propRef struct {
+	subject expr
+	key     string
+}
+
+type indexRef struct {
+	subject expr
+	index   expr
+}
+
+type listLit struct {
+	items []expr
+}
+
+type mapLit struct {
+	keys   []string
+	values []expr
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+// labelExpr is a predicate like n:Label.
+type labelExpr struct {
+	x      expr
+	labels []string
+}
+
+type funcCall struct {
+	// name is lower case.
+	name     string
+	distinct bool
+	// star is count(*).
+	star bool
+	args []expr
+}
+
+func (l *literal) String() string {
+	switch v := l.value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	}
+	s, _ := toString(l.value)
+	return s.(string)
+}
+
+func (p *paramRef) String() string {
+	return "$" + p.name
+}
+
+func (v *varRef) String() string {
+	return v.name
+}
+
+func (p *propRef) String() string {
+	return p.subject.String() + "." + p.key
+}
+
+func (i *indexRef) String() string {
+	return i.subject.String() + "[" + i.index.String() + "]"
+}
+
+func joinExprs(exprs []expr) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *listLit) String() string {
+	return "[" + joinExprs(l.items) + "]"
+}
+
+func (m *mapLit) String() string {
+	parts := make([]string, len(m.keys))
+	for i, k := range m.keys {
+		parts[i] = k + ": " + m.values[i].String()
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (u *unaryExpr) String() string {
+	if u.op == "NOT" {
+		return "NOT " + u.x.String()
+	}
+	return u.op + u.x.String()
+}
+
+func (b *binaryExpr) String() string {
+	return "(" + b.left.String() + " " + b.op + " " + b.right.String() + ")"
+}
+
+func (n *isNullExpr) String() string {
+	if n.not {
+		return n.x.String() + " IS NOT NULL"
+	}
+	return n.x.String() + " IS NULL"
+}
+
+func (l *labelExpr) String() string {
+	return l.x.String() + ":" + strings.Join(l.labels, ":")
+}
+
+func (f *funcCall) String() string {
+	switch {
+	case f.star:
+		return f.name + "(*)"
+	case f.distinct:
+		return f.name + "(DISTINCT " + joinExprs(f.args) + ")"
+	}
+	return f.name + "(" + joinExprs(f.args) + ")"
+}
+
+var aggregates = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true, "collect": true,
+}
+
+// walkExpr calls fn for an expression and all its subexpressions.
+func walkExpr(e expr, fn func(expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch e := e.(type) {
+	case *propRef:
+		walkExpr(e.subject, fn)
+	case *indexRef:
+		walkExpr(e.subject, fn)
+		walkExpr(e.index, fn)
+	case *listLit:
+		for _, item := range e.items {
+			walkExpr(item, fn)
+		}
+	case *mapLit:
+		for _, v := range e.values {
+			walkExpr(v, fn)
+		}
+	case *unaryExpr:
+		walkExpr(e.x, fn)
+	case *binaryExpr:
+		walkExpr(e.left, fn)
+		walkExpr(e.right, fn)
+	case *isNullExpr:
+		walkExpr(e.x, fn)
+	case *labelExpr:
+		walkExpr(e.x, fn)
+	case *funcCall:
+		for _, arg := range e.args {
+			walkExpr(arg, fn)
+		}
+	}
+}
+
+// aggregateCalls returns calls of aggregating functions in an expression.
+func aggregateCalls(e expr) []*funcCall {
+	var calls []*funcCall
+	walkExpr(e, func(e expr) {
+		if call, ok := e.(*funcCall); ok && aggregates[call.name] {
+			calls = append(calls, call)
+		}
+	})
+	return calls
+}
@@ -0,0 +1,856 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// row binds variables to values.
+type row map[string]Value
+
+func (r row) clone() row {
+	res := make(row, len(r)+1)
+	for k, v := range r {
+		res[k] = v
+	}
+	return res
+}
+
+func (ex *executor) eval(e expr, r row) (Value, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.value, nil
+	case *paramRef:
+		v, ok := ex.params[e.name]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing parameter '%s'", ErrQuery, e.name)
+		}
+		return v, nil
+	case *varRef:
+		v, ok := r[e.name]
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s' not defined", ErrQuery, e.name)
+		}
+		return v, nil
+	case *propRef:
+		subject, err := ex.eval(e.subject, r)
+		if err != nil {
+			return nil, err
+		}
+		return property(subject, e.key)
+	case *indexRef:
+		return ex.evalIndex(e, r)
+	case *listLit:
+		list := make([]Value, len(e.items))
+		for i, item := range e.items {
+			v, err := ex.eval(item, r)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case *mapLit:
+		m := make(map[string]Value, len(e.keys))
+		for i, k := range e.keys {
+			v, err := ex.eval(e.values[i], r)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case *unaryExpr:
+		x, err := ex.eval(e.x, r)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == "NOT" {
+			return not(x)
+		}
+		return arithmetic("-", int64(0), x)
+	case *binaryExpr:
+		return ex.evalBinary(e, r)
+	case *isNullExpr:
+		x, err := ex.eval(e.x, r)
+		if err != nil {
+			return nil, err
+		}
+		return (x == nil) != e.not, nil
+	case *labelExpr:
+		x, err := ex.eval(e.x, r)
+		if err != nil || x == nil {
+			return nil, err
+		}
+		n, ok := x.(*Node)
+		if !ok {
+			return nil, typeError("Node", x)
+		}
+		for _, label := range e.labels {
+			if !n.HasLabel(label) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *funcCall:
+		return ex.evalCall(e, r)
+	}
+	return nil, fmt.Errorf("%w: unsupported expression %s", ErrQuery, e)
+}
+
+// evalPredicate evaluates a condition. Null is treated as false.
+func (ex *executor) evalPredicate(e expr, r row) (bool, error) {
+	v, err := ex.eval(e, r)
+	if err != nil {
+		return false, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, typeError("Boolean", v)
+}
+
+func property(subject Value, key string) (Value, error) {
+	switch s := subject.(type) {
+	case nil:
+		return nil, nil
+	case *Node:
+		v, _ := s.Properties.Get(key)
+		return v, nil
+	case *Relationship:
+		v, _ := s.Properties.Get(key)
+		return v, nil
+	case map[string]Value:
+		return s[key], nil
+	}
+	return nil, typeError("Node, Edge or Map", subject)
+}
+
+func (ex *executor) evalIndex(e *indexRef, r row) (Value, error) {
+	subject, err := ex.eval(e.subject, r)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ex.eval(e.index, r)
+	if err != nil || subject == nil || index == nil {
+		return nil, err
+	}
+	switch s := subject.(type) {
+	case []Value:
+		i, ok := index.(int64)
+		if !ok {
+			return nil, typeError("Integer", index)
+		}
+		if i < 0 {
+			i += int64(len(s))
+		}
+		if i < 0 || i >= int64(len(s)) {
+			return nil, nil
+		}
+		return s[i], nil
+	case map[string]Value, *Node, *Relationship:
+		k, ok := index.(string)
+		if !ok {
+			return nil, typeError("String", index)
+		}
+		return property(subject, k)
+	}
+	return nil, typeError("List or Map", subject)
+}
+
+func toBool(v Value) (Value, error) {
+	switch v.(type) {
+	case nil, bool:
+		return v, nil
+	}
+	return nil, typeError("Boolean", v)
+}
+
+func not(x Value) (Value, error) {
+	x, err := toBool(x)
+	if err != nil || x == nil {
+		return nil, err
+	}
+	return !x.(bool), nil
+}
+
+func (ex *executor) evalBinary(e *binaryExpr, r row) (Value, error) {
+	left, err := ex.eval(e.left, r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := ex.eval(e.right, r)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "AND", "OR", "XOR":
+		return logical(e.op, left, right)
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		return not(equal(left, right))
+	case "<", "<=", ">", ">=":
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		c, ok := compare(left, right)
+		if !ok {
+			return nil, nil
+		}
+		switch e.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "IN":
+		return in(left, right)
+	case "STARTS WITH", "ENDS WITH", "CONTAINS":
+		return stringPredicate(e.op, left, right)
+	}
+	return arithmetic(e.op, left, right)
+}
+
+func logical(op string, left, right Value) (Value, error) {
+	left, err := toBool(left)
+	if err != nil {
+		return nil, err
+	}
+	if right, err = toBool(right); err != nil {
+		return nil, err
+	}
+	switch op {
+	case "AND":
+		if left == false || right == false {
+			return false, nil
+		}
+	case "OR":
+		if left == true || right == true {
+			return true, nil
+		}
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	l, r := left.(bool), right.(bool)
+	switch op {
+	case "AND":
+		return l && r, nil
+	case "OR":
+		return l || r, nil
+	}
+	return l != r, nil
+}
+
+func in(x, list Value) (Value, error) {
+	if list == nil {
+		return nil, nil
+	}
+	items, ok := list.([]Value)
+	if !ok {
+		return nil, typeError("List", list)
+	}
+	var res Value = false
+	for _, item := range items {
+		switch equal(x, item) {
+		case true:
+			return true, nil
+		case nil:
+			res = nil
+		}
+	}
+	return res, nil
+}
+
+func stringPredicate(op string, left, right Value) (Value, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	s, ok := left.(string)
+	if !ok {
+		return nil, typeError("String", left)
+	}
+	sub, ok := right.(string)
+	if !ok {
+		return nil, typeError("String", right)
+	}
+	switch op {
+	case "STARTS WITH":
+		return strings.HasPrefix(s, sub), nil
+	case "ENDS WITH":
+		return strings.HasSuffix(s, sub), nil
+	}
+	return strings.Contains(s, sub), nil
+}
+
+func arithmetic(op string, left, right Value) (Value, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if op == "+" {
+		if res, ok := concat(left, right); ok {
+			return res, nil
+		}
+	}
+	l, ok := toFloat(left)
+	if !ok {
+		return nil, typeError("Integer or Float", left)
+	}
+	r, ok := toFloat(right)
+	if !ok {
+		return nil, typeError("Integer or Float", right)
+	}
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt && op != "^" {
+		return intArithmetic(op, li, ri)
+	}
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "%":
+		return math.Mod(l, r), nil
+	}
+	return math.Pow(l, r), nil
+}
+
+// concat concatenates strings and lists.
+func concat(left, right Value) (Value, bool) {
+	if l, ok := left.([]Value); ok {
+		if r, ok := right.([]Value); ok {
+			return append(append([]Value{}, l...), r...), true
+		}
+		return append(append([]Value{}, l...), right), true
+	}
+	if r, ok := right.([]Value); ok {
+		return append([]Value{left}, r...), true
+	}
+	_, lStr := left.(string)
+	_, rStr := right.(string)
+	if !lStr && !rStr {
+		return nil, false
+	}
+	l, err := toString(left)
+	if err != nil {
+		return nil, false
+	}
+	r, err := toString(right)
+	if err != nil {
+		return nil, false
+	}
+	return l.(string) + r.(string), true
+}
+
+func intArithmetic(op string, l, r int64) (Value, error) {
+	switch op {
+	case "+":
+		res := l + r
+		if (res > l) != (r > 0) {
+			return nil, fmt.Errorf("%w: integer overflow", ErrQuery)
+		}
+		return res, nil
+	case "-":
+		res := l - r
+		if (res < l) != (r > 0) {
+			return nil, fmt.Errorf("%w: integer overflow", ErrQuery)
+		}
+		return res, nil
+	case "*":
+		if l != 0 && r != 0 {
+			res := l * r
+			if res/r != l || (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+				return nil, fmt.Errorf("%w: integer overflow", ErrQuery)
+			}
+			return res, nil
+		}
+		return int64(0), nil
+	}
+	if r == 0 {
+		return nil, fmt.Errorf("%w: division by zero", ErrQuery)
+	}
+	if r == -1 && l == math.MinInt64 {
+		if op == "%" {
+			return int64(0), nil
+		}
+		return nil, fmt.Errorf("%w: integer overflow", ErrQuery)
+	}
+	if op == "/" {
+		return l / r, nil
+	}
+	return l % r, nil
+}
+
+func (ex *executor) evalCall(call *funcCall, r row) (Value, error) {
+	if aggregates[call.name] {
+		v, ok := ex.aggregated[call]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid use of aggregating function '%s'", ErrQuery, call.name)
+		}
+		return v, nil
+	}
+	args := make([]Value, len(call.args))
+	for i, arg := range call.args {
+		v, err := ex.eval(arg, r)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	fn := functions[call.name]
+	if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("%w: received %d arguments to function '%s'", ErrQuery, len(args), call.name)
+	}
+	return fn.call(ex, args)
+}
+
+type function struct {
+	minArgs, maxArgs int
+	call             func(ex *executor, args []Value) (Value, error)
+}
+
+// nullable wraps a function of one argument returning null for null.
+func nullable(fn func(v Value) (Value, error)) function {
+	return function{minArgs: 1, maxArgs: 1, call: func(_ *executor, args []Value) (Value, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(args[0])
+	}}
+}
+
+func stringFunc(fn func(s string) Value) function {
+	return nullable(func(v Value) (Value, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError("String", v)
+		}
+		return fn(s), nil
+	})
+}
+
+func mathFunc(fn func(f float64) float64) function {
+	return nullable(func(v Value) (Value, error) {
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, typeError("Integer or Float", v)
+		}
+		if _, isInt := v.(int64); isInt {
+			return v, nil
+		}
+		return fn(f), nil
+	})
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"id": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case *Node:
+				return v.ID, nil
+			case *Relationship:
+				return v.ID, nil
+			}
+			return nil, typeError("Node or Edge", v)
+		}),
+		"labels": nullable(func(v Value) (Value, error) {
+			n, ok := v.(*Node)
+			if !ok {
+				return nil, typeError("Node", v)
+			}
+			res := make([]Value, len(n.Labels))
+			for i, label := range n.Labels {
+				res[i] = label
+			}
+			return res, nil
+		}),
+		"type": nullable(func(v Value) (Value, error) {
+			r, ok := v.(*Relationship)
+			if !ok {
+				return nil, typeError("Edge", v)
+			}
+			return r.Type, nil
+		}),
+		"properties": nullable(func(v Value) (Value, error) {
+			var props Properties
+			switch v := v.(type) {
+			case *Node:
+				props = v.Properties
+			case *Relationship:
+				props = v.Properties
+			case map[string]Value:
+				return v, nil
+			default:
+				return nil, typeError("Node, Edge or Map", v)
+			}
+			res := make(map[string]Value, len(props))
+			for _, prop := range props {
+				res[prop.Key] = prop.Value
+			}
+			return res, nil
+		}),
+		"keys": nullable(func(v Value) (Value, error) {
+			var props Properties
+			switch v := v.(type) {
+			case *Node:
+				props = v.Properties
+			case *Relationship:
+				props = v.Properties
+			case map[string]Value:
+				var res []Value
+				for _, k := range sortedKeys(v) {
+					res = append(res, k)
+				}
+				return res, nil
+			default:
+				return nil, typeError("Node, Edge or Map", v)
+			}
+			res := make([]Value, len(props))
+			for i, prop := range props {
+				res[i] = prop.Key
+			}
+			return res, nil
+		}),
+		"startnode": {minArgs: 1, maxArgs: 1, call: func(ex *executor, args []Value) (Value, error) {
+			return endpoint(ex, args[0], true)
+		}},
+		"endnode": {minArgs: 1, maxArgs: 1, call: func(ex *executor, args []Value) (Value, error) {
+			return endpoint(ex, args[0], false)
+		}},
+		"nodes": nullable(func(v Value) (Value, error) {
+			p, ok := v.(*Path)
+			if !ok {
+				return nil, typeError("Path", v)
+			}
+			res := make([]Value, len(p.Nodes))
+			for i, n := range p.Nodes {
+				res[i] = n
+			}
+			return res, nil
+		}),
+		"relationships": nullable(func(v Value) (Value, error) {
+			p, ok := v.(*Path)
+			if !ok {
+				return nil, typeError("Path", v)
+			}
+			res := make([]Value, len(p.Relationships))
+			for i, r := range p.Relationships {
+				res[i] = r
+			}
+			return res, nil
+		}),
+		"length": nullable(func(v Value) (Value, error) {
+			if p, ok := v.(*Path); ok {
+				return int64(len(p.Relationships)), nil
+			}
+			return size(v)
+		}),
+		"size": nullable(size),
+		"head": nullable(func(v Value) (Value, error) {
+			l, ok := v.([]Value)
+			if !ok {
+				return nil, typeError("List", v)
+			}
+			if len(l) == 0 {
+				return nil, nil
+			}
+			return l[0], nil
+		}),
+		"last": nullable(func(v Value) (Value, error) {
+			l, ok := v.([]Value)
+			if !ok {
+				return nil, typeError("List", v)
+			}
+			if len(l) == 0 {
+				return nil, nil
+			}
+			return l[len(l)-1], nil
+		}),
+		"tail": nullable(func(v Value) (Value, error) {
+			l, ok := v.([]Value)
+			if !ok {
+				return nil, typeError("List", v)
+			}
+			if len(l) == 0 {
+				return []Value{}, nil
+			}
+			return append([]Value{}, l[1:]...), nil
+		}),
+		"range": {minArgs: 2, maxArgs: 3, call: func(_ *executor, args []Value) (Value, error) {
+			return rangeList(args)
+		}},
+		"coalesce": {minArgs: 1, maxArgs: math.MaxInt, call: func(_ *executor, args []Value) (Value, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+		"exists": {minArgs: 1, maxArgs: 1, call: func(_ *executor, args []Value) (Value, error) {
+			return args[0] != nil, nil
+		}},
+		"toupper": stringFunc(func(s string) Value { return strings.ToUpper(s) }),
+		"tolower": stringFunc(func(s string) Value { return strings.ToLower(s) }),
+		"trim":    stringFunc(func(s string) Value { return strings.TrimSpace(s) }),
+		"ltrim":   stringFunc(func(s string) Value { return strings.TrimLeft(s, " \t\n\r") }),
+		"rtrim":   stringFunc(func(s string) Value { return strings.TrimRight(s, " \t\n\r") }),
+		"reverse": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case string:
+				runes := []rune(v)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return string(runes), nil
+			case []Value:
+				res := make([]Value, len(v))
+				for i, item := range v {
+					res[len(v)-1-i] = item
+				}
+				return res, nil
+			}
+			return nil, typeError("String or List", v)
+		}),
+		"substring": {minArgs: 2, maxArgs: 3, call: func(_ *executor, args []Value) (Value, error) {
+			return substring(args)
+		}},
+		"replace": {minArgs: 3, maxArgs: 3, call: func(_ *executor, args []Value) (Value, error) {
+			strs, err := stringArgs(args)
+			if err != nil || strs == nil {
+				return nil, err
+			}
+			return strings.ReplaceAll(strs[0], strs[1], strs[2]), nil
+		}},
+		"split": {minArgs: 2, maxArgs: 2, call: func(_ *executor, args []Value) (Value, error) {
+			strs, err := stringArgs(args)
+			if err != nil || strs == nil {
+				return nil, err
+			}
+			var res []Value
+			for _, part := range strings.Split(strs[0], strs[1]) {
+				res = append(res, part)
+			}
+			return res, nil
+		}},
+		"tostring": nullable(toString),
+		"tointeger": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case int64:
+				return v, nil
+			case float64:
+				if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+					return nil, nil
+				}
+				return int64(v), nil
+			case string:
+				if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+					return i, nil
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+					return nil, nil
+				}
+				return int64(f), nil
+			}
+			return nil, typeError("Integer, Float or String", v)
+		}),
+		"tofloat": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case int64:
+				return float64(v), nil
+			case float64:
+				return v, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, nil
+				}
+				return f, nil
+			}
+			return nil, typeError("Integer, Float or String", v)
+		}),
+		"toboolean": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case bool:
+				return v, nil
+			case string:
+				switch strings.ToLower(v) {
+				case "true":
+					return true, nil
+				case "false":
+					return false, nil
+				}
+				return nil, nil
+			}
+			return nil, typeError("Boolean or String", v)
+		}),
+		"abs": nullable(func(v Value) (Value, error) {
+			switch v := v.(type) {
+			case int64:
+				if v == math.MinInt64 {
+					return nil, fmt.Errorf("%w: integer overflow", ErrQuery)
+				}
+				if v < 0 {
+					return -v, nil
+				}
+				return v, nil
+			case float64:
+				return math.Abs(v), nil
+			}
+			return nil, typeError("Integer or Float", v)
+		}),
+		"ceil":  mathFunc(math.Ceil),
+		"floor": mathFunc(math.Floor),
+		"round": mathFunc(func(f float64) float64 { return math.Floor(f + 0.5) }),
+		"sign": nullable(func(v Value) (Value, error) {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, typeError("Integer or Float", v)
+			}
+			switch {
+			case f > 0:
+				return int64(1), nil
+			case f < 0:
+				return int64(-1), nil
+			}
+			return int64(0), nil
+		}),
+		"sqrt": nullable(func(v Value) (Value, error) {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, typeError("Integer or Float", v)
+			}
+			return math.Sqrt(f), nil
+		}),
+	}
+}
+
+func endpoint(ex *executor, v Value, start bool) (Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	r, ok := v.(*Relationship)
+	if !ok {
+		return nil, typeError("Edge", v)
+	}
+	id := r.Dst
+	if start {
+		id = r.Src
+	}
+	if n := ex.g.node(id); n != nil {
+		return n, nil
+	}
+	return nil, nil
+}
+
+func size(v Value) (Value, error) {
+	switch v := v.(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case []Value:
+		return int64(len(v)), nil
+	}
+	return nil, typeError("List or String", v)
+}
+
+// stringArgs returns arguments as strings or nil if any of them is null.
+func stringArgs(args []Value) ([]string, error) {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+		s, ok := arg.(string)
+		if !ok {
+			return nil, typeError("String", arg)
+		}
+		res[i] = s
+	}
+	return res, nil
+}
+
+func intArgs(args []Value) ([]int64, error) {
+	res := make([]int64, len(args))
+	for i, arg := range args {
+		n, ok := arg.(int64)
+		if !ok {
+			return nil, typeError("Integer", arg)
+		}
+		res[i] = n
+	}
+	return res, nil
+}
+
+// maxRange limits the size of lists created by range().
+const maxRange = 1 << 24
+
+func rangeList(args []Value) (Value, error) {
+	bounds, err := intArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	step := int64(1)
+	if len(bounds) == 3 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("%w: step argument to range() can't be 0", ErrQuery)
+	}
+	res := []Value{}
+	for i := bounds[0]; step > 0 && i <= bounds[1] || step < 0 && i >= bounds[1]; i += step {
+		if len(res) == maxRange {
+			return nil, fmt.Errorf("%w: range is too large", ErrQuery)
+		}
+		res = append(res, i)
+		if step > 0 && i > math.MaxInt64-step || step < 0 && i < math.MinInt64-step {
+			break
+		}
+	}
+	return res, nil
+}
+
+func substring(args []Value) (Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, typeError("String", args[0])
+	}
+	bounds, err := intArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	start := bounds[0]
+	if start < 0 {
+		return nil, fmt.Errorf("%w: start must be a non-negative integer", ErrQuery)
+	}
+	start = min(start, int64(len(runes)))
+	end := int64(len(runes))
+	if len(bounds) == 2 {
+		if bounds[1] < 0 {
+			return nil, fmt.Errorf("%w: length must be a non-negative integer", ErrQuery)
+		}
+		end = min(end, start+min(bounds[1], end))
+	}
+	return string(runes[start:end]), nil
+}
@@ -0,0 +1,319 @@
+// Package graph implements a property graph with labeled nodes and typed relationships
+// queried with a subset of Cypher. See Graph.Query for the supported language.
+//
+// Nodes and relationships get sequential identifiers and are always visited in the order
+// of their identifiers, so executing the same queries produces the same graph.
+package graph
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+var (
+	ErrSyntax   = errors.New("syntax error")
+	ErrQuery    = errors.New("query error")
+	ErrType     = errors.New("type mismatch")
+	ErrReadOnly = errors.New("graph.RO_QUERY is to be executed only on read-only queries")
+)
+
+// Property is a property of a node or a relationship.
+type Property struct {
+	Key   string
+	Value Value
+}
+
+// Properties are ordered by the time they were set.
+type Properties []Property
+
+func (p Properties) Get(key string) (Value, bool) {
+	for _, prop := range p {
+		if prop.Key == key {
+			return prop.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set sets a property and reports whether it was set. Setting nil removes the property.
+func (p *Properties) set(key string, value Value) (set, removed bool) {
+	i := slices.IndexFunc(*p, func(prop Property) bool { return prop.Key == key })
+	switch {
+	case value == nil && i < 0:
+		return false, false
+	case value == nil:
+		*p = slices.Delete(*p, i, i+1)
+		return false, true
+	case i < 0:
+		*p = append(*p, Property{Key: key, Value: value})
+	default:
+		(*p)[i].Value = value
+	}
+	return true, false
+}
+
+type Node struct {
+	ID         int64
+	Labels     []string
+	Properties Properties
+	out, in    []*Relationship
+}
+
+func (n *Node) HasLabel(label string) bool {
+	return slices.Contains(n.Labels, label)
+}
+
+type Relationship struct {
+	ID         int64
+	Type       string
+	Src, Dst   int64
+	Properties Properties
+}
+
+// Path is an alternating sequence of nodes and relationships starting and ending with a node.
+type Path struct {
+	Nodes         []*Node
+	Relationships []*Relationship
+}
+
+// registry assigns sequential identifiers to names. Identifiers are never reused,
+// so clients may cache them.
+type registry struct {
+	names []string
+	ids   map[string]int
+}
+
+func (r *registry) clone() registry {
+	return registry{names: slices.Clone(r.names), ids: maps.Clone(r.ids)}
+}
+
+func (r *registry) id(name string) (int, bool) {
+	id, ok := r.ids[name]
+	return id, ok
+}
+
+// add registers a name and reports whether it is new.
+func (r *registry) add(name string) bool {
+	if _, ok := r.ids[name]; ok {
+		return false
+	}
+	if r.ids == nil {
+		r.ids = map[string]int{}
+	}
+	r.ids[name] = len(r.names)
+	r.names = append(r.names, name)
+	return true
+}
+
+type Graph struct {
+	// nodes and relationships are indexed by identifiers, deleted ones are nil.
+	nodes         []*Node
+	relationships []*Relationship
+	nodeCount     int
+	relCount      int
+
+	labels   registry
+	relTypes registry
+	keys     registry
+}
+
+func New() *Graph {
+	return &Graph{}
+}
+
+// Clone returns a deep copy of the graph with the same identifiers.
+func (g *Graph) Clone() *Graph {
+	c := &Graph{
+		nodes:         make([]*Node, len(g.nodes)),
+		relationships: make([]*Relationship, len(g.relationships)),
+		nodeCount:     g.nodeCount,
+		relCount:      g.relCount,
+		labels:        g.labels.clone(),
+		relTypes:      g.relTypes.clone(),
+		keys:          g.keys.clone(),
+	}
+	for i, r := range g.relationships {
+		if r != nil {
+			c.relationships[i] = &Relationship{
+				ID: r.ID, Type: r.Type, Src: r.Src, Dst: r.Dst, Properties: slices.Clone(r.Properties),
+			}
+		}
+	}
+	copyRels := func(rels []*Relationship) []*Relationship {
+		res := make([]*Relationship, len(rels))
+		for i, r := range rels {
+			res[i] = c.relationships[r.ID]
+		}
+		return res
+	}
+	for i, n := range g.nodes {
+		if n != nil {
+			c.nodes[i] = &Node{
+				ID:         n.ID,
+				Labels:     slices.Clone(n.Labels),
+				Properties: slices.Clone(n.Properties),
+				out:        copyRels(n.out),
+				in:         copyRels(n.in),
+			}
+		}
+	}
+	return c
+}
+
+func (g *Graph) NodeCount() int {
+	return g.nodeCount
+}
+
+func (g *Graph) RelationshipCount() int {
+	return g.relCount
+}
+
+// Labels returns all labels ever used in the graph ordered by their identifiers.
+func (g *Graph) Labels() []string {
+	return slices.Clone(g.labels.names)
+}
+
+// RelationshipTypes returns all relationship types ordered by their identifiers.
+func (g *Graph) RelationshipTypes() []string {
+	return slices.Clone(g.relTypes.names)
+}
+
+// PropertyKeys returns all property keys ordered by their identifiers.
+func (g *Graph) PropertyKeys() []string {
+	return slices.Clone(g.keys.names)
+}
+
+// LabelID returns the identifier of a label used by the compact result set format.
+func (g *Graph) LabelID(label string) int {
+	id, _ := g.labels.id(label)
+	return id
+}
+
+func (g *Graph) RelationshipTypeID(relType string) int {
+	id, _ := g.relTypes.id(relType)
+	return id
+}
+
+func (g *Graph) PropertyKeyID(key string) int {
+	id, _ := g.keys.id(key)
+	return id
+}
+
+func (g *Graph) node(id int64) *Node {
+	if id < 0 || id >= int64(len(g.nodes)) {
+		return nil
+	}
+	return g.nodes[id]
+}
+
+// Stats counts changes made by a query.
+type Stats struct {
+	LabelsAdded          int
+	NodesCreated         int
+	NodesDeleted         int
+	PropertiesSet        int
+	PropertiesRemoved    int
+	RelationshipsCreated int
+	RelationshipsDeleted int
+}
+
+func (s Stats) modified() bool {
+	return s != Stats{}
+}
+
+func (g *Graph) createNode(labels []string, props Properties, stats *Stats) *Node {
+	n := &Node{ID: int64(len(g.nodes)), Labels: slices.Clone(labels)}
+	for _, label := range labels {
+		if g.labels.add(label) {
+			stats.LabelsAdded++
+		}
+	}
+	for _, prop := range props {
+		g.setProperty(&n.Properties, prop.Key, prop.Value, stats)
+	}
+	g.nodes = append(g.nodes, n)
+	g.nodeCount++
+	stats.NodesCreated++
+	return n
+}
+
+func (g *Graph) createRelationship(relType string, src, dst *Node, props Properties, stats *Stats) *Relationship {
+	r := &Relationship{ID: int64(len(g.relationships)), Type: relType, Src: src.ID, Dst: dst.ID}
+	g.relTypes.add(relType)
+	for _, prop := range props {
+		g.setProperty(&r.Properties, prop.Key, prop.Value, stats)
+	}
+	g.relationships = append(g.relationships, r)
+	src.out = append(src.out, r)
+	dst.in = append(dst.in, r)
+	g.relCount++
+	stats.RelationshipsCreated++
+	return r
+}
+
+func (g *Graph) setProperty(props *Properties, key string, value Value, stats *Stats) {
+	set, removed := props.set(key, value)
+	if set {
+		g.keys.add(key)
+		stats.PropertiesSet++
+	}
+	if removed {
+		stats.PropertiesRemoved++
+	}
+}
+
+func (g *Graph) addLabels(n *Node, labels []string, stats *Stats) {
+	for _, label := range labels {
+		if n.HasLabel(label) {
+			continue
+		}
+		if g.labels.add(label) {
+			stats.LabelsAdded++
+		}
+		n.Labels = append(n.Labels, label)
+	}
+}
+
+func (g *Graph) deleteRelationship(r *Relationship, stats *Stats) {
+	if g.relationships[r.ID] == nil {
+		return
+	}
+	g.relationships[r.ID] = nil
+	g.relCount--
+	stats.RelationshipsDeleted++
+	isRel := func(other *Relationship) bool { return other == r }
+	if src := g.nodes[r.Src]; src != nil {
+		src.out = slices.DeleteFunc(src.out, isRel)
+	}
+	if dst := g.nodes[r.Dst]; dst != nil {
+		dst.in = slices.DeleteFunc(dst.in, isRel)
+	}
+}
+
+// deleteNode deletes a node with all its relationships.
+func (g *Graph) deleteNode(n *Node, stats *Stats) {
+	if g.nodes[n.ID] == nil {
+		return
+	}
+	for _, r := range slices.Clone(n.out) {
+		g.deleteRelationship(r, stats)
+	}
+	for _, r := range slices.Clone(n.in) {
+		g.deleteRelationship(r, stats)
+	}
+	g.nodes[n.ID] = nil
+	g.nodeCount--
+	stats.NodesDeleted++
+}
+
+// deleted reports whether an entity was deleted by the query.
+func (g *Graph) deleted(v Value) bool {
+	switch v := v.(type) {
+	case *Node:
+		return g.nodes[v.ID] != v
+	case *Relationship:
+		return g.relationships[v.ID] != v
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func query(t *testing.T, g *graph.Graph, q string) *graph.Result {
+	t.Helper()
+	res, err := g.Query(q, false)
+	require.NoError(t, err, q)
+	return res
+}
+
+// social returns a graph of people following each other: alice -> bob -> carol -> dave and alice -> carol.
+func social(t *testing.T) *graph.Graph {
+	g := graph.New()
+	query(t, g, `CREATE (a:Person {name: 'alice', age: 30}), (b:Person {name: 'bob', age: 25}),
+		(c:Person {name: 'carol', age: 35}), (d:Person:Admin {name: 'dave', age: 40}),
+		(a)-[:FOLLOWS {since: 2020}]->(b), (b)-[:FOLLOWS {since: 2021}]->(c),
+		(c)-[:FOLLOWS {since: 2022}]->(d), (a)-[:FOLLOWS {since: 2023}]->(c)`)
+	return g
+}
+
+func TestGraph_create(t *testing.T) {
+	t.Parallel()
+	g := graph.New()
+	res := query(t, g, `CREATE (a:Person {name: 'alice', tags: ['x', 'y'], missing: null})-[:KNOWS]->(:Person)`)
+	assert.Nil(t, res.Columns)
+	assert.Equal(t, graph.Stats{LabelsAdded: 1, NodesCreated: 2, PropertiesSet: 2, RelationshipsCreated: 1}, res.Stats)
+	assert.Equal(t, 2, g.NodeCount())
+	assert.Equal(t, 1, g.RelationshipCount())
+	assert.Equal(t, []string{"Person"}, g.Labels())
+	assert.Equal(t, []string{"KNOWS"}, g.RelationshipTypes())
+	assert.Equal(t, []string{"name", "tags"}, g.PropertyKeys())
+
+	res = query(t, g, `CREATE (n:City {name: 'Paris'}) RETURN n.name, id(n), labels(n)`)
+	assert.Equal(t, []string{"n.name", "id(n)", "labels(n)"}, res.Columns)
+	assert.Equal(t, [][]graph.Value{{"Paris", int64(2), []graph.Value{"City"}}}, res.Rows)
+}
+
+func TestGraph_match(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	cases := []struct {
+		query    string
+		expected [][]graph.Value
+	}{
+		{
+			`MATCH (p:Person) WHERE p.age > 28 RETURN p.name ORDER BY p.age DESC LIMIT 2`,
+			[][]graph.Value{{"dave"}, {"carol"}},
+		},
+		{
+			`MATCH (a {name: 'alice'})-[:FOLLOWS]->(b) RETURN b.name AS name ORDER BY name`,
+			[][]graph.Value{{"bob"}, {"carol"}},
+		},
+		{
+			`MATCH (a)<-[r:FOLLOWS]-(b:Person {name: 'alice'}) RETURN a.name, r.since ORDER BY r.since`,
+			[][]graph.Value{{"bob", int64(2020)}, {"carol", int64(2023)}},
+		},
+		{
+			`MATCH (c {name: 'carol'})-[:FOLLOWS]-(n) RETURN n.name ORDER BY n.name`,
+			[][]graph.Value{{"alice"}, {"bob"}, {"dave"}},
+		},
+		{
+			`MATCH (a {name: 'alice'})-[:FOLLOWS*2..3]->(n) RETURN n.name ORDER BY n.name`,
+			[][]graph.Value{{"carol"}, {"dave"}, {"dave"}},
+		},
+		{
+			`MATCH (a:Admin), (b:Person) WHERE b.name STARTS WITH 'b' OR b.name ENDS WITH 'e' RETURN a.name, b.name ORDER BY b.name`,
+			[][]graph.Value{{"dave", "alice"}, {"dave", "bob"}, {"dave", "dave"}},
+		},
+		{
+			`MATCH (a)-[:FOLLOWS]->(b), (b)-[:FOLLOWS]->(c) RETURN a.name, c.name ORDER BY a.name, c.name`,
+			[][]graph.Value{{"alice", "carol"}, {"alice", "dave"}, {"bob", "dave"}},
+		},
+		{
+			`MATCH (n:Person) RETURN DISTINCT n.age > 30 AS old ORDER BY old`,
+			[][]graph.Value{{false}, {true}},
+		},
+		{
+			`MATCH (n:Person) RETURN n.name SKIP 1 LIMIT 2`,
+			[][]graph.Value{{"bob"}, {"carol"}},
+		},
+		{
+			`CYPHER min=26 names=['bob', 'dave'] MATCH (n) WHERE n.age >= $min AND NOT n.name IN $names RETURN n.name`,
+			[][]graph.Value{{"alice"}, {"carol"}},
+		},
+		{
+			`MATCH (n:Person) WHERE n:Admin RETURN toUpper(n.name) + '!', size(n.name), n.age / 3, n.age % 7, -n.age`,
+			[][]graph.Value{{"DAVE!", int64(4), int64(13), int64(5), int64(-40)}},
+		},
+		{
+			`OPTIONAL MATCH (n:Missing) RETURN n`,
+			[][]graph.Value{{nil}},
+		},
+		{
+			`MATCH (d:Admin) OPTIONAL MATCH (d)-[:FOLLOWS]->(x) RETURN d.name, x`,
+			[][]graph.Value{{"dave", nil}},
+		},
+		{
+			`UNWIND [3, 1, 2] AS x WITH x WHERE x > 1 RETURN x ORDER BY x`,
+			[][]graph.Value{{int64(2)}, {int64(3)}},
+		},
+	}
+	for _, c := range cases {
+		res, err := g.Query(c.query, true)
+		require.NoError(t, err, c.query)
+		assert.Equal(t, c.expected, res.Rows, c.query)
+	}
+}
+
+func TestGraph_path(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	res := query(t, g, `MATCH p = (a {name: 'alice'})-[:FOLLOWS*]->(d:Admin) RETURN p ORDER BY length(p)`)
+	require.Len(t, res.Rows, 2)
+	names := func(p graph.Value) []string {
+		var res []string
+		for _, n := range p.(*graph.Path).Nodes {
+			name, _ := n.Properties.Get("name")
+			res = append(res, name.(string))
+		}
+		return res
+	}
+	assert.Equal(t, []string{"alice", "carol", "dave"}, names(res.Rows[0][0]))
+	assert.Len(t, res.Rows[0][0].(*graph.Path).Relationships, 2)
+	assert.Equal(t, []string{"alice", "bob", "carol", "dave"}, names(res.Rows[1][0]))
+
+	// Paths are written from the end when only the end is bound.
+	res = query(t, g, `MATCH (d:Admin) MATCH p = (a)-[:FOLLOWS]->(c)-[:FOLLOWS]->(d) RETURN a.name, p ORDER BY a.name`)
+	require.Len(t, res.Rows, 2)
+	assert.Equal(t, []string{"alice", "carol", "dave"}, names(res.Rows[0][1]))
+	assert.Equal(t, []string{"bob", "carol", "dave"}, names(res.Rows[1][1]))
+
+	res = query(t, g, `MATCH p = (a {name: 'bob'})-[*0..1]-(b) RETURN b.name, length(p) ORDER BY length(p), b.name`)
+	assert.Equal(t, [][]graph.Value{{"bob", int64(0)}, {"alice", int64(1)}, {"carol", int64(1)}}, res.Rows)
+}
+
+func TestGraph_aggregate(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	cases := []struct {
+		query    string
+		expected [][]graph.Value
+	}{
+		{
+			`MATCH (n:Person) RETURN count(*), count(n.missing), sum(n.age), avg(n.age), min(n.name), max(n.age)`,
+			[][]graph.Value{{int64(4), int64(0), int64(130), 32.5, "alice", int64(40)}},
+		},
+		{
+			`MATCH (a)-[:FOLLOWS]->(b) RETURN a.name, count(b) AS n, collect(b.name) ORDER BY n DESC, a.name`,
+			[][]graph.Value{
+				{"alice", int64(2), []graph.Value{"bob", "carol"}},
+				{"bob", int64(1), []graph.Value{"carol"}},
+				{"carol", int64(1), []graph.Value{"dave"}},
+			},
+		},
+		{
+			`MATCH (n:Missing) RETURN count(n), collect(n), sum(n.x)`,
+			[][]graph.Value{{int64(0), []graph.Value{}, int64(0)}},
+		},
+		{
+			`MATCH (n:Missing) RETURN n.name, count(n)`,
+			[][]graph.Value{},
+		},
+		{
+			`MATCH (a)-[:FOLLOWS]->(b) WITH a, count(DISTINCT b) AS n WHERE n > 1 RETURN a.name, n * 10`,
+			[][]graph.Value{{"alice", int64(20)}},
+		},
+	}
+	for _, c := range cases {
+		res, err := g.Query(c.query, true)
+		require.NoError(t, err, c.query)
+		assert.Equal(t, c.expected, res.Rows, c.query)
+	}
+}
+
+func TestGraph_merge(t *testing.T) {
+	t.Parallel()
+	g := graph.New()
+	merge := `MERGE (c:City {name: 'Paris'}) ON CREATE SET c.created = true ON MATCH SET c.matched = true
+		RETURN c.created, c.matched`
+	res := query(t, g, merge)
+	assert.Equal(t, [][]graph.Value{{true, nil}}, res.Rows)
+	assert.Equal(t, 1, res.Stats.NodesCreated)
+	res = query(t, g, merge)
+	assert.Equal(t, [][]graph.Value{{true, true}}, res.Rows)
+	assert.Equal(t, 0, res.Stats.NodesCreated)
+	assert.Equal(t, 1, g.NodeCount())
+
+	// Bound nodes are reused and relationships are created once.
+	relate := `UNWIND ['a', 'b', 'a'] AS name MERGE (p:Person {name: name})
+		WITH p MATCH (c:City) MERGE (p)-[r:LIVES_IN]->(c) RETURN count(r)`
+	res = query(t, g, relate)
+	assert.Equal(t, [][]graph.Value{{int64(3)}}, res.Rows)
+	assert.Equal(t, graph.Stats{LabelsAdded: 1, NodesCreated: 2, PropertiesSet: 2, RelationshipsCreated: 2}, res.Stats)
+	res = query(t, g, relate)
+	assert.Equal(t, graph.Stats{}, res.Stats)
+}
+
+func TestGraph_update(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	res := query(t, g, `MATCH (n {name: 'bob'}) SET n.age = n.age + 1, n.nick = 'b', n:Admin REMOVE n.missing`)
+	assert.Equal(t, graph.Stats{PropertiesSet: 2}, res.Stats)
+	res = query(t, g, `MATCH (n:Admin) RETURN n.name, n.age, n.nick ORDER BY n.name`)
+	assert.Equal(t, [][]graph.Value{{"bob", int64(26), "b"}, {"dave", int64(40), nil}}, res.Rows)
+
+	res = query(t, g, `MATCH (n {name: 'bob'}) SET n = {name: 'robert'} REMOVE n:Admin RETURN properties(n), labels(n)`)
+	assert.Equal(t, [][]graph.Value{{map[string]graph.Value{"name": "robert"}, []graph.Value{"Person"}}}, res.Rows)
+	assert.Equal(t, graph.Stats{PropertiesSet: 1, PropertiesRemoved: 2}, res.Stats)
+
+	res = query(t, g, `MATCH (n {name: 'robert'}) SET n += {age: 26, name: null} RETURN keys(n)`)
+	assert.Equal(t, [][]graph.Value{{[]graph.Value{"age"}}}, res.Rows)
+
+	_, err := g.Query(`MATCH (n) SET n.x = {a: 1}`, false)
+	assert.ErrorIs(t, err, graph.ErrType)
+}
+
+func TestGraph_delete(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	res := query(t, g, `MATCH ()-[r:FOLLOWS]->() WHERE r.since > 2021 DELETE r`)
+	assert.Equal(t, graph.Stats{RelationshipsDeleted: 2}, res.Stats)
+	assert.Equal(t, 2, g.RelationshipCount())
+
+	// Nodes are deleted with their relationships.
+	res = query(t, g, `MATCH (n {name: 'bob'}) DETACH DELETE n`)
+	assert.Equal(t, graph.Stats{NodesDeleted: 1, RelationshipsDeleted: 2}, res.Stats)
+	res = query(t, g, `MATCH (n) OPTIONAL MATCH (n)-[r]-() RETURN n.name, count(r) ORDER BY n.name`)
+	assert.Equal(t, [][]graph.Value{{"alice", int64(0)}, {"carol", int64(0)}, {"dave", int64(0)}}, res.Rows)
+
+	// Identifiers aren't reused.
+	res = query(t, g, `CREATE (n) RETURN id(n)`)
+	assert.Equal(t, [][]graph.Value{{int64(4)}}, res.Rows)
+}
+
+func TestGraph_procedures(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	res := query(t, g, `CALL db.labels()`)
+	assert.Equal(t, []string{"label"}, res.Columns)
+	assert.Equal(t, [][]graph.Value{{"Person"}, {"Admin"}}, res.Rows)
+	res = query(t, g, `CALL db.propertyKeys() YIELD propertyKey RETURN propertyKey ORDER BY propertyKey`)
+	assert.Equal(t, [][]graph.Value{{"age"}, {"name"}, {"since"}}, res.Rows)
+	res = query(t, g, `CALL db.relationshipTypes()`)
+	assert.Equal(t, [][]graph.Value{{"FOLLOWS"}}, res.Rows)
+}
+
+func TestGraph_readOnly(t *testing.T) {
+	t.Parallel()
+	g := graph.New()
+	_, err := g.Query(`CREATE (n)`, true)
+	assert.ErrorIs(t, err, graph.ErrReadOnly)
+	assert.Equal(t, 0, g.NodeCount())
+	_, err = g.Query(`MATCH (n) RETURN n`, true)
+	assert.NoError(t, err)
+}
+
+func TestGraph_errors(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	cases := []struct {
+		query string
+		err   error
+	}{
+		{`MATCH (n RETURN n`, graph.ErrSyntax},
+		{`MATCH (n)`, graph.ErrSyntax},
+		{`RETURN 1 MATCH (n)`, graph.ErrSyntax},
+		{`MATCH (n) RETURN foo(n)`, graph.ErrSyntax},
+		{`MATCH (a)<-[]->(b) RETURN a`, graph.ErrSyntax},
+		{`RETURN 'unterminated`, graph.ErrSyntax},
+		{`RETURN 9223372036854775808`, graph.ErrSyntax},
+		{`MATCH (n) RETURN m`, graph.ErrQuery},
+		{`RETURN $missing`, graph.ErrQuery},
+		{`CREATE (a)-[:R]-(b)`, graph.ErrQuery},
+		{`CREATE (a)-[:R|S]->(b)`, graph.ErrQuery},
+		{`MATCH (a) CREATE (a:L)`, graph.ErrQuery},
+		{`RETURN 1 AS x, 2 AS x`, graph.ErrQuery},
+		{`RETURN 9223372036854775807 + 1`, graph.ErrQuery},
+		{`RETURN 1 / 0`, graph.ErrQuery},
+		{`MATCH (n) RETURN n LIMIT -1`, graph.ErrQuery},
+		{`CALL db.unknown()`, graph.ErrQuery},
+		{`RETURN 'a' * 2`, graph.ErrType},
+		{`MATCH (n) WHERE n.name RETURN n`, graph.ErrType},
+	}
+	for _, c := range cases {
+		_, err := g.Query(c.query, false)
+		assert.ErrorIs(t, err, c.err, c.query)
+	}
+}
+
+func TestGraph_values(t *testing.T) {
+	t.Parallel()
+	g := graph.New()
+	res := query(t, g, `RETURN 1 = 1.0, null = null, 1 < 'a', [1, null] = [1, 2], true XOR null, 2 ^ 3,
+		'a' + 1, [1] + 2, {a: [1, 2]}.a[-1], range(1, 7, 3), substring('hello', 1, 3), toInteger('42'),
+		coalesce(null, 'x'), 7 / 2.0, -9223372036854775808`)
+	assert.Equal(t, [][]graph.Value{{
+		true, nil, nil, nil, nil, 8.0,
+		"a1", []graph.Value{int64(1), int64(2)}, int64(2), []graph.Value{int64(1), int64(4), int64(7)}, "ell", int64(42),
+		"x", 3.5, int64(-9223372036854775808),
+	}}, res.Rows)
+
+	res = query(t, g, `UNWIND [null, 'b', 2, true, [1], 1.5, 'a'] AS x RETURN x ORDER BY x`)
+	assert.Equal(t, [][]graph.Value{
+		{[]graph.Value{int64(1)}}, {"a"}, {"b"}, {true}, {1.5}, {int64(2)}, {nil},
+	}, res.Rows)
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+	plan, err := graph.Explain(`MATCH (a:Person)-[:FOLLOWS]->(b) WHERE b.age > 30 RETURN a.name ORDER BY a.name LIMIT 1`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Results",
+		"    Limit",
+		"        Sort",
+		"            Project",
+		"                Filter",
+		"                    Conditional Traverse | (a)-[:FOLLOWS]->(b)",
+		"                        Node By Label Scan | (a:Person)",
+	}, plan)
+
+	plan, err = graph.Explain(`MATCH (a), (b) MERGE (a)-[:R]->(b) CREATE (c)`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Create",
+		"    Merge",
+		"        All Node Scan | (b)",
+		"            All Node Scan | (a)",
+	}, plan)
+
+	_, err = graph.Explain(`MATCH`)
+	assert.ErrorIs(t, err, graph.ErrSyntax)
+}
+
+func TestGraph_Clone(t *testing.T) {
+	t.Parallel()
+	g := social(t)
+	c := g.Clone()
+	query(t, g, `MATCH (n:Person {name: 'bob'}) DETACH DELETE n`)
+	query(t, g, `MATCH (n:Person {name: 'alice'}) SET n.age = 31`)
+
+	assert.Equal(t, 4, c.NodeCount())
+	assert.Equal(t, 4, c.RelationshipCount())
+	res := query(t, c, `MATCH (a {name: 'alice'})-[:FOLLOWS]->(b) RETURN a.age, b.name ORDER BY b.name`)
+	assert.Equal(t, [][]graph.Value{{int64(30), "bob"}, {int64(30), "carol"}}, res.Rows)
+
+	// Identifiers of the copy continue from the original ones.
+	res = query(t, c, `CREATE (n:City) RETURN id(n)`)
+	assert.Equal(t, [][]graph.Value{{int64(4)}}, res.Rows)
+	assert.Equal(t, 3, g.NodeCount())
+}
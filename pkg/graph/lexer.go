@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	// tokQuoted is a backtick quoted identifier which is never a keyword.
+	tokQuoted
+	tokInt
+	tokFloat
+	tokString
+	tokParam
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether a token is the given punctuation or a keyword ignoring case.
+func (t token) is(s string) bool {
+	switch t.kind {
+	case tokPunct:
+		return t.text == s
+	case tokIdent:
+		return strings.EqualFold(t.text, s)
+	}
+	return false
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// twoCharPuncts are punctuations of two characters. Arrows aren't tokens because
+// the minus may be a part of a relationship pattern like <-[r]-.
+var twoCharPuncts = []string{"<>", "<=", ">=", "..", "+="}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case r >= '0' && r <= '9':
+			tok := lexNumber(src, i)
+			tokens = append(tokens, tok)
+			i += len(tok.text)
+		case r == '\'' || r == '"':
+			text, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at offset %d: %w", ErrSyntax, i, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i += n
+		case r == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("%w at offset %d: unterminated identifier", ErrSyntax, i)
+			}
+			tokens = append(tokens, token{kind: tokQuoted, text: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case r == '$':
+			start := i
+			i++
+			for i < len(src) && (src[i] == '_' || isAlnum(src[i])) {
+				i++
+			}
+			if i == start+1 {
+				return nil, fmt.Errorf("%w at offset %d: invalid parameter", ErrSyntax, start)
+			}
+			tokens = append(tokens, token{kind: tokParam, text: src[start+1 : i], pos: start})
+		default:
+			text := string(r)
+			for _, p := range twoCharPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					text = p
+				}
+			}
+			if !strings.Contains("()[]{},:.|*+-/%=<>;^", text[:1]) {
+				return nil, fmt.Errorf("%w at offset %d: unexpected character '%s'", ErrSyntax, i, text)
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: text, pos: i})
+			i += len(text)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func lexNumber(src string, start int) token {
+	i := start
+	digits := func() {
+		for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+			i++
+		}
+	}
+	digits()
+	kind := tokInt
+	// A dot followed by a dot is a range like *1..3.
+	if i+1 < len(src) && src[i] == '.' && src[i+1] >= '0' && src[i+1] <= '9' {
+		kind = tokFloat
+		i++
+		digits()
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '-' || src[j] == '+') {
+			j++
+		}
+		if j < len(src) && src[j] >= '0' && src[j] <= '9' {
+			kind = tokFloat
+			i = j
+			digits()
+		}
+	}
+	return token{kind: kind, text: src[start:i], pos: start}
+}
+
+// lexString returns the unescaped string literal at the start of src and its length.
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var sb strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(src[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
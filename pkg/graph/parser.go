@@ -0,0 +1,922 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	anon   int
+}
+
+// parse parses a query optionally prefixed with parameters like CYPHER name=value.
+func parse(src string) (*query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	q := &query{params: map[string]Value{}}
+	if err := p.parseParams(q); err != nil {
+		return nil, err
+	}
+	for p.peek().kind != tokEOF && !p.peek().is(";") {
+		c, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		q.clauses = append(q.clauses, c)
+	}
+	p.accept(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	if err := validate(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given punctuation or keyword.
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok token) error {
+	return fmt.Errorf("%w at offset %d: unexpected %s", ErrSyntax, tok.pos, tok)
+}
+
+func (p *parser) identifier() (string, error) {
+	tok := p.next()
+	if tok.kind != tokIdent && tok.kind != tokQuoted {
+		return "", p.unexpected(tok)
+	}
+	return tok.text, nil
+}
+
+func (p *parser) anonymous() string {
+	p.anon++
+	return fmt.Sprintf(" anon_%d", p.anon)
+}
+
+func (p *parser) parseParams(q *query) error {
+	if !p.peek().is("CYPHER") {
+		return nil
+	}
+	p.next()
+	for p.peek().kind == tokIdent && p.peekAt(1).is("=") {
+		name := p.next().text
+		p.next()
+		e, err := p.parseExpr()
+		if err != nil {
+			return err
+		}
+		value, err := (&executor{}).eval(e, nil)
+		if err != nil {
+			return fmt.Errorf("%w: invalid value of parameter %s: %w", ErrSyntax, name, err)
+		}
+		q.params[name] = value
+	}
+	return nil
+}
+
+func (p *parser) parseClause() (clause, error) {
+	tok := p.next()
+	switch {
+	case tok.is("OPTIONAL"):
+		if err := p.expect("MATCH"); err != nil {
+			return nil, err
+		}
+		return p.parseMatch(true)
+	case tok.is("MATCH"):
+		return p.parseMatch(false)
+	case tok.is("UNWIND"):
+		list, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AS"); err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		return &unwindClause{list: list, variable: name}, nil
+	case tok.is("CREATE"):
+		patterns, err := p.parsePatterns()
+		if err != nil {
+			return nil, err
+		}
+		return &createClause{patterns: patterns}, nil
+	case tok.is("MERGE"):
+		return p.parseMerge()
+	case tok.is("SET"):
+		items, err := p.parseSetItems()
+		if err != nil {
+			return nil, err
+		}
+		return &setClause{items: items}, nil
+	case tok.is("REMOVE"):
+		return p.parseRemove()
+	case tok.is("DETACH"):
+		if err := p.expect("DELETE"); err != nil {
+			return nil, err
+		}
+		return p.parseDelete(true)
+	case tok.is("DELETE"):
+		return p.parseDelete(false)
+	case tok.is("WITH"):
+		return p.parseProjection(true)
+	case tok.is("RETURN"):
+		return p.parseProjection(false)
+	case tok.is("CALL"):
+		return p.parseCall()
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *parser) parseMatch(optional bool) (clause, error) {
+	patterns, err := p.parsePatterns()
+	if err != nil {
+		return nil, err
+	}
+	c := &matchClause{optional: optional, patterns: patterns}
+	if p.accept("WHERE") {
+		if c.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parseMerge() (clause, error) {
+	pattern, err := p.parsePattern()
+	if err != nil {
+		return nil, err
+	}
+	c := &mergeClause{pattern: pattern}
+	for p.accept("ON") {
+		onCreate := p.accept("CREATE")
+		if !onCreate {
+			if err := p.expect("MATCH"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("SET"); err != nil {
+			return nil, err
+		}
+		items, err := p.parseSetItems()
+		if err != nil {
+			return nil, err
+		}
+		if onCreate {
+			c.onCreate = append(c.onCreate, items...)
+		} else {
+			c.onMatch = append(c.onMatch, items...)
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parseSetItems() ([]setItem, error) {
+	var items []setItem
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		item := setItem{variable: name}
+		switch {
+		case p.accept("."):
+			item.kind = setProperty
+			if item.key, err = p.identifier(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			item.value, err = p.parseExpr()
+		case p.accept("="):
+			item.kind = setReplace
+			item.value, err = p.parseExpr()
+		case p.accept("+="):
+			item.kind = setMerge
+			item.value, err = p.parseExpr()
+		case p.peek().is(":"):
+			item.kind = setLabels
+			item.labels, err = p.parseLabels()
+		default:
+			return nil, p.unexpected(p.peek())
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.accept(",") {
+			return items, nil
+		}
+	}
+}
+
+func (p *parser) parseRemove() (clause, error) {
+	c := &removeClause{}
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		item := setItem{variable: name}
+		if p.accept(".") {
+			item.kind = setProperty
+			item.key, err = p.identifier()
+		} else {
+			item.kind = setLabels
+			item.labels, err = p.parseLabels()
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.items = append(c.items, item)
+		if !p.accept(",") {
+			return c, nil
+		}
+	}
+}
+
+func (p *parser) parseDelete(detach bool) (clause, error) {
+	exprs, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	return &deleteClause{detach: detach, exprs: exprs}, nil
+}
+
+func (p *parser) parseProjection(with bool) (clause, error) {
+	c := &projectionClause{with: with, distinct: p.accept("DISTINCT")}
+	if p.accept("*") {
+		c.star = true
+		if !p.accept(",") {
+			return p.parseProjectionTail(c)
+		}
+	}
+	for {
+		start := p.peek().pos
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := projectionItem{expr: e, alias: strings.TrimSpace(p.src[start:p.peek().pos])}
+		if p.accept("AS") {
+			if item.alias, err = p.identifier(); err != nil {
+				return nil, err
+			}
+		}
+		c.items = append(c.items, item)
+		if !p.accept(",") {
+			return p.parseProjectionTail(c)
+		}
+	}
+}
+
+func (p *parser) parseProjectionTail(c *projectionClause) (clause, error) {
+	var err error
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := sortItem{expr: e}
+			switch {
+			case p.accept("DESC"), p.accept("DESCENDING"):
+				item.desc = true
+			case p.accept("ASC"), p.accept("ASCENDING"):
+			}
+			c.orderBy = append(c.orderBy, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("SKIP") {
+		if c.skip, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("LIMIT") {
+		if c.limit, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if c.with && p.accept("WHERE") {
+		if c.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parseCall() (clause, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(".") {
+		part, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		name += "." + part
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	c := &callClause{procedure: name}
+	if !p.accept(")") {
+		if c.args, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("YIELD") {
+		for {
+			name, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			c.yield = append(c.yield, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parsePatterns() ([]*patternPart, error) {
+	var parts []*patternPart
+	for {
+		part, err := p.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		if !p.accept(",") {
+			return parts, nil
+		}
+	}
+}
+
+func (p *parser) parsePattern() (*patternPart, error) {
+	part := &patternPart{}
+	if p.peekAt(1).is("=") {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		part.path = name
+		p.next()
+	}
+	n, err := p.parseNodePattern()
+	if err != nil {
+		return nil, err
+	}
+	part.nodes = append(part.nodes, n)
+	for p.peek().is("-") || p.peek().is("<") {
+		r, err := p.parseRelPattern()
+		if err != nil {
+			return nil, err
+		}
+		n, err := p.parseNodePattern()
+		if err != nil {
+			return nil, err
+		}
+		part.rels = append(part.rels, r)
+		part.nodes = append(part.nodes, n)
+	}
+	return part, nil
+}
+
+func (p *parser) parseNodePattern() (*nodePattern, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	n := &nodePattern{}
+	var err error
+	if tok := p.peek(); tok.kind == tokIdent || tok.kind == tokQuoted {
+		n.variable = p.next().text
+	} else {
+		n.variable = p.anonymous()
+	}
+	if p.peek().is(":") {
+		if n.labels, err = p.parseLabels(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().is("{") {
+		if n.props, err = p.parseMap(); err != nil {
+			return nil, err
+		}
+	}
+	return n, p.expect(")")
+}
+
+func (p *parser) parseLabels() ([]string, error) {
+	var labels []string
+	for p.accept(":") {
+		label, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+func (p *parser) parseRelPattern() (*relPattern, error) {
+	r := &relPattern{dir: dirBoth, minHops: 1, maxHops: 1}
+	if p.accept("<") {
+		r.dir = dirIn
+	}
+	if err := p.expect("-"); err != nil {
+		return nil, err
+	}
+	if p.accept("[") {
+		if err := p.parseRelDetail(r); err != nil {
+			return nil, err
+		}
+	} else {
+		r.variable = p.anonymous()
+	}
+	if err := p.expect("-"); err != nil {
+		return nil, err
+	}
+	if p.accept(">") {
+		if r.dir == dirIn {
+			return nil, fmt.Errorf("%w at offset %d: relationship can't point in both directions",
+				ErrSyntax, p.peek().pos)
+		}
+		r.dir = dirOut
+	}
+	return r, nil
+}
+
+func (p *parser) parseRelDetail(r *relPattern) error {
+	var err error
+	if tok := p.peek(); tok.kind == tokIdent || tok.kind == tokQuoted {
+		r.variable = p.next().text
+	} else {
+		r.variable = p.anonymous()
+	}
+	if p.accept(":") {
+		for {
+			relType, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			r.types = append(r.types, relType)
+			if !p.accept("|") {
+				break
+			}
+			p.accept(":")
+		}
+	}
+	if p.accept("*") {
+		if err := p.parseHops(r); err != nil {
+			return err
+		}
+	}
+	if p.peek().is("{") {
+		if r.props, err = p.parseMap(); err != nil {
+			return err
+		}
+	}
+	return p.expect("]")
+}
+
+// parseHops parses a length of a variable length relationship like *, *2, *1..3, *..3 or *2..
+func (p *parser) parseHops(r *relPattern) error {
+	r.varLength = true
+	r.minHops, r.maxHops = 1, -1
+	hops := func() (int, bool, error) {
+		if p.peek().kind != tokInt {
+			return 0, false, nil
+		}
+		tok := p.next()
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w at offset %d: invalid length %s", ErrSyntax, tok.pos, tok.text)
+		}
+		return n, true, nil
+	}
+	low, hasLow, err := hops()
+	if err != nil {
+		return err
+	}
+	if hasLow {
+		r.minHops = low
+	}
+	if !p.accept("..") {
+		if hasLow {
+			r.maxHops = low
+		}
+		return nil
+	}
+	high, hasHigh, err := hops()
+	if err != nil {
+		return err
+	}
+	if hasHigh {
+		r.maxHops = high
+	}
+	if r.maxHops >= 0 && r.maxHops < r.minHops {
+		return fmt.Errorf("%w: maximal length of a relationship is less than minimal", ErrSyntax)
+	}
+	return nil
+}
+
+func (p *parser) parseMap() (*mapLit, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	m := &mapLit{}
+	if p.accept("}") {
+		return m, nil
+	}
+	for {
+		tok := p.next()
+		if tok.kind != tokIdent && tok.kind != tokQuoted && tok.kind != tokString {
+			return nil, p.unexpected(tok)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, tok.text)
+		m.values = append(m.values, value)
+		if !p.accept(",") {
+			return m, p.expect("}")
+		}
+	}
+}
+
+func (p *parser) parseExprList() ([]expr, error) {
+	var exprs []expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseBinary(0)
+}
+
+// binaryLevels are binary operators from the lowest precedence.
+var binaryLevels = [][]string{
+	{"OR"},
+	{"XOR"},
+	{"AND"},
+}
+
+func (p *parser) parseBinary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.parseNot()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range binaryLevels[level] {
+			if p.accept(candidate) {
+				op = candidate
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisons = []string{"=", "<>", "<=", ">=", "<", ">", "IN", "CONTAINS"}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseArithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		switch {
+		case p.accept("IS"):
+			not := p.accept("NOT")
+			if err := p.expect("NULL"); err != nil {
+				return nil, err
+			}
+			left = &isNullExpr{x: left, not: not}
+			continue
+		case p.peek().is("STARTS") && p.peekAt(1).is("WITH"):
+			op = "STARTS WITH"
+		case p.peek().is("ENDS") && p.peekAt(1).is("WITH"):
+			op = "ENDS WITH"
+		}
+		if op != "" {
+			p.pos += 2
+		} else {
+			for _, candidate := range comparisons {
+				if p.accept(candidate) {
+					op = candidate
+					break
+				}
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseArithmetic(0)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+var arithmeticLevels = [][]string{
+	{"+", "-"},
+	{"*", "/", "%"},
+	{"^"},
+}
+
+func (p *parser) parseArithmetic(level int) (expr, error) {
+	if level == len(arithmeticLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseArithmetic(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range arithmeticLevels[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseArithmetic(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	switch {
+	case p.peek().is("-") && p.peekAt(1).kind == tokInt:
+		// Negative literals are parsed at once to allow the minimal integer.
+		p.next()
+		return p.parseNumber(p.next(), "-")
+	case p.accept("-"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	case p.accept("+"):
+		return p.parseUnary()
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	x, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			key, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			x = &propRef{subject: x, key: key}
+		case p.accept("["):
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexRef{subject: x, index: index}
+		case p.peek().is(":"):
+			labels, err := p.parseLabels()
+			if err != nil {
+				return nil, err
+			}
+			x = &labelExpr{x: x, labels: labels}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) parseNumber(tok token, sign string) (expr, error) {
+	if tok.kind == tokFloat {
+		f, err := strconv.ParseFloat(sign+tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d: invalid number %s", ErrSyntax, tok.pos, tok.text)
+		}
+		return &literal{value: f}, nil
+	}
+	i, err := strconv.ParseInt(sign+tok.text, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w at offset %d: integer overflow %s", ErrSyntax, tok.pos, tok.text)
+	}
+	return &literal{value: i}, nil
+}
+
+func (p *parser) parseAtom() (expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokInt, tokFloat:
+		return p.parseNumber(tok, "")
+	case tokString:
+		return &literal{value: tok.text}, nil
+	case tokParam:
+		return &paramRef{name: tok.text}, nil
+	case tokQuoted:
+		return &varRef{name: tok.text}, nil
+	case tokIdent:
+		switch {
+		case tok.is("TRUE"):
+			return &literal{value: true}, nil
+		case tok.is("FALSE"):
+			return &literal{value: false}, nil
+		case tok.is("NULL"):
+			return &literal{value: nil}, nil
+		case p.peek().is("("):
+			return p.parseCallExpr(tok)
+		}
+		return &varRef{name: tok.text}, nil
+	}
+	switch {
+	case tok.is("("):
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case tok.is("["):
+		l := &listLit{}
+		if p.accept("]") {
+			return l, nil
+		}
+		items, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		l.items = items
+		return l, p.expect("]")
+	case tok.is("{"):
+		p.pos--
+		return p.parseMap()
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *parser) parseCallExpr(name token) (expr, error) {
+	p.next()
+	call := &funcCall{name: strings.ToLower(name.text)}
+	if _, ok := functions[call.name]; !ok && !aggregates[call.name] {
+		return nil, fmt.Errorf("%w at offset %d: unknown function '%s'", ErrSyntax, name.pos, name.text)
+	}
+	if call.name == "count" && p.accept("*") {
+		call.star = true
+		return call, p.expect(")")
+	}
+	call.distinct = p.accept("DISTINCT")
+	if p.accept(")") {
+		return call, nil
+	}
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	call.args = args
+	if aggregates[call.name] && len(args) != 1 {
+		return nil, fmt.Errorf("%w: %s expects one argument", ErrSyntax, call.name)
+	}
+	return call, p.expect(")")
+}
+
+// validate checks the order of clauses.
+func validate(q *query) error {
+	if len(q.clauses) == 0 {
+		return fmt.Errorf("%w: empty query", ErrSyntax)
+	}
+	for i, c := range q.clauses {
+		last := i == len(q.clauses)-1
+		switch c := c.(type) {
+		case *projectionClause:
+			if !c.with && !last {
+				return fmt.Errorf("%w: RETURN can only be used at the end of the query", ErrSyntax)
+			}
+			if c.with && last {
+				return fmt.Errorf("%w: query cannot conclude with WITH", ErrSyntax)
+			}
+		case *matchClause:
+			if last {
+				return fmt.Errorf("%w: query cannot conclude with MATCH", ErrSyntax)
+			}
+		case *unwindClause:
+			if last {
+				return fmt.Errorf("%w: query cannot conclude with UNWIND", ErrSyntax)
+			}
+		}
+	}
+	return nil
+}
+
+// isWrite reports whether a query modifies a graph.
+func (q *query) isWrite() bool {
+	for _, c := range q.clauses {
+		switch c.(type) {
+		case *createClause, *mergeClause, *setClause, *removeClause, *deleteClause:
+			return true
+		}
+	}
+	return false
+}
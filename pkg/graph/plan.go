@@ -0,0 +1,1360 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// op is an operation of an execution plan transforming rows produced by the previous one.
+type op interface {
+	apply(ex *executor, rows []row) ([]row, error)
+	// String describes an operation in GRAPH.EXPLAIN output. Empty operations aren't shown.
+	String() string
+}
+
+type plan struct {
+	ops []op
+	// columns are names of result columns or nil if the query returns nothing.
+	columns []string
+}
+
+type planner struct {
+	bound   map[string]bool
+	matches int
+}
+
+func newPlan(q *query) (*plan, error) {
+	pl := &planner{bound: map[string]bool{}}
+	res := &plan{}
+	for _, c := range q.clauses {
+		ops, columns, err := pl.planClause(c)
+		if err != nil {
+			return nil, err
+		}
+		res.ops = append(res.ops, ops...)
+		if columns != nil {
+			res.columns = columns
+		}
+	}
+	return res, nil
+}
+
+func (pl *planner) planClause(c clause) ([]op, []string, error) {
+	switch c := c.(type) {
+	case *matchClause:
+		ops, err := pl.planMatch(c)
+		return ops, nil, err
+	case *unwindClause:
+		if err := pl.bind(c.variable); err != nil {
+			return nil, nil, err
+		}
+		return []op{&unwindOp{list: c.list, variable: c.variable}}, nil, nil
+	case *createClause:
+		create, err := pl.planCreate(c.patterns, "CREATE")
+		if err != nil {
+			return nil, nil, err
+		}
+		return []op{create}, nil, nil
+	case *mergeClause:
+		merge, err := pl.planMerge(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []op{merge}, nil, nil
+	case *setClause:
+		return []op{&updateOp{items: c.items}}, nil, pl.checkBound(c.items)
+	case *removeClause:
+		return []op{&updateOp{items: c.items, remove: true}}, nil, pl.checkBound(c.items)
+	case *deleteClause:
+		return []op{&deleteOp{exprs: c.exprs}}, nil, nil
+	case *projectionClause:
+		return pl.planProjection(c)
+	case *callClause:
+		return pl.planCall(c)
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported clause", ErrQuery)
+}
+
+// bind declares a new variable.
+func (pl *planner) bind(name string) error {
+	if pl.bound[name] {
+		return fmt.Errorf("%w: variable '%s' already declared", ErrQuery, name)
+	}
+	pl.bound[name] = true
+	return nil
+}
+
+func (pl *planner) checkBound(items []setItem) error {
+	for _, item := range items {
+		if !pl.bound[item.variable] {
+			return fmt.Errorf("%w: '%s' not defined", ErrQuery, item.variable)
+		}
+	}
+	return nil
+}
+
+func (pl *planner) planMatch(c *matchClause) ([]op, error) {
+	before := make(map[string]bool, len(pl.bound))
+	for name := range pl.bound {
+		before[name] = true
+	}
+	pl.matches++
+	used := " used_" + strconv.Itoa(pl.matches)
+	var ops []op
+	for _, part := range c.patterns {
+		partOps, err := pl.planPattern(part, used)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, partOps...)
+	}
+	if c.where != nil {
+		ops = append(ops, &filterOp{predicate: c.where})
+	}
+	if !c.optional {
+		return ops, nil
+	}
+	var vars []string
+	for name := range pl.bound {
+		if !before[name] {
+			vars = append(vars, name)
+		}
+	}
+	slices.Sort(vars)
+	return []op{&optionalOp{ops: ops, vars: vars}}, nil
+}
+
+// planPattern plans matching of a path. used names a hidden variable holding relationships
+// matched by the clause, so every relationship is matched once.
+func (pl *planner) planPattern(part *patternPart, used string) ([]op, error) {
+	written := part
+	if !pl.bound[part.nodes[0].variable] && pl.bound[part.nodes[len(part.nodes)-1].variable] {
+		part = reversePattern(part)
+	}
+	var ops []op
+	first := part.nodes[0]
+	if pl.bound[first.variable] {
+		ops = append(ops, &scanOp{node: first, bound: true})
+	} else {
+		ops = append(ops, &scanOp{node: first})
+		pl.bound[first.variable] = true
+	}
+	for i, rel := range part.rels {
+		if pl.bound[rel.variable] {
+			return nil, fmt.Errorf("%w: relationship variable '%s' already declared", ErrQuery, rel.variable)
+		}
+		to := part.nodes[i+1]
+		ops = append(ops, &traverseOp{
+			from: part.nodes[i].variable, rel: rel, to: to, into: pl.bound[to.variable], used: used,
+		})
+		pl.bound[rel.variable] = true
+		pl.bound[to.variable] = true
+	}
+	if part.path != "" {
+		if err := pl.bind(part.path); err != nil {
+			return nil, err
+		}
+		ops = append(ops, &pathOp{part: written})
+	}
+	return ops, nil
+}
+
+// reversePattern returns the same path pattern written from the end.
+func reversePattern(part *patternPart) *patternPart {
+	res := &patternPart{path: part.path}
+	for i := len(part.nodes) - 1; i >= 0; i-- {
+		res.nodes = append(res.nodes, part.nodes[i])
+	}
+	for i := len(part.rels) - 1; i >= 0; i-- {
+		rel := *part.rels[i]
+		switch rel.dir {
+		case dirIn:
+			rel.dir = dirOut
+		case dirOut:
+			rel.dir = dirIn
+		}
+		res.rels = append(res.rels, &rel)
+	}
+	return res
+}
+
+func (pl *planner) planCreate(patterns []*patternPart, clause string) (*createOp, error) {
+	for _, part := range patterns {
+		for _, n := range part.nodes {
+			if pl.bound[n.variable] && (len(n.labels) > 0 || n.props != nil) {
+				return nil, fmt.Errorf("%w: the bound variable '%s' can't be redeclared in a %s clause",
+					ErrQuery, n.variable, clause)
+			}
+			pl.bound[n.variable] = true
+		}
+		for _, rel := range part.rels {
+			if len(rel.types) != 1 {
+				return nil, fmt.Errorf("%w: exactly one relationship type must be specified for %s",
+					ErrQuery, clause)
+			}
+			if rel.varLength {
+				return nil, fmt.Errorf("%w: variable length relationships cannot be used in %s",
+					ErrQuery, clause)
+			}
+			if clause == "CREATE" && rel.dir == dirBoth {
+				return nil, fmt.Errorf("%w: only directed relationships are supported in CREATE", ErrQuery)
+			}
+			if err := pl.bind(rel.variable); err != nil {
+				return nil, err
+			}
+		}
+		if part.path != "" {
+			if err := pl.bind(part.path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &createOp{patterns: patterns}, nil
+}
+
+func (pl *planner) planMerge(c *mergeClause) (*mergeOp, error) {
+	before := make(map[string]bool, len(pl.bound))
+	for name := range pl.bound {
+		before[name] = true
+	}
+	pl.matches++
+	match, err := pl.planPattern(c.pattern, " used_"+strconv.Itoa(pl.matches))
+	if err != nil {
+		return nil, err
+	}
+	pl.bound = before
+	create, err := pl.planCreate([]*patternPart{c.pattern}, "MERGE")
+	if err != nil {
+		return nil, err
+	}
+	if err := pl.checkBound(c.onCreate); err != nil {
+		return nil, err
+	}
+	if err := pl.checkBound(c.onMatch); err != nil {
+		return nil, err
+	}
+	return &mergeOp{match: match, create: create, onCreate: c.onCreate, onMatch: c.onMatch}, nil
+}
+
+func (pl *planner) planProjection(c *projectionClause) ([]op, []string, error) {
+	var items []projectionItem
+	if c.star {
+		var names []string
+		for name := range pl.bound {
+			if !anonymous(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, nil, fmt.Errorf("%w: RETURN * is not allowed when there are no variables in scope",
+				ErrQuery)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			items = append(items, projectionItem{expr: &varRef{name: name}, alias: name})
+		}
+	}
+	items = append(items, c.items...)
+
+	columns := make([]string, len(items))
+	aggregating := false
+	for i, item := range items {
+		if slices.Contains(columns[:i], item.alias) {
+			return nil, nil, fmt.Errorf("%w: multiple result columns with the same name '%s'",
+				ErrQuery, item.alias)
+		}
+		columns[i] = item.alias
+		if len(aggregateCalls(item.expr)) > 0 {
+			aggregating = true
+		}
+	}
+
+	var ops []op
+	if aggregating {
+		ops = append(ops, &aggregateOp{items: items})
+	} else {
+		ops = append(ops, &projectOp{items: items})
+	}
+	if c.distinct {
+		ops = append(ops, &distinctOp{columns: columns})
+	}
+	if len(c.orderBy) > 0 {
+		sorts := make([]sortItem, len(c.orderBy))
+		for i, s := range c.orderBy {
+			sorts[i] = s
+			// Sort by projected values of the same expressions.
+			for _, item := range items {
+				if item.expr.String() == s.expr.String() {
+					sorts[i].expr = &varRef{name: item.alias}
+				}
+			}
+		}
+		ops = append(ops, &sortOp{items: sorts})
+	}
+	if c.skip != nil {
+		ops = append(ops, &skipOp{count: c.skip})
+	}
+	if c.limit != nil {
+		ops = append(ops, &limitOp{count: c.limit})
+	}
+	ops = append(ops, &scopeOp{columns: columns})
+
+	pl.bound = map[string]bool{}
+	for _, column := range columns {
+		pl.bound[column] = true
+	}
+	if !c.with {
+		return ops, columns, nil
+	}
+	if c.where != nil {
+		ops = append(ops, &filterOp{predicate: c.where})
+	}
+	return ops, nil, nil
+}
+
+func (pl *planner) planCall(c *callClause) ([]op, []string, error) {
+	proc, ok := procedures[strings.ToLower(c.procedure)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: procedure '%s' is not registered", ErrQuery, c.procedure)
+	}
+	if len(c.args) > 0 {
+		return nil, nil, fmt.Errorf("%w: procedure '%s' requires 0 arguments", ErrQuery, c.procedure)
+	}
+	yield := c.yield
+	if yield == nil {
+		yield = []string{proc.output}
+	}
+	for _, name := range yield {
+		if name != proc.output {
+			return nil, nil, fmt.Errorf("%w: procedure '%s' does not yield output '%s'",
+				ErrQuery, c.procedure, name)
+		}
+		if err := pl.bind(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return []op{&procedureOp{name: c.procedure, proc: proc, yield: yield}}, yield, nil
+}
+
+// explain describes a plan from the last operation like GRAPH.EXPLAIN does.
+func (p *plan) explain() []string {
+	var lines []string
+	depth := 0
+	if p.columns != nil {
+		lines = append(lines, "Results")
+		depth++
+	}
+	var describe func(ops []op)
+	describe = func(ops []op) {
+		for i := len(ops) - 1; i >= 0; i-- {
+			s := ops[i].String()
+			if s == "" {
+				continue
+			}
+			lines = append(lines, strings.Repeat("    ", depth)+s)
+			depth++
+			if opt, ok := ops[i].(*optionalOp); ok {
+				describe(opt.ops)
+			}
+		}
+	}
+	describe(p.ops)
+	return lines
+}
+
+func (p *plan) execute(ex *executor) ([]row, error) {
+	rows := []row{{}}
+	for _, o := range p.ops {
+		var err error
+		if rows, err = o.apply(ex, rows); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// scanOp binds a variable to every node matching a pattern. A bound variable is only checked.
+type scanOp struct {
+	node  *nodePattern
+	bound bool
+}
+
+func (s *scanOp) String() string {
+	switch {
+	case s.bound:
+		return "Filter"
+	case len(s.node.labels) > 0:
+		return "Node By Label Scan | " + s.node.String()
+	}
+	return "All Node Scan | " + s.node.String()
+}
+
+func (s *scanOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		if s.bound {
+			n, ok := r[s.node.variable].(*Node)
+			if !ok {
+				continue
+			}
+			match, err := ex.matchNode(n, s.node, r)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				res = append(res, r)
+			}
+			continue
+		}
+		for _, n := range ex.g.nodes {
+			if n == nil {
+				continue
+			}
+			match, err := ex.matchNode(n, s.node, r)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				next := r.clone()
+				next[s.node.variable] = n
+				res = append(res, next)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (ex *executor) matchNode(n *Node, pattern *nodePattern, r row) (bool, error) {
+	for _, label := range pattern.labels {
+		if !n.HasLabel(label) {
+			return false, nil
+		}
+	}
+	return ex.matchProperties(n.Properties, pattern.props, r)
+}
+
+func (ex *executor) matchProperties(props Properties, pattern *mapLit, r row) (bool, error) {
+	if pattern == nil {
+		return true, nil
+	}
+	for i, k := range pattern.keys {
+		expected, err := ex.eval(pattern.values[i], r)
+		if err != nil {
+			return false, err
+		}
+		actual, _ := props.Get(k)
+		if equal(actual, expected) != true {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (ex *executor) matchRelationship(rel *Relationship, pattern *relPattern, r row) (bool, error) {
+	if len(pattern.types) > 0 && !slices.Contains(pattern.types, rel.Type) {
+		return false, nil
+	}
+	return ex.matchProperties(rel.Properties, pattern.props, r)
+}
+
+// step is a relationship leading to a node.
+type step struct {
+	rel  *Relationship
+	node *Node
+}
+
+// steps returns relationships of a node in the given direction.
+func (ex *executor) steps(n *Node, dir direction) []step {
+	var res []step
+	if dir != dirIn {
+		for _, rel := range n.out {
+			res = append(res, step{rel: rel, node: ex.g.nodes[rel.Dst]})
+		}
+	}
+	if dir != dirOut {
+		for _, rel := range n.in {
+			// Self loops are already visited as outgoing relationships.
+			if dir == dirBoth && rel.Src == rel.Dst {
+				continue
+			}
+			res = append(res, step{rel: rel, node: ex.g.nodes[rel.Src]})
+		}
+	}
+	return res
+}
+
+// traverseOp expands paths from a bound node through relationships matching a pattern.
+type traverseOp struct {
+	from string
+	rel  *relPattern
+	to   *nodePattern
+	// into checks that paths lead to an already bound node.
+	into bool
+	used string
+}
+
+func (t *traverseOp) String() string {
+	name := "Conditional Traverse"
+	switch {
+	case t.into:
+		name = "Expand Into"
+	case t.rel.varLength:
+		name = "Conditional Variable Length Traverse"
+	}
+	return fmt.Sprintf("%s | (%s)%s%s", name, strings.TrimSpace(t.from), t.rel, t.to)
+}
+
+func (t *traverseOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		src, ok := r[t.from].(*Node)
+		if !ok {
+			continue
+		}
+		used, _ := r[t.used].([]int64)
+		emit := func(rels []*Relationship, dst *Node) error {
+			if t.into && r[t.to.variable] != dst {
+				return nil
+			}
+			match, err := ex.matchNode(dst, t.to, r)
+			if err != nil || !match {
+				return err
+			}
+			next := r.clone()
+			ids := slices.Clip(used)
+			if t.rel.varLength {
+				list := make([]Value, len(rels))
+				for i, rel := range rels {
+					list[i] = rel
+					ids = append(ids, rel.ID)
+				}
+				next[t.rel.variable] = list
+			} else {
+				next[t.rel.variable] = rels[0]
+				ids = append(ids, rels[0].ID)
+			}
+			next[t.used] = ids
+			next[t.to.variable] = dst
+			res = append(res, next)
+			return nil
+		}
+		if err := t.expand(ex, src, used, r, nil, emit); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// expand walks paths of relationships not used yet by depth first search.
+func (t *traverseOp) expand(ex *executor, n *Node, used []int64, r row, path []*Relationship,
+	emit func(rels []*Relationship, dst *Node) error,
+) error {
+	if len(path) >= t.rel.minHops {
+		if len(path) > 0 || t.rel.varLength {
+			if err := emit(path, n); err != nil {
+				return err
+			}
+		}
+	}
+	if t.rel.maxHops >= 0 && len(path) >= t.rel.maxHops {
+		return nil
+	}
+	for _, s := range ex.steps(n, t.rel.dir) {
+		if slices.Contains(used, s.rel.ID) || slices.Contains(path, s.rel) {
+			continue
+		}
+		match, err := ex.matchRelationship(s.rel, t.rel, r)
+		if err != nil {
+			return err
+		}
+		if !match {
+			continue
+		}
+		if err := t.expand(ex, s.node, used, r, append(path, s.rel), emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathOp binds a path variable to the nodes and relationships matched by a pattern.
+type pathOp struct {
+	part *patternPart
+}
+
+func (p *pathOp) String() string {
+	return ""
+}
+
+func (p *pathOp) apply(ex *executor, rows []row) ([]row, error) {
+	res := rows[:0:0]
+	for _, r := range rows {
+		first, ok := r[p.part.nodes[0].variable].(*Node)
+		if !ok {
+			next := r.clone()
+			next[p.part.path] = nil
+			res = append(res, next)
+			continue
+		}
+		path := &Path{Nodes: []*Node{first}}
+		for _, pattern := range p.part.rels {
+			var rels []*Relationship
+			switch v := r[pattern.variable].(type) {
+			case *Relationship:
+				rels = []*Relationship{v}
+			case []Value:
+				for _, rel := range v {
+					rels = append(rels, rel.(*Relationship))
+				}
+			}
+			for _, rel := range rels {
+				cur := path.Nodes[len(path.Nodes)-1]
+				other := rel.Dst
+				if other == cur.ID {
+					other = rel.Src
+				}
+				path.Nodes = append(path.Nodes, ex.g.nodes[other])
+			}
+			path.Relationships = append(path.Relationships, rels...)
+		}
+		next := r.clone()
+		next[p.part.path] = path
+		res = append(res, next)
+	}
+	return res, nil
+}
+
+type filterOp struct {
+	predicate expr
+}
+
+func (f *filterOp) String() string {
+	return "Filter"
+}
+
+func (f *filterOp) apply(ex *executor, rows []row) ([]row, error) {
+	res := rows[:0:0]
+	for _, r := range rows {
+		ok, err := ex.evalPredicate(f.predicate, r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// optionalOp binds new variables to null for rows the operations produce nothing for.
+type optionalOp struct {
+	ops  []op
+	vars []string
+}
+
+func (o *optionalOp) String() string {
+	return "Optional"
+}
+
+func (o *optionalOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		matched := []row{r}
+		for _, sub := range o.ops {
+			var err error
+			if matched, err = sub.apply(ex, matched); err != nil {
+				return nil, err
+			}
+		}
+		if len(matched) == 0 {
+			next := r.clone()
+			for _, name := range o.vars {
+				next[name] = nil
+			}
+			matched = []row{next}
+		}
+		res = append(res, matched...)
+	}
+	return res, nil
+}
+
+type unwindOp struct {
+	list     expr
+	variable string
+}
+
+func (u *unwindOp) String() string {
+	return "Unwind"
+}
+
+func (u *unwindOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		v, err := ex.eval(u.list, r)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := v.([]Value)
+		if !ok {
+			items = []Value{v}
+		}
+		if v == nil {
+			items = nil
+		}
+		for _, item := range items {
+			next := r.clone()
+			next[u.variable] = item
+			res = append(res, next)
+		}
+	}
+	return res, nil
+}
+
+type createOp struct {
+	patterns []*patternPart
+}
+
+func (c *createOp) String() string {
+	return "Create"
+}
+
+func (c *createOp) apply(ex *executor, rows []row) ([]row, error) {
+	res := make([]row, 0, len(rows))
+	for _, r := range rows {
+		next, err := c.create(ex, r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, next)
+	}
+	return res, nil
+}
+
+func (c *createOp) create(ex *executor, r row) (row, error) {
+	next := r.clone()
+	for _, part := range c.patterns {
+		path := &Path{}
+		for i, pattern := range part.nodes {
+			n, err := ex.createNode(pattern, next)
+			if err != nil {
+				return nil, err
+			}
+			path.Nodes = append(path.Nodes, n)
+			if i == 0 {
+				continue
+			}
+			rel := part.rels[i-1]
+			props, err := ex.properties(rel.props, next)
+			if err != nil {
+				return nil, err
+			}
+			src, dst := path.Nodes[i-1], n
+			if rel.dir == dirIn {
+				src, dst = dst, src
+			}
+			created := ex.g.createRelationship(rel.types[0], src, dst, props, &ex.stats)
+			next[rel.variable] = created
+			path.Relationships = append(path.Relationships, created)
+		}
+		if part.path != "" {
+			next[part.path] = path
+		}
+	}
+	return next, nil
+}
+
+// createNode creates a node of a pattern unless its variable is already bound.
+func (ex *executor) createNode(pattern *nodePattern, r row) (*Node, error) {
+	if v, ok := r[pattern.variable]; ok {
+		n, ok := v.(*Node)
+		if !ok {
+			return nil, fmt.Errorf("%w: failed to create relationship; endpoint was not found", ErrQuery)
+		}
+		return n, nil
+	}
+	props, err := ex.properties(pattern.props, r)
+	if err != nil {
+		return nil, err
+	}
+	n := ex.g.createNode(pattern.labels, props, &ex.stats)
+	r[pattern.variable] = n
+	return n, nil
+}
+
+// properties evaluates properties of a created entity. Null properties are skipped.
+func (ex *executor) properties(m *mapLit, r row) (Properties, error) {
+	if m == nil {
+		return nil, nil
+	}
+	var props Properties
+	for i, k := range m.keys {
+		v, err := ex.eval(m.values[i], r)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if !isProperty(v) {
+			return nil, errPropertyType
+		}
+		props.set(k, v)
+	}
+	return props, nil
+}
+
+var errPropertyType = fmt.Errorf("%w: property values can only be of primitive types or arrays of primitive types",
+	ErrType)
+
+// mergeOp matches a pattern or creates it when nothing matches.
+type mergeOp struct {
+	match    []op
+	create   *createOp
+	onCreate []setItem
+	onMatch  []setItem
+}
+
+func (m *mergeOp) String() string {
+	return "Merge"
+}
+
+func (m *mergeOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		matched := []row{r}
+		for _, sub := range m.match {
+			var err error
+			if matched, err = sub.apply(ex, matched); err != nil {
+				return nil, err
+			}
+		}
+		items := m.onMatch
+		if len(matched) == 0 {
+			created, err := m.create.create(ex, r)
+			if err != nil {
+				return nil, err
+			}
+			matched, items = []row{created}, m.onCreate
+		}
+		for _, next := range matched {
+			if err := ex.update(items, false, next); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, matched...)
+	}
+	return res, nil
+}
+
+// updateOp implements SET and REMOVE.
+type updateOp struct {
+	items  []setItem
+	remove bool
+}
+
+func (u *updateOp) String() string {
+	return "Update"
+}
+
+func (u *updateOp) apply(ex *executor, rows []row) ([]row, error) {
+	for _, r := range rows {
+		if err := ex.update(u.items, u.remove, r); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func (ex *executor) update(items []setItem, remove bool, r row) error {
+	for _, item := range items {
+		target := r[item.variable]
+		if target == nil || ex.g.deleted(target) {
+			continue
+		}
+		var props *Properties
+		switch t := target.(type) {
+		case *Node:
+			props = &t.Properties
+			if item.kind == setLabels {
+				if remove {
+					removeLabels(t, item.labels)
+				} else {
+					ex.g.addLabels(t, item.labels, &ex.stats)
+				}
+				continue
+			}
+		case *Relationship:
+			if item.kind == setLabels {
+				return typeError("Node", target)
+			}
+			props = &t.Properties
+		default:
+			return fmt.Errorf("%w: update error: alias '%s' did not resolve to a graph entity",
+				ErrQuery, item.variable)
+		}
+		if remove {
+			ex.g.setProperty(props, item.key, nil, &ex.stats)
+			continue
+		}
+		v, err := ex.eval(item.value, r)
+		if err != nil {
+			return err
+		}
+		if err := ex.setProperties(props, item, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ex *executor) setProperties(props *Properties, item setItem, v Value) error {
+	if item.kind == setProperty {
+		if v != nil && !isProperty(v) {
+			return errPropertyType
+		}
+		ex.g.setProperty(props, item.key, v, &ex.stats)
+		return nil
+	}
+	var m map[string]Value
+	switch v := v.(type) {
+	case map[string]Value:
+		m = v
+	case *Node, *Relationship:
+		props, _ := functions["properties"].call(ex, []Value{v})
+		m = props.(map[string]Value)
+	default:
+		return typeError("Map", v)
+	}
+	if item.kind == setReplace {
+		for _, prop := range slices.Clone(*props) {
+			if _, ok := m[prop.Key]; !ok {
+				ex.g.setProperty(props, prop.Key, nil, &ex.stats)
+			}
+		}
+	}
+	for _, k := range sortedKeys(m) {
+		if m[k] != nil && !isProperty(m[k]) {
+			return errPropertyType
+		}
+		ex.g.setProperty(props, k, m[k], &ex.stats)
+	}
+	return nil
+}
+
+func removeLabels(n *Node, labels []string) {
+	n.Labels = slices.DeleteFunc(n.Labels, func(label string) bool {
+		return slices.Contains(labels, label)
+	})
+}
+
+// deleteOp deletes entities after evaluating all rows. Nodes are deleted with their relationships.
+type deleteOp struct {
+	exprs []expr
+}
+
+func (d *deleteOp) String() string {
+	return "Delete"
+}
+
+func (d *deleteOp) apply(ex *executor, rows []row) ([]row, error) {
+	var nodes []*Node
+	var rels []*Relationship
+	var collect func(v Value) error
+	collect = func(v Value) error {
+		switch v := v.(type) {
+		case nil:
+		case *Node:
+			nodes = append(nodes, v)
+		case *Relationship:
+			rels = append(rels, v)
+		case *Path:
+			nodes = append(nodes, v.Nodes...)
+			rels = append(rels, v.Relationships...)
+		default:
+			return fmt.Errorf("%w: delete type mismatch, expecting either Node or Relationship", ErrType)
+		}
+		return nil
+	}
+	for _, r := range rows {
+		for _, e := range d.exprs {
+			v, err := ex.eval(e, r)
+			if err != nil {
+				return nil, err
+			}
+			if err := collect(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, rel := range rels {
+		ex.g.deleteRelationship(rel, &ex.stats)
+	}
+	for _, n := range nodes {
+		ex.g.deleteNode(n, &ex.stats)
+	}
+	return rows, nil
+}
+
+type projectOp struct {
+	items []projectionItem
+}
+
+func (p *projectOp) String() string {
+	return "Project"
+}
+
+// apply keeps variables of rows, so ORDER BY may refer to them.
+func (p *projectOp) apply(ex *executor, rows []row) ([]row, error) {
+	res := make([]row, 0, len(rows))
+	for _, r := range rows {
+		next := r.clone()
+		for _, item := range p.items {
+			v, err := ex.eval(item.expr, r)
+			if err != nil {
+				return nil, err
+			}
+			next[item.alias] = v
+		}
+		res = append(res, next)
+	}
+	return res, nil
+}
+
+// aggregateOp groups rows by values of non-aggregating items.
+type aggregateOp struct {
+	items []projectionItem
+}
+
+func (a *aggregateOp) String() string {
+	return "Aggregate"
+}
+
+type group struct {
+	first row
+	keys  map[string]Value
+	accs  map[*funcCall]*accumulator
+}
+
+func (a *aggregateOp) apply(ex *executor, rows []row) ([]row, error) {
+	var calls []*funcCall
+	for _, item := range a.items {
+		calls = append(calls, aggregateCalls(item.expr)...)
+	}
+	newGroup := func(first row, keys map[string]Value) *group {
+		g := &group{first: first, keys: keys, accs: map[*funcCall]*accumulator{}}
+		for _, call := range calls {
+			g.accs[call] = &accumulator{call: call}
+		}
+		return g
+	}
+
+	var groups []*group
+	index := map[string]*group{}
+	for _, r := range rows {
+		keys := map[string]Value{}
+		var sb strings.Builder
+		for _, item := range a.items {
+			if len(aggregateCalls(item.expr)) > 0 {
+				continue
+			}
+			v, err := ex.eval(item.expr, r)
+			if err != nil {
+				return nil, err
+			}
+			keys[item.alias] = v
+			writeKey(&sb, v)
+			sb.WriteString(";")
+		}
+		g, ok := index[sb.String()]
+		if !ok {
+			g = newGroup(r, keys)
+			index[sb.String()] = g
+			groups = append(groups, g)
+		}
+		for _, call := range calls {
+			if err := g.accs[call].add(ex, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Aggregation without grouping keys returns a row even without input.
+	if len(groups) == 0 && slices.IndexFunc(a.items, func(item projectionItem) bool {
+		return len(aggregateCalls(item.expr)) == 0
+	}) < 0 {
+		groups = append(groups, newGroup(row{}, map[string]Value{}))
+	}
+
+	res := make([]row, 0, len(groups))
+	for _, g := range groups {
+		ex.aggregated = map[*funcCall]Value{}
+		for call, acc := range g.accs {
+			ex.aggregated[call] = acc.result()
+		}
+		next := g.first.clone()
+		for _, item := range a.items {
+			if v, ok := g.keys[item.alias]; ok {
+				next[item.alias] = v
+				continue
+			}
+			v, err := ex.eval(item.expr, g.first)
+			if err != nil {
+				return nil, err
+			}
+			next[item.alias] = v
+		}
+		res = append(res, next)
+	}
+	ex.aggregated = nil
+	return res, nil
+}
+
+type accumulator struct {
+	call  *funcCall
+	count int64
+	sum   Value
+	avg   float64
+	value Value
+	list  []Value
+	seen  map[string]bool
+}
+
+func (a *accumulator) add(ex *executor, r row) error {
+	if a.call.star {
+		a.count++
+		return nil
+	}
+	v, err := ex.eval(a.call.args[0], r)
+	if err != nil || v == nil {
+		return err
+	}
+	if a.call.distinct {
+		k := key(v)
+		if a.seen[k] {
+			return nil
+		}
+		if a.seen == nil {
+			a.seen = map[string]bool{}
+		}
+		a.seen[k] = true
+	}
+	a.count++
+	switch a.call.name {
+	case "sum", "avg":
+		f, ok := toFloat(v)
+		if !ok {
+			return typeError("Integer or Float", v)
+		}
+		a.avg += (f - a.avg) / float64(a.count)
+		if a.sum == nil {
+			a.sum = int64(0)
+		}
+		if a.sum, err = arithmetic("+", a.sum, v); err != nil {
+			// Integer sums overflowing are continued with doubles.
+			sum, _ := toFloat(a.sum)
+			a.sum = sum + f
+		}
+	case "min", "max":
+		if a.value == nil {
+			a.value = v
+			return nil
+		}
+		c := order(v, a.value)
+		if a.call.name == "min" && c < 0 || a.call.name == "max" && c > 0 {
+			a.value = v
+		}
+	case "collect":
+		a.list = append(a.list, v)
+	}
+	return nil
+}
+
+func (a *accumulator) result() Value {
+	switch a.call.name {
+	case "count":
+		return a.count
+	case "sum":
+		if a.sum == nil {
+			return int64(0)
+		}
+		return a.sum
+	case "avg":
+		if a.count == 0 {
+			return nil
+		}
+		return a.avg
+	case "collect":
+		if a.list == nil {
+			return []Value{}
+		}
+		return a.list
+	}
+	return a.value
+}
+
+type distinctOp struct {
+	columns []string
+}
+
+func (d *distinctOp) String() string {
+	return "Distinct"
+}
+
+func (d *distinctOp) apply(_ *executor, rows []row) ([]row, error) {
+	seen := map[string]bool{}
+	res := rows[:0:0]
+	for _, r := range rows {
+		var sb strings.Builder
+		for _, column := range d.columns {
+			writeKey(&sb, r[column])
+			sb.WriteString(";")
+		}
+		if !seen[sb.String()] {
+			seen[sb.String()] = true
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+type sortOp struct {
+	items []sortItem
+}
+
+func (s *sortOp) String() string {
+	return "Sort"
+}
+
+func (s *sortOp) apply(ex *executor, rows []row) ([]row, error) {
+	type sortable struct {
+		r    row
+		keys []Value
+	}
+	entries := make([]sortable, len(rows))
+	for i, r := range rows {
+		entries[i] = sortable{r: r, keys: make([]Value, len(s.items))}
+		for j, item := range s.items {
+			v, err := ex.eval(item.expr, r)
+			if err != nil {
+				return nil, err
+			}
+			entries[i].keys[j] = v
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b sortable) int {
+		for i, item := range s.items {
+			c := order(a.keys[i], b.keys[i])
+			if item.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	res := make([]row, len(entries))
+	for i, e := range entries {
+		res[i] = e.r
+	}
+	return res, nil
+}
+
+func (ex *executor) evalCount(e expr, clause string) (int, error) {
+	v, err := ex.eval(e, row{})
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("%w: %s specified value of invalid type, must be a positive integer",
+			ErrQuery, clause)
+	}
+	return int(min(n, int64(1<<31))), nil
+}
+
+type skipOp struct {
+	count expr
+}
+
+func (s *skipOp) String() string {
+	return "Skip"
+}
+
+func (s *skipOp) apply(ex *executor, rows []row) ([]row, error) {
+	n, err := ex.evalCount(s.count, "SKIP")
+	if err != nil {
+		return nil, err
+	}
+	return rows[min(n, len(rows)):], nil
+}
+
+type limitOp struct {
+	count expr
+}
+
+func (l *limitOp) String() string {
+	return "Limit"
+}
+
+func (l *limitOp) apply(ex *executor, rows []row) ([]row, error) {
+	n, err := ex.evalCount(l.count, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	return rows[:min(n, len(rows))], nil
+}
+
+// scopeOp keeps only projected variables.
+type scopeOp struct {
+	columns []string
+}
+
+func (s *scopeOp) String() string {
+	return ""
+}
+
+func (s *scopeOp) apply(_ *executor, rows []row) ([]row, error) {
+	res := make([]row, len(rows))
+	for i, r := range rows {
+		res[i] = make(row, len(s.columns))
+		for _, column := range s.columns {
+			res[i][column] = r[column]
+		}
+	}
+	return res, nil
+}
+
+type procedure struct {
+	output string
+	values func(g *Graph) []string
+}
+
+var procedures = map[string]procedure{
+	"db.labels":            {output: "label", values: (*Graph).Labels},
+	"db.relationshiptypes": {output: "relationshipType", values: (*Graph).RelationshipTypes},
+	"db.propertykeys":      {output: "propertyKey", values: (*Graph).PropertyKeys},
+}
+
+type procedureOp struct {
+	name  string
+	proc  procedure
+	yield []string
+}
+
+func (p *procedureOp) String() string {
+	return "ProcedureCall | " + p.name
+}
+
+func (p *procedureOp) apply(ex *executor, rows []row) ([]row, error) {
+	var res []row
+	for _, r := range rows {
+		for _, v := range p.proc.values(ex.g) {
+			next := r.clone()
+			next[p.proc.output] = v
+			res = append(res, next)
+		}
+	}
+	return res, nil
+}
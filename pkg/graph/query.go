@@ -0,0 +1,84 @@
+package graph
+
+// executor holds the state of a running query.
+type executor struct {
+	g      *Graph
+	params map[string]Value
+	stats  Stats
+	// aggregated holds results of aggregating functions of the current group.
+	aggregated map[*funcCall]Value
+}
+
+// Result is a result set of a query. Columns are nil when the query doesn't return anything.
+type Result struct {
+	Columns []string
+	Rows    [][]Value
+	Stats   Stats
+}
+
+// Modified reports whether a query changed the graph.
+func (s Stats) Modified() bool {
+	return s.modified()
+}
+
+// Query executes a query. The supported subset of Cypher consists of
+//
+//	[OPTIONAL] MATCH pattern, ... [WHERE condition]
+//	UNWIND list AS variable
+//	CREATE pattern, ...
+//	MERGE pattern [ON CREATE SET ...] [ON MATCH SET ...]
+//	SET n.key = value | n = {map} | n += {map} | n:Label, ...
+//	REMOVE n.key | n:Label, ...
+//	[DETACH] DELETE entity, ...
+//	WITH|RETURN [DISTINCT] * | expression [AS alias], ... [ORDER BY ...] [SKIP n] [LIMIT n]
+//	CALL db.labels() | db.relationshipTypes() | db.propertyKeys() [YIELD ...]
+//
+// Patterns like p = (a:Label {key: value})-[r:TYPE|OTHER *1..3]->(b) may be directed or not and
+// have variable length. Parameters are passed with a CYPHER name=value ... prefix.
+// Read only queries fail with ErrReadOnly if the query modifies the graph.
+//
+// A failed query may leave changes made before the failure.
+func (g *Graph) Query(src string, readOnly bool) (*Result, error) {
+	q, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if readOnly && q.isWrite() {
+		return nil, ErrReadOnly
+	}
+	p, err := newPlan(q)
+	if err != nil {
+		return nil, err
+	}
+	ex := &executor{g: g, params: q.params}
+	rows, err := p.execute(ex)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Columns: p.columns, Stats: ex.stats}
+	if p.columns == nil {
+		return res, nil
+	}
+	res.Rows = make([][]Value, len(rows))
+	for i, r := range rows {
+		res.Rows[i] = make([]Value, len(p.columns))
+		for j, column := range p.columns {
+			res.Rows[i][j] = r[column]
+		}
+	}
+	return res, nil
+}
+
+// Explain returns an execution plan of a query without executing it.
+// Every line describes an operation consuming rows of the next one indented deeper.
+func Explain(src string) ([]string, error) {
+	q, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPlan(q)
+	if err != nil {
+		return nil, err
+	}
+	return p.explain(), nil
+}
@@ -0,0 +1,356 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Value is a value of a query: nil, bool, int64, float64, string, []Value,
+// map[string]Value, *Node, *Relationship or *Path.
+type Value interface{}
+
+// typeName returns the Cypher name of a value type used in error messages.
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "Null"
+	case bool:
+		return "Boolean"
+	case int64:
+		return "Integer"
+	case float64:
+		return "Float"
+	case string:
+		return "String"
+	case []Value:
+		return "List"
+	case map[string]Value:
+		return "Map"
+	case *Node:
+		return "Node"
+	case *Relationship:
+		return "Edge"
+	case *Path:
+		return "Path"
+	}
+	return "Unknown"
+}
+
+func typeError(expected string, got Value) error {
+	return fmt.Errorf("%w: expected %s but was %s", ErrType, expected, typeName(got))
+}
+
+// isProperty reports whether a value can be stored as a property.
+func isProperty(v Value) bool {
+	switch v := v.(type) {
+	case bool, int64, float64, string:
+		return true
+	case []Value:
+		for _, item := range v {
+			if item == nil || !isProperty(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func toFloat(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equal implements Cypher equality. It returns nil when the result is unknown
+// because one of the values is null.
+func equal(a, b Value) Value {
+	if a == nil || b == nil {
+		return nil
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			if ai, ok := a.(int64); ok {
+				if bi, ok := b.(int64); ok {
+					return ai == bi
+				}
+			}
+			return x == y
+		}
+		return false
+	}
+	switch a := a.(type) {
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case []Value:
+		b, ok := b.([]Value)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		var res Value = true
+		for i := range a {
+			switch eq := equal(a[i], b[i]); eq {
+			case false:
+				return false
+			case nil:
+				res = nil
+			}
+		}
+		return res
+	case map[string]Value:
+		b, ok := b.(map[string]Value)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		var res Value = true
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok {
+				return false
+			}
+			switch eq := equal(av, bv); eq {
+			case false:
+				return false
+			case nil:
+				res = nil
+			}
+		}
+		return res
+	case *Node:
+		b, ok := b.(*Node)
+		return ok && a.ID == b.ID
+	case *Relationship:
+		b, ok := b.(*Relationship)
+		return ok && a.ID == b.ID
+	case *Path:
+		b, ok := b.(*Path)
+		return ok && key(a) == key(b)
+	}
+	return false
+}
+
+// compare compares values of comparable types. It reports false when values can't be compared.
+func compare(a, b Value) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		ai, aInt := a.(int64)
+		bi, bInt := b.(int64)
+		if aInt && bInt {
+			return cmp.Compare(ai, bi), true
+		}
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return 0, false
+		}
+		return cmp.Compare(x, y), true
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			return compareBool(a, b), true
+		}
+	case []Value:
+		if b, ok := b.([]Value); ok {
+			for i := 0; i < len(a) && i < len(b); i++ {
+				c, ok := compare(a[i], b[i])
+				if !ok {
+					return 0, false
+				}
+				if c != 0 {
+					return c, true
+				}
+			}
+			return cmp.Compare(len(a), len(b)), true
+		}
+	}
+	return 0, false
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// orderRank orders values of different types in ORDER BY.
+func orderRank(v Value) int {
+	switch v.(type) {
+	case map[string]Value:
+		return 0
+	case *Node:
+		return 1
+	case *Relationship:
+		return 2
+	case []Value:
+		return 3
+	case *Path:
+		return 4
+	case string:
+		return 5
+	case bool:
+		return 6
+	case int64, float64:
+		return 7
+	}
+	return 8
+}
+
+// order is a total order of values used by ORDER BY. Nulls are the last ones.
+func order(a, b Value) int {
+	ra, rb := orderRank(a), orderRank(b)
+	if ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+	switch a := a.(type) {
+	case *Node:
+		return cmp.Compare(a.ID, b.(*Node).ID)
+	case *Relationship:
+		return cmp.Compare(a.ID, b.(*Relationship).ID)
+	case []Value:
+		b := b.([]Value)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := order(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(len(a), len(b))
+	case float64, int64:
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		// NaN is greater than any other number.
+		switch {
+		case math.IsNaN(x) && math.IsNaN(y):
+			return 0
+		case math.IsNaN(x):
+			return 1
+		case math.IsNaN(y):
+			return -1
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+		ai, _ := a.(int64)
+		bi, _ := b.(int64)
+		return cmp.Compare(ai, bi)
+	}
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	return strings.Compare(key(a), key(b))
+}
+
+// key returns a string identifying a value used to group and deduplicate rows.
+func key(v Value) string {
+	var sb strings.Builder
+	writeKey(&sb, v)
+	return sb.String()
+}
+
+func writeKey(sb *strings.Builder, v Value) {
+	switch v := v.(type) {
+	case nil:
+		sb.WriteString("n")
+	case bool:
+		sb.WriteString("b" + strconv.FormatBool(v))
+	case int64:
+		sb.WriteString("i" + strconv.FormatInt(v, 10))
+	case float64:
+		// Integral floats are equal to integers.
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			sb.WriteString("i" + strconv.FormatInt(int64(v), 10))
+		} else {
+			sb.WriteString("f" + strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case string:
+		sb.WriteString("s" + strconv.Quote(v))
+	case []Value:
+		sb.WriteString("[")
+		for _, item := range v {
+			writeKey(sb, item)
+			sb.WriteString(",")
+		}
+		sb.WriteString("]")
+	case map[string]Value:
+		sb.WriteString("{")
+		for _, k := range sortedKeys(v) {
+			sb.WriteString(strconv.Quote(k) + ":")
+			writeKey(sb, v[k])
+			sb.WriteString(",")
+		}
+		sb.WriteString("}")
+	case *Node:
+		sb.WriteString("N" + strconv.FormatInt(v.ID, 10))
+	case *Relationship:
+		sb.WriteString("R" + strconv.FormatInt(v.ID, 10))
+	case *Path:
+		sb.WriteString("P")
+		for _, n := range v.Nodes {
+			sb.WriteString(strconv.FormatInt(n.ID, 10) + ",")
+		}
+		sb.WriteString("/")
+		for _, r := range v.Relationships {
+			sb.WriteString(strconv.FormatInt(r.ID, 10) + ",")
+		}
+	}
+}
+
+func sortedKeys(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// FormatFloat formats a double the way graph result sets do.
+func FormatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// toString converts a value to a string like toString() does.
+func toString(v Value) (Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return FormatFloat(v), nil
+	}
+	return nil, typeError("String, Boolean, Integer or Float", v)
+}
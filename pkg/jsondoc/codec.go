@@ -0,0 +1,199 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrSyntax = errors.New("invalid JSON")
+
+// Parse decodes a single JSON value. Integers that fit into int64 are decoded as int64,
+// all other numbers are decoded as float64.
+func Parse(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := parseValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: trailing data after value", ErrSyntax)
+	}
+	return value, nil
+}
+
+func parseValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return parseObject(dec)
+		case '[':
+			return parseArray(dec)
+		default:
+			return nil, fmt.Errorf("%w: unexpected %s", ErrSyntax, t)
+		}
+	case json.Number:
+		return parseNumber(t)
+	default:
+		return t, nil
+	}
+}
+
+func parseObject(dec *json.Decoder) (*Object, error) {
+	obj := NewObject()
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: object key must be a string", ErrSyntax)
+		}
+		value, err := parseValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+	return obj, nil
+}
+
+func parseArray(dec *json.Decoder) (*Array, error) {
+	arr := NewArray()
+	for dec.More() {
+		value, err := parseValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		arr.Items = append(arr.Items, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+	return arr, nil
+}
+
+func parseNumber(n json.Number) (interface{}, error) {
+	if i, err := n.Int64(); err == nil {
+		return i, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+	return f, nil
+}
+
+// Format describes whitespace used by Marshal, the same way as INDENT, NEWLINE and SPACE
+// options of JSON.GET do.
+type Format struct {
+	Indent  string
+	Newline string
+	Space   string
+}
+
+func (f Format) compact() bool {
+	return f.Indent == "" && f.Newline == "" && f.Space == ""
+}
+
+// Marshal encodes value. Empty Format produces compact output.
+func Marshal(value interface{}, format Format) []byte {
+	buf := &bytes.Buffer{}
+	marshalValue(buf, value, format, 0)
+	return buf.Bytes()
+}
+
+//nolint:gocognit // plain switch over JSON types
+func marshalValue(buf *bytes.Buffer, value interface{}, format Format, depth int) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(FormatFloat(v))
+	case string:
+		marshalString(buf, v)
+	case *Array:
+		if len(v.Items) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteByte('[')
+		for i, item := range v.Items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeIndent(buf, format, depth+1)
+			marshalValue(buf, item, format, depth+1)
+		}
+		writeIndent(buf, format, depth)
+		buf.WriteByte(']')
+	case *Object:
+		if v.Len() == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeIndent(buf, format, depth+1)
+			marshalString(buf, key)
+			buf.WriteByte(':')
+			buf.WriteString(format.Space)
+			marshalValue(buf, v.values[key], format, depth+1)
+		}
+		writeIndent(buf, format, depth)
+		buf.WriteByte('}')
+	default:
+		panic(fmt.Sprintf("unsupported JSON value %T", value))
+	}
+}
+
+func writeIndent(buf *bytes.Buffer, format Format, depth int) {
+	if format.compact() {
+		return
+	}
+	buf.WriteString(format.Newline)
+	buf.WriteString(strings.Repeat(format.Indent, depth))
+}
+
+func marshalString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)           // encoding a string never fails
+	buf.Truncate(buf.Len() - 1) // Encode always appends a newline
+}
+
+// FormatFloat formats a float so that it is always distinguishable from an integer.
+func FormatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "null"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package jsondoc_test
+
+import (
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/jsondoc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sample = `{"store":{"book":[{"title":"Sayings","price":8.95},{"title":"Moby Dick","price":9}],` +
+	`"bicycle":{"color":"red","price":19.95}},"name":"shop"}`
+
+func mustParse(t *testing.T, data string) *jsondoc.Document {
+	t.Helper()
+	root, err := jsondoc.Parse([]byte(data))
+	require.NoError(t, err)
+	return jsondoc.New(root)
+}
+
+func TestParseMarshal(t *testing.T) {
+	t.Parallel()
+	cases := []string{
+		`{"b":1,"a":[1,2.5,"x",true,null,{}],"c":[]}`,
+		`"str\"ing"`,
+		`-12`,
+		`1.0`,
+		`null`,
+	}
+	for _, c := range cases {
+		doc := mustParse(t, c)
+		assert.Equal(t, c, string(jsondoc.Marshal(doc.Root(), jsondoc.Format{})))
+	}
+
+	_, err := jsondoc.Parse([]byte(`{"a":1} 2`))
+	require.ErrorIs(t, err, jsondoc.ErrSyntax)
+	_, err = jsondoc.Parse([]byte(`{"a":`))
+	require.ErrorIs(t, err, jsondoc.ErrSyntax)
+}
+
+func TestMarshal_format(t *testing.T) {
+	t.Parallel()
+	doc := mustParse(t, `{"a":[1,2],"b":{}}`)
+	actual := jsondoc.Marshal(doc.Root(), jsondoc.Format{Indent: "  ", Newline: "\n", Space: " "})
+	assert.Equal(t, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}", string(actual))
+}
+
+func TestPath_Select(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		Path     string
+		Expected string
+	}{
+		{Path: "$", Expected: sample},
+		{Path: "$.name", Expected: `["shop"]`},
+		{Path: "$.store.book[0].title", Expected: `["Sayings"]`},
+		{Path: "$.store.book[-1].title", Expected: `["Moby Dick"]`},
+		{Path: "$['store']['bicycle'].color", Expected: `["red"]`},
+		{Path: "$.store.book[*].price", Expected: `[8.95,9]`},
+		{Path: "$..price", Expected: `[8.95,9,19.95]`},
+		{Path: "$.store.*.color", Expected: `["red"]`},
+		{Path: "$..book[1].title", Expected: `["Moby Dick"]`},
+		{Path: "$.missing", Expected: `[]`},
+		{Path: ".store.bicycle.color", Expected: `["red"]`},
+		{Path: "name", Expected: `["shop"]`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Path, func(t *testing.T) {
+			t.Parallel()
+			doc := mustParse(t, sample)
+			path, err := jsondoc.Compile(c.Path)
+			require.NoError(t, err)
+
+			nodes := path.Select(doc)
+			values := jsondoc.NewArray()
+			for _, n := range nodes {
+				values.Items = append(values.Items, n.Value)
+			}
+			if c.Path == "$" {
+				require.Len(t, nodes, 1)
+				assert.Equal(t, c.Expected, string(jsondoc.Marshal(nodes[0].Value, jsondoc.Format{})))
+				return
+			}
+			assert.Equal(t, c.Expected, string(jsondoc.Marshal(values, jsondoc.Format{})))
+		})
+	}
+}
+
+func TestCompile_badPaths(t *testing.T) {
+	t.Parallel()
+	for _, p := range []string{"$.", "$[", "$[abc]", "$['a'", "$a"} {
+		_, err := jsondoc.Compile(p)
+		assert.ErrorIs(t, err, jsondoc.ErrPathSyntax, p)
+	}
+}
+
+func TestNode_SetDelete(t *testing.T) {
+	t.Parallel()
+	doc := mustParse(t, `{"a":[1,2,3,4],"b":{"c":1,"d":2}}`)
+
+	path, err := jsondoc.Compile("$.a[*]")
+	require.NoError(t, err)
+	assert.Equal(t, 4, jsondoc.Delete(path.Select(doc)))
+
+	path, err = jsondoc.Compile("$.b.c")
+	require.NoError(t, err)
+	for _, n := range path.Select(doc) {
+		n.Set("x")
+	}
+
+	parent, key, ok := path.Parent()
+	require.True(t, ok)
+	assert.Equal(t, "c", key)
+	for _, n := range parent.Select(doc) {
+		n.Value.(*jsondoc.Object).Set("e", int64(3))
+	}
+	assert.Equal(t, `{"a":[],"b":{"c":"x","d":2,"e":3}}`, string(jsondoc.Marshal(doc.Root(), jsondoc.Format{})))
+}
@@ -0,0 +1,307 @@
+package jsondoc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrPathSyntax = errors.New("invalid JSONPath")
+
+type segmentKind int
+
+const (
+	segmentChild segmentKind = iota
+	segmentIndex
+	segmentWildcard
+)
+
+type segment struct {
+	kind      segmentKind
+	recursive bool
+	name      string
+	index     int
+}
+
+// Path is a compiled path. Both JSONPath ($.a[0]..b[*]) and legacy (.a[0].b) syntaxes
+// are supported. The following selectors are available:
+//
+//   - $ – root of the document
+//   - .name, ['name'] – a member of an object
+//   - [n] – an item of an array, negative n counts from the end
+//   - .*, [*] – all members of an object or items of an array
+//   - ..selector – recursive descent
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []segment
+}
+
+func Compile(path string) (*Path, error) {
+	p := &Path{raw: path}
+	rest := path
+	switch {
+	case strings.HasPrefix(path, "$"):
+		rest = path[1:]
+	case path == ".":
+		p.legacy = true
+		return p, nil
+	default:
+		p.legacy = true
+		if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+			rest = "." + path
+		}
+	}
+
+	for len(rest) > 0 {
+		seg, tail, err := parseSegment(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s at %d", err, path, len(path)-len(rest))
+		}
+		p.segments = append(p.segments, seg)
+		rest = tail
+	}
+	return p, nil
+}
+
+func parseSegment(s string) (segment, string, error) {
+	var seg segment
+	if strings.HasPrefix(s, "..") {
+		seg.recursive = true
+		s = s[1:]
+		if len(s) > 1 && s[1] == '[' {
+			s = s[1:]
+		}
+	}
+
+	switch s[0] {
+	case '.':
+		s = s[1:]
+		if strings.HasPrefix(s, "*") {
+			seg.kind = segmentWildcard
+			return seg, s[1:], nil
+		}
+		end := strings.IndexAny(s, ".[")
+		if end == -1 {
+			end = len(s)
+		}
+		if end == 0 {
+			return seg, s, fmt.Errorf("%w: empty member name", ErrPathSyntax)
+		}
+		seg.kind = segmentChild
+		seg.name = s[:end]
+		return seg, s[end:], nil
+	case '[':
+		return parseBracket(seg, s[1:])
+	default:
+		return seg, s, fmt.Errorf("%w: unexpected character %q", ErrPathSyntax, s[0])
+	}
+}
+
+func parseBracket(seg segment, s string) (segment, string, error) {
+	if s == "" {
+		return seg, s, fmt.Errorf("%w: unclosed bracket", ErrPathSyntax)
+	}
+	if quote := s[0]; quote == '\'' || quote == '"' {
+		end := strings.IndexByte(s[1:], quote)
+		if end == -1 || !strings.HasPrefix(s[end+2:], "]") {
+			return seg, s, fmt.Errorf("%w: unclosed quoted name", ErrPathSyntax)
+		}
+		seg.kind = segmentChild
+		seg.name = s[1 : end+1]
+		return seg, s[end+3:], nil
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end == -1 {
+		return seg, s, fmt.Errorf("%w: unclosed bracket", ErrPathSyntax)
+	}
+	inner := strings.TrimSpace(s[:end])
+	if inner == "*" {
+		seg.kind = segmentWildcard
+		return seg, s[end+1:], nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return seg, s, fmt.Errorf("%w: invalid index %q", ErrPathSyntax, inner)
+	}
+	seg.kind = segmentIndex
+	seg.index = index
+	return seg, s[end+1:], nil
+}
+
+// IsLegacy reports whether the path uses legacy syntax. Commands return a single value
+// instead of an array of matches for legacy paths.
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Parent splits path into a path of the parent object and a name of a member, if the last
+// selector of the path is a plain member name.
+func (p *Path) Parent() (*Path, string, bool) {
+	if len(p.segments) == 0 {
+		return nil, "", false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.kind != segmentChild || last.recursive {
+		return nil, "", false
+	}
+	parent := &Path{
+		raw:      p.raw,
+		legacy:   p.legacy,
+		segments: p.segments[:len(p.segments)-1],
+	}
+	return parent, last.name, true
+}
+
+// Select returns all nodes of the document matched by the path.
+func (p *Path) Select(doc *Document) []Node {
+	nodes := []Node{{Value: doc.root, parent: doc}}
+	recursive := false
+	for _, seg := range p.segments {
+		if seg.recursive {
+			recursive = true
+			var all []Node
+			for _, n := range nodes {
+				all = descendants(all, n)
+			}
+			nodes = all
+		}
+		var next []Node
+		for _, n := range nodes {
+			next = seg.apply(next, n)
+		}
+		nodes = next
+	}
+	if recursive {
+		nodes = unique(nodes)
+	}
+	return nodes
+}
+
+func (s segment) apply(dst []Node, n Node) []Node {
+	switch v := n.Value.(type) {
+	case *Object:
+		switch s.kind {
+		case segmentChild:
+			if item, ok := v.values[s.name]; ok {
+				dst = append(dst, Node{Value: item, parent: v, key: s.name})
+			}
+		case segmentWildcard:
+			for _, key := range v.keys {
+				dst = append(dst, Node{Value: v.values[key], parent: v, key: key})
+			}
+		case segmentIndex:
+		}
+	case *Array:
+		switch s.kind {
+		case segmentIndex:
+			index := s.index
+			if index < 0 {
+				index += len(v.Items)
+			}
+			if index >= 0 && index < len(v.Items) {
+				dst = append(dst, Node{Value: v.Items[index], parent: v, index: index})
+			}
+		case segmentWildcard:
+			for i, item := range v.Items {
+				dst = append(dst, Node{Value: item, parent: v, index: i})
+			}
+		case segmentChild:
+		}
+	}
+	return dst
+}
+
+func descendants(dst []Node, n Node) []Node {
+	dst = append(dst, n)
+	switch v := n.Value.(type) {
+	case *Object:
+		for _, key := range v.keys {
+			dst = descendants(dst, Node{Value: v.values[key], parent: v, key: key})
+		}
+	case *Array:
+		for i, item := range v.Items {
+			dst = descendants(dst, Node{Value: item, parent: v, index: i})
+		}
+	}
+	return dst
+}
+
+type nodeID struct {
+	parent interface{}
+	key    string
+	index  int
+}
+
+func unique(nodes []Node) []Node {
+	seen := make(map[nodeID]struct{}, len(nodes))
+	return slices.DeleteFunc(nodes, func(n Node) bool {
+		id := nodeID{parent: n.parent, key: n.key, index: n.index}
+		if _, ok := seen[id]; ok {
+			return true
+		}
+		seen[id] = struct{}{}
+		return false
+	})
+}
+
+// Node is a value matched by a path along with its location in the document.
+type Node struct {
+	Value  interface{}
+	parent interface{}
+	key    string
+	index  int
+}
+
+func (n Node) IsRoot() bool {
+	_, ok := n.parent.(*Document)
+	return ok
+}
+
+// Set replaces the value at the location of the node.
+func (n Node) Set(value interface{}) {
+	switch p := n.parent.(type) {
+	case *Document:
+		p.root = value
+	case *Object:
+		p.Set(n.key, value)
+	case *Array:
+		p.Items[n.index] = value
+	}
+}
+
+// Delete removes nodes from their parents. Root can't be deleted, so it is skipped.
+// Returns amount of deleted nodes.
+func Delete(nodes []Node) int {
+	// Items of arrays must be deleted from the last to the first,
+	// so that indexes of the remaining nodes stay valid.
+	sorted := slices.Clone(nodes)
+	slices.SortStableFunc(sorted, func(a, b Node) int {
+		return b.index - a.index
+	})
+
+	deleted := 0
+	for _, n := range sorted {
+		switch p := n.parent.(type) {
+		case *Object:
+			if p.Delete(n.key) {
+				deleted++
+			}
+		case *Array:
+			p.Items = slices.Delete(p.Items, n.index, n.index+1)
+			deleted++
+		}
+	}
+	return deleted
+}
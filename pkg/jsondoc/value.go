@@ -0,0 +1,148 @@
+package jsondoc
+
+import "slices"
+
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeNull    = "null"
+)
+
+// Document is a mutable JSON document. Values inside the document are represented by
+// nil, bool, int64, float64, string, *Array and *Object.
+type Document struct {
+	root interface{}
+}
+
+func New(root interface{}) *Document {
+	return &Document{root: root}
+}
+
+func (d *Document) Root() interface{} {
+	return d.root
+}
+
+func (d *Document) SetRoot(root interface{}) {
+	d.root = root
+}
+
+// Object is a JSON object that keeps insertion order of its keys.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	o.keys = slices.DeleteFunc(o.keys, func(k string) bool {
+		return k == key
+	})
+	return true
+}
+
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Array is a JSON array.
+type Array struct {
+	Items []interface{}
+}
+
+func NewArray(items ...interface{}) *Array {
+	return &Array{Items: items}
+}
+
+func (a *Array) Len() int {
+	return len(a.Items)
+}
+
+// Insert inserts values before the item at index. Index must be normalized.
+func (a *Array) Insert(index int, values ...interface{}) {
+	a.Items = slices.Insert(a.Items, index, values...)
+}
+
+// Pop removes an item at index. Negative index counts from the end of an array.
+// Out of range indexes are clamped to the bounds of an array.
+func (a *Array) Pop(index int) (interface{}, bool) {
+	if len(a.Items) == 0 {
+		return nil, false
+	}
+	if index < 0 {
+		index += len(a.Items)
+	}
+	index = max(0, min(index, len(a.Items)-1))
+	item := a.Items[index]
+	a.Items = slices.Delete(a.Items, index, index+1)
+	return item, true
+}
+
+// TypeName returns name of the JSON type of value as reported by JSON.TYPE.
+func TypeName(value interface{}) string {
+	switch value.(type) {
+	case *Object:
+		return TypeObject
+	case *Array:
+		return TypeArray
+	case string:
+		return TypeString
+	case int64:
+		return TypeInteger
+	case float64:
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	default:
+		return TypeNull
+	}
+}
+
+// Clone makes a deep copy of value.
+func Clone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Object:
+		o := &Object{
+			keys:   slices.Clone(v.keys),
+			values: make(map[string]interface{}, len(v.values)),
+		}
+		for k, item := range v.values {
+			o.values[k] = Clone(item)
+		}
+		return o
+	case *Array:
+		a := &Array{Items: make([]interface{}, len(v.Items))}
+		for i, item := range v.Items {
+			a.Items[i] = Clone(item)
+		}
+		return a
+	default:
+		return v
+	}
+}
@@ -0,0 +1,7 @@
+// Package keyspace holds errors of keyspace access shared by built-in commands and modules,
+// so both reply the same way.
+package keyspace
+
+import "errors"
+
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
@@ -0,0 +1,119 @@
+package lua
+
+// Names of variables are resolved by the parser: locals refer to slots of the frame
+// of their function, captured variables to upvalues of the closure, other names to globals.
+
+type expr interface{}
+
+type (
+	constExpr  struct{ value Value }
+	varargExpr struct{}
+	localExpr  struct{ slot int }
+	upvalExpr  struct{ index int }
+	globalExpr struct{ name string }
+	// parenExpr truncates multiple results to one value.
+	parenExpr struct{ e expr }
+	indexExpr struct {
+		obj, key expr
+		line     int
+	}
+	callExpr struct {
+		fn   expr
+		args []expr
+		line int
+	}
+	methodCallExpr struct {
+		obj  expr
+		name string
+		args []expr
+		line int
+	}
+	functionExpr struct{ proto *funcProto }
+	tableExpr    struct {
+		items []tableItem
+		line  int
+	}
+	binaryExpr struct {
+		op          string
+		left, right expr
+		line        int
+	}
+	unaryExpr struct {
+		op   string
+		e    expr
+		line int
+	}
+)
+
+// tableItem is a field of a table constructor. Positional items have nil key.
+type tableItem struct {
+	key, value expr
+}
+
+type stmt interface{}
+
+type (
+	localStmt struct {
+		slots []int
+		exprs []expr
+	}
+	// localFunctionStmt declares the local before creating the closure, so it can recurse.
+	localFunctionStmt struct {
+		slot int
+		fn   *funcProto
+	}
+	assignStmt struct {
+		targets []expr
+		exprs   []expr
+		line    int
+	}
+	callStmt  struct{ call expr }
+	doStmt    struct{ body []stmt }
+	whileStmt struct {
+		cond expr
+		body []stmt
+	}
+	repeatStmt struct {
+		body []stmt
+		cond expr
+	}
+	ifStmt struct {
+		conds  []expr
+		blocks [][]stmt
+		orElse []stmt
+	}
+	numericForStmt struct {
+		slot               int
+		start, limit, step expr
+		body               []stmt
+		line               int
+	}
+	genericForStmt struct {
+		slots []int
+		exprs []expr
+		body  []stmt
+		line  int
+	}
+	returnStmt struct{ exprs []expr }
+	breakStmt  struct{}
+)
+
+// funcProto is a compiled function. Parameters occupy the first slots of the frame.
+type funcProto struct {
+	chunk  string
+	name   string
+	line   int
+	params int
+	vararg bool
+	slots  int
+	upvals []upvalDesc
+	body   []stmt
+}
+
+// upvalDesc describes where a closure takes a captured variable from when it is created:
+// a local slot of the enclosing function or an upvalue of the enclosing closure.
+type upvalDesc struct {
+	name      string
+	fromLocal bool
+	index     int
+}
@@ -0,0 +1,191 @@
+package lua
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxJSONDepth limits nesting of encoded tables, so cyclic tables fail.
+const maxJSONDepth = 1000
+
+// cjsonLib implements encode and decode of the cjson library. Tables with keys 1..n only
+// are encoded as arrays, empty tables as objects, and JSON null is decoded as nil.
+func cjsonLib() *Table {
+	t := NewTable(0, 0)
+	register(t, map[string]GoFunction{
+		"encode": cjsonEncode,
+		"decode": cjsonDecode,
+	})
+	return t
+}
+
+func cjsonEncode(s *State, args []Value) ([]Value, error) {
+	v, err := checkAny(s, args, 0, "encode")
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := encodeJSON(&b, v, 0); err != nil {
+		return nil, s.Errorf("%s", err)
+	}
+	return []Value{b.String()}, nil
+}
+
+//nolint:gocyclo // one case per value type
+func encodeJSON(b *strings.Builder, v Value, depth int) error {
+	if depth > maxJSONDepth {
+		return errors.New("Cannot serialise, excessive nesting")
+	}
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return errors.New("Cannot serialise number: must not be NaN or Inf")
+		}
+		b.WriteString(FormatNumber(v))
+	case string:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+	case *Table:
+		if n := v.Len(); n > 0 && v.isArray() {
+			b.WriteByte('[')
+			for i := 1; i <= n; i++ {
+				if i > 1 {
+					b.WriteByte(',')
+				}
+				if err := encodeJSON(b, v.Get(float64(i)), depth+1); err != nil {
+					return err
+				}
+			}
+			b.WriteByte(']')
+			return nil
+		}
+		b.WriteByte('{')
+		var key Value
+		first := true
+		for {
+			k, item, err := v.Next(key)
+			if err != nil {
+				return err
+			}
+			if k == nil {
+				break
+			}
+			key = k
+			name, ok := toStringCoerce(k)
+			if !ok {
+				return errors.New("Cannot serialise " + TypeName(k) + ": table key must be a number or string")
+			}
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			if err := encodeJSON(b, name, depth+1); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := encodeJSON(b, item, depth+1); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return errors.New("Cannot serialise " + TypeName(v) + ": type not supported")
+	}
+	return nil
+}
+
+// isArray reports whether all keys of the table are in its array part.
+func (t *Table) isArray() bool {
+	if len(t.hash) > 0 {
+		return false
+	}
+	for _, v := range t.array {
+		if v == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func cjsonDecode(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "decode")
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.UseNumber()
+	v, err := decodeJSON(dec)
+	if err == nil {
+		if _, err = dec.Token(); errors.Is(err, io.EOF) {
+			err = nil
+		} else if err == nil {
+			err = errors.New("trailing data")
+		}
+	}
+	if err != nil {
+		return nil, s.Errorf("Expected value but found invalid token: %s", err)
+	}
+	return []Value{v}, nil
+}
+
+// decodeJSON decodes a value token by token, so keys of objects keep their order.
+func decodeJSON(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return tok, nil
+	case string:
+		return tok, nil
+	case json.Number:
+		n, err := strconv.ParseFloat(tok.String(), 64)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	case json.Delim:
+		t := NewTable(0, 0)
+		if tok == '[' {
+			// Nulls leave holes, so following items keep their indexes.
+			for i := 1; dec.More(); i++ {
+				v, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				_ = t.Set(float64(i), v)
+			}
+		} else {
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				_ = t.Set(key, v)
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return nil, errors.New("unexpected token")
+}
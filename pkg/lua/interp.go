@@ -0,0 +1,629 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxCallDepth limits nesting of calls, so runaway recursion fails instead of exhausting the stack.
+const maxCallDepth = 5000
+
+// maxIndexChain limits __index chains, so loops of metatables fail.
+const maxIndexChain = 100
+
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowReturn
+)
+
+// frame is an activation of a Lua function.
+type frame struct {
+	fn      *Function
+	slots   []*cell
+	varargs []Value
+}
+
+func (s *State) runtimeError(fr *frame, line int, format string, args ...interface{}) error {
+	return &Error{Value: fmt.Sprintf("%s:%d: %s", fr.fn.proto.chunk, line, fmt.Sprintf(format, args...))}
+}
+
+// describe names a variable holding a value for error messages like Lua does.
+func describe(e expr, v Value) string {
+	switch e := e.(type) {
+	case *globalExpr:
+		return fmt.Sprintf("global '%s' (a %s value)", e.name, TypeName(v))
+	case *indexExpr:
+		if key, ok := e.key.(*constExpr); ok {
+			if name, ok := key.value.(string); ok {
+				return fmt.Sprintf("field '%s' (a %s value)", name, TypeName(v))
+			}
+		}
+	case *upvalExpr:
+		return fmt.Sprintf("upvalue (a %s value)", TypeName(v))
+	}
+	return fmt.Sprintf("a %s value", TypeName(v))
+}
+
+// callFunction calls a function with arguments. Go functions are called directly.
+func (s *State) callFunction(fn *Function, args []Value) ([]Value, error) {
+	if err := s.tick(); err != nil {
+		return nil, err
+	}
+	if s.depth >= maxCallDepth {
+		return nil, &Error{Value: "stack overflow"}
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+
+	if fn.native != nil {
+		return fn.native(s, args)
+	}
+	proto := fn.proto
+	fr := &frame{fn: fn, slots: make([]*cell, proto.slots)}
+	for i := 0; i < proto.params; i++ {
+		var v Value
+		if i < len(args) {
+			v = args[i]
+		}
+		fr.slots[i] = &cell{v: v}
+	}
+	if proto.vararg && len(args) > proto.params {
+		fr.varargs = append([]Value(nil), args[proto.params:]...)
+	}
+	fl, rets, err := s.execBlock(fr, proto.body)
+	if err != nil || fl != flowReturn {
+		return nil, err
+	}
+	return rets, nil
+}
+
+func (s *State) closure(fr *frame, proto *funcProto) *Function {
+	fn := &Function{name: proto.name, proto: proto, upvals: make([]*cell, len(proto.upvals))}
+	for i, u := range proto.upvals {
+		if !u.fromLocal {
+			fn.upvals[i] = fr.fn.upvals[u.index]
+			continue
+		}
+		if fr.slots[u.index] == nil {
+			fr.slots[u.index] = &cell{}
+		}
+		fn.upvals[i] = fr.slots[u.index]
+	}
+	return fn
+}
+
+func (s *State) execBlock(fr *frame, body []stmt) (flow, []Value, error) {
+	for _, st := range body {
+		fl, rets, err := s.exec(fr, st)
+		if err != nil || fl != flowNormal {
+			return fl, rets, err
+		}
+	}
+	return flowNormal, nil, nil
+}
+
+//nolint:gocyclo // one case per statement
+func (s *State) exec(fr *frame, st stmt) (flow, []Value, error) {
+	switch st := st.(type) {
+	case *localStmt:
+		values, err := s.evalList(fr, st.exprs)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		for i, slot := range st.slots {
+			var v Value
+			if i < len(values) {
+				v = values[i]
+			}
+			fr.slots[slot] = &cell{v: v}
+		}
+	case *localFunctionStmt:
+		c := &cell{}
+		fr.slots[st.slot] = c
+		c.v = s.closure(fr, st.fn)
+	case *assignStmt:
+		return flowNormal, nil, s.assign(fr, st)
+	case *callStmt:
+		_, err := s.evalMulti(fr, st.call)
+		return flowNormal, nil, err
+	case *doStmt:
+		return s.execBlock(fr, st.body)
+	case *whileStmt:
+		for {
+			if err := s.tick(); err != nil {
+				return flowNormal, nil, err
+			}
+			cond, err := s.eval(fr, st.cond)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if !Truthy(cond) {
+				return flowNormal, nil, nil
+			}
+			fl, rets, err := s.execBlock(fr, st.body)
+			if err != nil || fl == flowReturn {
+				return fl, rets, err
+			}
+			if fl == flowBreak {
+				return flowNormal, nil, nil
+			}
+		}
+	case *repeatStmt:
+		for {
+			if err := s.tick(); err != nil {
+				return flowNormal, nil, err
+			}
+			fl, rets, err := s.execBlock(fr, st.body)
+			if err != nil || fl == flowReturn {
+				return fl, rets, err
+			}
+			if fl == flowBreak {
+				return flowNormal, nil, nil
+			}
+			cond, err := s.eval(fr, st.cond)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if Truthy(cond) {
+				return flowNormal, nil, nil
+			}
+		}
+	case *ifStmt:
+		for i, c := range st.conds {
+			cond, err := s.eval(fr, c)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if Truthy(cond) {
+				return s.execBlock(fr, st.blocks[i])
+			}
+		}
+		return s.execBlock(fr, st.orElse)
+	case *numericForStmt:
+		return s.numericFor(fr, st)
+	case *genericForStmt:
+		return s.genericFor(fr, st)
+	case *returnStmt:
+		rets, err := s.evalList(fr, st.exprs)
+		return flowReturn, rets, err
+	case *breakStmt:
+		return flowBreak, nil, nil
+	}
+	return flowNormal, nil, nil
+}
+
+// assign evaluates tables and keys of targets, then values, and assigns them.
+func (s *State) assign(fr *frame, st *assignStmt) error {
+	type target struct {
+		obj, key Value
+	}
+	targets := make([]target, len(st.targets))
+	for i, t := range st.targets {
+		if ix, ok := t.(*indexExpr); ok {
+			obj, err := s.eval(fr, ix.obj)
+			if err != nil {
+				return err
+			}
+			key, err := s.eval(fr, ix.key)
+			if err != nil {
+				return err
+			}
+			targets[i] = target{obj: obj, key: key}
+		}
+	}
+	values, err := s.evalList(fr, st.exprs)
+	if err != nil {
+		return err
+	}
+	for i, t := range st.targets {
+		var v Value
+		if i < len(values) {
+			v = values[i]
+		}
+		switch t := t.(type) {
+		case *localExpr:
+			fr.slots[t.slot].v = v
+		case *upvalExpr:
+			fr.fn.upvals[t.index].v = v
+		case *globalExpr:
+			if err := s.globals.Set(t.name, v); err != nil {
+				return err
+			}
+		case *indexExpr:
+			tbl, ok := targets[i].obj.(*Table)
+			if !ok {
+				return s.runtimeError(fr, t.line, "attempt to index %s", describe(t.obj, targets[i].obj))
+			}
+			if err := tbl.Set(targets[i].key, v); err != nil {
+				return s.runtimeError(fr, t.line, "%s", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *State) numericFor(fr *frame, st *numericForStmt) (flow, []Value, error) {
+	var bounds [3]float64
+	names := [3]string{"initial value", "limit", "step"}
+	exprs := [3]expr{st.start, st.limit, st.step}
+	bounds[2] = 1
+	for i, e := range exprs {
+		if e == nil {
+			continue
+		}
+		v, err := s.eval(fr, e)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		n, ok := toNumberCoerce(v)
+		if !ok {
+			return flowNormal, nil, s.runtimeError(fr, st.line, "'for' %s must be a number", names[i])
+		}
+		bounds[i] = n
+	}
+	start, limit, step := bounds[0], bounds[1], bounds[2]
+	for i := start; step > 0 && i <= limit || step <= 0 && i >= limit; i += step {
+		if err := s.tick(); err != nil {
+			return flowNormal, nil, err
+		}
+		fr.slots[st.slot] = &cell{v: i}
+		fl, rets, err := s.execBlock(fr, st.body)
+		if err != nil || fl == flowReturn {
+			return fl, rets, err
+		}
+		if fl == flowBreak {
+			break
+		}
+	}
+	return flowNormal, nil, nil
+}
+
+func (s *State) genericFor(fr *frame, st *genericForStmt) (flow, []Value, error) {
+	values, err := s.evalList(fr, st.exprs)
+	if err != nil {
+		return flowNormal, nil, err
+	}
+	values = append(values, nil, nil, nil)
+	iter, state, control := values[0], values[1], values[2]
+	fn, ok := iter.(*Function)
+	if !ok {
+		return flowNormal, nil, s.runtimeError(fr, st.line, "attempt to call a %s value", TypeName(iter))
+	}
+	for {
+		if err := s.tick(); err != nil {
+			return flowNormal, nil, err
+		}
+		rets, err := s.callFunction(fn, []Value{state, control})
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if len(rets) == 0 || rets[0] == nil {
+			return flowNormal, nil, nil
+		}
+		control = rets[0]
+		for i, slot := range st.slots {
+			var v Value
+			if i < len(rets) {
+				v = rets[i]
+			}
+			fr.slots[slot] = &cell{v: v}
+		}
+		fl, rets, err := s.execBlock(fr, st.body)
+		if err != nil || fl == flowReturn {
+			return fl, rets, err
+		}
+		if fl == flowBreak {
+			return flowNormal, nil, nil
+		}
+	}
+}
+
+// evalList evaluates expressions expanding all results of the last one.
+func (s *State) evalList(fr *frame, exprs []expr) ([]Value, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	values := make([]Value, 0, len(exprs))
+	for _, e := range exprs[:len(exprs)-1] {
+		v, err := s.eval(fr, e)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	last, err := s.evalMulti(fr, exprs[len(exprs)-1])
+	if err != nil {
+		return nil, err
+	}
+	return append(values, last...), nil
+}
+
+// evalMulti evaluates an expression to all its results. Only calls and varargs have several.
+func (s *State) evalMulti(fr *frame, e expr) ([]Value, error) {
+	switch e := e.(type) {
+	case *callExpr:
+		fn, err := s.eval(fr, e.fn)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalList(fr, e.args)
+		if err != nil {
+			return nil, err
+		}
+		return s.callAt(fr, e.line, e.fn, fn, args)
+	case *methodCallExpr:
+		obj, err := s.eval(fr, e.obj)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := s.index(fr, e.line, e.obj, obj, e.name)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalList(fr, e.args)
+		if err != nil {
+			return nil, err
+		}
+		args = append([]Value{obj}, args...)
+		if _, ok := fn.(*Function); !ok {
+			return nil, s.runtimeError(fr, e.line, "attempt to call method '%s' (a %s value)", e.name, TypeName(fn))
+		}
+		return s.callAt(fr, e.line, nil, fn, args)
+	case *varargExpr:
+		return append([]Value(nil), fr.varargs...), nil
+	}
+	v, err := s.eval(fr, e)
+	if err != nil {
+		return nil, err
+	}
+	return []Value{v}, nil
+}
+
+// callAt calls a function remembering the position of the call for error().
+func (s *State) callAt(fr *frame, line int, fnExpr expr, fn Value, args []Value) ([]Value, error) {
+	f, ok := fn.(*Function)
+	if !ok {
+		return nil, s.runtimeError(fr, line, "attempt to call %s", describe(fnExpr, fn))
+	}
+	s.chunk, s.line = fr.fn.proto.chunk, line
+	return s.callFunction(f, args)
+}
+
+//nolint:gocyclo // one case per expression
+func (s *State) eval(fr *frame, e expr) (Value, error) {
+	switch e := e.(type) {
+	case *constExpr:
+		return e.value, nil
+	case *localExpr:
+		return fr.slots[e.slot].v, nil
+	case *upvalExpr:
+		return fr.fn.upvals[e.index].v, nil
+	case *globalExpr:
+		return s.globals.Get(e.name), nil
+	case *varargExpr:
+		if len(fr.varargs) == 0 {
+			return nil, nil
+		}
+		return fr.varargs[0], nil
+	case *parenExpr:
+		return s.eval(fr, e.e)
+	case *indexExpr:
+		obj, err := s.eval(fr, e.obj)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.eval(fr, e.key)
+		if err != nil {
+			return nil, err
+		}
+		return s.index(fr, e.line, e.obj, obj, key)
+	case *callExpr, *methodCallExpr:
+		values, err := s.evalMulti(fr, e)
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+		return values[0], nil
+	case *functionExpr:
+		return s.closure(fr, e.proto), nil
+	case *tableExpr:
+		return s.table(fr, e)
+	case *binaryExpr:
+		return s.binary(fr, e)
+	case *unaryExpr:
+		v, err := s.eval(fr, e.e)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "not":
+			return !Truthy(v), nil
+		case "-":
+			n, ok := toNumberCoerce(v)
+			if !ok {
+				return nil, s.runtimeError(fr, e.line, "attempt to perform arithmetic on %s", describe(e.e, v))
+			}
+			return -n, nil
+		case "#":
+			switch v := v.(type) {
+			case string:
+				return float64(len(v)), nil
+			case *Table:
+				return float64(v.Len()), nil
+			}
+			return nil, s.runtimeError(fr, e.line, "attempt to get length of %s", describe(e.e, v))
+		}
+	}
+	return nil, fmt.Errorf("unknown expression %T", e)
+}
+
+// index reads a field. Tables fall back to the __index metamethod, strings index the string library.
+func (s *State) index(fr *frame, line int, objExpr expr, obj, key Value) (Value, error) {
+	for range maxIndexChain {
+		switch o := obj.(type) {
+		case *Table:
+			v := o.Get(key)
+			if v != nil || o.meta == nil {
+				return v, nil
+			}
+			switch h := o.meta.GetString("__index").(type) {
+			case nil:
+				return nil, nil
+			case *Function:
+				rets, err := s.callFunction(h, []Value{o, key})
+				if err != nil || len(rets) == 0 {
+					return nil, err
+				}
+				return rets[0], nil
+			default:
+				obj, objExpr = h, nil
+			}
+		case string:
+			return s.strings.Get(key), nil
+		default:
+			return nil, s.runtimeError(fr, line, "attempt to index %s", describe(objExpr, obj))
+		}
+	}
+	return nil, s.runtimeError(fr, line, "loop in gettable")
+}
+
+func (s *State) table(fr *frame, e *tableExpr) (Value, error) {
+	t := NewTable(0, 0)
+	n := 0
+	for i, item := range e.items {
+		if item.key != nil {
+			key, err := s.eval(fr, item.key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := s.eval(fr, item.value)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.Set(key, v); err != nil {
+				return nil, s.runtimeError(fr, e.line, "%s", err)
+			}
+			continue
+		}
+		values := []Value{nil}
+		var err error
+		if i == len(e.items)-1 {
+			values, err = s.evalMulti(fr, item.value)
+		} else {
+			values[0], err = s.eval(fr, item.value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			n++
+			_ = t.Set(float64(n), v)
+		}
+	}
+	return t, nil
+}
+
+//nolint:gocyclo // one case per operator
+func (s *State) binary(fr *frame, e *binaryExpr) (Value, error) {
+	left, err := s.eval(fr, e.left)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "and":
+		if !Truthy(left) {
+			return left, nil
+		}
+		return s.eval(fr, e.right)
+	case "or":
+		if Truthy(left) {
+			return left, nil
+		}
+		return s.eval(fr, e.right)
+	}
+	right, err := s.eval(fr, e.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return rawEqual(left, right), nil
+	case "~=":
+		return !rawEqual(left, right), nil
+	case "<":
+		return s.less(fr, e.line, left, right, false)
+	case "<=":
+		return s.less(fr, e.line, left, right, true)
+	case ">":
+		return s.less(fr, e.line, right, left, false)
+	case ">=":
+		return s.less(fr, e.line, right, left, true)
+	case "..":
+		a, ok := toStringCoerce(left)
+		if !ok {
+			return nil, s.runtimeError(fr, e.line, "attempt to concatenate %s", describe(e.left, left))
+		}
+		b, ok := toStringCoerce(right)
+		if !ok {
+			return nil, s.runtimeError(fr, e.line, "attempt to concatenate %s", describe(e.right, right))
+		}
+		return a + b, nil
+	}
+
+	a, ok := toNumberCoerce(left)
+	if !ok {
+		return nil, s.runtimeError(fr, e.line, "attempt to perform arithmetic on %s", describe(e.left, left))
+	}
+	b, ok := toNumberCoerce(right)
+	if !ok {
+		return nil, s.runtimeError(fr, e.line, "attempt to perform arithmetic on %s", describe(e.right, right))
+	}
+	return arith(e.op, a, b), nil
+}
+
+func arith(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "%":
+		return a - math.Floor(a/b)*b
+	case "^":
+		return math.Pow(a, b)
+	}
+	return math.NaN()
+}
+
+func (s *State) less(fr *frame, line int, a, b Value, orEqual bool) (Value, error) {
+	res, err := lessValues(a, b, orEqual)
+	if err != nil {
+		return nil, s.runtimeError(fr, line, "%s", err)
+	}
+	return res, nil
+}
+
+// lessValues compares numbers or strings. Other values can't be ordered.
+func lessValues(a, b Value, orEqual bool) (bool, error) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return x < y || orEqual && x == y, nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return x < y || orEqual && x == y, nil
+		}
+	}
+	if TypeName(a) == TypeName(b) {
+		return false, fmt.Errorf("attempt to compare two %s values", TypeName(a))
+	}
+	return false, fmt.Errorf("attempt to compare %s with %s", TypeName(a), TypeName(b))
+}
@@ -0,0 +1,277 @@
+package lua
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is an error of compiling a chunk.
+type SyntaxError struct {
+	Chunk string
+	Line  int
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Chunk, e.Line, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokNumber
+	tokString
+	// tokSymbol is a keyword or a punctuation.
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	line int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "<eof>"
+	}
+	return t.text
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "if": true, "in": true, "local": true,
+	"nil": true, "not": true, "or": true, "repeat": true, "return": true, "then": true,
+	"true": true, "until": true, "while": true,
+}
+
+// symbols are punctuations ordered so longer ones are matched first.
+var symbols = []string{
+	"...", "..", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+type lexer struct {
+	chunk string
+	src   string
+	pos   int
+	line  int
+}
+
+func lex(chunk, src string) ([]token, error) {
+	l := &lexer{chunk: chunk, src: src, line: 1}
+	if strings.HasPrefix(src, "#") {
+		// Skips the shebang line.
+		l.skipLine()
+	}
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Chunk: l.chunk, Line: l.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) skipLine() {
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		l.pos++
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "--"):
+			l.pos += 2
+			if level := l.longBracket(); level >= 0 {
+				if _, err := l.longString(level); err != nil {
+					return token{}, err
+				}
+				continue
+			}
+			l.skipLine()
+		case isAlpha(c):
+			start := l.pos
+			for l.pos < len(l.src) && (isAlpha(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+				l.pos++
+			}
+			text := l.src[start:l.pos]
+			if keywords[text] {
+				return token{kind: tokSymbol, text: text, line: l.line}, nil
+			}
+			return token{kind: tokName, text: text, line: l.line}, nil
+		case isDigit(c) || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+			return l.number()
+		case c == '"' || c == '\'':
+			return l.shortString(c)
+		case c == '[':
+			if level := l.longBracket(); level >= 0 {
+				line := l.line
+				s, err := l.longString(level)
+				if err != nil {
+					return token{}, err
+				}
+				return token{kind: tokString, text: s, line: line}, nil
+			}
+			l.pos++
+			return token{kind: tokSymbol, text: "[", line: l.line}, nil
+		default:
+			for _, sym := range symbols {
+				if strings.HasPrefix(l.src[l.pos:], sym) {
+					l.pos += len(sym)
+					return token{kind: tokSymbol, text: sym, line: l.line}, nil
+				}
+			}
+			return token{}, l.errorf("unexpected symbol near '%c'", c)
+		}
+	}
+	return token{kind: tokEOF, line: l.line}, nil
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], "0x") || strings.HasPrefix(l.src[l.pos:], "0X") {
+		l.pos += 2
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if (c == '+' || c == '-') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E') {
+			l.pos++
+			continue
+		}
+		if !isAlpha(c) && !isDigit(c) && c != '.' {
+			break
+		}
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	n, ok := ParseNumber(text)
+	if !ok {
+		return token{}, l.errorf("malformed number near '%s'", text)
+	}
+	return token{kind: tokNumber, text: text, num: n, line: l.line}, nil
+}
+
+func (l *lexer) shortString(quote byte) (token, error) {
+	line := l.line
+	l.pos++
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			return token{}, l.errorf("unfinished string")
+		}
+		c := l.src[l.pos]
+		if c == quote {
+			l.pos++
+			return token{kind: tokString, text: b.String(), line: line}, nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			l.pos++
+			continue
+		}
+		l.pos++
+		if l.pos >= len(l.src) {
+			return token{}, l.errorf("unfinished string")
+		}
+		c = l.src[l.pos]
+		l.pos++
+		switch c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '\n':
+			l.line++
+			b.WriteByte('\n')
+		case '\\', '"', '\'':
+			b.WriteByte(c)
+		default:
+			if !isDigit(c) {
+				return token{}, l.errorf("invalid escape sequence '\\%c'", c)
+			}
+			n := int(c - '0')
+			for i := 0; i < 2 && l.pos < len(l.src) && isDigit(l.src[l.pos]); i++ {
+				n = n*10 + int(l.src[l.pos]-'0')
+				l.pos++
+			}
+			if n > 255 {
+				return token{}, l.errorf("escape sequence too large")
+			}
+			b.WriteByte(byte(n))
+		}
+	}
+}
+
+// longBracket returns the level of a long bracket like [==[ at the position or -1.
+// The position is moved past the bracket only if it is found.
+func (l *lexer) longBracket() int {
+	if l.pos >= len(l.src) || l.src[l.pos] != '[' {
+		return -1
+	}
+	i := l.pos + 1
+	for i < len(l.src) && l.src[i] == '=' {
+		i++
+	}
+	if i >= len(l.src) || l.src[i] != '[' {
+		return -1
+	}
+	level := i - l.pos - 1
+	l.pos = i + 1
+	return level
+}
+
+func (l *lexer) longString(level int) (string, error) {
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(l.src[l.pos:], closing)
+	if end < 0 {
+		return "", l.errorf("unfinished long string")
+	}
+	s := l.src[l.pos : l.pos+end]
+	l.line += strings.Count(s, "\n")
+	l.pos += end + len(closing)
+	// The first newline of a long string is skipped.
+	if strings.HasPrefix(s, "\r\n") {
+		s = s[2:]
+	} else if strings.HasPrefix(s, "\n") {
+		s = s[1:]
+	}
+	return s, nil
+}
+
+func isAlpha(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,106 @@
+// Package lua implements an interpreter of a subset of Lua 5.1 used by server-side scripts.
+//
+// Numbers are doubles, tables keep insertion order of their keys, and only the __index
+// metamethod is supported. Coroutines, goto, string metatables other than method calls
+// and io/os libraries aren't available.
+package lua
+
+import (
+	"context"
+	"fmt"
+)
+
+// Chunk is a compiled script which can be run by any State.
+type Chunk struct {
+	proto *funcProto
+}
+
+// Compile compiles the source of a chunk. The name prefixes positions in error messages.
+func Compile(name, src string) (*Chunk, error) {
+	proto, err := parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	return &Chunk{proto: proto}, nil
+}
+
+// State is an environment running scripts: globals, standard libraries and the call stack.
+// A State must not be used concurrently.
+type State struct {
+	globals *Table
+	strings *Table
+	ctx     context.Context
+	depth   int
+	steps   int
+	// chunk and line are the position of the last call, used by error() to locate messages.
+	chunk string
+	line  int
+}
+
+// NewState creates a state with base, string, table, math and cjson libraries.
+func NewState() *State {
+	s := &State{globals: NewTable(0, 0), ctx: context.Background()}
+	openLibs(s)
+	return s
+}
+
+// Globals returns the table of global variables.
+func (s *State) Globals() *Table {
+	return s.globals
+}
+
+// SetGlobal assigns a global variable.
+func (s *State) SetGlobal(name string, v Value) {
+	s.globals.SetString(name, v)
+}
+
+// Run runs a chunk with arguments available as varargs and returns its results.
+// The context is checked while the script runs, so cancelling it interrupts the script
+// with the context error, which scripts can't catch.
+func (s *State) Run(ctx context.Context, chunk *Chunk, args ...Value) ([]Value, error) {
+	s.ctx = ctx
+	defer func() { s.ctx = context.Background() }()
+	fn := &Function{name: chunk.proto.name, proto: chunk.proto}
+	return s.callFunction(fn, args)
+}
+
+// CallContext calls a function of the state checking the context the same way as Run.
+func (s *State) CallContext(ctx context.Context, fn Value, args ...Value) ([]Value, error) {
+	s.ctx = ctx
+	defer func() { s.ctx = context.Background() }()
+	return s.Call(fn, args...)
+}
+
+// Call calls a function. It is used by Go functions calling back into scripts.
+func (s *State) Call(fn Value, args ...Value) ([]Value, error) {
+	f, ok := fn.(*Function)
+	if !ok {
+		return nil, s.Errorf("attempt to call a %s value", TypeName(fn))
+	}
+	return s.callFunction(f, args)
+}
+
+// Errorf creates an error raised by a Go function located at the current call.
+func (s *State) Errorf(format string, args ...interface{}) error {
+	return &Error{Value: s.where() + fmt.Sprintf(format, args...)}
+}
+
+func (s *State) where() string {
+	if s.chunk == "" {
+		return ""
+	}
+	return s.chunk + ":" + FormatNumber(float64(s.line)) + ": "
+}
+
+// checkSteps is a number of steps between checks of the context.
+const checkSteps = 1024
+
+// tick is called on every loop iteration and call, so long running scripts are interrupted
+// when the context is cancelled.
+func (s *State) tick() error {
+	s.steps++
+	if s.steps%checkSteps != 0 {
+		return nil
+	}
+	return s.ctx.Err()
+}
@@ -0,0 +1,224 @@
+package lua_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/burenotti/redis_impl/pkg/lua"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, src string, args ...lua.Value) []lua.Value {
+	t.Helper()
+	chunk, err := lua.Compile("test", src)
+	require.NoError(t, err, src)
+	res, err := lua.NewState().Run(context.Background(), chunk, args...)
+	require.NoError(t, err, src)
+	return res
+}
+
+func TestState_expressions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		src      string
+		expected []lua.Value
+	}{
+		{`return 1 + 2 * 3 ^ 2, -2 ^ 2, 7 % 3, -7 % 3, 7 / 2`, []lua.Value{19.0, -4.0, 1.0, 2.0, 3.5}},
+		{`return "10" + 1, 10 .. 20, "a" .. "b" .. "c"`, []lua.Value{11.0, "1020", "abc"}},
+		{`return 1 < 2, "a" < "b", 1 == 1.0, "1" == 1, {} == {}`, []lua.Value{true, true, true, false, false}},
+		{`return nil and 1, false or "x", 1 and 2, not nil, #"abc", #{1, 2, 3}`, []lua.Value{nil, "x", 2.0, true, 3.0, 3.0}},
+		{`return 0x10, 1e2, .5, [[long
+string]], "\65\t\"", 'q'`, []lua.Value{16.0, 100.0, 0.5, "long\nstring", "A\t\"", "q"}},
+		{`local t = {1, 2, x = 3, [10] = 4; "y"} return t[1], t[3], t.x, t[10], #t`, []lua.Value{1.0, "y", 3.0, 4.0, 3.0}},
+		{`return select("#", 1, nil, 3), select(2, "a", "b", "c")`, []lua.Value{3.0, "b", "c"}},
+		{`return ...`, []lua.Value{"a", "b"}},
+		{`return (select(2, "a", "b", "c"))`, []lua.Value{"b"}},
+	}
+	for _, c := range cases {
+		args := []lua.Value{"a", "b"}
+		assert.Equal(t, c.expected, run(t, c.src, args...), c.src)
+	}
+}
+
+func TestState_statements(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		src      string
+		expected []lua.Value
+	}{
+		{`local s = 0 for i = 1, 10 do s = s + i end return s`, []lua.Value{55.0}},
+		{`local s = 0 for i = 10, 1, -3 do s = s + i end return s`, []lua.Value{22.0}},
+		{`local n = 0 while true do n = n + 1 if n == 5 then break end end return n`, []lua.Value{5.0}},
+		{`local n = 0 repeat local m = n n = n + 1 until m >= 3 return n`, []lua.Value{4.0}},
+		{`local x = 5 if x < 3 then return "a" elseif x < 6 then return "b" else return "c" end`, []lua.Value{"b"}},
+		{`local a, b, c = (function() return 1, 2 end)() return a, b, c`, []lua.Value{1.0, 2.0, nil}},
+		{`local a, b = 1, 2 a, b = b, a return a, b`, []lua.Value{2.0, 1.0}},
+		{`local t = {} for k, v in pairs({a = 1, b = 2, c = 3}) do t[#t + 1] = k .. v end
+			return table.concat(t, ",")`, []lua.Value{"a1,b2,c3"}},
+		{`local s = "" for i, v in ipairs({"x", "y", nil, "z"}) do s = s .. i .. v end return s`, []lua.Value{"1x2y"}},
+		{`local function fib(n) if n < 2 then return n end return fib(n - 1) + fib(n - 2) end return fib(20)`,
+			[]lua.Value{6765.0}},
+		{`local fs = {} for i = 1, 3 do fs[i] = function() return i end end return fs[1](), fs[3]()`,
+			[]lua.Value{1.0, 3.0}},
+		{`local function counter() local n = 0 return function() n = n + 1 return n end end
+			local c = counter() c() c() return c()`, []lua.Value{3.0}},
+		{`local obj = {n = 1} function obj:add(x) self.n = self.n + x return self end
+			return obj:add(2):add(3).n`, []lua.Value{6.0}},
+		{`local Base = {greet = function() return "hi" end} local o = setmetatable({}, {__index = Base})
+			return o.greet()`, []lua.Value{"hi"}},
+		{`x = 1 local function f() x = x + 1 end f() return x`, []lua.Value{2.0}},
+		{`local t = {1, 2, 3} for k in pairs(t) do t[k] = nil end return next(t)`, []lua.Value{nil}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, run(t, c.src), c.src)
+	}
+}
+
+func TestState_strings(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		src      string
+		expected []lua.Value
+	}{
+		{`return ("hello"):upper(), string.sub("hello", 2, -2), ("abc"):rep(2, 1), #("x"):rep(3)`,
+			[]lua.Value{"HELLO", "ell", "abcabc", 3.0}},
+		{`return string.find("a.b", ".", 1, true), string.find("hello world", "o w")`,
+			[]lua.Value{2.0, 5.0, 7.0}},
+		{`return string.find("key:123", "(%a+):(%d+)")`, []lua.Value{1.0, 7.0, "key", "123"}},
+		{`return string.match("  trim  ", "^%s*(.-)%s*$"), string.match("x=1", "()=()")`,
+			[]lua.Value{"trim", 2.0, 3.0}},
+		{`return (string.gsub("hello world", "o", "0")), string.gsub("abc", "%w", "%0%0")`,
+			[]lua.Value{"hell0 w0rld", "aabbcc", 3.0}},
+		{`return (string.gsub("$name is $age", "%$(%w+)", {name = "bob", age = 5}))`, []lua.Value{"bob is 5"}},
+		{`return (string.gsub("abc", ".", function(c) return c:byte() .. "," end))`, []lua.Value{"97,98,99,"}},
+		{`local r = {} for k, v in string.gmatch("a=1, b=2", "(%w+)=(%w+)") do r[#r + 1] = k .. v end
+			return table.concat(r, ";")`, []lua.Value{"a1;b2"}},
+		{`return string.format("%d %5.2f %s %x %q %g", 42, 3.14159, "s", 255, "a\"b", 0.1)`,
+			[]lua.Value{`42  3.14 s ff "a\"b" 0.1`}},
+		{`return string.match("f(a(b)c)", "%b()"), string.byte("A"), string.char(72, 105)`,
+			[]lua.Value{"(a(b)c)", 65.0, "Hi"}},
+		{`return tostring(1e15), tostring(2^53), tostring(0.1), tostring(-0.0 + 3), tonumber("0x1F"), tonumber("z", 36)`,
+			[]lua.Value{"1e+15", "9.007199254741e+15", "0.1", "3", 31.0, 35.0}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, run(t, c.src), c.src)
+	}
+}
+
+func TestState_libraries(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		src      string
+		expected []lua.Value
+	}{
+		{`local t = {3, 1, 2} table.sort(t) return unpack(t)`, []lua.Value{1.0, 2.0, 3.0}},
+		{`local t = {3, 1, 2} table.sort(t, function(a, b) return a > b end) return unpack(t)`,
+			[]lua.Value{3.0, 2.0, 1.0}},
+		{`local t = {1, 3} table.insert(t, 2, 2) table.insert(t, 4) local r = table.remove(t, 1)
+			return r, table.concat(t, "-")`, []lua.Value{1.0, "2-3-4"}},
+		{`return math.floor(3.7), math.max(1, 5, 3), math.min(2, -1), math.abs(-2), math.huge > 0`,
+			[]lua.Value{3.0, 5.0, -1.0, 2.0, true}},
+		{`return bit.band(12, 10), bit.bor(12, 10), bit.bxor(12, 10), bit.lshift(1, 4), bit.tohex(255)`,
+			[]lua.Value{8.0, 14.0, 6.0, 16.0, "000000ff"}},
+		{`return cjson.encode({1, 2, "x"}), cjson.encode({a = true, b = {c = 1}})`,
+			[]lua.Value{`[1,2,"x"]`, `{"a":true,"b":{"c":1}}`}},
+		{`local v = cjson.decode('{"a":[1,2,{"b":null}],"c":"d"}') return v.a[2], v.c, #v.a`,
+			[]lua.Value{2.0, "d", 3.0}},
+		{`return pcall(error, "boom", 0)`, []lua.Value{false, "boom"}},
+		{`return pcall(function() error({code = 1}) end)`, nil},
+		{`local ok, err = pcall(function() local x = nil return x.y end) return ok, err`,
+			[]lua.Value{false, "test:1: attempt to index a nil value"}},
+		{`return pcall(function() error("msg") end)`, []lua.Value{false, "test:1: msg"}},
+		{`return type(print), type(nil), type({}), type("")`, []lua.Value{"nil", "nil", "table", "string"}},
+	}
+	for _, c := range cases {
+		res := run(t, c.src)
+		if c.expected == nil {
+			require.Len(t, res, 2)
+			assert.Equal(t, false, res[0])
+			assert.IsType(t, &lua.Table{}, res[1])
+			continue
+		}
+		assert.Equal(t, c.expected, res, c.src)
+	}
+}
+
+func TestState_errors(t *testing.T) {
+	t.Parallel()
+	compileErrors := []struct {
+		src string
+		msg string
+	}{
+		{`x = `, "test:1: unexpected symbol near '<eof>'"},
+		{`if x then`, "test:1: 'end' expected near '<eof>'"},
+		{"while true do\n\nx = 1", "test:3: 'end' expected (to close 'while' at line 1) near '<eof>'"},
+		{`break`, "test:1: no loop to break near 'break'"},
+		{`x = "unfinished`, "test:1: unfinished string"},
+		{`f() = 1`, "test:1: syntax error near '='"},
+		{`return 1 x = 2`, "test:1: '<eof>' expected near 'x'"},
+	}
+	for _, c := range compileErrors {
+		_, err := lua.Compile("test", c.src)
+		assert.EqualError(t, err, c.msg, c.src)
+	}
+
+	runtimeErrors := []struct {
+		src string
+		msg string
+	}{
+		{`return x.y`, "test:1: attempt to index global 'x' (a nil value)"},
+		{`local t = {} return t.a.b`, "test:1: attempt to index field 'a' (a nil value)"},
+		{`return 1 + {}`, "test:1: attempt to perform arithmetic on a table value"},
+		{`return "a" .. nil`, "test:1: attempt to concatenate a nil value"},
+		{`return 1 < "2"`, "test:1: attempt to compare number with string"},
+		{`undefined()`, "test:1: attempt to call global 'undefined' (a nil value)"},
+		{"\nerror('custom')", "test:2: custom"},
+		{`local function f() return f() + 1 end return f()`, "stack overflow"},
+		{`return ("x"):bad()`, "test:1: attempt to call method 'bad' (a nil value)"},
+		{`return string.rep()`, "test:1: bad argument #1 to 'rep' (string expected, got no value)"},
+	}
+	for _, c := range runtimeErrors {
+		chunk, err := lua.Compile("test", c.src)
+		require.NoError(t, err, c.src)
+		_, err = lua.NewState().Run(context.Background(), chunk)
+		var luaErr *lua.Error
+		require.ErrorAs(t, err, &luaErr, c.src)
+		assert.EqualError(t, err, c.msg, c.src)
+	}
+}
+
+func TestState_interrupt(t *testing.T) {
+	t.Parallel()
+	chunk, err := lua.Compile("test", `local ok = pcall(function() while true do end end) return ok`)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = lua.NewState().Run(ctx, chunk)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTable_next(t *testing.T) {
+	t.Parallel()
+	tbl := lua.NewTable(0, 0)
+	require.NoError(t, tbl.Set("b", 1.0))
+	require.NoError(t, tbl.Set(2.0, "two"))
+	require.NoError(t, tbl.Set(1.0, "one"))
+	require.NoError(t, tbl.Set("a", 2.0))
+	require.Error(t, tbl.Set(nil, 1.0))
+	assert.Equal(t, 2, tbl.Len())
+
+	var keys []lua.Value
+	var key lua.Value
+	for {
+		k, _, err := tbl.Next(key)
+		require.NoError(t, err)
+		if k == nil {
+			break
+		}
+		keys = append(keys, k)
+		key = k
+	}
+	assert.Equal(t, []lua.Value{1.0, 2.0, "b", "a"}, keys)
+}
@@ -0,0 +1,785 @@
+package lua
+
+import (
+	"fmt"
+)
+
+type localVar struct {
+	name string
+	slot int
+}
+
+// funcState tracks the scopes of a function being parsed.
+type funcState struct {
+	parent  *funcState
+	proto   *funcProto
+	actives []localVar
+	loops   int
+}
+
+func (fs *funcState) declare(name string) int {
+	slot := fs.proto.slots
+	fs.proto.slots++
+	fs.actives = append(fs.actives, localVar{name: name, slot: slot})
+	return slot
+}
+
+func (fs *funcState) findLocal(name string) int {
+	for i := len(fs.actives) - 1; i >= 0; i-- {
+		if fs.actives[i].name == name {
+			return fs.actives[i].slot
+		}
+	}
+	return -1
+}
+
+func (fs *funcState) findUpval(name string) int {
+	for i, u := range fs.proto.upvals {
+		if u.name == name {
+			return i
+		}
+	}
+	if fs.parent == nil {
+		return -1
+	}
+	desc := upvalDesc{name: name}
+	if slot := fs.parent.findLocal(name); slot >= 0 {
+		desc.fromLocal, desc.index = true, slot
+	} else if index := fs.parent.findUpval(name); index >= 0 {
+		desc.index = index
+	} else {
+		return -1
+	}
+	fs.proto.upvals = append(fs.proto.upvals, desc)
+	return len(fs.proto.upvals) - 1
+}
+
+func (fs *funcState) resolve(name string) expr {
+	if slot := fs.findLocal(name); slot >= 0 {
+		return &localExpr{slot: slot}
+	}
+	if index := fs.findUpval(name); index >= 0 {
+		return &upvalExpr{index: index}
+	}
+	return &globalExpr{name: name}
+}
+
+type parser struct {
+	chunk  string
+	tokens []token
+	pos    int
+	fs     *funcState
+}
+
+// parse compiles a chunk into a vararg function without parameters.
+func parse(chunk, src string) (*funcProto, error) {
+	tokens, err := lex(chunk, src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{chunk: chunk, tokens: tokens}
+	proto := &funcProto{chunk: chunk, name: "main chunk", line: 0, vararg: true}
+	p.fs = &funcState{proto: proto}
+	if proto.body, err = p.block(); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorNear(tok, "'<eof>' expected")
+	}
+	return proto, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) check(s string) bool {
+	tok := p.peek()
+	return tok.kind == tokSymbol && tok.text == s
+}
+
+func (p *parser) accept(s string) bool {
+	if p.check(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorNear(p.peek(), fmt.Sprintf("'%s' expected", s))
+	}
+	return nil
+}
+
+// expectMatch expects a token closing the one opened at line.
+func (p *parser) expectMatch(s, opening string, line int) error {
+	if p.accept(s) {
+		return nil
+	}
+	if line == p.peek().line {
+		return p.expect(s)
+	}
+	return p.errorNear(p.peek(), fmt.Sprintf("'%s' expected (to close '%s' at line %d)", s, opening, line))
+}
+
+func (p *parser) errorNear(tok token, msg string) error {
+	return &SyntaxError{Chunk: p.chunk, Line: tok.line, Msg: fmt.Sprintf("%s near '%s'", msg, tok)}
+}
+
+func (p *parser) name() (string, error) {
+	tok := p.next()
+	if tok.kind != tokName {
+		return "", p.errorNear(tok, "<name> expected")
+	}
+	return tok.text, nil
+}
+
+func (p *parser) blockEnds() bool {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return true
+	}
+	if tok.kind != tokSymbol {
+		return false
+	}
+	switch tok.text {
+	case "else", "elseif", "end", "until":
+		return true
+	}
+	return false
+}
+
+// block parses statements of a new scope.
+func (p *parser) block() ([]stmt, error) {
+	active := len(p.fs.actives)
+	body, err := p.statements()
+	p.fs.actives = p.fs.actives[:active]
+	return body, err
+}
+
+// statements parses statements until the end of a block. A return must be the last statement.
+func (p *parser) statements() ([]stmt, error) {
+	var body []stmt
+	for !p.blockEnds() {
+		if p.accept("return") {
+			s, err := p.returnStmt()
+			if err != nil {
+				return nil, err
+			}
+			return append(body, s), nil
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			body = append(body, s)
+		}
+	}
+	return body, nil
+}
+
+func (p *parser) returnStmt() (stmt, error) {
+	s := &returnStmt{}
+	if !p.blockEnds() && !p.check(";") {
+		var err error
+		if s.exprs, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	p.accept(";")
+	if !p.blockEnds() {
+		return nil, p.errorNear(p.peek(), "'<eof>' expected")
+	}
+	return s, nil
+}
+
+func (p *parser) statement() (stmt, error) {
+	tok := p.peek()
+	if tok.kind == tokSymbol {
+		switch tok.text {
+		case ";":
+			p.next()
+			return nil, nil
+		case "if":
+			return p.ifStmt()
+		case "while":
+			return p.whileStmt()
+		case "do":
+			p.next()
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectMatch("end", "do", tok.line); err != nil {
+				return nil, err
+			}
+			return &doStmt{body: body}, nil
+		case "for":
+			return p.forStmt()
+		case "repeat":
+			return p.repeatStmt()
+		case "function":
+			return p.functionStmt()
+		case "local":
+			p.next()
+			if p.accept("function") {
+				return p.localFunctionStmt()
+			}
+			return p.localStmt()
+		case "break":
+			p.next()
+			if p.fs.loops == 0 {
+				return nil, p.errorNear(tok, "no loop to break")
+			}
+			return &breakStmt{}, nil
+		}
+	}
+	return p.exprStmt()
+}
+
+func (p *parser) ifStmt() (stmt, error) {
+	line := p.next().line
+	s := &ifStmt{}
+	for {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.conds = append(s.conds, cond)
+		s.blocks = append(s.blocks, body)
+		if !p.accept("elseif") {
+			break
+		}
+	}
+	if p.accept("else") {
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.orElse = body
+	}
+	if err := p.expectMatch("end", "if", line); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) loopBody() ([]stmt, error) {
+	p.fs.loops++
+	defer func() { p.fs.loops-- }()
+	return p.block()
+}
+
+func (p *parser) whileStmt() (stmt, error) {
+	line := p.next().line
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.loopBody()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("end", "while", line); err != nil {
+		return nil, err
+	}
+	return &whileStmt{cond: cond, body: body}, nil
+}
+
+// repeatStmt parses the condition in the scope of the body, so it can refer to its locals.
+func (p *parser) repeatStmt() (stmt, error) {
+	line := p.next().line
+	active := len(p.fs.actives)
+	defer func() { p.fs.actives = p.fs.actives[:active] }()
+	p.fs.loops++
+	body, err := p.statements()
+	p.fs.loops--
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("until", "repeat", line); err != nil {
+		return nil, err
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &repeatStmt{body: body, cond: cond}, nil
+}
+
+func (p *parser) forStmt() (stmt, error) {
+	line := p.next().line
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	active := len(p.fs.actives)
+	defer func() { p.fs.actives = p.fs.actives[:active] }()
+
+	if p.accept("=") {
+		s := &numericForStmt{line: line}
+		if s.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if s.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		s.slot = p.fs.declare(first)
+		if s.body, err = p.loopBody(); err != nil {
+			return nil, err
+		}
+		if err := p.expectMatch("end", "for", line); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	names := []string{first}
+	for p.accept(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	s := &genericForStmt{line: line}
+	if s.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		s.slots = append(s.slots, p.fs.declare(name))
+	}
+	if s.body, err = p.loopBody(); err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("end", "for", line); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// functionStmt parses function a.b:c() end as an assignment of a closure.
+func (p *parser) functionStmt() (stmt, error) {
+	line := p.next().line
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	fullName := name
+	target := p.fs.resolve(name)
+	method := false
+	for p.check(".") || p.check(":") {
+		method = p.next().text == ":"
+		field, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fullName += "." + field
+		target = &indexExpr{obj: target, key: &constExpr{value: field}, line: line}
+		if method {
+			break
+		}
+	}
+	proto, err := p.funcBody(fullName, method, line)
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{targets: []expr{target}, exprs: []expr{&functionExpr{proto: proto}}, line: line}, nil
+}
+
+func (p *parser) localFunctionStmt() (stmt, error) {
+	line := p.peek().line
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	slot := p.fs.declare(name)
+	proto, err := p.funcBody(name, false, line)
+	if err != nil {
+		return nil, err
+	}
+	return &localFunctionStmt{slot: slot, fn: proto}, nil
+}
+
+// localStmt declares the locals after parsing the values, so the values refer to outer variables.
+func (p *parser) localStmt() (stmt, error) {
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	s := &localStmt{}
+	if p.accept("=") {
+		var err error
+		if s.exprs, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		s.slots = append(s.slots, p.fs.declare(name))
+	}
+	return s, nil
+}
+
+func (p *parser) exprStmt() (stmt, error) {
+	tok := p.peek()
+	e, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.check("=") && !p.check(",") {
+		switch e.(type) {
+		case *callExpr, *methodCallExpr:
+			return &callStmt{call: e}, nil
+		}
+		return nil, p.errorNear(p.peek(), "syntax error")
+	}
+	targets := []expr{e}
+	for p.accept(",") {
+		target, err := p.suffixedExpr()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	for _, target := range targets {
+		switch target.(type) {
+		case *localExpr, *upvalExpr, *globalExpr, *indexExpr:
+		default:
+			return nil, p.errorNear(p.peek(), "syntax error")
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	exprs, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{targets: targets, exprs: exprs, line: tok.line}, nil
+}
+
+func (p *parser) funcBody(name string, method bool, line int) (*funcProto, error) {
+	proto := &funcProto{chunk: p.chunk, name: name, line: line}
+	fs := &funcState{parent: p.fs, proto: proto}
+	p.fs = fs
+	defer func() { p.fs = fs.parent }()
+
+	if method {
+		fs.declare("self")
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.check(")") {
+		if p.accept("...") {
+			proto.vararg = true
+			break
+		}
+		param, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fs.declare(param)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	proto.params = proto.slots
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("end", "function", line); err != nil {
+		return nil, err
+	}
+	proto.body = body
+	return proto, nil
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	var exprs []expr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+// binaryPriority holds left and right priorities of binary operators. Right associative
+// operators have lower right priority.
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"+": {6, 6}, "-": {6, 6}, "..": {5, 4},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+const unaryPriority = 8
+
+func (p *parser) expr() (expr, error) {
+	return p.subExpr(0)
+}
+
+func (p *parser) subExpr(limit int) (expr, error) {
+	var e expr
+	tok := p.peek()
+	if tok.kind == tokSymbol && (tok.text == "not" || tok.text == "-" || tok.text == "#") {
+		p.next()
+		operand, err := p.subExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		e = &unaryExpr{op: tok.text, e: operand, line: tok.line}
+		// Negative literals are folded into constants.
+		if c, ok := operand.(*constExpr); ok && tok.text == "-" {
+			if n, ok := c.value.(float64); ok {
+				e = &constExpr{value: -n}
+			}
+		}
+	} else {
+		var err error
+		if e, err = p.simpleExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		op := p.peek()
+		if op.kind != tokSymbol {
+			return e, nil
+		}
+		prio, ok := binaryPriority[op.text]
+		if !ok || prio[0] <= limit {
+			return e, nil
+		}
+		p.next()
+		right, err := p.subExpr(prio[1])
+		if err != nil {
+			return nil, err
+		}
+		e = &binaryExpr{op: op.text, left: e, right: right, line: op.line}
+	}
+}
+
+func (p *parser) simpleExpr() (expr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &constExpr{value: tok.num}, nil
+	case tokString:
+		p.next()
+		return &constExpr{value: tok.text}, nil
+	case tokSymbol:
+		switch tok.text {
+		case "nil":
+			p.next()
+			return &constExpr{}, nil
+		case "true":
+			p.next()
+			return &constExpr{value: true}, nil
+		case "false":
+			p.next()
+			return &constExpr{value: false}, nil
+		case "...":
+			p.next()
+			if !p.fs.proto.vararg {
+				return nil, p.errorNear(tok, "cannot use '...' outside a vararg function")
+			}
+			return &varargExpr{}, nil
+		case "{":
+			return p.tableConstructor()
+		case "function":
+			p.next()
+			proto, err := p.funcBody("anonymous", false, tok.line)
+			if err != nil {
+				return nil, err
+			}
+			return &functionExpr{proto: proto}, nil
+		}
+	}
+	return p.suffixedExpr()
+}
+
+func (p *parser) primaryExpr() (expr, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokName:
+		return p.fs.resolve(tok.text), nil
+	case tok.kind == tokSymbol && tok.text == "(":
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectMatch(")", "(", tok.line); err != nil {
+			return nil, err
+		}
+		return &parenExpr{e: e}, nil
+	}
+	return nil, p.errorNear(tok, "unexpected symbol")
+}
+
+func (p *parser) suffixedExpr() (expr, error) {
+	e, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("."):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &constExpr{value: name}, line: tok.line}
+		case p.accept("["):
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key, line: tok.line}
+		case p.accept(":"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodCallExpr{obj: e, name: name, args: args, line: tok.line}
+		case p.check("(") || p.check("{") || tok.kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: tok.line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) callArgs() ([]expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokString:
+		p.next()
+		return []expr{&constExpr{value: tok.text}}, nil
+	case p.check("{"):
+		t, err := p.tableConstructor()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{t}, nil
+	case p.accept("("):
+		if p.accept(")") {
+			return nil, nil
+		}
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectMatch(")", "(", tok.line); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+	return nil, p.errorNear(tok, "function arguments expected")
+}
+
+func (p *parser) tableConstructor() (expr, error) {
+	line := p.next().line
+	t := &tableExpr{line: line}
+	for !p.check("}") {
+		var item tableItem
+		var err error
+		switch {
+		case p.peek().kind == tokName && p.tokens[p.pos+1].kind == tokSymbol && p.tokens[p.pos+1].text == "=":
+			item.key = &constExpr{value: p.next().text}
+			p.next()
+			item.value, err = p.expr()
+		case p.accept("["):
+			if item.key, err = p.expr(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			item.value, err = p.expr()
+		default:
+			item.value, err = p.expr()
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.items = append(t.items, item)
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	if err := p.expectMatch("}", "{", line); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
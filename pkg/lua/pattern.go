@@ -0,0 +1,429 @@
+package lua
+
+import (
+	"errors"
+)
+
+// Lua patterns used by string.find, match, gmatch and gsub.
+
+const (
+	maxCaptures = 32
+	patternEsc  = '%'
+	// capUnfinished marks a capture which is not closed yet, capPosition a position capture ().
+	capUnfinished = -1
+	capPosition   = -2
+)
+
+var (
+	errMalformedEsc     = errors.New("malformed pattern (ends with '%')")
+	errMalformedBracket = errors.New("malformed pattern (missing ']')")
+	errUnbalanced       = errors.New("unbalanced pattern")
+	errMissingFrontier  = errors.New("missing '[' after '%f' in pattern")
+	errTooManyCaptures  = errors.New("too many captures")
+	errInvalidCapture   = errors.New("invalid pattern capture")
+	errUnfinishedCap    = errors.New("unfinished capture")
+	errInvalidCapIndex  = errors.New("invalid capture index")
+)
+
+type capture struct {
+	start, len int
+}
+
+// matchState is a state of matching a pattern against a source. Positions are byte offsets.
+type matchState struct {
+	src      string
+	pat      string
+	level    int
+	captures [maxCaptures]capture
+}
+
+// patternError aborts matching of a malformed pattern. It is recovered by protect.
+type patternError struct {
+	err error
+}
+
+func (ms *matchState) fail(err error) {
+	panic(patternError{err: err})
+}
+
+// protect runs f converting failures of matching to errors.
+func (ms *matchState) protect(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(patternError)
+			if !ok {
+				panic(r)
+			}
+			err = pe.err
+		}
+	}()
+	f()
+	return nil
+}
+
+// find matches the pattern at position init or later and returns bounds of the match or -1.
+func (ms *matchState) find(init int, anchor bool, p int) (start, end int, err error) {
+	start, end = -1, -1
+	err = ms.protect(func() {
+		for s := init; s <= len(ms.src); s++ {
+			ms.level = 0
+			if e := ms.match(s, p); e >= 0 {
+				start, end = s, e
+				return
+			}
+			if anchor {
+				return
+			}
+		}
+	})
+	return start, end, err
+}
+
+func (ms *matchState) patByte(p int) byte {
+	if p < len(ms.pat) {
+		return ms.pat[p]
+	}
+	return 0
+}
+
+func (ms *matchState) classEnd(p int) int {
+	c := ms.pat[p]
+	p++
+	switch c {
+	case patternEsc:
+		if p >= len(ms.pat) {
+			ms.fail(errMalformedEsc)
+		}
+		return p + 1
+	case '[':
+		if ms.patByte(p) == '^' {
+			p++
+		}
+		for {
+			if p >= len(ms.pat) {
+				ms.fail(errMalformedBracket)
+			}
+			c := ms.pat[p]
+			p++
+			if c == patternEsc && p < len(ms.pat) {
+				p++
+			}
+			if ms.patByte(p) == ']' {
+				return p + 1
+			}
+		}
+	}
+	return p
+}
+
+func matchClass(c, cl byte) bool {
+	var res bool
+	switch lower(cl) {
+	case 'a':
+		res = isAlpha(c) && c != '_'
+	case 'c':
+		res = c < 32 || c == 127
+	case 'd':
+		res = isDigit(c)
+	case 'l':
+		res = c >= 'a' && c <= 'z'
+	case 'p':
+		res = isPunct(c)
+	case 's':
+		res = c == ' ' || c >= '\t' && c <= '\r'
+	case 'u':
+		res = c >= 'A' && c <= 'Z'
+	case 'w':
+		res = isAlpha(c) && c != '_' || isDigit(c)
+	case 'x':
+		res = isDigit(c) || lower(c) >= 'a' && lower(c) <= 'f'
+	case 'z':
+		res = c == 0
+	default:
+		return cl == c
+	}
+	if cl >= 'A' && cl <= 'Z' {
+		return !res
+	}
+	return res
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func isPunct(c byte) bool {
+	return c > 32 && c < 127 && !isAlpha(c) && !isDigit(c) || c == '_'
+}
+
+// matchBracketClass matches a set [...] starting at p and ending with ']' at ec.
+func (ms *matchState) matchBracketClass(c byte, p, ec int) bool {
+	sig := true
+	if ms.pat[p+1] == '^' {
+		sig = false
+		p++
+	}
+	for p++; p < ec; p++ {
+		switch {
+		case ms.pat[p] == patternEsc:
+			p++
+			if matchClass(c, ms.pat[p]) {
+				return sig
+			}
+		case ms.patByte(p+1) == '-' && p+2 < ec:
+			if ms.pat[p] <= c && c <= ms.pat[p+2] {
+				return sig
+			}
+			p += 2
+		case ms.pat[p] == c:
+			return sig
+		}
+	}
+	return !sig
+}
+
+func (ms *matchState) singleMatch(s, p, ep int) bool {
+	if s >= len(ms.src) {
+		return false
+	}
+	c := ms.src[s]
+	switch ms.pat[p] {
+	case '.':
+		return true
+	case patternEsc:
+		return matchClass(c, ms.pat[p+1])
+	case '[':
+		return ms.matchBracketClass(c, p, ep-1)
+	}
+	return ms.pat[p] == c
+}
+
+// match returns the end of the match of pattern from p at source position s or -1.
+//
+//nolint:gocyclo // follows the structure of the reference implementation
+func (ms *matchState) match(s, p int) int {
+	for {
+		if p >= len(ms.pat) {
+			return s
+		}
+		switch ms.pat[p] {
+		case '(':
+			if ms.patByte(p+1) == ')' {
+				return ms.startCapture(s, p+2, capPosition)
+			}
+			return ms.startCapture(s, p+1, capUnfinished)
+		case ')':
+			return ms.endCapture(s, p+1)
+		case '$':
+			if p+1 == len(ms.pat) {
+				if s == len(ms.src) {
+					return s
+				}
+				return -1
+			}
+		case patternEsc:
+			switch next := ms.patByte(p + 1); {
+			case next == 'b':
+				if s = ms.matchBalance(s, p+2); s < 0 {
+					return -1
+				}
+				p += 4
+				continue
+			case next == 'f':
+				p += 2
+				if ms.patByte(p) != '[' {
+					ms.fail(errMissingFrontier)
+				}
+				ep := ms.classEnd(p)
+				var prev, cur byte
+				if s > 0 {
+					prev = ms.src[s-1]
+				}
+				if s < len(ms.src) {
+					cur = ms.src[s]
+				}
+				if ms.matchBracketClass(prev, p, ep-1) || !ms.matchBracketClass(cur, p, ep-1) {
+					return -1
+				}
+				p = ep
+				continue
+			case isDigit(next):
+				if s = ms.matchCapture(s, next); s < 0 {
+					return -1
+				}
+				p += 2
+				continue
+			}
+		}
+
+		ep := ms.classEnd(p)
+		m := ms.singleMatch(s, p, ep)
+		switch ms.patByte(ep) {
+		case '?':
+			if m {
+				if res := ms.match(s+1, ep+1); res >= 0 {
+					return res
+				}
+			}
+			p = ep + 1
+			continue
+		case '*':
+			return ms.maxExpand(s, p, ep)
+		case '+':
+			if !m {
+				return -1
+			}
+			return ms.maxExpand(s+1, p, ep)
+		case '-':
+			return ms.minExpand(s, p, ep)
+		}
+		if !m {
+			return -1
+		}
+		s++
+		p = ep
+	}
+}
+
+func (ms *matchState) maxExpand(s, p, ep int) int {
+	i := 0
+	for ms.singleMatch(s+i, p, ep) {
+		i++
+	}
+	for ; i >= 0; i-- {
+		if res := ms.match(s+i, ep+1); res >= 0 {
+			return res
+		}
+	}
+	return -1
+}
+
+func (ms *matchState) minExpand(s, p, ep int) int {
+	for {
+		if res := ms.match(s, ep+1); res >= 0 {
+			return res
+		}
+		if !ms.singleMatch(s, p, ep) {
+			return -1
+		}
+		s++
+	}
+}
+
+func (ms *matchState) startCapture(s, p, what int) int {
+	if ms.level >= maxCaptures {
+		ms.fail(errTooManyCaptures)
+	}
+	ms.captures[ms.level] = capture{start: s, len: what}
+	ms.level++
+	res := ms.match(s, p)
+	if res < 0 {
+		ms.level--
+	}
+	return res
+}
+
+func (ms *matchState) endCapture(s, p int) int {
+	l := -1
+	for i := ms.level - 1; i >= 0; i-- {
+		if ms.captures[i].len == capUnfinished {
+			l = i
+			break
+		}
+	}
+	if l < 0 {
+		ms.fail(errInvalidCapture)
+	}
+	ms.captures[l].len = s - ms.captures[l].start
+	res := ms.match(s, p)
+	if res < 0 {
+		ms.captures[l].len = capUnfinished
+	}
+	return res
+}
+
+func (ms *matchState) matchBalance(s, p int) int {
+	if p+1 >= len(ms.pat) {
+		ms.fail(errUnbalanced)
+	}
+	if s >= len(ms.src) || ms.src[s] != ms.pat[p] {
+		return -1
+	}
+	open, closing := ms.pat[p], ms.pat[p+1]
+	depth := 1
+	for s++; s < len(ms.src); s++ {
+		switch ms.src[s] {
+		case closing:
+			depth--
+			if depth == 0 {
+				return s + 1
+			}
+		case open:
+			depth++
+		}
+	}
+	return -1
+}
+
+func (ms *matchState) matchCapture(s int, index byte) int {
+	l := int(index - '1')
+	if l < 0 || l >= ms.level || ms.captures[l].len == capUnfinished {
+		ms.fail(errInvalidCapIndex)
+	}
+	c := ms.captures[l]
+	if len(ms.src)-s >= c.len && ms.src[c.start:c.start+c.len] == ms.src[s:s+c.len] {
+		return s + c.len
+	}
+	return -1
+}
+
+// capture returns the i-th capture of a match from s to e. Without captures the whole match
+// is the only capture.
+func (ms *matchState) capture(i, s, e int) (Value, error) {
+	if i >= ms.level {
+		if i == 0 {
+			return ms.src[s:e], nil
+		}
+		return nil, errInvalidCapIndex
+	}
+	c := ms.captures[i]
+	switch c.len {
+	case capUnfinished:
+		return nil, errUnfinishedCap
+	case capPosition:
+		return float64(c.start + 1), nil
+	}
+	return ms.src[c.start : c.start+c.len], nil
+}
+
+// allCaptures returns all captures of a match. The whole match is returned if there are none
+// and whole is set.
+func (ms *matchState) allCaptures(s, e int, whole bool) ([]Value, error) {
+	n := ms.level
+	if n == 0 && whole {
+		n = 1
+	}
+	res := make([]Value, n)
+	for i := range res {
+		v, err := ms.capture(i, s, e)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// hasSpecials reports whether a pattern has magic characters, so plain search can't be used.
+func hasSpecials(pat string) bool {
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '^', '$', '*', '+', '?', '.', '(', ')', '[', ']', '%', '-':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1154 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func openLibs(s *State) {
+	register(s.globals, map[string]GoFunction{
+		"assert":       baseAssert,
+		"error":        baseError,
+		"getmetatable": baseGetMetatable,
+		"ipairs":       baseIPairs,
+		"next":         baseNext,
+		"pairs":        basePairs,
+		"pcall":        basePCall,
+		"rawequal":     baseRawEqual,
+		"rawget":       baseRawGet,
+		"rawset":       baseRawSet,
+		"select":       baseSelect,
+		"setmetatable": baseSetMetatable,
+		"tonumber":     baseToNumber,
+		"tostring":     baseToString,
+		"type":         baseType,
+		"unpack":       tableUnpack,
+		"xpcall":       baseXPCall,
+	})
+	s.SetGlobal("_VERSION", "Lua 5.1")
+
+	s.strings = NewTable(0, 0)
+	register(s.strings, map[string]GoFunction{
+		"byte":    strByte,
+		"char":    strChar,
+		"find":    strFind,
+		"format":  strFormat,
+		"gmatch":  strGMatch,
+		"gsub":    strGSub,
+		"len":     strLen,
+		"lower":   strLower,
+		"match":   strMatch,
+		"rep":     strRep,
+		"reverse": strReverse,
+		"sub":     strSub,
+		"upper":   strUpper,
+	})
+	s.SetGlobal("string", s.strings)
+
+	table := NewTable(0, 0)
+	register(table, map[string]GoFunction{
+		"concat": tableConcat,
+		"getn":   tableGetN,
+		"insert": tableInsert,
+		"maxn":   tableMaxN,
+		"remove": tableRemove,
+		"sort":   tableSort,
+		"unpack": tableUnpack,
+	})
+	s.SetGlobal("table", table)
+
+	s.SetGlobal("math", mathLib())
+	s.SetGlobal("bit", bitLib())
+	s.SetGlobal("cjson", cjsonLib())
+}
+
+func register(t *Table, funcs map[string]GoFunction) {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.SetString(name, NewFunction(name, funcs[name]))
+	}
+}
+
+func arg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func argError(s *State, i int, fname, msg string) error {
+	return s.Errorf("bad argument #%d to '%s' (%s)", i+1, fname, msg)
+}
+
+func typeError(s *State, args []Value, i int, fname, expected string) error {
+	got := "no value"
+	if i < len(args) {
+		got = TypeName(args[i])
+	}
+	return argError(s, i, fname, expected+" expected, got "+got)
+}
+
+func checkAny(s *State, args []Value, i int, fname string) (Value, error) {
+	if i >= len(args) {
+		return nil, argError(s, i, fname, "value expected")
+	}
+	return args[i], nil
+}
+
+func checkNumber(s *State, args []Value, i int, fname string) (float64, error) {
+	n, ok := toNumberCoerce(arg(args, i))
+	if !ok {
+		return 0, typeError(s, args, i, fname, "number")
+	}
+	return n, nil
+}
+
+func checkInt(s *State, args []Value, i int, fname string) (int, error) {
+	n, err := checkNumber(s, args, i, fname)
+	return int(n), err
+}
+
+func optInt(s *State, args []Value, i int, fname string, def int) (int, error) {
+	if arg(args, i) == nil {
+		return def, nil
+	}
+	return checkInt(s, args, i, fname)
+}
+
+func checkString(s *State, args []Value, i int, fname string) (string, error) {
+	str, ok := toStringCoerce(arg(args, i))
+	if !ok {
+		return "", typeError(s, args, i, fname, "string")
+	}
+	return str, nil
+}
+
+func checkTable(s *State, args []Value, i int, fname string) (*Table, error) {
+	t, ok := arg(args, i).(*Table)
+	if !ok {
+		return nil, typeError(s, args, i, fname, "table")
+	}
+	return t, nil
+}
+
+func baseAssert(s *State, args []Value) ([]Value, error) {
+	if Truthy(arg(args, 0)) {
+		return args, nil
+	}
+	if len(args) > 1 {
+		return nil, &Error{Value: args[1]}
+	}
+	return nil, s.Errorf("assertion failed!")
+}
+
+// baseError raises a value. String messages are prefixed with the position of the call
+// unless level is 0.
+func baseError(s *State, args []Value) ([]Value, error) {
+	v := arg(args, 0)
+	level, err := optInt(s, args, 1, "error", 1)
+	if err != nil {
+		return nil, err
+	}
+	if msg, ok := v.(string); ok && level > 0 {
+		v = s.where() + msg
+	}
+	return nil, &Error{Value: v}
+}
+
+func baseGetMetatable(_ *State, args []Value) ([]Value, error) {
+	if t, ok := arg(args, 0).(*Table); ok && t.meta != nil {
+		return []Value{t.meta}, nil
+	}
+	return []Value{nil}, nil
+}
+
+func baseSetMetatable(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "setmetatable")
+	if err != nil {
+		return nil, err
+	}
+	switch meta := arg(args, 1).(type) {
+	case nil:
+		t.meta = nil
+	case *Table:
+		t.meta = meta
+	default:
+		return nil, typeError(s, args, 1, "setmetatable", "nil or table")
+	}
+	return []Value{t}, nil
+}
+
+func baseIPairs(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "ipairs")
+	if err != nil {
+		return nil, err
+	}
+	iter := NewFunction("ipairs_iter", func(_ *State, args []Value) ([]Value, error) {
+		i, _ := arg(args, 1).(float64)
+		v := t.Get(i + 1)
+		if v == nil {
+			return []Value{nil}, nil
+		}
+		return []Value{i + 1, v}, nil
+	})
+	return []Value{iter, t, float64(0)}, nil
+}
+
+func baseNext(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "next")
+	if err != nil {
+		return nil, err
+	}
+	k, v, err := t.Next(arg(args, 1))
+	if err != nil {
+		return nil, s.Errorf("%s", err)
+	}
+	if k == nil {
+		return []Value{nil}, nil
+	}
+	return []Value{k, v}, nil
+}
+
+var nextFunction = NewFunction("next", baseNext)
+
+func basePairs(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "pairs")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{nextFunction, t, nil}, nil
+}
+
+// basePCall calls a function catching errors raised by scripts. Other errors, such as
+// interruption of the script, aren't caught.
+func basePCall(s *State, args []Value) ([]Value, error) {
+	fn, err := checkAny(s, args, 0, "pcall")
+	if err != nil {
+		return nil, err
+	}
+	rets, err := s.Call(fn, args[1:]...)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return []Value{false, e.Value}, nil
+		}
+		return nil, err
+	}
+	return append([]Value{true}, rets...), nil
+}
+
+func baseXPCall(s *State, args []Value) ([]Value, error) {
+	fn, err := checkAny(s, args, 0, "xpcall")
+	if err != nil {
+		return nil, err
+	}
+	rets, err := s.Call(fn)
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			return nil, err
+		}
+		handled, err := s.Call(arg(args, 1), e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return append([]Value{false}, handled...), nil
+	}
+	return append([]Value{true}, rets...), nil
+}
+
+func baseRawEqual(_ *State, args []Value) ([]Value, error) {
+	return []Value{rawEqual(arg(args, 0), arg(args, 1))}, nil
+}
+
+func baseRawGet(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "rawget")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{t.Get(arg(args, 1))}, nil
+}
+
+func baseRawSet(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "rawset")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Set(arg(args, 1), arg(args, 2)); err != nil {
+		return nil, s.Errorf("%s", err)
+	}
+	return []Value{t}, nil
+}
+
+func baseSelect(s *State, args []Value) ([]Value, error) {
+	if str, ok := arg(args, 0).(string); ok && str == "#" {
+		return []Value{float64(len(args) - 1)}, nil
+	}
+	n, err := checkInt(s, args, 0, "select")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n < 0:
+		n = len(args) + n
+	case n == 0:
+		return nil, argError(s, 0, "select", "index out of range")
+	}
+	if n < 1 {
+		return nil, argError(s, 0, "select", "index out of range")
+	}
+	if n >= len(args) {
+		return nil, nil
+	}
+	return args[n:], nil
+}
+
+func baseToNumber(s *State, args []Value) ([]Value, error) {
+	base, err := optInt(s, args, 1, "tonumber", 10)
+	if err != nil {
+		return nil, err
+	}
+	if base == 10 {
+		n, ok := toNumberCoerce(arg(args, 0))
+		if !ok {
+			return []Value{nil}, nil
+		}
+		return []Value{n}, nil
+	}
+	if base < 2 || base > 36 {
+		return nil, argError(s, 1, "tonumber", "base out of range")
+	}
+	str, err := checkString(s, args, 0, "tonumber")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(str), base, 64)
+	if err != nil {
+		return []Value{nil}, nil
+	}
+	return []Value{float64(n)}, nil
+}
+
+func baseToString(s *State, args []Value) ([]Value, error) {
+	v, err := checkAny(s, args, 0, "tostring")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{ToString(v)}, nil
+}
+
+func baseType(s *State, args []Value) ([]Value, error) {
+	v, err := checkAny(s, args, 0, "type")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{TypeName(v)}, nil
+}
+
+// strRange converts relative positions of a string to a zero based range.
+// Negative positions count from the end.
+func strRange(n, i, j int) (int, int) {
+	if i < 0 {
+		i = max(n+i+1, 0)
+	}
+	if j < 0 {
+		j = n + j + 1
+	}
+	i = max(i, 1)
+	j = min(j, n)
+	return i - 1, j
+}
+
+func strByte(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "byte")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(s, args, 1, "byte", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(s, args, 2, "byte", i)
+	if err != nil {
+		return nil, err
+	}
+	start, end := strRange(len(str), i, j)
+	var res []Value
+	for k := start; k < end; k++ {
+		res = append(res, float64(str[k]))
+	}
+	return res, nil
+}
+
+func strChar(s *State, args []Value) ([]Value, error) {
+	b := make([]byte, len(args))
+	for i := range args {
+		c, err := checkInt(s, args, i, "char")
+		if err != nil {
+			return nil, err
+		}
+		if c < 0 || c > 255 {
+			return nil, argError(s, i, "char", "invalid value")
+		}
+		b[i] = byte(c)
+	}
+	return []Value{string(b)}, nil
+}
+
+func strLen(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "len")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(len(str))}, nil
+}
+
+func strLower(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "lower")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToLower(str)}, nil
+}
+
+func strUpper(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "upper")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToUpper(str)}, nil
+}
+
+// maxStringSize limits strings built by string.rep, so scripts can't exhaust memory at once.
+const maxStringSize = 512 << 20
+
+func strRep(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "rep")
+	if err != nil {
+		return nil, err
+	}
+	n, err := checkInt(s, args, 1, "rep")
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return []Value{""}, nil
+	}
+	if len(str)*n > maxStringSize {
+		return nil, s.Errorf("resulting string too large")
+	}
+	return []Value{strings.Repeat(str, n)}, nil
+}
+
+func strReverse(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "reverse")
+	if err != nil {
+		return nil, err
+	}
+	b := []byte(str)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return []Value{string(b)}, nil
+}
+
+func strSub(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "sub")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(s, args, 1, "sub", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(s, args, 2, "sub", -1)
+	if err != nil {
+		return nil, err
+	}
+	start, end := strRange(len(str), i, j)
+	if start >= end {
+		return []Value{""}, nil
+	}
+	return []Value{str[start:end]}, nil
+}
+
+func strFind(s *State, args []Value) ([]Value, error) {
+	return strFindAux(s, args, "find", true)
+}
+
+func strMatch(s *State, args []Value) ([]Value, error) {
+	return strFindAux(s, args, "match", false)
+}
+
+// strFindAux implements string.find returning bounds and captures, and string.match
+// returning captures only.
+func strFindAux(s *State, args []Value, fname string, find bool) ([]Value, error) {
+	str, err := checkString(s, args, 0, fname)
+	if err != nil {
+		return nil, err
+	}
+	pat, err := checkString(s, args, 1, fname)
+	if err != nil {
+		return nil, err
+	}
+	init, err := optInt(s, args, 2, fname, 1)
+	if err != nil {
+		return nil, err
+	}
+	if init < 0 {
+		init = max(len(str)+init+1, 1)
+	}
+	init = max(init, 1) - 1
+	if init > len(str) {
+		return []Value{nil}, nil
+	}
+	if find && (Truthy(arg(args, 3)) || !hasSpecials(pat)) {
+		i := strings.Index(str[init:], pat)
+		if i < 0 {
+			return []Value{nil}, nil
+		}
+		return []Value{float64(init + i + 1), float64(init + i + len(pat))}, nil
+	}
+
+	anchor := strings.HasPrefix(pat, "^")
+	p := 0
+	if anchor {
+		p = 1
+	}
+	ms := &matchState{src: str, pat: pat}
+	start, end, err := ms.find(init, anchor, p)
+	if err != nil {
+		return nil, s.Errorf("%s", err)
+	}
+	if start < 0 {
+		return []Value{nil}, nil
+	}
+	captures, err := ms.allCaptures(start, end, !find)
+	if err != nil {
+		return nil, s.Errorf("%s", err)
+	}
+	if find {
+		return append([]Value{float64(start + 1), float64(end)}, captures...), nil
+	}
+	return captures, nil
+}
+
+func strGMatch(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "gmatch")
+	if err != nil {
+		return nil, err
+	}
+	pat, err := checkString(s, args, 1, "gmatch")
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	iter := NewFunction("gmatch_iter", func(s *State, _ []Value) ([]Value, error) {
+		ms := &matchState{src: str, pat: pat}
+		for ; pos <= len(str); pos++ {
+			end := -1
+			if err := ms.protect(func() {
+				ms.level = 0
+				end = ms.match(pos, 0)
+			}); err != nil {
+				return nil, s.Errorf("%s", err)
+			}
+			if end < 0 {
+				continue
+			}
+			start := pos
+			pos = end
+			if end == start {
+				pos++
+			}
+			captures, err := ms.allCaptures(start, end, true)
+			if err != nil {
+				return nil, s.Errorf("%s", err)
+			}
+			return captures, nil
+		}
+		return []Value{nil}, nil
+	})
+	return []Value{iter}, nil
+}
+
+//nolint:gocyclo // follows the structure of the reference implementation
+func strGSub(s *State, args []Value) ([]Value, error) {
+	str, err := checkString(s, args, 0, "gsub")
+	if err != nil {
+		return nil, err
+	}
+	pat, err := checkString(s, args, 1, "gsub")
+	if err != nil {
+		return nil, err
+	}
+	repl := arg(args, 2)
+	switch repl.(type) {
+	case string, float64, *Table, *Function:
+	default:
+		return nil, typeError(s, args, 2, "gsub", "string/function/table")
+	}
+	maxN, err := optInt(s, args, 3, "gsub", len(str)+1)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor := strings.HasPrefix(pat, "^")
+	p := 0
+	if anchor {
+		p = 1
+	}
+	ms := &matchState{src: str, pat: pat}
+	var b strings.Builder
+	src, n := 0, 0
+	for n < maxN {
+		end := -1
+		if err := ms.protect(func() {
+			ms.level = 0
+			end = ms.match(src, p)
+		}); err != nil {
+			return nil, s.Errorf("%s", err)
+		}
+		if end >= 0 {
+			n++
+			if err := gsubValue(s, ms, &b, src, end, repl); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case end > src:
+			src = end
+		case src < len(str):
+			b.WriteByte(str[src])
+			src++
+		default:
+			return []Value{b.String() + str[src:], float64(n)}, nil
+		}
+		if anchor {
+			break
+		}
+	}
+	b.WriteString(str[src:])
+	return []Value{b.String(), float64(n)}, nil
+}
+
+// gsubValue appends the replacement of a match. False or nil replacement keeps the match.
+func gsubValue(s *State, ms *matchState, b *strings.Builder, start, end int, repl Value) error {
+	match := ms.src[start:end]
+	var value Value
+	switch r := repl.(type) {
+	case string, float64:
+		tmpl, _ := toStringCoerce(r)
+		for i := 0; i < len(tmpl); i++ {
+			c := tmpl[i]
+			if c != patternEsc || i+1 == len(tmpl) {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			d := tmpl[i]
+			switch {
+			case d == '0':
+				b.WriteString(match)
+			case isDigit(d):
+				v, err := ms.capture(int(d-'1'), start, end)
+				if err != nil {
+					return s.Errorf("%s", err)
+				}
+				str, _ := toStringCoerce(v)
+				b.WriteString(str)
+			default:
+				b.WriteByte(d)
+			}
+		}
+		return nil
+	case *Table:
+		key, err := ms.capture(0, start, end)
+		if err != nil {
+			return s.Errorf("%s", err)
+		}
+		value = r.Get(key)
+	case *Function:
+		captures, err := ms.allCaptures(start, end, true)
+		if err != nil {
+			return s.Errorf("%s", err)
+		}
+		rets, err := s.Call(r, captures...)
+		if err != nil {
+			return err
+		}
+		value = arg(rets, 0)
+	}
+	if !Truthy(value) {
+		b.WriteString(match)
+		return nil
+	}
+	str, ok := toStringCoerce(value)
+	if !ok {
+		return s.Errorf("invalid replacement value (a %s)", TypeName(value))
+	}
+	b.WriteString(str)
+	return nil
+}
+
+//nolint:gocyclo // one case per conversion
+func strFormat(s *State, args []Value) ([]Value, error) {
+	format, err := checkString(s, args, 0, "format")
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	argi := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		start := i
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && isDigit(format[i]) {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && isDigit(format[i]) {
+				i++
+			}
+		}
+		if i >= len(format) {
+			return nil, s.Errorf("invalid option '%%' to 'format'")
+		}
+		spec := "%" + format[start:i]
+		conv := format[i]
+		argi++
+		if argi >= len(args) {
+			return nil, argError(s, argi, "format", "no value")
+		}
+		switch conv {
+		case 'd', 'i':
+			n, err := checkNumber(s, args, argi, "format")
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, spec+"d", int64(n))
+		case 'c':
+			n, err := checkNumber(s, args, argi, "format")
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(byte(int64(n)))
+		case 'x', 'X', 'o':
+			n, err := checkNumber(s, args, argi, "format")
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, spec+string(conv), uint64(int64(n)))
+		case 'e', 'E', 'f', 'g', 'G':
+			n, err := checkNumber(s, args, argi, "format")
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(spec, ".") {
+				// C defaults to 6 digits of precision, while Go uses the shortest representation.
+				spec += ".6"
+			}
+			fmt.Fprintf(&b, spec+string(conv), n)
+		case 'q':
+			str, err := checkString(s, args, argi, "format")
+			if err != nil {
+				return nil, err
+			}
+			quoteString(&b, str)
+		case 's':
+			fmt.Fprintf(&b, spec+"s", ToString(args[argi]))
+		default:
+			return nil, s.Errorf("invalid option '%%%c' to 'format'", conv)
+		}
+	}
+	return []Value{b.String()}, nil
+}
+
+func quoteString(b *strings.Builder, str string) {
+	b.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
+		case '"', '\\', '\n':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r':
+			b.WriteString("\\r")
+		case 0:
+			b.WriteString("\\000")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+}
+
+func tableConcat(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "concat")
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if arg(args, 1) != nil {
+		if sep, err = checkString(s, args, 1, "concat"); err != nil {
+			return nil, err
+		}
+	}
+	i, err := optInt(s, args, 2, "concat", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(s, args, 3, "concat", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for k := i; k <= j; k++ {
+		str, ok := toStringCoerce(t.Get(float64(k)))
+		if !ok {
+			return nil, s.Errorf("invalid value (at index %d) in table for 'concat'", k)
+		}
+		b.WriteString(str)
+		if k < j {
+			b.WriteString(sep)
+		}
+	}
+	return []Value{b.String()}, nil
+}
+
+func tableGetN(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "getn")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(t.Len())}, nil
+}
+
+func tableMaxN(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "maxn")
+	if err != nil {
+		return nil, err
+	}
+	res := 0.0
+	var k Value
+	for {
+		if k, _, err = t.Next(k); err != nil || k == nil {
+			return []Value{res}, err
+		}
+		if n, ok := k.(float64); ok && n > res {
+			res = n
+		}
+	}
+}
+
+func tableInsert(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "insert")
+	if err != nil {
+		return nil, err
+	}
+	n := t.Len()
+	switch len(args) {
+	case 2:
+		t.Append(args[1])
+	case 3:
+		pos, err := checkInt(s, args, 1, "insert")
+		if err != nil {
+			return nil, err
+		}
+		for i := n; i >= pos; i-- {
+			_ = t.Set(float64(i+1), t.Get(float64(i)))
+		}
+		if err := t.Set(float64(pos), args[2]); err != nil {
+			return nil, s.Errorf("%s", err)
+		}
+	default:
+		return nil, s.Errorf("wrong number of arguments to 'insert'")
+	}
+	return nil, nil
+}
+
+func tableRemove(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "remove")
+	if err != nil {
+		return nil, err
+	}
+	n := t.Len()
+	pos, err := optInt(s, args, 1, "remove", n)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return []Value{nil}, nil
+	}
+	v := t.Get(float64(pos))
+	for i := pos; i < n; i++ {
+		_ = t.Set(float64(i), t.Get(float64(i+1)))
+	}
+	_ = t.Set(float64(n), nil)
+	return []Value{v}, nil
+}
+
+func tableSort(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "sort")
+	if err != nil {
+		return nil, err
+	}
+	comp := arg(args, 1)
+	items := make([]Value, t.Len())
+	for i := range items {
+		items[i] = t.Get(float64(i + 1))
+	}
+	var sortErr error
+	sort.SliceStable(items, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		if comp == nil {
+			less, err := lessValues(items[i], items[j], false)
+			if err != nil {
+				sortErr = s.Errorf("%s", err)
+			}
+			return less
+		}
+		rets, err := s.Call(comp, items[i], items[j])
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return Truthy(arg(rets, 0))
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	for i, v := range items {
+		_ = t.Set(float64(i+1), v)
+	}
+	return nil, nil
+}
+
+func tableUnpack(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(s, args, 0, "unpack")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(s, args, 1, "unpack", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(s, args, 2, "unpack", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	if j-i >= maxCallDepth*100 {
+		return nil, s.Errorf("too many results to unpack")
+	}
+	var res []Value
+	for k := i; k <= j; k++ {
+		res = append(res, t.Get(float64(k)))
+	}
+	return res, nil
+}
+
+func mathLib() *Table {
+	t := NewTable(0, 0)
+	unary := map[string]func(float64) float64{
+		"abs": math.Abs, "acos": math.Acos, "asin": math.Asin, "atan": math.Atan,
+		"ceil": math.Ceil, "cos": math.Cos, "cosh": math.Cosh, "deg": func(x float64) float64 { return x * 180 / math.Pi },
+		"exp": math.Exp, "floor": math.Floor, "log10": math.Log10, "rad": func(x float64) float64 { return x * math.Pi / 180 },
+		"sin": math.Sin, "sinh": math.Sinh, "sqrt": math.Sqrt, "tan": math.Tan, "tanh": math.Tanh,
+	}
+	funcs := make(map[string]GoFunction, len(unary))
+	for name, f := range unary {
+		funcs[name] = func(s *State, args []Value) ([]Value, error) {
+			x, err := checkNumber(s, args, 0, name)
+			if err != nil {
+				return nil, err
+			}
+			return []Value{f(x)}, nil
+		}
+	}
+	binary := map[string]func(float64, float64) float64{
+		"atan2": math.Atan2, "fmod": math.Mod, "pow": math.Pow,
+		"ldexp": func(m, e float64) float64 { return math.Ldexp(m, int(e)) },
+	}
+	for name, f := range binary {
+		funcs[name] = func(s *State, args []Value) ([]Value, error) {
+			x, err := checkNumber(s, args, 0, name)
+			if err != nil {
+				return nil, err
+			}
+			y, err := checkNumber(s, args, 1, name)
+			if err != nil {
+				return nil, err
+			}
+			return []Value{f(x, y)}, nil
+		}
+	}
+	funcs["log"] = mathLog
+	funcs["max"] = mathMinMax("max", func(a, b float64) bool { return a > b })
+	funcs["min"] = mathMinMax("min", func(a, b float64) bool { return a < b })
+	funcs["modf"] = func(s *State, args []Value) ([]Value, error) {
+		x, err := checkNumber(s, args, 0, "modf")
+		if err != nil {
+			return nil, err
+		}
+		i, f := math.Modf(x)
+		return []Value{i, f}, nil
+	}
+	funcs["frexp"] = func(s *State, args []Value) ([]Value, error) {
+		x, err := checkNumber(s, args, 0, "frexp")
+		if err != nil {
+			return nil, err
+		}
+		m, e := math.Frexp(x)
+		return []Value{m, float64(e)}, nil
+	}
+	// Random numbers are seeded identically for every script, so scripts are deterministic.
+	rng := rand.New(rand.NewPCG(0, 0))
+	funcs["random"] = func(s *State, args []Value) ([]Value, error) {
+		r := rng.Float64()
+		switch len(args) {
+		case 0:
+			return []Value{r}, nil
+		case 1, 2:
+			lo, hi := 1, 0
+			var err error
+			if len(args) == 1 {
+				hi, err = checkInt(s, args, 0, "random")
+			} else if lo, err = checkInt(s, args, 0, "random"); err == nil {
+				hi, err = checkInt(s, args, 1, "random")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, argError(s, len(args)-1, "random", "interval is empty")
+			}
+			return []Value{math.Floor(r*float64(hi-lo+1)) + float64(lo)}, nil
+		}
+		return nil, s.Errorf("wrong number of arguments")
+	}
+	funcs["randomseed"] = func(s *State, args []Value) ([]Value, error) {
+		seed, err := checkNumber(s, args, 0, "randomseed")
+		if err != nil {
+			return nil, err
+		}
+		rng = rand.New(rand.NewPCG(uint64(int64(seed)), 0))
+		return nil, nil
+	}
+	register(t, funcs)
+	t.SetString("pi", math.Pi)
+	t.SetString("huge", math.Inf(1))
+	return t
+}
+
+func mathLog(s *State, args []Value) ([]Value, error) {
+	x, err := checkNumber(s, args, 0, "log")
+	if err != nil {
+		return nil, err
+	}
+	if arg(args, 1) == nil {
+		return []Value{math.Log(x)}, nil
+	}
+	base, err := checkNumber(s, args, 1, "log")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{math.Log(x) / math.Log(base)}, nil
+}
+
+func mathMinMax(name string, better func(a, b float64) bool) GoFunction {
+	return func(s *State, args []Value) ([]Value, error) {
+		res, err := checkNumber(s, args, 0, name)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(args); i++ {
+			x, err := checkNumber(s, args, i, name)
+			if err != nil {
+				return nil, err
+			}
+			if better(x, res) {
+				res = x
+			}
+		}
+		return []Value{res}, nil
+	}
+}
+
+// bitLib implements the bit library of LuaJIT operating on 32 bit integers.
+func bitLib() *Table {
+	t := NewTable(0, 0)
+	toBit := func(s *State, args []Value, i int, fname string) (int32, error) {
+		n, err := checkNumber(s, args, i, fname)
+		return int32(int64(n)), err
+	}
+	fold := func(name string, op func(a, b int32) int32) GoFunction {
+		return func(s *State, args []Value) ([]Value, error) {
+			res, err := toBit(s, args, 0, name)
+			if err != nil {
+				return nil, err
+			}
+			for i := 1; i < len(args); i++ {
+				x, err := toBit(s, args, i, name)
+				if err != nil {
+					return nil, err
+				}
+				res = op(res, x)
+			}
+			return []Value{float64(res)}, nil
+		}
+	}
+	shift := func(name string, op func(a int32, n uint) int32) GoFunction {
+		return func(s *State, args []Value) ([]Value, error) {
+			x, err := toBit(s, args, 0, name)
+			if err != nil {
+				return nil, err
+			}
+			n, err := toBit(s, args, 1, name)
+			if err != nil {
+				return nil, err
+			}
+			return []Value{float64(op(x, uint(n&31)))}, nil
+		}
+	}
+	register(t, map[string]GoFunction{
+		"tobit": fold("tobit", func(a, _ int32) int32 { return a }),
+		"bnot": func(s *State, args []Value) ([]Value, error) {
+			x, err := toBit(s, args, 0, "bnot")
+			return []Value{float64(^x)}, err
+		},
+		"band":    fold("band", func(a, b int32) int32 { return a & b }),
+		"bor":     fold("bor", func(a, b int32) int32 { return a | b }),
+		"bxor":    fold("bxor", func(a, b int32) int32 { return a ^ b }),
+		"lshift":  shift("lshift", func(a int32, n uint) int32 { return a << n }),
+		"rshift":  shift("rshift", func(a int32, n uint) int32 { return int32(uint32(a) >> n) }),
+		"arshift": shift("arshift", func(a int32, n uint) int32 { return a >> n }),
+		"tohex": func(s *State, args []Value) ([]Value, error) {
+			x, err := toBit(s, args, 0, "tohex")
+			if err != nil {
+				return nil, err
+			}
+			return []Value{fmt.Sprintf("%08x", uint32(x))}, nil
+		},
+	})
+	return t
+}
@@ -0,0 +1,234 @@
+package lua
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	errNilIndex = errors.New("table index is nil")
+	errNaNIndex = errors.New("table index is NaN")
+	errNextKey  = errors.New("invalid key to 'next'")
+)
+
+// Table is a Lua table. Consecutive integer keys starting at 1 are stored in the array part.
+// Other keys are iterated in insertion order, so scripts behave deterministically.
+type Table struct {
+	array []Value
+	hash  map[Value]Value
+	// keys are hash keys in insertion order. Removed keys stay in place until the table grows,
+	// so next() keeps working when fields are cleared during traversal.
+	keys  []Value
+	index map[Value]int
+	meta  *Table
+}
+
+// NewTable creates a table with preallocated array and hash parts.
+func NewTable(narr, nhash int) *Table {
+	t := &Table{}
+	if narr > 0 {
+		t.array = make([]Value, 0, narr)
+	}
+	if nhash > 0 {
+		t.hash = make(map[Value]Value, nhash)
+		t.index = make(map[Value]int, nhash)
+	}
+	return t
+}
+
+// NewArray creates a table holding the values at keys from 1.
+func NewArray(values ...Value) *Table {
+	t := NewTable(len(values), 0)
+	for _, v := range values {
+		t.Append(v)
+	}
+	return t
+}
+
+// arrayIndex returns the zero based position of a key in the array part.
+func arrayIndex(key Value) (int, bool) {
+	n, ok := key.(float64)
+	if !ok || n != math.Trunc(n) || n < 1 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n) - 1, true
+}
+
+// Get returns a value of the key without invoking metamethods.
+func (t *Table) Get(key Value) Value {
+	if i, ok := arrayIndex(key); ok && i < len(t.array) {
+		return t.array[i]
+	}
+	if t.hash == nil {
+		return nil
+	}
+	return t.hash[normalizeKey(key)]
+}
+
+// GetString returns a value of the string key.
+func (t *Table) GetString(key string) Value {
+	if t.hash == nil {
+		return nil
+	}
+	return t.hash[key]
+}
+
+// Set assigns a value to the key without invoking metamethods. Nil value removes the key.
+func (t *Table) Set(key, value Value) error {
+	switch k := key.(type) {
+	case nil:
+		return errNilIndex
+	case float64:
+		if math.IsNaN(k) {
+			return errNaNIndex
+		}
+	}
+	key = normalizeKey(key)
+	if i, ok := arrayIndex(key); ok {
+		switch {
+		case i < len(t.array):
+			t.array[i] = value
+			if i == len(t.array)-1 && value == nil {
+				t.trimArray()
+			}
+			return nil
+		case i == len(t.array) && value != nil:
+			t.array = append(t.array, value)
+			t.delHash(key)
+			t.migrate()
+			return nil
+		}
+	}
+	if value == nil {
+		t.delHash(key)
+		return nil
+	}
+	t.setHash(key, value)
+	return nil
+}
+
+// SetString assigns a value to the string key.
+func (t *Table) SetString(key string, value Value) {
+	_ = t.Set(key, value)
+}
+
+// Append stores the value after the last element of the array part.
+func (t *Table) Append(value Value) {
+	_ = t.Set(float64(len(t.array)+1), value)
+}
+
+// Len returns a border of the table as the length operator does.
+func (t *Table) Len() int {
+	return len(t.array)
+}
+
+// Metatable returns the metatable of the table.
+func (t *Table) Metatable() *Table {
+	return t.meta
+}
+
+// SetMetatable sets the metatable of the table. Only __index is supported.
+func (t *Table) SetMetatable(meta *Table) {
+	t.meta = meta
+}
+
+// Next returns the key and value following the key in traversal order.
+// Nil key starts the traversal, nil returned key ends it.
+func (t *Table) Next(key Value) (Value, Value, error) {
+	start := 0
+	if key != nil {
+		key = normalizeKey(key)
+		pos, inHash := t.index[key]
+		i, isArray := arrayIndex(key)
+		switch {
+		case isArray && (i < len(t.array) || !inHash):
+			// The array may have been trimmed by clearing its last elements during traversal.
+			start = i + 1
+		case inHash:
+			return t.nextHash(pos + 1)
+		default:
+			return nil, nil, errNextKey
+		}
+	}
+	for i := start; i < len(t.array); i++ {
+		if t.array[i] != nil {
+			return float64(i + 1), t.array[i], nil
+		}
+	}
+	return t.nextHash(0)
+}
+
+func (t *Table) nextHash(pos int) (Value, Value, error) {
+	for ; pos < len(t.keys); pos++ {
+		k := t.keys[pos]
+		if v, ok := t.hash[k]; ok {
+			return k, v, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func (t *Table) setHash(key, value Value) {
+	if t.hash == nil {
+		t.hash = make(map[Value]Value)
+		t.index = make(map[Value]int)
+	}
+	if _, ok := t.index[key]; !ok {
+		if len(t.keys) > 2*len(t.hash)+8 {
+			t.compact()
+		}
+		t.index[key] = len(t.keys)
+		t.keys = append(t.keys, key)
+	}
+	t.hash[key] = value
+}
+
+func (t *Table) delHash(key Value) {
+	if t.hash != nil {
+		delete(t.hash, key)
+	}
+}
+
+// compact drops removed keys from the insertion order.
+func (t *Table) compact() {
+	keys := t.keys[:0]
+	clear(t.index)
+	for _, k := range t.keys {
+		if _, ok := t.hash[k]; ok {
+			t.index[k] = len(keys)
+			keys = append(keys, k)
+		}
+	}
+	clear(t.keys[len(keys):])
+	t.keys = keys
+}
+
+// migrate moves keys following the array part from the hash part.
+func (t *Table) migrate() {
+	for t.hash != nil {
+		key := float64(len(t.array) + 1)
+		v, ok := t.hash[key]
+		if !ok {
+			return
+		}
+		t.array = append(t.array, v)
+		delete(t.hash, key)
+	}
+}
+
+func (t *Table) trimArray() {
+	n := len(t.array)
+	for n > 0 && t.array[n-1] == nil {
+		n--
+	}
+	clear(t.array[n:])
+	t.array = t.array[:n]
+}
+
+// normalizeKey makes negative zero equal to zero.
+func normalizeKey(key Value) Value {
+	if n, ok := key.(float64); ok && n == 0 {
+		return float64(0)
+	}
+	return key
+}
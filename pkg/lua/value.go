@@ -0,0 +1,178 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Value is a Lua value: nil, bool, float64, string, *Table or *Function.
+type Value interface{}
+
+// GoFunction is a function implemented in Go and callable from scripts.
+type GoFunction func(s *State, args []Value) ([]Value, error)
+
+// Function is a Lua closure or a Go function.
+type Function struct {
+	name   string
+	proto  *funcProto
+	upvals []*cell
+	native GoFunction
+}
+
+// NewFunction wraps a Go function, so it can be stored in tables and globals.
+func NewFunction(name string, fn GoFunction) *Function {
+	return &Function{name: name, native: fn}
+}
+
+// cell holds a local variable shared by closures capturing it.
+type cell struct {
+	v Value
+}
+
+// Error is an error raised by a script. Value is the object passed to error()
+// or a message of a runtime error prefixed with its position.
+type Error struct {
+	Value Value
+}
+
+func (e *Error) Error() string {
+	if s, ok := toStringCoerce(e.Value); ok {
+		return s
+	}
+	if e.Value == nil {
+		return "nil"
+	}
+	return ToString(e.Value)
+}
+
+// TypeName returns the name of the type of a value as reported by type().
+func TypeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *Function:
+		return "function"
+	}
+	return "userdata"
+}
+
+// Truthy reports whether a value is considered true by conditions. Only nil and false are false.
+func Truthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// ToString converts a value to a string as tostring() does.
+func ToString(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return FormatNumber(v)
+	case string:
+		return v
+	case *Table:
+		return fmt.Sprintf("table: %p", v)
+	case *Function:
+		if v.native != nil {
+			return fmt.Sprintf("builtin: %p", v)
+		}
+		return fmt.Sprintf("function: %p", v)
+	}
+	return fmt.Sprintf("userdata: %v", v)
+}
+
+// FormatNumber formats a number the same way as "%.14g" in C, so integers have no fraction.
+func FormatNumber(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	case math.IsNaN(n):
+		return "nan"
+	case n == math.Trunc(n) && math.Abs(n) < 1e15:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+// ParseNumber converts a string to a number as tonumber() does. Hexadecimal integers
+// and surrounding spaces are accepted.
+func ParseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	neg := false
+	body := s
+	if body[0] == '-' || body[0] == '+' {
+		neg = body[0] == '-'
+		body = body[1:]
+	}
+	if len(body) > 2 && body[0] == '0' && (body[1] == 'x' || body[1] == 'X') {
+		n, err := strconv.ParseUint(body[2:], 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		if neg {
+			return -float64(n), true
+		}
+		return float64(n), true
+	}
+	for _, c := range body {
+		if !strings.ContainsRune("0123456789.eE+-", c) {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// toNumberCoerce converts numbers and numeric strings to numbers.
+func toNumberCoerce(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		return ParseNumber(v)
+	}
+	return 0, false
+}
+
+// toStringCoerce converts strings and numbers to strings.
+func toStringCoerce(v Value) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return FormatNumber(v), true
+	}
+	return "", false
+}
+
+// rawEqual compares values without metamethods. Numbers are compared by value,
+// tables and functions by reference.
+func rawEqual(a, b Value) bool {
+	return a == b
+}
@@ -0,0 +1,241 @@
+// Package module is the API of server modules. A module is a Go plugin built with
+// -buildmode=plugin against the same version of this package. It exports an init function
+//
+//	func RedisModuleInit(m *module.Module, args []string) error
+//
+// which names the module and registers its commands, value types and keyspace event subscribers.
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/burenotti/redis_impl/pkg/keyspace"
+)
+
+// InitSymbol is the name of the init function exported by modules.
+const InitSymbol = "RedisModuleInit"
+
+var (
+	ErrNotSupported = errors.New("modules are not supported on this platform")
+	ErrInvalidInit  = errors.New("module doesn't export a valid " + InitSymbol + " function")
+	ErrNoName       = errors.New("module didn't set its name")
+	ErrCommand      = errors.New("invalid module command")
+	ErrType         = errors.New("invalid module type")
+	// ErrWrongType is the error built-in commands reply for keys of other types.
+	ErrWrongType = keyspace.ErrWrongType
+)
+
+// InitFunc is the type of the init function exported by modules.
+type InitFunc = func(m *Module, args []string) error
+
+// Flags of module commands. Only write changes the behaviour of a command: its successful calls
+// are logged and emit keyspace events, and read-only scripts can't call it. Other flags are reported only.
+const (
+	FlagWrite    = "write"
+	FlagReadOnly = "readonly"
+	FlagAdmin    = "admin"
+	FlagFast     = "fast"
+	FlagDenyOOM  = "deny-oom"
+	FlagRandom   = "random"
+)
+
+var knownFlags = []string{FlagWrite, FlagReadOnly, FlagAdmin, FlagFast, FlagDenyOOM, FlagRandom}
+
+// Keyspace is the database selected by the client calling a module command.
+type Keyspace interface {
+	// GetString returns the string stored at key. Found is false if the key doesn't exist.
+	GetString(ctx context.Context, key string) (value []byte, found bool, err error)
+	SetString(ctx context.Context, key string, value []byte) error
+	// GetValue returns the value of type typ stored at key. Keys of other types fail with ErrWrongType.
+	GetValue(ctx context.Context, key string, typ *Type) (value interface{}, found bool, err error)
+	SetValue(ctx context.Context, key string, typ *Type, value interface{}) error
+	// Del deletes the key and reports whether it existed.
+	Del(ctx context.Context, key string) (bool, error)
+}
+
+// Handler executes a module command. Args don't include the name of the command. Replies may be
+// nil, []byte (bulk strings), string (simple strings), int64, error and []interface{} of them.
+type Handler func(ctx context.Context, ks Keyspace, args [][]byte) (interface{}, error)
+
+// Command is a command registered by a module.
+type Command struct {
+	// Name is the name of the command. It is case-insensitive.
+	Name string
+	// Arity is the number of arguments including the name. Negative arity -N means at least N arguments.
+	Arity int
+	Flags []string
+	// FirstKey, LastKey and KeyStep locate keys in arguments counting the name as 0.
+	// LastKey -1 means the last argument. Commands without keys have zero FirstKey.
+	FirstKey, LastKey, KeyStep int
+	Handler                    Handler
+}
+
+// HasFlag reports whether the command has the flag.
+func (c *Command) HasFlag(flag string) bool {
+	return slices.Contains(c.Flags, flag)
+}
+
+// CheckArity reports whether the command accepts n arguments including the name.
+func (c *Command) CheckArity(n int) bool {
+	if c.Arity < 0 {
+		return n >= -c.Arity
+	}
+	return n == c.Arity
+}
+
+// Keys returns keys from args of the command. Args include the name.
+func (c *Command) Keys(args []string) []string {
+	if c.FirstKey <= 0 || c.FirstKey >= len(args) {
+		return nil
+	}
+	last := c.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	last = min(last, len(args)-1)
+	var keys []string
+	for i := c.FirstKey; i <= last; i += c.KeyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+func (c *Command) validate() error {
+	switch {
+	case c.Name == "" || strings.ContainsAny(c.Name, " \t\r\n"):
+		return fmt.Errorf("%w: name %q", ErrCommand, c.Name)
+	case c.Arity == 0:
+		return fmt.Errorf("%w: %s has zero arity", ErrCommand, c.Name)
+	case c.Handler == nil:
+		return fmt.Errorf("%w: %s has no handler", ErrCommand, c.Name)
+	case c.FirstKey < 0 || c.FirstKey > 0 && c.KeyStep <= 0:
+		return fmt.Errorf("%w: %s has invalid key specification", ErrCommand, c.Name)
+	case c.LastKey >= 0 && c.LastKey < c.FirstKey:
+		return fmt.Errorf("%w: %s has invalid key specification", ErrCommand, c.Name)
+	case c.HasFlag(FlagWrite) && c.HasFlag(FlagReadOnly):
+		return fmt.Errorf("%w: %s is both write and readonly", ErrCommand, c.Name)
+	}
+	for _, flag := range c.Flags {
+		if !slices.Contains(knownFlags, flag) {
+			return fmt.Errorf("%w: %s has unknown flag %s", ErrCommand, c.Name, flag)
+		}
+	}
+	return nil
+}
+
+// Type is a value type registered by a module. Values are serialized by Save and deserialized
+// by Load, for example when a transaction copies them to be able to roll back.
+type Type struct {
+	// Name is reported by TYPE. Names of types are unique across modules.
+	Name string
+	Save func(value interface{}) ([]byte, error)
+	Load func(data []byte) (interface{}, error)
+}
+
+// Value is a value of a module type stored in the keyspace.
+type Value struct {
+	Type  *Type
+	Value interface{}
+}
+
+// Clone copies the value by saving and loading it.
+func (v *Value) Clone() (*Value, error) {
+	data, err := v.Type.Save(v.Value)
+	if err != nil {
+		return nil, fmt.Errorf("save %s value: %w", v.Type.Name, err)
+	}
+	value, err := v.Type.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("load %s value: %w", v.Type.Name, err)
+	}
+	return &Value{Type: v.Type, Value: value}, nil
+}
+
+// Event is a keyspace event. Events are named after the lowercase name of the command
+// which changed the key.
+type Event struct {
+	DB    int
+	Key   string
+	Event string
+}
+
+// Subscriber receives keyspace events after the command which caused them completes.
+// Subscribers are called sequentially and must not block.
+type Subscriber func(Event)
+
+// Module holds everything registered by a module.
+type Module struct {
+	Name    string
+	Version int
+	Path    string
+	Args    []string
+
+	commands    []*Command
+	types       []*Type
+	subscribers []Subscriber
+}
+
+// Init creates a module by calling its init function.
+func Init(init InitFunc, path string, args []string) (*Module, error) {
+	m := &Module{Path: path, Args: args}
+	if err := init(m, args); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		return nil, ErrNoName
+	}
+	return m, nil
+}
+
+// CreateCommand registers a command.
+func (m *Module) CreateCommand(c Command) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	c.Name = strings.ToUpper(c.Name)
+	for _, other := range m.commands {
+		if other.Name == c.Name {
+			return fmt.Errorf("%w: %s is registered twice", ErrCommand, c.Name)
+		}
+	}
+	m.commands = append(m.commands, &c)
+	return nil
+}
+
+// CreateType registers a value type. The returned type is used to get and set values of the type.
+func (m *Module) CreateType(t Type) (*Type, error) {
+	switch {
+	case t.Name == "":
+		return nil, fmt.Errorf("%w: empty name", ErrType)
+	case t.Save == nil || t.Load == nil:
+		return nil, fmt.Errorf("%w: %s has no serialization callbacks", ErrType, t.Name)
+	}
+	for _, other := range m.types {
+		if other.Name == t.Name {
+			return nil, fmt.Errorf("%w: %s is registered twice", ErrType, t.Name)
+		}
+	}
+	m.types = append(m.types, &t)
+	return &t, nil
+}
+
+// Subscribe registers a subscriber of keyspace events.
+func (m *Module) Subscribe(s Subscriber) {
+	m.subscribers = append(m.subscribers, s)
+}
+
+func (m *Module) Commands() []*Command {
+	return m.commands
+}
+
+func (m *Module) Types() []*Type {
+	return m.types
+}
+
+func (m *Module) Subscribers() []Subscriber {
+	return m.subscribers
+}
@@ -0,0 +1,55 @@
+package module_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noop(context.Context, module.Keyspace, [][]byte) (interface{}, error) {
+	return nil, nil
+}
+
+func TestModule_CreateCommand(t *testing.T) {
+	t.Parallel()
+	m := &module.Module{}
+	require.NoError(t, m.CreateCommand(module.Command{
+		Name: "mod.mset", Arity: -3, Flags: []string{module.FlagWrite}, FirstKey: 1, LastKey: -1, KeyStep: 2, Handler: noop,
+	}))
+	c := m.Commands()[0]
+	assert.Equal(t, "MOD.MSET", c.Name)
+	assert.True(t, c.CheckArity(5))
+	assert.False(t, c.CheckArity(2))
+	assert.Equal(t, []string{"a", "b"}, c.Keys([]string{"MOD.MSET", "a", "1", "b", "2"}))
+
+	invalid := []module.Command{
+		{Name: "mod.mset", Arity: 1, Handler: noop},
+		{Name: "bad name", Arity: 1, Handler: noop},
+		{Name: "mod.zero", Handler: noop},
+		{Name: "mod.nohandler", Arity: 1},
+		{Name: "mod.keys", Arity: 2, FirstKey: 1, Handler: noop},
+		{Name: "mod.keys", Arity: 2, FirstKey: 2, LastKey: 1, KeyStep: 1, Handler: noop},
+		{Name: "mod.flags", Arity: 1, Flags: []string{module.FlagWrite, module.FlagReadOnly}, Handler: noop},
+		{Name: "mod.flags", Arity: 1, Flags: []string{"unknown"}, Handler: noop},
+	}
+	for _, c := range invalid {
+		require.ErrorIs(t, m.CreateCommand(c), module.ErrCommand, c.Name)
+	}
+}
+
+func TestInit(t *testing.T) {
+	t.Parallel()
+	_, err := module.Init(func(*module.Module, []string) error { return nil }, "", nil)
+	require.ErrorIs(t, err, module.ErrNoName)
+
+	m, err := module.Init(func(m *module.Module, args []string) error {
+		m.Name = args[0]
+		_, err := m.CreateType(module.Type{Name: "type"})
+		return err
+	}, "mod.so", []string{"mod"})
+	require.ErrorIs(t, err, module.ErrType)
+	assert.Nil(t, m)
+}
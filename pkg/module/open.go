@@ -0,0 +1,26 @@
+//go:build linux && cgo
+
+package module
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// Open loads the plugin at path and initializes the module. Plugins can't be closed, so opening
+// the same path again reuses the loaded code and only calls the init function again.
+func Open(path string, args []string) (*Module, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(InitSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInit, err)
+	}
+	init, ok := sym.(InitFunc)
+	if !ok {
+		return nil, fmt.Errorf("%w: it has type %T", ErrInvalidInit, sym)
+	}
+	return Init(init, path, args)
+}
@@ -0,0 +1,8 @@
+//go:build !linux || !cgo
+
+package module
+
+// Open fails, because plugins are only supported on Linux with cgo.
+func Open(_ string, _ []string) (*Module, error) {
+	return nil, ErrNotSupported
+}
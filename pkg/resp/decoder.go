@@ -0,0 +1,366 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	DefaultMaxBulkLen      = 512 << 20
+	DefaultMaxMultiBulkLen = 1024 * 1024
+
+	// maxLineLen bounds lines of headers and simple values, which are short unless malformed.
+	maxLineLen = 64 << 10
+	// decoderBufferSize is the initial size of the buffer of a Decoder, which is restored once
+	// a larger value is decoded.
+	decoderBufferSize = 16 << 10
+)
+
+var ErrLimitExceeded = errors.New("protocol limit exceeded")
+
+// Limits bound sizes declared by headers, so a malformed header can't make the receiver wait for
+// and buffer gigabytes. Zero fields mean the defaults.
+type Limits struct {
+	// MaxBulkLen is the maximum length of a bulk string.
+	MaxBulkLen int64
+	// MaxMultiBulkLen is the maximum number of elements of an array.
+	MaxMultiBulkLen int64
+}
+
+func (l Limits) maxBulkLen() int64 {
+	if l.MaxBulkLen > 0 {
+		return l.MaxBulkLen
+	}
+	return DefaultMaxBulkLen
+}
+
+func (l Limits) maxMultiBulkLen() int64 {
+	if l.MaxMultiBulkLen > 0 {
+		return l.MaxMultiBulkLen
+	}
+	return DefaultMaxMultiBulkLen
+}
+
+// Decoder decodes values read from a stream into a reusable buffer, which grows to fit the
+// largest value and shrinks back after it. Bulk strings of decoded values refer to the buffer,
+// so they are valid until the next call only.
+type Decoder struct {
+	r   io.Reader
+	buf []byte
+	// buf[base:end] is read, but not decoded yet.
+	base, end int
+	scanner   scanner
+	args      [][]byte
+	// err is the error of the stream, which is returned once buffered values are decoded.
+	err error
+}
+
+func NewDecoder(r io.Reader, limits Limits) *Decoder {
+	return &Decoder{r: r, scanner: scanner{limits: limits}}
+}
+
+// Decode decodes the next value.
+func (d *Decoder) Decode() (interface{}, error) {
+	n, err := d.next(false)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := build(d.buf[d.base:d.base+n], 0, false)
+	d.base += n
+	return value, nil
+}
+
+// DecodeCommand decodes the next command, which is an array of bulk strings. The returned slice is
+// reused as well, so decoding of commands doesn't allocate once the buffer fits them.
+func (d *Decoder) DecodeCommand() ([][]byte, error) {
+	n, err := d.next(true)
+	if err != nil {
+		return nil, err
+	}
+	d.args = buildArgs(d.buf[d.base:d.base+n], d.args[:0])
+	d.base += n
+	return d.args, nil
+}
+
+// next reads until the next value is buffered and returns its length. A syntax error is returned
+// by all following calls, because the rest of the stream can't be decoded.
+func (d *Decoder) next(command bool) (int, error) {
+	if d.err != nil && d.base == d.end {
+		return 0, d.err
+	}
+	d.shrink()
+	for {
+		n, err := d.scanner.scan(d.buf[d.base:d.end], command)
+		if !errors.Is(err, ErrIncomplete) {
+			if err != nil {
+				d.base, d.end, d.err = 0, 0, err
+			}
+			return n, err
+		}
+		if err := d.fill(d.scanner.need); err != nil {
+			return 0, d.scanner.fail(err)
+		}
+	}
+}
+
+// fill reads until at least n bytes of the next value are buffered, as io.ReadFull does.
+func (d *Decoder) fill(n int) error {
+	if len(d.buf)-d.base < n {
+		d.grow(n)
+	}
+	for d.end-d.base < n {
+		if d.err != nil {
+			err := d.err
+			if errors.Is(err, io.EOF) && d.end > d.base {
+				err = io.ErrUnexpectedEOF
+			}
+			d.base, d.end = 0, 0
+			return err
+		}
+		read, err := d.r.Read(d.buf[d.end:])
+		d.end += read
+		d.err = err
+	}
+	return nil
+}
+
+// grow makes room for n bytes of the next value, moving it to the beginning of the buffer.
+// Positions in the value don't change, so the state of the scanner stays valid.
+func (d *Decoder) grow(n int) {
+	buf := d.buf
+	if size := max(n, decoderBufferSize); len(buf) < size {
+		buf = make([]byte, max(size, 2*len(buf)))
+	}
+	d.end = copy(buf, d.buf[d.base:d.end])
+	d.base = 0
+	d.buf = buf
+}
+
+// shrink replaces the buffer grown by a large value once it isn't needed.
+func (d *Decoder) shrink() {
+	if len(d.buf) > decoderBufferSize && d.end-d.base <= decoderBufferSize/2 {
+		buf := make([]byte, decoderBufferSize)
+		d.end = copy(buf, d.buf[d.base:d.end])
+		d.base = 0
+		d.buf = buf
+	}
+	if cap(d.args) > decoderBufferSize {
+		d.args = nil
+	}
+}
+
+// scanner finds the end of a value received in chunks. It remembers elements of arrays it has
+// scanned, so they aren't scanned again as the value is received.
+type scanner struct {
+	limits Limits
+	// off is the offset of the first element which isn't scanned yet.
+	off int
+	// left are numbers of elements left in nested arrays, the innermost one is the last.
+	left []int64
+	// need is the length of data needed to scan the next element once ErrIncomplete is returned.
+	need int
+}
+
+// scan returns the length of the value at the beginning of data, which must begin with data passed
+// to the previous call if it has returned ErrIncomplete. A command is an array of bulk strings.
+func (s *scanner) scan(data []byte, command bool) (int, error) {
+	for {
+		off := s.off
+		end, err := scanLine(data, off)
+		if err != nil {
+			s.need = len(data) + 1
+			return 0, s.fail(err)
+		}
+		line, next := data[off:end], end+2 //nolint:mnd // 2 is length of "\r\n"
+		if len(line) == 0 {
+			return 0, s.fail(fmt.Errorf("%w: empty line", ErrInvalidSyntax))
+		}
+
+		depth := len(s.left)
+		switch {
+		case command && depth == 0 && line[0] != prefixArray:
+			return 0, s.fail(fmt.Errorf("%w: command must be an array", ErrInvalidSyntax))
+		case command && depth > 0 && line[0] != prefixBulkString:
+			return 0, s.fail(fmt.Errorf("%w: command arguments must be bulk strings", ErrInvalidSyntax))
+		}
+
+		switch line[0] {
+		case prefixSimpleString, prefixError:
+		case prefixInteger:
+			if _, err := parseInt(line[1:]); err != nil {
+				return 0, s.fail(err)
+			}
+		case prefixBulkString:
+			size, err := parseSize(line[1:])
+			switch {
+			case err != nil:
+				return 0, s.fail(err)
+			case size > s.limits.maxBulkLen():
+				return 0, s.fail(fmt.Errorf("%w: invalid bulk length", ErrLimitExceeded))
+			case command && size < 0:
+				return 0, s.fail(fmt.Errorf("%w: command arguments must not be nil", ErrInvalidSyntax))
+			case size >= 0:
+				end := next + int(size)
+				if len(data) < end+2 {
+					s.need = end + 2
+					return 0, ErrIncomplete
+				}
+				if data[end] != '\r' || data[end+1] != '\n' {
+					return 0, s.fail(fmt.Errorf("%w: not null bulk string must has crlf ending", ErrInvalidSyntax))
+				}
+				next = end + 2
+			}
+		case prefixArray:
+			size, err := parseSize(line[1:])
+			switch {
+			case err != nil:
+				return 0, s.fail(err)
+			case size > s.limits.maxMultiBulkLen():
+				return 0, s.fail(fmt.Errorf("%w: invalid multibulk length", ErrLimitExceeded))
+			case size > 0:
+				s.off = next
+				s.left = append(s.left, size)
+				continue
+			}
+		default:
+			return 0, s.fail(fmt.Errorf("%w: unknown prefix %q", ErrInvalidSyntax, line[0]))
+		}
+
+		s.off = next
+		for len(s.left) > 0 {
+			last := len(s.left) - 1
+			if s.left[last]--; s.left[last] > 0 {
+				break
+			}
+			s.left = s.left[:last]
+		}
+		if len(s.left) == 0 {
+			s.off = 0
+			return next, nil
+		}
+	}
+}
+
+// fail resets the scanner unless data is incomplete.
+func (s *scanner) fail(err error) error {
+	if !errors.Is(err, ErrIncomplete) {
+		s.reset()
+	}
+	return err
+}
+
+func (s *scanner) reset() {
+	s.off = 0
+	s.left = s.left[:0]
+}
+
+// scanLine returns the offset of CRLF ending the line at offset off.
+func scanLine(data []byte, off int) (int, error) {
+	i := bytes.IndexByte(data[off:], '\n')
+	switch {
+	case i > maxLineLen || i < 0 && len(data)-off > maxLineLen:
+		return 0, fmt.Errorf("%w: too long line", ErrLimitExceeded)
+	case i < 0:
+		return 0, ErrIncomplete
+	case i == 0 || data[off+i-1] != '\r':
+		return 0, fmt.Errorf("%w: line must end with crlf", ErrInvalidSyntax)
+	}
+	return off + i - 1, nil
+}
+
+// build builds the scanned value at offset off and returns offset of the next one. Bulk strings
+// refer to data unless they are cloned.
+func build(data []byte, off int, clone bool) (interface{}, int) {
+	end := off + bytes.IndexByte(data[off:], '\n') - 1
+	line, next := data[off:end], end+2 //nolint:mnd // 2 is length of "\r\n"
+	switch line[0] {
+	case prefixSimpleString:
+		return string(line[1:]), next
+	case prefixError:
+		return errors.New(string(line[1:])), next //nolint:err113 // may return errors
+	case prefixInteger:
+		value, _ := parseInt(line[1:])
+		return value, next
+	case prefixBulkString:
+		size, _ := parseSize(line[1:])
+		if size < 0 {
+			return []byte(nil), next
+		}
+		value := data[next : next+int(size) : next+int(size)]
+		if clone {
+			value = bytes.Clone(value)
+		}
+		return value, next + int(size) + 2
+	default:
+		size, _ := parseSize(line[1:])
+		if size < 0 {
+			return []interface{}(nil), next
+		}
+		value := make([]interface{}, size)
+		for i := range value {
+			value[i], next = build(data, next, clone)
+		}
+		return value, next
+	}
+}
+
+// buildArgs appends arguments of the scanned command to args. Arguments refer to data.
+func buildArgs(data []byte, args [][]byte) [][]byte {
+	end := bytes.IndexByte(data, '\n') - 1
+	count, _ := parseSize(data[1:end])
+	off := end + 2
+	for range count {
+		end := off + bytes.IndexByte(data[off:], '\n') - 1
+		size, _ := parseSize(data[off+1 : end])
+		off = end + 2
+		args = append(args, data[off:off+int(size):off+int(size)])
+		off += int(size) + 2
+	}
+	return args
+}
+
+func parseInt(data []byte) (int64, error) {
+	if value, ok := parseShortInt(data); ok {
+		return value, nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidSyntax, err)
+	}
+	return value, nil
+}
+
+// parseShortInt parses integers which can't overflow without converting data to a string, which
+// would be allocated.
+func parseShortInt(data []byte) (int64, bool) {
+	digits := data
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 || len(digits) > 18 { //nolint:mnd // 18 digits always fit int64
+		return 0, false
+	}
+	var value int64
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + int64(c-'0')
+	}
+	if data[0] == '-' {
+		value = -value
+	}
+	return value, true
+}
+
+// parseSize parses size of a bulk string or an array, -1 stands for nil.
+func parseSize(data []byte) (int64, error) {
+	size, err := parseInt(data)
+	if err == nil && size < -1 {
+		return 0, fmt.Errorf("%w: size must not be less than -1", ErrInvalidSyntax)
+	}
+	return size, err
+}
@@ -0,0 +1,203 @@
+package resp_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/burenotti/redis_impl/pkg/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	t.Parallel()
+	input := "+abacaba\r\n:-12\r\n-ERR wrong\r\n$0\r\n\r\n$-1\r\n*-1\r\n*0\r\n" +
+		"*3\r\n$7\r\na\rb\nc\r\n\r\n*2\r\n:1\r\n*0\r\n$-1\r\n"
+	expected := []interface{}{
+		"abacaba",
+		int64(-12),
+		errors.New("ERR wrong"),
+		[]byte{},
+		[]byte(nil),
+		[]interface{}(nil),
+		[]interface{}{},
+		[]interface{}{[]byte("a\rb\nc\r\n"), []interface{}{int64(1), []interface{}{}}, []byte(nil)},
+	}
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			d := resp.NewDecoder(reader(strings.NewReader(input)), resp.Limits{})
+			for _, value := range expected {
+				actual, err := d.Decode()
+				require.NoError(t, err)
+				assert.Equal(t, value, actual)
+			}
+			_, err := d.Decode()
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+func TestDecoder_DecodeCommand(t *testing.T) {
+	t.Parallel()
+	large := strings.Repeat("x", 100<<10)
+	input := "*1\r\n$4\r\nPING\r\n*3\r\n$3\r\nSET\r\n$5\r\nlarge\r\n$102400\r\n" + large + "\r\n" +
+		"*2\r\n$3\r\nGET\r\n$5\r\nlarge\r\n"
+
+	d := resp.NewDecoder(iotest.HalfReader(strings.NewReader(input)), resp.Limits{})
+	for _, expected := range [][]string{{"PING"}, {"SET", "large", large}, {"GET", "large"}} {
+		args, err := d.DecodeCommand()
+		require.NoError(t, err)
+		actual := make([]string, len(args))
+		for i, arg := range args {
+			actual[i] = string(arg)
+		}
+		assert.Equal(t, expected, actual)
+	}
+	_, err := d.DecodeCommand()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestDecoder_DecodeCommand_errors(t *testing.T) {
+	t.Parallel()
+	limits := resp.Limits{MaxBulkLen: 8, MaxMultiBulkLen: 4}
+	cases := []struct {
+		Name  string
+		Input string
+		Error error
+	}{
+		{Name: "not array", Input: "+PING\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "not bulk string", Input: "*1\r\n:1\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "nil argument", Input: "*1\r\n$-1\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "no crlf", Input: "*1\r\n$4\nPING\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "bad length", Input: "*1\r\n$x\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "bulk length", Input: "*1\r\n$9\r\n", Error: resp.ErrLimitExceeded},
+		{Name: "multibulk length", Input: "*5\r\n", Error: resp.ErrLimitExceeded},
+		{Name: "long line", Input: "*" + strings.Repeat("1", 100<<10), Error: resp.ErrLimitExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+			d := resp.NewDecoder(strings.NewReader(c.Input+"*1\r\n$4\r\nPING\r\n"), limits)
+			_, err := d.DecodeCommand()
+			require.ErrorIs(t, err, c.Error)
+			// The rest of the stream can't be decoded.
+			_, err = d.DecodeCommand()
+			assert.ErrorIs(t, err, c.Error)
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		t.Parallel()
+		d := resp.NewDecoder(strings.NewReader("*1\r\n$4\r\nPI"), limits)
+		_, err := d.DecodeCommand()
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestDecoder_DecodeCommand_allocs(t *testing.T) {
+	d := resp.NewDecoder(&repeatReader{data: []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")}, resp.Limits{})
+	_, err := d.DecodeCommand()
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, err := d.DecodeCommand(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestParser_ParseCommand(t *testing.T) {
+	t.Parallel()
+	var p resp.Parser
+	p.Limits = resp.Limits{MaxBulkLen: 1024}
+	data := []byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n*2\r\n$3\r\nGET")
+
+	args, n, err := p.ParseCommand(data)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("GET"), []byte("key")}, args)
+	data = data[n:]
+
+	_, n, err = p.ParseCommand(data)
+	require.ErrorIs(t, err, resp.ErrIncomplete)
+	assert.Zero(t, n)
+
+	args, n, err = p.ParseCommand(append(data, "\r\n$4\r\nkey2\r\n"...))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("GET"), []byte("key2")}, args)
+	assert.Equal(t, len(data)+len("\r\n$4\r\nkey2\r\n"), n)
+
+	// Limits are checked before the value is received.
+	_, _, err = p.ParseCommand([]byte("*2\r\n$3\r\nSET\r\n$1025\r\n"))
+	assert.ErrorIs(t, err, resp.ErrLimitExceeded)
+}
+
+// repeatReader repeats data endlessly.
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.data[r.off:])
+		n += copied
+		r.off = (r.off + copied) % len(r.data)
+	}
+	return n, nil
+}
+
+var command = []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+
+// BenchmarkDecoder_DecodeCommand decodes pipelined commands, which doesn't allocate.
+func BenchmarkDecoder_DecodeCommand(b *testing.B) {
+	d := resp.NewDecoder(&repeatReader{data: command}, resp.Limits{})
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := d.DecodeCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser_ParseCommand(b *testing.B) {
+	var p resp.Parser
+	b.ReportAllocs()
+	for range b.N {
+		if _, _, err := p.ParseCommand(command); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkUnmarshal decodes the same commands into values, which don't refer to the reader.
+func BenchmarkUnmarshal(b *testing.B) {
+	r := bufio.NewReader(&repeatReader{data: command})
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := resp.Unmarshal(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	var p resp.Parser
+	b.ReportAllocs()
+	for range b.N {
+		if _, _, err := p.Parse(command); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package resp
+
+import (
+	"errors"
+)
+
+// ErrIncomplete is returned by Parser when data ends before the value does.
+var ErrIncomplete = errors.New("incomplete value")
+
+// Parser parses values from data received in arbitrary chunks without blocking. It remembers
+// elements of arrays it has scanned, so a large array isn't scanned again every time more of it
+// arrives. The zero value is ready to use and applies default limits.
+type Parser struct {
+	Limits  Limits
+	scanner scanner
+	args    [][]byte
+}
+
+// Parse parses the value at the beginning of data and returns it along with its length. If data
+// ends before the value does, Parse returns ErrIncomplete, and data must be passed again along with
+// the data received next. Values don't refer to data, so it may be reused. Any other error resets
+// the parser.
+func (p *Parser) Parse(data []byte) (interface{}, int, error) {
+	n, err := p.scan(data, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, _ := build(data[:n], 0, true)
+	return value, n, nil
+}
+
+// ParseCommand parses the command at the beginning of data the way Parse does. A command is an
+// array of bulk strings. Arguments refer to data and the returned slice is reused, so they are
+// valid until data is modified or the parser is called again.
+func (p *Parser) ParseCommand(data []byte) ([][]byte, int, error) {
+	n, err := p.scan(data, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.args = buildArgs(data[:n], p.args[:0])
+	return p.args, n, nil
+}
+
+func (p *Parser) scan(data []byte, command bool) (int, error) {
+	p.scanner.limits = p.Limits
+	return p.scanner.scan(data, command)
+}
+
+// Reset discards the partially parsed value.
+func (p *Parser) Reset() {
+	p.scanner.reset()
+}
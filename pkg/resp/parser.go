@@ -1,10 +1,12 @@
 package resp
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -12,6 +14,9 @@ import (
 
 var ErrInvalidSyntax = errors.New("invalid syntax")
 
+// maxPreallocated bounds memory allocated by Unmarshal before the value is read.
+const maxPreallocated = 4096
+
 const (
 	prefixSimpleString = '+'
 	prefixError        = '-'
@@ -60,24 +65,26 @@ func unmarshalArray(r ReaderPeeker) ([]interface{}, error) {
 		return nil, err
 	}
 
-	size, err := strconv.ParseInt(string(rawHeader[1:]), 10, 64)
+	size, err := parseSize(rawHeader[1:])
 	if err != nil {
 		return nil, err
 	}
-
-	if size < -1 {
-		return nil, fmt.Errorf("%w: size of an array must not be less than -1", ErrInvalidSyntax)
+	if size > DefaultMaxMultiBulkLen {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ErrLimitExceeded)
 	}
 
 	if size == -1 {
 		return nil, nil
 	}
 
-	value := make([]interface{}, size)
+	// Elements are appended as they are read, so a header doesn't allocate the array at once.
+	value := make([]interface{}, 0, min(size, maxPreallocated))
 	for i := int64(0); i < size; i++ {
-		if value[i], err = unmarshalAny(r); err != nil {
+		item, err := unmarshalAny(r)
+		if err != nil {
 			return nil, err
 		}
+		value = append(value, item)
 	}
 
 	return value, nil
@@ -174,22 +181,21 @@ func unmarshalBulkString(r ReaderPeeker) ([]byte, error) {
 		return nil, fmt.Errorf("%w: bulk string must start with '$'", ErrInvalidSyntax)
 	}
 
-	size, err := strconv.ParseInt(string(rawHeader[1:]), 10, 64)
+	size, err := parseSize(rawHeader[1:])
 	if err != nil {
 		return nil, err
 	}
+	if size > DefaultMaxBulkLen {
+		return nil, fmt.Errorf("%w: invalid bulk length", ErrLimitExceeded)
+	}
 
 	if size == -1 {
 		return nil, nil
 	}
 
-	if size == 0 {
-		return []byte{}, nil
-	}
-
-	rawData := make([]byte, size+2) //nolint:mnd // 2 is length of "\r\n"
-	if n, err := r.Read(rawData); err != nil || n != len(rawData) {
-		return nil, fmt.Errorf("%w: can't read enoguh data", ErrInvalidSyntax)
+	rawData, err := readN(r, int(size)+2) //nolint:mnd // 2 is length of "\r\n"
+	if err != nil {
+		return nil, err
 	}
 
 	if string(rawData[len(rawData)-2:]) != "\r\n" {
@@ -244,16 +250,62 @@ func marshalAny(w io.Writer, value interface{}) error {
 	}
 }
 
+// lineReader is implemented by bufio.Reader, which finds lines in its buffer.
+type lineReader interface {
+	ReadSlice(delim byte) ([]byte, error)
+}
+
+// readUntilCRLF reads a line and returns it without CRLF.
 func readUntilCRLF(r ReaderPeeker) ([]byte, error) {
-	result := make([]byte, 0, 32) //nolint:mnd // random value
-	buf := make([]byte, 1)
-	for {
-		if _, err := r.Read(buf); err != nil {
-			return nil, err
+	var line []byte
+	if lr, ok := r.(lineReader); ok {
+		for {
+			chunk, err := lr.ReadSlice('\n')
+			line = append(line, chunk...)
+			if len(line) > maxLineLen {
+				return nil, fmt.Errorf("%w: too long line", ErrLimitExceeded)
+			}
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, bufio.ErrBufferFull) {
+				return nil, err
+			}
 		}
-		if buf[0] == '\n' && result[len(result)-1] == '\r' {
-			return result[:len(result)-1], nil
+	} else {
+		buf := make([]byte, 1)
+		for len(line) == 0 || line[len(line)-1] != '\n' {
+			if len(line) > maxLineLen {
+				return nil, fmt.Errorf("%w: too long line", ErrLimitExceeded)
+			}
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
+			}
+			line = append(line, buf[0])
+		}
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line must end with crlf", ErrInvalidSyntax)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readN reads exactly n bytes. Memory is allocated as data arrives, so a header declaring a large
+// value doesn't allocate it at once.
+func readN(r io.Reader, n int) ([]byte, error) {
+	data := make([]byte, 0, min(n, maxPreallocated))
+	for len(data) < n {
+		if len(data) == cap(data) {
+			data = slices.Grow(data, min(n-len(data), cap(data)))
+		}
+		read, err := io.ReadFull(r, data[len(data):min(n, cap(data))])
+		data = data[:len(data)+read]
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
 		}
-		result = append(result, buf[0])
 	}
+	return data, nil
 }
@@ -98,3 +98,84 @@ func TestMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_Parse(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		Name     string
+		Input    string
+		Expected interface{}
+		Error    error
+	}{
+		{Name: "simple string", Input: "+abacaba\r\n", Expected: "abacaba"},
+		{Name: "integer", Input: ":-123456\r\n", Expected: int64(-123456)},
+		{Name: "error", Input: "-abacaba\r\n", Expected: errors.New("abacaba")},
+		{Name: "empty_bulk_string", Input: "$0\r\n\r\n", Expected: []byte{}},
+		{Name: "nil_bulk_string", Input: "$-1\r\n", Expected: []byte(nil)},
+		{Name: "bulk_string", Input: "$7\r\na\rb\nc\r\n\r\n", Expected: []byte("a\rb\nc\r\n")},
+		{Name: "nil_array", Input: "*-1\r\n", Expected: []interface{}(nil)},
+		{Name: "empty_array", Input: "*0\r\n", Expected: []interface{}{}},
+		{
+			Name:  "nested_array",
+			Input: "*3\r\n$3\r\nSET\r\n*2\r\n:1\r\n*0\r\n$-1\r\n",
+			Expected: []interface{}{
+				[]byte("SET"),
+				[]interface{}{int64(1), []interface{}{}},
+				[]byte(nil),
+			},
+		},
+		{Name: "unknown_prefix", Input: "PING\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "bad_size", Input: "*x\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "negative_size", Input: "$-2\r\n", Error: resp.ErrInvalidSyntax},
+		{Name: "no_crlf_after_bulk_string", Input: "$1\r\nabc\r\n", Error: resp.ErrInvalidSyntax},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+			// Every split of the input must be parsed the same way.
+			for split := 0; split < len(c.Input); split++ {
+				var p resp.Parser
+				first := []byte(c.Input[:split])
+				value, n, err := p.Parse(first)
+				if err == nil {
+					require.Equal(t, split, n)
+					assert.Equal(t, c.Expected, value)
+					continue
+				}
+				if !errors.Is(err, resp.ErrIncomplete) {
+					require.ErrorIs(t, err, c.Error)
+					continue
+				}
+				value, n2, err := p.Parse(append(first[n:], c.Input[split:]...))
+				if c.Error != nil {
+					require.ErrorIs(t, err, c.Error)
+					continue
+				}
+				require.NoError(t, err, "split at %d", split)
+				assert.Equal(t, len(c.Input), n+n2)
+				assert.Equal(t, c.Expected, value, "split at %d", split)
+			}
+		})
+	}
+}
+
+func TestParser_Parse_pipeline(t *testing.T) {
+	t.Parallel()
+	var p resp.Parser
+	data := []byte("*1\r\n$4\r\nPING\r\n:1\r\n+OK")
+
+	value, n, err := p.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("PING")}, value)
+	data = data[n:]
+
+	value, n, err = p.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	data = data[n:]
+
+	_, n, err = p.Parse(data)
+	require.ErrorIs(t, err, resp.ErrIncomplete)
+	assert.Zero(t, n)
+}
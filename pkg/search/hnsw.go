@@ -0,0 +1,261 @@
+package search
+
+import (
+	"math"
+	"slices"
+
+	"github.com/burenotti/redis_impl/pkg/algo/hashing"
+	"github.com/burenotti/redis_impl/pkg/algo/heap"
+)
+
+const (
+	// hnswSeed seeds levels of nodes. Levels are derived from keys, so a graph depends
+	// only on the order of insertions and is the same on every replica.
+	hnswSeed = 0x686e7377
+	// hnswMaxLevel limits levels of nodes.
+	hnswMaxLevel = 16
+)
+
+type hnswNode struct {
+	key     string
+	vec     []float32
+	deleted bool
+	// links are ids of neighbors on every layer the node belongs to.
+	links [][]int32
+}
+
+type candidate struct {
+	id   int32
+	dist float32
+}
+
+// hnsw is a hierarchical navigable small world graph described by Malkov and Yashunin.
+// Removed nodes are only marked as deleted and still used for navigation, and the graph
+// is rebuilt once half of the nodes are deleted.
+type hnsw struct {
+	dist           distanceFunc
+	m              int
+	efConstruction int
+	levelMult      float64
+
+	nodes    []*hnswNode
+	ids      map[string]int32
+	entry    int32
+	maxLevel int
+	deleted  int
+
+	// visited marks nodes visited by a search with the current epoch.
+	visited []uint32
+	epoch   uint32
+}
+
+func newHNSW(opts VectorOptions) *hnsw {
+	return &hnsw{
+		dist:           distance(opts.Metric),
+		m:              opts.M,
+		efConstruction: opts.EFConstruction,
+		levelMult:      1 / math.Log(float64(opts.M)),
+		ids:            map[string]int32{},
+		entry:          -1,
+	}
+}
+
+// maxLinks returns a maximum amount of links of a node on a layer.
+func (h *hnsw) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.m //nolint:mnd // the bottom layer is denser as the paper suggests
+	}
+	return h.m
+}
+
+// level returns a random level with exponentially decaying probability.
+func (h *hnsw) level(key string) int {
+	u := float64(hashing.Sum64([]byte(key), hnswSeed)>>11) / (1 << 53) //nolint:mnd // 53 bits of mantissa
+	return min(int(-math.Log(1-u)*h.levelMult), hnswMaxLevel)
+}
+
+func (h *hnsw) add(key string, vec []float32) {
+	h.remove(key)
+	id := int32(len(h.nodes))
+	h.nodes = append(h.nodes, &hnswNode{key: key, vec: vec, links: make([][]int32, h.level(key)+1)})
+	h.ids[key] = id
+	h.insert(id)
+}
+
+func (h *hnsw) insert(id int32) {
+	node := h.nodes[id]
+	level := len(node.links) - 1
+	if h.entry < 0 {
+		h.entry, h.maxLevel = id, level
+		return
+	}
+	ep := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.searchLayer(node.vec, ep, 1, l)[0].id
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		found := h.searchLayer(node.vec, ep, h.efConstruction, l)
+		node.links[l] = h.selectNeighbors(found, h.maxLinks(l))
+		for _, n := range node.links[l] {
+			h.link(n, id, l)
+		}
+		ep = found[0].id
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+// link adds a link between nodes and prunes links of the source node when there are too many.
+func (h *hnsw) link(from, to int32, level int) {
+	node := h.nodes[from]
+	node.links[level] = append(node.links[level], to)
+	if len(node.links[level]) <= h.maxLinks(level) {
+		return
+	}
+	found := make([]candidate, len(node.links[level]))
+	for i, n := range node.links[level] {
+		found[i] = candidate{id: n, dist: h.dist(node.vec, h.nodes[n].vec)}
+	}
+	slices.SortFunc(found, compareCandidates)
+	node.links[level] = h.selectNeighbors(found, h.maxLinks(level))
+}
+
+func compareCandidates(a, b candidate) int {
+	switch {
+	case a.dist < b.dist:
+		return -1
+	case a.dist > b.dist:
+		return 1
+	default:
+		return int(a.id - b.id)
+	}
+}
+
+// selectNeighbors selects up to m neighbors from candidates ordered by distance. A candidate
+// that is closer to an already selected neighbor than to the node is skipped, so links
+// spread in different directions. Skipped candidates fill the remaining slots.
+func (h *hnsw) selectNeighbors(found []candidate, m int) []int32 {
+	res := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range found {
+		if len(res) == m {
+			break
+		}
+		vec := h.nodes[c.id].vec
+		diverse := true
+		for _, n := range res {
+			if h.dist(vec, h.nodes[n].vec) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			res = append(res, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(res) == m {
+			break
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
+// searchLayer returns up to ef nodes of a layer closest to the query ordered by distance.
+func (h *hnsw) searchLayer(query []float32, ep int32, ef, level int) []candidate {
+	if len(h.visited) < len(h.nodes) {
+		h.visited = make([]uint32, len(h.nodes)*2) //nolint:mnd // amortized growth
+		h.epoch = 0
+	}
+	h.epoch++
+	if h.epoch == 0 {
+		clear(h.visited)
+		h.epoch++
+	}
+
+	start := candidate{id: ep, dist: h.dist(query, h.nodes[ep].vec)}
+	h.visited[ep] = h.epoch
+	candidates := heap.WithLess(func(a, b candidate) bool { return compareCandidates(a, b) < 0 }, start)
+	// The farthest of found nodes is on top.
+	found := heap.WithLess(func(a, b candidate) bool { return compareCandidates(a, b) > 0 }, start)
+	for candidates.Len() > 0 {
+		c := candidates.MustPop()
+		if worst, _ := found.Peek(); found.Len() >= ef && c.dist > worst.dist {
+			break
+		}
+		for _, n := range h.nodes[c.id].links[level] {
+			if h.visited[n] == h.epoch {
+				continue
+			}
+			h.visited[n] = h.epoch
+			next := candidate{id: n, dist: h.dist(query, h.nodes[n].vec)}
+			if worst, _ := found.Peek(); found.Len() < ef || next.dist < worst.dist {
+				candidates.Push(next)
+				found.Push(next)
+				if found.Len() > ef {
+					found.MustPop()
+				}
+			}
+		}
+	}
+
+	res := make([]candidate, found.Len())
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = found.MustPop()
+	}
+	return res
+}
+
+func (h *hnsw) search(query []float32, k, ef int) []neighbor {
+	if h.entry < 0 || k <= 0 {
+		return nil
+	}
+	ep := h.entry
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.searchLayer(query, ep, 1, l)[0].id
+	}
+	var res []neighbor
+	for _, c := range h.searchLayer(query, ep, max(ef, k), 0) {
+		if node := h.nodes[c.id]; !node.deleted {
+			res = append(res, neighbor{key: node.key, dist: c.dist})
+		}
+	}
+	slices.SortFunc(res, compareNeighbors)
+	if len(res) > k {
+		res = res[:k]
+	}
+	return res
+}
+
+func (h *hnsw) remove(key string) {
+	id, ok := h.ids[key]
+	if !ok {
+		return
+	}
+	delete(h.ids, key)
+	h.nodes[id].deleted = true
+	h.deleted++
+	if h.deleted*2 > len(h.nodes) {
+		h.rebuild()
+	}
+}
+
+// rebuild builds the graph again from nodes that aren't deleted.
+func (h *hnsw) rebuild() {
+	nodes := h.nodes
+	h.nodes = make([]*hnswNode, 0, len(nodes)-h.deleted)
+	h.entry, h.maxLevel, h.deleted = -1, 0, 0
+	for _, node := range nodes {
+		if node.deleted {
+			continue
+		}
+		id := int32(len(h.nodes))
+		h.nodes = append(h.nodes, &hnswNode{key: node.key, vec: node.vec, links: make([][]int32, len(node.links))})
+		h.ids[node.key] = id
+		h.insert(id)
+	}
+}
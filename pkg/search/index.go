@@ -0,0 +1,364 @@
+// Package search implements secondary indexes over hashes with full-text and vector similarity search.
+//
+// TEXT fields are tokenized, stop words are dropped and every token is indexed both as is
+// and stemmed with the Porter stemmer. TAG fields are split into exact-match tags and NUMERIC
+// fields are kept in sorted sets for range queries. VECTOR fields hold little-endian float32
+// blobs searched either exactly (FLAT) or approximately with an HNSW graph.
+// See ParseQuery for the query language.
+package search
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/pkg/algo/set"
+)
+
+var (
+	ErrInvalidDefinition = errors.New("invalid index definition")
+	ErrIndexExists       = errors.New("index already exists")
+	ErrUnknownIndex      = errors.New("unknown index name")
+	ErrUnknownField      = errors.New("unknown field")
+	ErrSyntax            = errors.New("syntax error")
+	ErrUnknownParam      = errors.New("no such parameter")
+)
+
+// stemPrefix marks stemmed terms, so a stem never matches an unrelated verbatim token.
+const stemPrefix = "+"
+
+type document struct {
+	// values are raw values of indexed fields by attribute.
+	values  map[string]string
+	numbers map[string]float64
+	terms   map[string][]string
+	tags    map[string][]string
+	vectors map[string][]float32
+}
+
+type numericEntry struct {
+	value float64
+	key   string
+}
+
+func lessNumeric(a, b numericEntry) bool {
+	if a.value != b.value {
+		return a.value < b.value
+	}
+	return a.key < b.key
+}
+
+type Index struct {
+	def    Definition
+	fields map[string]Field
+	docs   map[string]*document
+	// text maps an attribute to postings, which map a term to its positions in documents.
+	text    map[string]map[string]map[string][]int
+	tags    map[string]map[string]map[string]struct{}
+	numeric map[string]*set.SortedSet[numericEntry]
+	vectors map[string]vectorIndex
+	// failures is amount of hashes that couldn't be indexed.
+	failures int
+}
+
+func NewIndex(def Definition) (*Index, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	def.Prefixes = slices.Clone(def.Prefixes)
+	def.Fields = slices.Clone(def.Fields)
+	idx := &Index{def: def, fields: make(map[string]Field, len(def.Fields))}
+	for _, f := range def.Fields {
+		idx.fields[f.Attribute()] = f
+	}
+	idx.Clear()
+	return idx, nil
+}
+
+func (idx *Index) Definition() Definition {
+	return idx.def
+}
+
+// Clear removes all documents from the index.
+func (idx *Index) Clear() {
+	idx.docs = map[string]*document{}
+	idx.text = map[string]map[string]map[string][]int{}
+	idx.tags = map[string]map[string]map[string]struct{}{}
+	idx.numeric = map[string]*set.SortedSet[numericEntry]{}
+	idx.vectors = map[string]vectorIndex{}
+	idx.failures = 0
+	for attr, f := range idx.fields {
+		switch f.Type {
+		case FieldText:
+			idx.text[attr] = map[string]map[string][]int{}
+		case FieldTag:
+			idx.tags[attr] = map[string]map[string]struct{}{}
+		case FieldNumeric:
+			idx.numeric[attr] = set.WithLess(lessNumeric)
+		case FieldVector:
+			idx.vectors[attr] = newVectorIndex(f.Vector)
+		}
+	}
+}
+
+func (idx *Index) NumDocs() int {
+	return len(idx.docs)
+}
+
+// NumTerms returns amount of distinct terms of TEXT fields.
+func (idx *Index) NumTerms() int {
+	n := 0
+	for _, postings := range idx.text {
+		for term := range postings {
+			if !strings.HasPrefix(term, stemPrefix) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// NumRecords returns amount of (term, document) pairs of TEXT fields.
+func (idx *Index) NumRecords() int {
+	n := 0
+	for _, postings := range idx.text {
+		for term, docs := range postings {
+			if !strings.HasPrefix(term, stemPrefix) {
+				n += len(docs)
+			}
+		}
+	}
+	return n
+}
+
+// Failures returns amount of hashes that weren't indexed because of invalid values.
+func (idx *Index) Failures() int {
+	return idx.failures
+}
+
+// Update indexes a hash, replacing its previous version. Hashes with keys that
+// don't match the definition are ignored.
+func (idx *Index) Update(key string, hash map[string][]byte) {
+	if !idx.def.Matches(key) {
+		return
+	}
+	idx.Remove(key)
+
+	doc := &document{
+		values:  map[string]string{},
+		numbers: map[string]float64{},
+		terms:   map[string][]string{},
+		tags:    map[string][]string{},
+		vectors: map[string][]float32{},
+	}
+	for _, f := range idx.def.Fields {
+		raw, ok := hash[f.Name]
+		if !ok {
+			continue
+		}
+		attr := f.Attribute()
+		doc.values[attr] = string(raw)
+		switch f.Type {
+		case FieldNumeric:
+			v, err := strconv.ParseFloat(string(raw), 64)
+			if err != nil || math.IsNaN(v) {
+				// Like RediSearch, a hash with an invalid value is not indexed at all.
+				idx.failures++
+				return
+			}
+			doc.numbers[attr] = v
+		case FieldVector:
+			vec, ok := DecodeVector(raw, f.Vector.Dim)
+			if !ok {
+				idx.failures++
+				return
+			}
+			doc.vectors[attr] = prepare(f.Vector.Metric, vec)
+		}
+	}
+
+	for attr, value := range doc.values {
+		f := idx.fields[attr]
+		switch f.Type {
+		case FieldText:
+			doc.terms[attr] = idx.addText(attr, key, value, f.NoStem)
+		case FieldTag:
+			tags := splitTags(value, f.Separator, f.CaseSensitive)
+			for _, tag := range tags {
+				docs, ok := idx.tags[attr][tag]
+				if !ok {
+					docs = map[string]struct{}{}
+					idx.tags[attr][tag] = docs
+				}
+				docs[key] = struct{}{}
+			}
+			doc.tags[attr] = tags
+		case FieldNumeric:
+			idx.numeric[attr].Add(numericEntry{value: doc.numbers[attr], key: key})
+		case FieldVector:
+			idx.vectors[attr].add(key, doc.vectors[attr])
+		}
+	}
+	idx.docs[key] = doc
+}
+
+// addText adds tokens of a value to postings and returns distinct terms of the value.
+func (idx *Index) addText(attr, key, value string, noStem bool) []string {
+	postings := idx.text[attr]
+	var terms []string
+	add := func(term string, pos int) {
+		docs, ok := postings[term]
+		if !ok {
+			docs = map[string][]int{}
+			postings[term] = docs
+		}
+		if _, ok := docs[key]; !ok {
+			terms = append(terms, term)
+		}
+		docs[key] = append(docs[key], pos)
+	}
+	for pos, token := range tokenize(value) {
+		add(token, pos)
+		if !noStem {
+			add(stemPrefix+Stem(token), pos)
+		}
+	}
+	return terms
+}
+
+// Remove removes a document from the index.
+func (idx *Index) Remove(key string) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for attr, terms := range doc.terms {
+		postings := idx.text[attr]
+		for _, term := range terms {
+			delete(postings[term], key)
+			if len(postings[term]) == 0 {
+				delete(postings, term)
+			}
+		}
+	}
+	for attr, tags := range doc.tags {
+		for _, tag := range tags {
+			delete(idx.tags[attr][tag], key)
+			if len(idx.tags[attr][tag]) == 0 {
+				delete(idx.tags[attr], tag)
+			}
+		}
+	}
+	for attr, v := range doc.numbers {
+		idx.numeric[attr].Remove(numericEntry{value: v, key: key})
+	}
+	for attr := range doc.vectors {
+		idx.vectors[attr].remove(key)
+	}
+	delete(idx.docs, key)
+}
+
+type SearchOptions struct {
+	// SortBy is an attribute to sort matches by. By default, matches are sorted by score.
+	SortBy     string
+	Descending bool
+	// Verbatim disables stemming of query terms.
+	Verbatim bool
+	// Params are values of query parameters referenced as $name.
+	Params map[string][]byte
+}
+
+// Match is a document matching a query.
+type Match struct {
+	Key string
+	// Score is a relevance of a text query or a distance to the vector of a KNN query.
+	Score float64
+}
+
+// Search returns all documents matching the query in the requested order.
+func (idx *Index) Search(q *Query, opts SearchOptions) ([]Match, error) {
+	var scores docScores
+	var err error
+	// An unfiltered KNN query doesn't need the set of all documents.
+	if _, all := q.root.(allNode); !all || q.knn == nil {
+		ev := &evaluator{idx: idx, verbatim: opts.Verbatim}
+		if scores, err = q.root.eval(ev); err != nil {
+			return nil, err
+		}
+	}
+	if q.knn != nil {
+		if scores, err = idx.knn(q, scores, opts.Params); err != nil {
+			return nil, err
+		}
+	}
+	matches := make([]Match, 0, len(scores))
+	for key, score := range scores {
+		matches = append(matches, Match{Key: key, Score: score})
+	}
+
+	switch opts.SortBy {
+	case "":
+		// Text matches go from the most relevant and KNN matches go from the nearest.
+		sortByScore(matches, q.knn == nil)
+		return matches, nil
+	case q.ScoreField():
+		sortByScore(matches, opts.Descending)
+		return matches, nil
+	}
+
+	f, ok := idx.fields[opts.SortBy]
+	if !ok {
+		return nil, ErrUnknownField
+	}
+	attr := f.Attribute()
+	slices.SortFunc(matches, func(a, b Match) int {
+		c := idx.compareValues(f, idx.docs[a.Key], idx.docs[b.Key])
+		if opts.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	// Documents without the value go last in any order.
+	missing := func(m Match) bool {
+		_, ok := idx.docs[m.Key].values[attr]
+		return !ok
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return cmp.Compare(boolRank(missing(a)), boolRank(missing(b)))
+	})
+	return matches, nil
+}
+
+func sortByScore(matches []Match, descending bool) {
+	slices.SortFunc(matches, func(a, b Match) int {
+		c := cmp.Compare(a.Score, b.Score)
+		if descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+}
+
+func boolRank(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func (idx *Index) compareValues(f Field, a, b *document) int {
+	attr := f.Attribute()
+	if f.Type == FieldNumeric {
+		return cmp.Compare(a.numbers[attr], b.numbers[attr])
+	}
+	return cmp.Compare(a.values[attr], b.values[attr])
+}
@@ -0,0 +1,223 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIndex(t *testing.T) *search.Index {
+	t.Helper()
+	idx, err := search.NewIndex(search.Definition{
+		Name:     "products",
+		Prefixes: []string{"product:"},
+		Fields: []search.Field{
+			{Name: "title", Type: search.FieldText, Weight: 2},
+			{Name: "description", Type: search.FieldText, Weight: 1},
+			{Name: "tags", Type: search.FieldTag, Separator: ','},
+			{Name: "price", Type: search.FieldNumeric, Sortable: true},
+		},
+	})
+	require.NoError(t, err)
+
+	docs := map[string]map[string]string{
+		"product:1": {"title": "Running shoes", "description": "Light shoes for runners", "tags": "sport,Shoes", "price": "100"},
+		"product:2": {"title": "Hiking boots", "description": "Boots for running in the mountains", "tags": "outdoor,shoes", "price": "150"},
+		"product:3": {"title": "Coffee mug", "description": "A mug for hot drinks", "tags": "kitchen", "price": "10"},
+		"product:4": {"title": "Tea cup", "description": "Drink hot tea", "tags": "kitchen,tea", "price": "7.5"},
+		"other:1":   {"title": "Running shoes", "price": "1"},
+	}
+	for key, fields := range docs {
+		hash := map[string][]byte{}
+		for name, value := range fields {
+			hash[name] = []byte(value)
+		}
+		idx.Update(key, hash)
+	}
+	return idx
+}
+
+func find(t *testing.T, idx *search.Index, query string, opts search.SearchOptions) []string {
+	t.Helper()
+	q, err := search.ParseQuery(query)
+	require.NoError(t, err)
+	matches, err := idx.Search(q, opts)
+	require.NoError(t, err)
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = m.Key
+	}
+	return keys
+}
+
+func TestIndex_Search(t *testing.T) {
+	t.Parallel()
+	idx := newTestIndex(t)
+	cases := map[string][]string{
+		"*":                             {"product:1", "product:2", "product:3", "product:4"},
+		"shoes":                         {"product:1"},
+		"run":                           {"product:1", "product:2"},
+		"@title:run":                    {"product:1"},
+		"hot drink":                     {"product:3", "product:4"},
+		"mug | cup":                     {"product:3", "product:4"},
+		"hot -tea":                      {"product:3"},
+		"-(mug | cup | shoes)":          {"product:2"},
+		`"hot drinks"`:                  {"product:3"},
+		`"drinks hot"`:                  {"product:4"},
+		`"tea hot"`:                     {},
+		"coff*":                         {"product:3"},
+		"@tags:{shoes}":                 {"product:1", "product:2"},
+		"@tags:{tea | sport}":           {"product:1", "product:4"},
+		"@price:[10 100]":               {"product:1", "product:3"},
+		"@price:[(10 +inf]":             {"product:1", "product:2"},
+		"@price:[-inf (10]":             {"product:4"},
+		"@tags:{kitchen} @price:[8 20]": {"product:3"},
+		"@title:(mug | boots) | tea":    {"product:2", "product:3", "product:4"},
+		"the":                           {},
+	}
+	for query, expected := range cases {
+		assert.ElementsMatch(t, expected, find(t, idx, query, search.SearchOptions{}), query)
+	}
+}
+
+func TestIndex_Search_scoreAndSort(t *testing.T) {
+	t.Parallel()
+	idx := newTestIndex(t)
+
+	// Title has a greater weight than description.
+	assert.Equal(t, []string{"product:1", "product:2"}, find(t, idx, "running", search.SearchOptions{}))
+	assert.Equal(t, []string{"product:4", "product:3", "product:1", "product:2"},
+		find(t, idx, "*", search.SearchOptions{SortBy: "price"}))
+	assert.Equal(t, []string{"product:2", "product:1", "product:3", "product:4"},
+		find(t, idx, "*", search.SearchOptions{SortBy: "price", Descending: true}))
+
+	// Verbatim disables stemming.
+	assert.Empty(t, find(t, idx, "run", search.SearchOptions{Verbatim: true}))
+	assert.Equal(t, []string{"product:1", "product:2"},
+		find(t, idx, "running", search.SearchOptions{Verbatim: true}))
+}
+
+func TestIndex_Update(t *testing.T) {
+	t.Parallel()
+	idx := newTestIndex(t)
+
+	idx.Update("product:3", map[string][]byte{"title": []byte("Green tea"), "price": []byte("3")})
+	// Product 4 contains the term in both fields.
+	assert.Equal(t, []string{"product:4", "product:3"}, find(t, idx, "tea", search.SearchOptions{}))
+	assert.Empty(t, find(t, idx, "mug", search.SearchOptions{}))
+	assert.Empty(t, find(t, idx, "@tags:{kitchen} @price:[0 5]", search.SearchOptions{}))
+
+	idx.Remove("product:4")
+	assert.Equal(t, []string{"product:3"}, find(t, idx, "tea", search.SearchOptions{}))
+	assert.Equal(t, 3, idx.NumDocs())
+
+	// A hash with an invalid numeric value is not indexed.
+	idx.Update("product:3", map[string][]byte{"title": []byte("Mug"), "price": []byte("cheap")})
+	assert.Empty(t, find(t, idx, "mug", search.SearchOptions{}))
+	assert.Equal(t, 1, idx.Failures())
+
+	idx.Clear()
+	assert.Equal(t, 0, idx.NumDocs())
+	assert.Equal(t, 0, idx.NumTerms())
+}
+
+func TestIndex_Search_errors(t *testing.T) {
+	t.Parallel()
+	idx := newTestIndex(t)
+	for _, query := range []string{"@unknown:foo", "@price:foo", "@title:[1 2]", "@title:{foo}"} {
+		q, err := search.ParseQuery(query)
+		require.NoError(t, err, query)
+		_, err = idx.Search(q, search.SearchOptions{})
+		assert.Error(t, err, query)
+	}
+	q, err := search.ParseQuery("*")
+	require.NoError(t, err)
+	_, err = idx.Search(q, search.SearchOptions{SortBy: "unknown"})
+	assert.ErrorIs(t, err, search.ErrUnknownField)
+}
+
+func TestParseQuery_errors(t *testing.T) {
+	t.Parallel()
+	for _, query := range []string{
+		"", "(foo", "foo)", "@:foo", "@price:[1]", "@price:[a b]", "@tags:{foo", "@tags:{}",
+		`"foo`, "f*", "@title:@body:foo", "a | ",
+	} {
+		_, err := search.ParseQuery(query)
+		assert.ErrorIs(t, err, search.ErrSyntax, query)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	r := search.NewRegistry()
+	def := search.Definition{
+		Name:     "idx",
+		Prefixes: []string{"user:"},
+		Fields:   []search.Field{{Name: "name", Type: search.FieldText, Weight: 1}},
+	}
+	idx, err := r.Create(def)
+	require.NoError(t, err)
+	_, err = r.Create(def)
+	assert.ErrorIs(t, err, search.ErrIndexExists)
+
+	r.Update("user:1", map[string][]byte{"name": []byte("Alice")})
+	r.Update("admin:1", map[string][]byte{"name": []byte("Alice")})
+	assert.Equal(t, 1, idx.NumDocs())
+	r.Remove("user:1")
+	assert.Equal(t, 0, idx.NumDocs())
+
+	assert.Equal(t, []string{"idx"}, r.Names())
+	_, err = r.Drop("idx")
+	require.NoError(t, err)
+	_, err = r.Get("idx")
+	assert.ErrorIs(t, err, search.ErrUnknownIndex)
+}
+
+func TestSuggestions(t *testing.T) {
+	t.Parallel()
+	s := search.NewSuggestions()
+	s.Add("hello world", 1, false, []byte("greeting"))
+	s.Add("help", 3, false, nil)
+	s.Add("helicopter", 2, false, nil)
+	s.Add("yellow", 5, false, nil)
+	s.Add("hello world", 4, true, nil)
+	assert.Equal(t, 4, s.Len())
+
+	assert.Equal(t, []search.Suggestion{
+		{String: "hello world", Score: 5, Payload: []byte("greeting")},
+		{String: "help", Score: 3},
+	}, s.Get("hel", false, 2))
+	assert.Equal(t, []search.Suggestion{
+		{String: "hello world", Score: 5, Payload: []byte("greeting")},
+		{String: "yellow", Score: 5},
+		{String: "help", Score: 3},
+		{String: "helicopter", Score: 2},
+	}, s.Get("hell", true, search.DefaultMaxSuggestions))
+	assert.Empty(t, s.Get("x", false, search.DefaultMaxSuggestions))
+
+	assert.True(t, s.Del("help"))
+	assert.False(t, s.Del("help"))
+	assert.Equal(t, 3, s.Len())
+}
+
+func TestSuggestions_case(t *testing.T) {
+	t.Parallel()
+	s := search.NewSuggestions()
+	s.Add("Wörld", 1, false, nil)
+	s.Add("WORD", 2, false, nil)
+	s.Add("word", 1, true, nil)
+	assert.Equal(t, 2, s.Len())
+
+	world := search.Suggestion{String: "Wörld", Score: 1}
+	word := search.Suggestion{String: "WORD", Score: 3}
+	assert.Equal(t, []search.Suggestion{world}, s.Get("wö", false, search.DefaultMaxSuggestions))
+	assert.Equal(t, []search.Suggestion{world}, s.Get("WÖR", false, search.DefaultMaxSuggestions))
+	assert.Equal(t, []search.Suggestion{word}, s.Get("Wo", false, search.DefaultMaxSuggestions))
+	assert.Equal(t, []search.Suggestion{word, world}, s.Get("wO", true, search.DefaultMaxSuggestions))
+	assert.Equal(t, []search.Suggestion{world}, s.Get("XÖ", true, search.DefaultMaxSuggestions))
+
+	assert.True(t, s.Del("WÖRLD"))
+	assert.Equal(t, 1, s.Len())
+}
@@ -0,0 +1,710 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query.
+type Query struct {
+	root node
+	knn  *knnClause
+}
+
+// knnClause selects k nearest neighbors of a vector among documents matching the query.
+// K and EF_RUNTIME are either numbers or parameters.
+type knnClause struct {
+	k         string
+	field     string
+	param     string
+	efRuntime string
+	alias     string
+}
+
+// ScoreField returns the name of the field holding distances of a KNN query, or an empty
+// string if the query has no KNN clause.
+func (q *Query) ScoreField() string {
+	switch {
+	case q.knn == nil:
+		return ""
+	case q.knn.alias != "":
+		return q.knn.alias
+	default:
+		return "__" + q.knn.field + "_score"
+	}
+}
+
+// ParseQuery parses a query. The syntax is a subset of the RediSearch query language:
+//
+//	hello world         documents containing both terms in any TEXT field
+//	hello | world       documents containing any of the terms
+//	-hello              documents without the term
+//	(a | b) c           grouping
+//	"hello world"       exact phrase
+//	hel*                terms starting with a prefix
+//	@title:hello        a term in the given field; @title:(a | b) applies to the whole group
+//	@price:[10 (20]     numeric range, "(" excludes a bound, -inf and +inf are allowed
+//	@tags:{red | blue}  documents with any of the tags
+//	*                   all documents
+//
+// Intersection binds tighter than union, and negation binds tighter than intersection.
+// A query may end with a KNN clause selecting the nearest neighbors of a vector among
+// documents matching the rest of the query:
+//
+//	*=>[KNN 10 @embedding $vec]
+//	@tags:{red}=>[KNN $k @embedding $vec EF_RUNTIME 50 AS distance]
+//
+// The vector is always a parameter, K and EF_RUNTIME may be parameters as well.
+func ParseQuery(query string) (*Query, error) {
+	input := []rune(query)
+	// The filter parser stops at the KNN clause, which is parsed separately.
+	end := len(input)
+	if i := strings.LastIndex(query, "=>"); i >= 0 {
+		end = utf8.RuneCountInString(query[:i])
+	}
+	p := &parser{input: input[:end]}
+	root, err := p.parseUnion("")
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	q := &Query{root: root}
+	if end < len(input) {
+		p.input, p.pos = input, end+2 //nolint:mnd // length of "=>"
+		if q.knn, err = p.parseKNN(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrSyntax, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) expect(r rune) error {
+	p.skipSpaces()
+	if p.peek() != r {
+		return p.errorf("expected %q", r)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) parseUnion(field string) (node, error) {
+	first, err := p.parseIntersection(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []node{first}
+	for {
+		p.skipSpaces()
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+		next, err := p.parseIntersection(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &unionNode{children: children}, nil
+}
+
+func (p *parser) parseIntersection(field string) (node, error) {
+	var children []node
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	switch len(children) {
+	case 0:
+		return nil, p.errorf("expected an expression")
+	case 1:
+		return children[0], nil
+	default:
+		return &intersectionNode{children: children}, nil
+	}
+}
+
+func (p *parser) parseUnary(field string) (node, error) {
+	p.skipSpaces()
+	if p.peek() == '-' {
+		p.pos++
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	return p.parseAtom(field)
+}
+
+func (p *parser) parseAtom(field string) (node, error) {
+	switch p.peek() {
+	case '(':
+		p.pos++
+		n, err := p.parseUnion(field)
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(')')
+	case '@':
+		if field != "" {
+			return nil, p.errorf("nested field modifier")
+		}
+		p.pos++
+		return p.parseField()
+	case '"':
+		p.pos++
+		return p.parsePhrase(field)
+	case '*':
+		if field != "" {
+			return nil, p.errorf("unexpected %q", '*')
+		}
+		p.pos++
+		return allNode{}, nil
+	default:
+		return p.parseTerm(field)
+	}
+}
+
+func (p *parser) parseField() (node, error) {
+	start := p.pos
+	for !p.eof() && (unicode.IsLetter(p.peek()) || unicode.IsDigit(p.peek()) || p.peek() == '_') {
+		p.pos++
+	}
+	field := string(p.input[start:p.pos])
+	if field == "" {
+		return nil, p.errorf("expected a field name")
+	}
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	switch p.peek() {
+	case '[':
+		p.pos++
+		return p.parseRange(field)
+	case '{':
+		p.pos++
+		return p.parseTags(field)
+	default:
+		return p.parseUnary(field)
+	}
+}
+
+// isTermRune reports whether r may be a part of an unescaped term.
+func isTermRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("()|@{}[]\"*", r)
+}
+
+// readWord reads a term keeping escape sequences, so they are handled by the tokenizer.
+func (p *parser) readWord() string {
+	start := p.pos
+	for !p.eof() {
+		if p.peek() == '\\' && p.pos+1 < len(p.input) {
+			p.pos += 2
+			continue
+		}
+		if !isTermRune(p.peek()) {
+			break
+		}
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *parser) parseTerm(field string) (node, error) {
+	word := p.readWord()
+	if word == "" {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	tokens := tokenize(word)
+	if p.peek() == '*' {
+		p.pos++
+		if len(tokens) != 1 || len([]rune(tokens[0])) < 2 { //nolint:mnd // as in RediSearch
+			return nil, p.errorf("prefix must contain at least two letters")
+		}
+		return &prefixNode{field: field, prefix: tokens[0]}, nil
+	}
+	switch len(tokens) {
+	case 0:
+		// Stop words don't restrict results.
+		return ignoredNode{}, nil
+	case 1:
+		return &termNode{field: field, token: tokens[0]}, nil
+	default:
+		children := make([]node, len(tokens))
+		for i, token := range tokens {
+			children[i] = &termNode{field: field, token: token}
+		}
+		return &intersectionNode{children: children}, nil
+	}
+}
+
+func (p *parser) parsePhrase(field string) (node, error) {
+	start := p.pos
+	for !p.eof() && p.peek() != '"' {
+		if p.peek() == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return nil, p.errorf("unterminated phrase")
+	}
+	tokens := tokenize(string(p.input[start:p.pos]))
+	p.pos++
+	if len(tokens) == 0 {
+		return ignoredNode{}, nil
+	}
+	return &phraseNode{field: field, tokens: tokens}, nil
+}
+
+func (p *parser) parseRange(field string) (node, error) {
+	n := &rangeNode{field: field}
+	var err error
+	if n.min, n.minExclusive, err = p.parseBound(); err != nil {
+		return nil, err
+	}
+	if n.max, n.maxExclusive, err = p.parseBound(); err != nil {
+		return nil, err
+	}
+	return n, p.expect(']')
+}
+
+func (p *parser) parseBound() (float64, bool, error) {
+	p.skipSpaces()
+	exclusive := p.peek() == '('
+	if exclusive {
+		p.pos++
+	}
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.peek()) && p.peek() != ']' {
+		p.pos++
+	}
+	value := string(p.input[start:p.pos])
+	switch strings.ToLower(value) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "inf", "+inf":
+		return math.Inf(1), exclusive, nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, false, p.errorf("invalid numeric bound %q", value)
+	}
+	return v, exclusive, nil
+}
+
+func (p *parser) parseTags(field string) (node, error) {
+	n := &tagNode{field: field}
+	var tag strings.Builder
+	add := func() error {
+		value := strings.TrimSpace(tag.String())
+		if value == "" {
+			return p.errorf("empty tag")
+		}
+		n.tags = append(n.tags, value)
+		tag.Reset()
+		return nil
+	}
+	for {
+		if p.eof() {
+			return nil, p.errorf("unterminated tag set")
+		}
+		r := p.peek()
+		p.pos++
+		switch {
+		case r == '\\' && !p.eof():
+			tag.WriteRune(p.peek())
+			p.pos++
+		case r == '|':
+			if err := add(); err != nil {
+				return nil, err
+			}
+		case r == '}':
+			return n, add()
+		default:
+			tag.WriteRune(r)
+		}
+	}
+}
+
+func (p *parser) parseKNN() (*knnClause, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	var words []string
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.errorf("unterminated KNN clause")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			break
+		}
+		start := p.pos
+		for !p.eof() && !unicode.IsSpace(p.peek()) && p.peek() != ']' {
+			p.pos++
+		}
+		words = append(words, string(p.input[start:p.pos]))
+	}
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+
+	if len(words) < 4 || !strings.EqualFold(words[0], "KNN") { //nolint:mnd // KNN k @field $vec
+		return nil, p.errorf("expected KNN k @field $param")
+	}
+	c := &knnClause{k: words[1]}
+	if len(words[2]) < 2 || words[2][0] != '@' { //nolint:mnd // "@" and a name
+		return nil, p.errorf("expected a vector field, got %q", words[2])
+	}
+	c.field = words[2][1:]
+	if len(words[3]) < 2 || words[3][0] != '$' { //nolint:mnd // "$" and a name
+		return nil, p.errorf("expected a vector parameter, got %q", words[3])
+	}
+	c.param = words[3][1:]
+	for i := 4; i < len(words); i += 2 {
+		if i+1 >= len(words) {
+			return nil, p.errorf("need value for %s", words[i])
+		}
+		switch strings.ToUpper(words[i]) {
+		case "EF_RUNTIME":
+			c.efRuntime = words[i+1]
+		case "AS":
+			c.alias = words[i+1]
+		default:
+			return nil, p.errorf("unknown KNN option %s", words[i])
+		}
+	}
+	for _, value := range []string{c.k, c.efRuntime} {
+		if value == "" || strings.HasPrefix(value, "$") {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return nil, p.errorf("invalid number %q", value)
+		}
+	}
+	return c, nil
+}
+
+// docScores maps keys of matching documents to their scores. A nil map means that
+// a node doesn't restrict results, e.g. a stop word.
+type docScores map[string]float64
+
+type node interface {
+	eval(ev *evaluator) (docScores, error)
+}
+
+type evaluator struct {
+	idx      *Index
+	verbatim bool
+}
+
+func (ev *evaluator) field(attr string, typ FieldType) (Field, error) {
+	f, ok := ev.idx.fields[attr]
+	if !ok {
+		return Field{}, fmt.Errorf("%w: %s", ErrUnknownField, attr)
+	}
+	if f.Type != typ {
+		return Field{}, fmt.Errorf("%w: %s is not a %s field", ErrSyntax, attr, typ)
+	}
+	return f, nil
+}
+
+// textFields returns the TEXT field with the given attribute or all TEXT fields.
+func (ev *evaluator) textFields(attr string) ([]Field, error) {
+	if attr != "" {
+		f, err := ev.field(attr, FieldText)
+		return []Field{f}, err
+	}
+	var res []Field
+	for _, f := range ev.idx.def.Fields {
+		if f.Type == FieldText {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+// term returns an indexed term matching a query token.
+func (ev *evaluator) term(f Field, token string) string {
+	if ev.verbatim || f.NoStem {
+		return token
+	}
+	return stemPrefix + Stem(token)
+}
+
+// idf returns inverse document frequency of a term found in df documents.
+func (ev *evaluator) idf(df int) float64 {
+	return math.Log1p(float64(len(ev.idx.docs)) / float64(max(df, 1)))
+}
+
+func (ev *evaluator) all() docScores {
+	res := make(docScores, len(ev.idx.docs))
+	for key := range ev.idx.docs {
+		res[key] = 0
+	}
+	return res
+}
+
+type allNode struct{}
+
+func (allNode) eval(ev *evaluator) (docScores, error) {
+	return ev.all(), nil
+}
+
+type ignoredNode struct{}
+
+func (ignoredNode) eval(*evaluator) (docScores, error) {
+	return nil, nil
+}
+
+type intersectionNode struct {
+	children []node
+}
+
+func (n *intersectionNode) eval(ev *evaluator) (docScores, error) {
+	var res docScores
+	for _, child := range n.children {
+		scores, err := child.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		if scores == nil {
+			continue
+		}
+		if res == nil {
+			res = scores
+			continue
+		}
+		for key, score := range res {
+			if other, ok := scores[key]; ok {
+				res[key] = score + other
+			} else {
+				delete(res, key)
+			}
+		}
+	}
+	return res, nil
+}
+
+type unionNode struct {
+	children []node
+}
+
+func (n *unionNode) eval(ev *evaluator) (docScores, error) {
+	var res docScores
+	for _, child := range n.children {
+		scores, err := child.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		if scores == nil {
+			continue
+		}
+		if res == nil {
+			res = docScores{}
+		}
+		for key, score := range scores {
+			res[key] += score
+		}
+	}
+	return res, nil
+}
+
+type notNode struct {
+	child node
+}
+
+func (n *notNode) eval(ev *evaluator) (docScores, error) {
+	excluded, err := n.child.eval(ev)
+	if err != nil || excluded == nil {
+		return nil, err
+	}
+	res := ev.all()
+	for key := range excluded {
+		delete(res, key)
+	}
+	return res, nil
+}
+
+type termNode struct {
+	field string
+	token string
+}
+
+func (n *termNode) eval(ev *evaluator) (docScores, error) {
+	fields, err := ev.textFields(n.field)
+	if err != nil {
+		return nil, err
+	}
+	res := docScores{}
+	for _, f := range fields {
+		postings := ev.idx.text[f.Attribute()][ev.term(f, n.token)]
+		idf := ev.idf(len(postings))
+		for key, positions := range postings {
+			res[key] += f.Weight * float64(len(positions)) * idf
+		}
+	}
+	return res, nil
+}
+
+type prefixNode struct {
+	field  string
+	prefix string
+}
+
+func (n *prefixNode) eval(ev *evaluator) (docScores, error) {
+	fields, err := ev.textFields(n.field)
+	if err != nil {
+		return nil, err
+	}
+	res := docScores{}
+	for _, f := range fields {
+		for term, postings := range ev.idx.text[f.Attribute()] {
+			if strings.HasPrefix(term, stemPrefix) || !strings.HasPrefix(term, n.prefix) {
+				continue
+			}
+			idf := ev.idf(len(postings))
+			for key, positions := range postings {
+				res[key] += f.Weight * float64(len(positions)) * idf
+			}
+		}
+	}
+	return res, nil
+}
+
+type phraseNode struct {
+	field  string
+	tokens []string
+}
+
+func (n *phraseNode) eval(ev *evaluator) (docScores, error) {
+	fields, err := ev.textFields(n.field)
+	if err != nil {
+		return nil, err
+	}
+	res := docScores{}
+	for _, f := range fields {
+		postings := make([]map[string][]int, len(n.tokens))
+		for i, token := range n.tokens {
+			postings[i] = ev.idx.text[f.Attribute()][ev.term(f, token)]
+		}
+		idf := ev.idf(len(postings[0]))
+		for key, positions := range postings[0] {
+			occurrences := 0
+			for _, start := range positions {
+				if phraseAt(postings, key, start) {
+					occurrences++
+				}
+			}
+			if occurrences > 0 {
+				res[key] += f.Weight * float64(occurrences) * idf
+			}
+		}
+	}
+	return res, nil
+}
+
+// phraseAt reports whether the i-th term of a phrase is found in a document at position start+i.
+func phraseAt(postings []map[string][]int, key string, start int) bool {
+	for i := 1; i < len(postings); i++ {
+		if _, ok := slices.BinarySearch(postings[i][key], start+i); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type rangeNode struct {
+	field        string
+	min, max     float64
+	minExclusive bool
+	maxExclusive bool
+}
+
+func (n *rangeNode) eval(ev *evaluator) (docScores, error) {
+	if _, err := ev.field(n.field, FieldNumeric); err != nil {
+		return nil, err
+	}
+	res := docScores{}
+	ev.idx.numeric[n.field].AscendFrom(numericEntry{value: n.min}, func(e numericEntry) bool {
+		if e.value > n.max || n.maxExclusive && e.value == n.max {
+			return false
+		}
+		if !n.minExclusive || e.value != n.min {
+			res[e.key] = 0
+		}
+		return true
+	})
+	return res, nil
+}
+
+type tagNode struct {
+	field string
+	tags  []string
+}
+
+func (n *tagNode) eval(ev *evaluator) (docScores, error) {
+	f, err := ev.field(n.field, FieldTag)
+	if err != nil {
+		return nil, err
+	}
+	res := docScores{}
+	for _, tag := range n.tags {
+		if !f.CaseSensitive {
+			tag = strings.ToLower(tag)
+		}
+		for key := range ev.idx.tags[n.field][tag] {
+			res[key] = 0
+		}
+	}
+	return res, nil
+}
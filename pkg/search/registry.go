@@ -0,0 +1,88 @@
+package search
+
+import (
+	"maps"
+	"slices"
+)
+
+// Registry holds indexes of a keyspace and keeps them up to date with its hashes.
+type Registry struct {
+	indexes map[string]*Index
+}
+
+func NewRegistry() *Registry {
+	return &Registry{indexes: map[string]*Index{}}
+}
+
+// Create creates an empty index. The caller is responsible for indexing existing hashes.
+func (r *Registry) Create(def Definition) (*Index, error) {
+	if _, ok := r.indexes[def.Name]; ok {
+		return nil, ErrIndexExists
+	}
+	idx, err := NewIndex(def)
+	if err != nil {
+		return nil, err
+	}
+	r.indexes[def.Name] = idx
+	return idx, nil
+}
+
+func (r *Registry) Get(name string) (*Index, error) {
+	idx, ok := r.indexes[name]
+	if !ok {
+		return nil, ErrUnknownIndex
+	}
+	return idx, nil
+}
+
+// Drop removes an index and returns it.
+func (r *Registry) Drop(name string) (*Index, error) {
+	idx, ok := r.indexes[name]
+	if !ok {
+		return nil, ErrUnknownIndex
+	}
+	delete(r.indexes, name)
+	return idx, nil
+}
+
+// Names returns sorted names of all indexes.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.indexes))
+	for name := range r.indexes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Snapshot returns registered indexes, so they can be restored with Restore.
+// Documents of the indexes aren't copied.
+func (r *Registry) Snapshot() map[string]*Index {
+	return maps.Clone(r.indexes)
+}
+
+// Restore replaces registered indexes with a snapshot.
+func (r *Registry) Restore(snapshot map[string]*Index) {
+	r.indexes = maps.Clone(snapshot)
+}
+
+// Update indexes a hash stored at key by all matching indexes.
+func (r *Registry) Update(key string, hash map[string][]byte) {
+	for _, idx := range r.indexes {
+		idx.Update(key, hash)
+	}
+}
+
+// Remove removes a key from all indexes.
+func (r *Registry) Remove(key string) {
+	for _, idx := range r.indexes {
+		idx.Remove(key)
+	}
+}
+
+// Clear removes all documents from all indexes. Definitions are kept.
+func (r *Registry) Clear() {
+	for _, idx := range r.indexes {
+		idx.Clear()
+	}
+}
@@ -0,0 +1,169 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	FieldText    FieldType = "TEXT"
+	FieldTag     FieldType = "TAG"
+	FieldNumeric FieldType = "NUMERIC"
+	FieldVector  FieldType = "VECTOR"
+)
+
+const (
+	DefaultWeight       = 1.0
+	DefaultTagSeparator = ','
+)
+
+type VectorAlgorithm string
+
+const (
+	// VectorFlat is an exact brute-force search.
+	VectorFlat VectorAlgorithm = "FLAT"
+	// VectorHNSW is an approximate search over a hierarchical navigable small world graph.
+	VectorHNSW VectorAlgorithm = "HNSW"
+)
+
+type DistanceMetric string
+
+const (
+	// MetricL2 is a squared Euclidean distance.
+	MetricL2 DistanceMetric = "L2"
+	// MetricIP is an inner product distance, 1 - a·b.
+	MetricIP DistanceMetric = "IP"
+	// MetricCosine is a cosine distance, 1 - cos(a, b).
+	MetricCosine DistanceMetric = "COSINE"
+)
+
+// Defaults of HNSW parameters.
+const (
+	DefaultM              = 16
+	DefaultEFConstruction = 200
+	DefaultEFRuntime      = 10
+)
+
+// VectorOptions describe a VECTOR field. Vectors are stored in hashes as little-endian float32 blobs.
+type VectorOptions struct {
+	Algorithm VectorAlgorithm
+	Dim       int
+	Metric    DistanceMetric
+	// M is a maximum amount of links of a node on upper layers of an HNSW graph.
+	// Nodes of the bottom layer have twice as much.
+	M int
+	// EFConstruction is a size of the candidate list used when a node is added to an HNSW graph.
+	EFConstruction int
+	// EFRuntime is a default size of the candidate list used by KNN queries.
+	EFRuntime int
+}
+
+func (o VectorOptions) validate() error {
+	switch o.Algorithm {
+	case VectorFlat, VectorHNSW:
+	default:
+		return fmt.Errorf("unknown algorithm %s", o.Algorithm)
+	}
+	switch o.Metric {
+	case MetricL2, MetricIP, MetricCosine:
+	default:
+		return fmt.Errorf("unknown distance metric %s", o.Metric)
+	}
+	if o.Dim <= 0 {
+		return errors.New("dimension must be positive")
+	}
+	if o.Algorithm == VectorHNSW && (o.M < 2 || o.EFConstruction <= 0 || o.EFRuntime <= 0) { //nolint:mnd // a graph needs links
+		return errors.New("M must be at least 2, EF_CONSTRUCTION and EF_RUNTIME must be positive")
+	}
+	return nil
+}
+
+// Field describes how a hash field is indexed.
+type Field struct {
+	// Name is a name of the hash field.
+	Name string
+	// Alias is a name of the attribute used in queries. Defaults to Name.
+	Alias string
+	Type  FieldType
+	// Weight multiplies scores of TEXT matches.
+	Weight float64
+	// NoStem disables stemming of a TEXT field.
+	NoStem bool
+	// Separator splits a TAG field value into tags.
+	Separator byte
+	// CaseSensitive disables lowercasing of TAG values.
+	CaseSensitive bool
+	Sortable      bool
+	// Vector describes a VECTOR field.
+	Vector VectorOptions
+}
+
+// Attribute returns the name of the field used in queries.
+func (f Field) Attribute() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Definition describes an index. Hashes with keys starting with one of Prefixes are
+// indexed. An index without prefixes indexes all hashes.
+type Definition struct {
+	Name     string
+	Prefixes []string
+	Fields   []Field
+}
+
+func (d Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("%w: index name must not be empty", ErrInvalidDefinition)
+	}
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("%w: schema must contain at least one field", ErrInvalidDefinition)
+	}
+	seen := make(map[string]struct{}, len(d.Fields))
+	for _, f := range d.Fields {
+		attr := f.Attribute()
+		if f.Name == "" {
+			return fmt.Errorf("%w: field name must not be empty", ErrInvalidDefinition)
+		}
+		if _, ok := seen[attr]; ok {
+			return fmt.Errorf("%w: duplicate field %s", ErrInvalidDefinition, attr)
+		}
+		seen[attr] = struct{}{}
+		switch f.Type {
+		case FieldText:
+			if f.Weight <= 0 {
+				return fmt.Errorf("%w: weight of %s must be positive", ErrInvalidDefinition, attr)
+			}
+		case FieldTag:
+			if f.Separator == 0 || strings.ContainsRune(" \t\r\n", rune(f.Separator)) {
+				return fmt.Errorf("%w: invalid separator of %s", ErrInvalidDefinition, attr)
+			}
+		case FieldNumeric:
+		case FieldVector:
+			if err := f.Vector.validate(); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrInvalidDefinition, attr, err)
+			}
+		default:
+			return fmt.Errorf("%w: unknown type %s of %s", ErrInvalidDefinition, f.Type, attr)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a key is indexed by the definition.
+func (d Definition) Matches(key string) bool {
+	if len(d.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range d.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
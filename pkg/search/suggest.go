@@ -0,0 +1,113 @@
+package search
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/burenotti/redis_impl/pkg/algo/heap"
+	"github.com/burenotti/redis_impl/pkg/algo/trie"
+)
+
+// DefaultMaxSuggestions is amount of suggestions returned by default.
+const DefaultMaxSuggestions = 5
+
+// fuzzyDistance is a maximal Levenshtein distance of fuzzy suggestions.
+const fuzzyDistance = 1
+
+type Suggestion struct {
+	String  string
+	Score   float64
+	Payload []byte
+}
+
+// compareSuggestions orders suggestions from the highest score.
+func compareSuggestions(a, b Suggestion) int {
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.String, b.String)
+}
+
+// Suggestions is an autocomplete dictionary of scored strings. Strings are matched regardless of
+// their case, so strings differing only in case are the same suggestion.
+type Suggestions struct {
+	// trie is keyed by lowercase strings.
+	trie *trie.Trie[*Suggestion]
+}
+
+func NewSuggestions() *Suggestions {
+	return &Suggestions{trie: trie.New[*Suggestion]()}
+}
+
+func (s *Suggestions) Len() int {
+	return s.trie.Len()
+}
+
+// Add adds a suggestion or replaces the score of an existing one. With incr the score
+// is added to the existing one. A nil payload keeps the existing payload.
+func (s *Suggestions) Add(str string, score float64, incr bool, payload []byte) {
+	key := strings.ToLower(str)
+	if sug, ok := s.trie.Get(key); ok {
+		if incr {
+			score += sug.Score
+		}
+		sug.Score = score
+		if payload != nil {
+			sug.Payload = payload
+		}
+		return
+	}
+	s.trie.Put(key, &Suggestion{String: str, Score: score, Payload: payload})
+}
+
+// Clone returns a deep copy of the dictionary.
+func (s *Suggestions) Clone() *Suggestions {
+	c := NewSuggestions()
+	s.trie.WalkPrefix("", func(key string, sug *Suggestion) bool {
+		copied := *sug
+		copied.Payload = slices.Clone(sug.Payload)
+		c.trie.Put(key, &copied)
+		return true
+	})
+	return c
+}
+
+// Del removes a suggestion and reports whether it existed.
+func (s *Suggestions) Del(str string) bool {
+	return s.trie.Delete(strings.ToLower(str))
+}
+
+// Get returns at most limit suggestions starting with prefix ordered from the highest score.
+// Fuzzy suggestions may start with a string one edit away from prefix.
+func (s *Suggestions) Get(prefix string, fuzzy bool, limit int) []Suggestion {
+	if limit <= 0 {
+		return nil
+	}
+	// The worst of the best suggestions is on top of the heap.
+	best := heap.WithLess(func(a, b Suggestion) bool {
+		return compareSuggestions(a, b) > 0
+	})
+	collect := func(_ string, sug *Suggestion) bool {
+		if best.Len() == limit {
+			if worst, _ := best.Peek(); compareSuggestions(*sug, worst) >= 0 {
+				return true
+			}
+			best.MustPop()
+		}
+		best.Push(*sug)
+		return true
+	}
+	prefix = strings.ToLower(prefix)
+	if fuzzy {
+		s.trie.WalkFuzzyPrefix(prefix, fuzzyDistance, collect)
+	} else {
+		s.trie.WalkPrefix(prefix, collect)
+	}
+
+	res := make([]Suggestion, best.Len())
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = best.MustPop()
+	}
+	return res
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// separators split text into tokens in addition to whitespace. Escaped separators
+// are a part of a token.
+const separators = ",.<>{}[]\"':;!@#$%^&*()-+=~|/\\"
+
+// stopWords are common words, which are not indexed.
+var stopWords = map[string]struct{}{
+	"a": {}, "is": {}, "the": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {},
+	"but": {}, "by": {}, "for": {}, "if": {}, "in": {}, "into": {}, "it": {}, "no": {}, "not": {},
+	"of": {}, "on": {}, "or": {}, "such": {}, "that": {}, "their": {}, "then": {}, "there": {},
+	"these": {}, "they": {}, "this": {}, "to": {}, "was": {}, "will": {}, "with": {},
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(separators, r)
+}
+
+// tokenize splits text into lowercase tokens. Stop words are dropped.
+func tokenize(text string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		escaped bool
+	)
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		token := strings.ToLower(current.String())
+		current.Reset()
+		if _, ok := stopWords[token]; !ok {
+			tokens = append(tokens, token)
+		}
+	}
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+			current.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case isSeparator(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// splitTags splits a tag field value by separator. Tags are trimmed and, unless
+// caseSensitive is set, lowercased.
+func splitTags(value string, separator byte, caseSensitive bool) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, string(separator)) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !caseSensitive {
+			tag = strings.ToLower(tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,232 @@
+package search
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/burenotti/redis_impl/pkg/algo/heap"
+)
+
+const float32Size = 4
+
+// DecodeVector decodes a little-endian float32 blob of dim components.
+func DecodeVector(raw []byte, dim int) ([]float32, bool) {
+	if len(raw) != dim*float32Size {
+		return nil, false
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*float32Size:]))
+		if math.IsNaN(float64(vec[i])) || math.IsInf(float64(vec[i]), 0) {
+			return nil, false
+		}
+	}
+	return vec, true
+}
+
+// EncodeVector encodes a vector as a little-endian float32 blob.
+func EncodeVector(vec []float32) []byte {
+	raw := make([]byte, len(vec)*float32Size)
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(raw[i*float32Size:], math.Float32bits(v))
+	}
+	return raw
+}
+
+type distanceFunc func(a, b []float32) float32
+
+func l2(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+func innerProduct(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return 1 - sum
+}
+
+// distance returns a distance function of a metric. Cosine distance is an inner product
+// distance of vectors normalized by prepare.
+func distance(metric DistanceMetric) distanceFunc {
+	if metric == MetricL2 {
+		return l2
+	}
+	return innerProduct
+}
+
+// prepare returns a vector as it is stored in an index.
+func prepare(metric DistanceMetric, vec []float32) []float32 {
+	if metric != MetricCosine {
+		return vec
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	res := make([]float32, len(vec))
+	for i, v := range vec {
+		res[i] = float32(float64(v) / norm)
+	}
+	return res
+}
+
+type neighbor struct {
+	key  string
+	dist float32
+}
+
+func compareNeighbors(a, b neighbor) int {
+	if c := cmp.Compare(a.dist, b.dist); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.key, b.key)
+}
+
+// vectorIndex finds nearest neighbors of a vector. Stored and query vectors are prepared.
+type vectorIndex interface {
+	add(key string, vec []float32)
+	remove(key string)
+	// search returns at most k nearest neighbors ordered by distance. ef is a size
+	// of the candidate list of approximate indexes.
+	search(query []float32, k, ef int) []neighbor
+}
+
+func newVectorIndex(opts VectorOptions) vectorIndex {
+	if opts.Algorithm == VectorHNSW {
+		return newHNSW(opts)
+	}
+	return &flatIndex{dist: distance(opts.Metric), vectors: map[string][]float32{}}
+}
+
+// flatIndex compares a query with every vector.
+type flatIndex struct {
+	dist    distanceFunc
+	vectors map[string][]float32
+}
+
+func (f *flatIndex) add(key string, vec []float32) {
+	f.vectors[key] = vec
+}
+
+func (f *flatIndex) remove(key string) {
+	delete(f.vectors, key)
+}
+
+func (f *flatIndex) search(query []float32, k, _ int) []neighbor {
+	return nearest(query, k, f.dist, func(yield func(key string, vec []float32)) {
+		for key, vec := range f.vectors {
+			yield(key, vec)
+		}
+	})
+}
+
+// nearest returns k nearest of vectors produced by scan ordered by distance.
+func nearest(query []float32, k int, dist distanceFunc, scan func(yield func(key string, vec []float32))) []neighbor {
+	if k <= 0 {
+		return nil
+	}
+	// The farthest of the best k neighbors is on top of the heap.
+	best := heap.WithLess(func(a, b neighbor) bool {
+		return compareNeighbors(a, b) > 0
+	})
+	scan(func(key string, vec []float32) {
+		n := neighbor{key: key, dist: dist(query, vec)}
+		if best.Len() == k {
+			if worst, _ := best.Peek(); compareNeighbors(n, worst) >= 0 {
+				return
+			}
+			best.MustPop()
+		}
+		best.Push(n)
+	})
+	res := make([]neighbor, 0, best.Len())
+	for best.Len() > 0 {
+		res = append(res, best.MustPop())
+	}
+	slices.Reverse(res)
+	return res
+}
+
+// knn selects nearest neighbors of the query vector among matching documents. Nil scores
+// mean that the query doesn't filter documents.
+func (idx *Index) knn(q *Query, scores docScores, params map[string][]byte) (docScores, error) {
+	c := q.knn
+	f, ok := idx.fields[c.field]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownField, c.field)
+	}
+	if f.Type != FieldVector {
+		return nil, fmt.Errorf("%w: %s is not a %s field", ErrSyntax, c.field, FieldVector)
+	}
+	k, err := intParam(c.k, params)
+	if err != nil {
+		return nil, err
+	}
+	ef := f.Vector.EFRuntime
+	if c.efRuntime != "" {
+		if ef, err = intParam(c.efRuntime, params); err != nil {
+			return nil, err
+		}
+	}
+	blob, ok := params[c.param]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownParam, c.param)
+	}
+	vec, ok := DecodeVector(blob, f.Vector.Dim)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be a FLOAT32 blob of %d dimensions", ErrSyntax, c.param, f.Vector.Dim)
+	}
+	vec = prepare(f.Vector.Metric, vec)
+
+	var found []neighbor
+	if scores == nil {
+		found = idx.vectors[c.field].search(vec, k, ef)
+	} else {
+		// Filtered queries are exact: the filter usually leaves few documents, and an
+		// approximate search would miss neighbors that are far from each other in the graph.
+		found = nearest(vec, k, distance(f.Vector.Metric), func(yield func(key string, vec []float32)) {
+			for key := range scores {
+				if v, ok := idx.docs[key].vectors[c.field]; ok {
+					yield(key, v)
+				}
+			}
+		})
+	}
+	res := make(docScores, len(found))
+	for _, n := range found {
+		res[n.key] = float64(n.dist)
+	}
+	return res, nil
+}
+
+// intParam parses a non-negative number, which is either a literal or a parameter.
+func intParam(value string, params map[string][]byte) (int, error) {
+	if name, ok := strings.CutPrefix(value, "$"); ok {
+		raw, ok := params[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownParam, name)
+		}
+		value = string(raw)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q must be a non-negative integer", ErrSyntax, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,211 @@
+package search_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVectorIndex(t testing.TB, algorithm search.VectorAlgorithm, metric search.DistanceMetric, dim int,
+) *search.Index {
+	t.Helper()
+	idx, err := search.NewIndex(search.Definition{
+		Name: "vectors",
+		Fields: []search.Field{
+			{Name: "color", Type: search.FieldTag, Separator: ','},
+			{Name: "vec", Type: search.FieldVector, Vector: search.VectorOptions{
+				Algorithm:      algorithm,
+				Dim:            dim,
+				Metric:         metric,
+				M:              search.DefaultM,
+				EFConstruction: search.DefaultEFConstruction,
+				EFRuntime:      search.DefaultEFRuntime,
+			}},
+		},
+	})
+	require.NoError(t, err)
+	return idx
+}
+
+func randomVectors(rnd *rand.Rand, n, dim int) [][]float32 {
+	res := make([][]float32, n)
+	for i := range res {
+		res[i] = make([]float32, dim)
+		for j := range res[i] {
+			res[i][j] = rnd.Float32()*2 - 1
+		}
+	}
+	return res
+}
+
+func knn(t testing.TB, idx *search.Index, query string, vec []float32) []string {
+	t.Helper()
+	q, err := search.ParseQuery(query)
+	require.NoError(t, err)
+	matches, err := idx.Search(q, search.SearchOptions{Params: map[string][]byte{"vec": search.EncodeVector(vec)}})
+	require.NoError(t, err)
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = m.Key
+	}
+	return keys
+}
+
+func TestIndex_Search_knn(t *testing.T) {
+	t.Parallel()
+	for _, algorithm := range []search.VectorAlgorithm{search.VectorFlat, search.VectorHNSW} {
+		idx := newVectorIndex(t, algorithm, search.MetricL2, 2)
+		points := map[string][]float32{"a": {0, 0}, "b": {1, 0}, "c": {0, 2}, "d": {3, 3}}
+		for key, p := range points {
+			idx.Update(key, map[string][]byte{"vec": search.EncodeVector(p), "color": []byte(key)})
+		}
+
+		assert.Equal(t, []string{"b", "a", "c"}, knn(t, idx, "*=>[KNN 3 @vec $vec]", []float32{1, 0.1}), algorithm)
+		assert.Equal(t, []string{"c", "d"}, knn(t, idx, "@color:{c | d}=>[KNN 5 @vec $vec]", []float32{0, 0}), algorithm)
+
+		q, err := search.ParseQuery("*=>[KNN $k @vec $vec AS dist]")
+		require.NoError(t, err)
+		assert.Equal(t, "dist", q.ScoreField())
+		matches, err := idx.Search(q, search.SearchOptions{
+			Params:     map[string][]byte{"vec": search.EncodeVector([]float32{3, 1}), "k": []byte("2")},
+			SortBy:     "dist",
+			Descending: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []search.Match{{Key: "b", Score: 5}, {Key: "d", Score: 4}}, matches, algorithm)
+
+		idx.Remove("a")
+		assert.Equal(t, []string{"b", "c"}, knn(t, idx, "*=>[KNN 2 @vec $vec]", []float32{0, 0}), algorithm)
+	}
+}
+
+func TestIndex_Search_knnMetrics(t *testing.T) {
+	t.Parallel()
+	points := map[string][]float32{"short": {1, 0}, "long": {10, 1}, "opposite": {-1, 0}}
+	cases := map[search.DistanceMetric][]string{
+		search.MetricL2:     {"short", "opposite", "long"},
+		search.MetricIP:     {"long", "short", "opposite"},
+		search.MetricCosine: {"short", "long", "opposite"},
+	}
+	for metric, expected := range cases {
+		idx := newVectorIndex(t, search.VectorFlat, metric, 2)
+		for key, p := range points {
+			idx.Update(key, map[string][]byte{"vec": search.EncodeVector(p)})
+		}
+		assert.Equal(t, expected, knn(t, idx, "*=>[KNN 3 @vec $vec]", []float32{2, 0}), metric)
+	}
+}
+
+func TestIndex_Search_hnswRecall(t *testing.T) {
+	t.Parallel()
+	const (
+		n, dim, k = 2000, 16, 10
+		queries   = 50
+	)
+	rnd := rand.New(rand.NewSource(1))
+	flat := newVectorIndex(t, search.VectorFlat, search.MetricCosine, dim)
+	hnsw := newVectorIndex(t, search.VectorHNSW, search.MetricCosine, dim)
+	for i, vec := range randomVectors(rnd, n, dim) {
+		hash := map[string][]byte{"vec": search.EncodeVector(vec)}
+		flat.Update(fmt.Sprint(i), hash)
+		hnsw.Update(fmt.Sprint(i), hash)
+	}
+	// Deleted nodes stay in the graph until it is rebuilt and must not be returned.
+	for i := 0; i < n; i += 3 {
+		flat.Remove(fmt.Sprint(i))
+		hnsw.Remove(fmt.Sprint(i))
+	}
+
+	query := fmt.Sprintf("*=>[KNN %d @vec $vec EF_RUNTIME 100]", k)
+	found := 0
+	for _, vec := range randomVectors(rnd, queries, dim) {
+		expected := knn(t, flat, query, vec)
+		actual := knn(t, hnsw, query, vec)
+		require.Len(t, actual, k)
+		for _, key := range actual {
+			if assert.Contains(t, expected, key) {
+				found++
+			}
+		}
+	}
+	assert.GreaterOrEqual(t, float64(found)/(queries*k), 0.95)
+}
+
+func TestIndex_Update_invalidVector(t *testing.T) {
+	t.Parallel()
+	idx := newVectorIndex(t, search.VectorHNSW, search.MetricL2, 3)
+	idx.Update("short", map[string][]byte{"vec": search.EncodeVector([]float32{1, 2})})
+	assert.Equal(t, 0, idx.NumDocs())
+	assert.Equal(t, 1, idx.Failures())
+}
+
+func TestIndex_Search_knnErrors(t *testing.T) {
+	t.Parallel()
+	idx := newVectorIndex(t, search.VectorFlat, search.MetricL2, 2)
+	vec := search.EncodeVector([]float32{1, 2})
+	cases := map[string]map[string][]byte{
+		"*=>[KNN 2 @vec $missing]": {"vec": vec},
+		"*=>[KNN $k @vec $vec]":    {"vec": vec},
+		"*=>[KNN 2 @color $vec]":   {"vec": vec},
+		"*=>[KNN 2 @unknown $vec]": {"vec": vec},
+		"*=>[KNN 2 @vec $vec]":     {"vec": vec[:4]},
+	}
+	for query, params := range cases {
+		q, err := search.ParseQuery(query)
+		require.NoError(t, err, query)
+		_, err = idx.Search(q, search.SearchOptions{Params: params})
+		assert.Error(t, err, query)
+	}
+
+	for _, query := range []string{
+		"*=>[KNN 2 @vec]", "*=>[KNN 2 vec $vec]", "*=>[KNN 2 @vec vec]", "*=>[TOP 2 @vec $vec]",
+		"*=>[KNN -1 @vec $vec]", "*=>[KNN 2 @vec $vec", "*=>[KNN 2 @vec $vec] foo", "*=>KNN 2 @vec $vec",
+		"*=>[KNN 2 @vec $vec EF_RUNTIME]", "*=>[KNN 2 @vec $vec LIMIT 1]", "=>[KNN 2 @vec $vec]",
+	} {
+		_, err := search.ParseQuery(query)
+		assert.ErrorIs(t, err, search.ErrSyntax, query)
+	}
+}
+
+func benchmarkKNN(b *testing.B, algorithm search.VectorAlgorithm) {
+	const n, dim = 10000, 128
+	rnd := rand.New(rand.NewSource(1))
+	idx := newVectorIndex(b, algorithm, search.MetricCosine, dim)
+	for i, vec := range randomVectors(rnd, n, dim) {
+		idx.Update(fmt.Sprint(i), map[string][]byte{"vec": search.EncodeVector(vec)})
+	}
+	q, err := search.ParseQuery("*=>[KNN 10 @vec $vec]")
+	require.NoError(b, err)
+	queries := randomVectors(rnd, 100, dim)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params := map[string][]byte{"vec": search.EncodeVector(queries[i%len(queries)])}
+		if _, err := idx.Search(q, search.SearchOptions{Params: params}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndex_Search_flat(b *testing.B) {
+	benchmarkKNN(b, search.VectorFlat)
+}
+
+func BenchmarkIndex_Search_hnsw(b *testing.B) {
+	benchmarkKNN(b, search.VectorHNSW)
+}
+
+func BenchmarkIndex_Update_hnsw(b *testing.B) {
+	const dim = 128
+	idx := newVectorIndex(b, search.VectorHNSW, search.MetricCosine, dim)
+	vectors := randomVectors(rand.New(rand.NewSource(1)), b.N, dim)
+
+	b.ResetTimer()
+	for i, vec := range vectors {
+		idx.Update(fmt.Sprint(i), map[string][]byte{"vec": search.EncodeVector(vec)})
+	}
+}
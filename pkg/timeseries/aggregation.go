@@ -0,0 +1,185 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidAggregation = errors.New("unknown aggregation type")
+
+type Aggregation string
+
+const (
+	AggAvg   Aggregation = "avg"
+	AggSum   Aggregation = "sum"
+	AggMin   Aggregation = "min"
+	AggMax   Aggregation = "max"
+	AggCount Aggregation = "count"
+	AggFirst Aggregation = "first"
+	AggLast  Aggregation = "last"
+)
+
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(strings.ToLower(s)); a {
+	case AggAvg, AggSum, AggMin, AggMax, AggCount, AggFirst, AggLast:
+		return a, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidAggregation, s)
+	}
+}
+
+type accumulator struct {
+	agg   Aggregation
+	count int
+	sum   float64
+	min   float64
+	max   float64
+	first float64
+	last  float64
+}
+
+func (a *accumulator) add(v float64) {
+	if a.count == 0 {
+		a.min, a.max, a.first = v, v, v
+	}
+	a.count++
+	a.sum += v
+	a.min = math.Min(a.min, v)
+	a.max = math.Max(a.max, v)
+	a.last = v
+}
+
+func (a *accumulator) value() float64 {
+	switch a.agg {
+	case AggAvg:
+		return a.sum / float64(a.count)
+	case AggSum:
+		return a.sum
+	case AggMin:
+		return a.min
+	case AggMax:
+		return a.max
+	case AggCount:
+		return float64(a.count)
+	case AggFirst:
+		return a.first
+	case AggLast:
+		return a.last
+	default:
+		panic("unknown aggregation " + string(a.agg))
+	}
+}
+
+// BucketStart returns start of the bucket that contains ts. Buckets are aligned to align.
+func BucketStart(ts, bucket, align int64) int64 {
+	offset := (ts - align) % bucket
+	if offset < 0 {
+		offset += bucket
+	}
+	return ts - offset
+}
+
+// Aggregate groups samples ordered by timestamp into buckets and aggregates each bucket.
+// Every resulting sample has a timestamp of the start of its bucket.
+func Aggregate(samples []Sample, agg Aggregation, bucket, align int64) []Sample {
+	var res []Sample
+	var acc *accumulator
+	var start int64
+	for _, s := range samples {
+		bs := BucketStart(s.Timestamp, bucket, align)
+		if acc != nil && bs != start {
+			res = append(res, Sample{Timestamp: start, Value: acc.value()})
+			acc = nil
+		}
+		if acc == nil {
+			acc = &accumulator{agg: agg}
+			start = bs
+		}
+		acc.add(s.Value)
+	}
+	if acc != nil {
+		res = append(res, Sample{Timestamp: start, Value: acc.value()})
+	}
+	return res
+}
+
+// Rule is a compaction rule. It aggregates samples of a source series into buckets
+// and emits an aggregated sample into the destination series once a bucket is closed.
+type Rule struct {
+	Dest        string
+	Aggregation Aggregation
+	Bucket      int64
+	Align       int64
+	start       int64
+	acc         *accumulator
+}
+
+// Compaction is a sample produced by a rule that must be added to the series Dest.
+type Compaction struct {
+	Dest   string
+	Sample Sample
+}
+
+func NewRule(dest string, agg Aggregation, bucket, align int64) *Rule {
+	return &Rule{Dest: dest, Aggregation: agg, Bucket: bucket, Align: align}
+}
+
+func (r *Rule) observe(s Sample) (Sample, bool) {
+	start := BucketStart(s.Timestamp, r.Bucket, r.Align)
+	var closed Sample
+	emitted := false
+	if r.acc != nil && start > r.start {
+		closed = Sample{Timestamp: r.start, Value: r.acc.value()}
+		emitted = true
+		r.acc = nil
+	}
+	if r.acc == nil {
+		r.acc = &accumulator{agg: r.Aggregation}
+		r.start = start
+	}
+	r.acc.add(s.Value)
+	return closed, emitted
+}
+
+// Query describes a range query. Filters are applied before aggregation, and Count limits
+// amount of returned samples after aggregation.
+type Query struct {
+	From           int64
+	To             int64
+	Reverse        bool
+	FilterByTS     []int64
+	FilterByValue  bool
+	MinValue       float64
+	MaxValue       float64
+	Count          int
+	Aggregation    Aggregation
+	BucketDuration int64
+	Align          int64
+}
+
+func (s *Series) Query(q Query) []Sample {
+	samples := s.Range(q.From, q.To)
+	if len(q.FilterByTS) > 0 {
+		samples = slices.DeleteFunc(samples, func(s Sample) bool {
+			return !slices.Contains(q.FilterByTS, s.Timestamp)
+		})
+	}
+	if q.FilterByValue {
+		samples = slices.DeleteFunc(samples, func(s Sample) bool {
+			return s.Value < q.MinValue || s.Value > q.MaxValue
+		})
+	}
+	if q.Aggregation != "" {
+		samples = Aggregate(samples, q.Aggregation, q.BucketDuration, q.Align)
+	}
+	if q.Reverse {
+		slices.Reverse(samples)
+	}
+	if q.Count > 0 && len(samples) > q.Count {
+		samples = samples[:q.Count]
+	}
+	return samples
+}
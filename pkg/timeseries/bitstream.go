@@ -0,0 +1,61 @@
+package timeseries
+
+import "errors"
+
+var errEndOfStream = errors.New("unexpected end of bit stream")
+
+type bitWriter struct {
+	buf  []byte
+	free uint8 // free bits in the last byte of buf
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+// writeBits writes n least significant bits of v, most significant bit first.
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(v&(1<<i) != 0)
+	}
+}
+
+func (w *bitWriter) clone() bitWriter {
+	return bitWriter{buf: append([]byte(nil), w.buf...), free: w.free}
+}
+
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, errEndOfStream
+	}
+	bit := r.buf[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
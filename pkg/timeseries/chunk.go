@@ -0,0 +1,239 @@
+package timeseries
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Sample is a single point of a time series. Timestamp is in milliseconds.
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Sizes of delta-of-delta buckets. A bucket is selected with a unary prefix:
+// 0, 10, 110, 1110, 11110, and 11111 for raw 64 bits.
+var dodBucketBits = [...]int{7, 9, 12, 32}
+
+const (
+	rawBits         = 64
+	leadingBits     = 5
+	significantBits = 6
+	maxLeading      = 1<<leadingBits - 1
+)
+
+// chunk stores samples compressed with Gorilla encoding: timestamps are stored as
+// delta-of-delta and values are XORed with the previous value.
+type chunk struct {
+	data  bitWriter
+	count int
+	first Sample
+	last  Sample
+
+	prevDelta int64
+	leading   int
+	trailing  int
+}
+
+func newChunk(samples ...Sample) *chunk {
+	c := &chunk{}
+	for _, s := range samples {
+		c.append(s)
+	}
+	return c
+}
+
+func (c *chunk) size() int {
+	return len(c.data.buf)
+}
+
+// append adds a sample to the end of the chunk. Timestamp must be greater than
+// timestamp of the last sample.
+func (c *chunk) append(s Sample) {
+	if c.count == 0 {
+		c.data.writeBits(uint64(s.Timestamp), rawBits)
+		c.data.writeBits(math.Float64bits(s.Value), rawBits)
+		c.first = s
+		c.last = s
+		c.count++
+		return
+	}
+
+	delta := s.Timestamp - c.last.Timestamp
+	c.writeDoD(delta - c.prevDelta)
+	c.prevDelta = delta
+
+	c.writeXOR(math.Float64bits(c.last.Value) ^ math.Float64bits(s.Value))
+	c.last = s
+	c.count++
+}
+
+func (c *chunk) writeDoD(dod int64) {
+	if dod == 0 {
+		c.data.writeBit(false)
+		return
+	}
+	for _, n := range dodBucketBits {
+		if dod >= -(1<<(n-1)) && dod < 1<<(n-1) {
+			c.data.writeBit(true)
+			c.data.writeBit(false)
+			c.data.writeBits(uint64(dod), n)
+			return
+		}
+		c.data.writeBit(true)
+	}
+	c.data.writeBit(true)
+	c.data.writeBits(uint64(dod), rawBits)
+}
+
+func (c *chunk) writeXOR(xor uint64) {
+	if xor == 0 {
+		c.data.writeBit(false)
+		return
+	}
+	c.data.writeBit(true)
+
+	leading := min(bits.LeadingZeros64(xor), maxLeading)
+	trailing := bits.TrailingZeros64(xor)
+	if c.count > 1 && leading >= c.leading && trailing >= c.trailing {
+		// Meaningful bits fit into the window of the previous value.
+		c.data.writeBit(false)
+		c.data.writeBits(xor>>c.trailing, rawBits-c.leading-c.trailing)
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	meaningful := rawBits - leading - trailing
+	c.data.writeBit(true)
+	c.data.writeBits(uint64(leading), leadingBits)
+	c.data.writeBits(uint64(meaningful%rawBits), significantBits)
+	c.data.writeBits(xor>>trailing, meaningful)
+}
+
+// samples decodes all samples of the chunk.
+func (c *chunk) samples() []Sample {
+	res := make([]Sample, 0, c.count)
+	it := c.iterator()
+	for it.next() {
+		res = append(res, it.sample)
+	}
+	return res
+}
+
+func (c *chunk) iterator() *chunkIterator {
+	return &chunkIterator{r: bitReader{buf: c.data.buf}, total: c.count}
+}
+
+type chunkIterator struct {
+	r         bitReader
+	total     int
+	read      int
+	sample    Sample
+	prevDelta int64
+	leading   int
+	trailing  int
+	err       error
+}
+
+func (it *chunkIterator) next() bool {
+	if it.read >= it.total || it.err != nil {
+		return false
+	}
+	if it.read == 0 {
+		ts, err := it.r.readBits(rawBits)
+		if err != nil {
+			return it.fail(err)
+		}
+		v, err := it.r.readBits(rawBits)
+		if err != nil {
+			return it.fail(err)
+		}
+		it.sample = Sample{Timestamp: int64(ts), Value: math.Float64frombits(v)}
+		it.read++
+		return true
+	}
+
+	dod, err := it.readDoD()
+	if err != nil {
+		return it.fail(err)
+	}
+	it.prevDelta += dod
+	it.sample.Timestamp += it.prevDelta
+
+	xor, err := it.readXOR()
+	if err != nil {
+		return it.fail(err)
+	}
+	it.sample.Value = math.Float64frombits(math.Float64bits(it.sample.Value) ^ xor)
+	it.read++
+	return true
+}
+
+func (it *chunkIterator) fail(err error) bool {
+	it.err = err
+	return false
+}
+
+func (it *chunkIterator) readDoD() (int64, error) {
+	// Amount of leading ones selects a bucket.
+	ones := 0
+	for ones <= len(dodBucketBits) {
+		bit, err := it.r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+	switch {
+	case ones == 0:
+		return 0, nil
+	case ones <= len(dodBucketBits):
+		return it.readSigned(dodBucketBits[ones-1])
+	default:
+		v, err := it.r.readBits(rawBits)
+		return int64(v), err
+	}
+}
+
+func (it *chunkIterator) readSigned(n int) (int64, error) {
+	v, err := it.r.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	shift := rawBits - n
+	return int64(v<<shift) >> shift, nil
+}
+
+func (it *chunkIterator) readXOR() (uint64, error) {
+	bit, err := it.r.readBit()
+	if err != nil || !bit {
+		return 0, err
+	}
+	newWindow, err := it.r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if newWindow {
+		leading, err := it.r.readBits(leadingBits)
+		if err != nil {
+			return 0, err
+		}
+		meaningful, err := it.r.readBits(significantBits)
+		if err != nil {
+			return 0, err
+		}
+		if meaningful == 0 {
+			meaningful = rawBits
+		}
+		it.leading = int(leading)
+		it.trailing = rawBits - it.leading - int(meaningful)
+	}
+	v, err := it.r.readBits(rawBits - it.leading - it.trailing)
+	if err != nil {
+		return 0, err
+	}
+	return v << it.trailing, nil
+}
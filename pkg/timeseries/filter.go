@@ -0,0 +1,85 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Matcher is a label filter of TS.MRANGE. Supported forms are:
+//
+//   - label=value, label=(v1,v2) – label equals one of values
+//   - label!=value, label!=(v1,v2) – label is missing or doesn't equal any of values
+//   - label= – series doesn't have the label
+//   - label!= – series has the label
+type Matcher struct {
+	Label  string
+	Values []string
+	Negate bool
+}
+
+func ParseMatcher(expr string) (Matcher, error) {
+	var m Matcher
+	idx := strings.IndexByte(expr, '=')
+	if idx <= 0 {
+		return m, fmt.Errorf("%w: %s", ErrInvalidFilter, expr)
+	}
+	m.Label = expr[:idx]
+	if strings.HasSuffix(m.Label, "!") {
+		m.Negate = true
+		m.Label = m.Label[:len(m.Label)-1]
+	}
+	if m.Label == "" {
+		return m, fmt.Errorf("%w: %s", ErrInvalidFilter, expr)
+	}
+
+	value := expr[idx+1:]
+	switch {
+	case value == "":
+	case strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"):
+		m.Values = strings.Split(value[1:len(value)-1], ",")
+	default:
+		m.Values = []string{value}
+	}
+	return m, nil
+}
+
+func (m Matcher) String() string {
+	op := "="
+	if m.Negate {
+		op = "!="
+	}
+	switch len(m.Values) {
+	case 0:
+		return m.Label + op
+	case 1:
+		return m.Label + op + m.Values[0]
+	default:
+		return m.Label + op + "(" + strings.Join(m.Values, ",") + ")"
+	}
+}
+
+// IsPositive reports whether matcher requires a label to have a specific value.
+func (m Matcher) IsPositive() bool {
+	return !m.Negate && len(m.Values) > 0
+}
+
+func (m Matcher) Match(s *Series) bool {
+	value, ok := s.Label(m.Label)
+	if len(m.Values) == 0 {
+		return ok == m.Negate
+	}
+	return (ok && slices.Contains(m.Values, value)) != m.Negate
+}
+
+func MatchAll(s *Series, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Match(s) {
+			return false
+		}
+	}
+	return true
+}
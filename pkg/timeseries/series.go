@@ -0,0 +1,301 @@
+package timeseries
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDuplicateSample = errors.New("duplicate sample is blocked by BLOCK duplicate policy")
+	ErrTooOld          = errors.New("timestamp is older than retention")
+	ErrInvalidPolicy   = errors.New("unknown duplicate policy")
+)
+
+const DefaultChunkSize = 4096
+
+type DuplicatePolicy string
+
+const (
+	PolicyBlock DuplicatePolicy = "BLOCK"
+	PolicyFirst DuplicatePolicy = "FIRST"
+	PolicyLast  DuplicatePolicy = "LAST"
+	PolicyMin   DuplicatePolicy = "MIN"
+	PolicyMax   DuplicatePolicy = "MAX"
+	PolicySum   DuplicatePolicy = "SUM"
+)
+
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(strings.ToUpper(s)); p {
+	case PolicyBlock, PolicyFirst, PolicyLast, PolicyMin, PolicyMax, PolicySum:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidPolicy, s)
+	}
+}
+
+// resolve returns a value that should be stored when a sample with the same timestamp already exists.
+func (p DuplicatePolicy) resolve(old, value float64) (float64, error) {
+	switch p {
+	case PolicyFirst:
+		return old, nil
+	case PolicyLast:
+		return value, nil
+	case PolicyMin:
+		return math.Min(old, value), nil
+	case PolicyMax:
+		return math.Max(old, value), nil
+	case PolicySum:
+		return old + value, nil
+	case PolicyBlock:
+		return 0, ErrDuplicateSample
+	default:
+		return 0, ErrDuplicateSample
+	}
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Options struct {
+	// Retention is a maximum age of samples in milliseconds compared to the last sample. 0 means forever.
+	Retention       int64
+	DuplicatePolicy DuplicatePolicy
+	// ChunkSize is a size of a compressed chunk in bytes.
+	ChunkSize int
+	Labels    []Label
+}
+
+// Series is a time series, which stores samples in Gorilla compressed chunks.
+type Series struct {
+	opts   Options
+	chunks []*chunk
+	rules  []*Rule
+	source string
+}
+
+func New(opts Options) *Series {
+	if opts.DuplicatePolicy == "" {
+		opts.DuplicatePolicy = PolicyBlock
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	return &Series{opts: opts}
+}
+
+// Clone returns a deep copy of the series including state of its compaction rules.
+func (s *Series) Clone() *Series {
+	c := &Series{opts: s.opts, source: s.source}
+	c.opts.Labels = slices.Clone(s.opts.Labels)
+	c.chunks = make([]*chunk, len(s.chunks))
+	for i, ch := range s.chunks {
+		copied := *ch
+		copied.data = ch.data.clone()
+		c.chunks[i] = &copied
+	}
+	c.rules = make([]*Rule, len(s.rules))
+	for i, rule := range s.rules {
+		copied := *rule
+		if rule.acc != nil {
+			acc := *rule.acc
+			copied.acc = &acc
+		}
+		c.rules[i] = &copied
+	}
+	return c
+}
+
+func (s *Series) Options() Options {
+	return s.opts
+}
+
+func (s *Series) Labels() []Label {
+	return s.opts.Labels
+}
+
+func (s *Series) Label(name string) (string, bool) {
+	for _, l := range s.opts.Labels {
+		if l.Name == name {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// Len returns amount of stored samples.
+func (s *Series) Len() int {
+	total := 0
+	for _, c := range s.chunks {
+		total += c.count
+	}
+	return total
+}
+
+// Last returns the sample with the greatest timestamp.
+func (s *Series) Last() (Sample, bool) {
+	if len(s.chunks) == 0 {
+		return Sample{}, false
+	}
+	return s.chunks[len(s.chunks)-1].last, true
+}
+
+// Add inserts a sample. Policy overrides duplicate policy of the series if not empty.
+// Returns samples produced by compaction rules for closed buckets, including buckets
+// recomputed because the sample is inserted into them out of order.
+func (s *Series) Add(sample Sample, policy DuplicatePolicy) ([]Compaction, error) {
+	if policy == "" {
+		policy = s.opts.DuplicatePolicy
+	}
+
+	last, ok := s.Last()
+	if ok && s.opts.Retention > 0 && sample.Timestamp < last.Timestamp-s.opts.Retention {
+		return nil, ErrTooOld
+	}
+
+	if ok && sample.Timestamp <= last.Timestamp {
+		if err := s.upsert(sample, policy); err != nil {
+			return nil, err
+		}
+		return s.recompact(sample.Timestamp), nil
+	}
+
+	if len(s.chunks) == 0 || s.chunks[len(s.chunks)-1].size() >= s.opts.ChunkSize {
+		s.chunks = append(s.chunks, newChunk())
+	}
+	s.chunks[len(s.chunks)-1].append(sample)
+	s.trim()
+	return s.compact(sample), nil
+}
+
+// upsert inserts a sample in the middle of the series, so a chunk that contains it must be rebuilt.
+func (s *Series) upsert(sample Sample, policy DuplicatePolicy) error {
+	i := sort.Search(len(s.chunks), func(i int) bool {
+		return s.chunks[i].last.Timestamp >= sample.Timestamp
+	})
+	c := s.chunks[i]
+	samples := c.samples()
+	j, found := slices.BinarySearchFunc(samples, sample.Timestamp, func(s Sample, ts int64) int {
+		return cmp.Compare(s.Timestamp, ts)
+	})
+	if found {
+		v, err := policy.resolve(samples[j].Value, sample.Value)
+		if err != nil {
+			return err
+		}
+		samples[j].Value = v
+	} else {
+		samples = slices.Insert(samples, j, sample)
+	}
+	s.chunks[i] = newChunk(samples...)
+	return nil
+}
+
+// trim drops chunks that are entirely older than retention.
+func (s *Series) trim() {
+	if s.opts.Retention <= 0 {
+		return
+	}
+	last, _ := s.Last()
+	minTS := last.Timestamp - s.opts.Retention
+	drop := 0
+	for drop < len(s.chunks)-1 && s.chunks[drop].last.Timestamp < minTS {
+		drop++
+	}
+	s.chunks = s.chunks[drop:]
+}
+
+func (s *Series) minTimestamp() int64 {
+	last, ok := s.Last()
+	if !ok || s.opts.Retention <= 0 {
+		return math.MinInt64
+	}
+	return last.Timestamp - s.opts.Retention
+}
+
+// Range returns samples with timestamps in [from, to] ordered by timestamp.
+func (s *Series) Range(from, to int64) []Sample {
+	from = max(from, s.minTimestamp())
+	var res []Sample
+	for _, c := range s.chunks {
+		if c.last.Timestamp < from || c.first.Timestamp > to {
+			continue
+		}
+		it := c.iterator()
+		for it.next() {
+			if it.sample.Timestamp >= from && it.sample.Timestamp <= to {
+				res = append(res, it.sample)
+			}
+		}
+	}
+	return res
+}
+
+// Source returns key of the series this series is compacted from.
+func (s *Series) Source() string {
+	return s.source
+}
+
+func (s *Series) SetSource(key string) {
+	s.source = key
+}
+
+func (s *Series) Rules() []*Rule {
+	return s.rules
+}
+
+func (s *Series) AddRule(rule *Rule) {
+	s.rules = append(s.rules, rule)
+}
+
+func (s *Series) RemoveRule(dest string) bool {
+	n := len(s.rules)
+	s.rules = slices.DeleteFunc(s.rules, func(r *Rule) bool {
+		return r.Dest == dest
+	})
+	return len(s.rules) != n
+}
+
+func (s *Series) compact(sample Sample) []Compaction {
+	var res []Compaction
+	for _, r := range s.rules {
+		if closed, ok := r.observe(sample); ok {
+			res = append(res, Compaction{Dest: r.Dest, Sample: closed})
+		}
+	}
+	return res
+}
+
+// recompact aggregates buckets containing ts again once a sample is upserted. The open bucket of
+// a rule is rebuilt, and a closed one is emitted again to replace the sample of the destination.
+func (s *Series) recompact(ts int64) []Compaction {
+	var res []Compaction
+	for _, r := range s.rules {
+		start := BucketStart(ts, r.Bucket, r.Align)
+		if r.acc == nil || start > r.start {
+			// The rule hasn't observed samples of the bucket.
+			continue
+		}
+		samples := s.Range(start, start+r.Bucket-1)
+		if len(samples) == 0 {
+			continue
+		}
+		if start == r.start {
+			r.acc = &accumulator{agg: r.Aggregation}
+			for _, sample := range samples {
+				r.acc.add(sample.Value)
+			}
+			continue
+		}
+		for _, closed := range Aggregate(samples, r.Aggregation, r.Bucket, r.Align) {
+			res = append(res, Compaction{Dest: r.Dest, Sample: closed})
+		}
+	}
+	return res
+}
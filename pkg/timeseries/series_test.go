@@ -0,0 +1,242 @@
+package timeseries_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/burenotti/redis_impl/pkg/timeseries"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeries_compression(t *testing.T) {
+	t.Parallel()
+	rnd := rand.New(rand.NewSource(42))
+	s := timeseries.New(timeseries.Options{ChunkSize: 128})
+
+	var expected []timeseries.Sample
+	ts := int64(1_700_000_000_000)
+	value := 100.0
+	for i := 0; i < 5000; i++ {
+		switch rnd.Intn(4) {
+		case 0:
+			ts += 1000
+		case 1:
+			ts += int64(rnd.Intn(100_000)) + 1
+		case 2:
+			ts += int64(rnd.Intn(1<<40)) + 1
+		default:
+			ts += 1000 + int64(rnd.Intn(10))
+		}
+		switch rnd.Intn(3) {
+		case 0:
+		case 1:
+			value += rnd.NormFloat64()
+		default:
+			value = math.Float64frombits(rnd.Uint64() &^ (0x7ff << 52))
+		}
+		sample := timeseries.Sample{Timestamp: ts, Value: value}
+		expected = append(expected, sample)
+		_, err := s.Add(sample, "")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, len(expected), s.Len())
+	assert.Equal(t, expected, s.Range(0, math.MaxInt64))
+}
+
+func TestSeries_duplicatePolicy(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		Policy   timeseries.DuplicatePolicy
+		Expected float64
+	}{
+		{Policy: timeseries.PolicyFirst, Expected: 1},
+		{Policy: timeseries.PolicyLast, Expected: 5},
+		{Policy: timeseries.PolicyMin, Expected: 1},
+		{Policy: timeseries.PolicyMax, Expected: 5},
+		{Policy: timeseries.PolicySum, Expected: 6},
+	}
+	for _, c := range cases {
+		s := timeseries.New(timeseries.Options{DuplicatePolicy: c.Policy})
+		for _, sample := range []timeseries.Sample{{10, 1}, {20, 2}, {30, 3}} {
+			_, err := s.Add(sample, "")
+			require.NoError(t, err)
+		}
+		_, err := s.Add(timeseries.Sample{Timestamp: 10, Value: 5}, "")
+		require.NoError(t, err)
+		assert.Equal(t, c.Expected, s.Range(10, 10)[0].Value, c.Policy)
+	}
+
+	s := timeseries.New(timeseries.Options{})
+	_, err := s.Add(timeseries.Sample{Timestamp: 10, Value: 1}, "")
+	require.NoError(t, err)
+	_, err = s.Add(timeseries.Sample{Timestamp: 10, Value: 2}, "")
+	require.ErrorIs(t, err, timeseries.ErrDuplicateSample)
+
+	_, err = s.Add(timeseries.Sample{Timestamp: 5, Value: 2}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []timeseries.Sample{{5, 2}, {10, 1}}, s.Range(0, 100))
+}
+
+func TestSeries_retention(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{Retention: 100, ChunkSize: 16})
+	for ts := int64(0); ts <= 1000; ts += 10 {
+		_, err := s.Add(timeseries.Sample{Timestamp: ts, Value: float64(ts)}, "")
+		require.NoError(t, err)
+	}
+	samples := s.Range(0, math.MaxInt64)
+	assert.Equal(t, int64(900), samples[0].Timestamp)
+	assert.Len(t, samples, 11)
+
+	_, err := s.Add(timeseries.Sample{Timestamp: 800, Value: 1}, "")
+	assert.ErrorIs(t, err, timeseries.ErrTooOld)
+}
+
+func TestSeries_Query(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{})
+	for ts := int64(0); ts < 100; ts += 10 {
+		_, err := s.Add(timeseries.Sample{Timestamp: ts, Value: float64(ts / 10)}, "")
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		Name     string
+		Query    timeseries.Query
+		Expected []timeseries.Sample
+	}{
+		{
+			Name:     "range",
+			Query:    timeseries.Query{From: 20, To: 40},
+			Expected: []timeseries.Sample{{20, 2}, {30, 3}, {40, 4}},
+		},
+		{
+			Name:     "reverse with count",
+			Query:    timeseries.Query{From: 0, To: 100, Reverse: true, Count: 2},
+			Expected: []timeseries.Sample{{90, 9}, {80, 8}},
+		},
+		{
+			Name:     "filters",
+			Query:    timeseries.Query{To: 100, FilterByTS: []int64{10, 20, 30}, FilterByValue: true, MinValue: 2, MaxValue: 5},
+			Expected: []timeseries.Sample{{20, 2}, {30, 3}},
+		},
+		{
+			Name:     "avg",
+			Query:    timeseries.Query{To: 100, Aggregation: timeseries.AggAvg, BucketDuration: 30},
+			Expected: []timeseries.Sample{{0, 1}, {30, 4}, {60, 7}, {90, 9}},
+		},
+		{
+			Name:     "count aligned",
+			Query:    timeseries.Query{To: 100, Aggregation: timeseries.AggCount, BucketDuration: 30, Align: 10},
+			Expected: []timeseries.Sample{{-20, 1}, {10, 3}, {40, 3}, {70, 3}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, c.Expected, s.Query(c.Query))
+		})
+	}
+}
+
+func TestSeries_compactionRules(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{})
+	s.AddRule(timeseries.NewRule("max", timeseries.AggMax, 10, 0))
+	s.AddRule(timeseries.NewRule("sum", timeseries.AggSum, 20, 0))
+
+	var compactions []timeseries.Compaction
+	for ts := int64(0); ts <= 40; ts += 5 {
+		res, err := s.Add(timeseries.Sample{Timestamp: ts, Value: float64(ts)}, "")
+		require.NoError(t, err)
+		compactions = append(compactions, res...)
+	}
+
+	assert.Equal(t, []timeseries.Compaction{
+		{Dest: "max", Sample: timeseries.Sample{Timestamp: 0, Value: 5}},
+		{Dest: "max", Sample: timeseries.Sample{Timestamp: 10, Value: 15}},
+		{Dest: "sum", Sample: timeseries.Sample{Timestamp: 0, Value: 30}},
+		{Dest: "max", Sample: timeseries.Sample{Timestamp: 20, Value: 25}},
+		{Dest: "max", Sample: timeseries.Sample{Timestamp: 30, Value: 35}},
+		{Dest: "sum", Sample: timeseries.Sample{Timestamp: 20, Value: 110}},
+	}, compactions)
+}
+
+func TestSeries_compactionRules_upsert(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{DuplicatePolicy: timeseries.PolicyLast})
+	s.AddRule(timeseries.NewRule("sum", timeseries.AggSum, 10, 0))
+	for _, ts := range []int64{0, 5, 10, 12, 20} {
+		_, err := s.Add(timeseries.Sample{Timestamp: ts, Value: float64(ts)}, "")
+		require.NoError(t, err)
+	}
+
+	// Closed buckets are emitted again.
+	compactions, err := s.Add(timeseries.Sample{Timestamp: 3, Value: 3}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []timeseries.Compaction{{Dest: "sum", Sample: timeseries.Sample{Timestamp: 0, Value: 8}}}, compactions)
+	compactions, err = s.Add(timeseries.Sample{Timestamp: 12, Value: 11}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []timeseries.Compaction{{Dest: "sum", Sample: timeseries.Sample{Timestamp: 10, Value: 21}}}, compactions)
+
+	// The open bucket is rebuilt, so it is emitted with the upserted sample once it is closed.
+	compactions, err = s.Add(timeseries.Sample{Timestamp: 20, Value: 1}, "")
+	require.NoError(t, err)
+	assert.Empty(t, compactions)
+	_, err = s.Add(timeseries.Sample{Timestamp: 25, Value: 2}, "")
+	require.NoError(t, err)
+	compactions, err = s.Add(timeseries.Sample{Timestamp: 30, Value: 0}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []timeseries.Compaction{{Dest: "sum", Sample: timeseries.Sample{Timestamp: 20, Value: 3}}}, compactions)
+}
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{Labels: []timeseries.Label{{"area", "eu"}, {"sensor", "1"}}})
+	cases := map[string]bool{
+		"area=eu":         true,
+		"area=us":         false,
+		"area=(us,eu)":    true,
+		"area!=eu":        false,
+		"area!=(us,asia)": true,
+		"room=":           true,
+		"area=":           false,
+		"area!=":          true,
+		"room!=":          false,
+	}
+	for expr, expected := range cases {
+		m, err := timeseries.ParseMatcher(expr)
+		require.NoError(t, err)
+		assert.Equal(t, expected, m.Match(s), expr)
+	}
+
+	_, err := timeseries.ParseMatcher("=value")
+	assert.ErrorIs(t, err, timeseries.ErrInvalidFilter)
+}
+
+func TestSeries_Clone(t *testing.T) {
+	t.Parallel()
+	s := timeseries.New(timeseries.Options{ChunkSize: 128, Labels: []timeseries.Label{{Name: "a", Value: "b"}}})
+	s.AddRule(timeseries.NewRule("dest", timeseries.AggSum, 10, 0))
+	for ts := int64(0); ts < 100; ts++ {
+		_, err := s.Add(timeseries.Sample{Timestamp: ts, Value: float64(ts)}, "")
+		require.NoError(t, err)
+	}
+
+	c := s.Clone()
+	_, err := s.Add(timeseries.Sample{Timestamp: 100, Value: 100}, "")
+	require.NoError(t, err)
+	s.Labels()[0].Value = "changed"
+
+	assert.Equal(t, 100, c.Len())
+	assert.Equal(t, s.Range(0, 99), c.Range(0, 99))
+	assert.Equal(t, "b", c.Labels()[0].Value)
+
+	// Compaction rules keep their own state.
+	compactions, err := c.Add(timeseries.Sample{Timestamp: 100, Value: 100}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []timeseries.Compaction{{Dest: "dest", Sample: timeseries.Sample{Timestamp: 90, Value: 945}}}, compactions)
+}